@@ -0,0 +1,788 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/region"
+	"github.com/tsuna/gohbase/regioninfo"
+	"github.com/tsuna/gohbase/zk"
+	"golang.org/x/net/context"
+)
+
+//go:generate mockgen -destination=test/mock/admin_client.go -package=mock github.com/tsuna/gohbase AdminClient
+
+// AdminClient sends administrative RPCs to the active HBase Master.
+type AdminClient interface {
+	// SetBalancer turns the load balancer on or off, waiting for any
+	// balancing in progress to complete, and returns its previous state.
+	SetBalancer(ctx context.Context, on bool) (bool, error)
+	// IsBalancerEnabled returns whether the load balancer is on.
+	IsBalancerEnabled(ctx context.Context) (bool, error)
+	// SetNormalizer turns the region normalizer on or off, and returns its
+	// previous state.
+	SetNormalizer(ctx context.Context, on bool) (bool, error)
+	// IsNormalizerEnabled returns whether the region normalizer is on.
+	IsNormalizerEnabled(ctx context.Context) (bool, error)
+	// Normalize runs the region normalizer, and returns whether it ran.
+	Normalize(ctx context.Context) (bool, error)
+	// CompactionState returns the compaction state of a table, combining
+	// those of its regions: a table is being major compacted if any of its
+	// regions is, and so on.
+	CompactionState(ctx context.Context, table string) (pb.GetRegionInfoResponse_CompactionState, error)
+	// RegionCompactionState returns the compaction state of a region.
+	RegionCompactionState(ctx context.Context, regionName []byte) (pb.GetRegionInfoResponse_CompactionState, error)
+	// RollWALWriter makes the RegionServer at the given "host:port" roll its
+	// write-ahead log, and returns the encoded names of the regions to flush
+	// so that old logs can be archived (always empty since HBase 1.0).
+	RollWALWriter(ctx context.Context, server string) ([][]byte, error)
+	// OnlineRegions returns the regions served by the RegionServer at the
+	// given "host:port", according to that RegionServer.
+	OnlineRegions(ctx context.Context, server string) ([]*pb.RegionInfo, error)
+	// ServerInfo returns the name, with its start code, and the port of the
+	// web UI of the RegionServer at the given "host:port".
+	ServerInfo(ctx context.Context, server string) (*pb.ServerInfo, error)
+	// RegionInfo returns the description and compaction state of the region
+	// with the given name, asking the RegionServer at the given "host:port"
+	// rather than the one hbase:meta says serves it.
+	RegionInfo(ctx context.Context, server string,
+		regionName []byte) (*pb.GetRegionInfoResponse, error)
+	// CloseRegion makes the RegionServer at the given "host:port" close the
+	// region with the given name, bypassing the Master, and returns whether
+	// it was closed.  The region stays offline until it's assigned again.
+	CloseRegion(ctx context.Context, server string, regionName []byte) (bool, error)
+	// ClearBlockCache evicts the blocks of the regions of a table from the
+	// block caches of their RegionServers, and returns the combined eviction
+	// statistics, which list the regions that failed.
+	ClearBlockCache(ctx context.Context, table string) (*pb.CacheEvictionStats, error)
+	// ClearRegionBlockCache evicts the blocks of a region from the block
+	// cache of its RegionServer, and returns the eviction statistics.
+	ClearRegionBlockCache(ctx context.Context, regionName []byte) (*pb.CacheEvictionStats, error)
+	// ClearDeadServers makes the Master forget the given dead RegionServers,
+	// as listed by the cluster status, and returns those it couldn't forget,
+	// for instance because their failure is still being processed.
+	ClearDeadServers(ctx context.Context, servers []*pb.ServerName) ([]*pb.ServerName, error)
+	// ClusterStatus returns the status of the cluster, as seen by the Master.
+	ClusterStatus(ctx context.Context) (*pb.ClusterStatus, error)
+	// RegionsInTransition returns the regions being opened, closed, split,
+	// etc. according to the Master.
+	RegionsInTransition(ctx context.Context) ([]*pb.RegionInTransition, error)
+	// WaitForRegionsInTransition blocks until no region is in transition,
+	// polling the Master with the given interval.
+	WaitForRegionsInTransition(ctx context.Context, interval time.Duration) error
+	// RegionAssignments lists the regions of a table and where they're
+	// assigned, sorted by start key.
+	RegionAssignments(ctx context.Context, table string) ([]RegionAssignment, error)
+	// TableExists returns whether the given table exists, according to the
+	// Master.
+	TableExists(ctx context.Context, table string) (bool, error)
+	// IsTableEnabled returns whether the given table is enabled, according to
+	// its state in ZooKeeper.  It returns ErrTableNotFound if the table
+	// doesn't exist.
+	IsTableEnabled(ctx context.Context, table string) (bool, error)
+	// IsTableAvailable returns whether the given table exists, is enabled and
+	// has all its regions assigned in hbase:meta, meaning it can serve
+	// requests.
+	IsTableAvailable(ctx context.Context, table string) (bool, error)
+	// UserPermissions returns the permissions granted on the given scope,
+	// which is either a table name, a namespace name prefixed with "@", or
+	// empty for the permissions granted globally.  It requires the
+	// AccessController coprocessor to be loaded by the Master.
+	UserPermissions(ctx context.Context, scope string) ([]*pb.UserPermission, error)
+	// HasPermission returns whether the user of the client has the given
+	// permission, according to the AccessController coprocessor of the Master.
+	HasPermission(ctx context.Context, perm *pb.Permission) (bool, error)
+	// RegionLocality lists the regions of a table along with the locality of
+	// their data to the RegionServers serving them, and their favored nodes,
+	// sorted by start key.
+	RegionLocality(ctx context.Context, table string) ([]RegionLocality, error)
+	// CheckConsistency cross-checks hbase:meta, ZooKeeper and the regions the
+	// RegionServers report serving, and returns the inconsistencies found,
+	// like hbck does without fixing anything.
+	CheckConsistency(ctx context.Context) ([]Inconsistency, error)
+	// SnapshotScan takes a snapshot of the given table, clones it to a
+	// temporary table and calls scan with a client and the name of that
+	// table, so that it's read as of the snapshot without load on the table
+	// itself.  The clone and the snapshot are deleted once scan returns,
+	// even if it fails, and SnapshotScan returns the first error of scan
+	// or of the cleanup.
+	SnapshotScan(ctx context.Context, table string, scan func(c Client, clone string) error) error
+	// Close closes the connections to the Master and RegionServers.
+	Close() error
+}
+
+// RegionAssignment describes a region of a table and where it's assigned.
+type RegionAssignment struct {
+	// Full and encoded names of the region.
+	RegionName  []byte
+	EncodedName string
+	// Boundaries of the region, StopKey being empty for the last region.
+	StartKey []byte
+	StopKey  []byte
+	// "host:port" of the RegionServer the region is assigned to according to
+	// hbase:meta, empty if it's unassigned.
+	Server string
+	// Whether that RegionServer is alive and reports serving the region,
+	// according to the cluster status.
+	Online bool
+	// State of the region if it's in transition, nil otherwise.
+	Transition *pb.RegionState_State
+}
+
+// ErrRegionNotFound is returned when a request targets a region that doesn't
+// exist in hbase:meta.
+var ErrRegionNotFound = errors.New("region not found")
+
+// Locates the active Master.  Overridable for tests.
+var locateMaster = zk.LocateMaster
+
+// Reads the state of a table in ZooKeeper.  Overridable for tests.
+var tableState = zk.TableState
+
+// Locates the RegionServer serving hbase:meta.  Overridable for tests.
+var locateMeta = zk.LocateMeta
+
+// Full name of the coprocessor service managing permissions.
+const accessControlService = "hbase.pb.AccessControlService"
+
+// Key of the connection to the Master in adminClient.conns.
+const masterAddr = ""
+
+type adminClient struct {
+	// Configuration, as given by the options, and client used to read
+	// hbase:meta.
+	cfg *client
+
+	// Protects conns.
+	m sync.Mutex
+	// Connections to the Master and to the AdminService of RegionServers,
+	// keyed by "host:port" (masterAddr for the Master).
+	conns map[string]RegionClient
+}
+
+// NewAdminClient creates a new AdminClient, which locates the Master through
+// the given ZooKeeper quorum.  It accepts the same options as NewClient.
+func NewAdminClient(zkquorum string, options ...Option) AdminClient {
+	return &adminClient{
+		cfg:   newClient(zkquorum, options...),
+		conns: make(map[string]RegionClient),
+	}
+}
+
+// Returns the connection to the Master or to the RegionServer at the given
+// address, establishing it if needed.
+func (a *adminClient) connection(ctx context.Context, addr string) (RegionClient, error) {
+	a.m.Lock()
+	conn := a.conns[addr]
+	a.m.Unlock()
+	if conn != nil {
+		return conn, nil
+	}
+
+	type result struct {
+		client RegionClient
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var host string
+		var port uint16
+		var err error
+		service := region.AdminService
+		if addr == masterAddr {
+			service = region.MasterService
+			host, port, err = locateMaster(a.cfg.zkquorum)
+			if err == nil {
+				log.WithFields(log.Fields{
+					"Host": host,
+					"Port": port,
+				}).Debug("Located the Master in ZooKeeper")
+			}
+		} else {
+			var portStr string
+			host, portStr, err = net.SplitHostPort(addr)
+			if err == nil {
+				var port64 uint64
+				port64, err = strconv.ParseUint(portStr, 10, 16)
+				port = uint16(port64)
+			}
+		}
+		if err != nil {
+			done <- result{nil, err}
+			return
+		}
+		options := append([]region.Option{region.Service(service)},
+			a.cfg.regionOptions...)
+		queueSize, flushInterval := a.cfg.queueTuning()
+		client, err := a.cfg.newRegionClient(host, port, queueSize, flushInterval,
+			options...)
+		done <- result{client, err}
+	}()
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return nil, res.err
+		}
+		a.m.Lock()
+		if conn = a.conns[addr]; conn == nil {
+			conn = res.client
+			a.conns[addr] = conn
+		} else {
+			res.client.Close(ctx)
+		}
+		a.m.Unlock()
+		return conn, nil
+	case <-ctx.Done():
+		return nil, ErrDeadline
+	}
+}
+
+// Forgets the given connection, so that the next RPC connects again, to what
+// may be a new active Master.
+func (a *adminClient) resetConnection(addr string, conn RegionClient) {
+	a.m.Lock()
+	if a.conns[addr] == conn {
+		delete(a.conns, addr)
+	}
+	a.m.Unlock()
+	conn.Close(context.Background())
+}
+
+// Sends the given RPC to the Master or to the RegionServer at the given
+// address. RPCs to the Master are retried until the deadline of the call, as
+// a new active Master may take over. RPCs to a RegionServer are not: they're
+// about regions it may not host, and some, like CloseRegion, aren't
+// idempotent.
+func (a *adminClient) sendRPC(rpc hrpc.Call, addr string) (proto.Message, error) {
+	ctx := rpc.GetContext()
+	if rpc.Priority() == hrpc.NormalPriority {
+		// Administrative RPCs don't queue behind the user traffic.
+		rpc.SetPriority(hrpc.AdminPriority)
+	}
+	for {
+		conn, err := a.connection(ctx, addr)
+		if err == ErrDeadline {
+			return nil, err
+		} else if err == nil {
+			if err = conn.QueueRPC(rpc); err != nil {
+				// The connection is dead if the RPC can't be queued.
+				a.resetConnection(addr, conn)
+			} else {
+				select {
+				case res := <-rpc.GetResultChan():
+					err = res.Error
+					switch err.(type) {
+					case region.RetryableError, region.RegionMovedError:
+						// The call failed, not the connection.
+					case region.UnrecoverableError:
+						a.resetConnection(addr, conn)
+					default:
+						return res.Msg, err
+					}
+				case <-ctx.Done():
+					return nil, ErrDeadline
+				}
+			}
+		}
+		if addr != masterAddr {
+			return nil, err
+		}
+		log.WithFields(log.Fields{
+			"Type":   rpc.GetName(),
+			"Server": addr,
+			"Error":  err,
+		}).Debug("Failed to send an admin RPC, retrying")
+		select {
+		case <-time.After(100 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ErrDeadline
+		}
+	}
+}
+
+func (a *adminClient) SetBalancer(ctx context.Context, on bool) (bool, error) {
+	res, err := a.sendRPC(hrpc.NewSetBalancer(ctx, on), masterAddr)
+	if err != nil {
+		return false, err
+	}
+	return res.(*pb.SetBalancerRunningResponse).GetPrevBalanceValue(), nil
+}
+
+func (a *adminClient) IsBalancerEnabled(ctx context.Context) (bool, error) {
+	res, err := a.sendRPC(hrpc.NewIsBalancerEnabled(ctx), masterAddr)
+	if err != nil {
+		return false, err
+	}
+	return res.(*pb.IsBalancerEnabledResponse).GetEnabled(), nil
+}
+
+func (a *adminClient) SetNormalizer(ctx context.Context, on bool) (bool, error) {
+	res, err := a.sendRPC(hrpc.NewSetNormalizer(ctx, on), masterAddr)
+	if err != nil {
+		return false, err
+	}
+	return res.(*pb.SetNormalizerRunningResponse).GetPrevNormalizerValue(), nil
+}
+
+func (a *adminClient) IsNormalizerEnabled(ctx context.Context) (bool, error) {
+	res, err := a.sendRPC(hrpc.NewIsNormalizerEnabled(ctx), masterAddr)
+	if err != nil {
+		return false, err
+	}
+	return res.(*pb.IsNormalizerEnabledResponse).GetEnabled(), nil
+}
+
+func (a *adminClient) Normalize(ctx context.Context) (bool, error) {
+	res, err := a.sendRPC(hrpc.NewNormalize(ctx), masterAddr)
+	if err != nil {
+		return false, err
+	}
+	return res.(*pb.NormalizeResponse).GetNormalizerRan(), nil
+}
+
+// Returns the region with the given name and the address of its RegionServer.
+func (a *adminClient) locateRegion(ctx context.Context, regionName []byte) (*regioninfo.Info, string, error) {
+	get, err := hrpc.NewGet(ctx, metaTableName, regionName, hrpc.Families(infoFamily))
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := a.cfg.Get(get)
+	if err != nil {
+		return nil, "", err
+	} else if resp.Result == nil || len(resp.Result.Cell) == 0 {
+		return nil, "", ErrRegionNotFound
+	}
+	reg, host, port, err := parseMetaRow(resp.Result)
+	if err != nil {
+		return nil, "", err
+	} else if host == "" {
+		return nil, "", fmt.Errorf("region %s is not assigned", regionName)
+	}
+	return reg, net.JoinHostPort(host, strconv.Itoa(int(port))), nil
+}
+
+// Returns the compaction state of the given region hosted at the given
+// address.
+func (a *adminClient) compactionState(ctx context.Context, reg *regioninfo.Info,
+	addr string) (pb.GetRegionInfoResponse_CompactionState, error) {
+	res, err := a.sendRPC(hrpc.NewGetRegionInfo(ctx, reg), addr)
+	if err != nil {
+		return pb.GetRegionInfoResponse_NONE, err
+	}
+	return res.(*pb.GetRegionInfoResponse).GetCompactionState(), nil
+}
+
+func (a *adminClient) CompactionState(ctx context.Context,
+	table string) (pb.GetRegionInfoResponse_CompactionState, error) {
+	rows, err := scanTableMeta(ctx, a.cfg, table)
+	if err != nil {
+		return pb.GetRegionInfoResponse_NONE, err
+	}
+	var major, minor bool
+	for _, row := range rows {
+		reg, host, port, err := parseMetaRow(row)
+		if err != nil {
+			return pb.GetRegionInfoResponse_NONE, err
+		} else if host == "" {
+			continue // Not assigned, so not compacting.
+		}
+		state, err := a.compactionState(ctx, reg,
+			net.JoinHostPort(host, strconv.Itoa(int(port))))
+		if err != nil {
+			return pb.GetRegionInfoResponse_NONE, err
+		}
+		switch state {
+		case pb.GetRegionInfoResponse_MAJOR_AND_MINOR:
+			return state, nil
+		case pb.GetRegionInfoResponse_MAJOR:
+			major = true
+		case pb.GetRegionInfoResponse_MINOR:
+			minor = true
+		}
+	}
+	switch {
+	case major && minor:
+		return pb.GetRegionInfoResponse_MAJOR_AND_MINOR, nil
+	case major:
+		return pb.GetRegionInfoResponse_MAJOR, nil
+	case minor:
+		return pb.GetRegionInfoResponse_MINOR, nil
+	}
+	return pb.GetRegionInfoResponse_NONE, nil
+}
+
+func (a *adminClient) RegionCompactionState(ctx context.Context,
+	regionName []byte) (pb.GetRegionInfoResponse_CompactionState, error) {
+	reg, addr, err := a.locateRegion(ctx, regionName)
+	if err != nil {
+		return pb.GetRegionInfoResponse_NONE, err
+	}
+	return a.compactionState(ctx, reg, addr)
+}
+
+// Sends the given RPC to the AdminService of the RegionServer at the given
+// address.
+func (a *adminClient) sendRegionServerRPC(rpc hrpc.Call, server string) (proto.Message, error) {
+	if server == masterAddr {
+		return nil, errors.New("no RegionServer given")
+	}
+	return a.sendRPC(rpc, server)
+}
+
+func (a *adminClient) RollWALWriter(ctx context.Context, server string) ([][]byte, error) {
+	res, err := a.sendRegionServerRPC(hrpc.NewRollWALWriter(ctx), server)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*pb.RollWALWriterResponse).RegionToFlush, nil
+}
+
+func (a *adminClient) OnlineRegions(ctx context.Context, server string) ([]*pb.RegionInfo, error) {
+	res, err := a.sendRegionServerRPC(hrpc.NewGetOnlineRegion(ctx), server)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*pb.GetOnlineRegionResponse).RegionInfo, nil
+}
+
+func (a *adminClient) ServerInfo(ctx context.Context, server string) (*pb.ServerInfo, error) {
+	res, err := a.sendRegionServerRPC(hrpc.NewGetServerInfo(ctx), server)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*pb.GetServerInfoResponse).ServerInfo, nil
+}
+
+func (a *adminClient) RegionInfo(ctx context.Context, server string,
+	regionName []byte) (*pb.GetRegionInfoResponse, error) {
+	rpc := hrpc.NewGetRegionInfo(ctx, &regioninfo.Info{RegionName: regionName})
+	res, err := a.sendRegionServerRPC(rpc, server)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*pb.GetRegionInfoResponse), nil
+}
+
+func (a *adminClient) CloseRegion(ctx context.Context, server string,
+	regionName []byte) (bool, error) {
+	res, err := a.sendRegionServerRPC(hrpc.NewCloseRegion(ctx, regionName), server)
+	if err != nil {
+		return false, err
+	}
+	return res.(*pb.CloseRegionResponse).GetClosed(), nil
+}
+
+// Evicts the blocks of the given regions from the block cache of the
+// RegionServer at the given address.
+func (a *adminClient) clearBlockCache(ctx context.Context, addr string,
+	regionNames [][]byte) (*pb.CacheEvictionStats, error) {
+	res, err := a.sendRegionServerRPC(hrpc.NewClearRegionBlockCache(ctx, regionNames), addr)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*pb.ClearRegionBlockCacheResponse).Stats, nil
+}
+
+func (a *adminClient) ClearBlockCache(ctx context.Context, table string) (*pb.CacheEvictionStats, error) {
+	rows, err := scanTableMeta(ctx, a.cfg, table)
+	if err != nil {
+		return nil, err
+	}
+	regions := make(map[string][][]byte)
+	for _, row := range rows {
+		reg, host, port, err := parseMetaRow(row)
+		if err != nil {
+			return nil, err
+		} else if host == "" {
+			continue // Not assigned, so nothing cached.
+		}
+		addr := net.JoinHostPort(host, strconv.Itoa(int(port)))
+		regions[addr] = append(regions[addr], reg.RegionName)
+	}
+	addrs := make([]string, 0, len(regions))
+	for addr := range regions {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	var evictions, evicted, cacheSize int64
+	total := &pb.CacheEvictionStats{}
+	for _, addr := range addrs {
+		stats, err := a.clearBlockCache(ctx, addr, regions[addr])
+		if err != nil {
+			return nil, err
+		}
+		evictions += stats.GetEvictionCount()
+		evicted += stats.GetBytesEvicted()
+		cacheSize += stats.GetMaxCacheSize()
+		total.Exception = append(total.Exception, stats.Exception...)
+	}
+	total.EvictionCount = &evictions
+	total.BytesEvicted = &evicted
+	total.MaxCacheSize = &cacheSize
+	return total, nil
+}
+
+func (a *adminClient) ClearRegionBlockCache(ctx context.Context,
+	regionName []byte) (*pb.CacheEvictionStats, error) {
+	reg, addr, err := a.locateRegion(ctx, regionName)
+	if err != nil {
+		return nil, err
+	}
+	return a.clearBlockCache(ctx, addr, [][]byte{reg.RegionName})
+}
+
+func (a *adminClient) ClearDeadServers(ctx context.Context,
+	servers []*pb.ServerName) ([]*pb.ServerName, error) {
+	res, err := a.sendRPC(hrpc.NewClearDeadServers(ctx, servers), masterAddr)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*pb.ClearDeadServersResponse).ServerName, nil
+}
+
+func (a *adminClient) ClusterStatus(ctx context.Context) (*pb.ClusterStatus, error) {
+	res, err := a.sendRPC(hrpc.NewGetClusterStatus(ctx), masterAddr)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*pb.GetClusterStatusResponse).ClusterStatus, nil
+}
+
+func (a *adminClient) RegionsInTransition(ctx context.Context) ([]*pb.RegionInTransition, error) {
+	status, err := a.ClusterStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return status.RegionsInTransition, nil
+}
+
+func (a *adminClient) WaitForRegionsInTransition(ctx context.Context, interval time.Duration) error {
+	for {
+		rits, err := a.RegionsInTransition(ctx)
+		if err != nil {
+			return err
+		} else if len(rits) == 0 {
+			return nil
+		}
+		log.WithFields(log.Fields{
+			"Count": len(rits),
+		}).Debug("Waiting for regions in transition")
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ErrDeadline
+		}
+	}
+}
+
+func (a *adminClient) RegionAssignments(ctx context.Context, table string) ([]RegionAssignment, error) {
+	rows, err := scanTableMeta(ctx, a.cfg, table)
+	if err != nil {
+		return nil, err
+	}
+	status, err := a.ClusterStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return regionAssignments(rows, status)
+}
+
+// Returns the assignments of the regions described by the given rows of
+// hbase:meta, in the same order.
+func regionAssignments(rows []*pb.Result, status *pb.ClusterStatus) ([]RegionAssignment, error) {
+	// The regions each live RegionServer reports serving.
+	online := make(map[string]map[string]struct{})
+	for _, live := range status.LiveServers {
+		addr := net.JoinHostPort(live.Server.GetHostName(),
+			strconv.Itoa(int(live.Server.GetPort())))
+		regions := make(map[string]struct{})
+		for _, load := range live.ServerLoad.GetRegionLoads() {
+			regions[string(load.RegionSpecifier.GetValue())] = struct{}{}
+		}
+		online[addr] = regions
+	}
+	transitions := make(map[string]pb.RegionState_State)
+	for _, rit := range status.RegionsInTransition {
+		transitions[string(rit.Spec.GetValue())] = rit.RegionState.GetState()
+	}
+
+	assignments := make([]RegionAssignment, 0, len(rows))
+	for _, row := range rows {
+		reg, host, port, err := parseMetaRow(row)
+		if err != nil {
+			return nil, err
+		}
+		assignment := RegionAssignment{
+			RegionName:  reg.RegionName,
+			EncodedName: encodedName(reg.RegionName),
+			StartKey:    reg.StartKey,
+			StopKey:     reg.StopKey,
+		}
+		if host != "" {
+			assignment.Server = net.JoinHostPort(host, strconv.Itoa(int(port)))
+			_, assignment.Online = online[assignment.Server][string(reg.RegionName)]
+		}
+		if state, ok := transitions[string(reg.RegionName)]; ok {
+			assignment.Transition = &state
+		} else if state, ok = transitions[assignment.EncodedName]; ok {
+			assignment.Transition = &state
+		}
+		assignments = append(assignments, assignment)
+	}
+	return assignments, nil
+}
+
+func (a *adminClient) TableExists(ctx context.Context, table string) (bool, error) {
+	res, err := a.sendRPC(hrpc.NewGetTableDescriptors(ctx, table), masterAddr)
+	if err != nil {
+		return false, err
+	}
+	return len(res.(*pb.GetTableDescriptorsResponse).TableSchema) != 0, nil
+}
+
+func (a *adminClient) IsTableEnabled(ctx context.Context, table string) (bool, error) {
+	if exists, err := a.TableExists(ctx, table); err != nil {
+		return false, err
+	} else if !exists {
+		return false, ErrTableNotFound
+	}
+	state, err := a.readTableState(ctx, table)
+	if err != nil {
+		return false, err
+	}
+	return state == pb.Table_ENABLED, nil
+}
+
+// Reads the state of a table in ZooKeeper.
+func (a *adminClient) readTableState(ctx context.Context, table string) (pb.Table_State, error) {
+	// ZooKeeper calls can't be interrupted, so give up waiting on them
+	// when the deadline passes.
+	type result struct {
+		state pb.Table_State
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		state, err := tableState(a.cfg.zkquorum, table)
+		done <- result{state, err}
+	}()
+	select {
+	case res := <-done:
+		return res.state, res.err
+	case <-ctx.Done():
+		return pb.Table_ENABLED, ErrDeadline
+	}
+}
+
+func (a *adminClient) IsTableAvailable(ctx context.Context, table string) (bool, error) {
+	enabled, err := a.IsTableEnabled(ctx, table)
+	if err == ErrTableNotFound {
+		return false, nil
+	} else if err != nil || !enabled {
+		return false, err
+	}
+	rows, err := scanTableMeta(ctx, a.cfg, table)
+	if err == ErrTableNotFound {
+		return false, nil // Regions not created yet.
+	} else if err != nil {
+		return false, err
+	}
+	for _, row := range rows {
+		_, host, _, err := parseMetaRow(row)
+		if err != nil {
+			return false, err
+		} else if host == "" {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Calls the given method of a coprocessor service of the Master, and
+// deserializes its response into resp.
+func (a *adminClient) execMasterService(ctx context.Context, service, method string,
+	req, resp proto.Message) error {
+	call, err := hrpc.NewExecMasterService(ctx, service, method, req)
+	if err != nil {
+		return err
+	}
+	res, err := a.sendRPC(call, masterAddr)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(res.(*pb.CoprocessorServiceResponse).GetValue().GetValue(), resp)
+}
+
+func (a *adminClient) UserPermissions(ctx context.Context, scope string) ([]*pb.UserPermission, error) {
+	req := &pb.GetUserPermissionsRequest{}
+	switch {
+	case scope == "":
+		req.Type = pb.Permission_Global.Enum()
+	case scope[0] == '@':
+		req.Type = pb.Permission_Namespace.Enum()
+		req.NamespaceName = []byte(scope[1:])
+	default:
+		req.Type = pb.Permission_Table.Enum()
+		req.TableName = hrpc.ParseTableName(scope)
+	}
+	resp := &pb.GetUserPermissionsResponse{}
+	if err := a.execMasterService(ctx, accessControlService, "GetUserPermissions",
+		req, resp); err != nil {
+		return nil, err
+	}
+	return resp.UserPermission, nil
+}
+
+func (a *adminClient) HasPermission(ctx context.Context, perm *pb.Permission) (bool, error) {
+	req := &pb.CheckPermissionsRequest{Permission: []*pb.Permission{perm}}
+	err := a.execMasterService(ctx, accessControlService, "CheckPermissions",
+		req, &pb.CheckPermissionsResponse{})
+	if e, ok := err.(region.DoNotRetryError); ok && e.Exception == region.AccessDeniedException {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Returns the encoded name of the region with the given name, which is the
+// part between its last two dots ("table,startkey,id.encoded.").
+func encodedName(regionName []byte) string {
+	if len(regionName) < 2 || regionName[len(regionName)-1] != '.' {
+		return "" // Old format, without encoded name.
+	}
+	name := regionName[:len(regionName)-1]
+	dot := bytes.LastIndexByte(name, '.')
+	if dot < 0 {
+		return ""
+	}
+	return string(name[dot+1:])
+}
+
+func (a *adminClient) Close() error {
+	a.m.Lock()
+	conns := a.conns
+	a.conns = make(map[string]RegionClient)
+	a.m.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	for _, conn := range conns {
+		conn.Close(ctx)
+	}
+	return a.cfg.Close()
+}
@@ -0,0 +1,466 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/region"
+	"github.com/tsuna/gohbase/test/fakehbase"
+	"golang.org/x/net/context"
+)
+
+// Makes the given fake server the active Master, until the returned function
+// is called.
+func setFakeMaster(s *fakehbase.Server) func() {
+	savedLocateMaster := locateMaster
+	locateMaster = func(string) (string, uint16, error) {
+		return s.Host(), s.Port(), nil
+	}
+	return func() { locateMaster = savedLocateMaster }
+}
+
+func TestAdminSwitches(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	defer setFakeMaster(s)()
+	ac := NewAdminClient("~invalid.quorum~")
+	defer ac.Close()
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	if prev, err := ac.SetBalancer(ctx, false); err != nil || !prev {
+		t.Errorf("SetBalancer returned %v, %v", prev, err)
+	}
+	if on, err := ac.IsBalancerEnabled(ctx); err != nil || on {
+		t.Errorf("IsBalancerEnabled returned %v, %v", on, err)
+	}
+	if prev, err := ac.SetNormalizer(ctx, false); err != nil || !prev {
+		t.Errorf("SetNormalizer returned %v, %v", prev, err)
+	}
+	if on, err := ac.IsNormalizerEnabled(ctx); err != nil || on {
+		t.Errorf("IsNormalizerEnabled returned %v, %v", on, err)
+	}
+	if ran, err := ac.Normalize(ctx); err != nil || ran {
+		t.Errorf("Normalize returned %v, %v", ran, err)
+	}
+}
+
+func TestAdminReconnects(t *testing.T) {
+	s := newFakeServer(t)
+	restore := setFakeMaster(s)
+	ac := NewAdminClient("~invalid.quorum~")
+	defer ac.Close()
+	ctx, cancel := newTestContext()
+	defer cancel()
+	if _, err := ac.IsBalancerEnabled(ctx); err != nil {
+		t.Fatalf("IsBalancerEnabled failed: %s", err)
+	}
+
+	// The Master dies, and a new one takes over.
+	s.Close()
+	s = newFakeServer(t)
+	defer s.Close()
+	restore()
+	defer setFakeMaster(s)()
+	if _, err := ac.IsBalancerEnabled(ctx); err != nil {
+		t.Errorf("IsBalancerEnabled failed after a Master failover: %s", err)
+	}
+}
+
+func TestCompactionState(t *testing.T) {
+	s, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+	ac := &adminClient{cfg: c, conns: make(map[string]RegionClient)}
+	defer ac.Close()
+
+	for _, state := range []pb.GetRegionInfoResponse_CompactionState{
+		pb.GetRegionInfoResponse_NONE,
+		pb.GetRegionInfoResponse_MAJOR,
+	} {
+		s.SetCompactionState("test", state)
+		if got, err := ac.CompactionState(ctx, "test"); err != nil || got != state {
+			t.Errorf("CompactionState returned %s, %v; expected %s", got, err, state)
+		}
+	}
+
+	rows, err := scanTableMeta(ctx, ac.cfg, "test")
+	if err != nil {
+		t.Fatalf("Failed to scan meta: %s", err)
+	}
+	reg, _, _, err := parseMetaRow(rows[0])
+	if err != nil {
+		t.Fatalf("Failed to parse the meta row: %s", err)
+	}
+	if got, err := ac.RegionCompactionState(ctx, reg.RegionName); err != nil ||
+		got != pb.GetRegionInfoResponse_MAJOR {
+		t.Errorf("RegionCompactionState returned %s, %v", got, err)
+	}
+	regionName := []byte("test,,1234567890042.")
+	if _, err = ac.RegionCompactionState(ctx, regionName); err != ErrRegionNotFound {
+		t.Errorf("Expected ErrRegionNotFound for a nonexistent region, got %v", err)
+	}
+	if _, err = ac.CompactionState(ctx, "nonexistent"); err != ErrTableNotFound {
+		t.Errorf("Expected ErrTableNotFound, got %v", err)
+	}
+}
+
+func TestTableChecks(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	defer setFakeMaster(s)()
+	s.CreateTable("test", []string{"cf"})
+	state := pb.Table_ENABLED
+	savedTableState := tableState
+	tableState = func(zkquorum, table string) (pb.Table_State, error) {
+		return state, nil
+	}
+	defer func() { tableState = savedTableState }()
+	ac := &adminClient{cfg: newFakeClient(t, s), conns: make(map[string]RegionClient)}
+	defer ac.Close()
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	if exists, err := ac.TableExists(ctx, "test"); err != nil || !exists {
+		t.Errorf("TableExists returned %v, %v", exists, err)
+	}
+	if exists, err := ac.TableExists(ctx, "default:test"); err != nil || !exists {
+		t.Errorf("TableExists returned %v, %v with a namespace", exists, err)
+	}
+	if enabled, err := ac.IsTableEnabled(ctx, "test"); err != nil || !enabled {
+		t.Errorf("IsTableEnabled returned %v, %v", enabled, err)
+	}
+	if available, err := ac.IsTableAvailable(ctx, "test"); err != nil || !available {
+		t.Errorf("IsTableAvailable returned %v, %v", available, err)
+	}
+
+	state = pb.Table_DISABLED
+	if enabled, err := ac.IsTableEnabled(ctx, "test"); err != nil || enabled {
+		t.Errorf("IsTableEnabled returned %v, %v for a disabled table", enabled, err)
+	}
+	if available, err := ac.IsTableAvailable(ctx, "test"); err != nil || available {
+		t.Errorf("IsTableAvailable returned %v, %v for a disabled table", available, err)
+	}
+
+	if exists, err := ac.TableExists(ctx, "nonexistent"); err != nil || exists {
+		t.Errorf("TableExists returned %v, %v for a nonexistent table", exists, err)
+	}
+	if _, err := ac.IsTableEnabled(ctx, "nonexistent"); err != ErrTableNotFound {
+		t.Errorf("Expected ErrTableNotFound, got %v", err)
+	}
+	if available, err := ac.IsTableAvailable(ctx, "nonexistent"); err != nil || available {
+		t.Errorf("IsTableAvailable returned %v, %v for a nonexistent table", available, err)
+	}
+}
+
+func TestRegionAssignments(t *testing.T) {
+	s, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+	defer setFakeMaster(s)()
+	ac := &adminClient{cfg: c, conns: make(map[string]RegionClient)}
+	defer ac.Close()
+
+	assignments, err := ac.RegionAssignments(ctx, "test")
+	if err != nil {
+		t.Fatalf("RegionAssignments failed: %s", err)
+	}
+	if len(assignments) != 1 {
+		t.Fatalf("Expected 1 region, got %v", assignments)
+	}
+	a := assignments[0]
+	server := net.JoinHostPort(s.Host(), strconv.Itoa(int(s.Port())))
+	if a.Server != server || !a.Online || a.Transition != nil ||
+		len(a.StartKey) != 0 || len(a.StopKey) != 0 || len(a.EncodedName) != 32 {
+		t.Errorf("Unexpected assignment %+v", a)
+	}
+}
+
+func TestEncodedName(t *testing.T) {
+	tests := map[string]string{
+		"test,,1234567890042.0123456789abcdef0123456789abcdef.":    "0123456789abcdef0123456789abcdef",
+		"test,a.b,1234567890042.0123456789abcdef0123456789abcdef.": "0123456789abcdef0123456789abcdef",
+		"hbase:meta,,1": "",
+	}
+	for name, expected := range tests {
+		if got := encodedName([]byte(name)); got != expected {
+			t.Errorf("encodedName(%q) = %q, expected %q", name, got, expected)
+		}
+	}
+}
+
+func TestRegionsInTransition(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	defer setFakeMaster(s)()
+	s.CreateTable("test", []string{"cf"})
+	ac := NewAdminClient("~invalid.quorum~")
+	defer ac.Close()
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	if err := ac.WaitForRegionsInTransition(ctx, time.Millisecond); err != nil {
+		t.Errorf("WaitForRegionsInTransition failed on a settled cluster: %s", err)
+	}
+
+	s.SetRegionInTransition("test", pb.RegionState_OPENING.Enum())
+	rits, err := ac.RegionsInTransition(ctx)
+	if err != nil {
+		t.Fatalf("RegionsInTransition failed: %s", err)
+	}
+	if len(rits) != 1 || rits[0].RegionState.GetState() != pb.RegionState_OPENING {
+		t.Errorf("Unexpected regions in transition %v", rits)
+	}
+
+	shortCtx, shortCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer shortCancel()
+	if err = ac.WaitForRegionsInTransition(shortCtx, time.Millisecond); err != ErrDeadline {
+		t.Errorf("Expected ErrDeadline while a region is in transition, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		s.SetRegionInTransition("test", nil)
+	}()
+	if err = ac.WaitForRegionsInTransition(ctx, time.Millisecond); err != nil {
+		t.Errorf("WaitForRegionsInTransition failed: %s", err)
+	}
+}
+
+func TestRollWALWriter(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	ac := NewAdminClient("~invalid.quorum~")
+	defer ac.Close()
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	server := net.JoinHostPort(s.Host(), strconv.Itoa(int(s.Port())))
+	if _, err := ac.RollWALWriter(ctx, server); err != nil {
+		t.Fatalf("RollWALWriter failed: %s", err)
+	}
+	if rolls := s.WALRolls(); rolls != 1 {
+		t.Errorf("Expected the WAL to be rolled once, got %d", rolls)
+	}
+}
+
+func TestRegionServerAdmin(t *testing.T) {
+	s, c, ctx, done := newFakeEnv(t, "test", "other")
+	defer done()
+	ac := &adminClient{cfg: c, conns: make(map[string]RegionClient)}
+	defer ac.Close()
+	server := net.JoinHostPort(s.Host(), strconv.Itoa(int(s.Port())))
+
+	info, err := ac.ServerInfo(ctx, server)
+	if err != nil {
+		t.Fatalf("ServerInfo failed: %s", err)
+	}
+	name := info.GetServerName()
+	if name.GetHostName() != s.Host() || name.GetPort() != uint32(s.Port()) ||
+		name.GetStartCode() == 0 || info.GetWebuiPort() == 0 {
+		t.Errorf("Unexpected server info %s", info)
+	}
+
+	regions, err := ac.OnlineRegions(ctx, server)
+	if err != nil {
+		t.Fatalf("OnlineRegions failed: %s", err)
+	}
+	if len(regions) != 2 || string(regions[0].TableName.Qualifier) != "other" ||
+		string(regions[1].TableName.Qualifier) != "test" {
+		t.Fatalf("Unexpected online regions %v", regions)
+	}
+
+	rows, err := scanTableMeta(ctx, ac.cfg, "test")
+	if err != nil {
+		t.Fatalf("Failed to scan meta: %s", err)
+	}
+	reg, _, _, err := parseMetaRow(rows[0])
+	if err != nil {
+		t.Fatalf("Failed to parse the meta row: %s", err)
+	}
+	resp, err := ac.RegionInfo(ctx, server, reg.RegionName)
+	if err != nil {
+		t.Fatalf("RegionInfo failed: %s", err)
+	}
+	if string(resp.GetRegionInfo().TableName.Qualifier) != "test" {
+		t.Errorf("Unexpected region info %s", resp)
+	}
+
+	if closed, err := ac.CloseRegion(ctx, server, reg.RegionName); err != nil || !closed {
+		t.Fatalf("CloseRegion returned %v, %v", closed, err)
+	}
+	if regions, err = ac.OnlineRegions(ctx, server); err != nil {
+		t.Fatalf("OnlineRegions failed: %s", err)
+	}
+	if len(regions) != 1 || string(regions[0].TableName.Qualifier) != "other" {
+		t.Errorf("Unexpected online regions after closing one %v", regions)
+	}
+
+	// The RegionServer no longer hosts the region, which isn't retried.
+	_, err = ac.CloseRegion(ctx, server, reg.RegionName)
+	if _, ok := err.(region.RetryableError); !ok {
+		t.Errorf("Expected a NotServingRegionException, got %#v", err)
+	}
+	_, err = ac.RegionInfo(ctx, server, reg.RegionName)
+	if _, ok := err.(region.RetryableError); !ok {
+		t.Errorf("Expected a NotServingRegionException, got %#v", err)
+	}
+	if ctx.Err() != nil {
+		t.Errorf("Expected the errors before the deadline, got %s", ctx.Err())
+	}
+
+	if _, err = ac.ServerInfo(ctx, ""); err == nil {
+		t.Error("Expected an error without a RegionServer")
+	}
+}
+
+func TestClearBlockCache(t *testing.T) {
+	s, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+	ac := &adminClient{cfg: c, conns: make(map[string]RegionClient)}
+	defer ac.Close()
+
+	stats, err := ac.ClearBlockCache(ctx, "test")
+	if err != nil {
+		t.Fatalf("ClearBlockCache failed: %s", err)
+	}
+	if stats.GetEvictionCount() != 1 || stats.GetBytesEvicted() == 0 ||
+		stats.GetMaxCacheSize() == 0 || len(stats.Exception) != 0 {
+		t.Errorf("Unexpected eviction stats %s", stats)
+	}
+	if _, err = ac.ClearBlockCache(ctx, "nonexistent"); err != ErrTableNotFound {
+		t.Errorf("Expected ErrTableNotFound, got %v", err)
+	}
+
+	rows, err := scanTableMeta(ctx, ac.cfg, "test")
+	if err != nil {
+		t.Fatalf("Failed to scan meta: %s", err)
+	}
+	reg, _, _, err := parseMetaRow(rows[0])
+	if err != nil {
+		t.Fatalf("Failed to parse the meta row: %s", err)
+	}
+	if stats, err = ac.ClearRegionBlockCache(ctx, reg.RegionName); err != nil {
+		t.Fatalf("ClearRegionBlockCache failed: %s", err)
+	}
+	if stats.GetEvictionCount() != 1 {
+		t.Errorf("Unexpected eviction stats %s", stats)
+	}
+
+	// The RegionServer reports the regions it doesn't serve.
+	server := net.JoinHostPort(s.Host(), strconv.Itoa(int(s.Port())))
+	if _, err = ac.CloseRegion(ctx, server, reg.RegionName); err != nil {
+		t.Fatalf("CloseRegion failed: %s", err)
+	}
+	if stats, err = ac.ClearBlockCache(ctx, "test"); err != nil {
+		t.Fatalf("ClearBlockCache failed: %s", err)
+	}
+	if stats.GetEvictionCount() != 0 || len(stats.Exception) != 1 ||
+		string(stats.Exception[0].Region.GetValue()) != string(reg.RegionName) {
+		t.Errorf("Unexpected eviction stats %s", stats)
+	}
+}
+
+func TestClearDeadServers(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	defer setFakeMaster(s)()
+	ac := NewAdminClient("~invalid.quorum~")
+	defer ac.Close()
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	dead := &pb.ServerName{
+		HostName:  proto.String("regionserver"),
+		Port:      proto.Uint32(16020),
+		StartCode: proto.Uint64(42),
+	}
+	s.AddDeadServer(dead)
+	status, err := ac.ClusterStatus(ctx)
+	if err != nil {
+		t.Fatalf("ClusterStatus failed: %s", err)
+	}
+	if len(status.DeadServers) != 1 {
+		t.Fatalf("Expected 1 dead server, got %v", status.DeadServers)
+	}
+
+	alive := &pb.ServerName{
+		HostName:  proto.String(s.Host()),
+		Port:      proto.Uint32(uint32(s.Port())),
+		StartCode: proto.Uint64(1),
+	}
+	notCleared, err := ac.ClearDeadServers(ctx, []*pb.ServerName{status.DeadServers[0], alive})
+	if err != nil {
+		t.Fatalf("ClearDeadServers failed: %s", err)
+	}
+	if len(notCleared) != 1 || !proto.Equal(notCleared[0], alive) {
+		t.Errorf("Expected only the live server not to be cleared, got %v", notCleared)
+	}
+	if status, err = ac.ClusterStatus(ctx); err != nil {
+		t.Fatalf("ClusterStatus failed: %s", err)
+	}
+	if len(status.DeadServers) != 0 {
+		t.Errorf("Expected no dead server left, got %v", status.DeadServers)
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	defer setFakeMaster(s)()
+	tablePerm := &pb.Permission{
+		Type: pb.Permission_Table.Enum(),
+		TablePermission: &pb.TablePermission{
+			TableName: hrpc.ParseTableName("test"),
+			Action:    []pb.Permission_Action{pb.Permission_READ, pb.Permission_WRITE},
+		},
+	}
+	nsPerm := &pb.Permission{
+		Type: pb.Permission_Namespace.Enum(),
+		NamespacePermission: &pb.NamespacePermission{
+			NamespaceName: []byte("ns"),
+			Action:        []pb.Permission_Action{pb.Permission_ADMIN},
+		},
+	}
+	s.Grant("gopher", tablePerm)
+	s.Grant("alice", nsPerm)
+	ac := NewAdminClient("~invalid.quorum~")
+	defer ac.Close()
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	for scope, user := range map[string]string{"test": "gopher", "@ns": "alice"} {
+		perms, err := ac.UserPermissions(ctx, scope)
+		if err != nil {
+			t.Fatalf("UserPermissions(%q) failed: %s", scope, err)
+		} else if len(perms) != 1 || string(perms[0].User) != user {
+			t.Errorf("Unexpected permissions on %q: %v", scope, perms)
+		}
+	}
+	if perms, err := ac.UserPermissions(ctx, ""); err != nil || len(perms) != 0 {
+		t.Errorf("Expected no global permissions, got %v, %v", perms, err)
+	}
+
+	read := &pb.Permission{
+		Type: pb.Permission_Table.Enum(),
+		TablePermission: &pb.TablePermission{
+			TableName: hrpc.ParseTableName("test"),
+			Family:    []byte("cf"),
+			Action:    []pb.Permission_Action{pb.Permission_READ},
+		},
+	}
+	if ok, err := ac.HasPermission(ctx, read); err != nil || !ok {
+		t.Errorf("HasPermission returned %v, %v for a granted permission", ok, err)
+	}
+	if ok, err := ac.HasPermission(ctx, nsPerm); err != nil || ok {
+		t.Errorf("HasPermission returned %v, %v for a permission of another user", ok, err)
+	}
+}
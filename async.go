@@ -0,0 +1,116 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"golang.org/x/net/context"
+)
+
+// The part of the futures common to all operations.
+type future struct {
+	done chan struct{}
+	err  error
+}
+
+// Done returns a channel closed once the operation is done.
+func (f *future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Err returns the error the operation failed with once it's done, nil if it
+// succeeded or isn't done yet.
+func (f *future) Err() error {
+	select {
+	case <-f.done:
+		return f.err
+	default:
+		return nil
+	}
+}
+
+// Waits for the operation to be done, or the context to be done first.
+func (f *future) wait(ctx context.Context) error {
+	select {
+	case <-f.done:
+		return f.err
+	case <-ctx.Done():
+		return ErrDeadline
+	}
+}
+
+// A GetFuture is the eventual outcome of a Get started with GetAsync.
+type GetFuture struct {
+	future
+	resp *pb.GetResponse
+}
+
+// Wait returns the response of the Get once it's done.  If the context is done
+// first, it returns ErrDeadline, while the Get goes on until its own context
+// is done.
+func (f *GetFuture) Wait(ctx context.Context) (*pb.GetResponse, error) {
+	if err := f.wait(ctx); err != nil {
+		return nil, err
+	}
+	return f.resp, nil
+}
+
+// A MutateFuture is the eventual outcome of a mutation started with PutAsync,
+// DeleteAsync or IncrementAsync.
+type MutateFuture struct {
+	future
+	resp *pb.MutateResponse
+}
+
+// Wait returns the response of the mutation once it's done.  If the context
+// is done first, it returns ErrDeadline, while the mutation goes on until its
+// own context is done.
+func (f *MutateFuture) Wait(ctx context.Context) (*pb.MutateResponse, error) {
+	if err := f.wait(ctx); err != nil {
+		return nil, err
+	}
+	return f.resp, nil
+}
+
+// GetAsync starts the given Get and returns right away.  The operations
+// started asynchronously are carried out like their synchronous counterparts,
+// retries included, each by a goroutine of the client while it's in flight, so
+// that callers can start any number of them without managing goroutines.
+func (c *client) GetAsync(get *hrpc.Get) *GetFuture {
+	f := &GetFuture{future: future{done: make(chan struct{})}}
+	go func() {
+		f.resp, f.err = c.Get(get)
+		close(f.done)
+	}()
+	return f
+}
+
+// PutAsync starts the given Put and returns right away, see GetAsync.
+func (c *client) PutAsync(mutate *hrpc.Mutate) *MutateFuture {
+	return c.mutateAsync(c.Put, mutate)
+}
+
+// DeleteAsync starts the given Delete and returns right away, see GetAsync.
+func (c *client) DeleteAsync(mutate *hrpc.Mutate) *MutateFuture {
+	return c.mutateAsync(c.Delete, mutate)
+}
+
+// IncrementAsync starts the given Increment and returns right away, see
+// GetAsync.
+func (c *client) IncrementAsync(mutate *hrpc.Mutate) *MutateFuture {
+	return c.mutateAsync(c.Increment, mutate)
+}
+
+func (c *client) mutateAsync(send func(*hrpc.Mutate) (*pb.MutateResponse, error),
+	mutate *hrpc.Mutate) *MutateFuture {
+	f := &MutateFuture{future: future{done: make(chan struct{})}}
+	go func() {
+		f.resp, f.err = send(mutate)
+		close(f.done)
+	}()
+	return f
+}
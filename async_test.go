@@ -0,0 +1,73 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"golang.org/x/net/context"
+)
+
+func TestAsync(t *testing.T) {
+	_, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+
+	var puts []*MutateFuture
+	for i := 0; i < 100; i++ {
+		put, _ := hrpc.NewPutStr(ctx, "test", fmt.Sprint("row", i),
+			map[string]map[string][]byte{"cf": {"a": []byte(fmt.Sprint(i))}})
+		puts = append(puts, c.PutAsync(put))
+	}
+	for i, f := range puts {
+		if _, err := f.Wait(ctx); err != nil {
+			t.Fatalf("Put of row%d failed: %s", i, err)
+		}
+	}
+	var gets []*GetFuture
+	for i := 0; i < 100; i++ {
+		get, _ := hrpc.NewGetStr(ctx, "test", fmt.Sprint("row", i))
+		gets = append(gets, c.GetAsync(get))
+	}
+	for i, f := range gets {
+		<-f.Done()
+		if f.Err() != nil {
+			t.Fatalf("Get of row%d failed: %s", i, f.Err())
+		}
+		resp, _ := f.Wait(ctx)
+		if len(resp.Result.Cell) != 1 || string(resp.Result.Cell[0].Value) != fmt.Sprint(i) {
+			t.Errorf("Unexpected result for row%d: %v", i, resp.Result)
+		}
+	}
+
+	del, _ := hrpc.NewDelStr(ctx, "test", "row0", nil)
+	if _, err := c.DeleteAsync(del).Wait(ctx); err != nil {
+		t.Errorf("Delete failed: %s", err)
+	}
+	inc, _ := hrpc.NewIncStr(ctx, "nonexistent", "row",
+		map[string]map[string][]byte{"cf": {"a": encodeUint64(1)}})
+	if _, err := c.IncrementAsync(inc).Wait(ctx); err != ErrTableNotFound {
+		t.Errorf("Expected ErrTableNotFound, got %v", err)
+	}
+}
+
+func TestFutureWait(t *testing.T) {
+	f := &MutateFuture{future: future{done: make(chan struct{})}}
+	if f.Err() != nil {
+		t.Errorf("Expected no error before the mutation is done, got %s", f.Err())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.Wait(ctx); err != ErrDeadline {
+		t.Errorf("Expected ErrDeadline, got %v", err)
+	}
+	f.err = ErrTableNotFound
+	close(f.done)
+	if f.Err() != ErrTableNotFound {
+		t.Errorf("Expected ErrTableNotFound, got %v", f.Err())
+	}
+}
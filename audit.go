@@ -0,0 +1,68 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"time"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+)
+
+// AuditRecord describes a mutation made by the client and its outcome.
+type AuditRecord struct {
+	// User on behalf of whom the mutation was made, empty for the default
+	// user of the connections.
+	User string
+
+	Table []byte
+	Row   []byte
+
+	// Operation is whether the mutation is a put, a delete, an append or
+	// an increment.
+	Operation pb.MutationProto_MutationType
+
+	// Conditional is true if the mutation was only to be applied if a cell
+	// had an expected value.
+	Conditional bool
+
+	// Time is when the outcome of the mutation was known.
+	Time time.Time
+
+	// Err is nil if the mutation was applied, or the error it failed with
+	// once it wasn't retried anymore.  A mutation that failed may still
+	// have been applied, e.g. when its deadline expired while waiting for
+	// the response.
+	Err error
+}
+
+// Audit will return an option that will make the client call the given hook
+// with the outcome of every mutation it makes, through Put, Delete, Append,
+// Increment or Batch, once it's known after all the retries, to keep a
+// client-side audit trail independent of the logs of the servers.  The hook is
+// called synchronously before the mutation returns, and may be called
+// concurrently for different mutations.
+func Audit(hook func(*AuditRecord)) Option {
+	return func(c *client) {
+		c.auditHook = hook
+	}
+}
+
+// Reports the outcome of the given mutation to the audit hook, if any.
+func (c *client) audit(mutate *hrpc.Mutate, err error) {
+	if c.auditHook == nil {
+		return
+	}
+	c.auditHook(&AuditRecord{
+		User:        mutate.User(),
+		Table:       mutate.Table(),
+		Row:         mutate.Key(),
+		Operation:   mutate.MutationType(),
+		Conditional: mutate.IsConditional(),
+		Time:        time.Now(),
+		Err:         err,
+	})
+}
@@ -0,0 +1,68 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tsuna/gohbase/hrpc"
+)
+
+func TestAudit(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	s.CreateTable("test", []string{"cf"})
+	var m sync.Mutex
+	var records []string
+	c := newFakeClient(t, s, Audit(func(r *AuditRecord) {
+		if r.Time.IsZero() {
+			t.Errorf("No time in %+v", r)
+		}
+		m.Lock()
+		records = append(records, fmt.Sprintf("%s %s %s %s conditional=%v err=%v",
+			r.User, r.Operation, r.Table, r.Row, r.Conditional, r.Err != nil))
+		m.Unlock()
+	}))
+	defer c.Close()
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	values := map[string]map[string][]byte{"cf": {"a": []byte("1")}}
+	put, _ := hrpc.NewPutStr(ctx, "test", "row", values)
+	put.SetUser("alice")
+	if _, err := c.Put(put); err != nil {
+		t.Fatalf("Put failed: %s", err)
+	}
+	app, _ := hrpc.NewAppStr(ctx, "test", "row", values)
+	if _, err := c.Append(app); err != nil {
+		t.Fatalf("Append failed: %s", err)
+	}
+	del, _ := hrpc.NewDelStr(ctx, "nonexistent", "row", values)
+	if _, err := c.Delete(del); err != ErrTableNotFound {
+		t.Fatalf("Expected ErrTableNotFound, got %v", err)
+	}
+	cond, _ := hrpc.NewPutStr(ctx, "test", "cond", values)
+	cond.SetCondition("cf", "a", nil)
+	put, _ = hrpc.NewPutStr(ctx, "test", "batched", values)
+	c.Batch(ctx, []*hrpc.Mutate{cond, put})
+
+	m.Lock()
+	defer m.Unlock()
+	expected := []string{
+		"alice PUT test row conditional=false err=false",
+		" APPEND test row conditional=false err=false",
+		" DELETE nonexistent row conditional=false err=true",
+		" PUT test cond conditional=true err=true",
+		" PUT test batched conditional=false err=false",
+	}
+	if strings.Join(records, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected the records:\n%s\ngot:\n%s", strings.Join(expected, "\n"),
+			strings.Join(records, "\n"))
+	}
+}
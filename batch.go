@@ -0,0 +1,279 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/region"
+	"golang.org/x/net/context"
+)
+
+var (
+	// ErrConditionalBatch is returned by Batch for conditional mutations,
+	// which HBase can't apply as part of a Multi RPC.
+	ErrConditionalBatch = errors.New("conditional mutations can't be batched")
+
+	// ErrUnsupportedBatchOp is returned by BatchCallback for operations
+	// other than Gets and mutations.
+	ErrUnsupportedBatchOp = errors.New("only Gets and mutations can be batched")
+
+	// Returned for actions HBase didn't report the outcome of.
+	errMissingResult = errors.New("no result for this action in the response")
+)
+
+// Batch applies the given mutations, those in the same region being sent
+// together in a Multi RPC.  HBase reports the outcome of each of them: those
+// that failed because their region wasn't where it was expected are retried
+// on their own, against the region as located again, until the context is
+// done, while the others aren't sent again.  Batch returns the error of each
+// mutation, nil if it was applied, in the same order as the mutations.
+func (c *client) Batch(ctx context.Context, mutates []*hrpc.Mutate) []error {
+	errs := make([]error, len(mutates))
+	defer func() {
+		for i, mutate := range mutates {
+			c.audit(mutate, errs[i])
+		}
+	}()
+	var pending []int
+	for i, mutate := range mutates {
+		if mutate.IsConditional() {
+			errs[i] = ErrConditionalBatch
+		} else {
+			c.sampleKey(mutate)
+			pending = append(pending, i)
+		}
+	}
+	for len(pending) != 0 {
+		select {
+		case <-ctx.Done():
+			for _, i := range pending {
+				errs[i] = ErrDeadline
+			}
+			return errs
+		default:
+		}
+
+		// Mutations whose region isn't known yet are sent on their own, and
+		// grouped with the others once it's been located.
+		groups := make(map[string][]int)
+		for _, i := range pending {
+			mutate := mutates[i]
+			key := string(mutate.Table()) + "\x00" + mutate.User() + "\x00" +
+				mutate.Tenant() + "\x00"
+			if reg := c.getRegion(mutate.Table(), mutate.Key()); reg != nil {
+				key += string(reg.RegionName)
+			} else {
+				key += strconv.Itoa(i)
+			}
+			groups[key] = append(groups[key], i)
+		}
+
+		var m sync.Mutex
+		var wg sync.WaitGroup
+		var retry []int
+		for _, indexes := range groups {
+			wg.Add(1)
+			go func(indexes []int) {
+				defer wg.Done()
+				failed := c.sendMulti(ctx, mutates, indexes, errs)
+				m.Lock()
+				retry = append(retry, failed...)
+				m.Unlock()
+			}(indexes)
+		}
+		wg.Wait()
+		pending = retry
+	}
+	return errs
+}
+
+// BatchCallback carries out the given Gets and mutations concurrently, and
+// calls cb with the index, response and error of each of them as soon as it's
+// done, so that results can be consumed as they stream in.  The response is a
+// *pb.GetResponse or a *pb.MutateResponse, nil if the operation failed.  cb is
+// called from the goroutine of BatchCallback, one operation at a time, and
+// BatchCallback returns once it was called for all the operations.  If the
+// context is done first, cb is called with ErrDeadline for the remaining
+// operations, which go on until their own contexts are done.
+func (c *client) BatchCallback(ctx context.Context, ops []hrpc.Call,
+	cb func(index int, resp proto.Message, err error)) {
+	type outcome struct {
+		index int
+		resp  proto.Message
+		err   error
+	}
+	// Buffered so that the operations don't block once we stop waiting.
+	outcomes := make(chan outcome, len(ops))
+	done := make([]bool, len(ops))
+	pending := 0
+	for i, op := range ops {
+		send := c.batchOp(op)
+		if send == nil {
+			done[i] = true
+			cb(i, nil, ErrUnsupportedBatchOp)
+			continue
+		}
+		pending++
+		go func(i int) {
+			resp, err := send()
+			outcomes <- outcome{index: i, resp: resp, err: err}
+		}(i)
+	}
+	for ; pending > 0; pending-- {
+		select {
+		case o := <-outcomes:
+			done[o.index] = true
+			cb(o.index, o.resp, o.err)
+		case <-ctx.Done():
+			for i := range ops {
+				if !done[i] {
+					cb(i, nil, ErrDeadline)
+				}
+			}
+			return
+		}
+	}
+}
+
+// Returns the function carrying out the given operation of BatchCallback, nil
+// if it's not supported.
+func (c *client) batchOp(op hrpc.Call) func() (proto.Message, error) {
+	switch op := op.(type) {
+	case *hrpc.Get:
+		return func() (proto.Message, error) {
+			resp, err := c.Get(op)
+			if err != nil {
+				return nil, err
+			}
+			return resp, nil
+		}
+	case *hrpc.Mutate:
+		send := c.Put
+		switch op.MutationType() {
+		case pb.MutationProto_DELETE:
+			send = c.Delete
+		case pb.MutationProto_APPEND:
+			send = c.Append
+		case pb.MutationProto_INCREMENT:
+			send = c.Increment
+		}
+		return func() (proto.Message, error) {
+			resp, err := send(op)
+			if err != nil {
+				return nil, err
+			}
+			return resp, nil
+		}
+	}
+	return nil
+}
+
+// Sends the mutations at the given indexes in a Multi RPC, and records their
+// outcome in errs.  Returns the indexes of those that must be retried.
+func (c *client) sendMulti(ctx context.Context, mutates []*hrpc.Mutate,
+	indexes []int, errs []error) []int {
+	batch := make([]*hrpc.Mutate, len(indexes))
+	for j, i := range indexes {
+		batch[j] = mutates[i]
+		c.applyDefaults(batch[j])
+	}
+	multi, err := hrpc.NewMulti(ctx, batch[0].Table(), batch)
+	if err != nil {
+		for _, i := range indexes {
+			errs[i] = err
+		}
+		return nil
+	}
+	multi.SetUser(batch[0].User())
+	multi.SetTenant(batch[0].Tenant())
+	cancel := c.applyTimeout(multi)
+	res, err := c.sendRPC(multi)
+	cancel()
+	for _, mutate := range batch {
+		c.invalidateGetCache(mutate)
+	}
+	if err != nil {
+		for _, i := range indexes {
+			errs[i] = err
+		}
+		return nil
+	}
+
+	results := res.(*pb.MultiResponse).RegionActionResult
+	if len(results) != 1 {
+		for _, i := range indexes {
+			errs[i] = errMissingResult
+		}
+		return nil
+	}
+	if results[0].Exception != nil {
+		// All the actions failed.
+		err = region.ActionError(results[0].Exception)
+		if _, ok := err.(region.RetryableError); ok {
+			c.actionsFailed(multi, len(indexes))
+			return indexes
+		}
+		for _, i := range indexes {
+			errs[i] = tableError(err)
+		}
+		return nil
+	}
+
+	var retry []int
+	done := make([]bool, len(indexes))
+	for _, result := range results[0].ResultOrException {
+		j := int(result.GetIndex())
+		if j >= len(indexes) {
+			continue
+		}
+		done[j] = true
+		i := indexes[j]
+		if result.Exception == nil {
+			errs[i] = nil
+			continue
+		}
+		err = region.ActionError(result.Exception)
+		if _, ok := err.(region.RetryableError); ok {
+			retry = append(retry, i)
+			continue
+		}
+		errs[i] = tableError(err)
+	}
+	for j, i := range indexes {
+		if !done[j] {
+			errs[i] = errMissingResult
+		}
+	}
+	if len(retry) != 0 {
+		c.actionsFailed(multi, len(retry))
+	}
+	return retry
+}
+
+// Called when some actions of the given Multi RPC failed because its region
+// wasn't served where it was expected, so that the region is looked up again
+// before they're retried.
+func (c *client) actionsFailed(multi *hrpc.Multi, failed int) {
+	reg := multi.GetRegion()
+	if reg == nil {
+		return
+	}
+	log.WithFields(log.Fields{
+		"Table":   string(multi.Table()),
+		"Region":  string(reg.RegionName),
+		"Actions": failed,
+	}).Debug("Actions of a Multi failed, retrying them")
+	if reg.MarkUnavailable() {
+		go c.reestablishRegion(reg)
+	}
+}
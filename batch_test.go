@@ -0,0 +1,133 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/region"
+	"golang.org/x/net/context"
+)
+
+func TestBatch(t *testing.T) {
+	s, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+
+	var mutates []*hrpc.Mutate
+	for i := 0; i < 5; i++ {
+		put, _ := hrpc.NewPutStr(ctx, "test", fmt.Sprint("row", i),
+			map[string]map[string][]byte{"cf": {"a": []byte(fmt.Sprint(i))}})
+		mutates = append(mutates, put)
+	}
+	// Fails for good.
+	bad, _ := hrpc.NewPutStr(ctx, "test", "bad",
+		map[string]map[string][]byte{"nope": {"a": []byte("1")}})
+	cond, _ := hrpc.NewPutStr(ctx, "test", "cond",
+		map[string]map[string][]byte{"cf": {"a": []byte("1")}})
+	cond.SetCondition("cf", "a", nil)
+	mutates = append(mutates, bad, cond)
+	// Only the actions on this row are retried, twice.
+	s.RejectActions("test", "row3", 2)
+
+	errs := c.Batch(ctx, mutates)
+	if len(errs) != len(mutates) {
+		t.Fatalf("Expected %d errors, got %d", len(mutates), len(errs))
+	}
+	for i := 0; i < 5; i++ {
+		if errs[i] != nil {
+			t.Errorf("Put of row%d failed: %s", i, errs[i])
+		}
+	}
+	if e, ok := errs[5].(region.DoNotRetryError); !ok ||
+		e.Exception != region.NoSuchColumnFamilyException {
+		t.Errorf("Expected a NoSuchColumnFamilyException, got %v", errs[5])
+	}
+	if errs[6] != ErrConditionalBatch {
+		t.Errorf("Expected ErrConditionalBatch, got %v", errs[6])
+	}
+
+	for i := 0; i < 5; i++ {
+		get, _ := hrpc.NewGetStr(ctx, "test", fmt.Sprint("row", i))
+		resp, err := c.Get(get)
+		if err != nil {
+			t.Fatalf("Get failed: %s", err)
+		}
+		if len(resp.Result.Cell) != 1 || string(resp.Result.Cell[0].Value) != fmt.Sprint(i) {
+			t.Errorf("Unexpected cells in row%d: %v", i, resp.Result.Cell)
+		}
+	}
+
+	// The actions on this row never succeed.
+	s.RejectActions("test", "row0", 1<<30)
+	shortCtx, shortCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer shortCancel()
+	put, _ := hrpc.NewPutStr(shortCtx, "test", "row0",
+		map[string]map[string][]byte{"cf": {"a": []byte("x")}})
+	if errs = c.Batch(shortCtx, []*hrpc.Mutate{put}); errs[0] != ErrDeadline {
+		t.Errorf("Expected ErrDeadline, got %v", errs[0])
+	}
+}
+
+func TestBatchCallback(t *testing.T) {
+	_, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+
+	values := map[string]map[string][]byte{"cf": {"a": []byte("1")}}
+	put, _ := hrpc.NewPutStr(ctx, "test", "existing", values)
+	if _, err := c.Put(put); err != nil {
+		t.Fatalf("Put failed: %s", err)
+	}
+	put, _ = hrpc.NewPutStr(ctx, "test", "row", values)
+	get, _ := hrpc.NewGetStr(ctx, "test", "existing")
+	scan, _ := hrpc.NewScanStr(ctx, "test")
+	app, _ := hrpc.NewAppStr(ctx, "test", "existing", values)
+	del, _ := hrpc.NewDelStr(ctx, "nonexistent", "row", values)
+	ops := []hrpc.Call{put, get, scan, app, del}
+
+	outcomes := make([]string, len(ops))
+	c.BatchCallback(ctx, ops, func(i int, resp proto.Message, err error) {
+		if outcomes[i] != "" {
+			t.Errorf("Called twice for operation %d", i)
+		}
+		switch resp := resp.(type) {
+		case *pb.GetResponse:
+			outcomes[i] = fmt.Sprintf("get %s", resp.Result.Cell[0].Value)
+		case *pb.MutateResponse:
+			outcomes[i] = "mutate"
+		case nil:
+			outcomes[i] = err.Error()
+		}
+	})
+	expected := []string{
+		"mutate",
+		"get 1",
+		ErrUnsupportedBatchOp.Error(),
+		"mutate",
+		ErrTableNotFound.Error(),
+	}
+	for i := range ops {
+		if outcomes[i] != expected[i] {
+			t.Errorf("Expected %q for operation %d, got %q", expected[i], i, outcomes[i])
+		}
+	}
+
+	// Every operation is reported once even if the context is done.
+	doneCtx, doneCancel := context.WithCancel(ctx)
+	doneCancel()
+	get, _ = hrpc.NewGetStr(ctx, "test", "row")
+	calls := make([]int, 2)
+	c.BatchCallback(doneCtx, []hrpc.Call{get, scan}, func(i int, resp proto.Message, err error) {
+		calls[i]++
+	})
+	if calls[0] != 1 || calls[1] != 1 {
+		t.Errorf("Expected one call for each operation, got %v", calls)
+	}
+}
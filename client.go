@@ -10,6 +10,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"strconv"
 	"sync"
 	"time"
@@ -37,31 +38,80 @@ var (
 	// ErrDeadline is returned when the deadline of a request has been exceeded
 	ErrDeadline = errors.New("deadline exceeded")
 
+	// ErrTableNotFound is returned when a request targets a table that
+	// doesn't exist.
+	ErrTableNotFound = errors.New("table not found")
+
+	// ErrTableDisabled is returned when a request targets a table that is
+	// disabled.
+	ErrTableDisabled = errors.New("table disabled")
+
+	// Used internally when the client of the region of an RPC was found
+	// shut down, to have the region re-established before the RPC is
+	// retried.
+	errClientDown = errors.New("region client shut down")
+
+	// Used internally when hbase:meta has no RegionServer for a region,
+	// because it's being assigned or it's the parent of a split whose
+	// daughters aren't in hbase:meta yet.  The region is looked up again.
+	errRegionNotAssigned = errors.New("region not assigned")
+
 	// Default timeouts
 
 	// How long to wait for a region lookup (either meta lookup or finding
 	// meta in ZooKeeper).  Should be greater than or equal to the ZooKeeper
 	// session timeout.
 	regionLookupTimeout = 30 * time.Second
+
+	// How long Close waits for the responses to the RPCs in flight before
+	// failing them.
+	closeTimeout = 5 * time.Second
 )
 
-type Option func(*Client)
+//go:generate mockgen -destination=test/mock/client.go -package=mock github.com/tsuna/gohbase Client
+
+// Option is a functional option used to configure a Client.
+type Option func(*client)
+
+// FailedRPC describes an RPC that failed for good, i.e. that won't be
+// retried anymore.
+type FailedRPC struct {
+	// Table and Key targeted by the RPC.
+	Table []byte
+	Key   []byte
+
+	// Operation is the name of the RPC (e.g. "Get" or "Mutate").
+	Operation string
+
+	// Call is the RPC itself, which can be inspected further or re-sent
+	// later on (e.g. from a dead-letter queue).
+	Call hrpc.Call
+
+	// Err is the error the RPC failed with.
+	Err error
+
+	// Metadata describes the attempts made before giving up.
+	Metadata hrpc.Metadata
+}
+
+// FailureHook is a function called whenever an RPC fails for good.
+type FailureHook func(*FailedRPC)
 
 // region -> client cache.
 type regionClientCache struct {
 	m sync.Mutex
 
-	clients map[*regioninfo.Info]*region.Client
+	clients map[*regioninfo.Info]RegionClient
 }
 
-func (rcc *regionClientCache) get(r *regioninfo.Info) *region.Client {
+func (rcc *regionClientCache) get(r *regioninfo.Info) RegionClient {
 	rcc.m.Lock()
 	c := rcc.clients[r]
 	rcc.m.Unlock()
 	return c
 }
 
-func (rcc *regionClientCache) put(r *regioninfo.Info, c *region.Client) {
+func (rcc *regionClientCache) put(r *regioninfo.Info, c RegionClient) {
 	rcc.m.Lock()
 	rcc.clients[r] = c
 	rcc.m.Unlock()
@@ -104,6 +154,15 @@ func (krc *keyRegionCache) get(key []byte) ([]byte, *regioninfo.Info) {
 	return k.([]byte), v.(*regioninfo.Info)
 }
 
+// Removes the given region from the cache, unless it was replaced already.
+func (krc *keyRegionCache) del(reg *regioninfo.Info) {
+	krc.m.Lock()
+	if v, ok := krc.regions.Get(reg.RegionName); ok && v.(*regioninfo.Info) == reg {
+		krc.regions.Delete(reg.RegionName)
+	}
+	krc.m.Unlock()
+}
+
 func (krc *keyRegionCache) put(key []byte, reg *regioninfo.Info) *regioninfo.Info {
 	krc.m.Lock()
 	oldV, _ := krc.regions.Put(key, func(interface{}, bool) (interface{}, bool) { return reg, true })
@@ -114,39 +173,241 @@ func (krc *keyRegionCache) put(key []byte, reg *regioninfo.Info) *regioninfo.Inf
 	return oldV.(*regioninfo.Info)
 }
 
-// A Client provides access to an HBase cluster.
-type Client struct {
+// Removes from the cache the regions of the table of the given region whose
+// keys overlap with its own, and returns them.  Such regions are stale: they
+// were split or merged into the given one.  Only the regions around its keys
+// are looked at, which keeps adding a region cheap however many regions of its
+// table are cached.
+func (krc *keyRegionCache) removeOverlaps(reg *regioninfo.Info) []*regioninfo.Info {
+	var stale []*regioninfo.Info
+	overlaps := func(other *regioninfo.Info) bool {
+		return !bytes.Equal(other.RegionName, reg.RegionName) &&
+			(len(other.StopKey) == 0 || bytes.Compare(other.StopKey, reg.StartKey) > 0) &&
+			(len(reg.StopKey) == 0 || bytes.Compare(other.StartKey, reg.StopKey) < 0)
+	}
+	// Sorts after the names of the regions starting with the start key of
+	// reg, and before those of the regions starting after it.
+	key := createRegionSearchKey(reg.Table, reg.StartKey)
+	krc.m.Lock()
+
+	// Walk back over the regions starting before or with reg, which
+	// includes reg itself if it's cached.  The cached regions don't overlap
+	// each other, so the first one that doesn't overlap with reg is the
+	// last to look at.
+	enum, _ := krc.regions.Seek(key)
+	_, _, err := enum.Prev() // The region after key, if any.
+	if err == io.EOF {
+		enum, err = krc.regions.SeekLast()
+	}
+	for err == nil {
+		var k, v interface{}
+		if k, v, err = enum.Prev(); err != nil || !isCacheKeyForTable(reg.Table, k.([]byte)) {
+			break
+		}
+		other := v.(*regioninfo.Info)
+		if overlaps(other) {
+			stale = append(stale, other)
+		} else if !bytes.Equal(other.RegionName, reg.RegionName) {
+			break
+		}
+	}
+
+	// Then walk forward over the regions starting after reg, until its
+	// stop key.
+	enum, _ = krc.regions.Seek(key)
+	for {
+		k, v, err := enum.Next()
+		if err != nil || !isCacheKeyForTable(reg.Table, k.([]byte)) {
+			break
+		}
+		other := v.(*regioninfo.Info)
+		if len(reg.StopKey) != 0 && bytes.Compare(other.StartKey, reg.StopKey) >= 0 {
+			break // This region and all the next ones start after reg.
+		}
+		if overlaps(other) {
+			stale = append(stale, other)
+		}
+	}
+	for _, other := range stale {
+		krc.regions.Delete(other.RegionName)
+	}
+	krc.m.Unlock()
+	return stale
+}
+
+// table -> expiration time of the last failed lookup of that table.
+// This prevents callers hammering a nonexistent table from hammering meta.
+type negativeCache struct {
+	m sync.Mutex
+
+	entries map[string]time.Time
+}
+
+// Returns true if the given table is known not to exist.
+func (nc *negativeCache) get(table []byte) bool {
+	nc.m.Lock()
+	defer nc.m.Unlock()
+	expiration, ok := nc.entries[string(table)]
+	if !ok {
+		return false
+	} else if time.Now().After(expiration) {
+		delete(nc.entries, string(table))
+		return false
+	}
+	return true
+}
+
+func (nc *negativeCache) put(table []byte, ttl time.Duration) {
+	nc.m.Lock()
+	nc.entries[string(table)] = time.Now().Add(ttl)
+	nc.m.Unlock()
+}
+
+// Client is a client for an HBase cluster, created with NewClient.  It is an
+// interface so that applications can substitute it in their tests, e.g. with
+// the mock in the test/mock package.
+type Client interface {
+	CheckTable(ctx context.Context, table string) (*pb.GetResponse, error)
+	Get(get *hrpc.Get) (*pb.GetResponse, error)
+	Scan(s *hrpc.Scan) ([]*pb.Result, error)
+	Scanner(s *hrpc.Scan, buffer int) *Scanner
+	Put(mutate *hrpc.Mutate) (*pb.MutateResponse, error)
+	Delete(mutate *hrpc.Mutate) (*pb.MutateResponse, error)
+	Append(mutate *hrpc.Mutate) (*pb.MutateResponse, error)
+	Increment(mutate *hrpc.Mutate) (*pb.MutateResponse, error)
+	GetAsync(get *hrpc.Get) *GetFuture
+	PutAsync(mutate *hrpc.Mutate) *MutateFuture
+	DeleteAsync(mutate *hrpc.Mutate) *MutateFuture
+	IncrementAsync(mutate *hrpc.Mutate) *MutateFuture
+	Batch(ctx context.Context, mutates []*hrpc.Mutate) []error
+	BatchCallback(ctx context.Context, ops []hrpc.Call,
+		cb func(index int, resp proto.Message, err error))
+	PrefetchRegions(ctx context.Context, table string) error
+	SetRpcQueueSize(size int)
+	SetFlushInterval(interval time.Duration)
+	DumpState() ClientState
+	Close() error
+}
+
+// A client provides access to an HBase cluster.
+type client struct {
 	regions keyRegionCache
 
-	// Maps a *regioninfo.Info to the *region.Client that we think currently
+	// Maps a *regioninfo.Info to the RegionClient that we think currently
 	// serves it.
 	clients regionClientCache
 
 	// Client connected to the RegionServer hosting the hbase:meta table.
-	metaClient *region.Client
+	metaClient RegionClient
 
 	zkquorum string
 
+	// ID of the cluster, read from ZooKeeper the first time a delegation
+	// token is needed.  Protected by clusterIDLock.
+	clusterIDLock sync.Mutex
+	clusterID     string
+
+	// tuningLock protects rpcQueueSize and flushInterval, which can be
+	// changed while the client is in use.
+	tuningLock sync.Mutex
+
 	// The maximum size of the RPC queue in the region client
 	rpcQueueSize int
 
 	// The timeout before flushing the RPC queue in the region client
 	flushInterval time.Duration
 
+	// Options passed to every region client created.
+	regionOptions []region.Option
+
+	// Creates the region clients, nil to use region.NewClient.
+	regionClientFactory NewRegionClientFunc
+
+	// If not nil, the region clients are shared with other clients through
+	// this registry, or with the other regions of the same RegionServer if
+	// the registry is private.
+	registry        *RegionClientRegistry
+	privateRegistry bool
+
+	// Number of connections made to each RegionServer, across which RPCs
+	// are spread, 0 or 1 for a single one.
+	connsPerServer int
+
+	// Connections used for RPCs made on behalf of other users.
+	userClients userClients
+
+	// Cache of the responses of Gets, nil if disabled.
+	getCache *getCache
+
+	// Gets in flight shared with identical ones, nil if disabled.
+	getCoalescer *getCoalescer
+
+	// Whether to connect to the RegionServers when prefetching regions.
+	preConnect bool
+
 	metaRegionInfo *regioninfo.Info
+
+	// Called whenever an RPC fails after exhausting retries, if not nil.
+	failureHook FailureHook
+
+	// Tables recently found not to exist, and for how long to remember it.
+	notFound         negativeCache
+	negativeCacheTTL time.Duration
+
+	// Path of the file in which the region cache is saved on Close and from
+	// which it's loaded on startup.  Empty if the cache isn't persisted.
+	regionCacheFile string
+
+	// Addresses ("host:port") of the RegionServers that were serving the
+	// regions loaded from the region cache file, to which we haven't
+	// connected yet.
+	warmRegions warmRegionCache
+
+	// Defaults applied to the requests against each table, by table name.
+	tableProfiles map[string]TableProfile
+
+	// Last RPCs that failed for good, reported by DumpState.
+	recentErrors recentErrors
+
+	// Notified of the progress of each RPC, nil if none.
+	listener EventListener
+
+	// Whether closest-row-before Gets are carried out with reversed scans.
+	scanClosestBefore bool
+
+	// Records the keys of a fraction of the requests, nil if disabled.
+	keySampler *keySampler
+
+	// Called with the outcome of each mutation, nil if none.
+	auditHook func(*AuditRecord)
+
+	// Bounds of the delay between the attempts to re-establish a region
+	// whose connection failed, which doubles after each failed attempt.
+	minReestablishBackoff time.Duration
+	maxReestablishBackoff time.Duration
 }
 
 // NewClient creates a new HBase client.
-func NewClient(zkquorum string, options ...Option) *Client {
+func NewClient(zkquorum string, options ...Option) Client {
+	return newClient(zkquorum, options...)
+}
+
+func newClient(zkquorum string, options ...Option) *client {
 	log.WithFields(log.Fields{
 		"Host": zkquorum,
 	}).Debug("Creating new client.")
-	c := &Client{
-		regions:       keyRegionCache{regions: b.TreeNew(regioninfo.CompareGeneric)},
-		clients:       regionClientCache{clients: make(map[*regioninfo.Info]*region.Client)},
-		zkquorum:      zkquorum,
-		rpcQueueSize:  100,
-		flushInterval: 20 * time.Millisecond,
+	c := &client{
+		regions:          keyRegionCache{regions: b.TreeNew(regioninfo.CompareGeneric)},
+		clients:          regionClientCache{clients: make(map[*regioninfo.Info]RegionClient)},
+		warmRegions:      warmRegionCache{addrs: make(map[*regioninfo.Info]string)},
+		notFound:         negativeCache{entries: make(map[string]time.Time)},
+		negativeCacheTTL: time.Second,
+		zkquorum:         zkquorum,
+		rpcQueueSize:     100,
+		flushInterval:    20 * time.Millisecond,
+
+		minReestablishBackoff: defaultMinReestablishBackoff,
+		maxReestablishBackoff: defaultMaxReestablishBackoff,
 		metaRegionInfo: &regioninfo.Info{
 			Table:      []byte("hbase:meta"),
 			RegionName: []byte("hbase:meta,,1"),
@@ -156,13 +417,62 @@ func NewClient(zkquorum string, options ...Option) *Client {
 	for _, option := range options {
 		option(c)
 	}
+	if c.connsPerServer > 1 && c.registry == nil {
+		// The connections to each RegionServer are shared by its regions.
+		c.registry = NewRegionClientRegistry()
+		c.privateRegistry = true
+	}
+	if c.regionCacheFile != "" {
+		if err := c.loadRegionCache(); err != nil {
+			log.WithFields(log.Fields{
+				"File":  c.regionCacheFile,
+				"Error": err,
+			}).Warn("Failed to load the region cache")
+		}
+	}
 	return c
 }
 
+// Close saves the region cache (if the RegionCacheFile option was given) and
+// closes the connections to all the RegionServers, unless they're shared
+// through a RegionClientRegistry, after waiting a little for the responses to
+// the RPCs in flight.  The client must not be used afterwards.
+func (c *client) Close() error {
+	var err error
+	if c.regionCacheFile != "" {
+		err = c.saveRegionCache()
+	}
+	c.userClients.close()
+	if c.registry != nil {
+		// The connections are owned by the registry.
+		if c.privateRegistry {
+			c.registry.Close()
+		}
+		return err
+	}
+	closed := make(map[RegionClient]struct{})
+	c.clients.m.Lock()
+	for _, client := range c.clients.clients {
+		if client != nil {
+			closed[client] = struct{}{}
+		}
+	}
+	c.clients.m.Unlock()
+	if c.metaClient != nil {
+		closed[c.metaClient] = struct{}{}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	for client := range closed {
+		client.Close(ctx)
+	}
+	return err
+}
+
 // RpcQueueSize will return an option that will set the size of the RPC queues
 // used in a given client
 func RpcQueueSize(size int) Option {
-	return func(c *Client) {
+	return func(c *client) {
 		c.rpcQueueSize = size
 	}
 }
@@ -170,13 +480,243 @@ func RpcQueueSize(size int) Option {
 // FlushInterval will return an option that will set the timeout for flushing
 // the RPC queues used in a given client
 func FlushInterval(interval time.Duration) Option {
-	return func(c *Client) {
+	return func(c *client) {
 		c.flushInterval = interval
 	}
 }
 
+// OnFailure will return an option that will register a hook called, in the
+// goroutine of the caller, whenever an RPC fails and won't be retried.  This
+// allows applications to implement dead-letter queues for failed writes.
+func OnFailure(hook FailureHook) Option {
+	return func(c *client) {
+		c.failureHook = hook
+	}
+}
+
+// StuckRPCTimeout will return an option that will set how long past its
+// deadline an RPC may wait for its response before the connection it was sent
+// on is considered wedged, and is recycled.  A timeout of 0 disables the
+// detection of stuck RPCs.
+func StuckRPCTimeout(timeout time.Duration) Option {
+	return func(c *client) {
+		c.regionOptions = append(c.regionOptions, region.StuckRPCTimeout(timeout))
+	}
+}
+
+// ConnectionsPerRegionServer will return an option that will make the client
+// open up to n connections to each RegionServer, and send RPCs over them in
+// turn.  Each connection has a single writer, so RPCs with large requests or
+// responses hold up the others sent over the same connection, which multiple
+// connections mitigate.  The connections are shared by all the regions of a
+// RegionServer, and with other clients if the SharedRegionClients option is
+// given too.  Without this option, each region gets its own connection,
+// unless the connections are shared through a registry, in which case there's
+// a single connection per RegionServer.
+func ConnectionsPerRegionServer(n int) Option {
+	return func(c *client) {
+		c.connsPerServer = n
+	}
+}
+
+// ReestablishBackoff will return an option that will set the bounds of the
+// delay between the attempts to re-establish a region after its connection
+// failed: the region is looked up again, and its RegionServer re-dialed,
+// first after min, then after twice as long as the previous time, up to max.
+// Each delay is shortened by up to half at random, so that the regions of a
+// RegionServer that went away aren't all looked up again at once.  The RPCs
+// waiting for the region are sent once it's re-established, and only fail if
+// their context is done first.  A min that isn't positive is replaced by the
+// default, and a max lower than min by min.
+func ReestablishBackoff(min, max time.Duration) Option {
+	return func(c *client) {
+		if min <= 0 {
+			min = defaultMinReestablishBackoff
+		}
+		if max < min {
+			max = min
+		}
+		c.minReestablishBackoff = min
+		c.maxReestablishBackoff = max
+	}
+}
+
+// ReconnectRegionServers will return an option that will make the connections
+// to RegionServers reconnect when they fail, rather than be replaced, with the
+// delay between the attempts growing from min to max, see region.Reconnect.
+// The RPCs queued but not written yet are written once reconnected, and those
+// written already fail with region.ErrConnectionLost instead of being
+// retried, as the RegionServer may have applied them.  By default, the RPCs
+// of a failed connection are retried over a new one.
+func ReconnectRegionServers(min, max time.Duration) Option {
+	return func(c *client) {
+		c.regionOptions = append(c.regionOptions, region.Reconnect(min, max))
+	}
+}
+
+// Returns a random duration between half the given one and the given one.
+func jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Default bounds of the ReestablishBackoff option.
+const (
+	defaultMinReestablishBackoff = 100 * time.Millisecond
+	defaultMaxReestablishBackoff = 5 * time.Second
+)
+
+// MaxQueueDepth will return an option that will set how many RPCs may be
+// queued for each connection to a RegionServer.  RPCs made while the queue is
+// full fail right away with region.ErrClientOverloaded, so that callers can
+// shed load instead of piling up RPCs in memory when a RegionServer can't
+// keep up.  A depth of 0, the default, leaves the queues unbounded.
+func MaxQueueDepth(depth int) Option {
+	return func(c *client) {
+		c.regionOptions = append(c.regionOptions, region.MaxQueueDepth(depth))
+	}
+}
+
+// MaxInFlight will return an option that will set how many RPCs may be queued
+// or waiting for their response at once on each connection to a RegionServer.
+// Past that, RPCs wait for one of them to be answered, until their deadline.
+// This keeps the call queues of RegionServers from overflowing, and bounds
+// the memory used by the client.  A limit of 0, the default, leaves their
+// number unbounded.
+func MaxInFlight(limit int) Option {
+	return func(c *client) {
+		c.regionOptions = append(c.regionOptions, region.MaxInFlight(limit))
+	}
+}
+
+// DirectSend will return an option that will make the RPCs be written to the
+// connections to RegionServers by the goroutines making them, rather than
+// batched by a writer goroutine per connection.  This cuts the latency of
+// RPCs, in particular the flush interval, at the cost of a write per RPC.
+func DirectSend() Option {
+	return func(c *client) {
+		c.regionOptions = append(c.regionOptions, region.DirectSend())
+	}
+}
+
+// EffectiveUser will return an option that will set the user on behalf of
+// whom the RPCs are made, as reported to RegionServers when connecting, so
+// that authorization and auditing in HBase reflect the real caller.  The
+// default is "gopher".  Individual RPCs can be made on behalf of another user
+// with hrpc.EffectiveUser.
+func EffectiveUser(user string) Option {
+	return func(c *client) {
+		c.regionOptions = append(c.regionOptions, region.EffectiveUser(user))
+	}
+}
+
+// KeepAlive will return an option that will set the period of the TCP
+// keepalive probes sent on the connections to RegionServers, so that dead
+// connections are detected even while idle.  A negative period disables
+// keepalives, 0 leaves the default of the platform.
+func KeepAlive(period time.Duration) Option {
+	return func(c *client) {
+		c.regionOptions = append(c.regionOptions, region.KeepAlive(period))
+	}
+}
+
+// IdleTimeout will return an option that will close the connections to
+// RegionServers that go without any RPC for longer than the given timeout.
+// They're reopened the next time an RPC is sent to one of their regions.  A
+// timeout of 0, the default, keeps idle connections open.
+func IdleTimeout(timeout time.Duration) Option {
+	return func(c *client) {
+		c.regionOptions = append(c.regionOptions, region.IdleTimeout(timeout))
+	}
+}
+
+// Dialer will return an option that will set the function used to connect to
+// RegionServers, such as the Dial method of a net.Dialer binding a source
+// address, or of a SOCKS proxy.  It's given the host names of RegionServers
+// unresolved, and the KeepAlive and DialTimeout options don't apply to it.
+func Dialer(dial region.DialFunc) Option {
+	return func(c *client) {
+		c.regionOptions = append(c.regionOptions, region.Dialer(dial))
+	}
+}
+
+// DialTimeout will return an option that will set how long connecting to
+// each address of a RegionServer may take.  A timeout of 0, the default,
+// leaves it up to the operating system.
+func DialTimeout(timeout time.Duration) Option {
+	return func(c *client) {
+		c.regionOptions = append(c.regionOptions, region.DialTimeout(timeout))
+	}
+}
+
+// CellBlockCodec will return an option that will set the Java classes of the
+// codec, and optionally of the compressor, RegionServers are asked to use for
+// cell blocks.  RegionServers rejecting them are talked to with protobuf cells
+// instead.  By default, cell blocks aren't used.  The cells of puts, deletes
+// and batches are sent in cell blocks too when the codec is KeyValueCodec or
+// KeyValueCodecWithTags, and the compressor is GzipCodec, DefaultCodec or
+// none, which cuts the cost of serializing large writes.
+func CellBlockCodec(codec, compressor string) Option {
+	return func(c *client) {
+		c.regionOptions = append(c.regionOptions, region.CellBlockCodec(codec, compressor))
+	}
+}
+
+// FairScheduling will return an option that will make the connections to
+// RegionServers interleave the RPCs they write by tenant, so that a tenant
+// flooding a RegionServer with writes doesn't delay the RPCs of the others.
+// The tenant of an RPC is set with hrpc.Tenant, or is its table.  Tenants get
+// shares of the queue proportional to their weights, 1 for those missing
+// from weights.
+func FairScheduling(weights map[string]int) Option {
+	return func(c *client) {
+		c.regionOptions = append(c.regionOptions, region.FairScheduling(weights))
+	}
+}
+
+// SharedRegionClients will return an option that will make the client share
+// its connections to RegionServers with all the other clients using the same
+// registry.  The clients should be configured identically (queue size, flush
+// interval, etc.), as the connection of whichever client connected first to
+// a given RegionServer is used by all of them.
+func SharedRegionClients(registry *RegionClientRegistry) Option {
+	return func(c *client) {
+		c.registry = registry
+	}
+}
+
+// PreConnect will return an option that will make PrefetchRegions also
+// connect to (and complete the handshake with) every RegionServer hosting the
+// prefetched regions, so that the first requests don't pay for it.
+func PreConnect() Option {
+	return func(c *client) {
+		c.preConnect = true
+	}
+}
+
+// NegativeCacheTTL will return an option that will set for how long a table
+// that was found not to exist during a region lookup is remembered as such.
+// During that time, requests to that table fail with ErrTableNotFound without
+// looking up hbase:meta again.  A TTL of 0 disables this behavior.
+func NegativeCacheTTL(ttl time.Duration) Option {
+	return func(c *client) {
+		c.negativeCacheTTL = ttl
+	}
+}
+
+// RegionCacheFile will return an option that will make the client save its
+// region cache to the given file when it's closed, and load it back when it's
+// created.  This spares services restarting under load a cold cache and the
+// resulting burst of lookups in hbase:meta.  The regions loaded are validated
+// lazily: the first request to each one connects to the RegionServer that was
+// serving it, and the region is looked up again if it has moved since.
+func RegionCacheFile(path string) Option {
+	return func(c *client) {
+		c.regionCacheFile = path
+	}
+}
+
 // CheckTable returns an error if the given table name doesn't exist.
-func (c *Client) CheckTable(ctx context.Context, table string) (*pb.GetResponse, error) {
+func (c *client) CheckTable(ctx context.Context, table string) (*pb.GetResponse, error) {
 	getStr, _ := hrpc.NewGetStr(ctx, table, "theKey")
 	resp, err := c.sendRPC(getStr)
 	if err != nil {
@@ -186,17 +726,70 @@ func (c *Client) CheckTable(ctx context.Context, table string) (*pb.GetResponse,
 }
 
 // Get returns a single row fetched from HBase.
-func (c *Client) Get(get *hrpc.Get) (*pb.GetResponse, error) {
+// Once it returns, get.Metadata() describes how the call was carried out.
+func (c *client) Get(get *hrpc.Get) (*pb.GetResponse, error) {
+	defer c.applyProfile(get)()
+	if get.IsClosestBefore() && c.scanClosestBefore {
+		return c.getBefore(get)
+	}
+	c.sampleKey(get)
+	var generation uint64
+	if c.getCache != nil {
+		if resp := c.getCache.get(get); resp != nil {
+			return resp, nil
+		}
+		generation = c.getCache.currentGeneration()
+	}
+	var resp *pb.GetResponse
+	var err error
+	if c.getCoalescer != nil {
+		resp, err = c.getCoalescer.do(get, func() (*pb.GetResponse, error) {
+			return c.sendGet(get)
+		})
+	} else {
+		resp, err = c.sendGet(get)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.getCache != nil {
+		c.getCache.put(get, resp, generation)
+	}
+	return resp, err
+}
+
+func (c *client) sendGet(get *hrpc.Get) (*pb.GetResponse, error) {
 	resp, err := c.sendRPC(get)
 	if err != nil {
 		return nil, err
 	}
-	return resp.(*pb.GetResponse), err
+	return resp.(*pb.GetResponse), nil
 }
 
 // Scan retrieves the values specified in families from the given range.
-func (c *Client) Scan(s *hrpc.Scan) ([]*pb.Result, error) {
+// The metadata of all the RPCs issued to carry out the scan is accumulated
+// in s.
+func (c *client) Scan(s *hrpc.Scan) ([]*pb.Result, error) {
 	var results []*pb.Result
+	err := c.scan(s, func(batch []*pb.Result, _ func() error) error {
+		results = append(results, batch...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Scans the given range region by region, calling emit with each batch of
+// results as it's received.  The next batch is only requested once emit
+// returns, and emit may call renew to keep the RegionServer's scanner open
+// meanwhile.  If emit returns an error, the scanner is closed and the error is
+// returned.
+func (c *client) scan(s *hrpc.Scan,
+	emit func(results []*pb.Result, renew func() error) error) error {
+	defer c.applyProfile(s)()
+	c.sampleKey(s)
 	var scanres *pb.ScanResponse
 	var rpc *hrpc.Scan
 	ctx := s.GetContext()
@@ -205,44 +798,105 @@ func (c *Client) Scan(s *hrpc.Scan) ([]*pb.Result, error) {
 	filters := s.GetFilter()
 	startRow := s.GetStartRow()
 	stopRow := s.GetStopRow()
-	for {
-		// Make a new Scan RPC for this region
-		if rpc == nil {
-			// If it's the first region, just begin at the given startRow
-			rpc, _ = hrpc.NewScanRange(ctx, table, startRow, stopRow, hrpc.Families(families), hrpc.Filters(filters))
-		} else {
-			// If it's not the first region, we want to start at whatever the
-			// last region's StopKey was
-			rpc, _ = hrpc.NewScanRange(ctx, table, rpc.GetRegionStop(), stopRow, hrpc.Families(families), hrpc.Filters(filters))
+	versions := hrpc.MaxVersions(s.GetMaxVersions())
+	user := hrpc.EffectiveUser(s.User())
+	tenant := hrpc.Tenant(s.Tenant())
+	priority := hrpc.Priority(s.Priority())
+	options := []func(hrpc.Call) error{hrpc.Families(families), hrpc.Filters(filters),
+		versions, user, tenant, priority}
+	if cache := s.GetCacheBlocks(); cache != nil {
+		options = append(options, hrpc.CacheBlocks(*cache))
+	}
+	if consistency := s.GetConsistency(); consistency != nil {
+		options = append(options, hrpc.Consistency(*consistency))
+	}
+	if s.IsNeedCursorResult() {
+		options = append(options, hrpc.NeedCursorResult())
+	}
+	if s.IsReversed() {
+		options = append(options, hrpc.Reversed())
+	}
+	if rows := s.GetNumberOfRows(); rows > 0 {
+		options = append(options, hrpc.NumberOfRows(rows))
+	}
+	renew := func() error {
+		if scanres.MoreResults != nil && !scanres.GetMoreResults() {
+			// The RegionServer closed the scanner already.
+			return nil
 		}
+		renewRPC := hrpc.NewRenewFromID(ctx, table, *scanres.ScannerId, rpc.Key())
+		renewRPC.SetUser(s.User())
+		renewRPC.SetTenant(s.Tenant())
+		renewRPC.SetPriority(s.Priority())
+		_, err := c.sendRPC(renewRPC)
+		s.AddMetadata(renewRPC.Metadata())
+		return err
+	}
+	for {
+		// Make a new Scan RPC for this region.  If it's the first region,
+		// just begin at the given startRow, otherwise startRow was moved to
+		// where the last region ended.
+		rpc, _ = hrpc.NewScanRange(ctx, table, startRow, stopRow, options...)
 
 		res, err := c.sendRPC(rpc)
+		s.AddMetadata(rpc.Metadata())
 		if err != nil {
-			return nil, err
+			return err
 		}
 		scanres = res.(*pb.ScanResponse)
-		results = append(results, scanres.Results...)
 
-		// TODO: The more_results field of the ScanResponse object was always
-		// true, so we should figure out if there's a better way to know when
-		// to move on to the next region than making an extra request and
-		// seeing if there were no results
-		for len(scanres.Results) != 0 {
+		// Heartbeats carry no results but mean the RegionServer hasn't
+		// reached the end of the region yet.  Unless it tells that the
+		// region is exhausted, it takes an extra request without results
+		// to find out.
+		for len(scanres.Results) != 0 || scanres.GetHeartbeatMessage() {
+			advanceCursor(s, scanres)
+			if len(scanres.Results) != 0 {
+				if err = emit(scanres.Results, renew); err != nil {
+					break
+				}
+			}
+			if regionExhausted(scanres) {
+				break
+			}
 			rpc = hrpc.NewScanFromID(ctx, table, *scanres.ScannerId, rpc.Key())
+			rpc.SetUser(s.User())
+			rpc.SetTenant(s.Tenant())
+			rpc.SetPriority(s.Priority())
+			if rows := s.GetNumberOfRows(); rows > 0 {
+				hrpc.NumberOfRows(rows)(rpc)
+			}
 
 			res, err = c.sendRPC(rpc)
+			s.AddMetadata(rpc.Metadata())
 			if err != nil {
-				return nil, err
+				return err
 			}
 			scanres = res.(*pb.ScanResponse)
-			results = append(results, scanres.Results...)
 		}
 
-		rpc = hrpc.NewCloseFromID(ctx, table, *scanres.ScannerId, rpc.Key())
+		if scanres.MoreResults == nil || scanres.GetMoreResults() {
+			// Otherwise the RegionServer closed the scanner already.
+			closeRPC := hrpc.NewCloseFromID(ctx, table, *scanres.ScannerId, rpc.Key())
+			closeRPC.SetUser(s.User())
+			closeRPC.SetTenant(s.Tenant())
+			closeRPC.SetPriority(s.Priority())
+			c.sendRPC(closeRPC)
+		}
 		if err != nil {
-			return nil, err
+			return err
+		}
+
+		if s.IsReversed() {
+			// Same as below, going down: stop at the first region, or
+			// once the stop_key of this scanner is in this region.
+			regionStart := rpc.GetRegionStart()
+			if len(regionStart) == 0 || (len(stopRow) != 0 && bytes.Compare(stopRow, regionStart) >= 0) {
+				return nil
+			}
+			startRow = closestRowBefore(regionStart)
+			continue
 		}
-		res, err = c.sendRPC(rpc)
 
 		// Check to see if this region is the last we should scan (either
 		// because (1) it's the last region or (3) because its stop_key is
@@ -250,16 +904,41 @@ func (c *Client) Scan(s *hrpc.Scan) ([]*pb.Result, error) {
 		// that (2) we're not trying to scan until the end of the table).
 		// (1)                               (2)                  (3)
 		if len(rpc.GetRegionStop()) == 0 || (len(stopRow) != 0 && bytes.Compare(stopRow, rpc.GetRegionStop()) <= 0) {
-			return results, nil
+			return nil
 		}
+		startRow = rpc.GetRegionStop()
+	}
+}
+
+// Returns whether the given response says that there's nothing left to scan
+// in its region.  RegionServers older than 1.1 don't send
+// more_results_in_region, but more_results is false once they closed the
+// scanner at the end of the region.
+func regionExhausted(res *pb.ScanResponse) bool {
+	if res.MoreResultsInRegion != nil {
+		return !res.GetMoreResultsInRegion()
+	}
+	return res.MoreResults != nil && !res.GetMoreResults()
+}
+
+// Records in s the row the scan reached according to the given response.
+func advanceCursor(s *hrpc.Scan, res *pb.ScanResponse) {
+	if cursor := res.GetCursor(); cursor != nil {
+		s.SetCursor(cursor.Row)
+	} else if n := len(res.Results); n != 0 && len(res.Results[n-1].Cell) != 0 {
+		s.SetCursor(res.Results[n-1].Cell[0].Row)
 	}
 }
 
 // Put inserts or updates the values into the given row of the table.
 // TODO: Do we want to combine the following four functions into a single function -
-// 		func (c *Client) Mutate(mutate *hrpc.Mutate) {  ?
-func (c *Client) Put(mutate *hrpc.Mutate) (*pb.MutateResponse, error) {
+// 		func (c *client) Mutate(mutate *hrpc.Mutate) {  ?
+func (c *client) Put(mutate *hrpc.Mutate) (*pb.MutateResponse, error) {
+	defer c.applyProfile(mutate)()
+	c.sampleKey(mutate)
 	resp, err := c.sendRPC(mutate)
+	c.invalidateGetCache(mutate)
+	c.audit(mutate, err)
 	if err != nil {
 		return nil, err
 	}
@@ -267,8 +946,12 @@ func (c *Client) Put(mutate *hrpc.Mutate) (*pb.MutateResponse, error) {
 }
 
 // Delete removes values from the given row of the table.
-func (c *Client) Delete(mutate *hrpc.Mutate) (*pb.MutateResponse, error) {
+func (c *client) Delete(mutate *hrpc.Mutate) (*pb.MutateResponse, error) {
+	defer c.applyProfile(mutate)()
+	c.sampleKey(mutate)
 	resp, err := c.sendRPC(mutate)
+	c.invalidateGetCache(mutate)
+	c.audit(mutate, err)
 	if err != nil {
 		return nil, err
 	}
@@ -276,8 +959,12 @@ func (c *Client) Delete(mutate *hrpc.Mutate) (*pb.MutateResponse, error) {
 }
 
 // Append atomically appends all the given values to their current values in HBase.
-func (c *Client) Append(mutate *hrpc.Mutate) (*pb.MutateResponse, error) {
+func (c *client) Append(mutate *hrpc.Mutate) (*pb.MutateResponse, error) {
+	defer c.applyProfile(mutate)()
+	c.sampleKey(mutate)
 	resp, err := c.sendRPC(mutate)
+	c.invalidateGetCache(mutate)
+	c.audit(mutate, err)
 	if err != nil {
 		return nil, err
 	}
@@ -285,14 +972,26 @@ func (c *Client) Append(mutate *hrpc.Mutate) (*pb.MutateResponse, error) {
 }
 
 // Increment atomically increments the given values in HBase.
-func (c *Client) Increment(mutate *hrpc.Mutate) (*pb.MutateResponse, error) {
+func (c *client) Increment(mutate *hrpc.Mutate) (*pb.MutateResponse, error) {
+	defer c.applyProfile(mutate)()
+	c.sampleKey(mutate)
 	resp, err := c.sendRPC(mutate)
+	c.invalidateGetCache(mutate)
+	c.audit(mutate, err)
 	if err != nil {
 		return nil, err
 	}
 	return resp.(*pb.MutateResponse), err
 }
 
+// Drops the cached Gets of the row written by the given mutation, whether it
+// succeeded or not, as it may have been applied even if it failed.
+func (c *client) invalidateGetCache(mutate *hrpc.Mutate) {
+	if c.getCache != nil {
+		c.getCache.invalidate(mutate.Table(), mutate.Key())
+	}
+}
+
 // Creates the META key to search for in order to locate the given key.
 func createRegionSearchKey(table, key []byte) []byte {
 	metaKey := make([]byte, 0, len(table)+len(key)+3)
@@ -309,6 +1008,9 @@ func createRegionSearchKey(table, key []byte) []byte {
 
 // Checks whether or not the given cache key is for the given table.
 func isCacheKeyForTable(table, cacheKey []byte) bool {
+	if len(cacheKey) <= len(table) {
+		return false
+	}
 	// Check we found an entry that's really for the requested table.
 	for i := 0; i < len(table); i++ {
 		if table[i] != cacheKey[i] { // This table isn't in the map, we found
@@ -322,7 +1024,7 @@ func isCacheKeyForTable(table, cacheKey []byte) bool {
 }
 
 // Searches in the regions cache for the region hosting the given row.
-func (c *Client) getRegion(table, key []byte) *regioninfo.Info {
+func (c *client) getRegion(table, key []byte) *regioninfo.Info {
 	if bytes.Equal(table, metaTableName) {
 		return c.metaRegionInfo
 	}
@@ -343,7 +1045,7 @@ func (c *Client) getRegion(table, key []byte) *regioninfo.Info {
 }
 
 // Returns the client currently known to hose the given region, or NULL.
-func (c *Client) clientFor(region *regioninfo.Info) *region.Client {
+func (c *client) clientFor(region *regioninfo.Info) RegionClient {
 	if region == c.metaRegionInfo {
 		return c.metaClient
 	}
@@ -353,7 +1055,7 @@ func (c *Client) clientFor(region *regioninfo.Info) *region.Client {
 // Queues an RPC targeted at a particular region for handling by the appropriate
 // region client. Results will be written to the rpc's result and error
 // channels.
-func (c *Client) queueRPC(rpc hrpc.Call) error {
+func (c *client) queueRPC(rpc hrpc.Call) error {
 	table := rpc.Table()
 	key := rpc.Key()
 	reg := c.getRegion(table, key)
@@ -369,12 +1071,14 @@ func (c *Client) queueRPC(rpc hrpc.Call) error {
 		}
 	}
 
-	var client *region.Client
+	var client RegionClient
 	if reg != nil {
 		ch := reg.GetAvailabilityChan()
 		if ch != nil {
+			waitStart := time.Now()
 			select {
 			case <-ch:
+				rpc.AddRetryDelay(time.Since(waitStart))
 				return c.queueRPC(rpc)
 			case <-rpc.GetContext().Done():
 				return ErrDeadline
@@ -382,6 +1086,31 @@ func (c *Client) queueRPC(rpc hrpc.Call) error {
 		}
 
 		client = c.clientFor(reg)
+		if client == nil {
+			// This region was loaded from the region cache file and we
+			// haven't connected to its RegionServer yet.
+			var err error
+			client, err = c.connectWarmRegion(rpc.GetContext(), reg)
+			if err != nil {
+				return err
+			}
+		} else if client.Err() != nil {
+			// The connection was closed while no RPC was using it,
+			// because it was idle or the RegionServer went away.
+			// The caller re-establishes the region.
+			rpc.SetRegion(reg)
+			return errClientDown
+		}
+		if c.connsPerServer > 1 && reg != c.metaRegionInfo {
+			// Spread the RPCs across the connections to the
+			// RegionServer.
+			var err error
+			client, err = c.registry.get(rpc.GetContext(), client.Host(), client.Port(),
+				c.connsPerServer, c.dialRegion)
+			if err != nil {
+				return err
+			}
+		}
 	} else {
 		var err error
 		client, reg, err = c.locateRegion(rpc.GetContext(), table, key)
@@ -389,22 +1118,47 @@ func (c *Client) queueRPC(rpc hrpc.Call) error {
 			return err
 		}
 	}
+	if user := rpc.User(); user != "" {
+		var err error
+		client, err = c.userClient(rpc.GetContext(), client.Host(), client.Port(), user)
+		if err != nil {
+			return err
+		}
+	}
 	rpc.SetRegion(reg)
 	return client.QueueRPC(rpc)
 }
 
 // sendRPC takes an RPC call, and will send it to the correct region server. If
 // the correct region server is offline or otherwise unavailable, sendRPC will
-// continually retry until the deadline set on the RPC's context is exceeded.
-func (c *Client) sendRPC(rpc hrpc.Call) (proto.Message, error) {
+// continually retry until the deadline set on the RPC's context is exceeded,
+// or until it was sent as many times as allowed by the profile of its table.
+func (c *client) sendRPC(rpc hrpc.Call) (proto.Message, error) {
 	log.WithFields(log.Fields{
 		"Type":  rpc.GetName(),
 		"Table": string(rpc.Table()),
 		"Key":   string(rpc.Key()),
 	}).Debug("Sending RPC")
 	err := c.queueRPC(rpc)
-	if err == ErrDeadline {
-		return nil, err
+	if err == ErrDeadline || err == ErrTableNotFound || err == ErrTableDisabled ||
+		err == region.ErrClientOverloaded {
+		return nil, c.rpcFailed(rpc, err)
+	} else if err == errClientDown {
+		// The region is marked as unavailable below until it's
+		// re-established.
+	} else if err == errRegionNotAssigned {
+		// Give the master some time to assign the region before looking
+		// it up again.
+		select {
+		case <-time.After(jitter(c.minReestablishBackoff)):
+		case <-rpc.GetContext().Done():
+			return nil, c.rpcFailed(rpc, ErrDeadline)
+		}
+		return c.resendRPC(rpc, err)
+	} else if err != nil && err == rpc.GetContext().Err() {
+		// The deadline passed while waiting for room among the RPCs in
+		// flight on the connection, see MaxInFlight.
+		return nil, c.rpcFailed(rpc, ErrDeadline)
 	} else if err != nil {
 		log.WithFields(log.Fields{
 			"Type":  rpc.GetName(),
@@ -413,7 +1167,7 @@ func (c *Client) sendRPC(rpc hrpc.Call) (proto.Message, error) {
 		}).Debug("We hit an error queuing the RPC. Resending.")
 		// There was an error locating the region for the RPC, or the client
 		// for the region encountered an error and has shut down.
-		return c.sendRPC(rpc)
+		return c.resendRPC(rpc, err)
 	}
 	if err == nil {
 		var res hrpc.RPCResult
@@ -422,10 +1176,10 @@ func (c *Client) sendRPC(rpc hrpc.Call) (proto.Message, error) {
 		select {
 		case res = <-resch:
 		case <-rpc.GetContext().Done():
-			return nil, ErrDeadline
+			return nil, c.rpcFailed(rpc, ErrDeadline)
 		}
 
-		err := res.Error
+		err = res.Error
 		log.WithFields(log.Fields{
 			"Type":   rpc.GetName(),
 			"Table":  string(rpc.Table()),
@@ -434,17 +1188,30 @@ func (c *Client) sendRPC(rpc hrpc.Call) (proto.Message, error) {
 			"Error":  err,
 		}).Debug("Successfully sent RPC. Returning.")
 
-		if _, ok := err.(region.RetryableError); ok {
-			return c.sendRPC(rpc)
+		if moved, ok := err.(region.RegionMovedError); ok {
+			// HBase told us where the region went, no need to look it up.
+			c.regionMoved(rpc.GetRegion(), moved.Host, moved.Port)
+			return c.resendRPC(rpc, err)
+		} else if _, ok := err.(region.RetryableError); ok {
+			// The region isn't where we thought it was (it moved, or is
+			// being split or opened), so it needs to be looked up again,
+			// which is taken care of below.
 		} else if _, ok := err.(region.UnrecoverableError); ok {
 			// Prevents dropping into the else block below,
 			// error handling happens a few lines down
+		} else if err != nil && err == rpc.GetContext().Err() {
+			// The region client gave up on the RPC as its context was
+			// done before its response was received.
+			return nil, c.rpcFailed(rpc, ErrDeadline)
+		} else if err != nil {
+			return nil, c.rpcFailed(rpc, tableError(err))
 		} else {
-			return res.Msg, res.Error
+			return res.Msg, nil
 		}
 	}
 
-	// There was an issue related to the network, so we're going to mark the
+	// There was an issue related to the network or the region isn't served
+	// by this client anymore, so we're going to mark the
 	// region as unavailable, and generate the channel used for announcing
 	// when it's available again
 	region := rpc.GetRegion()
@@ -466,11 +1233,43 @@ func (c *Client) sendRPC(rpc hrpc.Call) (proto.Message, error) {
 		"Table": string(rpc.Table()),
 		"Key":   string(rpc.Key()),
 	}).Debug("Retrying sendRPC")
-	return c.sendRPC(rpc)
+	return c.resendRPC(rpc, err)
+}
+
+// rpcFailed is called when the given RPC failed for good with the given error,
+// which it returns.
+// Lookups in hbase:meta made internally to locate regions aren't reported to
+// the failure hook, only the RPC that triggered them is, but all failures are
+// remembered for DumpState.
+func (c *client) rpcFailed(rpc hrpc.Call, err error) error {
+	c.recentErrors.add(RecentError{
+		Time:      time.Now(),
+		Operation: rpc.GetName(),
+		Table:     rpc.Table(),
+		Key:       rpc.Key(),
+		Err:       err,
+	})
+	if c.listener != nil {
+		c.listener.RPCFailed(rpc, err)
+	}
+	if c.failureHook != nil && !bytes.Equal(rpc.Table(), metaTableName) {
+		c.failureHook(&FailedRPC{
+			Table:     rpc.Table(),
+			Key:       rpc.Key(),
+			Operation: rpc.GetName(),
+			Call:      rpc,
+			Err:       err,
+			Metadata:  rpc.Metadata(),
+		})
+	}
+	return err
 }
 
 // Locates the region in which the given row key for the given table is.
-func (c *Client) locateRegion(ctx context.Context, table, key []byte) (*region.Client, *regioninfo.Info, error) {
+func (c *client) locateRegion(ctx context.Context, table, key []byte) (RegionClient, *regioninfo.Info, error) {
+	if c.notFound.get(table) {
+		return nil, nil, ErrTableNotFound
+	}
 	metaKey := createRegionSearchKey(table, key)
 	rpc, _ := hrpc.NewGetBefore(ctx, metaTableName, metaKey, hrpc.Families(infoFamily))
 	rpc.SetRegion(c.metaRegionInfo)
@@ -490,34 +1289,131 @@ func (c *Client) locateRegion(ctx context.Context, table, key []byte) (*region.C
 		}
 	}
 
-	return c.discoverRegion(ctx, resp.(*pb.GetResponse))
+	metaRow := resp.(*pb.GetResponse)
+	if metaRow.Result == nil || len(metaRow.Result.Cell) == 0 ||
+		// The row right before the one we looked for belongs to another
+		// table, so there's no region for this one.
+		!isCacheKeyForTable(table, metaRow.Result.Cell[0].Row) {
+		if c.negativeCacheTTL > 0 {
+			c.notFound.put(table, c.negativeCacheTTL)
+		}
+		return nil, nil, ErrTableNotFound
+	}
+	return c.discoverRegion(ctx, metaRow)
+}
+
+// tableError converts errors sent by HBase because of the state of a table
+// into ErrTableNotFound and ErrTableDisabled.  Other errors are returned
+// unchanged.
+func tableError(err error) error {
+	if e, ok := err.(region.DoNotRetryError); ok {
+		switch e.Exception {
+		case region.TableNotFoundException:
+			return ErrTableNotFound
+		case region.TableNotEnabledException:
+			return ErrTableDisabled
+		}
+	}
+	return err
 }
 
 type newRegResult struct {
-	Client *region.Client
+	Client RegionClient
 	Err    error
 }
 
-var newRegion = func(ret chan newRegResult, host string, port uint16, queueSize int, queueTimeout time.Duration) {
-	c, e := region.NewClient(host, port, queueSize, queueTimeout)
-	ret <- newRegResult{c, e}
+var newRegion = func(ret chan newRegResult, host string, port uint16, queueSize int,
+	queueTimeout time.Duration, options ...region.Option) {
+	c, err := region.NewClient(host, port, queueSize, queueTimeout, options...)
+	if err != nil {
+		ret <- newRegResult{nil, err}
+		return
+	}
+	ret <- newRegResult{c, nil}
+}
+
+// Returns a client connected to the given RegionServer.  If the client shares
+// its connections with other clients, an existing connection may be reused.
+func (c *client) regionClient(ctx context.Context, host string, port uint16) (RegionClient, error) {
+	if c.registry != nil {
+		return c.registry.get(ctx, host, port, c.connsPerServer, c.dialRegion)
+	}
+	return c.dialRegion(ctx, host, port)
+}
+
+// Creates a new client connected to the given RegionServer.
+func (c *client) dialRegion(ctx context.Context, host string, port uint16) (RegionClient, error) {
+	return c.dialRegionWith(ctx, host, port, c.regionOptions)
+}
+
+// Creates a new client connected to the given RegionServer, with the given
+// options.
+func (c *client) dialRegionWith(ctx context.Context, host string, port uint16,
+	options []region.Option) (RegionClient, error) {
+	var res newRegResult
+	// Buffered so that newRegion doesn't block forever if we give up.
+	ret := make(chan newRegResult, 1)
+	queueSize, flushInterval := c.queueTuning()
+	if c.regionClientFactory != nil {
+		go func() {
+			rc, err := c.newRegionClient(host, port, queueSize, flushInterval, options...)
+			ret <- newRegResult{rc, err}
+		}()
+	} else {
+		go newRegion(ret, host, port, queueSize, flushInterval, options...)
+	}
+
+	select {
+	case res = <-ret:
+	case <-ctx.Done():
+		return nil, ErrDeadline
+	}
+	return res.Client, res.Err
 }
 
 // Adds a new region to our regions cache.
-func (c *Client) discoverRegion(ctx context.Context, metaRow *pb.GetResponse) (*region.Client, *regioninfo.Info, error) {
+func (c *client) discoverRegion(ctx context.Context, metaRow *pb.GetResponse) (RegionClient, *regioninfo.Info, error) {
 	if metaRow.Result == nil {
-		return nil, nil, errors.New("table not found")
+		return nil, nil, ErrTableNotFound
 	}
+	reg, host, port, err := parseMetaRow(metaRow.Result)
+	if err != nil {
+		return nil, nil, err
+	} else if reg.Offline && !reg.Split {
+		// The regions of a disabled table stay offline until it's
+		// enabled again, so there's no point in retrying.
+		return nil, nil, ErrTableDisabled
+	} else if reg.Offline || host == "" {
+		// The parent of a split is skipped, its daughters are
+		// about to replace it in hbase:meta.
+		return nil, nil, errRegionNotAssigned
+	}
+
+	client, err := c.regionClient(ctx, host, port)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.addRegionToCache(reg, client)
+
+	return client, reg, nil
+}
+
+// Parses a row of hbase:meta into the region it describes and the host and
+// port of the RegionServer serving it.  The host is empty if the region isn't
+// currently assigned, and the region is marked offline if its table is
+// disabled or if it was split.
+func parseMetaRow(row *pb.Result) (*regioninfo.Info, string, uint16, error) {
 	var host string
 	var port uint16
 	var reg *regioninfo.Info
-	for _, cell := range metaRow.Result.Cell {
+	for _, cell := range row.Cell {
 		switch string(cell.Qualifier) {
 		case "regioninfo":
 			var err error
 			reg, err = regioninfo.InfoFromCell(cell)
 			if err != nil {
-				return nil, nil, err
+				return nil, "", 0, err
 			}
 		case "server":
 			value := cell.Value
@@ -526,13 +1422,13 @@ func (c *Client) discoverRegion(ctx context.Context, metaRow *pb.GetResponse) (*
 			}
 			colon := bytes.IndexByte(value, ':')
 			if colon < 1 { // Colon can't be at the beginning.
-				return nil, nil,
+				return nil, "", 0,
 					fmt.Errorf("broken meta: no colon found in info:server %q", cell)
 			}
 			host = string(value[:colon])
 			portU64, err := strconv.ParseUint(string(value[colon+1:]), 10, 16)
 			if err != nil {
-				return nil, nil, err
+				return nil, "", 0, err
 			}
 			port = uint16(portU64)
 		default:
@@ -543,28 +1439,15 @@ func (c *Client) discoverRegion(ctx context.Context, metaRow *pb.GetResponse) (*
 			// regions_cache with the daughter regions of the split.
 		}
 	}
-
-	var res newRegResult
-	ret := make(chan newRegResult)
-	go newRegion(ret, host, port, c.rpcQueueSize, c.flushInterval)
-
-	select {
-	case res = <-ret:
-	case <-ctx.Done():
-		return nil, nil, ErrDeadline
-	}
-
-	if res.Err != nil {
-		return nil, nil, res.Err
+	if reg == nil {
+		return nil, "", 0, fmt.Errorf("broken meta: no info:regioninfo in %q", row)
 	}
-
-	c.addRegionToCache(reg, res.Client)
-
-	return res.Client, reg, nil
+	return reg, host, port, nil
 }
 
-// Adds a region to our meta cache.
-func (c *Client) addRegionToCache(reg *regioninfo.Info, client *region.Client) {
+// Adds a region to our meta cache.  The client is nil for regions connected to
+// lazily, whose RegionServer is recorded in warmRegions beforehand.
+func (c *client) addRegionToCache(reg *regioninfo.Info, client RegionClient) {
 	// Would add more specific information but most fields for reg/client are unexported.
 	log.WithFields(log.Fields{
 		"Region": reg,
@@ -575,7 +1458,9 @@ func (c *Client) addRegionToCache(reg *regioninfo.Info, client *region.Client) {
 	// at this stage no one knows about this region yet, so another thread
 	// may be looking up that region again while we're in the process of
 	// publishing our findings.
-	c.clients.put(reg, client)
+	if client != nil {
+		c.clients.put(reg, client)
+	}
 
 	// 2. Store the region in the sorted map.
 	// This will effectively "publish" the result of our work to other
@@ -585,17 +1470,72 @@ func (c *Client) addRegionToCache(reg *regioninfo.Info, client *region.Client) {
 	// acceptable trade-off.  We avoid extra synchronization complexity in
 	// exchange of occasional duplicate work (which should be rare anyway).
 	c.regions.put(reg.RegionName, reg)
+
+	// 3. Evict the regions this one replaces.
+	// When regions are merged, the merged region starts with the first
+	// parent, so it shadows it in the sorted map, but the second parent
+	// would keep being found for its keys, and keep failing with a
+	// NotServingRegionException.  The parent of a split region is
+	// shadowed by its daughters, but is evicted all the same.  RPCs
+	// waiting for a parent to become available again find this region
+	// once it is.
+	for _, stale := range c.regions.removeOverlaps(reg) {
+		log.WithFields(log.Fields{
+			"Region": stale,
+			"By":     reg,
+		}).Debug("Evicting region replaced by a split or merge.")
+		c.clients.del(stale)
+		c.warmRegions.del(stale)
+	}
+}
+
+// regionMoved marks the given region as unavailable until a connection to the
+// RegionServer it moved to is established.
+func (c *client) regionMoved(reg *regioninfo.Info, host string, port uint16) {
+	if reg == nil || !reg.MarkUnavailable() {
+		return
+	}
+	if reg == c.metaRegionInfo {
+		// The location of the meta region is only trusted from ZooKeeper.
+		go c.reestablishRegion(reg)
+		return
+	}
+	go c.relocateRegion(reg, host, port)
+}
+
+// relocateRegion connects to the RegionServer a region moved to, and makes it
+// available again.  Falls back to looking up the region in hbase:meta if that
+// RegionServer can't be reached.
+func (c *client) relocateRegion(reg *regioninfo.Info, host string, port uint16) {
+	ctx, cancel := context.WithTimeout(context.Background(), regionLookupTimeout)
+	client, err := c.regionClient(ctx, host, port)
+	cancel()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Region": reg,
+			"Host":   host,
+			"Port":   port,
+			"Error":  err,
+		}).Debug("Failed to connect to the new location of the region")
+		c.reestablishRegion(reg)
+		return
+	}
+	c.clients.put(reg, client)
+	reg.MarkAvailable()
 }
 
 // reestablishRegion will continually attempt to reestablish a connection to a
-// given region
-func (c *Client) reestablishRegion(reg *regioninfo.Info) {
+// given region, backing off exponentially between attempts.  It gives up if
+// the table of the region was dropped or disabled, and the RPCs waiting for
+// the region then fail with ErrTableNotFound or ErrTableDisabled.
+func (c *client) reestablishRegion(reg *regioninfo.Info) {
 	// The meta client is not kept in the region client cache.
 	if reg != c.metaRegionInfo {
 		// This region is inaccessible, and a new client will be created, so the
 		// client will be removed from the region client cache.
 		c.clients.del(reg)
 	}
+	backoff := c.minReestablishBackoff
 	for {
 		log.WithFields(log.Fields{
 			"Table":      reg.Table,
@@ -614,17 +1554,35 @@ func (c *Client) reestablishRegion(reg *regioninfo.Info) {
 		} else { // Otherwise do a normal meta lookup.
 			_, _, err = c.locateRegion(ctx, reg.Table, reg.StartKey)
 		}
-		if err == nil {
+		if err == ErrTableNotFound || err == ErrTableDisabled {
+			log.WithFields(log.Fields{
+				"RegionName": reg.RegionName,
+				"Error":      err,
+			}).Warn("Giving up re-establishing region.")
+			// The RPCs waiting for the region look it up again,
+			// and fail with the same error.
+			c.regions.del(reg)
+			c.warmRegions.del(reg)
+			reg.MarkAvailable()
+			return
+		} else if err == nil {
 			reg.MarkAvailable()
 			return
 		}
-		// TODO: Make this configurable, or verify that it's a sane number
-		time.Sleep(time.Millisecond * 100)
+		log.WithFields(log.Fields{
+			"RegionName": reg.RegionName,
+			"Error":      err,
+			"Backoff":    backoff,
+		}).Debug("Failed to re-establish region, backing off.")
+		time.Sleep(jitter(backoff))
+		if backoff *= 2; backoff > c.maxReestablishBackoff {
+			backoff = c.maxReestablishBackoff
+		}
 	}
 }
 
 // Asynchronously looks up the meta region in ZooKeeper.
-func (c *Client) locateMeta(ctx context.Context) error {
+func (c *client) locateMeta(ctx context.Context) error {
 	errchan := make(chan error)
 	go c.locateMetaSync(errchan)
 	select {
@@ -636,7 +1594,7 @@ func (c *Client) locateMeta(ctx context.Context) error {
 }
 
 // Synchronously looks up the meta region in ZooKeeper.
-func (c *Client) locateMetaSync(errchan chan<- error) {
+func (c *client) locateMetaSync(errchan chan<- error) {
 	host, port, err := zk.LocateMeta(c.zkquorum)
 	if err != nil {
 		log.Errorf("Error while locating meta: %s", err)
@@ -647,6 +1605,8 @@ func (c *Client) locateMetaSync(errchan chan<- error) {
 		"Host": host,
 		"Port": port,
 	}).Debug("Located META in ZooKeeper")
-	c.metaClient, err = region.NewClient(host, port, c.rpcQueueSize, c.flushInterval)
+	ctx, cancel := context.WithTimeout(context.Background(), regionLookupTimeout)
+	defer cancel()
+	c.metaClient, err = c.regionClient(ctx, host, port)
 	errchan <- err
 }
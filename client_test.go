@@ -0,0 +1,546 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/region"
+	"github.com/tsuna/gohbase/regioninfo"
+	"golang.org/x/net/context"
+)
+
+// Returns a client whose cache contains a single region covering the whole
+// "test" table, currently marked as unavailable.
+func newClientWithUnavailableRegion(options ...Option) (*client, *regioninfo.Info) {
+	client := newClient("~invalid.quorum~", options...) // We shouldn't connect to ZK.
+	reg := &regioninfo.Info{
+		Table:      []byte("test"),
+		RegionName: []byte("test,,1234567890042.56f833d5569a27c7a43fbf547b4924a4."),
+		StopKey:    []byte(""),
+	}
+	client.addRegionToCache(reg, &mockRegionClient{})
+	reg.MarkUnavailable()
+	return client, reg
+}
+
+func TestFailureHook(t *testing.T) {
+	var failures []*FailedRPC
+	client, _ := newClientWithUnavailableRegion(OnFailure(func(f *FailedRPC) {
+		failures = append(failures, f)
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	get, _ := hrpc.NewGetStr(ctx, "test", "theKey")
+	if _, err := client.Get(get); err != ErrDeadline {
+		t.Fatalf("Expected ErrDeadline, got %v", err)
+	}
+	if len(failures) != 1 {
+		t.Fatalf("Expected the hook to be called once, got %d calls", len(failures))
+	}
+	f := failures[0]
+	if !bytes.Equal(f.Table, []byte("test")) || !bytes.Equal(f.Key, []byte("theKey")) ||
+		f.Operation != "Get" || f.Call != get || f.Err != ErrDeadline {
+		t.Errorf("Unexpected failure reported: %+v", f)
+	}
+}
+
+func TestTableError(t *testing.T) {
+	notFound := region.DoNotRetryError{Exception: region.TableNotFoundException}
+	if err := tableError(notFound); err != ErrTableNotFound {
+		t.Errorf("Expected ErrTableNotFound, got %v", err)
+	}
+	disabled := region.DoNotRetryError{Exception: region.TableNotEnabledException}
+	if err := tableError(disabled); err != ErrTableDisabled {
+		t.Errorf("Expected ErrTableDisabled, got %v", err)
+	}
+	denied := region.DoNotRetryError{Exception: region.AccessDeniedException}
+	if err := tableError(denied); err != denied {
+		t.Errorf("Expected the error to be left alone, got %v", err)
+	}
+
+	if isCacheKeyForTable([]byte("test"), []byte("tes")) ||
+		isCacheKeyForTable([]byte("test"), []byte("test")) {
+		t.Error("Keys shorter than the table name can't be for that table")
+	}
+	if !isCacheKeyForTable([]byte("test"), []byte("test,,1234567890042")) {
+		t.Error("Expected the key to be for the table")
+	}
+}
+
+// A cancellingRegionClient fails the RPCs queued with the error of their
+// context, after cancelling it, as region clients do when the context of an
+// RPC is done before its response is received.
+type cancellingRegionClient struct {
+	mockRegionClient
+	cancel context.CancelFunc
+}
+
+func (c *cancellingRegionClient) QueueRPC(rpc hrpc.Call) error {
+	c.cancel()
+	rpc.GetResultChan() <- hrpc.RPCResult{Error: rpc.GetContext().Err()}
+	return nil
+}
+
+func TestCancelledRPCFailsWithErrDeadline(t *testing.T) {
+	client := newClient("~invalid.quorum~")
+	reg := &regioninfo.Info{
+		Table:      []byte("test"),
+		RegionName: []byte("test,,1234567890042.56f833d5569a27c7a43fbf547b4924a4."),
+		StopKey:    []byte(""),
+	}
+	parent, cancelParent := newTestContext()
+	defer cancelParent()
+	// Either the result or the context can be seen done first.
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithCancel(parent)
+		client.addRegionToCache(reg, &cancellingRegionClient{cancel: cancel})
+		get, _ := hrpc.NewGetStr(ctx, "test", "row")
+		if _, err := client.Get(get); err != ErrDeadline {
+			t.Fatalf("[#%d] Expected ErrDeadline, got %v", i, err)
+		} else if parent.Err() != nil {
+			t.Fatalf("[#%d] The RPC never reached the cached region", i)
+		}
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	client := newClient("~invalid.quorum~", NegativeCacheTTL(time.Hour))
+	client.notFound.put([]byte("nope"), client.negativeCacheTTL)
+
+	// The lookup must fail right away, without trying to reach meta.
+	_, _, err := client.locateRegion(context.Background(), []byte("nope"), []byte("theKey"))
+	if err != ErrTableNotFound {
+		t.Errorf("Expected ErrTableNotFound, got %v", err)
+	}
+	if client.notFound.get([]byte("nop")) || client.notFound.get([]byte("nope2")) {
+		t.Error("Found a negative cache entry for the wrong table")
+	}
+
+	client.notFound.put([]byte("expired"), -time.Second)
+	if client.notFound.get([]byte("expired")) {
+		t.Error("Found an expired negative cache entry")
+	}
+	if _, ok := client.notFound.entries["expired"]; ok {
+		t.Error("Expired negative cache entry wasn't evicted")
+	}
+}
+
+func TestRegionMoved(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+
+	client, reg := newClientWithUnavailableRegion()
+	reg.MarkAvailable()
+	client.regionMoved(reg, s.Host(), s.Port())
+	// The region becomes available again once connected to its new server.
+	for deadline := time.Now().Add(10 * time.Second); reg.GetAvailabilityChan() != nil; {
+		if time.Now().After(deadline) {
+			t.Fatal("The region didn't become available again")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	rc := client.clients.get(reg)
+	if rc == nil || rc.Host() != s.Host() || rc.Port() != s.Port() {
+		t.Errorf("Expected the region to be served by %s:%d, got %v",
+			s.Host(), s.Port(), rc)
+	}
+	rc.Close(context.Background())
+}
+
+func TestRegionCacheSplitsAndMerges(t *testing.T) {
+	client := newClient("~invalid.quorum~")
+	newRegion := func(name, start, stop string) *regioninfo.Info {
+		return &regioninfo.Info{
+			Table:      []byte("test"),
+			RegionName: []byte(name),
+			StartKey:   []byte(start),
+			StopKey:    []byte(stop),
+		}
+	}
+	other := newRegion("other,,1.", "", "")
+	other.Table = []byte("other")
+	client.addRegionToCache(other, &mockRegionClient{})
+	parent := newRegion("test,,1.", "", "")
+	client.addRegionToCache(parent, &mockRegionClient{})
+
+	// Split the region.
+	first := newRegion("test,,2.", "", "m")
+	second := newRegion("test,m,2.", "m", "")
+	client.addRegionToCache(first, &mockRegionClient{})
+	client.addRegionToCache(second, &mockRegionClient{})
+	if client.clients.get(parent) != nil {
+		t.Error("The parent of the split is still cached")
+	}
+	if reg := client.getRegion([]byte("test"), []byte("a")); reg != first {
+		t.Errorf("Expected the first daughter of the split, got %v", reg)
+	}
+	if reg := client.getRegion([]byte("test"), []byte("z")); reg != second {
+		t.Errorf("Expected the second daughter of the split, got %v", reg)
+	}
+
+	// Merge them back.
+	merged := newRegion("test,,3.", "", "")
+	client.addRegionToCache(merged, &mockRegionClient{})
+	for _, key := range []string{"a", "m", "z"} {
+		if reg := client.getRegion([]byte("test"), []byte(key)); reg != merged {
+			t.Errorf("Expected the merged region for %q, got %v", key, reg)
+		}
+	}
+	if client.clients.get(first) != nil || client.clients.get(second) != nil {
+		t.Error("The parents of the merge are still cached")
+	}
+	if reg := client.getRegion([]byte("other"), []byte("a")); reg != other {
+		t.Errorf("The region of another table was evicted, got %v", reg)
+	}
+
+	// Split the merged region in four, and merge the two in the middle:
+	// only those are evicted.
+	quarters := []*regioninfo.Info{
+		newRegion("test,,4.", "", "f"),
+		newRegion("test,f,4.", "f", "m"),
+		newRegion("test,m,4.", "m", "t"),
+		newRegion("test,t,4.", "t", ""),
+	}
+	for _, reg := range quarters {
+		client.addRegionToCache(reg, &mockRegionClient{})
+	}
+	middle := newRegion("test,f,5.", "f", "t")
+	client.addRegionToCache(middle, &mockRegionClient{})
+	for key, expected := range map[string]*regioninfo.Info{
+		"a": quarters[0], "f": middle, "p": middle, "t": quarters[3],
+	} {
+		if reg := client.getRegion([]byte("test"), []byte(key)); reg != expected {
+			t.Errorf("Expected %v for %q, got %v", expected, key, reg)
+		}
+	}
+	for i, reg := range quarters {
+		expected := i == 0 || i == 3
+		if cached := client.clients.get(reg) != nil; cached != expected {
+			t.Errorf("Expected region %v to be cached: %v, got %v", reg, expected, cached)
+		}
+	}
+}
+
+func TestUserClients(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+
+	client := newClient("~invalid.quorum~")
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	alice, err := client.userClient(ctx, s.Host(), s.Port(), "alice")
+	if err != nil {
+		t.Fatalf("Failed to connect on behalf of alice: %s", err)
+	}
+	again, err := client.userClient(ctx, s.Host(), s.Port(), "alice")
+	if err != nil || again != alice {
+		t.Errorf("Expected the connection of alice to be reused, got %v (%v)", again, err)
+	}
+	bob, err := client.userClient(ctx, s.Host(), s.Port(), "bob")
+	if err != nil || bob == alice {
+		t.Errorf("Expected bob to get a separate connection, got %v (%v)", bob, err)
+	}
+}
+
+func TestReopenClosedConnection(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	s.CreateTable("test", []string{"cf"})
+	client := newFakeClient(t, s, IdleTimeout(time.Hour))
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	put, _ := hrpc.NewPutStr(ctx, "test", "row",
+		map[string]map[string][]byte{"cf": {"q": []byte("v")}})
+	if _, err := client.Put(put); err != nil {
+		t.Fatalf("Put failed: %s", err)
+	}
+	reg := client.getRegion([]byte("test"), []byte("row"))
+	rc := client.clientFor(reg)
+	// The connection goes away while no RPC uses it.
+	rc.Close(context.Background())
+	for rc.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	get, _ := hrpc.NewGetStr(ctx, "test", "row")
+	resp, err := client.Get(get)
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	if len(resp.Result.Cell) != 1 || string(resp.Result.Cell[0].Value) != "v" {
+		t.Errorf("Unexpected result %v", resp.Result)
+	}
+	reg = client.getRegion([]byte("test"), []byte("row"))
+	if newRC := client.clientFor(reg); newRC == nil || newRC == rc || newRC.Err() != nil {
+		t.Errorf("Expected the closed connection to be replaced, got %v", newRC)
+	}
+}
+
+func TestReestablishRegionBacksOff(t *testing.T) {
+	client := newClient("~invalid.quorum~", // We shouldn't connect to ZK.
+		ReestablishBackoff(time.Millisecond, 4*time.Millisecond))
+	savedNewRegion := newRegion
+	defer func() { newRegion = savedNewRegion }()
+	newRegion = func(res chan newRegResult, host string, port uint16, queueSize int,
+		queueTimeout time.Duration, options ...region.Option) {
+		res <- newRegResult{&mockRegionClient{}, nil}
+	}
+	// The region isn't assigned to any RegionServer at first.
+	meta := &mockRegionClient{response: &pb.GetResponse{Result: metaRow("", "", "")}}
+	client.metaClient = meta
+	reg := &regioninfo.Info{
+		Table:      []byte("test"),
+		RegionName: []byte("test,,1234567890042.56f833d5569a27c7a43fbf547b4924a4."),
+		StopKey:    []byte(""),
+	}
+	client.addRegionToCache(reg, &mockRegionClient{})
+	reg.MarkUnavailable()
+	ch := reg.GetAvailabilityChan()
+
+	go client.reestablishRegion(reg)
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-ch:
+		t.Fatal("The region was re-established before it was assigned")
+	default:
+	}
+	meta.m.Lock()
+	lookups := len(meta.queued)
+	meta.response = &pb.GetResponse{Result: metaRow("", "", "rs1:16020")}
+	meta.m.Unlock()
+	// Backing off at most 4ms between lookups.
+	if lookups < 2 || lookups > 50 {
+		t.Errorf("Expected the region to be looked up every few ms, got %d lookups", lookups)
+	}
+	select {
+	case <-ch:
+	case <-time.After(10 * time.Second):
+		t.Fatal("The region wasn't re-established")
+	}
+}
+
+func TestReestablishBackoffBounds(t *testing.T) {
+	tests := []struct {
+		min, max       time.Duration
+		expMin, expMax time.Duration
+	}{
+		{time.Millisecond, time.Second, time.Millisecond, time.Second},
+		{0, time.Second, defaultMinReestablishBackoff, time.Second},
+		{-time.Second, 0, defaultMinReestablishBackoff, defaultMinReestablishBackoff},
+		{time.Second, time.Millisecond, time.Second, time.Second},
+	}
+	for i, tt := range tests {
+		client := newClient("~invalid.quorum~", // We shouldn't connect to ZK.
+			ReestablishBackoff(tt.min, tt.max))
+		if client.minReestablishBackoff != tt.expMin ||
+			client.maxReestablishBackoff != tt.expMax {
+			t.Errorf("Test %d: expected backoff between %s and %s, got %s and %s",
+				i, tt.expMin, tt.expMax,
+				client.minReestablishBackoff, client.maxReestablishBackoff)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if d := jitter(10 * time.Millisecond); d < 5*time.Millisecond ||
+			d > 10*time.Millisecond {
+			t.Fatalf("Expected a jittered delay between 5ms and 10ms, got %s", d)
+		}
+	}
+}
+
+// Kills the connection the first time it's written to.
+type killOnce struct {
+	kills int32
+}
+
+func (k *killOnce) OnWrite(rpc hrpc.Call, frame []byte) ([]byte, region.FaultAction) {
+	if atomic.CompareAndSwapInt32(&k.kills, 0, 1) {
+		return frame, region.KillConnection
+	}
+	return frame, region.PassFrame
+}
+
+func (k *killOnce) OnRead(frame []byte) ([]byte, region.FaultAction) {
+	return frame, region.PassFrame
+}
+
+func TestQueuedRPCsSurviveConnectionDrop(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	s.CreateTable("test", []string{"cf"})
+	// The Gets are queued while their region is looked up, and written in
+	// one batch.
+	const n = 10
+	client := newFakeClient(t, s, RpcQueueSize(n), FlushInterval(100*time.Millisecond),
+		ReestablishBackoff(time.Millisecond, 10*time.Millisecond))
+	defer client.Close()
+	faults := &killOnce{}
+	client.regionOptions = append(client.regionOptions, region.Faults(faults))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The connection dies as the first Get is written, failing it along
+	// with those queued behind it.  They're all sent again once the
+	// region is re-established, over a new connection.
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			get, _ := hrpc.NewGetStr(ctx, "test", "row")
+			_, err := client.Get(get)
+			errs <- err
+		}()
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Expected the Get to succeed after the connection dropped, got %s", err)
+		}
+	}
+	if kills := atomic.LoadInt32(&faults.kills); kills != 1 {
+		t.Errorf("Expected the connection to be killed, got %d kills", kills)
+	}
+}
+
+func TestReconnectRegionServers(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	s.CreateTable("test", []string{"cf"})
+	client := newFakeClient(t, s,
+		ReconnectRegionServers(time.Millisecond, 10*time.Millisecond))
+	defer client.Close()
+	faults := &killOnce{}
+	client.regionOptions = append(client.regionOptions, region.Faults(faults))
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	// The connection dies as the Get is written, before it reaches the
+	// RegionServer, so it's written again once reconnected.
+	get, _ := hrpc.NewGetStr(ctx, "test", "row")
+	if _, err := client.Get(get); err != nil {
+		t.Fatalf("Expected the Get to succeed once reconnected, got %s", err)
+	}
+	if kills := atomic.LoadInt32(&faults.kills); kills != 1 {
+		t.Errorf("Expected the connection to be killed, got %d kills", kills)
+	}
+	// Queued only once, rather than retried over a new connection.
+	if md := get.Metadata(); md.Attempts != 1 {
+		t.Errorf("Expected the Get to be queued once, got %d attempts", md.Attempts)
+	}
+}
+
+func TestEffectiveUser(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	s.CreateTable("test", []string{"cf"})
+	client := newFakeClient(t, s, EffectiveUser("alice"))
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	get, _ := hrpc.NewGetStr(ctx, "test", "row")
+	if _, err := client.Get(get); err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	rc := client.clientFor(client.getRegion([]byte("test"), []byte("row")))
+	if user := rc.State().User; user != "alice" {
+		t.Errorf("Expected the connection to be made on behalf of alice, got %q", user)
+	}
+}
+
+func TestDialer(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	s.CreateTable("test", []string{"cf"})
+	var dials int32
+	client := newFakeClient(t, s, Dialer(func(network, address string) (net.Conn, error) {
+		atomic.AddInt32(&dials, 1)
+		return net.Dial(network, address)
+	}))
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	get, _ := hrpc.NewGetStr(ctx, "test", "row")
+	if _, err := client.Get(get); err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	if n := atomic.LoadInt32(&dials); n != 1 {
+		t.Errorf("Expected the RegionServer to be connected to with the dialer, got %d dials", n)
+	}
+}
+
+// Records the headers of the Scan requests written.
+type scanHeaders struct {
+	m       sync.Mutex
+	headers []*pb.RequestHeader
+}
+
+func (h *scanHeaders) OnWrite(rpc hrpc.Call, frame []byte) ([]byte, region.FaultAction) {
+	if rpc.GetName() != "Scan" {
+		return frame, region.PassFrame
+	}
+	// The length of the frame is followed by that of the header.
+	length, n := binary.Uvarint(frame[4:])
+	header := &pb.RequestHeader{}
+	if err := proto.Unmarshal(frame[4+n:4+n+int(length)], header); err == nil {
+		h.m.Lock()
+		h.headers = append(h.headers, header)
+		h.m.Unlock()
+	}
+	return frame, region.PassFrame
+}
+
+func (h *scanHeaders) OnRead(frame []byte) ([]byte, region.FaultAction) {
+	return frame, region.PassFrame
+}
+
+func TestScanPriority(t *testing.T) {
+	_, client, ctx, done := newFakeEnv(t, "test")
+	defer done()
+	headers := &scanHeaders{}
+	client.regionOptions = append(client.regionOptions, region.Faults(headers))
+	for _, key := range []string{"a", "b", "c"} {
+		put, _ := hrpc.NewPutStr(ctx, "test", key,
+			map[string]map[string][]byte{"cf": {"q": []byte(key)}})
+		if _, err := client.Put(put); err != nil {
+			t.Fatalf("Put failed: %s", err)
+		}
+	}
+
+	// One row at a time, so that the scanner is used past its opening.
+	scan, _ := hrpc.NewScanStr(ctx, "test", hrpc.NumberOfRows(1),
+		hrpc.Priority(hrpc.AdminPriority))
+	results, err := client.Scan(scan)
+	if err != nil {
+		t.Fatalf("Scan failed: %s", err)
+	}
+	if len(results) != 3 {
+		t.Errorf("Expected 3 rows, got %d", len(results))
+	}
+	headers.m.Lock()
+	defer headers.m.Unlock()
+	if len(headers.headers) < 2 {
+		t.Fatalf("Expected the scan to take several RPCs, got %d", len(headers.headers))
+	}
+	for i, header := range headers.headers {
+		if header.GetPriority() != hrpc.AdminPriority {
+			t.Errorf("Expected RPC #%d of the scan to have priority %d, got %d",
+				i, hrpc.AdminPriority, header.GetPriority())
+		}
+	}
+}
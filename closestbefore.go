@@ -0,0 +1,80 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"errors"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+)
+
+// Returned by the emit function of the scans of getBefore once they found
+// the row.
+var errRowFound = errors.New("row found")
+
+// ScanForClosestRowBefore will return an option that will make the client
+// carry out the Gets created with hrpc.NewGetBefore with a reversed scan of a
+// single row, rather than with the closest_row_before flag of Gets, which
+// RegionServers stopped supporting in HBase 2.0.  Reversed scans require
+// HBase 0.98 or later.
+func ScanForClosestRowBefore() Option {
+	return func(c *client) {
+		c.scanClosestBefore = true
+	}
+}
+
+// Returns the row at or before the key of the given Get, found with a
+// reversed scan starting at that key.  The result is nil if there's no such
+// row.
+func (c *client) getBefore(get *hrpc.Get) (*pb.GetResponse, error) {
+	options := []func(hrpc.Call) error{
+		hrpc.Families(get.GetFamilies()),
+		hrpc.Filters(get.GetFilter()),
+		hrpc.MaxVersions(get.GetMaxVersions()),
+		hrpc.EffectiveUser(get.User()),
+		hrpc.Tenant(get.Tenant()),
+		hrpc.Reversed(),
+		hrpc.NumberOfRows(1),
+	}
+	if cache := get.GetCacheBlocks(); cache != nil {
+		options = append(options, hrpc.CacheBlocks(*cache))
+	}
+	if consistency := get.GetConsistency(); consistency != nil {
+		options = append(options, hrpc.Consistency(*consistency))
+	}
+	scan, err := hrpc.NewScanRange(get.GetContext(), get.Table(), get.Key(), nil, options...)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.GetResponse{}
+	err = c.scan(scan, func(results []*pb.Result, _ func() error) error {
+		resp.Result = results[0]
+		return errRowFound
+	})
+	get.AddMetadata(scan.Metadata())
+	if err != nil && err != errRowFound {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// Returns a row right before the given one, to look up the region before
+// the one starting with the given key.  Like HBase, this gives up on rows
+// sorting between the returned key followed by more than 9 0xFF bytes and
+// the given one.
+func closestRowBefore(row []byte) []byte {
+	if row[len(row)-1] == 0 {
+		return row[:len(row)-1]
+	}
+	before := make([]byte, len(row), len(row)+9)
+	copy(before, row)
+	before[len(before)-1]--
+	for i := 0; i < 9; i++ {
+		before = append(before, 0xFF)
+	}
+	return before
+}
@@ -0,0 +1,104 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/region"
+)
+
+func TestGetBefore(t *testing.T) {
+	s, legacy, ctx, done := newFakeEnv(t, "test")
+	defer done()
+	for _, key := range []string{"2016-01", "2016-03", "2016-07"} {
+		put, _ := hrpc.NewPutStr(ctx, "test", key,
+			map[string]map[string][]byte{"cf": {"q": []byte(key)}})
+		if _, err := legacy.Put(put); err != nil {
+			t.Fatalf("Put of %q failed: %s", key, err)
+		}
+	}
+
+	scanning := newFakeClient(t, s, ScanForClosestRowBefore())
+	defer scanning.Close()
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{"2016-03", "2016-03"},
+		{"2016-05", "2016-03"},
+		{"2017", "2016-07"},
+		{"2015", ""},
+	}
+	check := func(c *client) {
+		for _, test := range tests {
+			get, _ := hrpc.NewGetBefore(ctx, []byte("test"), []byte(test.key))
+			resp, err := c.Get(get)
+			if err != nil {
+				t.Errorf("Get before %q failed: %s", test.key, err)
+				continue
+			}
+			var row string
+			if resp.Result != nil && len(resp.Result.Cell) != 0 {
+				row = string(resp.Result.Cell[0].Row)
+			}
+			if row != test.expected {
+				t.Errorf("Expected row %q before %q, got %q", test.expected, test.key, row)
+			}
+		}
+	}
+	check(legacy)
+	check(scanning)
+
+	// Like HBase 2.0.
+	s.RejectClosestRowBefore()
+	get, _ := hrpc.NewGetBefore(ctx, []byte("test"), []byte("2016-05"))
+	if _, err := legacy.Get(get); err == nil {
+		t.Error("Expected the Get before a key to be rejected")
+	} else if _, ok := err.(region.DoNotRetryError); !ok {
+		t.Errorf("Expected a DoNotRetryError, got %v", err)
+	}
+	check(scanning)
+}
+
+func TestReversedScan(t *testing.T) {
+	_, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+	for _, key := range []string{"a", "b", "c", "d"} {
+		put, _ := hrpc.NewPutStr(ctx, "test", key,
+			map[string]map[string][]byte{"cf": {"q": []byte(key)}})
+		if _, err := c.Put(put); err != nil {
+			t.Fatalf("Put of %q failed: %s", key, err)
+		}
+	}
+	scan, _ := hrpc.NewScanRangeStr(ctx, "test", "c", "a", hrpc.Reversed(),
+		hrpc.NumberOfRows(1))
+	results, err := c.Scan(scan)
+	if err != nil {
+		t.Fatalf("Scan failed: %s", err)
+	}
+	if len(results) != 2 || string(results[0].Cell[0].Row) != "c" ||
+		string(results[1].Cell[0].Row) != "b" {
+		t.Errorf("Unexpected scan results %v", results)
+	}
+}
+
+func TestClosestRowBefore(t *testing.T) {
+	tests := []struct {
+		row      []byte
+		expected []byte
+	}{
+		{[]byte("b\x00"), []byte("b")},
+		{[]byte("b"), []byte("a\xff\xff\xff\xff\xff\xff\xff\xff\xff")},
+	}
+	for _, test := range tests {
+		if got := closestRowBefore(test.row); !bytes.Equal(got, test.expected) {
+			t.Errorf("Expected %q before %q, got %q", test.expected, test.row, got)
+		}
+	}
+}
@@ -0,0 +1,353 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+// gohbase is a small shell to get, put, scan and delete cells, list tables
+// and describe their regions, without firing up the JRuby HBase shell.
+//
+// A command given as arguments is run once, otherwise commands are read
+// from the standard input.  Run the help command for the list of commands.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tsuna/gohbase"
+	"github.com/tsuna/gohbase/filter"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/regioninfo"
+	"golang.org/x/net/context"
+)
+
+var (
+	zkquorum = flag.String("zkquorum", "localhost",
+		"Specification of the ZooKeeper quorum")
+	timeout = flag.Duration("timeout", 30*time.Second, "Timeout of each command")
+)
+
+const metaTable = "hbase:meta"
+
+var errUsage = errors.New("wrong number of arguments")
+
+type command struct {
+	usage string
+	help  string
+	run   func(ctx context.Context, client gohbase.Client, args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"get": {"get TABLE ROW [FAMILY[:QUALIFIER]]...",
+			"Prints the cells of a row", get},
+		"put": {"put TABLE ROW FAMILY:QUALIFIER VALUE",
+			"Writes a cell", put},
+		"scan": {"scan TABLE [START [STOP]]",
+			"Prints the cells of the rows in [START, STOP)", scan},
+		"delete": {"delete TABLE ROW [FAMILY[:QUALIFIER]]...",
+			"Deletes a row, or some of its families or cells", del},
+		"list": {"list",
+			"Lists the tables", list},
+		"regions": {"regions TABLE",
+			"Describes the regions of a table and where they are", regions},
+		"help": {"help",
+			"Prints this help", help},
+	}
+}
+
+func help(context.Context, gohbase.Client, []string) error {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %-42s %s\n", commands[name].usage, commands[name].help)
+	}
+	return nil
+}
+
+// Parses FAMILY[:QUALIFIER] arguments.
+func parseColumns(args []string) map[string][]string {
+	if len(args) == 0 {
+		return nil
+	}
+	families := make(map[string][]string)
+	for _, arg := range args {
+		parts := strings.SplitN(arg, ":", 2)
+		if len(parts) == 1 {
+			families[parts[0]] = nil
+		} else {
+			families[parts[0]] = append(families[parts[0]], parts[1])
+		}
+	}
+	return families
+}
+
+func printResult(result *pb.Result) {
+	for _, cell := range result.Cell {
+		fmt.Printf("%q %s:%s @%d = %q\n", cell.Row, cell.Family, cell.Qualifier,
+			cell.GetTimestamp(), cell.Value)
+	}
+}
+
+func get(ctx context.Context, client gohbase.Client, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	rpc, err := hrpc.NewGetStr(ctx, args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if families := parseColumns(args[2:]); families != nil {
+		rpc.SetFamilies(families)
+	}
+	resp, err := client.Get(rpc)
+	if err != nil {
+		return err
+	}
+	if resp.Result == nil || len(resp.Result.Cell) == 0 {
+		fmt.Println("(no cells)")
+		return nil
+	}
+	printResult(resp.Result)
+	return nil
+}
+
+func put(ctx context.Context, client gohbase.Client, args []string) error {
+	if len(args) != 4 {
+		return errUsage
+	}
+	column := strings.SplitN(args[2], ":", 2)
+	if len(column) != 2 {
+		return fmt.Errorf("expected FAMILY:QUALIFIER, got %q", args[2])
+	}
+	rpc, err := hrpc.NewPutStr(ctx, args[0], args[1], map[string]map[string][]byte{
+		column[0]: {column[1]: []byte(args[3])},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = client.Put(rpc)
+	return err
+}
+
+func scan(ctx context.Context, client gohbase.Client, args []string) error {
+	if len(args) < 1 || len(args) > 3 {
+		return errUsage
+	}
+	var start, stop string
+	if len(args) > 1 {
+		start = args[1]
+	}
+	if len(args) > 2 {
+		stop = args[2]
+	}
+	rpc, err := hrpc.NewScanRangeStr(ctx, args[0], start, stop)
+	if err != nil {
+		return err
+	}
+	results, err := client.Scan(rpc)
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		printResult(result)
+	}
+	fmt.Printf("(%d rows)\n", len(results))
+	return nil
+}
+
+func del(ctx context.Context, client gohbase.Client, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	var values map[string]map[string][]byte
+	if families := parseColumns(args[2:]); families != nil {
+		values = make(map[string]map[string][]byte, len(families))
+		for family, qualifiers := range families {
+			values[family] = make(map[string][]byte, len(qualifiers))
+			for _, qualifier := range qualifiers {
+				values[family][qualifier] = nil
+			}
+		}
+	}
+	rpc, err := hrpc.NewDelStr(ctx, args[0], args[1], values)
+	if err != nil {
+		return err
+	}
+	_, err = client.Delete(rpc)
+	return err
+}
+
+// Scans the rows of hbase:meta starting with the given prefix.
+func scanMeta(ctx context.Context, client gohbase.Client, start, prefix string) ([]*pb.Result, error) {
+	options := []func(hrpc.Call) error{
+		hrpc.Families(map[string][]string{"info": {"regioninfo", "server"}}),
+	}
+	if prefix != "" {
+		options = append(options, hrpc.Filters(filter.NewPrefixFilter([]byte(prefix))))
+	}
+	rpc, err := hrpc.NewScanRangeStr(ctx, metaTable, start, "", options...)
+	if err != nil {
+		return nil, err
+	}
+	return client.Scan(rpc)
+}
+
+func list(ctx context.Context, client gohbase.Client, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	rows, err := scanMeta(ctx, client, "", "")
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]struct{})
+	for _, row := range rows {
+		for _, cell := range row.Cell {
+			if string(cell.Qualifier) != "regioninfo" {
+				continue
+			}
+			reg, err := regioninfo.InfoFromCell(cell)
+			if err != nil {
+				return err
+			}
+			if _, ok := seen[string(reg.Table)]; !ok {
+				seen[string(reg.Table)] = struct{}{}
+				fmt.Println(string(reg.Table))
+			}
+		}
+	}
+	return nil
+}
+
+func regions(ctx context.Context, client gohbase.Client, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	rows, err := scanMeta(ctx, client, args[0]+",,", args[0]+",")
+	if err != nil {
+		return err
+	} else if len(rows) == 0 {
+		return gohbase.ErrTableNotFound
+	}
+	for _, row := range rows {
+		var reg *regioninfo.Info
+		server := "(unassigned)"
+		for _, cell := range row.Cell {
+			switch string(cell.Qualifier) {
+			case "regioninfo":
+				if reg, err = regioninfo.InfoFromCell(cell); err != nil {
+					return err
+				}
+			case "server":
+				if len(cell.Value) != 0 {
+					server = string(cell.Value)
+				}
+			}
+		}
+		if reg != nil {
+			fmt.Printf("%s\n  start=%q stop=%q server=%s\n",
+				reg.RegionName, reg.StartKey, reg.StopKey, server)
+		}
+	}
+	return nil
+}
+
+// Splits a line into arguments, honoring single and double quotes.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var arg []rune
+	var quote rune
+	inArg := false
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg = append(arg, r)
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, string(arg))
+				arg = arg[:0]
+				inArg = false
+			}
+		default:
+			arg = append(arg, r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inArg {
+		args = append(args, string(arg))
+	}
+	return args, nil
+}
+
+func runCommand(client gohbase.Client, args []string) error {
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q, try help", args[0])
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	err := cmd.run(ctx, client, args[1:])
+	if err == errUsage {
+		err = fmt.Errorf("usage: %s", cmd.usage)
+	}
+	return err
+}
+
+func main() {
+	flag.Parse()
+	client := gohbase.NewClient(*zkquorum)
+	defer client.Close()
+
+	if flag.NArg() > 0 {
+		if err := runCommand(client, flag.Args()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			client.Close()
+			os.Exit(1)
+		}
+		return
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Print("gohbase> ")
+		line, err := in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			fmt.Println()
+			return
+		}
+		args, err := splitArgs(strings.TrimRight(line, "\r\n"))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		} else if len(args) == 0 {
+			continue
+		} else if args[0] == "exit" || args[0] == "quit" {
+			return
+		}
+		if err = runCommand(client, args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+// hbasebench is a load generator in the spirit of YCSB.  It optionally loads
+// a table with records, then runs a mix of reads, updates and scans over
+// them from concurrent workers, and reports the latency percentiles of each
+// kind of operation.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tsuna/gohbase"
+	"github.com/tsuna/gohbase/hrpc"
+	"golang.org/x/net/context"
+)
+
+var (
+	zkquorum = flag.String("zkquorum", "localhost",
+		"Specification of the ZooKeeper quorum")
+	table       = flag.String("table", "usertable", "Table to use, which must exist")
+	family      = flag.String("family", "cf", "Column family to use")
+	records     = flag.Int("records", 100000, "Number of records in the table")
+	load        = flag.Bool("load", false, "Insert the records before running")
+	operations  = flag.Int("operations", 100000, "Number of operations to run")
+	concurrency = flag.Int("concurrency", 16, "Number of concurrent workers")
+	readRatio   = flag.Float64("read", 0.5, "Proportion of reads")
+	updateRatio = flag.Float64("update", 0.5, "Proportion of updates")
+	scanRatio   = flag.Float64("scan", 0, "Proportion of scans")
+	scanLength  = flag.Int("scanlength", 100, "Number of records read by a scan")
+	valueSize   = flag.Int("valuesize", 100, "Size of the values written, in bytes")
+	distrib     = flag.String("distribution", "uniform",
+		"Distribution of the keys accessed: uniform or zipfian")
+	timeout = flag.Duration("timeout", 10*time.Second, "Timeout of each operation")
+)
+
+// Kinds of operations.
+const (
+	insertOp = "insert"
+	readOp   = "read"
+	updateOp = "update"
+	scanOp   = "scan"
+)
+
+// Latencies of the operations of each kind, and the number that failed.
+type stats struct {
+	m         sync.Mutex
+	latencies map[string][]time.Duration
+	failures  map[string]int
+}
+
+func newStats() *stats {
+	return &stats{
+		latencies: make(map[string][]time.Duration),
+		failures:  make(map[string]int),
+	}
+}
+
+func (s *stats) merge(op string, latencies []time.Duration, failures int) {
+	s.m.Lock()
+	s.latencies[op] = append(s.latencies[op], latencies...)
+	s.failures[op] += failures
+	s.m.Unlock()
+}
+
+// Prints the throughput and latency percentiles of each kind of operation.
+func (s *stats) report(elapsed time.Duration) {
+	ops := make([]string, 0, len(s.latencies))
+	for op := range s.latencies {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "op\tcount\tfailed\tops/s\tp50\tp95\tp99\tp99.9\tmax\t")
+	for _, op := range ops {
+		l := s.latencies[op]
+		sort.Sort(durations(l))
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.0f\t%s\t%s\t%s\t%s\t%s\t\n", op, len(l),
+			s.failures[op], float64(len(l))/elapsed.Seconds(),
+			percentile(l, 50), percentile(l, 95), percentile(l, 99),
+			percentile(l, 99.9), percentile(l, 100))
+	}
+	w.Flush()
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+// Returns the given percentile of sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p/100+0.5) - 1
+	if i < 0 {
+		i = 0
+	} else if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// Returns the key of the given record.  Keys are ordered like records, so
+// that a scan reads consecutive records.
+func key(record int) string {
+	return fmt.Sprintf("user%010d", record)
+}
+
+// A benchmark worker, with its own random source as rand's default one is
+// shared and locked.
+type worker struct {
+	client gohbase.Client
+	rnd    *rand.Rand
+	zipf   *rand.Zipf
+	value  []byte
+}
+
+func newWorker(client gohbase.Client, seed int64) *worker {
+	w := &worker{
+		client: client,
+		rnd:    rand.New(rand.NewSource(seed)),
+		value:  make([]byte, *valueSize),
+	}
+	if *distrib == "zipfian" {
+		w.zipf = rand.NewZipf(w.rnd, 1.1, 1, uint64(*records-1))
+	}
+	w.rnd.Read(w.value)
+	return w
+}
+
+// Returns the next record to access.
+func (w *worker) record() int {
+	if w.zipf != nil {
+		return int(w.zipf.Uint64())
+	}
+	return w.rnd.Intn(*records)
+}
+
+// Picks an operation according to the configured mix.
+func (w *worker) pick() string {
+	total := *readRatio + *updateRatio + *scanRatio
+	x := w.rnd.Float64() * total
+	switch {
+	case x < *readRatio:
+		return readOp
+	case x < *readRatio+*updateRatio:
+		return updateOp
+	}
+	return scanOp
+}
+
+// Runs an operation on the given record.
+func (w *worker) run(op string, record int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	k := key(record)
+	switch op {
+	case readOp:
+		get, err := hrpc.NewGetStr(ctx, *table, k)
+		if err != nil {
+			return err
+		}
+		_, err = w.client.Get(get)
+		return err
+	case scanOp:
+		scan, err := hrpc.NewScanRangeStr(ctx, *table, k, key(record+*scanLength))
+		if err != nil {
+			return err
+		}
+		_, err = w.client.Scan(scan)
+		return err
+	}
+	put, err := hrpc.NewPutStr(ctx, *table, k,
+		map[string]map[string][]byte{*family: {"field0": w.value}})
+	if err != nil {
+		return err
+	}
+	_, err = w.client.Put(put)
+	return err
+}
+
+// Runs n operations picked by next from concurrent workers, and records their
+// latencies.
+func runPhase(client gohbase.Client, n int, s *stats, next func(w *worker, i int) (string, int)) time.Duration {
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			w := newWorker(client, start.UnixNano()+int64(id))
+			latencies := make(map[string][]time.Duration)
+			failures := make(map[string]int)
+			for j := id; j < n; j += *concurrency {
+				op, record := next(w, j)
+				opStart := time.Now()
+				if err := w.run(op, record); err != nil {
+					failures[op]++
+					continue
+				}
+				latencies[op] = append(latencies[op], time.Since(opStart))
+			}
+			for op := range latencies {
+				s.merge(op, latencies[op], failures[op])
+				delete(failures, op)
+			}
+			for op, failed := range failures {
+				s.merge(op, nil, failed)
+			}
+		}(i)
+	}
+	wg.Wait()
+	return time.Since(start)
+}
+
+func main() {
+	flag.Parse()
+	if *distrib != "uniform" && *distrib != "zipfian" {
+		log.Fatalf("Unknown distribution %q", *distrib)
+	}
+	if *records < 2 || *concurrency < 1 {
+		log.Fatal("At least 2 records and 1 worker are needed")
+	}
+	client := gohbase.NewClient(*zkquorum)
+	defer client.Close()
+
+	if *load {
+		s := newStats()
+		elapsed := runPhase(client, *records, s, func(w *worker, i int) (string, int) {
+			return insertOp, i
+		})
+		fmt.Printf("Loaded %d records in %s\n", *records, elapsed)
+		s.report(elapsed)
+		fmt.Println()
+	}
+
+	s := newStats()
+	elapsed := runPhase(client, *operations, s, func(w *worker, i int) (string, int) {
+		return w.pick(), w.record()
+	})
+	fmt.Printf("Ran %d operations in %s\n", *operations, elapsed)
+	s.report(elapsed)
+}
@@ -0,0 +1,59 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+// hbaserecord records the RPCs exchanged with a RegionServer, or replays a
+// recording.  To record, point the clients at the listen address instead of
+// the RegionServer (e.g. by making ZooKeeper return it for hbase:meta), and
+// stop the proxy with SIGINT to save the recording.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/tsuna/gohbase/test/rpcrecord"
+)
+
+var (
+	listen   = flag.String("listen", "127.0.0.1:16020", "Address to listen on")
+	upstream = flag.String("record", "",
+		"host:port of the RegionServer to record, replays if unset")
+	file = flag.String("file", "recording.json", "File of the recording")
+)
+
+func main() {
+	flag.Parse()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	if *upstream == "" {
+		rec, err := rpcrecord.Load(*file)
+		if err != nil {
+			log.Fatalf("Failed to load %s: %s", *file, err)
+		}
+		server, err := rpcrecord.NewServer(*listen, rec)
+		if err != nil {
+			log.Fatalf("Failed to listen: %s", err)
+		}
+		log.Printf("Replaying %s on %s", *file, server.Addr())
+		<-interrupt
+		server.Close()
+		return
+	}
+
+	proxy, err := rpcrecord.NewProxy(*listen, *upstream)
+	if err != nil {
+		log.Fatalf("Failed to listen: %s", err)
+	}
+	log.Printf("Recording %s on %s", *upstream, proxy.Addr())
+	<-interrupt
+	proxy.Close()
+	if err = proxy.Recording().Save(*file); err != nil {
+		log.Fatalf("Failed to save %s: %s", *file, err)
+	}
+	log.Printf("Saved %d RPCs to %s", len(proxy.Recording().Exchanges()), *file)
+}
@@ -0,0 +1,35 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+// hbaserest serves the tables of an HBase cluster over HTTP, with a subset of
+// the REST API of HBase's REST server.  See package rest for the requests
+// supported.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/tsuna/gohbase"
+	"github.com/tsuna/gohbase/rest"
+)
+
+var (
+	zkquorum = flag.String("zkquorum", "localhost",
+		"Specification of the ZooKeeper quorum")
+	listen = flag.String("listen", ":8080", "Address to listen on")
+)
+
+func main() {
+	flag.Parse()
+	client := gohbase.NewClient(*zkquorum)
+	defer client.Close()
+	server := rest.NewServer(client)
+	defer server.Close()
+
+	log.Printf("Serving the tables of %s on %s", *zkquorum, *listen)
+	log.Fatal(http.ListenAndServe(*listen, server))
+}
@@ -0,0 +1,53 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+// hbck reports the inconsistencies between hbase:meta, ZooKeeper and the
+// regions the RegionServers serve: holes and overlaps in the regions of
+// tables, and regions not deployed, deployed on the wrong or several
+// RegionServers, or not in hbase:meta.  Like "hbase hbck" without any -fix
+// option, it only reads.  It exits with status 1 if it found any
+// inconsistency.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/tsuna/gohbase"
+	"golang.org/x/net/context"
+)
+
+var (
+	zkquorum = flag.String("zkquorum", "localhost",
+		"Specification of the ZooKeeper quorum")
+	timeout = flag.Duration("timeout", 5*time.Minute, "Timeout of the whole check")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 0 {
+		log.Fatal("Usage: hbck [flags]")
+	}
+	admin := gohbase.NewAdminClient(*zkquorum)
+	defer admin.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	inconsistencies, err := admin.CheckConsistency(ctx)
+	if err != nil {
+		log.Fatalf("Failed to check the consistency of the cluster: %s", err)
+	}
+	for _, inconsistency := range inconsistencies {
+		fmt.Println(inconsistency)
+	}
+	if len(inconsistencies) > 0 {
+		log.Printf("Found %d inconsistencies", len(inconsistencies))
+		os.Exit(1)
+	}
+	log.Print("No inconsistency found")
+}
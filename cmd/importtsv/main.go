@@ -0,0 +1,284 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+// importtsv streams delimited files (or the standard input) into a table.
+//
+// Each line becomes a put, whose row key, timestamp and cells are taken from
+// the fields of the line as mapped by the -columns flag, in the spirit of
+// HBase's ImportTsv.  For instance, with -columns=HBASE_ROW_KEY,cf:a,cf:b the
+// line "row1<TAB>x<TAB>y" writes x in cf:a and y in cf:b of row1.  Puts are
+// sent from concurrent workers, and batched on the wire by the client.
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tsuna/gohbase"
+	"github.com/tsuna/gohbase/hrpc"
+	"golang.org/x/net/context"
+)
+
+var (
+	zkquorum = flag.String("zkquorum", "localhost",
+		"Specification of the ZooKeeper quorum")
+	table   = flag.String("table", "", "Table to import into, which must exist")
+	columns = flag.String("columns", "", "Comma-separated mapping of the fields: "+
+		"HBASE_ROW_KEY, HBASE_TS_KEY (timestamp in ms), FAMILY:QUALIFIER, or - to skip")
+	format    = flag.String("format", "tsv", "Format of the input: tsv or csv (with quoting)")
+	separator = flag.String("separator", "\t", "Separator of the fields in tsv format")
+	header    = flag.Bool("header", false, "Skip the first line of each file")
+	timestamp = flag.Uint64("timestamp", 0,
+		"Timestamp of the cells in ms when there's no HBASE_TS_KEY, 0 for the server time")
+	workers   = flag.Int("workers", 16, "Number of concurrent puts")
+	maxErrors = flag.Int("maxerrors", 0,
+		"Number of bad or failed lines tolerated before aborting, -1 for no limit")
+	errorFile = flag.String("errorfile", "", "File to copy the bad or failed lines to")
+	timeout   = flag.Duration("timeout", 30*time.Second, "Timeout of each put")
+)
+
+const (
+	rowKeyColumn    = "HBASE_ROW_KEY"
+	timestampColumn = "HBASE_TS_KEY"
+	skipColumn      = "-"
+)
+
+// Where the fields of a line go.
+type mapping struct {
+	rowKey    int
+	timestamp int // -1 if the timestamp isn't in the lines.
+	// Family and qualifier of each field, empty for skipped fields.
+	families   []string
+	qualifiers []string
+}
+
+func parseMapping(spec string) (*mapping, error) {
+	m := &mapping{rowKey: -1, timestamp: -1}
+	for i, column := range strings.Split(spec, ",") {
+		column = strings.TrimSpace(column)
+		var family, qualifier string
+		switch column {
+		case rowKeyColumn:
+			if m.rowKey != -1 {
+				return nil, fmt.Errorf("%s given twice", rowKeyColumn)
+			}
+			m.rowKey = i
+		case timestampColumn:
+			if m.timestamp != -1 {
+				return nil, fmt.Errorf("%s given twice", timestampColumn)
+			}
+			m.timestamp = i
+		case skipColumn:
+		default:
+			parts := strings.SplitN(column, ":", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return nil, fmt.Errorf("invalid column %q, expected FAMILY:QUALIFIER", column)
+			}
+			family, qualifier = parts[0], parts[1]
+		}
+		m.families = append(m.families, family)
+		m.qualifiers = append(m.qualifiers, qualifier)
+	}
+	if m.rowKey == -1 {
+		return nil, fmt.Errorf("no %s column", rowKeyColumn)
+	}
+	return m, nil
+}
+
+// Returns the put of the given fields.
+func (m *mapping) put(ctx context.Context, fields []string) (*hrpc.Mutate, error) {
+	if len(fields) != len(m.families) {
+		return nil, fmt.Errorf("expected %d fields, got %d", len(m.families), len(fields))
+	}
+	values := make(map[string]map[string][]byte)
+	for i, field := range fields {
+		family := m.families[i]
+		if family == "" {
+			continue
+		}
+		if values[family] == nil {
+			values[family] = make(map[string][]byte)
+		}
+		values[family][m.qualifiers[i]] = []byte(field)
+	}
+	put, err := hrpc.NewPutStr(ctx, *table, fields[m.rowKey], values)
+	if err != nil {
+		return nil, err
+	}
+	ts := *timestamp
+	if m.timestamp != -1 {
+		if ts, err = strconv.ParseUint(fields[m.timestamp], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid timestamp %q", fields[m.timestamp])
+		}
+	}
+	if ts != 0 {
+		put.SetTimestamp(ts)
+	}
+	return put, nil
+}
+
+// A line to import.
+type line struct {
+	file   string
+	number int
+	fields []string
+	err    error // Set if the line couldn't be parsed.
+}
+
+// Reads the lines of the given input and sends them to the given channel.
+func readLines(name string, r io.Reader, lines chan<- line) {
+	if *format == "csv" {
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		for number := 1; ; number++ {
+			fields, err := cr.Read()
+			if err == io.EOF {
+				return
+			} else if err != nil {
+				lines <- line{file: name, number: number, err: err}
+				if _, ok := err.(*csv.ParseError); !ok {
+					return
+				}
+				continue
+			}
+			if number > 1 || !*header {
+				lines <- line{file: name, number: number, fields: fields}
+			}
+		}
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20)
+	for number := 1; scanner.Scan(); number++ {
+		if number > 1 || !*header {
+			lines <- line{file: name, number: number,
+				fields: strings.Split(scanner.Text(), *separator)}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		lines <- line{file: name, err: err}
+	}
+}
+
+// Copies bad or failed lines to the error file, and aborts once too many
+// were seen.
+type errorLog struct {
+	m      sync.Mutex
+	count  int
+	w      *csv.Writer
+	closer io.Closer
+}
+
+func (e *errorLog) add(l line, err error) {
+	e.m.Lock()
+	defer e.m.Unlock()
+	e.count++
+	log.Printf("%s:%d: %s", l.file, l.number, err)
+	if e.w != nil && l.fields != nil {
+		e.w.Write(l.fields)
+	}
+	if *maxErrors >= 0 && e.count > *maxErrors {
+		e.close()
+		log.Fatalf("Aborting after %d errors", e.count)
+	}
+}
+
+func (e *errorLog) close() {
+	if e.w != nil {
+		e.w.Flush()
+		e.closer.Close()
+	}
+}
+
+func main() {
+	flag.Parse()
+	if *table == "" || *columns == "" {
+		log.Fatal("The -table and -columns flags are required")
+	}
+	if *format != "tsv" && *format != "csv" {
+		log.Fatalf("Unknown format %q", *format)
+	}
+	m, err := parseMapping(*columns)
+	if err != nil {
+		log.Fatalf("Invalid -columns: %s", err)
+	}
+	errs := &errorLog{}
+	if *errorFile != "" {
+		f, err := os.Create(*errorFile)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %s", *errorFile, err)
+		}
+		errs.w, errs.closer = csv.NewWriter(f), f
+		if *format == "tsv" {
+			errs.w.Comma = []rune(*separator)[0]
+		}
+	}
+
+	client := gohbase.NewClient(*zkquorum)
+	defer client.Close()
+
+	lines := make(chan line, *workers*4)
+	go func() {
+		defer close(lines)
+		if flag.NArg() == 0 {
+			readLines("stdin", os.Stdin, lines)
+			return
+		}
+		for _, name := range flag.Args() {
+			f, err := os.Open(name)
+			if err != nil {
+				lines <- line{file: name, err: err}
+				continue
+			}
+			readLines(name, f, lines)
+			f.Close()
+		}
+	}()
+
+	start := time.Now()
+	var imported int64
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for l := range lines {
+				if l.err != nil {
+					errs.add(l, l.err)
+					continue
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+				put, err := m.put(ctx, l.fields)
+				if err == nil {
+					_, err = client.Put(put)
+				}
+				cancel()
+				if err != nil {
+					errs.add(l, err)
+					continue
+				}
+				atomic.AddInt64(&imported, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	errs.close()
+	elapsed := time.Since(start)
+	log.Printf("Imported %d lines in %s (%.0f lines/s), %d errors", imported, elapsed,
+		float64(imported)/elapsed.Seconds(), errs.count)
+	if errs.count != 0 {
+		client.Close()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+// rowcounter counts the rows of a table, scanning its regions in parallel.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/tsuna/gohbase"
+	"golang.org/x/net/context"
+)
+
+var (
+	zkquorum = flag.String("zkquorum", "localhost",
+		"Specification of the ZooKeeper quorum")
+	parallelism = flag.Int("parallelism", 8, "Number of regions scanned at the same time")
+	timeout     = flag.Duration("timeout", time.Hour, "Timeout of the whole count")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("Usage: rowcounter [flags] TABLE")
+	}
+	table := flag.Arg(0)
+	client := gohbase.NewClient(*zkquorum)
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := 0
+	total, err := gohbase.CountRows(ctx, client, table, *parallelism,
+		func(count gohbase.RegionCount) {
+			done++
+			if count.Err != nil {
+				log.Printf("[%d] %s: %s", done, count.Region, count.Err)
+			} else {
+				log.Printf("[%d] %s: %d rows", done, count.Region, count.Rows)
+			}
+		})
+	if err != nil {
+		log.Fatalf("Failed to count the rows of %s: %s", table, err)
+	}
+	log.Printf("Counted %d regions in %s", done, time.Since(start))
+	fmt.Println(total)
+}
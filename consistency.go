@@ -0,0 +1,289 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/regioninfo"
+	"golang.org/x/net/context"
+)
+
+// InconsistencyKind is a kind of inconsistency found by CheckConsistency.
+type InconsistencyKind int
+
+const (
+	// RegionHole means no region covers a range of keys of a table.
+	RegionHole InconsistencyKind = iota
+	// RegionOverlap means several regions cover the same keys.
+	RegionOverlap
+	// RegionNotDeployed means a region of an enabled table isn't served by
+	// any RegionServer, nor in transition.
+	RegionNotDeployed
+	// RegionWrongServer means a region is served by another RegionServer
+	// than the one hbase:meta says.
+	RegionWrongServer
+	// RegionMultiplyDeployed means several RegionServers serve a region.
+	RegionMultiplyDeployed
+	// RegionNotInMeta means a RegionServer serves a region that isn't in
+	// hbase:meta.
+	RegionNotInMeta
+	// MetaNotDeployed means hbase:meta isn't served by the RegionServer
+	// ZooKeeper says.
+	MetaNotDeployed
+)
+
+var inconsistencyKindNames = map[InconsistencyKind]string{
+	RegionHole:             "hole",
+	RegionOverlap:          "overlap",
+	RegionNotDeployed:      "not deployed",
+	RegionWrongServer:      "wrong server",
+	RegionMultiplyDeployed: "multiply deployed",
+	RegionNotInMeta:        "not in meta",
+	MetaNotDeployed:        "meta not deployed",
+}
+
+func (k InconsistencyKind) String() string {
+	if name, ok := inconsistencyKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("InconsistencyKind(%d)", int(k))
+}
+
+// Inconsistency is an inconsistency of the cluster found by CheckConsistency.
+type Inconsistency struct {
+	Kind  InconsistencyKind
+	Table string
+	// Name of the region, or of the first of the overlapping regions.  Empty
+	// for holes.
+	RegionName []byte
+	// Range of keys affected: the hole, the overlap or the region.
+	StartKey []byte
+	StopKey  []byte
+	// "host:port" of the RegionServers involved.
+	Servers []string
+}
+
+func (i Inconsistency) String() string {
+	s := fmt.Sprintf("%s in %s [%q, %q)", i.Kind, i.Table, i.StartKey, i.StopKey)
+	if len(i.RegionName) > 0 {
+		s += fmt.Sprintf(" region %q", i.RegionName)
+	}
+	if len(i.Servers) > 0 {
+		s += fmt.Sprintf(" on %v", i.Servers)
+	}
+	return s
+}
+
+// A region as found in hbase:meta.
+type metaRegion struct {
+	info   *regioninfo.Info
+	server string // Empty if unassigned.
+}
+
+func (a *adminClient) CheckConsistency(ctx context.Context) ([]Inconsistency, error) {
+	scan, err := hrpc.NewScanRange(ctx, metaTableName, nil, nil, hrpc.Families(infoFamily))
+	if err != nil {
+		return nil, err
+	}
+	rows, err := a.cfg.Scan(scan)
+	if err != nil {
+		return nil, err
+	}
+	var regions []metaRegion
+	enabled := make(map[string]bool)
+	for _, row := range rows {
+		reg, host, port, err := parseMetaRow(row)
+		if err != nil {
+			return nil, err
+		}
+		region := metaRegion{info: reg}
+		if host != "" {
+			region.server = net.JoinHostPort(host, strconv.Itoa(int(port)))
+		}
+		regions = append(regions, region)
+		table := string(reg.Table)
+		if _, ok := enabled[table]; !ok {
+			state, err := a.readTableState(ctx, table)
+			if err != nil {
+				return nil, err
+			}
+			enabled[table] = state == pb.Table_ENABLED
+		}
+	}
+
+	status, err := a.ClusterStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	online := make(map[string][]string)
+	for _, live := range status.LiveServers {
+		addr := net.JoinHostPort(live.Server.GetHostName(),
+			strconv.Itoa(int(live.Server.GetPort())))
+		for _, load := range live.ServerLoad.GetRegionLoads() {
+			name := string(load.RegionSpecifier.GetValue())
+			online[name] = append(online[name], addr)
+		}
+	}
+	transitions := make(map[string]struct{})
+	for _, rit := range status.RegionsInTransition {
+		transitions[string(rit.Spec.GetValue())] = struct{}{}
+	}
+
+	type result struct {
+		host string
+		port uint16
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		host, port, err := locateMeta(a.cfg.zkquorum)
+		done <- result{host, port, err}
+	}()
+	var metaServer string
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return nil, res.err
+		}
+		metaServer = net.JoinHostPort(res.host, strconv.Itoa(int(res.port)))
+	case <-ctx.Done():
+		return nil, ErrDeadline
+	}
+
+	return findInconsistencies(regions, enabled, online, transitions,
+		a.cfg.metaRegionInfo.RegionName, metaServer), nil
+}
+
+// Finds the inconsistencies between the regions in hbase:meta, whether their
+// tables are enabled, the RegionServers serving each region (keyed by region
+// name), the regions in transition (keyed by region name), and the
+// RegionServer ZooKeeper says serves the meta region.
+func findInconsistencies(regions []metaRegion, enabled map[string]bool,
+	online map[string][]string, transitions map[string]struct{},
+	metaRegionName []byte, metaServer string) []Inconsistency {
+	var found []Inconsistency
+	if servers := online[string(metaRegionName)]; len(servers) != 1 || servers[0] != metaServer {
+		found = append(found, Inconsistency{Kind: MetaNotDeployed,
+			Table: string(metaTableName), RegionName: metaRegionName,
+			Servers: append([]string{metaServer}, servers...)})
+	}
+
+	tables := make(map[string][]*regioninfo.Info)
+	inMeta := map[string]struct{}{string(metaRegionName): struct{}{}}
+	for _, region := range regions {
+		reg := region.info
+		name := string(reg.RegionName)
+		inMeta[name] = struct{}{}
+		if reg.Offline && reg.Split {
+			continue // Replaced by its daughters.
+		}
+		table := string(reg.Table)
+		tables[table] = append(tables[table], reg)
+
+		if _, ok := transitions[name]; ok {
+			continue
+		} else if _, ok = transitions[encodedName(reg.RegionName)]; ok {
+			continue
+		}
+		inconsistency := Inconsistency{Table: table, RegionName: reg.RegionName,
+			StartKey: reg.StartKey, StopKey: reg.StopKey}
+		servers := online[name]
+		switch {
+		case len(servers) > 1:
+			inconsistency.Kind = RegionMultiplyDeployed
+			inconsistency.Servers = servers
+		case len(servers) == 1 && servers[0] != region.server:
+			inconsistency.Kind = RegionWrongServer
+			inconsistency.Servers = []string{region.server, servers[0]}
+		case len(servers) == 0 && enabled[table] && !reg.Offline:
+			inconsistency.Kind = RegionNotDeployed
+			if region.server != "" {
+				inconsistency.Servers = []string{region.server}
+			}
+		default:
+			continue
+		}
+		found = append(found, inconsistency)
+	}
+
+	names := make([]string, 0, len(online))
+	for name := range online {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, ok := inMeta[name]; ok {
+			continue
+		}
+		table := name
+		if comma := bytes.IndexByte([]byte(name), ','); comma >= 0 {
+			table = name[:comma]
+		}
+		found = append(found, Inconsistency{Kind: RegionNotInMeta, Table: table,
+			RegionName: []byte(name), Servers: online[name]})
+	}
+
+	tableNames := make([]string, 0, len(tables))
+	for table := range tables {
+		tableNames = append(tableNames, table)
+	}
+	sort.Strings(tableNames)
+	for _, table := range tableNames {
+		found = append(found, checkRegionChain(table, tables[table])...)
+	}
+	return found
+}
+
+// Checks that the given regions of a table cover all its keys exactly once.
+func checkRegionChain(table string, regions []*regioninfo.Info) []Inconsistency {
+	sort.Sort(regionsByStartKey(regions))
+	var found []Inconsistency
+	// End of the keys covered so far, nil meaning the end of the table.
+	covered := []byte{}
+	var last *regioninfo.Info
+	for _, reg := range regions {
+		if covered == nil || bytes.Compare(reg.StartKey, covered) < 0 {
+			overlapEnd := covered
+			if len(reg.StopKey) > 0 && (overlapEnd == nil || bytes.Compare(reg.StopKey, overlapEnd) < 0) {
+				overlapEnd = reg.StopKey
+			}
+			found = append(found, Inconsistency{Kind: RegionOverlap, Table: table,
+				RegionName: last.RegionName, StartKey: reg.StartKey, StopKey: overlapEnd})
+		} else if bytes.Compare(reg.StartKey, covered) > 0 {
+			found = append(found, Inconsistency{Kind: RegionHole, Table: table,
+				StartKey: covered, StopKey: reg.StartKey})
+		}
+		// The region covering the furthest is the one later regions
+		// overlap with.
+		if covered != nil && len(reg.StopKey) == 0 {
+			covered = nil
+			last = reg
+		} else if covered != nil && bytes.Compare(reg.StopKey, covered) > 0 {
+			covered = reg.StopKey
+			last = reg
+		}
+	}
+	if covered != nil {
+		found = append(found, Inconsistency{Kind: RegionHole, Table: table,
+			StartKey: covered})
+	}
+	return found
+}
+
+type regionsByStartKey []*regioninfo.Info
+
+func (r regionsByStartKey) Len() int      { return len(r) }
+func (r regionsByStartKey) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r regionsByStartKey) Less(i, j int) bool {
+	return bytes.Compare(r[i].StartKey, r[j].StartKey) < 0
+}
@@ -0,0 +1,142 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/regioninfo"
+)
+
+func TestCheckConsistency(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	defer setFakeMaster(s)()
+	s.CreateTable("test", []string{"cf"})
+	s.CreateTable("test2", []string{"cf"})
+	savedTableState, savedLocateMeta := tableState, locateMeta
+	tableState = func(zkquorum, table string) (pb.Table_State, error) {
+		return pb.Table_ENABLED, nil
+	}
+	metaPort := s.Port()
+	locateMeta = func(string) (string, uint16, error) {
+		return s.Host(), metaPort, nil
+	}
+	defer func() { tableState, locateMeta = savedTableState, savedLocateMeta }()
+	ac := &adminClient{cfg: newFakeClient(t, s), conns: make(map[string]RegionClient)}
+	defer ac.Close()
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	if inconsistencies, err := ac.CheckConsistency(ctx); err != nil {
+		t.Fatalf("CheckConsistency failed: %s", err)
+	} else if len(inconsistencies) != 0 {
+		t.Errorf("Expected no inconsistency, got %v", inconsistencies)
+	}
+
+	metaPort++
+	inconsistencies, err := ac.CheckConsistency(ctx)
+	if err != nil {
+		t.Fatalf("CheckConsistency failed: %s", err)
+	}
+	if len(inconsistencies) != 1 || inconsistencies[0].Kind != MetaNotDeployed {
+		t.Errorf("Expected meta not to be deployed where ZooKeeper says, got %v",
+			inconsistencies)
+	}
+}
+
+func TestFindInconsistencies(t *testing.T) {
+	const rs1, rs2 = "rs1:16020", "rs2:16020"
+	region := func(table, start, stop, server string) metaRegion {
+		return metaRegion{
+			info: &regioninfo.Info{
+				Table:      []byte(table),
+				RegionName: []byte(table + "," + start + ",1." + stop + "."),
+				StartKey:   []byte(start),
+				StopKey:    []byte(stop),
+			},
+			server: server,
+		}
+	}
+	regions := []metaRegion{
+		// Consistent table.
+		region("ok", "", "m", rs1),
+		region("ok", "m", "", rs2),
+		// Hole between b and c, overlap between e and f, no region after g.
+		region("broken", "c", "f", rs1),
+		region("broken", "", "b", rs1),
+		region("broken", "e", "g", rs1),
+		// Not deployed, on the wrong server and deployed twice.
+		region("deploy", "", "a", rs1),
+		region("deploy", "a", "b", rs1),
+		region("deploy", "b", "", rs1),
+		// Regions of a disabled table aren't deployed.
+		region("disabled", "", "", rs1),
+		// In transition.
+		region("moving", "", "", rs1),
+	}
+	split := region("ok", "", "", rs1)
+	split.info.Offline, split.info.Split = true, true
+	regions = append(regions, split)
+
+	online := map[string][]string{"hbase:meta,,1": {rs1}}
+	for _, region := range regions {
+		if region.server != "" && string(region.info.Table) != "deploy" &&
+			string(region.info.Table) != "disabled" && string(region.info.Table) != "moving" &&
+			!region.info.Split {
+			name := string(region.info.RegionName)
+			online[name] = append(online[name], region.server)
+		}
+	}
+	online[string(regions[6].info.RegionName)] = []string{rs2}
+	online[string(regions[7].info.RegionName)] = []string{rs1, rs2}
+	online["orphan,,1.x."] = []string{rs2}
+	enabled := map[string]bool{"ok": true, "broken": true, "deploy": true, "moving": true}
+	transitions := map[string]struct{}{string(regions[9].info.RegionName): struct{}{}}
+
+	found := findInconsistencies(regions, enabled, online, transitions,
+		[]byte("hbase:meta,,1"), rs1)
+	expected := []Inconsistency{
+		{Kind: RegionNotDeployed, Table: "deploy", RegionName: regions[5].info.RegionName,
+			StopKey: []byte("a"), Servers: []string{rs1}},
+		{Kind: RegionWrongServer, Table: "deploy", RegionName: regions[6].info.RegionName,
+			StartKey: []byte("a"), StopKey: []byte("b"), Servers: []string{rs1, rs2}},
+		{Kind: RegionMultiplyDeployed, Table: "deploy", RegionName: regions[7].info.RegionName,
+			StartKey: []byte("b"), Servers: []string{rs1, rs2}},
+		{Kind: RegionNotInMeta, Table: "orphan", RegionName: []byte("orphan,,1.x."),
+			Servers: []string{rs2}},
+		{Kind: RegionHole, Table: "broken", StartKey: []byte("b"), StopKey: []byte("c")},
+		{Kind: RegionOverlap, Table: "broken", RegionName: regions[2].info.RegionName,
+			StartKey: []byte("e"), StopKey: []byte("f")},
+		{Kind: RegionHole, Table: "broken", StartKey: []byte("g")},
+	}
+	if len(found) != len(expected) {
+		t.Fatalf("Expected %d inconsistencies, got %d: %v", len(expected), len(found), found)
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(normalize(found[i]), normalize(expected[i])) {
+			t.Errorf("Expected %v, got %v", expected[i], found[i])
+		}
+	}
+
+	if found = findInconsistencies(nil, nil, map[string][]string{"hbase:meta,,1": {rs2}},
+		nil, []byte("hbase:meta,,1"), rs1); len(found) != 1 || found[0].Kind != MetaNotDeployed {
+		t.Errorf("Expected meta not to be deployed, got %v", found)
+	}
+}
+
+// Makes empty keys nil, so that inconsistencies can be compared.
+func normalize(i Inconsistency) Inconsistency {
+	if len(i.StartKey) == 0 {
+		i.StartKey = nil
+	}
+	if len(i.StopKey) == 0 {
+		i.StopKey = nil
+	}
+	return i
+}
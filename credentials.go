@@ -0,0 +1,259 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/tsuna/gohbase/region"
+	"github.com/tsuna/gohbase/zk"
+)
+
+// A CredentialProvider provides the credentials the client authenticates
+// with, e.g. from Vault, Kubernetes secrets or any other store.  Its methods
+// are called every time a connection is established, so that credentials can
+// be rotated, and may return nil when they have no credentials of that kind.
+type CredentialProvider interface {
+	// GetSASLCredentials returns the credentials to authenticate with using
+	// SASL.
+	GetSASLCredentials() (*region.SASLCredentials, error)
+
+	// GetTLSCertificates returns the certificates to present when
+	// connecting over TLS, see the TLS option.
+	GetTLSCertificates() ([]tls.Certificate, error)
+
+	// GetToken returns the delegation token of the given service, the ID
+	// of the HBase cluster.  It's used to authenticate with SASL when
+	// there are no SASL credentials.
+	GetToken(service string) (*Token, error)
+}
+
+// A Token is a Hadoop delegation token.
+type Token struct {
+	Identifier []byte
+	Password   []byte
+
+	// Kind of the token, HBaseTokenKind for HBase, and service it's valid
+	// for, the ID of the cluster for HBase.  Empty if unknown.
+	Kind    string
+	Service string
+}
+
+// Reads the ID of the cluster in ZooKeeper.  Overridable for tests.
+var readClusterID = zk.ClusterID
+
+// saslCredentials returns the DIGEST-MD5 credentials of the token.
+func (t *Token) saslCredentials() *region.SASLCredentials {
+	return &region.SASLCredentials{
+		Mechanism: region.DigestMD5,
+		Username:  base64.StdEncoding.EncodeToString(t.Identifier),
+		Password:  []byte(base64.StdEncoding.EncodeToString(t.Password)),
+	}
+}
+
+// parseToken parses a token made of its base64-encoded identifier and
+// password, separated by white space.
+func parseToken(s string) (*Token, error) {
+	parts := strings.Fields(s)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid token: expected an identifier and a password,"+
+			" got %d fields", len(parts))
+	}
+	id, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token identifier: %s", err)
+	}
+	password, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token password: %s", err)
+	}
+	return &Token{Identifier: id, Password: password}, nil
+}
+
+// Credentials will return an option that will make the client authenticate
+// with the credentials of the given provider.  The TLS certificates are only
+// used when connecting over TLS.
+func Credentials(provider CredentialProvider) Option {
+	return func(c *client) {
+		c.regionOptions = append(c.regionOptions,
+			region.SASL(func(string) (*region.SASLCredentials, error) {
+				return saslCredentials(provider, c.getClusterID)
+			}),
+			region.ClientCertificates(provider.GetTLSCertificates))
+	}
+}
+
+// Kerberos will return an option that will make the client authenticate with
+// Kerberos, using the GSSAPI SASL mechanism.  The given function returns a
+// new security context for each connection to a RegionServer, given its host:
+// gohbase relies on it for the Kerberos protocol itself.  The RegionServers
+// must not require a SASL security layer (hbase.rpc.protection must be
+// "authentication"): use TLS to protect the connections.
+func Kerberos(newContext func(host string) (region.SecurityContext, error)) Option {
+	creds := &region.SASLCredentials{
+		Mechanism:          region.GSSAPI,
+		NewSecurityContext: newContext,
+	}
+	return func(c *client) {
+		c.regionOptions = append(c.regionOptions,
+			region.SASL(func(string) (*region.SASLCredentials, error) {
+				return creds, nil
+			}))
+	}
+}
+
+// Returns the SASL credentials of the provider, derived from its token of the
+// cluster whose ID clusterID returns if it has no SASL credentials.
+func saslCredentials(provider CredentialProvider,
+	clusterID func() (string, error)) (*region.SASLCredentials, error) {
+	creds, err := provider.GetSASLCredentials()
+	if err != nil || creds != nil {
+		return creds, err
+	}
+	id, err := clusterID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the ID of the cluster: %s", err)
+	}
+	token, err := provider.GetToken(id)
+	if err != nil || token == nil {
+		return nil, err
+	}
+	return token.saslCredentials(), nil
+}
+
+// Returns the ID of the cluster, read from ZooKeeper the first time it's
+// needed.
+func (c *client) getClusterID() (string, error) {
+	c.clusterIDLock.Lock()
+	defer c.clusterIDLock.Unlock()
+	if c.clusterID == "" {
+		id, err := readClusterID(c.zkquorum)
+		if err != nil {
+			return "", err
+		}
+		c.clusterID = id
+	}
+	return c.clusterID, nil
+}
+
+// A FileCredentialProvider reads credentials from files, e.g. mounted from
+// Kubernetes secrets.  The files are read every time credentials are needed,
+// and the credentials whose files aren't set aren't provided.
+type FileCredentialProvider struct {
+	// PEM-encoded certificate and private key presented over TLS.
+	CertFile string
+	KeyFile  string
+
+	// Files of the username and the password to authenticate with using
+	// DIGEST-MD5, whose trailing white space is ignored.
+	UsernameFile string
+	PasswordFile string
+
+	// File of a delegation token used for all servers: its base64-encoded
+	// identifier and password, separated by white space.
+	TokenFile string
+}
+
+// GetSASLCredentials implements CredentialProvider.
+func (p *FileCredentialProvider) GetSASLCredentials() (*region.SASLCredentials, error) {
+	if p.UsernameFile == "" {
+		return nil, nil
+	}
+	username, err := ioutil.ReadFile(p.UsernameFile)
+	if err != nil {
+		return nil, err
+	}
+	var password []byte
+	if p.PasswordFile != "" {
+		if password, err = ioutil.ReadFile(p.PasswordFile); err != nil {
+			return nil, err
+		}
+	}
+	return &region.SASLCredentials{
+		Mechanism: region.DigestMD5,
+		Username:  strings.TrimRight(string(username), " \t\r\n"),
+		Password:  []byte(strings.TrimRight(string(password), " \t\r\n")),
+	}, nil
+}
+
+// GetTLSCertificates implements CredentialProvider.
+func (p *FileCredentialProvider) GetTLSCertificates() ([]tls.Certificate, error) {
+	if p.CertFile == "" {
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(p.CertFile, p.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return []tls.Certificate{cert}, nil
+}
+
+// GetToken implements CredentialProvider.
+func (p *FileCredentialProvider) GetToken(service string) (*Token, error) {
+	if p.TokenFile == "" {
+		return nil, nil
+	}
+	token, err := ioutil.ReadFile(p.TokenFile)
+	if err != nil {
+		return nil, err
+	}
+	return parseToken(string(token))
+}
+
+// An EnvCredentialProvider reads credentials from environment variables named
+// after its prefix: PREFIX_CERT and PREFIX_KEY hold the PEM-encoded
+// certificate and private key presented over TLS, PREFIX_USERNAME and
+// PREFIX_PASSWORD the username and the password to authenticate with using
+// DIGEST-MD5, and PREFIX_TOKEN a delegation token used for all servers, made
+// of its base64-encoded identifier and password separated by white space.
+// The credentials whose variables aren't set aren't provided.
+type EnvCredentialProvider struct {
+	Prefix string
+}
+
+func (p *EnvCredentialProvider) getenv(name string) string {
+	return os.Getenv(p.Prefix + "_" + name)
+}
+
+// GetSASLCredentials implements CredentialProvider.
+func (p *EnvCredentialProvider) GetSASLCredentials() (*region.SASLCredentials, error) {
+	username := p.getenv("USERNAME")
+	if username == "" {
+		return nil, nil
+	}
+	return &region.SASLCredentials{
+		Mechanism: region.DigestMD5,
+		Username:  username,
+		Password:  []byte(p.getenv("PASSWORD")),
+	}, nil
+}
+
+// GetTLSCertificates implements CredentialProvider.
+func (p *EnvCredentialProvider) GetTLSCertificates() ([]tls.Certificate, error) {
+	cert := p.getenv("CERT")
+	if cert == "" {
+		return nil, nil
+	}
+	pair, err := tls.X509KeyPair([]byte(cert), []byte(p.getenv("KEY")))
+	if err != nil {
+		return nil, err
+	}
+	return []tls.Certificate{pair}, nil
+}
+
+// GetToken implements CredentialProvider.
+func (p *EnvCredentialProvider) GetToken(service string) (*Token, error) {
+	token := p.getenv("TOKEN")
+	if token == "" {
+		return nil, nil
+	}
+	return parseToken(token)
+}
@@ -0,0 +1,105 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tsuna/gohbase/region"
+)
+
+// Returns the ID of the cluster the tests authenticate with.
+func testClusterID() (string, error) {
+	return "00000000-0000-0000-0000-000000000000", nil
+}
+
+func TestFileCredentialProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohbase")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	p := &FileCredentialProvider{
+		CertFile:     filepath.Join(dir, "client.crt"),
+		KeyFile:      filepath.Join(dir, "client.key"),
+		UsernameFile: filepath.Join(dir, "username"),
+		PasswordFile: filepath.Join(dir, "password"),
+		TokenFile:    filepath.Join(dir, "token"),
+	}
+	writeKeyPair(t, p.CertFile, p.KeyFile, "client", time.Now())
+	ioutil.WriteFile(p.UsernameFile, []byte("user\n"), 0600)
+	ioutil.WriteFile(p.PasswordFile, []byte("secret\n"), 0600)
+	ioutil.WriteFile(p.TokenFile, []byte("aWQ= cGFzc3dvcmQ=\n"), 0600)
+
+	certs, err := p.GetTLSCertificates()
+	if err != nil || len(certs) != 1 {
+		t.Errorf("Expected a certificate, got %v, %v", certs, err)
+	}
+	creds, err := p.GetSASLCredentials()
+	if err != nil || creds.Mechanism != region.DigestMD5 || creds.Username != "user" ||
+		string(creds.Password) != "secret" {
+		t.Errorf("Unexpected SASL credentials %+v, %v", creds, err)
+	}
+	token, err := p.GetToken("regionserver:16020")
+	if err != nil || string(token.Identifier) != "id" || string(token.Password) != "password" {
+		t.Errorf("Unexpected token %+v, %v", token, err)
+	}
+
+	// Without SASL credentials, those of the token are used.
+	p.UsernameFile = ""
+	creds, err = saslCredentials(p, testClusterID)
+	if err != nil || creds.Username != "aWQ=" || string(creds.Password) != "cGFzc3dvcmQ=" {
+		t.Errorf("Unexpected SASL credentials %+v, %v", creds, err)
+	}
+	// Without any, the client connects with simple authentication.
+	p.TokenFile = ""
+	if creds, err = saslCredentials(p, testClusterID); creds != nil || err != nil {
+		t.Errorf("Expected no SASL credentials, got %+v, %v", creds, err)
+	}
+	p.CertFile = filepath.Join(dir, "missing.crt")
+	if _, err = p.GetTLSCertificates(); err == nil {
+		t.Error("Expected an error for a missing certificate")
+	}
+}
+
+func TestEnvCredentialProvider(t *testing.T) {
+	p := &EnvCredentialProvider{Prefix: "GOHBASE_TEST"}
+	for _, name := range []string{"USERNAME", "PASSWORD", "TOKEN", "CERT", "KEY"} {
+		defer os.Unsetenv("GOHBASE_TEST_" + name)
+	}
+	if creds, err := saslCredentials(p, testClusterID); creds != nil || err != nil {
+		t.Errorf("Expected no SASL credentials, got %+v, %v", creds, err)
+	}
+	if certs, err := p.GetTLSCertificates(); certs != nil || err != nil {
+		t.Errorf("Expected no certificates, got %v, %v", certs, err)
+	}
+
+	os.Setenv("GOHBASE_TEST_TOKEN", "aWQ= cGFzc3dvcmQ=")
+	token, err := p.GetToken("regionserver:16020")
+	if err != nil || string(token.Identifier) != "id" || string(token.Password) != "password" {
+		t.Errorf("Unexpected token %+v, %v", token, err)
+	}
+	os.Setenv("GOHBASE_TEST_TOKEN", "aWQ=")
+	if _, err = p.GetToken("regionserver:16020"); err == nil {
+		t.Error("Expected an error for a token without password")
+	}
+
+	os.Setenv("GOHBASE_TEST_USERNAME", "user")
+	os.Setenv("GOHBASE_TEST_PASSWORD", "secret")
+	creds, err := saslCredentials(p, testClusterID)
+	if err != nil || creds.Username != "user" || string(creds.Password) != "secret" {
+		t.Errorf("Unexpected SASL credentials %+v, %v", creds, err)
+	}
+
+	os.Setenv("GOHBASE_TEST_CERT", "not a certificate")
+	if _, err = p.GetTLSCertificates(); err == nil {
+		t.Error("Expected an error for an invalid certificate")
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"golang.org/x/net/context"
+)
+
+// DiffKind is the kind of change made to a cell.
+type DiffKind int
+
+const (
+	// CellAdded means the column only exists in the second row.
+	CellAdded DiffKind = iota
+	// CellRemoved means the column only exists in the first row.
+	CellRemoved
+	// CellModified means the column has different values in both rows.
+	CellModified
+)
+
+// CellDiff is the difference between two rows in a column.
+type CellDiff struct {
+	Kind      DiffKind
+	Family    []byte
+	Qualifier []byte
+
+	// Latest version of the column in each row, nil if it doesn't exist
+	// there.
+	From, To *pb.Cell
+}
+
+// Returns the latest version of every column of the given row, keyed by
+// "family\x00qualifier".
+func latestCells(r *pb.Result) map[string]*pb.Cell {
+	cells := make(map[string]*pb.Cell)
+	if r == nil {
+		return cells
+	}
+	for _, cell := range r.Cell {
+		column := string(cell.Family) + "\x00" + string(cell.Qualifier)
+		if latest, ok := cells[column]; !ok || cell.GetTimestamp() > latest.GetTimestamp() {
+			cells[column] = cell
+		}
+	}
+	return cells
+}
+
+// Diff compares the latest version of every column of two rows, e.g. the same
+// row read from two clusters or at two points in time, and returns the
+// columns that differ, sorted by family and qualifier.  Timestamps are
+// ignored, only values are compared.  Either row may be nil.
+func Diff(from, to *pb.Result) []CellDiff {
+	fromCells := latestCells(from)
+	toCells := latestCells(to)
+	var diffs []CellDiff
+	for column, fromCell := range fromCells {
+		toCell, ok := toCells[column]
+		if !ok {
+			diffs = append(diffs, CellDiff{Kind: CellRemoved, Family: fromCell.Family,
+				Qualifier: fromCell.Qualifier, From: fromCell})
+		} else if !bytes.Equal(fromCell.Value, toCell.Value) {
+			diffs = append(diffs, CellDiff{Kind: CellModified, Family: fromCell.Family,
+				Qualifier: fromCell.Qualifier, From: fromCell, To: toCell})
+		}
+	}
+	for column, toCell := range toCells {
+		if _, ok := fromCells[column]; !ok {
+			diffs = append(diffs, CellDiff{Kind: CellAdded, Family: toCell.Family,
+				Qualifier: toCell.Qualifier, To: toCell})
+		}
+	}
+	sort.Sort(cellDiffs(diffs))
+	return diffs
+}
+
+type cellDiffs []CellDiff
+
+func (d cellDiffs) Len() int      { return len(d) }
+func (d cellDiffs) Swap(i, j int) { d[i], d[j] = d[j], d[i] }
+func (d cellDiffs) Less(i, j int) bool {
+	if c := bytes.Compare(d[i].Family, d[j].Family); c != 0 {
+		return c < 0
+	}
+	return bytes.Compare(d[i].Qualifier, d[j].Qualifier) < 0
+}
+
+// Merge returns the mutations that make the given row of the given table
+// converge to the to row when it's currently the from row: a put of the
+// columns added or modified, and a delete of all the versions of the columns
+// removed.  Either mutation is nil if there's nothing for it to do.
+func Merge(ctx context.Context, table, key string,
+	from, to *pb.Result) (put, del *hrpc.Mutate, err error) {
+	puts := make(map[string]map[string][]byte)
+	dels := make(map[string]map[string][]byte)
+	for _, diff := range Diff(from, to) {
+		values := puts
+		var value []byte
+		if diff.Kind == CellRemoved {
+			values = dels
+		} else {
+			value = diff.To.Value
+		}
+		family := string(diff.Family)
+		if values[family] == nil {
+			values[family] = make(map[string][]byte)
+		}
+		values[family][string(diff.Qualifier)] = value
+	}
+	if len(puts) > 0 {
+		if put, err = hrpc.NewPutStr(ctx, table, key, puts); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(dels) > 0 {
+		if del, err = hrpc.NewDelStr(ctx, table, key, dels); err != nil {
+			return nil, nil, err
+		}
+	}
+	return put, del, nil
+}
@@ -0,0 +1,94 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+)
+
+func TestDiff(t *testing.T) {
+	cell := func(family, qualifier, value string, ts uint64) *pb.Cell {
+		return &pb.Cell{Row: []byte("row"), Family: []byte(family),
+			Qualifier: []byte(qualifier), Value: []byte(value), Timestamp: proto.Uint64(ts)}
+	}
+	from := &pb.Result{Cell: []*pb.Cell{
+		cell("cf", "same", "1", 1),
+		cell("cf", "modified", "old", 2),
+		cell("cf", "modified", "older", 1),
+		cell("cf", "removed", "1", 1),
+	}}
+	to := &pb.Result{Cell: []*pb.Cell{
+		cell("cf", "same", "1", 5),
+		cell("cf", "modified", "new", 5),
+		cell("cf", "modified", "old", 2),
+		cell("a", "added", "1", 5),
+	}}
+	expected := []struct {
+		kind      DiffKind
+		qualifier string
+	}{{CellAdded, "added"}, {CellModified, "modified"}, {CellRemoved, "removed"}}
+	diffs := Diff(from, to)
+	if len(diffs) != len(expected) {
+		t.Fatalf("Expected %d diffs, got %v", len(expected), diffs)
+	}
+	for i, diff := range diffs {
+		if diff.Kind != expected[i].kind || string(diff.Qualifier) != expected[i].qualifier {
+			t.Errorf("Expected %v on %s, got %v", expected[i].kind, expected[i].qualifier, diff)
+		}
+	}
+	if v := string(diffs[1].From.Value) + "->" + string(diffs[1].To.Value); v != "old->new" {
+		t.Errorf("Expected the latest versions to be compared, got %s", v)
+	}
+	if diffs := Diff(nil, nil); len(diffs) != 0 {
+		t.Errorf("Expected no diff between empty rows, got %v", diffs)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	_, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+
+	row := func(key string) *pb.Result {
+		get, _ := hrpc.NewGetStr(ctx, "test", key)
+		resp, err := c.Get(get)
+		if err != nil {
+			t.Fatalf("Get failed: %s", err)
+		}
+		return resp.Result
+	}
+	for key, values := range map[string]map[string][]byte{
+		"from": {"a": []byte("1"), "b": []byte("2"), "c": []byte("3")},
+		"to":   {"a": []byte("1"), "b": []byte("20"), "d": []byte("4")},
+	} {
+		put, _ := hrpc.NewPutStr(ctx, "test", key, map[string]map[string][]byte{"cf": values})
+		if _, err := c.Put(put); err != nil {
+			t.Fatalf("Put failed: %s", err)
+		}
+	}
+
+	put, del, err := Merge(ctx, "test", "from", row("from"), row("to"))
+	if err != nil {
+		t.Fatalf("Merge failed: %s", err)
+	} else if put == nil || del == nil {
+		t.Fatalf("Expected a put and a delete, got %v and %v", put, del)
+	}
+	if _, err = c.Put(put); err != nil {
+		t.Fatalf("Put failed: %s", err)
+	}
+	if _, err = c.Delete(del); err != nil {
+		t.Fatalf("Delete failed: %s", err)
+	}
+	if diffs := Diff(row("from"), row("to")); len(diffs) != 0 {
+		t.Errorf("Expected the rows to have converged, got %v", diffs)
+	}
+	if put, del, _ = Merge(ctx, "test", "from", row("from"), row("to")); put != nil || del != nil {
+		t.Errorf("Expected no mutation for identical rows, got %v and %v", put, del)
+	}
+}
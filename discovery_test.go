@@ -10,13 +10,16 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/hrpc"
 	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/region"
 	"github.com/tsuna/gohbase/regioninfo"
 	"golang.org/x/net/context"
 )
 
 func TestRegionDiscovery(t *testing.T) {
-	client := NewClient("~invalid.quorum~") // We shouldn't connect to ZK.
+	client := newClient("~invalid.quorum~") // We shouldn't connect to ZK.
 	reg := client.getRegion([]byte("test"), []byte("theKey"))
 	if reg != nil {
 		t.Errorf("Found region %#v even though the cache was empty?!", reg)
@@ -25,7 +28,8 @@ func TestRegionDiscovery(t *testing.T) {
 	// Stub out how we create new regions.
 	savedNewRegion := newRegion
 	defer func() { newRegion = savedNewRegion }()
-	newRegion = func(res chan newRegResult, host string, port uint16, queueSize int, queueTimeout time.Duration) {
+	newRegion = func(res chan newRegResult, host string, port uint16, queueSize int,
+		queueTimeout time.Duration, options ...region.Option) {
 		res <- newRegResult{nil, nil}
 	}
 
@@ -88,3 +92,100 @@ func TestRegionDiscovery(t *testing.T) {
 		t.Errorf("Found region %#v even though this table doesn't exist", reg)
 	}
 }
+
+// Returns a row of hbase:meta for the only region of table "test", offline
+// and without a RegionServer, as when the table is disabled or the region was
+// split.
+func offlineMetaRow(split bool) *pb.Result {
+	row := metaRow("", "", "")
+	info := pb.MustMarshal(&pb.RegionInfo{
+		RegionId: proto.Uint64(1234567890042),
+		TableName: &pb.TableName{
+			Namespace: []byte("default"),
+			Qualifier: []byte("test"),
+		},
+		StartKey: []byte(""),
+		EndKey:   []byte(""),
+		Offline:  proto.Bool(true),
+		Split:    proto.Bool(split),
+	})
+	// The trailing bytes are stripped by regioninfo.InfoFromCell.
+	row.Cell[0].Value = append(append([]byte("PBUF"), info...), "0\x008\x00"...)
+	return row
+}
+
+func TestDiscoverUnavailableRegion(t *testing.T) {
+	client := newClient("~invalid.quorum~") // We shouldn't connect to ZK.
+	savedNewRegion := newRegion
+	defer func() { newRegion = savedNewRegion }()
+	var dials []string
+	newRegion = func(res chan newRegResult, host string, port uint16, queueSize int,
+		queueTimeout time.Duration, options ...region.Option) {
+		dials = append(dials, host)
+		res <- newRegResult{&mockRegionClient{}, nil}
+	}
+
+	testcases := []struct {
+		name string
+		row  *pb.Result
+		err  error
+	}{
+		{name: "unassigned", row: metaRow("", "", ""), err: errRegionNotAssigned},
+		{name: "disabled", row: offlineMetaRow(false), err: ErrTableDisabled},
+		{name: "split", row: offlineMetaRow(true), err: errRegionNotAssigned},
+	}
+	for _, tc := range testcases {
+		_, _, err := client.discoverRegion(context.Background(),
+			&pb.GetResponse{Result: tc.row})
+		if err != tc.err {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.err, err)
+		}
+		if reg := client.getRegion([]byte("test"), []byte("theKey")); reg != nil {
+			t.Errorf("%s: the region shouldn't be cached, found %#v", tc.name, reg)
+		}
+	}
+	if len(dials) != 0 {
+		t.Errorf("Expected no connection to a RegionServer, got %v", dials)
+	}
+}
+
+func TestReestablishRegionOfMissingTable(t *testing.T) {
+	testcases := []struct {
+		name string
+		row  *pb.Result
+		err  error
+	}{
+		{name: "disabled", row: offlineMetaRow(false), err: ErrTableDisabled},
+		{name: "dropped", row: nil, err: ErrTableNotFound},
+	}
+	for _, tc := range testcases {
+		client := newClient("~invalid.quorum~") // We shouldn't connect to ZK.
+		client.metaClient = &mockRegionClient{response: &pb.GetResponse{Result: tc.row}}
+		reg, _, _, err := parseMetaRow(metaRow("", "", "rs1:16020"))
+		if err != nil {
+			t.Fatalf("Failed to parse the meta row: %s", err)
+		}
+		client.addRegionToCache(reg, &mockRegionClient{})
+		reg.MarkUnavailable()
+
+		// This Get waits for the region to be re-established.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		get, _ := hrpc.NewGetStr(ctx, "test", "theKey")
+		errs := make(chan error, 1)
+		go func() {
+			_, err := client.Get(get)
+			errs <- err
+		}()
+
+		// Returns instead of retrying forever.
+		client.reestablishRegion(reg)
+		if err = <-errs; err != tc.err {
+			t.Errorf("%s: expected the waiting Get to fail with %v, got %v",
+				tc.name, tc.err, err)
+		}
+		if cached := client.getRegion([]byte("test"), []byte("theKey")); cached != nil {
+			t.Errorf("%s: expected the region to be evicted, found %#v", tc.name, cached)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tsuna/gohbase/region"
+	"github.com/tsuna/gohbase/regioninfo"
+)
+
+// Number of RPC failures remembered for DumpState.
+const recentErrorsSize = 20
+
+// ClientState is a snapshot of the state of a Client, returned by DumpState
+// for diagnostics.  Its String method formats it for humans, e.g. to attach
+// it to a support ticket.
+type ClientState struct {
+	// Time at which the snapshot was taken.
+	Time time.Time
+
+	// Regions lists the cached regions of each table, by start key.
+	Regions map[string][]RegionState
+
+	// RegionClients describes the connections to the RegionServers, by
+	// address.
+	RegionClients []region.State
+
+	// RecentErrors lists the last RPCs that failed for good, oldest first.
+	RecentErrors []RecentError
+
+	// HotKeys lists the most requested keys of each table, most requested
+	// first, if keys are sampled (see SampleKeys).
+	HotKeys map[string][]HotKey
+}
+
+// RegionState describes a cached region.
+type RegionState struct {
+	Name     []byte
+	StartKey []byte
+	StopKey  []byte
+
+	// Server is the "host:port" of the RegionServer we think serves the
+	// region, empty if unknown.
+	Server string
+
+	// Unavailable is true while the region is being looked up again.
+	Unavailable bool
+}
+
+// RecentError describes an RPC that failed for good.
+type RecentError struct {
+	Time      time.Time
+	Operation string
+	Table     []byte
+	Key       []byte
+	Err       error
+}
+
+// Ring buffer of the last RPC failures.
+type recentErrors struct {
+	m sync.Mutex
+
+	errs []RecentError
+	next int
+}
+
+func (r *recentErrors) add(e RecentError) {
+	r.m.Lock()
+	if len(r.errs) < recentErrorsSize {
+		r.errs = append(r.errs, e)
+	} else {
+		r.errs[r.next] = e
+	}
+	r.next = (r.next + 1) % recentErrorsSize
+	r.m.Unlock()
+}
+
+// Returns the errors remembered, oldest first.
+func (r *recentErrors) list() []RecentError {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if len(r.errs) < recentErrorsSize {
+		return append([]RecentError(nil), r.errs...)
+	}
+	return append(append([]RecentError(nil), r.errs[r.next:]...), r.errs[:r.next]...)
+}
+
+// DumpState returns a snapshot of the state of this client: the regions it
+// has cached, its connections with their queued and in-flight RPCs, and the
+// last RPCs that failed.
+func (c *client) DumpState() ClientState {
+	st := ClientState{
+		Time:         time.Now(),
+		Regions:      make(map[string][]RegionState),
+		RecentErrors: c.recentErrors.list(),
+	}
+	c.regions.m.Lock()
+	enum, err := c.regions.regions.SeekFirst()
+	for err == nil {
+		var v interface{}
+		_, v, err = enum.Next()
+		if err != nil {
+			break
+		}
+		reg := v.(*regioninfo.Info)
+		rs := RegionState{
+			Name:        reg.RegionName,
+			StartKey:    reg.StartKey,
+			StopKey:     reg.StopKey,
+			Unavailable: reg.IsUnavailable(),
+		}
+		if client := c.clients.get(reg); client != nil {
+			rs.Server = net.JoinHostPort(client.Host(), strconv.Itoa(int(client.Port())))
+		} else if addr, ok := c.warmRegions.get(reg); ok {
+			rs.Server = addr
+		}
+		table := string(reg.Table)
+		st.Regions[table] = append(st.Regions[table], rs)
+	}
+	c.regions.m.Unlock()
+
+	if c.keySampler != nil {
+		st.HotKeys = c.keySampler.hotKeys()
+	}
+
+	c.eachRegionClient(func(client RegionClient) {
+		st.RegionClients = append(st.RegionClients, client.State())
+	})
+	sort.Sort(statesByAddr(st.RegionClients))
+	return st
+}
+
+type statesByAddr []region.State
+
+func (s statesByAddr) Len() int      { return len(s) }
+func (s statesByAddr) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s statesByAddr) Less(i, j int) bool {
+	if s[i].Host != s[j].Host {
+		return s[i].Host < s[j].Host
+	}
+	if s[i].Port != s[j].Port {
+		return s[i].Port < s[j].Port
+	}
+	if s[i].Service != s[j].Service {
+		return s[i].Service < s[j].Service
+	}
+	return s[i].User < s[j].User
+}
+
+// String formats the snapshot as a human-readable report.
+func (st ClientState) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "gohbase client state at %s\n", st.Time.Format(time.RFC3339))
+
+	tables := make([]string, 0, len(st.Regions))
+	for table := range st.Regions {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	fmt.Fprintf(&buf, "\nCached regions (%d tables):\n", len(tables))
+	for _, table := range tables {
+		regions := st.Regions[table]
+		fmt.Fprintf(&buf, "  %s (%d regions)\n", table, len(regions))
+		for _, reg := range regions {
+			server := reg.Server
+			if server == "" {
+				server = "unknown"
+			}
+			fmt.Fprintf(&buf, "    %q on %s", reg.Name, server)
+			if reg.Unavailable {
+				buf.WriteString(" [unavailable]")
+			}
+			buf.WriteByte('\n')
+		}
+	}
+
+	fmt.Fprintf(&buf, "\nRegion clients (%d):\n", len(st.RegionClients))
+	for _, rc := range st.RegionClients {
+		fmt.Fprintf(&buf, "  %s %s as %s: ",
+			net.JoinHostPort(rc.Host, strconv.Itoa(int(rc.Port))), rc.Service, rc.User)
+		if rc.Err != nil {
+			fmt.Fprintf(&buf, "down (%s)", rc.Err)
+		} else {
+			buf.WriteString("up")
+		}
+		fmt.Fprintf(&buf, ", %d queued, %d in flight\n", rc.QueueDepth, len(rc.InFlight))
+		for _, rpc := range rc.InFlight {
+			fmt.Fprintf(&buf, "    call %d: %s %s/%q for %s\n",
+				rpc.CallID, rpc.Name, rpc.Table, rpc.Key, rpc.Age)
+		}
+	}
+
+	fmt.Fprintf(&buf, "\nRecent errors (%d):\n", len(st.RecentErrors))
+	for _, e := range st.RecentErrors {
+		fmt.Fprintf(&buf, "  %s %s %s/%q: %s\n", e.Time.Format(time.RFC3339),
+			e.Operation, e.Table, e.Key, e.Err)
+	}
+
+	if st.HotKeys != nil {
+		tables = tables[:0]
+		for table := range st.HotKeys {
+			tables = append(tables, table)
+		}
+		sort.Strings(tables)
+		fmt.Fprintf(&buf, "\nHot keys (%d tables):\n", len(tables))
+		for _, table := range tables {
+			fmt.Fprintf(&buf, "  %s\n", table)
+			for _, key := range st.HotKeys[table] {
+				fmt.Fprintf(&buf, "    %q: %d (overestimated by at most %d)\n", key.Key, key.Count, key.Error)
+			}
+		}
+	}
+	return buf.String()
+}
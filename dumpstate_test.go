@@ -0,0 +1,72 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tsuna/gohbase/hrpc"
+)
+
+func TestDumpState(t *testing.T) {
+	_, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+
+	get, _ := hrpc.NewGetStr(ctx, "test", "row")
+	if _, err := c.Get(get); err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	get, _ = hrpc.NewGetStr(ctx, "nonexistent", "row")
+	if _, err := c.Get(get); err != ErrTableNotFound {
+		t.Fatalf("Expected ErrTableNotFound, got %v", err)
+	}
+
+	st := c.DumpState()
+	if regions := st.Regions["test"]; len(regions) != 1 || regions[0].Server == "" ||
+		regions[0].Unavailable {
+		t.Errorf("Unexpected cached regions for table test: %+v", regions)
+	}
+	if len(st.RegionClients) == 0 {
+		t.Error("Expected at least one region client")
+	}
+	for _, rc := range st.RegionClients {
+		if rc.Err != nil || rc.QueueDepth != 0 || len(rc.InFlight) != 0 {
+			t.Errorf("Unexpected region client state %+v", rc)
+		}
+	}
+	if n := len(st.RecentErrors); n == 0 {
+		t.Fatal("Expected the failed Get to be in the recent errors")
+	}
+	last := st.RecentErrors[len(st.RecentErrors)-1]
+	if last.Err != ErrTableNotFound || string(last.Table) != "nonexistent" ||
+		last.Operation != "Get" {
+		t.Errorf("Unexpected last error %+v", last)
+	}
+	str := st.String()
+	for _, want := range []string{"test (1 regions)", "Get nonexistent/\"row\": table not found"} {
+		if !strings.Contains(str, want) {
+			t.Errorf("Expected %q in state:\n%s", want, str)
+		}
+	}
+}
+
+func TestRecentErrors(t *testing.T) {
+	var r recentErrors
+	for i := 0; i < recentErrorsSize+5; i++ {
+		r.add(RecentError{Err: fmt.Errorf("%d", i)})
+	}
+	errs := r.list()
+	if len(errs) != recentErrorsSize {
+		t.Fatalf("Expected %d errors, got %d", recentErrorsSize, len(errs))
+	}
+	for i, e := range errs {
+		if want := fmt.Sprint(i + 5); e.Err.Error() != want {
+			t.Errorf("Expected error %s at %d, got %s", want, i, e.Err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/region"
+)
+
+// EventListener is notified of each step in the life of the RPCs made by a
+// Client, e.g. to keep an audit trail or for instrumentation finer-grained
+// than aggregate metrics.  An RPC is queued, sent and gets its response once
+// per attempt, may be retried, and either succeeds or fails for good.  The
+// metadata of the RPC so far is available from rpc.Metadata().  The methods
+// are called synchronously from the goroutines handling the RPCs, so they
+// must be fast and must not block.  Embed NopEventListener to only implement
+// some of them.
+type EventListener interface {
+	region.EventListener
+
+	// RPCRetried is called when the RPC is about to be sent again after
+	// failing with the given error.
+	RPCRetried(rpc hrpc.Call, err error)
+
+	// RPCFailed is called when the RPC failed for good with the given
+	// error, and won't be retried anymore.
+	RPCFailed(rpc hrpc.Call, err error)
+}
+
+// NopEventListener is an EventListener ignoring all the events.
+type NopEventListener struct{}
+
+// RPCQueued does nothing.
+func (NopEventListener) RPCQueued(rpc hrpc.Call, addr string) {}
+
+// RPCSent does nothing.
+func (NopEventListener) RPCSent(rpc hrpc.Call, addr string, callID uint32) {}
+
+// RPCResponse does nothing.
+func (NopEventListener) RPCResponse(rpc hrpc.Call, addr string, callID uint32, err error) {}
+
+// RPCRetried does nothing.
+func (NopEventListener) RPCRetried(rpc hrpc.Call, err error) {}
+
+// RPCFailed does nothing.
+func (NopEventListener) RPCFailed(rpc hrpc.Call, err error) {}
+
+// OnEvents will return an option that will make the client notify the given
+// listener of the progress of all its RPCs, including the lookups in
+// hbase:meta made internally to locate regions.
+func OnEvents(listener EventListener) Option {
+	return func(c *client) {
+		c.listener = listener
+		c.regionOptions = append(c.regionOptions, region.Listener(listener))
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/tsuna/gohbase/hrpc"
+)
+
+// Records the events of the RPCs against table "test" or "nonexistent".
+type recordingListener struct {
+	NopEventListener
+
+	m      sync.Mutex
+	events []string
+}
+
+func (l *recordingListener) record(rpc hrpc.Call, event string) {
+	if string(rpc.Table()) == "hbase:meta" {
+		return
+	}
+	l.m.Lock()
+	l.events = append(l.events, fmt.Sprintf("%s %s %s", event, rpc.GetName(), rpc.Table()))
+	l.m.Unlock()
+}
+
+func (l *recordingListener) RPCQueued(rpc hrpc.Call, addr string) {
+	l.record(rpc, "queued")
+}
+
+func (l *recordingListener) RPCSent(rpc hrpc.Call, addr string, callID uint32) {
+	l.record(rpc, "sent")
+}
+
+func (l *recordingListener) RPCResponse(rpc hrpc.Call, addr string, callID uint32, err error) {
+	l.record(rpc, "response")
+}
+
+func (l *recordingListener) RPCRetried(rpc hrpc.Call, err error) {
+	l.record(rpc, "retried")
+}
+
+func (l *recordingListener) RPCFailed(rpc hrpc.Call, err error) {
+	l.record(rpc, "failed "+err.Error())
+}
+
+func TestEventListener(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	s.CreateTable("test", []string{"cf"})
+	l := &recordingListener{}
+	c := newFakeClient(t, s, OnEvents(l))
+	defer c.Close()
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	get, _ := hrpc.NewGetStr(ctx, "test", "row")
+	if _, err := c.Get(get); err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	get, _ = hrpc.NewGetStr(ctx, "nonexistent", "row")
+	if _, err := c.Get(get); err != ErrTableNotFound {
+		t.Fatalf("Expected ErrTableNotFound, got %v", err)
+	}
+	if _, err := c.resendRPC(get, errors.New("test")); err != ErrTableNotFound {
+		t.Fatalf("Expected ErrTableNotFound, got %v", err)
+	}
+
+	expected := []string{
+		"queued Get test",
+		"sent Get test",
+		"response Get test",
+		"failed table not found Get nonexistent",
+		"retried Get nonexistent",
+		"failed table not found Get nonexistent",
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+	if !reflect.DeepEqual(l.events, expected) {
+		t.Errorf("Expected events %q, got %q", expected, l.events)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"github.com/tsuna/gohbase/export"
+	"github.com/tsuna/gohbase/hrpc"
+	"golang.org/x/net/context"
+)
+
+// Number of results buffered by Export while they're being encoded.
+const exportBuffer = 100
+
+// Export streams the rows of the given table to the given encoder, see the
+// export package for the available formats.  Only the given families and
+// qualifiers are exported, or all of them if families is nil.  It returns the
+// number of rows exported, and flushes the encoder once they all are.
+func Export(ctx context.Context, c Client, table string, families map[string][]string,
+	enc export.Encoder) (int, error) {
+	scan, err := hrpc.NewScanStr(ctx, table, hrpc.Families(families))
+	if err != nil {
+		return 0, err
+	}
+	sc := c.Scanner(scan, exportBuffer)
+	defer sc.Close()
+	rows := 0
+	for result := range sc.Rows() {
+		if err = enc.Encode(result); err != nil {
+			return rows, err
+		}
+		rows++
+	}
+	if err = sc.Err(); err != nil {
+		return rows, err
+	}
+	return rows, enc.Flush()
+}
@@ -0,0 +1,364 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package export
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/tsuna/gohbase/pb"
+)
+
+// AvroType is the type of a field of an Avro schema, which determines how the
+// values of its column are decoded.  Numbers and booleans must be encoded as
+// HBase's Bytes.toBytes does.
+type AvroType string
+
+// The types supported.
+const (
+	// AvroBytes copies values as they are.
+	AvroBytes AvroType = "bytes"
+	// AvroString copies values, which must be in UTF-8, as they are.
+	AvroString AvroType = "string"
+	// AvroInt decodes 4-byte big-endian integers.
+	AvroInt AvroType = "int"
+	// AvroLong decodes 8-byte big-endian integers.
+	AvroLong AvroType = "long"
+	// AvroFloat decodes 4-byte big-endian IEEE 754 numbers.
+	AvroFloat AvroType = "float"
+	// AvroDouble decodes 8-byte big-endian IEEE 754 numbers.
+	AvroDouble AvroType = "double"
+	// AvroBoolean decodes single bytes, 0 being false.
+	AvroBoolean AvroType = "boolean"
+)
+
+// Size of the values decoded by each type, 0 for any size.
+var avroTypeSizes = map[AvroType]int{
+	AvroBytes:   0,
+	AvroString:  0,
+	AvroInt:     4,
+	AvroLong:    8,
+	AvroFloat:   4,
+	AvroDouble:  8,
+	AvroBoolean: 1,
+}
+
+// AvroField maps a column to a field of Avro records.  The field is nullable,
+// being null in the rows where the column is missing.
+type AvroField struct {
+	Name      string
+	Family    string
+	Qualifier string
+	Type      AvroType
+}
+
+// AvroSchema describes the Avro records rows are mapped to.
+type AvroSchema struct {
+	// Name of the records, "Row" if empty.
+	Name string
+	// Name of the field holding the row key, as bytes, "key" if empty.
+	KeyField string
+	Fields   []AvroField
+}
+
+// Avro names, for records and fields.
+var avroName = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+
+// InferAvroSchema returns a schema with a bytes field for every column found
+// in the given results, in the order of their families and qualifiers.  Field
+// names are made of the family and qualifier, separated by an underscore,
+// with any character not allowed in Avro names replaced by an underscore.
+func InferAvroSchema(results []*pb.Result) *AvroSchema {
+	seen := make(map[string]struct{})
+	var columns []string
+	for _, result := range results {
+		for _, cell := range result.Cell {
+			// Families can't contain colons.
+			column := string(cell.Family) + ":" + string(cell.Qualifier)
+			if _, ok := seen[column]; !ok {
+				seen[column] = struct{}{}
+				columns = append(columns, column)
+			}
+		}
+	}
+	sort.Strings(columns)
+	schema := &AvroSchema{}
+	names := map[string]struct{}{"key": struct{}{}}
+	for _, column := range columns {
+		colon := strings.IndexByte(column, ':')
+		base := avroFieldName(column[:colon] + "_" + column[colon+1:])
+		name := base
+		for i := 2; ; i++ {
+			if _, ok := names[name]; !ok {
+				break
+			}
+			name = fmt.Sprintf("%s_%d", base, i)
+		}
+		names[name] = struct{}{}
+		schema.Fields = append(schema.Fields, AvroField{
+			Name:      name,
+			Family:    column[:colon],
+			Qualifier: column[colon+1:],
+			Type:      AvroBytes,
+		})
+	}
+	return schema
+}
+
+// Returns the given string with the characters not allowed in Avro names
+// replaced by underscores.
+func avroFieldName(s string) string {
+	name := []byte(s)
+	for i, c := range name {
+		if !(c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c == '_' ||
+			i > 0 && c >= '0' && c <= '9') {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 {
+		return "_"
+	}
+	return string(name)
+}
+
+// Schema of the records of the rows when no schema is given: the row key and
+// all the cells of the row.
+const avroCellsSchema = `{"type":"record","name":"Row","fields":[` +
+	`{"name":"key","type":"bytes"},` +
+	`{"name":"cells","type":{"type":"array","items":{"type":"record","name":"Cell","fields":[` +
+	`{"name":"family","type":"bytes"},` +
+	`{"name":"qualifier","type":"bytes"},` +
+	`{"name":"timestamp","type":"long"},` +
+	`{"name":"value","type":"bytes"}]}}}]}`
+
+// Returns the JSON representation of the schema, after checking it.
+func (s *AvroSchema) json() ([]byte, error) {
+	type field struct {
+		Name    string           `json:"name"`
+		Type    interface{}      `json:"type"`
+		Default *json.RawMessage `json:"default,omitempty"`
+	}
+	type record struct {
+		Type   string  `json:"type"`
+		Name   string  `json:"name"`
+		Fields []field `json:"fields"`
+	}
+	name := s.Name
+	if name == "" {
+		name = "Row"
+	}
+	if !avroName.MatchString(name) {
+		return nil, fmt.Errorf("invalid Avro record name %q", name)
+	}
+	r := record{Type: "record", Name: name}
+	null := json.RawMessage("null")
+	names := make(map[string]struct{})
+	for i, f := range append([]AvroField{{Name: s.keyField(), Type: AvroBytes}}, s.Fields...) {
+		if !avroName.MatchString(f.Name) {
+			return nil, fmt.Errorf("invalid Avro field name %q", f.Name)
+		} else if _, ok := names[f.Name]; ok {
+			return nil, fmt.Errorf("duplicate Avro field %q", f.Name)
+		} else if _, ok := avroTypeSizes[f.Type]; !ok {
+			return nil, fmt.Errorf("unsupported Avro type %q for field %q", f.Type, f.Name)
+		}
+		names[f.Name] = struct{}{}
+		if i == 0 {
+			// The row key is never null.
+			r.Fields = append(r.Fields, field{Name: f.Name, Type: f.Type})
+		} else {
+			r.Fields = append(r.Fields, field{
+				Name:    f.Name,
+				Type:    []AvroType{"null", f.Type},
+				Default: &null,
+			})
+		}
+	}
+	return json.Marshal(r)
+}
+
+func (s *AvroSchema) keyField() string {
+	if s.KeyField == "" {
+		return "key"
+	}
+	return s.KeyField
+}
+
+// Number of bytes of records after which a block is written.
+const avroBlockSize = 64 << 10
+
+type avroEncoder struct {
+	w      *bufio.Writer
+	schema *AvroSchema
+	// Columns of the fields of the schema, as "family:qualifier".
+	columns map[string]int
+	sync    [16]byte
+
+	// Records of the current block, and their number.
+	block   []byte
+	records int64
+	// Values of the fields of the record being encoded.
+	values [][]byte
+}
+
+// NewAvroEncoder returns an Encoder writing an Avro object container file, in
+// which each row is a record of the given schema (see InferAvroSchema).  With
+// a nil schema, records have the row key and an array of all the cells of the
+// row instead, each with its family, qualifier, timestamp and value.  The
+// header of the file is written right away, and records are written in blocks
+// of about 64KB, uncompressed.
+func NewAvroEncoder(w io.Writer, schema *AvroSchema) (Encoder, error) {
+	e := &avroEncoder{w: bufio.NewWriter(w), schema: schema}
+	if _, err := rand.Read(e.sync[:]); err != nil {
+		return nil, err
+	}
+	schemaJSON := []byte(avroCellsSchema)
+	if schema != nil {
+		var err error
+		if schemaJSON, err = schema.json(); err != nil {
+			return nil, err
+		}
+		e.columns = make(map[string]int, len(schema.Fields))
+		for i, f := range schema.Fields {
+			e.columns[f.Family+":"+f.Qualifier] = i
+		}
+		e.values = make([][]byte, len(schema.Fields))
+	}
+	header := []byte{'O', 'b', 'j', 1}
+	// The metadata is a map of 2 entries, followed by an empty block.
+	header = appendAvroLong(header, 2)
+	header = appendAvroBytes(header, []byte("avro.schema"))
+	header = appendAvroBytes(header, schemaJSON)
+	header = appendAvroBytes(header, []byte("avro.codec"))
+	header = appendAvroBytes(header, []byte("null"))
+	header = appendAvroLong(header, 0)
+	header = append(header, e.sync[:]...)
+	if _, err := e.w.Write(header); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Appends a long or int, zig-zag encoded as a varint like encoding/binary
+// does.
+func appendAvroLong(buf []byte, v int64) []byte {
+	var varint [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(varint[:], v)
+	return append(buf, varint[:n]...)
+}
+
+func appendAvroBytes(buf []byte, v []byte) []byte {
+	buf = appendAvroLong(buf, int64(len(v)))
+	return append(buf, v...)
+}
+
+// Appends the value of a cell as the given type.
+func appendAvroValue(buf []byte, t AvroType, v []byte) []byte {
+	switch t {
+	case AvroInt:
+		return appendAvroLong(buf, int64(int32(binary.BigEndian.Uint32(v))))
+	case AvroLong:
+		return appendAvroLong(buf, int64(binary.BigEndian.Uint64(v)))
+	case AvroFloat:
+		var le [4]byte
+		binary.LittleEndian.PutUint32(le[:], binary.BigEndian.Uint32(v))
+		return append(buf, le[:]...)
+	case AvroDouble:
+		var le [8]byte
+		binary.LittleEndian.PutUint64(le[:], binary.BigEndian.Uint64(v))
+		return append(buf, le[:]...)
+	case AvroBoolean:
+		if v[0] != 0 {
+			return append(buf, 1)
+		}
+		return append(buf, 0)
+	}
+	return appendAvroBytes(buf, v)
+}
+
+func (e *avroEncoder) Encode(result *pb.Result) error {
+	if len(result.Cell) == 0 {
+		return nil
+	}
+	buf := appendAvroBytes(e.block, result.Cell[0].Row)
+	if e.schema == nil {
+		buf = appendAvroLong(buf, int64(len(result.Cell)))
+		for _, cell := range result.Cell {
+			buf = appendAvroBytes(buf, cell.Family)
+			buf = appendAvroBytes(buf, cell.Qualifier)
+			buf = appendAvroLong(buf, int64(cell.GetTimestamp()))
+			buf = appendAvroBytes(buf, cell.Value)
+		}
+		buf = appendAvroLong(buf, 0)
+	} else {
+		for i := range e.values {
+			e.values[i] = nil
+		}
+		// Cells are sorted by timestamp in decreasing order, so the first
+		// one of each column is its latest version.
+		for _, cell := range result.Cell {
+			i, ok := e.columns[string(cell.Family)+":"+string(cell.Qualifier)]
+			if !ok || e.values[i] != nil {
+				continue
+			}
+			f := &e.schema.Fields[i]
+			if size := avroTypeSizes[f.Type]; size != 0 && len(cell.Value) != size {
+				return fmt.Errorf("value of %s:%s in row %q is %d bytes long, expected %d for an Avro %s",
+					f.Family, f.Qualifier, cell.Row, len(cell.Value), size, f.Type)
+			}
+			e.values[i] = cell.Value
+		}
+		for i, v := range e.values {
+			if v == nil {
+				// Index of the null branch of the union.
+				buf = appendAvroLong(buf, 0)
+				continue
+			}
+			buf = appendAvroLong(buf, 1)
+			buf = appendAvroValue(buf, e.schema.Fields[i].Type, v)
+		}
+	}
+	e.block = buf
+	e.records++
+	if len(e.block) >= avroBlockSize {
+		return e.writeBlock()
+	}
+	return nil
+}
+
+// Writes the records encoded so far as a block.
+func (e *avroEncoder) writeBlock() error {
+	if e.records == 0 {
+		return nil
+	}
+	header := appendAvroLong(nil, e.records)
+	header = appendAvroLong(header, int64(len(e.block)))
+	if _, err := e.w.Write(header); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(e.block); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(e.sync[:]); err != nil {
+		return err
+	}
+	e.block = e.block[:0]
+	e.records = 0
+	return nil
+}
+
+func (e *avroEncoder) Flush() error {
+	if err := e.writeBlock(); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
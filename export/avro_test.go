@@ -0,0 +1,285 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/pb"
+)
+
+// Reads the values of an Avro object container file.
+type avroReader struct {
+	t   *testing.T
+	buf []byte
+}
+
+func (r *avroReader) long() int64 {
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.t.Fatalf("Invalid varint in %q", r.buf)
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *avroReader) bytes() []byte {
+	n := int(r.long())
+	if n > len(r.buf) {
+		r.t.Fatalf("Truncated value of %d bytes in %q", n, r.buf)
+	}
+	v := r.buf[:n]
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *avroReader) fixed(n int) []byte {
+	if n > len(r.buf) {
+		r.t.Fatalf("Truncated value of %d bytes in %q", n, r.buf)
+	}
+	v := r.buf[:n]
+	r.buf = r.buf[n:]
+	return v
+}
+
+// Reads the header of the file, and returns its schema and sync marker.
+func (r *avroReader) header() (map[string]interface{}, []byte) {
+	if magic := r.fixed(4); string(magic) != "Obj\x01" {
+		r.t.Fatalf("Invalid magic %q", magic)
+	}
+	meta := make(map[string]string)
+	for n := r.long(); n != 0; n = r.long() {
+		for i := int64(0); i < n; i++ {
+			key := string(r.bytes())
+			meta[key] = string(r.bytes())
+		}
+	}
+	if meta["avro.codec"] != "null" {
+		r.t.Errorf("Unexpected codec %q", meta["avro.codec"])
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(meta["avro.schema"]), &schema); err != nil {
+		r.t.Fatalf("Invalid schema %q: %s", meta["avro.schema"], err)
+	}
+	return schema, r.fixed(16)
+}
+
+// Reads the blocks of the file, calling record for each record.
+func (r *avroReader) blocks(sync []byte, record func()) int {
+	blocks := 0
+	for len(r.buf) != 0 {
+		n := r.long()
+		size := int(r.long())
+		before := len(r.buf)
+		for i := int64(0); i < n; i++ {
+			record()
+		}
+		if before-len(r.buf) != size {
+			r.t.Errorf("Block of %d bytes, expected %d", before-len(r.buf), size)
+		}
+		if marker := r.fixed(16); !bytes.Equal(marker, sync) {
+			r.t.Fatalf("Invalid sync marker %q", marker)
+		}
+		blocks++
+	}
+	return blocks
+}
+
+func TestAvroCells(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewAvroEncoder(&buf, nil)
+	if err != nil {
+		t.Fatalf("NewAvroEncoder failed: %s", err)
+	}
+	var expected []*pb.Result
+	for i := 0; i < 2000; i++ {
+		r := result(fmt.Sprintf("row%04d", i), "value", "other value")
+		if err = enc.Encode(r); err != nil {
+			t.Fatalf("Encode failed: %s", err)
+		}
+		expected = append(expected, r)
+	}
+	if err = enc.Encode(&pb.Result{}); err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+	if err = enc.Flush(); err != nil {
+		t.Fatalf("Flush failed: %s", err)
+	}
+
+	r := &avroReader{t: t, buf: buf.Bytes()}
+	schema, sync := r.header()
+	if schema["name"] != "Row" {
+		t.Errorf("Unexpected schema %v", schema)
+	}
+	var results []*pb.Result
+	blocks := r.blocks(sync, func() {
+		key := r.bytes()
+		result := &pb.Result{}
+		for n := r.long(); n != 0; n = r.long() {
+			for i := int64(0); i < n; i++ {
+				result.Cell = append(result.Cell, &pb.Cell{
+					Row:       key,
+					Family:    r.bytes(),
+					Qualifier: r.bytes(),
+					Timestamp: proto.Uint64(uint64(r.long())),
+					Value:     r.bytes(),
+				})
+			}
+		}
+		results = append(results, result)
+	})
+	if blocks < 2 {
+		t.Errorf("Expected several blocks, got %d", blocks)
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(results))
+	}
+	for i, r := range results {
+		if !proto.Equal(r, expected[i]) {
+			t.Errorf("Expected %v, got %v", expected[i], r)
+		}
+	}
+}
+
+func TestAvroSchema(t *testing.T) {
+	schema := &AvroSchema{
+		Name:     "Measure",
+		KeyField: "id",
+		Fields: []AvroField{
+			{Name: "name", Family: "cf", Qualifier: "name", Type: AvroString},
+			{Name: "count", Family: "cf", Qualifier: "count", Type: AvroLong},
+			{Name: "small", Family: "cf", Qualifier: "small", Type: AvroInt},
+			{Name: "ratio", Family: "cf", Qualifier: "ratio", Type: AvroDouble},
+			{Name: "approx", Family: "cf", Qualifier: "approx", Type: AvroFloat},
+			{Name: "ok", Family: "cf", Qualifier: "ok", Type: AvroBoolean},
+			{Name: "missing", Family: "cf", Qualifier: "missing", Type: AvroBytes},
+		},
+	}
+	var buf bytes.Buffer
+	enc, err := NewAvroEncoder(&buf, schema)
+	if err != nil {
+		t.Fatalf("NewAvroEncoder failed: %s", err)
+	}
+	count := make([]byte, 8)
+	binary.BigEndian.PutUint64(count, uint64(1<<40))
+	small := make([]byte, 4)
+	binary.BigEndian.PutUint32(small, uint32(0xFFFFFFFF)) // -1
+	ratio := make([]byte, 8)
+	binary.BigEndian.PutUint64(ratio, math.Float64bits(0.25))
+	approx := make([]byte, 4)
+	binary.BigEndian.PutUint32(approx, math.Float32bits(1.5))
+	cell := func(qualifier string, value []byte) *pb.Cell {
+		return &pb.Cell{Row: []byte("row"), Family: []byte("cf"),
+			Qualifier: []byte(qualifier), Value: value}
+	}
+	row := &pb.Result{Cell: []*pb.Cell{
+		cell("approx", approx),
+		cell("count", count),
+		cell("name", []byte("gohbase")),
+		// Older version of the same column, ignored.
+		cell("name", []byte("old")),
+		cell("ok", []byte{0xFF}),
+		cell("ratio", ratio),
+		cell("small", small),
+		cell("unknown", []byte("ignored")),
+	}}
+	if err = enc.Encode(row); err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+	if err = enc.Flush(); err != nil {
+		t.Fatalf("Flush failed: %s", err)
+	}
+
+	r := &avroReader{t: t, buf: buf.Bytes()}
+	header, sync := r.header()
+	fields := header["fields"].([]interface{})
+	if header["name"] != "Measure" || len(fields) != 8 {
+		t.Fatalf("Unexpected schema %v", header)
+	}
+	if field := fields[0].(map[string]interface{}); field["name"] != "id" ||
+		field["type"] != "bytes" {
+		t.Errorf("Unexpected key field %v", field)
+	}
+	if field := fields[2].(map[string]interface{}); !reflect.DeepEqual(field,
+		map[string]interface{}{"name": "count", "type": []interface{}{"null", "long"},
+			"default": nil}) {
+		t.Errorf("Unexpected field %v", field)
+	}
+	var got []interface{}
+	r.blocks(sync, func() {
+		got = append(got, string(r.bytes()))
+		for _, f := range schema.Fields {
+			if r.long() == 0 {
+				got = append(got, nil)
+				continue
+			}
+			switch f.Type {
+			case AvroString:
+				got = append(got, string(r.bytes()))
+			case AvroLong, AvroInt:
+				got = append(got, r.long())
+			case AvroDouble:
+				got = append(got, math.Float64frombits(binary.LittleEndian.Uint64(r.fixed(8))))
+			case AvroFloat:
+				got = append(got, math.Float32frombits(binary.LittleEndian.Uint32(r.fixed(4))))
+			case AvroBoolean:
+				got = append(got, r.fixed(1)[0] == 1)
+			default:
+				got = append(got, r.bytes())
+			}
+		}
+	})
+	expected := []interface{}{"row", "gohbase", int64(1 << 40), int64(-1), 0.25,
+		float32(1.5), true, nil}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+
+	row = &pb.Result{Cell: []*pb.Cell{cell("count", []byte{1})}}
+	if err = enc.Encode(row); err == nil {
+		t.Error("Expected an error for a long of 1 byte")
+	}
+
+	for i, schema := range []*AvroSchema{
+		{Name: "invalid name"},
+		{Fields: []AvroField{{Name: "key", Type: AvroBytes}}},
+		{Fields: []AvroField{{Name: "a", Type: "map"}}},
+	} {
+		if _, err = NewAvroEncoder(&buf, schema); err == nil {
+			t.Errorf("[#%d] Expected an error for an invalid schema", i)
+		}
+	}
+}
+
+func TestInferAvroSchema(t *testing.T) {
+	results := []*pb.Result{
+		result("a", "x", "y"),
+		{Cell: []*pb.Cell{
+			&pb.Cell{Family: []byte("cf"), Qualifier: []byte("q-0")},
+			&pb.Cell{Family: []byte("d"), Qualifier: []byte("")},
+		}},
+	}
+	schema := InferAvroSchema(results)
+	expected := []AvroField{
+		{Name: "cf_q_0", Family: "cf", Qualifier: "q-0", Type: AvroBytes},
+		{Name: "cf_q0", Family: "cf", Qualifier: "q0", Type: AvroBytes},
+		{Name: "cf_q1", Family: "cf", Qualifier: "q1", Type: AvroBytes},
+		{Name: "d_", Family: "d", Qualifier: "", Type: AvroBytes},
+	}
+	if !reflect.DeepEqual(schema.Fields, expected) {
+		t.Errorf("Expected %v, got %v", expected, schema.Fields)
+	}
+	if _, err := NewAvroEncoder(&bytes.Buffer{}, schema); err != nil {
+		t.Errorf("Inferred schema rejected: %s", err)
+	}
+}
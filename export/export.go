@@ -0,0 +1,80 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+// Package export encodes the results of scans, so that tables can be dumped
+// to files without a MapReduce job.
+//
+// Three formats are supported: JSON Lines, for consumption by other tools,
+// Hadoop SequenceFiles in the format of HBase's Export tool, which can be
+// loaded back with its Import tool, and Avro object container files, for data
+// lakes.
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/tsuna/gohbase/pb"
+)
+
+// An Encoder writes results to an underlying writer.
+type Encoder interface {
+	// Encode writes the given row.
+	Encode(result *pb.Result) error
+	// Flush writes any buffered data to the underlying writer.
+	Flush() error
+}
+
+// A Cell is how a cell is represented in JSON Lines.  Byte slices are
+// encoded in base64, as done by encoding/json.
+type Cell struct {
+	Family    []byte `json:"family"`
+	Qualifier []byte `json:"qualifier"`
+	Timestamp uint64 `json:"timestamp"`
+	Value     []byte `json:"value"`
+}
+
+// A Row is how a row is represented in JSON Lines, one per line.
+type Row struct {
+	Key   []byte  `json:"key"`
+	Cells []*Cell `json:"cells"`
+}
+
+type jsonLinesEncoder struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewJSONLinesEncoder returns an Encoder writing each row as a JSON object
+// (see Row) on its own line.
+func NewJSONLinesEncoder(w io.Writer) Encoder {
+	bw := bufio.NewWriter(w)
+	return &jsonLinesEncoder{w: bw, enc: json.NewEncoder(bw)}
+}
+
+func (e *jsonLinesEncoder) Encode(result *pb.Result) error {
+	if len(result.Cell) == 0 {
+		return nil
+	}
+	row := &Row{
+		Key:   result.Cell[0].Row,
+		Cells: make([]*Cell, len(result.Cell)),
+	}
+	for i, cell := range result.Cell {
+		row.Cells[i] = &Cell{
+			Family:    cell.Family,
+			Qualifier: cell.Qualifier,
+			Timestamp: cell.GetTimestamp(),
+			Value:     cell.Value,
+		}
+	}
+	// The encoder terminates each value with a newline.
+	return e.enc.Encode(row)
+}
+
+func (e *jsonLinesEncoder) Flush() error {
+	return e.w.Flush()
+}
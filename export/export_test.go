@@ -0,0 +1,127 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/pb"
+)
+
+func result(key string, values ...string) *pb.Result {
+	r := &pb.Result{}
+	for i, value := range values {
+		r.Cell = append(r.Cell, &pb.Cell{
+			Row:       []byte(key),
+			Family:    []byte("cf"),
+			Qualifier: []byte(fmt.Sprint("q", i)),
+			Timestamp: proto.Uint64(uint64(i + 1)),
+			Value:     []byte(value),
+		})
+	}
+	return r
+}
+
+func TestJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewJSONLinesEncoder(&buf)
+	for _, r := range []*pb.Result{result("a", "x", "y"), {}, result("b", "z")} {
+		if err := enc.Encode(r); err != nil {
+			t.Fatalf("Encode failed: %s", err)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Error("Expected nothing written before Flush")
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatalf("Flush failed: %s", err)
+	}
+	expected := `{"key":"YQ==","cells":[` +
+		`{"family":"Y2Y=","qualifier":"cTA=","timestamp":1,"value":"eA=="},` +
+		`{"family":"Y2Y=","qualifier":"cTE=","timestamp":2,"value":"eQ=="}]}` + "\n" +
+		`{"key":"Yg==","cells":[` +
+		`{"family":"Y2Y=","qualifier":"cTA=","timestamp":1,"value":"eg=="}]}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, buf.String())
+	}
+}
+
+// Reads a SequenceFile written by a sequenceFileEncoder.
+func readSequenceFile(t *testing.T, buf []byte) []*pb.Result {
+	header := "SEQ\x06" +
+		"\x31" + keyClass + "\x25" + valueClass + "\x00\x00\x00\x00\x00\x00"
+	if !bytes.HasPrefix(buf, []byte(header)) {
+		t.Fatalf("Unexpected header %q", buf[:len(header)])
+	}
+	buf = buf[len(header):]
+	sync := buf[:syncSize]
+	buf = buf[syncSize:]
+	var results []*pb.Result
+	for len(buf) > 0 {
+		length := int32(binary.BigEndian.Uint32(buf))
+		buf = buf[4:]
+		if length == syncEscape {
+			if !bytes.Equal(buf[:syncSize], sync) {
+				t.Fatalf("Invalid sync marker %q", buf[:syncSize])
+			}
+			buf = buf[syncSize:]
+			continue
+		}
+		keyLen := int(binary.BigEndian.Uint32(buf))
+		record := buf[4 : 4+length]
+		buf = buf[4+length:]
+		key := record[4:keyLen]
+		value, n := proto.DecodeVarint(record[keyLen:])
+		r := &pb.Result{}
+		if err := proto.Unmarshal(record[keyLen+n:keyLen+n+int(value)], r); err != nil {
+			t.Fatalf("Failed to decode a result: %s", err)
+		}
+		if !bytes.Equal(key, r.Cell[0].Row) {
+			t.Errorf("Key %q of a record doesn't match its row %q", key, r.Cell[0].Row)
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+func TestSequenceFile(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewSequenceFileEncoder(&buf)
+	if err != nil {
+		t.Fatalf("NewSequenceFileEncoder failed: %s", err)
+	}
+	var expected []*pb.Result
+	for i := 0; i < 200; i++ {
+		r := result(fmt.Sprintf("row%03d", i), "value", "other value")
+		if err = enc.Encode(r); err != nil {
+			t.Fatalf("Encode failed: %s", err)
+		}
+		expected = append(expected, r)
+	}
+	if err = enc.Encode(&pb.Result{}); err != nil {
+		t.Fatalf("Encode failed: %s", err)
+	}
+	if err = enc.Flush(); err != nil {
+		t.Fatalf("Flush failed: %s", err)
+	}
+	if syncs := bytes.Count(buf.Bytes(), enc.(*sequenceFileEncoder).sync[:]); syncs < 5 {
+		t.Errorf("Expected sync markers every %d bytes, got %d in %d bytes",
+			syncInterval, syncs, buf.Len())
+	}
+	results := readSequenceFile(t, buf.Bytes())
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d", len(expected), len(results))
+	}
+	for i, r := range results {
+		if !proto.Equal(r, expected[i]) {
+			t.Errorf("Expected %v, got %v", expected[i], r)
+		}
+	}
+}
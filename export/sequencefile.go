@@ -0,0 +1,114 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package export
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/pb"
+)
+
+const (
+	// Version 6 of the format, which has metadata in its header.
+	sequenceFileVersion = 6
+
+	// Classes of the keys and values written by HBase's Export tool.
+	keyClass   = "org.apache.hadoop.hbase.io.ImmutableBytesWritable"
+	valueClass = "org.apache.hadoop.hbase.client.Result"
+
+	syncSize = 16
+	// Written instead of the length of a record before a sync marker.
+	syncEscape = -1
+	// Approximate number of bytes between sync markers, as in Hadoop.
+	syncInterval = 100 * (4 + syncSize)
+)
+
+type sequenceFileEncoder struct {
+	w *bufio.Writer
+	// Number of bytes written so far.
+	pos int
+	// Position of the last sync marker.
+	lastSync int
+	sync     [syncSize]byte
+	buf      []byte
+}
+
+// NewSequenceFileEncoder returns an Encoder writing an uncompressed Hadoop
+// SequenceFile of ImmutableBytesWritable row keys to Results, like HBase's
+// Export tool does.  The header of the file is written right away.
+func NewSequenceFileEncoder(w io.Writer) (Encoder, error) {
+	e := &sequenceFileEncoder{w: bufio.NewWriter(w)}
+	if _, err := rand.Read(e.sync[:]); err != nil {
+		return nil, err
+	}
+	header := []byte{'S', 'E', 'Q', sequenceFileVersion}
+	header = appendText(header, keyClass)
+	header = appendText(header, valueClass)
+	// Neither record nor block compression, and no metadata.
+	header = append(header, 0, 0, 0, 0, 0, 0)
+	header = append(header, e.sync[:]...)
+	if err := e.write(header); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Appends a string serialized as a Hadoop Text.  Its length is a vint, which
+// takes a single byte for the short strings written here.
+func appendText(buf []byte, s string) []byte {
+	buf = append(buf, byte(len(s)))
+	return append(buf, s...)
+}
+
+func appendInt32(buf []byte, v int32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (e *sequenceFileEncoder) write(buf []byte) error {
+	n, err := e.w.Write(buf)
+	e.pos += n
+	return err
+}
+
+func (e *sequenceFileEncoder) Encode(result *pb.Result) error {
+	if len(result.Cell) == 0 {
+		return nil
+	}
+	value, err := proto.Marshal(result)
+	if err != nil {
+		return err
+	}
+	key := result.Cell[0].Row
+
+	buf := e.buf[:0]
+	if e.pos >= e.lastSync+syncInterval {
+		buf = appendInt32(buf, syncEscape)
+		buf = append(buf, e.sync[:]...)
+		e.lastSync = e.pos + len(buf)
+	}
+	// The key is an ImmutableBytesWritable, prefixed by its length, and the
+	// value the delimited protobuf of the Result, as written by HBase's
+	// ResultSerialization.
+	var varint [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(varint[:], uint64(len(value)))
+	keyLen := 4 + len(key)
+	buf = appendInt32(buf, int32(keyLen+n+len(value)))
+	buf = appendInt32(buf, int32(keyLen))
+	buf = appendInt32(buf, int32(len(key)))
+	buf = append(buf, key...)
+	buf = append(buf, varint[:n]...)
+	buf = append(buf, value...)
+	e.buf = buf
+	return e.write(buf)
+}
+
+func (e *sequenceFileEncoder) Flush() error {
+	return e.w.Flush()
+}
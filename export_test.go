@@ -0,0 +1,81 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/tsuna/gohbase/export"
+	"github.com/tsuna/gohbase/hrpc"
+)
+
+func TestExport(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	s.CreateTable("test", []string{"cf", "other"})
+	c := newFakeClient(t, s)
+	defer c.Close()
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	for i := 0; i < 30; i++ {
+		put, _ := hrpc.NewPutStr(ctx, "test", fmt.Sprintf("row%02d", i),
+			map[string]map[string][]byte{
+				"cf":    {"a": []byte(fmt.Sprint(i)), "b": []byte("b")},
+				"other": {"c": []byte("c")},
+			})
+		if _, err := c.Put(put); err != nil {
+			t.Fatalf("Put failed: %s", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	rows, err := Export(ctx, c, "test", map[string][]string{"cf": {"a"}},
+		export.NewJSONLinesEncoder(&buf))
+	if err != nil {
+		t.Fatalf("Export failed: %s", err)
+	}
+	if rows != 30 {
+		t.Errorf("Expected 30 rows exported, got %d", rows)
+	}
+	scanner := bufio.NewScanner(&buf)
+	var i int
+	for ; scanner.Scan(); i++ {
+		var row export.Row
+		if err = json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatalf("Invalid line %q: %s", scanner.Text(), err)
+		}
+		if key := fmt.Sprintf("row%02d", i); string(row.Key) != key {
+			t.Errorf("Expected row %s, got %s", key, row.Key)
+		}
+		if len(row.Cells) != 1 || string(row.Cells[0].Family) != "cf" ||
+			string(row.Cells[0].Qualifier) != "a" ||
+			string(row.Cells[0].Value) != fmt.Sprint(i) {
+			t.Errorf("Unexpected cells in row %s: %v", row.Key, row.Cells)
+		}
+	}
+	if i != 30 {
+		t.Errorf("Expected 30 lines, got %d", i)
+	}
+
+	buf.Reset()
+	enc, err := export.NewSequenceFileEncoder(&buf)
+	if err != nil {
+		t.Fatalf("NewSequenceFileEncoder failed: %s", err)
+	}
+	if rows, err = Export(ctx, c, "test", nil, enc); err != nil {
+		t.Fatalf("Export failed: %s", err)
+	} else if rows != 30 {
+		t.Errorf("Expected 30 rows exported, got %d", rows)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("SEQ\x06")) {
+		t.Errorf("Expected a SequenceFile, got %q", buf.Bytes())
+	}
+}
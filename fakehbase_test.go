@@ -0,0 +1,201 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/filter"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/region"
+	"github.com/tsuna/gohbase/test/fakehbase"
+	"golang.org/x/net/context"
+)
+
+// Starts a fake server, which the caller closes.
+func newFakeServer(t *testing.T) *fakehbase.Server {
+	s, err := fakehbase.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start the fake server: %s", err)
+	}
+	return s
+}
+
+// Returns a client talking to the given fake server instead of locating meta
+// through ZooKeeper.
+func newFakeClient(t *testing.T, s *fakehbase.Server, options ...Option) *client {
+	c := newClient("~invalid.quorum~", options...)
+	metaClient, err := region.NewClient(s.Host(), s.Port(), c.rpcQueueSize, c.flushInterval)
+	if err != nil {
+		t.Fatalf("Failed to connect to the fake server: %s", err)
+	}
+	c.metaClient = metaClient
+	return c
+}
+
+// Returns a context for the RPCs of a test.
+func newTestContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), 5*time.Second)
+}
+
+// Starts a fake server serving the given tables, each with the family "cf",
+// and returns it along with a client talking to it, a context for the RPCs of
+// the test, and a function to defer to release them.
+func newFakeEnv(t *testing.T, tables ...string) (*fakehbase.Server, *client,
+	context.Context, func()) {
+	s := newFakeServer(t)
+	for _, table := range tables {
+		s.CreateTable(table, []string{"cf"})
+	}
+	c := newFakeClient(t, s)
+	ctx, cancel := newTestContext()
+	return s, c, ctx, func() {
+		cancel()
+		c.Close()
+		s.Close()
+	}
+}
+
+func TestFakeServer(t *testing.T) {
+	_, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+
+	for _, key := range []string{"a", "b", "c"} {
+		put, _ := hrpc.NewPutStr(ctx, "test", key,
+			map[string]map[string][]byte{"cf": {"q": []byte(key)}})
+		if _, err := c.Put(put); err != nil {
+			t.Fatalf("Put of %q failed: %s", key, err)
+		}
+	}
+
+	get, _ := hrpc.NewGetStr(ctx, "test", "b")
+	res, err := c.Get(get)
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	if len(res.Result.Cell) != 1 || string(res.Result.Cell[0].Value) != "b" {
+		t.Errorf("Unexpected result %v", res.Result)
+	}
+
+	scan, _ := hrpc.NewScanRangeStr(ctx, "test", "b", "")
+	results, err := c.Scan(scan)
+	if err != nil {
+		t.Fatalf("Scan failed: %s", err)
+	}
+	if len(results) != 2 || string(results[0].Cell[0].Row) != "b" ||
+		string(results[1].Cell[0].Row) != "c" {
+		t.Errorf("Unexpected scan results %v", results)
+	}
+
+	get, _ = hrpc.NewGetStr(ctx, "nonexistent", "a")
+	if _, err = c.Get(get); err != ErrTableNotFound {
+		t.Errorf("Expected ErrTableNotFound, got %v", err)
+	}
+}
+
+func TestScanHeartbeats(t *testing.T) {
+	s, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "xa", "xb"} {
+		put, _ := hrpc.NewPutStr(ctx, "test", key,
+			map[string]map[string][]byte{"cf": {"q": []byte(key)}})
+		if _, err := c.Put(put); err != nil {
+			t.Fatalf("Put of %q failed: %s", key, err)
+		}
+	}
+	// The first responses are heartbeats without results, which mustn't be
+	// mistaken for the end of the region.
+	s.SetHeartbeatRows(2)
+
+	scan, _ := hrpc.NewScanStr(ctx, "test",
+		hrpc.Filters(filter.NewPrefixFilter([]byte("x"))), hrpc.NeedCursorResult())
+	sc := c.Scanner(scan, 1)
+	var rows []string
+	for result := range sc.Rows() {
+		rows = append(rows, string(result.Cell[0].Row))
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatalf("Scan failed: %s", err)
+	}
+	if len(rows) != 2 || rows[0] != "xa" || rows[1] != "xb" {
+		t.Errorf("Unexpected scan results %q", rows)
+	}
+	if cursor := string(scan.Cursor()); cursor != "xb" {
+		t.Errorf("Expected the cursor at %q, got %q", "xb", cursor)
+	}
+	if md := scan.Metadata(); md.Attempts < 4 {
+		t.Errorf("Expected the heartbeats to take several RPCs, got %d", md.Attempts)
+	}
+}
+
+func TestAdvanceCursor(t *testing.T) {
+	scan, _ := hrpc.NewScanStr(context.Background(), "test")
+	advanceCursor(scan, &pb.ScanResponse{HeartbeatMessage: proto.Bool(true)})
+	if cursor := scan.Cursor(); cursor != nil {
+		t.Errorf("Expected no cursor, got %q", cursor)
+	}
+	advanceCursor(scan, &pb.ScanResponse{HeartbeatMessage: proto.Bool(true),
+		Cursor: &pb.Cursor{Row: []byte("b")}})
+	if cursor := string(scan.Cursor()); cursor != "b" {
+		t.Errorf("Expected the cursor at %q, got %q", "b", cursor)
+	}
+	advanceCursor(scan, &pb.ScanResponse{Results: []*pb.Result{
+		{Cell: []*pb.Cell{{Row: []byte("c")}}},
+		{Cell: []*pb.Cell{{Row: []byte("d")}}},
+	}})
+	if cursor := string(scan.Cursor()); cursor != "d" {
+		t.Errorf("Expected the cursor at %q, got %q", "d", cursor)
+	}
+}
+
+func TestScanEndOfRegion(t *testing.T) {
+	_, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+
+	for _, key := range []string{"a", "b", "c"} {
+		put, _ := hrpc.NewPutStr(ctx, "test", key,
+			map[string]map[string][]byte{"cf": {"q": []byte(key)}})
+		if _, err := c.Put(put); err != nil {
+			t.Fatalf("Put of %q failed: %s", key, err)
+		}
+	}
+	scan, _ := hrpc.NewScanStr(ctx, "test")
+	results, err := c.Scan(scan)
+	if err != nil {
+		t.Fatalf("Scan failed: %s", err)
+	}
+	if len(results) != 3 {
+		t.Errorf("Expected 3 results, got %d", len(results))
+	}
+	// The RegionServer said the region was exhausted along with the
+	// results, no extra request was needed to find out.
+	if md := scan.Metadata(); md.Attempts != 1 {
+		t.Errorf("Expected a single Scan RPC, got %d attempts", md.Attempts)
+	}
+}
+
+func TestRegionExhausted(t *testing.T) {
+	for i, tc := range []struct {
+		res       *pb.ScanResponse
+		exhausted bool
+	}{
+		{&pb.ScanResponse{}, false},
+		{&pb.ScanResponse{MoreResults: proto.Bool(true)}, false},
+		{&pb.ScanResponse{MoreResults: proto.Bool(false)}, true},
+		{&pb.ScanResponse{MoreResults: proto.Bool(true),
+			MoreResultsInRegion: proto.Bool(false)}, true},
+		{&pb.ScanResponse{MoreResults: proto.Bool(true),
+			MoreResultsInRegion: proto.Bool(true)}, false},
+	} {
+		if exhausted := regionExhausted(tc.res); exhausted != tc.exhausted {
+			t.Errorf("#%d: expected %v, got %v", i, tc.exhausted, exhausted)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package filter
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/tsuna/gohbase/pb"
+)
+
+/*
+    The functions below are shorthands to compose filters without dealing with
+    comparators and compare operations directly, e.g.
+
+	filter.And(
+		filter.Prefix("abc"),
+		filter.ColumnValue("cf", "q", filter.Gt(10)),
+		filter.Or(filter.Value(filter.Contains("foo")), filter.KeysOnly()))
+
+    They build the same filters as the constructors above, and can be mixed
+    with them.  Conditions on values of unsupported types make the filters
+    using them fail to construct, and so the RPCs using those fail to be
+    sent.
+*/
+
+// Condition is a comparison applied by a filter to a row key, family,
+// qualifier or value.  See Eq, Ne, Lt, Le, Gt, Ge, HasPrefix, Contains and
+// Matches.
+type Condition struct {
+	op         CompareType
+	comparator Comparator
+
+	// Why the condition can't be used, if it can't.
+	err error
+}
+
+// Returns the condition comparing with the given value.  Integers are compared
+// as Java longs, as written by Bytes.toBytes(long) on the Java side.  Strings
+// and byte slices are compared lexicographically.  Values of other types make
+// an invalid condition.
+func compare(op CompareType, value interface{}) Condition {
+	var long int64
+	switch v := value.(type) {
+	case []byte:
+		return Condition{op: op,
+			comparator: NewBinaryComparator(NewByteArrayComparable(v))}
+	case string:
+		return Condition{op: op,
+			comparator: NewBinaryComparator(NewByteArrayComparable([]byte(v)))}
+	case int:
+		long = int64(v)
+	case int32:
+		long = int64(v)
+	case int64:
+		long = v
+	case uint32:
+		long = int64(v)
+	default:
+		return Condition{err: fmt.Errorf("can't compare values of type %T", value)}
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(long))
+	return Condition{op: op, comparator: NewLongComparator(NewByteArrayComparable(buf))}
+}
+
+// Eq matches what is equal to the given value.
+func Eq(value interface{}) Condition {
+	return compare(Equal, value)
+}
+
+// Ne matches what isn't equal to the given value.
+func Ne(value interface{}) Condition {
+	return compare(NotEqual, value)
+}
+
+// Lt matches what is less than the given value.
+func Lt(value interface{}) Condition {
+	return compare(Less, value)
+}
+
+// Le matches what is less than or equal to the given value.
+func Le(value interface{}) Condition {
+	return compare(LessOrEqual, value)
+}
+
+// Gt matches what is greater than the given value.
+func Gt(value interface{}) Condition {
+	return compare(Greater, value)
+}
+
+// Ge matches what is greater than or equal to the given value.
+func Ge(value interface{}) Condition {
+	return compare(GreaterOrEqual, value)
+}
+
+// HasPrefix matches what starts with the given prefix.
+func HasPrefix(prefix string) Condition {
+	return Condition{op: Equal,
+		comparator: NewBinaryPrefixComparator(NewByteArrayComparable([]byte(prefix)))}
+}
+
+// Contains matches what contains the given substring, case-insensitively.
+func Contains(substr string) Condition {
+	return Condition{op: Equal, comparator: NewSubstringComparator(substr)}
+}
+
+// Matches matches what matches the given Java regular expression.
+func Matches(pattern string) Condition {
+	return Condition{op: Equal,
+		comparator: NewRegexStringComparator(pattern, 0, "UTF-8", "JAVA")}
+}
+
+func (c Condition) compareFilter() *CompareFilter {
+	return NewCompareFilter(c.op, c.comparator)
+}
+
+// invalidFilter is built from an invalid condition, and fails to construct.
+type invalidFilter struct {
+	err error
+}
+
+func (f invalidFilter) ConstructPBFilter() (*pb.Filter, error) {
+	return nil, f.err
+}
+
+// Returns the first of the given filters that is invalid, if any.
+func firstInvalid(filters []Filter) (Filter, bool) {
+	for _, f := range filters {
+		if f, ok := f.(invalidFilter); ok {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// And returns a filter letting through only what all the given filters let
+// through.
+func And(filters ...Filter) Filter {
+	if f, ok := firstInvalid(filters); ok {
+		return f
+	}
+	return NewList(MustPassAll, filters...)
+}
+
+// Or returns a filter letting through what any of the given filters lets
+// through.
+func Or(filters ...Filter) Filter {
+	if f, ok := firstInvalid(filters); ok {
+		return f
+	}
+	return NewList(MustPassOne, filters...)
+}
+
+// Prefix returns a filter letting through the rows whose key starts with the
+// given prefix.
+func Prefix(prefix string) Filter {
+	return NewPrefixFilter([]byte(prefix))
+}
+
+// Row returns a filter letting through the rows whose key matches the given
+// condition.
+func Row(cond Condition) Filter {
+	if cond.err != nil {
+		return invalidFilter{cond.err}
+	}
+	return NewRowFilter(cond.compareFilter())
+}
+
+// Family returns a filter letting through the cells whose family matches the
+// given condition.
+func Family(cond Condition) Filter {
+	if cond.err != nil {
+		return invalidFilter{cond.err}
+	}
+	return NewFamilyFilter(cond.compareFilter())
+}
+
+// Qualifier returns a filter letting through the cells whose qualifier matches
+// the given condition.
+func Qualifier(cond Condition) Filter {
+	if cond.err != nil {
+		return invalidFilter{cond.err}
+	}
+	return NewQualifierFilter(cond.compareFilter())
+}
+
+// Value returns a filter letting through the cells whose value matches the
+// given condition.
+func Value(cond Condition) Filter {
+	if cond.err != nil {
+		return invalidFilter{cond.err}
+	}
+	return NewValueFilter(cond.compareFilter())
+}
+
+// ColumnValue returns a filter letting through the rows in which the latest
+// version of the given column matches the given condition.  Rows without that
+// column are filtered out.
+func ColumnValue(family, qualifier string, cond Condition) Filter {
+	if cond.err != nil {
+		return invalidFilter{cond.err}
+	}
+	return NewSingleColumnValueFilter([]byte(family), []byte(qualifier),
+		cond.op, cond.comparator, true, true)
+}
+
+// ColumnPrefix returns a filter letting through the cells whose qualifier
+// starts with the given prefix.
+func ColumnPrefix(prefix string) Filter {
+	return NewColumnPrefixFilter([]byte(prefix))
+}
+
+// KeysOnly returns a filter stripping the values from the cells.
+func KeysOnly() Filter {
+	return NewKeyOnlyFilter(false)
+}
+
+// FirstKeyOnly returns a filter letting through only the first cell of each
+// row, which is useful to count rows.
+func FirstKeyOnly() Filter {
+	return NewFirstKeyOnlyFilter()
+}
+
+// Limit returns a filter letting through at most the given number of rows per
+// region.
+func Limit(rows int64) Filter {
+	return NewPageFilter(rows)
+}
+
+// While returns a filter stopping the scan as soon as the given filter
+// filters something out.
+func While(f Filter) Filter {
+	if f, ok := f.(invalidFilter); ok {
+		return f
+	}
+	return NewWhileMatchFilter(f)
+}
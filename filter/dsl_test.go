@@ -0,0 +1,78 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package filter
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestDSL(t *testing.T) {
+	binary := func(value string) Comparator {
+		return NewBinaryComparator(NewByteArrayComparable([]byte(value)))
+	}
+	long := func(value string) Comparator {
+		return NewLongComparator(NewByteArrayComparable([]byte(value)))
+	}
+	testcases := []struct {
+		dsl      Filter
+		expected Filter
+	}{
+		{Prefix("abc"), NewPrefixFilter([]byte("abc"))},
+		{ColumnValue("cf", "q", Eq("v")),
+			NewSingleColumnValueFilter([]byte("cf"), []byte("q"), Equal,
+				binary("v"), true, true)},
+		{ColumnValue("cf", "q", Ge([]byte("v"))),
+			NewSingleColumnValueFilter([]byte("cf"), []byte("q"), GreaterOrEqual,
+				binary("v"), true, true)},
+		{ColumnValue("cf", "q", Lt(258)),
+			NewSingleColumnValueFilter([]byte("cf"), []byte("q"), Less,
+				long("\x00\x00\x00\x00\x00\x00\x01\x02"), true, true)},
+		{ColumnValue("cf", "q", Ne(int32(-1))),
+			NewSingleColumnValueFilter([]byte("cf"), []byte("q"), NotEqual,
+				long("\xff\xff\xff\xff\xff\xff\xff\xff"), true, true)},
+		{Row(HasPrefix("a")), NewRowFilter(NewCompareFilter(Equal,
+			NewBinaryPrefixComparator(NewByteArrayComparable([]byte("a")))))},
+		{And(Prefix("abc"), Value(Contains("foo"))),
+			NewList(MustPassAll, NewPrefixFilter([]byte("abc")),
+				NewValueFilter(NewCompareFilter(Equal, NewSubstringComparator("foo"))))},
+		{Or(Qualifier(Le(uint32(7))), And(KeysOnly(), FirstKeyOnly())),
+			NewList(MustPassOne,
+				NewQualifierFilter(NewCompareFilter(LessOrEqual,
+					long("\x00\x00\x00\x00\x00\x00\x00\x07"))),
+				NewList(MustPassAll, NewKeyOnlyFilter(false), NewFirstKeyOnlyFilter()))},
+		{While(Family(Gt(int64(1)))), NewWhileMatchFilter(NewFamilyFilter(
+			NewCompareFilter(Greater, long("\x00\x00\x00\x00\x00\x00\x00\x01"))))},
+	}
+	for i, testcase := range testcases {
+		got, err := testcase.dsl.ConstructPBFilter()
+		if err != nil {
+			t.Errorf("[#%d] Failed to construct the filter: %s", i, err)
+			continue
+		}
+		expected, err := testcase.expected.ConstructPBFilter()
+		if err != nil {
+			t.Fatalf("[#%d] Failed to construct the expected filter: %s", i, err)
+		}
+		if !proto.Equal(got, expected) {
+			t.Errorf("[#%d] Expected %s, got %s", i, expected, got)
+		}
+	}
+
+	// Values of unsupported types fail the filters using them, however
+	// deeply nested, instead of panicking.
+	for i, invalid := range []Filter{
+		ColumnValue("cf", "q", Eq(1.5)),
+		Row(Lt(uint64(1))),
+		And(Prefix("abc"), Or(KeysOnly(), Value(Gt(struct{}{})))),
+		While(Qualifier(Ne(nil))),
+	} {
+		if _, err := invalid.ConstructPBFilter(); err == nil {
+			t.Errorf("[#%d] Expected an error constructing the filter", i)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package filter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+/*
+    Specs describe filters as data, so that they can be read from
+    configuration files or received through REST APIs, e.g.
+
+	{"type": "FilterList", "operator": "MUST_PASS_ALL", "filters": [
+		{"type": "PrefixFilter", "prefix": "abc"},
+		{"type": "SingleColumnValueFilter", "family": "cf", "qualifier": "q",
+		 "op": "GREATER", "comparator": {"type": "LongComparator", "value": 10}},
+		{"type": "KeyOnlyFilter"}]}
+
+    Filters and comparators are named after their Java classes, compare
+    operations and list operators after the Java enums.  Row keys, families,
+    qualifiers and other byte arguments are given as strings.  The fields of
+    Spec and ComparatorSpec also have YAML tags, for use with a YAML decoder.
+*/
+
+// Spec describes a filter, see ParseJSON.  Only the fields used by the type
+// of the filter are set.
+type Spec struct {
+	Type string `json:"type" yaml:"type"`
+
+	// FilterList.
+	Operator string  `json:"operator,omitempty" yaml:"operator,omitempty"`
+	Filters  []*Spec `json:"filters,omitempty" yaml:"filters,omitempty"`
+
+	// SkipFilter and WhileMatchFilter.
+	Filter *Spec `json:"filter,omitempty" yaml:"filter,omitempty"`
+
+	// RowFilter, FamilyFilter, QualifierFilter, ValueFilter,
+	// DependentColumnFilter, SingleColumnValueFilter and
+	// SingleColumnValueExcludeFilter.
+	Op         string          `json:"op,omitempty" yaml:"op,omitempty"`
+	Comparator *ComparatorSpec `json:"comparator,omitempty" yaml:"comparator,omitempty"`
+
+	// DependentColumnFilter, SingleColumnValueFilter and
+	// SingleColumnValueExcludeFilter.
+	Family    string `json:"family,omitempty" yaml:"family,omitempty"`
+	Qualifier string `json:"qualifier,omitempty" yaml:"qualifier,omitempty"`
+	// Default to true.
+	FilterIfMissing   *bool `json:"filterIfMissing,omitempty" yaml:"filterIfMissing,omitempty"`
+	LatestVersionOnly *bool `json:"latestVersionOnly,omitempty" yaml:"latestVersionOnly,omitempty"`
+	// DependentColumnFilter.
+	DropDependentColumn bool `json:"dropDependentColumn,omitempty" yaml:"dropDependentColumn,omitempty"`
+
+	// PrefixFilter and ColumnPrefixFilter.
+	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	// MultipleColumnPrefixFilter, sorted.
+	Prefixes []string `json:"prefixes,omitempty" yaml:"prefixes,omitempty"`
+	// FirstKeyValueMatchingQualifiersFilter.
+	Qualifiers []string `json:"qualifiers,omitempty" yaml:"qualifiers,omitempty"`
+
+	// ColumnRangeFilter.
+	MinColumn          string `json:"minColumn,omitempty" yaml:"minColumn,omitempty"`
+	MinColumnInclusive bool   `json:"minColumnInclusive,omitempty" yaml:"minColumnInclusive,omitempty"`
+	MaxColumn          string `json:"maxColumn,omitempty" yaml:"maxColumn,omitempty"`
+	MaxColumnInclusive bool   `json:"maxColumnInclusive,omitempty" yaml:"maxColumnInclusive,omitempty"`
+
+	// ColumnCountGetFilter and ColumnPaginationFilter.
+	Limit int32 `json:"limit,omitempty" yaml:"limit,omitempty"`
+	// ColumnPaginationFilter, either an offset or a column to start from.
+	Offset       int32  `json:"offset,omitempty" yaml:"offset,omitempty"`
+	ColumnOffset string `json:"columnOffset,omitempty" yaml:"columnOffset,omitempty"`
+
+	// PageFilter.
+	PageSize int64 `json:"pageSize,omitempty" yaml:"pageSize,omitempty"`
+	// InclusiveStopFilter.
+	StopRow string `json:"stopRow,omitempty" yaml:"stopRow,omitempty"`
+	// KeyOnlyFilter.
+	LenAsValue bool `json:"lenAsValue,omitempty" yaml:"lenAsValue,omitempty"`
+	// RandomRowFilter.
+	Chance float32 `json:"chance,omitempty" yaml:"chance,omitempty"`
+	// TimestampsFilter.
+	Timestamps []int64 `json:"timestamps,omitempty" yaml:"timestamps,omitempty"`
+}
+
+// ComparatorSpec describes a comparator, see Spec.
+type ComparatorSpec struct {
+	Type string `json:"type" yaml:"type"`
+
+	// Value compared by BinaryComparator, BinaryPrefixComparator,
+	// BitComparator and LongComparator.  A string, except for
+	// LongComparator which also takes a number, compared as a Java long.
+	Value interface{} `json:"value,omitempty" yaml:"value,omitempty"`
+
+	// SubstringComparator and RegexStringComparator.
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	// RegexStringComparator, 0 by default.
+	Flags int32 `json:"flags,omitempty" yaml:"flags,omitempty"`
+
+	// BitComparator: AND, OR or XOR.
+	BitwiseOp string `json:"bitwiseOp,omitempty" yaml:"bitwiseOp,omitempty"`
+}
+
+var compareTypes = map[string]CompareType{
+	"LESS":             Less,
+	"LESS_OR_EQUAL":    LessOrEqual,
+	"EQUAL":            Equal,
+	"NOT_EQUAL":        NotEqual,
+	"GREATER_OR_EQUAL": GreaterOrEqual,
+	"GREATER":          Greater,
+	"NO_OP":            NoOp,
+}
+
+var listOperators = map[string]ListOperator{
+	"MUST_PASS_ALL": MustPassAll,
+	"MUST_PASS_ONE": MustPassOne,
+}
+
+var bitwiseOps = map[string]BitComparatorBitwiseOp{
+	"AND": BitComparatorAND,
+	"OR":  BitComparatorOR,
+	"XOR": BitComparatorXOR,
+}
+
+// ParseJSON builds the filter described by the given JSON, see Spec.
+func ParseJSON(data []byte) (Filter, error) {
+	var spec Spec
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// Keeps the precision of the values of LongComparators.
+	dec.UseNumber()
+	if err := dec.Decode(&spec); err != nil {
+		return nil, err
+	}
+	return FromSpec(&spec)
+}
+
+// FromSpec builds the filter described by the given spec.
+func FromSpec(spec *Spec) (Filter, error) {
+	if spec == nil {
+		return nil, errors.New("missing filter")
+	}
+	switch spec.Type {
+	case "FilterList":
+		op, ok := listOperators[spec.Operator]
+		if spec.Operator == "" {
+			op, ok = MustPassAll, true
+		}
+		if !ok {
+			return nil, fmt.Errorf("invalid operator %q for a FilterList", spec.Operator)
+		}
+		filters := make([]Filter, len(spec.Filters))
+		for i, s := range spec.Filters {
+			var err error
+			if filters[i], err = FromSpec(s); err != nil {
+				return nil, err
+			}
+		}
+		return NewList(op, filters...), nil
+	case "SkipFilter", "WhileMatchFilter":
+		f, err := FromSpec(spec.Filter)
+		if err != nil {
+			return nil, err
+		}
+		if spec.Type == "SkipFilter" {
+			return NewSkipFilter(f), nil
+		}
+		return NewWhileMatchFilter(f), nil
+	case "RowFilter", "FamilyFilter", "QualifierFilter", "ValueFilter",
+		"DependentColumnFilter":
+		cond, err := conditionFromSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		compareFilter := cond.compareFilter()
+		switch spec.Type {
+		case "RowFilter":
+			return NewRowFilter(compareFilter), nil
+		case "FamilyFilter":
+			return NewFamilyFilter(compareFilter), nil
+		case "QualifierFilter":
+			return NewQualifierFilter(compareFilter), nil
+		case "ValueFilter":
+			return NewValueFilter(compareFilter), nil
+		}
+		return NewDependentColumnFilter(compareFilter, []byte(spec.Family),
+			[]byte(spec.Qualifier), spec.DropDependentColumn), nil
+	case "SingleColumnValueFilter", "SingleColumnValueExcludeFilter":
+		cond, err := conditionFromSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		f := NewSingleColumnValueFilter([]byte(spec.Family), []byte(spec.Qualifier),
+			cond.op, cond.comparator,
+			spec.FilterIfMissing == nil || *spec.FilterIfMissing,
+			spec.LatestVersionOnly == nil || *spec.LatestVersionOnly)
+		if spec.Type == "SingleColumnValueExcludeFilter" {
+			return NewSingleColumnValueExcludeFilter(f), nil
+		}
+		return f, nil
+	case "PrefixFilter":
+		return NewPrefixFilter([]byte(spec.Prefix)), nil
+	case "ColumnPrefixFilter":
+		return NewColumnPrefixFilter([]byte(spec.Prefix)), nil
+	case "MultipleColumnPrefixFilter":
+		return NewMultipleColumnPrefixFilter(toBytes(spec.Prefixes)), nil
+	case "FirstKeyValueMatchingQualifiersFilter":
+		return NewFirstKeyValueMatchingQualifiersFilter(toBytes(spec.Qualifiers)), nil
+	case "ColumnRangeFilter":
+		return NewColumnRangeFilter([]byte(spec.MinColumn), []byte(spec.MaxColumn),
+			spec.MinColumnInclusive, spec.MaxColumnInclusive), nil
+	case "ColumnCountGetFilter":
+		return NewColumnCountGetFilter(spec.Limit), nil
+	case "ColumnPaginationFilter":
+		var columnOffset []byte
+		if spec.ColumnOffset != "" {
+			columnOffset = []byte(spec.ColumnOffset)
+		}
+		return NewColumnPaginationFilter(spec.Limit, spec.Offset, columnOffset), nil
+	case "PageFilter":
+		return NewPageFilter(spec.PageSize), nil
+	case "InclusiveStopFilter":
+		return NewInclusiveStopFilter([]byte(spec.StopRow)), nil
+	case "KeyOnlyFilter":
+		return NewKeyOnlyFilter(spec.LenAsValue), nil
+	case "FirstKeyOnlyFilter":
+		return NewFirstKeyOnlyFilter(), nil
+	case "FilterAllFilter":
+		return &AllFilter{}, nil
+	case "RandomRowFilter":
+		return NewRandomRowFilter(spec.Chance), nil
+	case "TimestampsFilter":
+		return NewTimestampsFilter(spec.Timestamps), nil
+	}
+	return nil, fmt.Errorf("unsupported filter type %q", spec.Type)
+}
+
+// Builds the compare operation and comparator of the given spec.
+func conditionFromSpec(spec *Spec) (Condition, error) {
+	op, ok := compareTypes[spec.Op]
+	if !ok {
+		return Condition{}, fmt.Errorf("invalid compare operation %q for a %s",
+			spec.Op, spec.Type)
+	}
+	comparator, err := comparatorFromSpec(spec.Comparator)
+	if err != nil {
+		return Condition{}, err
+	}
+	return Condition{op: op, comparator: comparator}, nil
+}
+
+// Builds the comparator described by the given spec.
+func comparatorFromSpec(spec *ComparatorSpec) (Comparator, error) {
+	if spec == nil {
+		return nil, errors.New("missing comparator")
+	}
+	switch spec.Type {
+	case "LongComparator":
+		long, err := longValue(spec.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 8)
+		binary.BigEndian.PutUint64(buf, uint64(long))
+		return NewLongComparator(NewByteArrayComparable(buf)), nil
+	case "BinaryComparator", "BinaryPrefixComparator", "BitComparator":
+		value, ok := spec.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("the value of a %s must be a string, got %v",
+				spec.Type, spec.Value)
+		}
+		comparable := NewByteArrayComparable([]byte(value))
+		switch spec.Type {
+		case "BinaryComparator":
+			return NewBinaryComparator(comparable), nil
+		case "BinaryPrefixComparator":
+			return NewBinaryPrefixComparator(comparable), nil
+		}
+		op, ok := bitwiseOps[spec.BitwiseOp]
+		if !ok {
+			return nil, fmt.Errorf("invalid bitwise operation %q", spec.BitwiseOp)
+		}
+		return NewBitComparator(op, comparable), nil
+	case "NullComparator":
+		return NewNullComparator(), nil
+	case "SubstringComparator":
+		return NewSubstringComparator(spec.Pattern), nil
+	case "RegexStringComparator":
+		return NewRegexStringComparator(spec.Pattern, spec.Flags, "UTF-8", "JAVA"), nil
+	}
+	return nil, fmt.Errorf("unsupported comparator type %q", spec.Type)
+}
+
+// Returns the long given as a number or a string.
+func longValue(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case json.Number:
+		return v.Int64()
+	case float64:
+		if v != float64(int64(v)) {
+			return 0, fmt.Errorf("the value of a LongComparator must be an integer, got %v", v)
+		}
+		return int64(v), nil
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	}
+	return 0, fmt.Errorf("the value of a LongComparator must be an integer, got %v", value)
+}
+
+func toBytes(strs []string) [][]byte {
+	bufs := make([][]byte, len(strs))
+	for i, s := range strs {
+		bufs[i] = []byte(s)
+	}
+	return bufs
+}
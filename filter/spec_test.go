@@ -0,0 +1,73 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package filter
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+func TestParseJSON(t *testing.T) {
+	testcases := []struct {
+		json     string
+		expected Filter
+	}{
+		{`{"type": "PrefixFilter", "prefix": "abc"}`, Prefix("abc")},
+		{`{"type": "FilterList", "operator": "MUST_PASS_ONE", "filters": [
+			{"type": "RowFilter", "op": "EQUAL",
+			 "comparator": {"type": "SubstringComparator", "pattern": "foo"}},
+			{"type": "FilterList", "filters": [
+				{"type": "KeyOnlyFilter"},
+				{"type": "FirstKeyOnlyFilter"}]}]}`,
+			Or(Row(Contains("foo")), And(KeysOnly(), FirstKeyOnly()))},
+		{`{"type": "SingleColumnValueFilter", "family": "cf", "qualifier": "q",
+			"op": "GREATER", "comparator": {"type": "LongComparator", "value": 9007199254740993}}`,
+			ColumnValue("cf", "q", Gt(int64(9007199254740993)))},
+		{`{"type": "SingleColumnValueFilter", "family": "cf", "qualifier": "q",
+			"op": "LESS", "comparator": {"type": "BinaryComparator", "value": "m"},
+			"filterIfMissing": false}`,
+			NewSingleColumnValueFilter([]byte("cf"), []byte("q"), Less,
+				NewBinaryComparator(NewByteArrayComparable([]byte("m"))), false, true)},
+		{`{"type": "WhileMatchFilter", "filter": {"type": "ValueFilter", "op": "EQUAL",
+			"comparator": {"type": "RegexStringComparator", "pattern": "^a.*"}}}`,
+			While(Value(Matches("^a.*")))},
+		{`{"type": "ColumnPaginationFilter", "limit": 10, "columnOffset": "q5"}`,
+			NewColumnPaginationFilter(10, 0, []byte("q5"))},
+		{`{"type": "TimestampsFilter", "timestamps": [1, 2]}`,
+			NewTimestampsFilter([]int64{1, 2})},
+	}
+	for i, testcase := range testcases {
+		f, err := ParseJSON([]byte(testcase.json))
+		if err != nil {
+			t.Errorf("[#%d] Failed to parse: %s", i, err)
+			continue
+		}
+		got, err := f.ConstructPBFilter()
+		if err != nil {
+			t.Fatalf("[#%d] Failed to construct the filter: %s", i, err)
+		}
+		expected, _ := testcase.expected.ConstructPBFilter()
+		if !proto.Equal(got, expected) {
+			t.Errorf("[#%d] Expected %s, got %s", i, expected, got)
+		}
+	}
+
+	for _, invalid := range []string{
+		`{"type": "NoSuchFilter"}`,
+		`{"type": "FilterList", "operator": "MUST_PASS_SOME"}`,
+		`{"type": "RowFilter", "op": "ABOUT", "comparator": {"type": "NullComparator"}}`,
+		`{"type": "RowFilter", "op": "EQUAL"}`,
+		`{"type": "ValueFilter", "op": "EQUAL", "comparator": {"type": "LongComparator", "value": 1.5}}`,
+		`{"type": "ValueFilter", "op": "EQUAL", "comparator": {"type": "BinaryComparator", "value": 1}}`,
+		`{"type": "SkipFilter"}`,
+		`{"type": "PrefixFilter"`,
+	} {
+		if _, err := ParseJSON([]byte(invalid)); err == nil {
+			t.Errorf("Expected an error parsing %s", invalid)
+		}
+	}
+}
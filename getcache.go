@@ -0,0 +1,174 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"container/list"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+)
+
+// GetCache will return an option that will make the client cache the
+// responses of Gets to the given tables, each for its TTL.  At most maxEntries
+// responses are cached, the least recently used ones being evicted first.
+// Writes made through the client invalidate the rows they touch, but writes
+// made by others are only seen once the cached responses expire, so this is
+// meant for read-mostly data where that staleness is acceptable.  Only plain
+// Gets are cached: not those with a filter, for more than one version, for
+// the row before a key, only checking existence, or made on behalf of another
+// user.
+func GetCache(maxEntries int, ttls map[string]time.Duration) Option {
+	return func(c *client) {
+		c.getCache = newGetCache(maxEntries, ttls)
+	}
+}
+
+// getCache is an LRU cache of the responses of Gets.
+type getCache struct {
+	m sync.Mutex
+
+	maxEntries int
+	ttls       map[string]time.Duration
+
+	// Most recently used entries first.
+	lru *list.List
+	// "table\x00row" -> families key -> element of lru.
+	rows map[string]map[string]*list.Element
+
+	// Incremented on every invalidation, so that the responses of Gets
+	// that were in flight during a write aren't cached.
+	generation uint64
+}
+
+type getCacheEntry struct {
+	row      string
+	families string
+	resp     *pb.GetResponse
+	expires  time.Time
+}
+
+func newGetCache(maxEntries int, ttls map[string]time.Duration) *getCache {
+	return &getCache{
+		maxEntries: maxEntries,
+		ttls:       ttls,
+		lru:        list.New(),
+		rows:       make(map[string]map[string]*list.Element),
+	}
+}
+
+func rowCacheKey(table, key []byte) string {
+	return string(table) + "\x00" + string(key)
+}
+
+// Returns a canonical representation of the families and qualifiers to get.
+func familiesCacheKey(families map[string][]string) string {
+	columns := make([]string, 0, len(families))
+	for family, qualifiers := range families {
+		qualifiers = append([]string(nil), qualifiers...)
+		sort.Strings(qualifiers)
+		columns = append(columns, family+"\x00"+strings.Join(qualifiers, "\x00"))
+	}
+	sort.Strings(columns)
+	return strings.Join(columns, "\x01")
+}
+
+// Returns the TTL of the responses of the given Get, or 0 if it isn't cached.
+func (gc *getCache) ttl(get *hrpc.Get) time.Duration {
+	if get.GetFilter() != nil || get.GetMaxVersions() > 1 ||
+		get.IsClosestBefore() || get.IsExistsOnly() || get.User() != "" {
+		return 0
+	}
+	return gc.ttls[string(get.Table())]
+}
+
+// Returns a copy of the cached response of the given Get, or nil.
+func (gc *getCache) get(get *hrpc.Get) *pb.GetResponse {
+	if gc.ttl(get) <= 0 {
+		return nil
+	}
+	row := rowCacheKey(get.Table(), get.Key())
+	families := familiesCacheKey(get.GetFamilies())
+	gc.m.Lock()
+	defer gc.m.Unlock()
+	elem, ok := gc.rows[row][families]
+	if !ok {
+		return nil
+	}
+	entry := elem.Value.(*getCacheEntry)
+	if time.Now().After(entry.expires) {
+		gc.remove(elem)
+		return nil
+	}
+	gc.lru.MoveToFront(elem)
+	return proto.Clone(entry.resp).(*pb.GetResponse)
+}
+
+// Returns the current generation, to be given to put.
+func (gc *getCache) currentGeneration() uint64 {
+	gc.m.Lock()
+	defer gc.m.Unlock()
+	return gc.generation
+}
+
+// Caches the response of the given Get, sent at the given generation, unless
+// there was a write since.
+func (gc *getCache) put(get *hrpc.Get, resp *pb.GetResponse, generation uint64) {
+	ttl := gc.ttl(get)
+	if ttl <= 0 {
+		return
+	}
+	entry := &getCacheEntry{
+		row:      rowCacheKey(get.Table(), get.Key()),
+		families: familiesCacheKey(get.GetFamilies()),
+		resp:     proto.Clone(resp).(*pb.GetResponse),
+		expires:  time.Now().Add(ttl),
+	}
+	gc.m.Lock()
+	defer gc.m.Unlock()
+	if gc.generation != generation {
+		return
+	}
+	if elem, ok := gc.rows[entry.row][entry.families]; ok {
+		gc.remove(elem)
+	}
+	families, ok := gc.rows[entry.row]
+	if !ok {
+		families = make(map[string]*list.Element)
+		gc.rows[entry.row] = families
+	}
+	families[entry.families] = gc.lru.PushFront(entry)
+	for gc.lru.Len() > gc.maxEntries {
+		gc.remove(gc.lru.Back())
+	}
+}
+
+// Drops all the cached responses for the given row.
+func (gc *getCache) invalidate(table, key []byte) {
+	row := rowCacheKey(table, key)
+	gc.m.Lock()
+	gc.generation++
+	for _, elem := range gc.rows[row] {
+		gc.lru.Remove(elem)
+	}
+	delete(gc.rows, row)
+	gc.m.Unlock()
+}
+
+// Removes an entry.  Must be called with the lock held.
+func (gc *getCache) remove(elem *list.Element) {
+	entry := gc.lru.Remove(elem).(*getCacheEntry)
+	families := gc.rows[entry.row]
+	delete(families, entry.families)
+	if len(families) == 0 {
+		delete(gc.rows, entry.row)
+	}
+}
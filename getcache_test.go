@@ -0,0 +1,69 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"golang.org/x/net/context"
+)
+
+func TestGetCache(t *testing.T) {
+	gc := newGetCache(2, map[string]time.Duration{"cached": time.Hour, "expired": -time.Second})
+	ctx := context.Background()
+	resp := func(value string) *pb.GetResponse {
+		return &pb.GetResponse{Result: &pb.Result{Cell: []*pb.Cell{{Value: []byte(value)}}}}
+	}
+	value := func(get *hrpc.Get) string {
+		if r := gc.get(get); r != nil {
+			return string(r.Result.Cell[0].Value)
+		}
+		return ""
+	}
+
+	a, _ := hrpc.NewGetStr(ctx, "cached", "a")
+	gc.put(a, resp("a"), gc.currentGeneration())
+	if v := value(a); v != "a" {
+		t.Errorf("Expected the cached value for a, got %q", v)
+	}
+	fam, _ := hrpc.NewGetStr(ctx, "cached", "a",
+		hrpc.Families(map[string][]string{"cf": {"q"}}))
+	if v := value(fam); v != "" {
+		t.Errorf("Got %q for a Get of other families", v)
+	}
+	for _, table := range []string{"expired", "notcached"} {
+		get, _ := hrpc.NewGetStr(ctx, table, "a")
+		gc.put(get, resp("a"), gc.currentGeneration())
+		if v := value(get); v != "" {
+			t.Errorf("Got %q from table %s", v, table)
+		}
+	}
+
+	// Writes invalidate the row, and the Gets in flight during them.
+	generation := gc.currentGeneration()
+	gc.invalidate([]byte("cached"), []byte("a"))
+	if v := value(a); v != "" {
+		t.Errorf("Got %q after invalidation", v)
+	}
+	gc.put(a, resp("stale"), generation)
+	if v := value(a); v != "" {
+		t.Errorf("Got %q from a Get made before the invalidation", v)
+	}
+
+	// The least recently used entries are evicted.
+	gc.put(a, resp("a"), gc.currentGeneration())
+	b, _ := hrpc.NewGetStr(ctx, "cached", "b")
+	gc.put(b, resp("b"), gc.currentGeneration())
+	value(a)
+	c, _ := hrpc.NewGetStr(ctx, "cached", "c")
+	gc.put(c, resp("c"), gc.currentGeneration())
+	if value(a) != "a" || value(b) != "" || value(c) != "c" {
+		t.Error("Expected b to be evicted")
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+)
+
+// CoalesceGets will return an option that will make the client send a single
+// RPC for identical Gets made concurrently: a Get for the same row of the
+// same table, with the same options and on behalf of the same user as one
+// already in flight waits for the response of the latter instead of being
+// sent.  This shields RegionServers from stampedes of requests for a hot row.
+// If the Get in flight times out, those waiting for it are sent in its stead.
+func CoalesceGets() Option {
+	return func(c *client) {
+		c.getCoalescer = &getCoalescer{calls: make(map[string]*coalescedGet)}
+	}
+}
+
+// getCoalescer keeps track of the Gets in flight, by coalesceKey.
+type getCoalescer struct {
+	m sync.Mutex
+
+	calls map[string]*coalescedGet
+}
+
+// A Get in flight, whose response is shared with identical Gets.
+type coalescedGet struct {
+	// Closed once resp and err are set.
+	done chan struct{}
+	resp *pb.GetResponse
+	err  error
+}
+
+// Returns a key identifying the Gets equivalent to the given one.
+func coalesceKey(get *hrpc.Get) (string, error) {
+	var filter []byte
+	if get.GetFilter() != nil {
+		pbFilter, err := get.GetFilter().ConstructPBFilter()
+		if err != nil {
+			return "", err
+		}
+		if filter, err = proto.Marshal(pbFilter); err != nil {
+			return "", err
+		}
+	}
+	var cacheBlocks string
+	if get.GetCacheBlocks() != nil {
+		cacheBlocks = fmt.Sprint(*get.GetCacheBlocks())
+	}
+	var consistency string
+	if get.GetConsistency() != nil {
+		consistency = get.GetConsistency().String()
+	}
+	return fmt.Sprintf("%q %q %q %q %q %q %d %t %t %s %s",
+		get.Table(), get.Key(), get.User(), get.Tenant(),
+		familiesCacheKey(get.GetFamilies()), filter, get.GetMaxVersions(),
+		get.IsClosestBefore(), get.IsExistsOnly(), cacheBlocks, consistency), nil
+}
+
+// Returns the response of the given Get, calling send to get it unless an
+// identical Get is already in flight.
+func (gc *getCoalescer) do(get *hrpc.Get,
+	send func() (*pb.GetResponse, error)) (*pb.GetResponse, error) {
+	key, err := coalesceKey(get)
+	if err != nil {
+		return send()
+	}
+	for {
+		gc.m.Lock()
+		call, ok := gc.calls[key]
+		if !ok {
+			call = &coalescedGet{done: make(chan struct{})}
+			gc.calls[key] = call
+			gc.m.Unlock()
+			call.resp, call.err = send()
+			gc.m.Lock()
+			delete(gc.calls, key)
+			gc.m.Unlock()
+			close(call.done)
+			if call.err != nil {
+				return nil, call.err
+			}
+			// Those waiting for this call get their own copy of the
+			// response, so that it's safe to modify.
+			return proto.Clone(call.resp).(*pb.GetResponse), nil
+		}
+		gc.m.Unlock()
+
+		select {
+		case <-call.done:
+		case <-get.GetContext().Done():
+			return nil, ErrDeadline
+		}
+		if call.err == ErrDeadline {
+			// The context of the Get in flight was done, not ours.
+			continue
+		} else if call.err != nil {
+			return nil, call.err
+		}
+		return proto.Clone(call.resp).(*pb.GetResponse), nil
+	}
+}
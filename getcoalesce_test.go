@@ -0,0 +1,115 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"golang.org/x/net/context"
+)
+
+func TestGetCoalescer(t *testing.T) {
+	gc := &getCoalescer{calls: make(map[string]*coalescedGet)}
+	ctx := context.Background()
+	release := make(chan struct{})
+	var m sync.Mutex
+	var sent int
+	send := func() (*pb.GetResponse, error) {
+		m.Lock()
+		sent++
+		m.Unlock()
+		<-release
+		return &pb.GetResponse{Result: &pb.Result{Cell: []*pb.Cell{{Value: []byte("v")}}}}, nil
+	}
+
+	var wg sync.WaitGroup
+	resps := make([]*pb.GetResponse, 10)
+	for i := range resps {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			get, _ := hrpc.NewGetStr(ctx, "test", "hot")
+			resp, err := gc.do(get, send)
+			if err != nil {
+				t.Errorf("Get failed: %s", err)
+			}
+			resps[i] = resp
+		}(i)
+	}
+	// Gets of other rows or with other options aren't coalesced.
+	other, _ := hrpc.NewGetStr(ctx, "test", "hot", hrpc.MaxVersions(2))
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		gc.do(other, send)
+	}()
+	for {
+		gc.m.Lock()
+		calls := len(gc.calls)
+		gc.m.Unlock()
+		if calls == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Leave the other Gets time to wait for the one in flight.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if sent != 2 {
+		t.Errorf("Expected 2 RPCs to be sent, got %d", sent)
+	}
+	for i, resp := range resps {
+		if resp == nil || string(resp.Result.Cell[0].Value) != "v" {
+			t.Fatalf("Unexpected response #%d: %v", i, resp)
+		}
+		for _, other := range resps[:i] {
+			if resp == other {
+				t.Fatalf("Response #%d is shared", i)
+			}
+		}
+	}
+	if len(gc.calls) != 0 {
+		t.Errorf("Expected no call in flight, got %d", len(gc.calls))
+	}
+
+	// A Get waiting for one that times out is sent in its stead.
+	timedOut := make(chan struct{})
+	go func() {
+		get, _ := hrpc.NewGetStr(ctx, "test", "hot")
+		gc.do(get, func() (*pb.GetResponse, error) {
+			<-timedOut
+			return nil, ErrDeadline
+		})
+	}()
+	for {
+		gc.m.Lock()
+		calls := len(gc.calls)
+		gc.m.Unlock()
+		if calls == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	get, _ := hrpc.NewGetStr(ctx, "test", "hot")
+	done := make(chan error)
+	go func() {
+		_, err := gc.do(get, send)
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(timedOut)
+	if err := <-done; err != nil {
+		t.Errorf("Expected the Get to be sent, got %v", err)
+	}
+	if sent != 3 {
+		t.Errorf("Expected 3 RPCs to be sent, got %d", sent)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+// Package hbytes encodes and decodes values the way HBase's Java class
+// org.apache.hadoop.hbase.util.Bytes does, so that cells written by Java
+// applications can be read from Go, and the other way around.
+//
+// Numbers are big-endian, floating-point numbers being stored as their IEEE
+// 754 bits, booleans are a single byte and strings are in UTF-8.  Unlike
+// Bytes, decoding functions return an error when a value doesn't have the
+// size of its type, instead of reading part of it.
+package hbytes
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// Returns an error if buf doesn't have the given size.
+func checkSize(buf []byte, size int, typ string) error {
+	if len(buf) != size {
+		return fmt.Errorf("%d bytes can't be decoded as a %s, which takes %d",
+			len(buf), typ, size)
+	}
+	return nil
+}
+
+// EncodeInt64 encodes v like Bytes.toBytes(long).
+func EncodeInt64(v int64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(v))
+	return buf
+}
+
+// DecodeInt64 decodes a value encoded like Bytes.toBytes(long).
+func DecodeInt64(buf []byte) (int64, error) {
+	if err := checkSize(buf, 8, "long"); err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(buf)), nil
+}
+
+// EncodeInt32 encodes v like Bytes.toBytes(int).
+func EncodeInt32(v int32) []byte {
+	buf := make([]byte, 4)
+	binary.BigEndian.PutUint32(buf, uint32(v))
+	return buf
+}
+
+// DecodeInt32 decodes a value encoded like Bytes.toBytes(int).
+func DecodeInt32(buf []byte) (int32, error) {
+	if err := checkSize(buf, 4, "int"); err != nil {
+		return 0, err
+	}
+	return int32(binary.BigEndian.Uint32(buf)), nil
+}
+
+// EncodeInt16 encodes v like Bytes.toBytes(short).
+func EncodeInt16(v int16) []byte {
+	buf := make([]byte, 2)
+	binary.BigEndian.PutUint16(buf, uint16(v))
+	return buf
+}
+
+// DecodeInt16 decodes a value encoded like Bytes.toBytes(short).
+func DecodeInt16(buf []byte) (int16, error) {
+	if err := checkSize(buf, 2, "short"); err != nil {
+		return 0, err
+	}
+	return int16(binary.BigEndian.Uint16(buf)), nil
+}
+
+// EncodeFloat64 encodes v like Bytes.toBytes(double).
+func EncodeFloat64(v float64) []byte {
+	return EncodeInt64(int64(math.Float64bits(v)))
+}
+
+// DecodeFloat64 decodes a value encoded like Bytes.toBytes(double).
+func DecodeFloat64(buf []byte) (float64, error) {
+	if err := checkSize(buf, 8, "double"); err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(buf)), nil
+}
+
+// EncodeFloat32 encodes v like Bytes.toBytes(float).
+func EncodeFloat32(v float32) []byte {
+	return EncodeInt32(int32(math.Float32bits(v)))
+}
+
+// DecodeFloat32 decodes a value encoded like Bytes.toBytes(float).
+func DecodeFloat32(buf []byte) (float32, error) {
+	if err := checkSize(buf, 4, "float"); err != nil {
+		return 0, err
+	}
+	return math.Float32frombits(binary.BigEndian.Uint32(buf)), nil
+}
+
+// EncodeBool encodes v like Bytes.toBytes(boolean), true being 0xFF.
+func EncodeBool(v bool) []byte {
+	if v {
+		return []byte{0xFF}
+	}
+	return []byte{0}
+}
+
+// DecodeBool decodes a value encoded like Bytes.toBytes(boolean), any byte
+// other than 0 being true.
+func DecodeBool(buf []byte) (bool, error) {
+	if err := checkSize(buf, 1, "boolean"); err != nil {
+		return false, err
+	}
+	return buf[0] != 0, nil
+}
+
+// EncodeString encodes s like Bytes.toBytes(String), which is in UTF-8 as Go
+// strings usually are.
+func EncodeString(s string) []byte {
+	return []byte(s)
+}
+
+// DecodeString decodes a value encoded like Bytes.toBytes(String).
+func DecodeString(buf []byte) string {
+	return string(buf)
+}
+
+// EncodeBigDecimal encodes the decimal number unscaled × 10^-scale like
+// Bytes.toBytes(BigDecimal): its scale, as an int, followed by its unscaled
+// value in two's complement, as BigInteger.toByteArray returns it.
+func EncodeBigDecimal(unscaled *big.Int, scale int32) []byte {
+	buf := EncodeInt32(scale)
+	switch unscaled.Sign() {
+	case 0:
+		return append(buf, 0)
+	case 1:
+		magnitude := unscaled.Bytes()
+		if magnitude[0]&0x80 != 0 {
+			// The sign bit must be 0.
+			buf = append(buf, 0)
+		}
+		return append(buf, magnitude...)
+	}
+	// The two's complement of -x is the inverse of x - 1.
+	inverse := new(big.Int).Neg(unscaled)
+	inverse.Sub(inverse, big.NewInt(1))
+	magnitude := inverse.Bytes()
+	if len(magnitude) == 0 || magnitude[0]&0x80 != 0 {
+		// The sign bit must be 1.
+		buf = append(buf, 0xFF)
+	}
+	for _, b := range magnitude {
+		buf = append(buf, ^b)
+	}
+	return buf
+}
+
+// DecodeBigDecimal decodes a value encoded like Bytes.toBytes(BigDecimal),
+// and returns its unscaled value and its scale.
+func DecodeBigDecimal(buf []byte) (*big.Int, int32, error) {
+	if len(buf) < 5 {
+		return nil, 0, fmt.Errorf("%d bytes can't be decoded as a BigDecimal, which takes at least 5",
+			len(buf))
+	}
+	scale, _ := DecodeInt32(buf[:4])
+	buf = buf[4:]
+	if buf[0]&0x80 == 0 {
+		return new(big.Int).SetBytes(buf), scale, nil
+	}
+	magnitude := make([]byte, len(buf))
+	for i, b := range buf {
+		magnitude[i] = ^b
+	}
+	unscaled := new(big.Int).SetBytes(magnitude)
+	unscaled.Add(unscaled, big.NewInt(1))
+	return unscaled.Neg(unscaled), scale, nil
+}
@@ -0,0 +1,114 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package hbytes
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestNumbers(t *testing.T) {
+	// Expected encodings, as returned by Bytes.toBytes.
+	if buf := EncodeInt64(-2); !bytes.Equal(buf, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFE}) {
+		t.Errorf("Unexpected encoding of -2L: %x", buf)
+	}
+	if buf := EncodeInt32(258); !bytes.Equal(buf, []byte{0, 0, 1, 2}) {
+		t.Errorf("Unexpected encoding of 258: %x", buf)
+	}
+	if buf := EncodeInt16(-1); !bytes.Equal(buf, []byte{0xFF, 0xFF}) {
+		t.Errorf("Unexpected encoding of (short) -1: %x", buf)
+	}
+	if buf := EncodeFloat64(1.5); !bytes.Equal(buf, []byte{0x3F, 0xF8, 0, 0, 0, 0, 0, 0}) {
+		t.Errorf("Unexpected encoding of 1.5: %x", buf)
+	}
+	if buf := EncodeFloat32(-2); !bytes.Equal(buf, []byte{0xC0, 0, 0, 0}) {
+		t.Errorf("Unexpected encoding of -2f: %x", buf)
+	}
+	if buf := EncodeBool(true); !bytes.Equal(buf, []byte{0xFF}) {
+		t.Errorf("Unexpected encoding of true: %x", buf)
+	}
+
+	for _, v := range []int64{math.MinInt64, -1, 0, 42, math.MaxInt64} {
+		if got, err := DecodeInt64(EncodeInt64(v)); err != nil || got != v {
+			t.Errorf("DecodeInt64 returned %d, %v; expected %d", got, err, v)
+		}
+	}
+	for _, v := range []int32{math.MinInt32, -1, 0, 42, math.MaxInt32} {
+		if got, err := DecodeInt32(EncodeInt32(v)); err != nil || got != v {
+			t.Errorf("DecodeInt32 returned %d, %v; expected %d", got, err, v)
+		}
+	}
+	for _, v := range []int16{math.MinInt16, -1, 0, 42, math.MaxInt16} {
+		if got, err := DecodeInt16(EncodeInt16(v)); err != nil || got != v {
+			t.Errorf("DecodeInt16 returned %d, %v; expected %d", got, err, v)
+		}
+	}
+	for _, v := range []float64{math.Inf(-1), -0.1, 0, math.SmallestNonzeroFloat64, math.MaxFloat64} {
+		if got, err := DecodeFloat64(EncodeFloat64(v)); err != nil || got != v {
+			t.Errorf("DecodeFloat64 returned %g, %v; expected %g", got, err, v)
+		}
+	}
+	for _, v := range []float32{-0.1, 0, 3.25, math.MaxFloat32} {
+		if got, err := DecodeFloat32(EncodeFloat32(v)); err != nil || got != v {
+			t.Errorf("DecodeFloat32 returned %g, %v; expected %g", got, err, v)
+		}
+	}
+	if got, err := DecodeBool([]byte{1}); err != nil || !got {
+		t.Errorf("DecodeBool returned %v, %v; expected true", got, err)
+	}
+	if got, err := DecodeBool(EncodeBool(false)); err != nil || got {
+		t.Errorf("DecodeBool returned %v, %v; expected false", got, err)
+	}
+	if got := DecodeString(EncodeString("héllo")); got != "héllo" {
+		t.Errorf("DecodeString returned %q", got)
+	}
+
+	if _, err := DecodeInt64([]byte{1, 2, 3, 4}); err == nil {
+		t.Error("Expected an error decoding an int as a long")
+	}
+	if _, err := DecodeInt16(nil); err == nil {
+		t.Error("Expected an error decoding an empty short")
+	}
+}
+
+func TestBigDecimal(t *testing.T) {
+	testcases := []struct {
+		unscaled string
+		scale    int32
+		encoded  []byte
+	}{
+		// new BigDecimal("1.23")
+		{unscaled: "123", scale: 2, encoded: []byte{0, 0, 0, 2, 0x7B}},
+		// new BigDecimal("-1.23")
+		{unscaled: "-123", scale: 2, encoded: []byte{0, 0, 0, 2, 0x85}},
+		{unscaled: "0", scale: 0, encoded: []byte{0, 0, 0, 0, 0}},
+		{unscaled: "-1", scale: 0, encoded: []byte{0, 0, 0, 0, 0xFF}},
+		{unscaled: "128", scale: 0, encoded: []byte{0, 0, 0, 0, 0, 0x80}},
+		{unscaled: "-128", scale: 0, encoded: []byte{0, 0, 0, 0, 0x80}},
+		{unscaled: "-129", scale: 0, encoded: []byte{0, 0, 0, 0, 0xFF, 0x7F}},
+		{unscaled: "255", scale: -3, encoded: []byte{0xFF, 0xFF, 0xFF, 0xFD, 0, 0xFF}},
+		{unscaled: "-65536", scale: 1, encoded: []byte{0, 0, 0, 1, 0xFF, 0, 0}},
+		{unscaled: "123456789012345678901234567890", scale: 10, encoded: []byte{
+			0, 0, 0, 10, 0x01, 0x8E, 0xE9, 0x0F, 0xF6, 0xC3, 0x73, 0xE0, 0xEE,
+			0x4E, 0x3F, 0x0A, 0xD2}},
+	}
+	for i, testcase := range testcases {
+		unscaled, _ := new(big.Int).SetString(testcase.unscaled, 10)
+		buf := EncodeBigDecimal(unscaled, testcase.scale)
+		if !bytes.Equal(buf, testcase.encoded) {
+			t.Errorf("[#%d] Expected %x, got %x", i, testcase.encoded, buf)
+		}
+		got, scale, err := DecodeBigDecimal(buf)
+		if err != nil || got.Cmp(unscaled) != 0 || scale != testcase.scale {
+			t.Errorf("[#%d] DecodeBigDecimal returned %s, %d, %v", i, got, scale, err)
+		}
+	}
+	if _, _, err := DecodeBigDecimal([]byte{0, 0, 0, 2}); err == nil {
+		t.Error("Expected an error for a BigDecimal without unscaled value")
+	}
+}
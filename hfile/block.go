@@ -0,0 +1,128 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package hfile
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// Magic numbers starting the blocks of each type.
+const (
+	dataBlock         = "DATABLK*"
+	bloomChunkBlock   = "BLMFBLK2"
+	rootIndexBlock    = "IDXROOT2"
+	fileInfoBlock     = "FILEINF2"
+	generalBloomBlock = "BLMFMET2"
+	trailerMagic      = "TRABLK\"$"
+)
+
+const (
+	// Size of the header of a block:
+	//	magic (8 bytes)
+	//	on-disk size without header (4 bytes)
+	//	uncompressed size without header (4 bytes)
+	//	offset of the previous block of the same type, or -1 (8 bytes)
+	//	checksum type (1 byte)
+	//	bytes per checksum (4 bytes)
+	//	on-disk size of the data with the header (4 bytes)
+	headerSize = 33
+
+	// Checksums are computed over chunks of this many bytes of the header
+	// and data of a block, and follow the data.
+	bytesPerChecksum = 16 * 1024
+	checksumSize     = 4
+	checksumCRC32C   = 2
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Encodes a block of the given type with the given data, not compressed.
+func encodeBlock(magic string, prevOffset int64, data []byte) []byte {
+	dataSize := headerSize + len(data)
+	numChecksums := (dataSize + bytesPerChecksum - 1) / bytesPerChecksum
+	onDiskSize := dataSize + numChecksums*checksumSize
+
+	block := make([]byte, onDiskSize)
+	copy(block, magic)
+	binary.BigEndian.PutUint32(block[8:], uint32(onDiskSize-headerSize))
+	binary.BigEndian.PutUint32(block[12:], uint32(len(data)))
+	binary.BigEndian.PutUint64(block[16:], uint64(prevOffset))
+	block[24] = checksumCRC32C
+	binary.BigEndian.PutUint32(block[25:], bytesPerChecksum)
+	binary.BigEndian.PutUint32(block[29:], uint32(dataSize))
+	copy(block[headerSize:], data)
+
+	checksums := block[dataSize:]
+	for start := 0; start < dataSize; start += bytesPerChecksum {
+		end := start + bytesPerChecksum
+		if end > dataSize {
+			end = dataSize
+		}
+		binary.BigEndian.PutUint32(checksums, crc32.Checksum(block[start:end], castagnoli))
+		checksums = checksums[checksumSize:]
+	}
+	return block
+}
+
+// An entry of a block index.
+type indexEntry struct {
+	offset     int64
+	onDiskSize int
+	key        []byte
+}
+
+// Appends a root-level block index to the given buffer.  The number of entries
+// isn't part of it, it's stored elsewhere by the blocks referring to it.
+func appendRootIndex(buf []byte, entries []indexEntry) []byte {
+	for _, entry := range entries {
+		buf = appendUint64(buf, uint64(entry.offset))
+		buf = appendUint32(buf, uint32(entry.onDiskSize))
+		buf = appendByteArray(buf, entry.key)
+	}
+	return buf
+}
+
+// Appends a byte array as Hadoop's Bytes.writeByteArray does: prefixed with
+// its length as a variable-length integer.
+func appendByteArray(buf []byte, b []byte) []byte {
+	return append(appendVLong(buf, int64(len(b))), b...)
+}
+
+// Appends an integer in the variable-length encoding of Hadoop's
+// WritableUtils.writeVLong.
+func appendVLong(buf []byte, v int64) []byte {
+	if v >= -112 && v <= 127 {
+		return append(buf, byte(v))
+	}
+	length := -112
+	if v < 0 {
+		v ^= -1
+		length = -120
+	}
+	for tmp := v; tmp != 0; tmp >>= 8 {
+		length--
+	}
+	buf = append(buf, byte(length))
+	if length < -120 {
+		length = -(length + 120)
+	} else {
+		length = -(length + 112)
+	}
+	for i := length; i != 0; i-- {
+		buf = append(buf, byte(v>>(uint(i-1)*8)))
+	}
+	return buf
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	return append(buf, byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32),
+		byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
@@ -0,0 +1,143 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package hfile
+
+import (
+	"bytes"
+	"math"
+)
+
+const (
+	// Version of the format of the metadata of compound Bloom filters.
+	bloomVersion = 3
+	// Hash function of Bloom filters, as in HBase's Hash class.
+	murmurHash = 1
+	// Size of the chunks of Bloom filters, as HBase's default
+	// io.storefile.bloom.block.size.
+	bloomChunkSize = 128 * 1024
+	// Comparator of the keys of the index of row Bloom filters.
+	rawBytesComparator = "org.apache.hadoop.hbase.KeyValue$RawBytesComparator"
+)
+
+// Returns the 32-bit MurmurHash2 of the given key, exactly as HBase's
+// MurmurHash class computes it, including its sign extension of the last
+// bytes.
+func murmur(key []byte, seed int32) int32 {
+	const m = 0x5bd1e995
+	const r = 24
+	h := uint32(seed) ^ uint32(len(key))
+	n := len(key) &^ 3
+	for i := 0; i < n; i += 4 {
+		k := uint32(key[i]) | uint32(key[i+1])<<8 | uint32(key[i+2])<<16 | uint32(key[i+3])<<24
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+	if left := len(key) - n; left > 0 {
+		if left >= 3 {
+			h ^= uint32(int32(int8(key[n+2])) << 16)
+		}
+		if left >= 2 {
+			h ^= uint32(int32(int8(key[n+1])) << 8)
+		}
+		h ^= uint32(int32(int8(key[n])))
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
+
+// A compound Bloom filter: a Bloom filter split in chunks, each holding the
+// keys in a range, stored in their own blocks.
+type bloomFilter struct {
+	hashCount    int
+	bitsPerKey   float64
+	keysPerChunk int
+
+	// Keys of the current chunk.
+	keys [][]byte
+
+	// Chunks written so far.
+	index     []indexEntry
+	byteSize  int64
+	keyCount  int64
+	maxKeys   int64
+	lastAdded []byte
+}
+
+func newBloomFilter(errorRate float64) *bloomFilter {
+	bitsPerKey := -math.Log(errorRate) / (math.Ln2 * math.Ln2)
+	hashCount := int(math.Ceil(math.Ln2 * bitsPerKey))
+	if hashCount < 1 {
+		hashCount = 1
+	}
+	return &bloomFilter{
+		hashCount:    hashCount,
+		bitsPerKey:   bitsPerKey,
+		keysPerChunk: int(bloomChunkSize * 8 / bitsPerKey),
+	}
+}
+
+// Adds a copy of a key, unless it's the same as the previous one.
+func (bf *bloomFilter) add(key []byte) {
+	if bf.lastAdded != nil && bytes.Equal(bf.lastAdded, key) {
+		return
+	}
+	bf.lastAdded = append([]byte(nil), key...)
+	bf.keys = append(bf.keys, bf.lastAdded)
+}
+
+// Returns true if the current chunk is full.
+func (bf *bloomFilter) chunkFull() bool {
+	return len(bf.keys) >= bf.keysPerChunk
+}
+
+// Returns the bits of the current chunk and its first key, and starts a new
+// chunk.
+func (bf *bloomFilter) finishChunk() ([]byte, []byte) {
+	size := int(math.Ceil(float64(len(bf.keys)) * bf.bitsPerKey / 8))
+	if size < 1 {
+		size = 1
+	}
+	bits := make([]byte, size)
+	numBits := int64(size) * 8
+	for _, key := range bf.keys {
+		hash1 := murmur(key, 0)
+		hash2 := murmur(key, hash1)
+		for i := 0; i < bf.hashCount; i++ {
+			// Overflows like Java's int arithmetic.
+			pos := int64(hash1+int32(i)*hash2) % numBits
+			if pos < 0 {
+				pos = -pos
+			}
+			bits[pos/8] |= 1 << uint(pos%8)
+		}
+	}
+	firstKey := bf.keys[0]
+	bf.byteSize += int64(size)
+	bf.keyCount += int64(len(bf.keys))
+	bf.maxKeys += int64(float64(numBits) / bf.bitsPerKey)
+	bf.keys = nil
+	return bits, firstKey
+}
+
+// Returns the content of the block holding the metadata of the filter.
+func (bf *bloomFilter) metadata() []byte {
+	var buf []byte
+	buf = appendUint32(buf, bloomVersion)
+	buf = appendUint64(buf, uint64(bf.byteSize))
+	buf = appendUint32(buf, uint32(bf.hashCount))
+	buf = appendUint32(buf, murmurHash)
+	buf = appendUint64(buf, uint64(bf.keyCount))
+	buf = appendUint64(buf, uint64(bf.maxKeys))
+	buf = appendUint32(buf, uint32(len(bf.index)))
+	buf = appendByteArray(buf, []byte(rawBytesComparator))
+	return appendRootIndex(buf, bf.index)
+}
@@ -0,0 +1,384 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+// Package hfile writes HFiles, the files in which HBase stores the cells of a
+// column family, so that they can be handed to HBase's bulk load API
+// (LoadIncrementalHFiles / completebulkload) without a Java step.
+//
+// Files are written in version 3 of the format, with a single-level data block
+// index, CRC32C checksums, no compression nor data block encoding, and
+// optionally a row Bloom filter.
+package hfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/keyvalue"
+	"github.com/tsuna/gohbase/pb"
+)
+
+const (
+	majorVersion = 3
+	minorVersion = 0
+
+	// The trailer is padded to this size, so that it can be read from the
+	// end of the file.
+	trailerSize = 4096
+
+	// Class of the comparator of the keys of the file.
+	kvComparator = "org.apache.hadoop.hbase.KeyValue$KVComparator"
+	// Compression.Algorithm.NONE in HBase.
+	compressionNone = 2
+
+	// Prefix of the protobuf file info.
+	pbMagic = "PBUF"
+
+	// DefaultBlockSize is the default size of data blocks, as HBase's.
+	DefaultBlockSize = 64 * 1024
+	// DefaultBloomErrorRate is the default false positive rate of the row
+	// Bloom filter, as HBase's.
+	DefaultBloomErrorRate = 0.01
+)
+
+// Keys of the file info.
+const (
+	fileInfoLastKey        = "hfile.LASTKEY"
+	fileInfoAvgKeyLen      = "hfile.AVG_KEY_LEN"
+	fileInfoAvgValueLen    = "hfile.AVG_VALUE_LEN"
+	fileInfoCreateTime     = "hfile.CREATE_TIME_TS"
+	fileInfoMaxTagsLen     = "hfile.MAX_TAGS_LEN"
+	fileInfoTagsCompressed = "hfile.TAGS_COMPRESSED"
+	fileInfoBloomType      = "BLOOM_FILTER_TYPE"
+	fileInfoBulkLoadTime   = "BULKLOAD_TIMESTAMP"
+	fileInfoMajorCompacted = "MAJOR_COMPACTION_KEY"
+	fileInfoTimeRange      = "TIMERANGE"
+)
+
+var (
+	// ErrOutOfOrder is returned by Writer.Append when given a KeyValue that
+	// doesn't sort after the previous one.
+	ErrOutOfOrder = errors.New("hfile: KeyValues appended out of order")
+
+	// ErrClosed is returned when using a Writer that was closed.
+	ErrClosed = errors.New("hfile: writer closed")
+)
+
+// Option is a function used to configure a Writer.
+type Option func(*Writer)
+
+// BlockSize will return an option that will set the size above which data
+// blocks are ended.
+func BlockSize(size int) Option {
+	return func(w *Writer) {
+		w.blockSize = size
+	}
+}
+
+// BloomErrorRate will return an option that will set the false positive rate
+// of the row Bloom filter of the file.  A rate of 0 disables the Bloom filter.
+func BloomErrorRate(rate float64) Option {
+	return func(w *Writer) {
+		w.bloomErrorRate = rate
+	}
+}
+
+// Writer writes KeyValues to an HFile.  KeyValues must be appended in the
+// order HBase sorts them (see keyvalue.Compare), and all of the same family
+// for the file to be bulk loaded.
+type Writer struct {
+	w   io.Writer
+	err error
+
+	blockSize      int
+	bloomErrorRate float64
+
+	// Number of bytes written so far.
+	offset int64
+	// Offset of the last block of each type, to link them.
+	prevOffsets map[string]int64
+	// Sum of the uncompressed sizes of the blocks, with their headers.
+	totalUncompressed int64
+
+	// Current data block.
+	block         []byte
+	blockFirstKey []byte
+	dataIndex     []indexEntry
+
+	bloom *bloomFilter
+
+	// Statistics of the KeyValues appended.
+	last             *keyvalue.KeyValue
+	entryCount       int64
+	totalKeyLength   int64
+	totalValueLength int64
+	maxTagsLength    int
+	minTimestamp     uint64
+	maxTimestamp     uint64
+
+	closed bool
+}
+
+// NewWriter returns a Writer writing an HFile to the given writer.
+func NewWriter(w io.Writer, options ...Option) *Writer {
+	hw := &Writer{
+		w:              w,
+		blockSize:      DefaultBlockSize,
+		bloomErrorRate: DefaultBloomErrorRate,
+		prevOffsets:    make(map[string]int64),
+	}
+	for _, option := range options {
+		option(hw)
+	}
+	if hw.bloomErrorRate > 0 {
+		hw.bloom = newBloomFilter(hw.bloomErrorRate)
+	}
+	return hw
+}
+
+// Append appends a KeyValue to the file.  It's copied, so it can be reused
+// once Append returns.
+func (w *Writer) Append(kv *keyvalue.KeyValue) error {
+	if w.closed {
+		return ErrClosed
+	} else if w.err != nil {
+		return w.err
+	}
+	if w.last != nil {
+		if keyvalue.Compare(w.last, kv) >= 0 {
+			return ErrOutOfOrder
+		}
+		if !bytes.Equal(w.last.Family, kv.Family) {
+			return fmt.Errorf("hfile: KeyValue of family %q in a file of family %q",
+				kv.Family, w.last.Family)
+		}
+	}
+	start := len(w.block)
+	block, err := kv.AppendTo(w.block, true)
+	if err != nil {
+		return err
+	}
+	w.block = block
+	// Everything else points into the block, which is kept until it's
+	// written.
+	appended, _, err := keyvalue.Decode(w.block[start:], true)
+	if err != nil {
+		return err
+	}
+	if w.blockFirstKey == nil {
+		w.blockFirstKey, _ = appended.AppendKey(nil)
+	}
+	if w.bloom != nil {
+		w.bloom.add(appended.Row)
+	}
+	w.last = appended
+	if w.entryCount == 0 || kv.Timestamp < w.minTimestamp {
+		w.minTimestamp = kv.Timestamp
+	}
+	if kv.Timestamp > w.maxTimestamp {
+		w.maxTimestamp = kv.Timestamp
+	}
+	w.entryCount++
+	w.totalKeyLength += int64(kv.KeyLength())
+	w.totalValueLength += int64(len(kv.Value))
+	if len(kv.Tags) > w.maxTagsLength {
+		w.maxTagsLength = len(kv.Tags)
+	}
+	if len(w.block) >= w.blockSize {
+		w.err = w.finishBlock()
+	}
+	return w.err
+}
+
+// Writes a block and returns its offset and on-disk size.
+func (w *Writer) writeBlock(magic string, data []byte) (int64, int, error) {
+	prevOffset, ok := w.prevOffsets[magic]
+	if !ok {
+		prevOffset = -1
+	}
+	block := encodeBlock(magic, prevOffset, data)
+	offset := w.offset
+	if _, err := w.w.Write(block); err != nil {
+		return 0, 0, err
+	}
+	w.offset += int64(len(block))
+	w.prevOffsets[magic] = offset
+	w.totalUncompressed += int64(headerSize + len(data))
+	return offset, len(block), nil
+}
+
+// Writes the current data block, if any, followed by the chunks of the Bloom
+// filter that are full.
+func (w *Writer) finishBlock() error {
+	if len(w.block) == 0 {
+		return nil
+	}
+	offset, size, err := w.writeBlock(dataBlock, w.block)
+	if err != nil {
+		return err
+	}
+	w.dataIndex = append(w.dataIndex, indexEntry{offset: offset, onDiskSize: size,
+		key: w.blockFirstKey})
+	// The last KeyValue is kept for the file info, the rest of the block can
+	// go.
+	w.last = &keyvalue.KeyValue{
+		Row:       append([]byte(nil), w.last.Row...),
+		Family:    append([]byte(nil), w.last.Family...),
+		Qualifier: append([]byte(nil), w.last.Qualifier...),
+		Timestamp: w.last.Timestamp,
+		Type:      w.last.Type,
+	}
+	w.block = nil
+	w.blockFirstKey = nil
+	if w.bloom != nil && w.bloom.chunkFull() {
+		return w.writeBloomChunk()
+	}
+	return nil
+}
+
+func (w *Writer) writeBloomChunk() error {
+	bits, firstKey := w.bloom.finishChunk()
+	offset, size, err := w.writeBlock(bloomChunkBlock, bits)
+	if err != nil {
+		return err
+	}
+	w.bloom.index = append(w.bloom.index, indexEntry{offset: offset, onDiskSize: size,
+		key: firstKey})
+	return nil
+}
+
+// Close writes the end of the file.  It doesn't close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.finishBlock(); err != nil {
+		return err
+	}
+	if w.bloom != nil && len(w.bloom.keys) > 0 {
+		if err := w.writeBloomChunk(); err != nil {
+			return err
+		}
+	}
+
+	trailer := &pb.FileTrailerProto{
+		FileInfoOffset:            proto.Uint64(0),
+		LoadOnOpenDataOffset:      proto.Uint64(uint64(w.offset)),
+		DataIndexCount:            proto.Uint32(uint32(len(w.dataIndex))),
+		MetaIndexCount:            proto.Uint32(0),
+		EntryCount:                proto.Uint64(uint64(w.entryCount)),
+		NumDataIndexLevels:        proto.Uint32(1),
+		FirstDataBlockOffset:      proto.Uint64(^uint64(0)),
+		LastDataBlockOffset:       proto.Uint64(^uint64(0)),
+		ComparatorClassName:       proto.String(kvComparator),
+		CompressionCodec:          proto.Uint32(compressionNone),
+		UncompressedDataIndexSize: proto.Uint64(0),
+	}
+	if len(w.dataIndex) > 0 {
+		trailer.FirstDataBlockOffset = proto.Uint64(uint64(w.dataIndex[0].offset))
+		trailer.LastDataBlockOffset = proto.Uint64(uint64(w.dataIndex[len(w.dataIndex)-1].offset))
+	}
+
+	// The load-on-open section: data block index, meta block index (always
+	// empty), file info and Bloom filter metadata.
+	index := appendRootIndex(nil, w.dataIndex)
+	trailer.UncompressedDataIndexSize = proto.Uint64(uint64(len(index)))
+	if _, _, err := w.writeBlock(rootIndexBlock, index); err != nil {
+		return err
+	}
+	if _, _, err := w.writeBlock(rootIndexBlock, nil); err != nil {
+		return err
+	}
+	trailer.FileInfoOffset = proto.Uint64(uint64(w.offset))
+	fileInfo, err := w.fileInfo()
+	if err != nil {
+		return err
+	}
+	if _, _, err = w.writeBlock(fileInfoBlock, fileInfo); err != nil {
+		return err
+	}
+	if w.bloom != nil && len(w.bloom.index) > 0 {
+		if _, _, err = w.writeBlock(generalBloomBlock, w.bloom.metadata()); err != nil {
+			return err
+		}
+	}
+
+	trailer.TotalUncompressedBytes = proto.Uint64(uint64(w.totalUncompressed + trailerSize))
+	buf, err := encodeTrailer(trailer)
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(buf)
+	return err
+}
+
+// Returns the content of the file info block.
+func (w *Writer) fileInfo() ([]byte, error) {
+	info := map[string][]byte{
+		fileInfoAvgKeyLen:      appendUint32(nil, 0),
+		fileInfoAvgValueLen:    appendUint32(nil, 0),
+		fileInfoCreateTime:     appendUint64(nil, uint64(time.Now().UnixNano()/int64(time.Millisecond))),
+		fileInfoMaxTagsLen:     appendUint32(nil, uint32(w.maxTagsLength)),
+		fileInfoTagsCompressed: {0},
+		fileInfoBulkLoadTime:   appendUint64(nil, uint64(time.Now().UnixNano()/int64(time.Millisecond))),
+		fileInfoMajorCompacted: {0},
+	}
+	if w.entryCount > 0 {
+		lastKey, err := w.last.AppendKey(nil)
+		if err != nil {
+			return nil, err
+		}
+		info[fileInfoLastKey] = lastKey
+		info[fileInfoAvgKeyLen] = appendUint32(nil, uint32(w.totalKeyLength/w.entryCount))
+		info[fileInfoAvgValueLen] = appendUint32(nil, uint32(w.totalValueLength/w.entryCount))
+		info[fileInfoTimeRange] = appendUint64(appendUint64(nil, w.minTimestamp), w.maxTimestamp)
+	}
+	if w.bloom != nil && len(w.bloom.index) > 0 {
+		info[fileInfoBloomType] = []byte("ROW")
+	}
+	// HBase keeps the file info sorted.
+	keys := make([]string, 0, len(info))
+	for key := range info {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fileInfo := &pb.FileInfoProto{}
+	for _, key := range keys {
+		fileInfo.MapEntry = append(fileInfo.MapEntry,
+			&pb.BytesBytesPair{First: []byte(key), Second: info[key]})
+	}
+	buf, err := proto.Marshal(fileInfo)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte(pbMagic), proto.EncodeVarint(uint64(len(buf)))...), buf...), nil
+}
+
+// Encodes the trailer: its magic, the length-delimited protobuf, padding, and
+// the version of the format.
+func encodeTrailer(trailer *pb.FileTrailerProto) ([]byte, error) {
+	msg, err := proto.Marshal(trailer)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 0, trailerSize)
+	buf = append(buf, trailerMagic...)
+	buf = append(buf, proto.EncodeVarint(uint64(len(msg)))...)
+	buf = append(buf, msg...)
+	if len(buf) > trailerSize-4 {
+		return nil, errors.New("hfile: trailer too large")
+	}
+	buf = append(buf, make([]byte, trailerSize-4-len(buf))...)
+	return appendUint32(buf, majorVersion|minorVersion<<24), nil
+}
@@ -0,0 +1,300 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package hfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/keyvalue"
+	"github.com/tsuna/gohbase/pb"
+)
+
+func TestAppendVLong(t *testing.T) {
+	// As written by Hadoop's WritableUtils.writeVLong.
+	for v, expected := range map[int64][]byte{
+		0:    {0x00},
+		127:  {0x7f},
+		-112: {0x90},
+		128:  {0x8f, 0x80},
+		255:  {0x8f, 0xff},
+		256:  {0x8e, 0x01, 0x00},
+		-113: {0x87, 0x70},
+	} {
+		if buf := appendVLong(nil, v); !bytes.Equal(buf, expected) {
+			t.Errorf("Expected %x for %d, got %x", expected, v, buf)
+		}
+	}
+}
+
+// A block read back from a file.
+type block struct {
+	magic      string
+	prevOffset int64
+	data       []byte
+	onDiskSize int
+}
+
+// Reads the block at the given offset, checking its checksums.
+func readBlock(t *testing.T, file []byte, offset int64) *block {
+	buf := file[offset:]
+	onDiskSize := headerSize + int(binary.BigEndian.Uint32(buf[8:]))
+	dataSize := int(binary.BigEndian.Uint32(buf[29:]))
+	b := &block{
+		magic:      string(buf[:8]),
+		prevOffset: int64(binary.BigEndian.Uint64(buf[16:])),
+		data:       buf[headerSize:dataSize],
+		onDiskSize: onDiskSize,
+	}
+	if n := int(binary.BigEndian.Uint32(buf[12:])); n != len(b.data) {
+		t.Fatalf("Block at %d: uncompressed size %d, expected %d", offset, n, len(b.data))
+	}
+	if buf[24] != checksumCRC32C {
+		t.Fatalf("Block at %d: unexpected checksum type %d", offset, buf[24])
+	}
+	checksums := buf[dataSize:onDiskSize]
+	for start := 0; start < dataSize; start += bytesPerChecksum {
+		end := start + bytesPerChecksum
+		if end > dataSize {
+			end = dataSize
+		}
+		if crc32.Checksum(buf[start:end], castagnoli) != binary.BigEndian.Uint32(checksums) {
+			t.Fatalf("Block at %d: invalid checksum", offset)
+		}
+		checksums = checksums[checksumSize:]
+	}
+	if len(checksums) != 0 {
+		t.Fatalf("Block at %d: %d extra checksum bytes", offset, len(checksums))
+	}
+	return b
+}
+
+func readVLong(buf []byte) (int64, []byte) {
+	first := int8(buf[0])
+	if first >= -112 {
+		return int64(first), buf[1:]
+	}
+	n := -111 - int(first)
+	negative := first < -120
+	if negative {
+		n = -119 - int(first)
+	}
+	var v int64
+	for _, b := range buf[1:n] {
+		v = v<<8 | int64(b)
+	}
+	if negative {
+		v ^= -1
+	}
+	return v, buf[n:]
+}
+
+func readRootIndex(buf []byte, count int) ([]indexEntry, []byte) {
+	entries := make([]indexEntry, count)
+	for i := range entries {
+		entries[i].offset = int64(binary.BigEndian.Uint64(buf))
+		entries[i].onDiskSize = int(binary.BigEndian.Uint32(buf[8:]))
+		n, rest := readVLong(buf[12:])
+		entries[i].key, buf = rest[:n], rest[n:]
+	}
+	return entries, buf
+}
+
+// Checks that the given row is in the Bloom filter.
+func bloomContains(bits []byte, hashCount int, row []byte) bool {
+	hash1 := murmur(row, 0)
+	hash2 := murmur(row, hash1)
+	numBits := int64(len(bits)) * 8
+	for i := 0; i < hashCount; i++ {
+		pos := int64(hash1+int32(i)*hash2) % numBits
+		if pos < 0 {
+			pos = -pos
+		}
+		if bits[pos/8]&(1<<uint(pos%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWriter(t *testing.T) {
+	var kvs []*keyvalue.KeyValue
+	for i := 0; i < 3000; i++ {
+		row := []byte(fmt.Sprintf("row%05d", i))
+		kvs = append(kvs,
+			&keyvalue.KeyValue{Row: row, Family: []byte("cf"), Qualifier: []byte("a"),
+				Timestamp: uint64(1000 + i), Type: keyvalue.Put, Value: []byte("value a")},
+			&keyvalue.KeyValue{Row: row, Family: []byte("cf"), Qualifier: []byte("b"),
+				Timestamp: 42, Type: keyvalue.Put, Value: []byte("value b"),
+				Tags: []byte{0, 3, 1, 'a', 'b'}})
+	}
+	var buf bytes.Buffer
+	// Small blocks and chunks, so that there are several of them.
+	w := NewWriter(&buf, BlockSize(4096))
+	w.bloom.keysPerChunk = 1000
+	for _, kv := range kvs {
+		if err := w.Append(kv); err != nil {
+			t.Fatalf("Append failed: %s", err)
+		}
+	}
+	if err := w.Append(kvs[0]); err != ErrOutOfOrder {
+		t.Errorf("Expected ErrOutOfOrder, got %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %s", err)
+	}
+	if err := w.Append(kvs[0]); err != ErrClosed {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+	file := buf.Bytes()
+
+	// Trailer.
+	tr := file[len(file)-trailerSize:]
+	if string(tr[:8]) != trailerMagic {
+		t.Fatalf("Invalid trailer magic %q", tr[:8])
+	}
+	if v := binary.BigEndian.Uint32(tr[trailerSize-4:]); v != 3 {
+		t.Errorf("Expected version 3.0, got %x", v)
+	}
+	n, nb := proto.DecodeVarint(tr[8:])
+	trailer := &pb.FileTrailerProto{}
+	if err := proto.Unmarshal(tr[8+nb:8+nb+int(n)], trailer); err != nil {
+		t.Fatalf("Invalid trailer: %s", err)
+	}
+	if trailer.GetEntryCount() != uint64(len(kvs)) {
+		t.Errorf("Expected %d entries, got %d", len(kvs), trailer.GetEntryCount())
+	}
+	if trailer.GetNumDataIndexLevels() != 1 || trailer.GetFirstDataBlockOffset() != 0 ||
+		trailer.GetComparatorClassName() != kvComparator {
+		t.Errorf("Unexpected trailer %v", trailer)
+	}
+
+	// Load-on-open section.
+	offset := int64(trailer.GetLoadOnOpenDataOffset())
+	var blocks []*block
+	for offset < int64(len(file)-trailerSize) {
+		b := readBlock(t, file, offset)
+		blocks = append(blocks, b)
+		offset += int64(b.onDiskSize)
+	}
+	if len(blocks) != 4 || blocks[0].magic != rootIndexBlock || blocks[1].magic != rootIndexBlock ||
+		blocks[2].magic != fileInfoBlock || blocks[3].magic != generalBloomBlock {
+		t.Fatalf("Unexpected load-on-open blocks %v", blocks)
+	}
+	dataIndex, rest := readRootIndex(blocks[0].data, int(trailer.GetDataIndexCount()))
+	if len(rest) != 0 || len(dataIndex) < 2 {
+		t.Fatalf("Unexpected data index %v", dataIndex)
+	}
+	if len(blocks[1].data) != 0 {
+		t.Errorf("Expected an empty meta index")
+	}
+
+	// Data blocks.
+	var read []*keyvalue.KeyValue
+	prevOffset := int64(-1)
+	for i, entry := range dataIndex {
+		b := readBlock(t, file, entry.offset)
+		if b.magic != dataBlock || b.onDiskSize != entry.onDiskSize || b.prevOffset != prevOffset {
+			t.Fatalf("Unexpected data block %d %v", i, b)
+		}
+		prevOffset = entry.offset
+		for data := b.data; len(data) > 0; {
+			kv, n, err := keyvalue.Decode(data, true)
+			if err != nil {
+				t.Fatalf("Invalid KeyValue in block %d: %s", i, err)
+			}
+			if len(kv.Tags) == 0 {
+				kv.Tags = nil
+			}
+			if len(data) == len(b.data) {
+				if key, _ := kv.AppendKey(nil); !bytes.Equal(key, entry.key) {
+					t.Errorf("Block %d indexed with key %q, starts with %q", i, entry.key, key)
+				}
+			}
+			read = append(read, kv)
+			data = data[n:]
+		}
+	}
+	if int64(trailer.GetLastDataBlockOffset()) != prevOffset {
+		t.Errorf("Last data block at %d, expected %d", prevOffset, trailer.GetLastDataBlockOffset())
+	}
+	if !reflect.DeepEqual(read, kvs) {
+		t.Error("KeyValues read back differ from those written")
+	}
+
+	// File info.
+	info := blocks[2].data
+	if string(info[:4]) != pbMagic {
+		t.Fatalf("Invalid file info magic %q", info[:4])
+	}
+	n, nb = proto.DecodeVarint(info[4:])
+	fileInfo := &pb.FileInfoProto{}
+	if err := proto.Unmarshal(info[4+nb:4+nb+int(n)], fileInfo); err != nil {
+		t.Fatalf("Invalid file info: %s", err)
+	}
+	entries := make(map[string][]byte)
+	for _, entry := range fileInfo.MapEntry {
+		entries[string(entry.First)] = entry.Second
+	}
+	lastKey, _ := kvs[len(kvs)-1].AppendKey(nil)
+	if !bytes.Equal(entries[fileInfoLastKey], lastKey) {
+		t.Errorf("Expected last key %q, got %q", lastKey, entries[fileInfoLastKey])
+	}
+	if binary.BigEndian.Uint32(entries[fileInfoMaxTagsLen]) != 5 {
+		t.Errorf("Expected max tags length of 5, got %x", entries[fileInfoMaxTagsLen])
+	}
+	if tr := entries[fileInfoTimeRange]; binary.BigEndian.Uint64(tr) != 42 ||
+		binary.BigEndian.Uint64(tr[8:]) != 3999 {
+		t.Errorf("Unexpected time range %x", tr)
+	}
+	if string(entries[fileInfoBloomType]) != "ROW" {
+		t.Errorf("Unexpected Bloom filter type %q", entries[fileInfoBloomType])
+	}
+
+	// Bloom filter.
+	meta := blocks[3].data
+	hashCount := int(binary.BigEndian.Uint32(meta[12:]))
+	if keyCount := binary.BigEndian.Uint64(meta[20:]); keyCount != 3000 {
+		t.Errorf("Expected 3000 keys in the Bloom filter, got %d", keyCount)
+	}
+	numChunks := int(binary.BigEndian.Uint32(meta[36:]))
+	n2, rest := readVLong(meta[40:])
+	if string(rest[:n2]) != rawBytesComparator {
+		t.Errorf("Unexpected Bloom filter comparator %q", rest[:n2])
+	}
+	chunks, rest := readRootIndex(rest[n2:], numChunks)
+	if numChunks != 3 || len(rest) != 0 {
+		t.Fatalf("Unexpected Bloom filter index %v", chunks)
+	}
+	for i := 0; i < 3000; i++ {
+		row := []byte(fmt.Sprintf("row%05d", i))
+		chunk := chunks[sort.Search(len(chunks), func(j int) bool {
+			return bytes.Compare(chunks[j].key, row) > 0
+		})-1]
+		b := readBlock(t, file, chunk.offset)
+		if b.magic != bloomChunkBlock || !bloomContains(b.data, hashCount, row) {
+			t.Fatalf("Row %s not in the Bloom filter", row)
+		}
+	}
+}
+
+func TestWriterFamilies(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{})
+	if err := w.Append(&keyvalue.KeyValue{Row: []byte("a"), Family: []byte("cf1"),
+		Type: keyvalue.Put}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Append(&keyvalue.KeyValue{Row: []byte("b"), Family: []byte("cf2"),
+		Type: keyvalue.Put}); err == nil {
+		t.Error("Expected an error appending a KeyValue of another family")
+	}
+}
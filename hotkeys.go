@@ -0,0 +1,182 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"container/heap"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tsuna/gohbase/hrpc"
+)
+
+// SampleKeys will return an option that will make the client record the keys
+// of the given fraction (between 0 and 1) of its requests, and keep track of
+// the approximate k most requested keys of each table among them, to find
+// hotspots.  They're reported by DumpState.
+func SampleKeys(fraction float64, k int) Option {
+	return func(c *client) {
+		c.keySampler = newKeySampler(fraction, k)
+	}
+}
+
+// HotKey is a key among the most requested of a table, see SampleKeys.
+type HotKey struct {
+	Key []byte
+
+	// Count is the number of sampled requests for the key.  It's
+	// overestimated by at most Error.
+	Count uint64
+	Error uint64
+}
+
+// Records the keys of a fraction of the requests.
+type keySampler struct {
+	fraction float64
+	k        int
+
+	// Protects everything below.
+	m sync.Mutex
+
+	rand *rand.Rand
+
+	// Heavy hitters of each table, by table name.
+	tables map[string]*spaceSaving
+}
+
+func newKeySampler(fraction float64, k int) *keySampler {
+	return &keySampler{
+		fraction: fraction,
+		k:        k,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		tables:   make(map[string]*spaceSaving),
+	}
+}
+
+// Records the key of the given request, if it's sampled.
+func (s *keySampler) add(rpc hrpc.Call) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.rand.Float64() >= s.fraction {
+		return
+	}
+	sketch, ok := s.tables[string(rpc.Table())]
+	if !ok {
+		sketch = newSpaceSaving(s.k)
+		s.tables[string(rpc.Table())] = sketch
+	}
+	sketch.add(string(rpc.Key()))
+}
+
+// Returns the most requested keys of each table, most requested first.
+func (s *keySampler) hotKeys() map[string][]HotKey {
+	s.m.Lock()
+	defer s.m.Unlock()
+	hot := make(map[string][]HotKey, len(s.tables))
+	for table, sketch := range s.tables {
+		hot[table] = sketch.top()
+	}
+	return hot
+}
+
+// Records the key of the given request, if keys are sampled.
+func (c *client) sampleKey(rpc hrpc.Call) {
+	if c.keySampler != nil {
+		c.keySampler.add(rpc)
+	}
+}
+
+// A Space-Saving sketch (Metwally et al.), which finds the heavy hitters of
+// a stream with a fixed number of counters.  When a key without counter
+// comes up and all are taken, the counter with the lowest count is given to
+// it, keeping its count, which becomes the maximum error of the count of the
+// new key.
+type spaceSaving struct {
+	k        int
+	counters map[string]*hotKeyCounter
+	// Heap of the counters, lowest count first.
+	byCount hotKeyCounters
+}
+
+type hotKeyCounter struct {
+	key   string
+	count uint64
+	err   uint64
+	index int // In the heap.
+}
+
+func newSpaceSaving(k int) *spaceSaving {
+	return &spaceSaving{k: k, counters: make(map[string]*hotKeyCounter, k)}
+}
+
+func (s *spaceSaving) add(key string) {
+	if c, ok := s.counters[key]; ok {
+		c.count++
+		heap.Fix(&s.byCount, c.index)
+		return
+	}
+	if len(s.byCount) < s.k {
+		c := &hotKeyCounter{key: key, count: 1}
+		s.counters[key] = c
+		heap.Push(&s.byCount, c)
+		return
+	}
+	if s.k <= 0 {
+		return
+	}
+	c := s.byCount[0]
+	delete(s.counters, c.key)
+	c.key, c.err = key, c.count
+	c.count++
+	s.counters[key] = c
+	heap.Fix(&s.byCount, 0)
+}
+
+// Returns the keys tracked, most requested first.
+func (s *spaceSaving) top() []HotKey {
+	keys := make([]HotKey, 0, len(s.byCount))
+	for _, c := range s.byCount {
+		keys = append(keys, HotKey{Key: []byte(c.key), Count: c.count, Error: c.err})
+	}
+	sort.Sort(hotKeysByCount(keys))
+	return keys
+}
+
+type hotKeyCounters []*hotKeyCounter
+
+func (h hotKeyCounters) Len() int           { return len(h) }
+func (h hotKeyCounters) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h hotKeyCounters) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *hotKeyCounters) Push(x interface{}) {
+	c := x.(*hotKeyCounter)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *hotKeyCounters) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+type hotKeysByCount []HotKey
+
+func (k hotKeysByCount) Len() int      { return len(k) }
+func (k hotKeysByCount) Swap(i, j int) { k[i], k[j] = k[j], k[i] }
+func (k hotKeysByCount) Less(i, j int) bool {
+	if k[i].Count != k[j].Count {
+		return k[i].Count > k[j].Count
+	}
+	return string(k[i].Key) < string(k[j].Key)
+}
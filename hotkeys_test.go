@@ -0,0 +1,66 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"golang.org/x/net/context"
+)
+
+func TestSpaceSaving(t *testing.T) {
+	s := newSpaceSaving(2)
+	for _, key := range strings.Split("a a a b c d", " ") {
+		s.add(key)
+	}
+	top := s.top()
+	if len(top) != 2 {
+		t.Fatalf("Expected 2 keys, got %v", top)
+	}
+	// a is counted exactly, while c took the counter of b, then d the
+	// counter of c.
+	if string(top[0].Key) != "a" || top[0].Count != 3 || top[0].Error != 0 {
+		t.Errorf("Expected a counted 3 times exactly, got %+v", top[0])
+	}
+	if string(top[1].Key) != "d" || top[1].Count != 3 || top[1].Error != 2 {
+		t.Errorf("Expected d counted 3 times with an error of 2, got %+v", top[1])
+	}
+}
+
+func TestSampleKeys(t *testing.T) {
+	c := newClient("~invalid.quorum~", SampleKeys(1, 3))
+	ctx := context.Background()
+	for _, key := range []string{"hot", "hot", "hot", "warm", "warm", "cold"} {
+		get, _ := hrpc.NewGetStr(ctx, "test", key)
+		c.sampleKey(get)
+	}
+	put, _ := hrpc.NewPutStr(ctx, "other", "row",
+		map[string]map[string][]byte{"cf": {"a": []byte("1")}})
+	c.sampleKey(put)
+
+	st := c.DumpState()
+	hot := st.HotKeys["test"]
+	if len(hot) != 3 || string(hot[0].Key) != "hot" || hot[0].Count != 3 ||
+		string(hot[1].Key) != "warm" || string(hot[2].Key) != "cold" {
+		t.Errorf("Unexpected hot keys of test: %+v", hot)
+	}
+	if len(st.HotKeys["other"]) != 1 {
+		t.Errorf("Unexpected hot keys of other: %+v", st.HotKeys["other"])
+	}
+	if !strings.Contains(st.String(), `"hot": 3`) {
+		t.Errorf("Expected the hot keys in the report, got:\n%s", st)
+	}
+
+	// Nothing is recorded when sampling none of the requests.
+	c = newClient("~invalid.quorum~", SampleKeys(0, 3))
+	get, _ := hrpc.NewGetStr(ctx, "test", "hot")
+	c.sampleKey(get)
+	if hot := c.DumpState().HotKeys; len(hot) != 0 {
+		t.Errorf("Expected no hot keys, got %+v", hot)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package hrpc
+
+import (
+	"errors"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/filter"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/regioninfo"
+	"golang.org/x/net/context"
+)
+
+// GetRegionInfo is an RPC to the AdminService of a RegionServer, asking for
+// information about one of its regions.
+type GetRegionInfo struct {
+	base
+
+	compactionState bool
+}
+
+// NewGetRegionInfo creates a new GetRegionInfo request for the given region,
+// which also asks for its compaction state.
+func NewGetRegionInfo(ctx context.Context, reg *regioninfo.Info) *GetRegionInfo {
+	return &GetRegionInfo{
+		base: base{
+			table:  reg.Table,
+			key:    reg.StartKey,
+			region: reg,
+			ctx:    ctx,
+		},
+		compactionState: true,
+	}
+}
+
+// NewRollWALWriter creates a new call asking a RegionServer to roll its
+// write-ahead log.
+func NewRollWALWriter(ctx context.Context) *AdminCall {
+	return newAdminCall(ctx, "RollWALWriter", &pb.RollWALWriterRequest{},
+		func() proto.Message { return &pb.RollWALWriterResponse{} })
+}
+
+// NewGetOnlineRegion creates a new call asking a RegionServer for the regions
+// it serves.
+func NewGetOnlineRegion(ctx context.Context) *AdminCall {
+	return newAdminCall(ctx, "GetOnlineRegion", &pb.GetOnlineRegionRequest{},
+		func() proto.Message { return &pb.GetOnlineRegionResponse{} })
+}
+
+// NewGetServerInfo creates a new call asking a RegionServer for its name and
+// the port of its web UI.
+func NewGetServerInfo(ctx context.Context) *AdminCall {
+	return newAdminCall(ctx, "GetServerInfo", &pb.GetServerInfoRequest{},
+		func() proto.Message { return &pb.GetServerInfoResponse{} })
+}
+
+// NewCloseRegion creates a new call asking a RegionServer to close the region
+// with the given name.  The Master isn't involved, so the region stays closed
+// until it's assigned again.
+func NewCloseRegion(ctx context.Context, regionName []byte) *AdminCall {
+	return newAdminCall(ctx, "CloseRegion", &pb.CloseRegionRequest{
+		Region: &pb.RegionSpecifier{
+			Type:  pb.RegionSpecifier_REGION_NAME.Enum(),
+			Value: regionName,
+		},
+	}, func() proto.Message { return &pb.CloseRegionResponse{} })
+}
+
+// NewClearRegionBlockCache creates a new call asking a RegionServer to evict
+// the blocks of the regions with the given names from its block cache.
+func NewClearRegionBlockCache(ctx context.Context, regionNames [][]byte) *AdminCall {
+	req := &pb.ClearRegionBlockCacheRequest{}
+	for _, name := range regionNames {
+		req.Region = append(req.Region, &pb.RegionSpecifier{
+			Type:  pb.RegionSpecifier_REGION_NAME.Enum(),
+			Value: name,
+		})
+	}
+	return newAdminCall(ctx, "ClearRegionBlockCache", req,
+		func() proto.Message { return &pb.ClearRegionBlockCacheResponse{} })
+}
+
+// GetName returns the name of this RPC call.
+func (g *GetRegionInfo) GetName() string {
+	return "GetRegionInfo"
+}
+
+// Serialize converts this request into a protobuf message suitable for
+// sending to a RegionServer.
+func (g *GetRegionInfo) Serialize() ([]byte, error) {
+	return proto.Marshal(&pb.GetRegionInfoRequest{
+		Region:          g.regionSpecifier(),
+		CompactionState: &g.compactionState,
+	})
+}
+
+// NewResponse creates an empty protobuf message to read the response of this
+// RPC.
+func (g *GetRegionInfo) NewResponse() proto.Message {
+	return &pb.GetRegionInfoResponse{}
+}
+
+// SetFilter always returns an error when used on GetRegionInfo objects. Do
+// not use.  Exists solely so GetRegionInfo can implement the Call interface.
+func (g *GetRegionInfo) SetFilter(ft filter.Filter) error {
+	return errors.New("Cannot set filter on GetRegionInfo operation.")
+}
+
+// SetFamilies always returns an error when used on GetRegionInfo objects. Do
+// not use.  Exists solely so GetRegionInfo can implement the Call interface.
+func (g *GetRegionInfo) SetFamilies(fam map[string][]string) error {
+	return errors.New("Cannot set families on GetRegionInfo operation.")
+}
@@ -6,8 +6,13 @@
 package hrpc
 
 import (
+	"errors"
+	"sync"
+	"time"
+
 	"github.com/golang/protobuf/proto"
 	"github.com/tsuna/gohbase/filter"
+	"github.com/tsuna/gohbase/keyvalue"
 	"github.com/tsuna/gohbase/pb"
 	"github.com/tsuna/gohbase/regioninfo"
 	"golang.org/x/net/context"
@@ -30,11 +35,94 @@ type Call interface {
 	GetResultChan() chan RPCResult
 
 	GetContext() context.Context
+	// SetContext replaces the context of this call, e.g. to give it a
+	// deadline.  It must not be called once the call was sent.
+	SetContext(ctx context.Context)
 
 	SetFamilies(fam map[string][]string) error
 	SetFilter(ft filter.Filter) error
+
+	// User returns the user on behalf of whom this call is made, or an
+	// empty string if it's made as the user of the connection.
+	User() string
+	SetUser(user string)
+
+	// Tenant returns the tag of the tenant this call is made for, used to
+	// schedule the RPCs of tenants fairly, or an empty string if it's
+	// scheduled with the other calls on its table.
+	Tenant() string
+	SetTenant(tenant string)
+
+	// Priority returns the priority of this call, which RegionServers use
+	// to pick the pool of handlers serving it, or NormalPriority.
+	Priority() uint32
+	SetPriority(priority uint32)
+
+	// Metadata returns information about how this call was carried out so
+	// far (attempts made, servers tried, time spent queued or waiting to be
+	// retried).
+	Metadata() Metadata
+	// StartAttempt records that this call is being queued for sending to the
+	// RegionServer at the given address.
+	StartAttempt(server string)
+	// EndQueueWait records that this call left the RPC queue and is being
+	// written to the wire.
+	EndQueueWait()
+	// AddRetryDelay records time spent waiting before this call could be
+	// retried (e.g. while its region was unavailable).
+	AddRetryDelay(d time.Duration)
+	// AddRetry records that this call failed and is being sent again.
+	AddRetry()
 }
 
+// CellBlockCall is implemented by the calls whose cells can be sent in a cell
+// block following their request, rather than in the request itself.
+type CellBlockCall interface {
+	Call
+
+	// SerializeCellBlock is like Serialize, except that the cells aren't
+	// part of the returned protobuf message but returned as KeyValues, in
+	// the order in which they must be sent.
+	SerializeCellBlock() ([]byte, []*keyvalue.KeyValue, error)
+}
+
+// Metadata describes how a call was carried out.  It is meant to be looked
+// at once the call has completed, to log or alert on degraded paths.
+type Metadata struct {
+	// Attempts is the number of times the call was queued on a region client.
+	Attempts int
+
+	// Retries is the number of times the call was sent again after failing,
+	// including when it failed before being queued on a region client
+	// (e.g. because its region couldn't be located).
+	Retries int
+
+	// Servers lists the "host:port" of every RegionServer the call was sent
+	// to, in order, without consecutive duplicates.
+	Servers []string
+
+	// QueueTime is the total time the call spent waiting in RPC queues
+	// before being written to the wire, across all attempts.
+	QueueTime time.Duration
+
+	// RetryDelay is the total time spent waiting for a region to become
+	// available again before the call could be retried.
+	RetryDelay time.Duration
+}
+
+// Priorities of calls, as defined by HBase's HConstants.  RegionServers serve
+// the calls with a priority above NormalPriority with dedicated handlers, so
+// that they don't queue behind the bulk of the user traffic.
+const (
+	// NormalPriority is the priority of calls by default.
+	NormalPriority uint32 = 0
+	// AdminPriority is the priority of administrative calls.
+	AdminPriority uint32 = 100
+	// HighPriority is the priority of calls against system tables, such
+	// as lookups in hbase:meta.
+	HighPriority uint32 = 200
+)
+
 // RPCResult is struct that will contain both the resulting message from an RPC
 // call, and any errors that may have occurred related to making the RPC call.
 type RPCResult struct {
@@ -52,12 +140,31 @@ type base struct {
 	resultch chan RPCResult
 
 	ctx context.Context
+
+	// Effective user of this call, empty for the user of the connection.
+	user string
+
+	// Tenant of this call, empty if it's scheduled by table.
+	tenant string
+
+	// Priority of this call, NormalPriority unless set.
+	priority uint32
+
+	// metaLock protects meta and queuedAt, which are updated both by the
+	// caller and by the region client's goroutines.
+	metaLock sync.Mutex
+	meta     Metadata
+	queuedAt time.Time
 }
 
 func (b *base) GetContext() context.Context {
 	return b.ctx
 }
 
+func (b *base) SetContext(ctx context.Context) {
+	b.ctx = ctx
+}
+
 func (b *base) GetRegion() *regioninfo.Info {
 	return b.region
 }
@@ -84,6 +191,30 @@ func applyOptions(call Call, options ...func(Call) error) error {
 	return nil
 }
 
+func (b *base) User() string {
+	return b.user
+}
+
+func (b *base) SetUser(user string) {
+	b.user = user
+}
+
+func (b *base) Tenant() string {
+	return b.tenant
+}
+
+func (b *base) SetTenant(tenant string) {
+	b.tenant = tenant
+}
+
+func (b *base) Priority() uint32 {
+	return b.priority
+}
+
+func (b *base) SetPriority(priority uint32) {
+	b.priority = priority
+}
+
 func (b *base) Table() []byte {
 	return b.table
 }
@@ -102,6 +233,67 @@ func (b *base) GetResultChan() chan RPCResult {
 	return b.resultch
 }
 
+// Metadata returns a copy of the information recorded about this call.
+func (b *base) Metadata() Metadata {
+	b.metaLock.Lock()
+	md := b.meta
+	md.Servers = append([]string(nil), b.meta.Servers...)
+	b.metaLock.Unlock()
+	return md
+}
+
+// StartAttempt records a new attempt at sending this call to the given server.
+func (b *base) StartAttempt(server string) {
+	b.metaLock.Lock()
+	b.meta.Attempts++
+	if n := len(b.meta.Servers); n == 0 || b.meta.Servers[n-1] != server {
+		b.meta.Servers = append(b.meta.Servers, server)
+	}
+	b.queuedAt = time.Now()
+	b.metaLock.Unlock()
+}
+
+// EndQueueWait adds the time elapsed since the last call to StartAttempt to
+// the queue time of this call.
+func (b *base) EndQueueWait() {
+	b.metaLock.Lock()
+	if !b.queuedAt.IsZero() {
+		b.meta.QueueTime += time.Since(b.queuedAt)
+		b.queuedAt = time.Time{}
+	}
+	b.metaLock.Unlock()
+}
+
+// AddRetryDelay adds the given duration to the retry delay of this call.
+func (b *base) AddRetryDelay(d time.Duration) {
+	b.metaLock.Lock()
+	b.meta.RetryDelay += d
+	b.metaLock.Unlock()
+}
+
+// AddRetry counts a new retry of this call.
+func (b *base) AddRetry() {
+	b.metaLock.Lock()
+	b.meta.Retries++
+	b.metaLock.Unlock()
+}
+
+// AddMetadata merges the given metadata into that of this call.  This is
+// used to account for internal calls made on behalf of this one.
+func (b *base) AddMetadata(md Metadata) {
+	b.metaLock.Lock()
+	b.meta.Attempts += md.Attempts
+	b.meta.Retries += md.Retries
+	for _, server := range md.Servers {
+		if n := len(b.meta.Servers); n == 0 || b.meta.Servers[n-1] != server {
+			b.meta.Servers = append(b.meta.Servers, server)
+		}
+	}
+	b.meta.QueueTime += md.QueueTime
+	b.meta.RetryDelay += md.RetryDelay
+	b.metaLock.Unlock()
+}
+
 // Families is used as a parameter for request creation. Adds families constraint to a request.
 func Families(fam map[string][]string) func(Call) error {
 	return func(g Call) error {
@@ -115,3 +307,127 @@ func Filters(fl filter.Filter) func(Call) error {
 		return g.SetFilter(fl)
 	}
 }
+
+// MaxVersions is used as a parameter for Get and Scan request creation. Sets
+// the maximum number of versions of each cell to return.
+func MaxVersions(versions uint32) func(Call) error {
+	return func(c Call) error {
+		switch c := c.(type) {
+		case *Get:
+			c.maxVersions = versions
+		case *Scan:
+			c.maxVersions = versions
+		default:
+			return errors.New("'MaxVersions' option can only be used with Get or Scan")
+		}
+		return nil
+	}
+}
+
+// CacheBlocks is used as a parameter for Get and Scan request creation. Sets
+// whether the RegionServer should keep the blocks read in its block cache,
+// which is best avoided for reads unlikely to be repeated (e.g. full scans).
+func CacheBlocks(cache bool) func(Call) error {
+	return func(c Call) error {
+		switch c := c.(type) {
+		case *Get:
+			c.cacheBlocks = &cache
+		case *Scan:
+			c.cacheBlocks = &cache
+		default:
+			return errors.New("'CacheBlocks' option can only be used with Get or Scan")
+		}
+		return nil
+	}
+}
+
+// Consistency is used as a parameter for Get and Scan request creation. Sets
+// the consistency required of the reads: with pb.Consistency_TIMELINE, they
+// may be served by secondary replicas of the regions.
+func Consistency(consistency pb.Consistency) func(Call) error {
+	return func(c Call) error {
+		switch c := c.(type) {
+		case *Get:
+			c.consistency = &consistency
+		case *Scan:
+			c.consistency = &consistency
+		default:
+			return errors.New("'Consistency' option can only be used with Get or Scan")
+		}
+		return nil
+	}
+}
+
+// NeedCursorResult is used as a parameter for Scan request creation. Asks the
+// RegionServers to send, in the heartbeats they send while scanning rows that
+// don't match, the row they reached, which is then available from
+// Scan.Cursor.  Requires HBase 2.0 or later, ignored by earlier versions.
+func NeedCursorResult() func(Call) error {
+	return func(c Call) error {
+		scan, ok := c.(*Scan)
+		if !ok {
+			return errors.New("'NeedCursorResult' option can only be used with Scan")
+		}
+		scan.needCursor = true
+		return nil
+	}
+}
+
+// Reversed is used as a parameter for Scan request creation. Makes the scan
+// return rows in descending order, from its start row (inclusive) down to its
+// stop row (exclusive), so the start row must be greater than the stop row.
+func Reversed() func(Call) error {
+	return func(c Call) error {
+		scan, ok := c.(*Scan)
+		if !ok {
+			return errors.New("'Reversed' option can only be used with Scan")
+		}
+		scan.reversed = true
+		// The scan begins in the region of its start row.
+		scan.key = scan.startRow
+		return nil
+	}
+}
+
+// NumberOfRows is used as a parameter for Scan request creation. Sets the
+// number of rows fetched from the RegionServer per RPC, 20 by default.
+func NumberOfRows(rows uint32) func(Call) error {
+	return func(c Call) error {
+		scan, ok := c.(*Scan)
+		if !ok {
+			return errors.New("'NumberOfRows' option can only be used with Scan")
+		}
+		scan.numberOfRows = rows
+		return nil
+	}
+}
+
+// EffectiveUser is used as a parameter for request creation. Makes the request
+// on behalf of the given user, over connections opened for that user.  The
+// cluster must allow the user gohbase runs as to impersonate other users.
+func EffectiveUser(user string) func(Call) error {
+	return func(c Call) error {
+		c.SetUser(user)
+		return nil
+	}
+}
+
+// Priority is used as a parameter for request creation. Sets the priority of
+// the request, e.g. HighPriority for it to be served by the handlers
+// RegionServers reserve for urgent requests.
+func Priority(priority uint32) func(Call) error {
+	return func(c Call) error {
+		c.SetPriority(priority)
+		return nil
+	}
+}
+
+// Tenant is used as a parameter for request creation. Tags the request with
+// the given tenant, so that region clients scheduling RPCs fairly give it the
+// share of that tenant rather than that of its table.
+func Tenant(tenant string) func(Call) error {
+	return func(c Call) error {
+		c.SetTenant(tenant)
+		return nil
+	}
+}
@@ -27,6 +27,18 @@ type Get struct {
 	existsOnly bool
 
 	filters filter.Filter
+
+	// Maximum number of versions of each cell to return, 0 for the
+	// server's default (the latest version only).
+	maxVersions uint32
+
+	// Whether the blocks read should be cached by the RegionServer, nil
+	// for the server's default (true).
+	cacheBlocks *bool
+
+	// Consistency required of the read, nil for the server's default
+	// (strong).
+	consistency *pb.Consistency
 }
 
 // NewGet is called to construct a Get* object which is then passed as the sole parameter for a
@@ -111,6 +123,35 @@ func (g *Get) ExistsOnly() error {
 	return nil
 }
 
+// IsClosestBefore returns true if this Get returns the row right before the
+// given key when it doesn't exist.
+func (g *Get) IsClosestBefore() bool {
+	return g.closestBefore
+}
+
+// IsExistsOnly returns true if this Get only checks whether the row exists.
+func (g *Get) IsExistsOnly() bool {
+	return g.existsOnly
+}
+
+// GetMaxVersions returns the maximum number of versions of each cell to
+// return, or 0 if not set.
+func (g *Get) GetMaxVersions() uint32 {
+	return g.maxVersions
+}
+
+// GetCacheBlocks returns whether the blocks read should be cached, or nil if
+// not set.
+func (g *Get) GetCacheBlocks() *bool {
+	return g.cacheBlocks
+}
+
+// GetConsistency returns the consistency required of the read, or nil if not
+// set.
+func (g *Get) GetConsistency() *pb.Consistency {
+	return g.consistency
+}
+
 // Serialize serializes this RPC into a buffer.
 func (g *Get) Serialize() ([]byte, error) {
 	get := &pb.GetRequest{
@@ -126,6 +167,11 @@ func (g *Get) Serialize() ([]byte, error) {
 	if g.existsOnly {
 		get.Get.ExistenceOnly = proto.Bool(true)
 	}
+	if g.maxVersions > 0 {
+		get.Get.MaxVersions = proto.Uint32(g.maxVersions)
+	}
+	get.Get.CacheBlocks = g.cacheBlocks
+	get.Get.Consistency = g.consistency
 	if g.filters != nil {
 		pbFilter, err := g.filters.ConstructPBFilter()
 		if err != nil {
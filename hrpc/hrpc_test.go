@@ -7,10 +7,15 @@ package hrpc
 
 import (
 	"bytes"
+	"github.com/golang/protobuf/proto"
 	"github.com/tsuna/gohbase/filter"
+	"github.com/tsuna/gohbase/keyvalue"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/regioninfo"
 	"golang.org/x/net/context"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestNewGet(t *testing.T) {
@@ -101,6 +106,8 @@ func TestNewScan(t *testing.T) {
 func confirmScanAttributes(s *Scan, ctx context.Context, table, start, stop []byte, fam map[string][]string, filter1 filter.Filter) bool {
 	if s.GetContext() != ctx ||
 		bytes.Compare(s.Table(), table) != 0 ||
+		// The scan starts in the region of its start row.
+		bytes.Compare(s.Key(), start) != 0 ||
 		bytes.Compare(s.GetStartRow(), start) != 0 ||
 		bytes.Compare(s.GetStopRow(), stop) != 0 ||
 		!reflect.DeepEqual(s.GetFamilies(), fam) ||
@@ -109,3 +116,292 @@ func confirmScanAttributes(s *Scan, ctx context.Context, table, start, stop []by
 	}
 	return true
 }
+
+func TestMutateTimestamp(t *testing.T) {
+	put, _ := NewPutStr(context.Background(), "test", "45",
+		map[string]map[string][]byte{"cf": {"a": []byte("1")}})
+	put.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+	for _, ts := range []uint64{0, 1234567890123} {
+		if ts != 0 {
+			put.SetTimestamp(ts)
+		}
+		data, err := put.Serialize()
+		if err != nil {
+			t.Fatalf("Failed to serialize: %s", err)
+		}
+		req := &pb.MutateRequest{}
+		if err = proto.Unmarshal(data, req); err != nil {
+			t.Fatalf("Failed to unmarshal: %s", err)
+		}
+		if got := req.Mutation.GetTimestamp(); got != ts {
+			t.Errorf("Expected timestamp %d, got %d", ts, got)
+		}
+	}
+}
+
+func TestReadOptions(t *testing.T) {
+	ctx := context.Background()
+	reg := &regioninfo.Info{RegionName: []byte("test,,1")}
+	get, err := NewGetStr(ctx, "test", "45",
+		CacheBlocks(false), Consistency(pb.Consistency_TIMELINE))
+	if err != nil {
+		t.Fatalf("Failed to create Get: %s", err)
+	}
+	get.SetRegion(reg)
+	data, err := get.Serialize()
+	if err != nil {
+		t.Fatalf("Failed to serialize: %s", err)
+	}
+	getReq := &pb.GetRequest{}
+	if err = proto.Unmarshal(data, getReq); err != nil {
+		t.Fatalf("Failed to unmarshal: %s", err)
+	}
+	if getReq.Get.GetCacheBlocks() ||
+		getReq.Get.GetConsistency() != pb.Consistency_TIMELINE {
+		t.Errorf("Unexpected Get: %v", getReq.Get)
+	}
+
+	scan, err := NewScanStr(ctx, "test", CacheBlocks(false))
+	if err != nil {
+		t.Fatalf("Failed to create Scan: %s", err)
+	}
+	scan.SetRegion(reg)
+	data, err = scan.Serialize()
+	if err != nil {
+		t.Fatalf("Failed to serialize: %s", err)
+	}
+	scanReq := &pb.ScanRequest{}
+	if err = proto.Unmarshal(data, scanReq); err != nil {
+		t.Fatalf("Failed to unmarshal: %s", err)
+	}
+	if scanReq.Scan.GetCacheBlocks() || scanReq.Scan.Consistency != nil {
+		t.Errorf("Unexpected Scan: %v", scanReq.Scan)
+	}
+
+	put, _ := NewPutStr(ctx, "test", "45",
+		map[string]map[string][]byte{"cf": {"a": []byte("1")}})
+	if err = CacheBlocks(false)(put); err == nil {
+		t.Error("Expected an error setting CacheBlocks on a Mutate")
+	}
+	if err = Consistency(pb.Consistency_TIMELINE)(put); err == nil {
+		t.Error("Expected an error setting Consistency on a Mutate")
+	}
+}
+
+func TestScanHeartbeatsAndCursor(t *testing.T) {
+	scan, err := NewScanStr(context.Background(), "test", NeedCursorResult())
+	if err != nil {
+		t.Fatalf("Failed to create Scan: %s", err)
+	}
+	scan.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+	data, err := scan.Serialize()
+	if err != nil {
+		t.Fatalf("Failed to serialize: %s", err)
+	}
+	req := &pb.ScanRequest{}
+	if err = proto.Unmarshal(data, req); err != nil {
+		t.Fatalf("Failed to unmarshal: %s", err)
+	}
+	if !req.GetClientHandlesHeartbeats() || !req.Scan.GetNeedCursorResult() {
+		t.Errorf("Unexpected ScanRequest: %v", req)
+	}
+	get, _ := NewGetStr(context.Background(), "test", "45")
+	if err = NeedCursorResult()(get); err == nil {
+		t.Error("Expected an error setting NeedCursorResult on a Get")
+	}
+}
+
+func TestMutateDurability(t *testing.T) {
+	put, _ := NewPutStr(context.Background(), "test", "45",
+		map[string]map[string][]byte{"cf": {"a": []byte("1")}})
+	put.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+	put.SetDurability(pb.MutationProto_SKIP_WAL)
+	data, err := put.Serialize()
+	if err != nil {
+		t.Fatalf("Failed to serialize: %s", err)
+	}
+	req := &pb.MutateRequest{}
+	if err = proto.Unmarshal(data, req); err != nil {
+		t.Fatalf("Failed to unmarshal: %s", err)
+	}
+	if got := req.Mutation.GetDurability(); got != pb.MutationProto_SKIP_WAL {
+		t.Errorf("Expected durability SKIP_WAL, got %s", got)
+	}
+	data, _, err = put.SerializeCellBlock()
+	if err != nil {
+		t.Fatalf("Failed to serialize: %s", err)
+	}
+	if err = proto.Unmarshal(data, req); err != nil {
+		t.Fatalf("Failed to unmarshal: %s", err)
+	}
+	if got := req.Mutation.GetDurability(); got != pb.MutationProto_SKIP_WAL {
+		t.Errorf("Expected durability SKIP_WAL in cell block request, got %s", got)
+	}
+}
+
+func TestNewMulti(t *testing.T) {
+	ctx := context.Background()
+	if _, err := NewMulti(ctx, []byte("test"), nil); err == nil {
+		t.Error("Expected an error for a Multi without mutations")
+	}
+	put, _ := NewPutStr(ctx, "test", "a",
+		map[string]map[string][]byte{"cf": {"q": []byte("1")}})
+	del, _ := NewDelStr(ctx, "test", "b",
+		map[string]map[string][]byte{"cf": {"q": nil}})
+	cond, _ := NewPutStr(ctx, "test", "c",
+		map[string]map[string][]byte{"cf": {"q": []byte("1")}})
+	cond.SetCondition("cf", "q", nil)
+	if _, err := NewMulti(ctx, []byte("test"), []*Mutate{put, cond}); err == nil {
+		t.Error("Expected an error for a Multi with a conditional mutation")
+	}
+
+	multi, err := NewMulti(ctx, []byte("test"), []*Mutate{put, del})
+	if err != nil {
+		t.Fatalf("NewMulti failed: %s", err)
+	}
+	if string(multi.Key()) != "a" {
+		t.Errorf("Expected the key of the first mutation, got %q", multi.Key())
+	}
+	multi.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+	data, err := multi.Serialize()
+	if err != nil {
+		t.Fatalf("Failed to serialize: %s", err)
+	}
+	req := &pb.MultiRequest{}
+	if err = proto.Unmarshal(data, req); err != nil {
+		t.Fatalf("Failed to unmarshal: %s", err)
+	}
+	if len(req.RegionAction) != 1 ||
+		string(req.RegionAction[0].Region.Value) != "test,,1" {
+		t.Fatalf("Unexpected region actions: %v", req.RegionAction)
+	}
+	actions := req.RegionAction[0].Action
+	if len(actions) != 2 {
+		t.Fatalf("Expected 2 actions, got %v", actions)
+	}
+	for i, expected := range []struct {
+		row          string
+		mutationType pb.MutationProto_MutationType
+	}{{"a", pb.MutationProto_PUT}, {"b", pb.MutationProto_DELETE}} {
+		action := actions[i]
+		if action.GetIndex() != uint32(i) ||
+			string(action.Mutation.Row) != expected.row ||
+			action.Mutation.GetMutateType() != expected.mutationType {
+			t.Errorf("Unexpected action #%d: %v", i, action)
+		}
+	}
+}
+
+func TestMutateCellBlock(t *testing.T) {
+	ctx := context.Background()
+	del, _ := NewDelStr(ctx, "test", "row", map[string]map[string][]byte{
+		"cf1": {"b": nil, "a": nil},
+		"cf2": {},
+	})
+	del.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+	data, kvs, err := del.SerializeCellBlock()
+	if err != nil {
+		t.Fatalf("Failed to serialize: %s", err)
+	}
+	req := &pb.MutateRequest{}
+	if err = proto.Unmarshal(data, req); err != nil {
+		t.Fatalf("Failed to unmarshal: %s", err)
+	}
+	if len(req.Mutation.ColumnValue) != 0 || req.Mutation.GetAssociatedCellCount() != 3 {
+		t.Errorf("Expected 3 cells in the cell block, got %s", req.Mutation)
+	}
+	expected := []struct {
+		family, qualifier string
+		kvType            keyvalue.Type
+	}{
+		{"cf1", "a", keyvalue.DeleteColumn},
+		{"cf1", "b", keyvalue.DeleteColumn},
+		{"cf2", "", keyvalue.DeleteFamily},
+	}
+	if len(kvs) != len(expected) {
+		t.Fatalf("Expected %d cells, got %v", len(expected), kvs)
+	}
+	for i, kv := range kvs {
+		if string(kv.Row) != "row" || string(kv.Family) != expected[i].family ||
+			string(kv.Qualifier) != expected[i].qualifier ||
+			kv.Type != expected[i].kvType || kv.Timestamp != latestTimestamp {
+			t.Errorf("Unexpected cell #%d: %#v", i, kv)
+		}
+	}
+}
+
+func TestDeleteOneVersion(t *testing.T) {
+	ctx := context.Background()
+	put, _ := NewPutStr(ctx, "test", "row",
+		map[string]map[string][]byte{"cf": {"a": []byte("1")}})
+	put.SetTimestamp(42)
+	if err := put.DeleteOneVersion(); err == nil {
+		t.Error("Expected an error making a put delete one version")
+	}
+	del, _ := NewDelStr(ctx, "test", "row", map[string]map[string][]byte{"cf": {"a": nil}})
+	if err := del.DeleteOneVersion(); err == nil {
+		t.Error("Expected an error making a delete without timestamp delete one version")
+	}
+	del.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+	del.SetTimestamp(42)
+	if err := del.DeleteOneVersion(); err != nil {
+		t.Fatalf("DeleteOneVersion failed: %s", err)
+	}
+	data, err := del.Serialize()
+	if err != nil {
+		t.Fatalf("Failed to serialize: %s", err)
+	}
+	req := &pb.MutateRequest{}
+	if err = proto.Unmarshal(data, req); err != nil {
+		t.Fatalf("Failed to unmarshal: %s", err)
+	}
+	qv := req.Mutation.ColumnValue[0].QualifierValue[0]
+	if qv.GetDeleteType() != pb.MutationProto_DELETE_ONE_VERSION || qv.DeleteType == nil {
+		t.Errorf("Expected DELETE_ONE_VERSION, got %s", qv)
+	}
+	_, kvs, err := del.SerializeCellBlock()
+	if err != nil {
+		t.Fatalf("Failed to serialize: %s", err)
+	}
+	if len(kvs) != 1 || kvs[0].Type != keyvalue.Delete || kvs[0].Timestamp != 42 {
+		t.Errorf("Expected a Delete cell at 42, got %v", kvs)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	get, err := NewGetStr(context.Background(), "test", "45")
+	if err != nil {
+		t.Fatalf("Failed to create Get request: %s", err)
+	}
+	if md := get.Metadata(); md.Attempts != 0 || len(md.Servers) != 0 {
+		t.Errorf("Expected empty metadata on a new call, got %+v", md)
+	}
+	get.StartAttempt("rs1:16020")
+	get.EndQueueWait()
+	get.StartAttempt("rs1:16020")
+	get.AddRetryDelay(time.Second)
+	get.AddRetry()
+	get.StartAttempt("rs2:16020")
+	get.EndQueueWait()
+
+	md := get.Metadata()
+	if md.Attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", md.Attempts)
+	}
+	if expected := []string{"rs1:16020", "rs2:16020"}; !reflect.DeepEqual(md.Servers, expected) {
+		t.Errorf("Expected servers %v, got %v", expected, md.Servers)
+	}
+	if md.RetryDelay != time.Second {
+		t.Errorf("Expected a retry delay of 1s, got %s", md.RetryDelay)
+	}
+	if md.Retries != 1 {
+		t.Errorf("Expected 1 retry, got %d", md.Retries)
+	}
+
+	scan, _ := NewScanStr(context.Background(), "test")
+	scan.AddMetadata(md)
+	scan.AddMetadata(md)
+	if md = scan.Metadata(); md.Attempts != 6 || md.Retries != 2 || len(md.Servers) != 4 {
+		t.Errorf("Unexpected merged metadata %+v", md)
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package hrpc
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/filter"
+	"github.com/tsuna/gohbase/pb"
+	"golang.org/x/net/context"
+)
+
+// AdminCall is an RPC to a method of the Master's MasterService, or of a
+// RegionServer's AdminService that doesn't target a specific region.
+type AdminCall struct {
+	base
+
+	method   string
+	request  proto.Message
+	response func() proto.Message
+}
+
+func newAdminCall(ctx context.Context, method string, request proto.Message,
+	response func() proto.Message) *AdminCall {
+	return &AdminCall{
+		base: base{
+			ctx: ctx,
+		},
+		method:   method,
+		request:  request,
+		response: response,
+	}
+}
+
+// NewSetBalancer creates a new call turning the load balancer on or off.  It
+// waits for any balancing in progress to complete.
+func NewSetBalancer(ctx context.Context, on bool) *AdminCall {
+	return newAdminCall(ctx, "SetBalancerRunning", &pb.SetBalancerRunningRequest{
+		On:          &on,
+		Synchronous: proto.Bool(true),
+	}, func() proto.Message { return &pb.SetBalancerRunningResponse{} })
+}
+
+// NewIsBalancerEnabled creates a new call asking whether the load balancer is
+// on.
+func NewIsBalancerEnabled(ctx context.Context) *AdminCall {
+	return newAdminCall(ctx, "IsBalancerEnabled", &pb.IsBalancerEnabledRequest{},
+		func() proto.Message { return &pb.IsBalancerEnabledResponse{} })
+}
+
+// NewSetNormalizer creates a new call turning the region normalizer on or off.
+func NewSetNormalizer(ctx context.Context, on bool) *AdminCall {
+	return newAdminCall(ctx, "SetNormalizerRunning",
+		&pb.SetNormalizerRunningRequest{On: &on},
+		func() proto.Message { return &pb.SetNormalizerRunningResponse{} })
+}
+
+// NewIsNormalizerEnabled creates a new call asking whether the region
+// normalizer is on.
+func NewIsNormalizerEnabled(ctx context.Context) *AdminCall {
+	return newAdminCall(ctx, "IsNormalizerEnabled", &pb.IsNormalizerEnabledRequest{},
+		func() proto.Message { return &pb.IsNormalizerEnabledResponse{} })
+}
+
+// NewNormalize creates a new call running the region normalizer.
+func NewNormalize(ctx context.Context) *AdminCall {
+	return newAdminCall(ctx, "Normalize", &pb.NormalizeRequest{},
+		func() proto.Message { return &pb.NormalizeResponse{} })
+}
+
+// NewGetTableDescriptors creates a new call asking for the schema of the
+// given tables.  Tables that don't exist are left out of the response.
+func NewGetTableDescriptors(ctx context.Context, tables ...string) *AdminCall {
+	names := make([]*pb.TableName, len(tables))
+	for i, table := range tables {
+		names[i] = ParseTableName(table)
+	}
+	return newAdminCall(ctx, "GetTableDescriptors",
+		&pb.GetTableDescriptorsRequest{TableNames: names},
+		func() proto.Message { return &pb.GetTableDescriptorsResponse{} })
+}
+
+// ParseTableName returns the given "namespace:qualifier" table name, the
+// namespace being "default" if omitted.
+func ParseTableName(table string) *pb.TableName {
+	namespace, qualifier := "default", table
+	if colon := strings.IndexByte(table, ':'); colon >= 0 {
+		namespace, qualifier = table[:colon], table[colon+1:]
+	}
+	return &pb.TableName{Namespace: []byte(namespace), Qualifier: []byte(qualifier)}
+}
+
+// NewExecMasterService creates a new call invoking the given method of a
+// coprocessor service loaded by the Master, e.g. the AccessControlService.
+// The response of the method is serialized in the value of the
+// CoprocessorServiceResponse.
+func NewExecMasterService(ctx context.Context, service, method string,
+	request proto.Message) (*AdminCall, error) {
+	data, err := proto.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	return newAdminCall(ctx, "ExecMasterService", &pb.CoprocessorServiceRequest{
+		// The Master ignores the region, but it's a required field.
+		Region: &pb.RegionSpecifier{
+			Type:  pb.RegionSpecifier_REGION_NAME.Enum(),
+			Value: []byte{},
+		},
+		Call: &pb.CoprocessorServiceCall{
+			Row:         []byte{},
+			ServiceName: &service,
+			MethodName:  &method,
+			Request:     data,
+		},
+	}, func() proto.Message { return &pb.CoprocessorServiceResponse{} }), nil
+}
+
+// NewGetClusterStatus creates a new call asking for the status of the
+// cluster: its live and dead RegionServers, regions in transition, etc.
+func NewGetClusterStatus(ctx context.Context) *AdminCall {
+	return newAdminCall(ctx, "GetClusterStatus", &pb.GetClusterStatusRequest{},
+		func() proto.Message { return &pb.GetClusterStatusResponse{} })
+}
+
+// NewDisableTable creates a new call disabling the given table.  The Master
+// disables it in the background, in the procedure whose ID is returned.
+func NewDisableTable(ctx context.Context, table string) *AdminCall {
+	return newAdminCall(ctx, "DisableTable",
+		&pb.DisableTableRequest{TableName: ParseTableName(table)},
+		func() proto.Message { return &pb.DisableTableResponse{} })
+}
+
+// NewDeleteTable creates a new call deleting the given table, which must be
+// disabled.  The Master deletes it in the background, in the procedure whose
+// ID is returned.
+func NewDeleteTable(ctx context.Context, table string) *AdminCall {
+	return newAdminCall(ctx, "DeleteTable",
+		&pb.DeleteTableRequest{TableName: ParseTableName(table)},
+		func() proto.Message { return &pb.DeleteTableResponse{} })
+}
+
+// NewGetProcedureResult creates a new call asking for the state of the
+// procedure with the given ID.
+func NewGetProcedureResult(ctx context.Context, procID uint64) *AdminCall {
+	return newAdminCall(ctx, "getProcedureResult",
+		&pb.GetProcedureResultRequest{ProcId: &procID},
+		func() proto.Message { return &pb.GetProcedureResultResponse{} })
+}
+
+// NewSnapshot creates a new call taking a snapshot with the given name of the
+// given table, after flushing it.  The snapshot is taken in the background,
+// see NewIsSnapshotDone.
+func NewSnapshot(ctx context.Context, name, table string) *AdminCall {
+	return newAdminCall(ctx, "Snapshot", &pb.SnapshotRequest{
+		Snapshot: &pb.SnapshotDescription{
+			Name:  &name,
+			Table: &table,
+			Type:  pb.SnapshotDescription_FLUSH.Enum(),
+		},
+	}, func() proto.Message { return &pb.SnapshotResponse{} })
+}
+
+// NewIsSnapshotDone creates a new call asking whether the given snapshot of
+// the given table was taken.
+func NewIsSnapshotDone(ctx context.Context, name, table string) *AdminCall {
+	return newAdminCall(ctx, "IsSnapshotDone", &pb.IsSnapshotDoneRequest{
+		Snapshot: &pb.SnapshotDescription{Name: &name, Table: &table},
+	}, func() proto.Message { return &pb.IsSnapshotDoneResponse{} })
+}
+
+// NewCloneSnapshot creates a new call creating the given table, which must not
+// exist, from the snapshot with the given name.  The table is created in the
+// background, see NewIsRestoreSnapshotDone.
+func NewCloneSnapshot(ctx context.Context, name, table string) *AdminCall {
+	// The Master clones the snapshot when restoring it to a table that
+	// doesn't exist.
+	return newAdminCall(ctx, "RestoreSnapshot", &pb.RestoreSnapshotRequest{
+		Snapshot: &pb.SnapshotDescription{Name: &name, Table: &table},
+	}, func() proto.Message { return &pb.RestoreSnapshotResponse{} })
+}
+
+// NewIsRestoreSnapshotDone creates a new call asking whether the given
+// snapshot was cloned or restored to the given table.
+func NewIsRestoreSnapshotDone(ctx context.Context, name, table string) *AdminCall {
+	return newAdminCall(ctx, "IsRestoreSnapshotDone", &pb.IsRestoreSnapshotDoneRequest{
+		Snapshot: &pb.SnapshotDescription{Name: &name, Table: &table},
+	}, func() proto.Message { return &pb.IsRestoreSnapshotDoneResponse{} })
+}
+
+// NewDeleteSnapshot creates a new call deleting the snapshot with the given
+// name.
+func NewDeleteSnapshot(ctx context.Context, name string) *AdminCall {
+	return newAdminCall(ctx, "DeleteSnapshot", &pb.DeleteSnapshotRequest{
+		Snapshot: &pb.SnapshotDescription{Name: &name},
+	}, func() proto.Message { return &pb.DeleteSnapshotResponse{} })
+}
+
+// NewClearDeadServers creates a new call asking the Master to forget the
+// given dead RegionServers, once it's done processing their failure.
+func NewClearDeadServers(ctx context.Context, servers []*pb.ServerName) *AdminCall {
+	return newAdminCall(ctx, "ClearDeadServers",
+		&pb.ClearDeadServersRequest{ServerName: servers},
+		func() proto.Message { return &pb.ClearDeadServersResponse{} })
+}
+
+// GetName returns the name of this RPC call.
+func (m *AdminCall) GetName() string {
+	return m.method
+}
+
+// Serialize converts this call into a protobuf message suitable for sending
+// to the Master.
+func (m *AdminCall) Serialize() ([]byte, error) {
+	return proto.Marshal(m.request)
+}
+
+// NewResponse creates an empty protobuf message to read the response of this
+// RPC.
+func (m *AdminCall) NewResponse() proto.Message {
+	return m.response()
+}
+
+// SetFilter always returns an error when used on AdminCall objects. Do not
+// use.  Exists solely so AdminCall can implement the Call interface.
+func (m *AdminCall) SetFilter(ft filter.Filter) error {
+	return errors.New("Cannot set filter on admin operation.")
+}
+
+// SetFamilies always returns an error when used on AdminCall objects. Do not
+// use.  Exists solely so AdminCall can implement the Call interface.
+func (m *AdminCall) SetFamilies(fam map[string][]string) error {
+	return errors.New("Cannot set families on admin operation.")
+}
@@ -0,0 +1,119 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package hrpc
+
+import (
+	"errors"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/filter"
+	"github.com/tsuna/gohbase/keyvalue"
+	"github.com/tsuna/gohbase/pb"
+	"golang.org/x/net/context"
+)
+
+// Multi sends several mutations to a region in a single RPC.  Each of them
+// succeeds or fails on its own, the results being reported per action in the
+// MultiResponse, in which the index of each action is its index in Mutates.
+type Multi struct {
+	base
+
+	mutates []*Mutate
+}
+
+// NewMulti creates a new Multi RPC applying the given mutations, which must
+// all be in the same region of the given table.  The region is located using
+// the key of the first mutation.  Conditional mutations can't be part of a
+// Multi.
+func NewMulti(ctx context.Context, table []byte, mutates []*Mutate) (*Multi, error) {
+	if len(mutates) == 0 {
+		return nil, errors.New("No mutations to send.")
+	}
+	for _, m := range mutates {
+		if m.IsConditional() {
+			return nil, errors.New("Conditional mutations can't be part of a Multi.")
+		}
+	}
+	return &Multi{
+		base: base{
+			table: table,
+			key:   mutates[0].Key(),
+			ctx:   ctx,
+		},
+		mutates: mutates,
+	}, nil
+}
+
+// Mutates returns the mutations sent by this RPC.
+func (m *Multi) Mutates() []*Mutate {
+	return m.mutates
+}
+
+// GetName returns the name of this RPC call.
+func (m *Multi) GetName() string {
+	return "Multi"
+}
+
+// Serialize converts this RPC into a protobuf message suitable for sending to
+// an HBase server.
+func (m *Multi) Serialize() ([]byte, error) {
+	actions := make([]*pb.Action, len(m.mutates))
+	for i, mutate := range m.mutates {
+		actions[i] = &pb.Action{
+			Index:    proto.Uint32(uint32(i)),
+			Mutation: mutate.toProto(),
+		}
+	}
+	multi := &pb.MultiRequest{
+		RegionAction: []*pb.RegionAction{&pb.RegionAction{
+			Region: m.regionSpecifier(),
+			Action: actions,
+		}},
+	}
+	return proto.Marshal(multi)
+}
+
+// SerializeCellBlock is like Serialize, except that the cells of the
+// mutations aren't part of the protobuf message but returned, in the order of
+// the mutations, to be sent in a cell block.
+func (m *Multi) SerializeCellBlock() ([]byte, []*keyvalue.KeyValue, error) {
+	actions := make([]*pb.Action, len(m.mutates))
+	var kvs []*keyvalue.KeyValue
+	for i, mutate := range m.mutates {
+		mutation, cells := mutate.toCellBlockProto()
+		actions[i] = &pb.Action{
+			Index:    proto.Uint32(uint32(i)),
+			Mutation: mutation,
+		}
+		kvs = append(kvs, cells...)
+	}
+	multi := &pb.MultiRequest{
+		RegionAction: []*pb.RegionAction{&pb.RegionAction{
+			Region: m.regionSpecifier(),
+			Action: actions,
+		}},
+	}
+	data, err := proto.Marshal(multi)
+	return data, kvs, err
+}
+
+// NewResponse creates an empty protobuf message to read the response of this
+// RPC.
+func (m *Multi) NewResponse() proto.Message {
+	return &pb.MultiResponse{}
+}
+
+// SetFilter always returns an error when used on Multi objects. Do not use.
+// Exists solely so Multi can implement the Call interface.
+func (m *Multi) SetFilter(ft filter.Filter) error {
+	return errors.New("Cannot set filter on multi operation.")
+}
+
+// SetFamilies always returns an error when used on Multi objects. Do not use.
+// Exists solely so Multi can implement the Call interface.
+func (m *Multi) SetFamilies(fam map[string][]string) error {
+	return errors.New("Cannot set families on multi operation.")
+}
@@ -7,12 +7,20 @@ package hrpc
 
 import (
 	"errors"
+	"math"
+	"sort"
+
 	"github.com/golang/protobuf/proto"
 	"github.com/tsuna/gohbase/filter"
+	"github.com/tsuna/gohbase/keyvalue"
 	"github.com/tsuna/gohbase/pb"
 	"golang.org/x/net/context"
 )
 
+// Timestamp of the cells sent in cell blocks without a timestamp, which the
+// RegionServer replaces with its current time (HConstants.LATEST_TIMESTAMP).
+const latestTimestamp = math.MaxInt64
+
 // Mutate represents a mutation on HBase.
 type Mutate struct {
 	base
@@ -22,6 +30,20 @@ type Mutate struct {
 
 	//values is a map of column families to a map of column qualifiers to bytes
 	values map[string]map[string][]byte
+
+	// Timestamp of the mutation in milliseconds since the epoch, or nil to
+	// let the RegionServer use its current time.
+	timestamp *uint64
+
+	// Condition the mutation is subject to, nil if unconditional.
+	condition *pb.Condition
+
+	// Durability of the mutation, nil for the table's default.
+	durability *pb.MutationProto_Durability
+
+	// Whether a delete only removes the version of the cells at its
+	// timestamp, rather than all the versions up to it.
+	oneVersion bool
 }
 
 // baseMutate will return a Mutate struct without the mutationType filled in.
@@ -68,14 +90,155 @@ func NewIncStr(ctx context.Context, table, key string, values map[string]map[str
 	return m, nil
 }
 
+// SetTimestamp sets the timestamp of the cells written by this mutation, in
+// milliseconds since the epoch.  By default the RegionServer uses its current
+// time.
+func (m *Mutate) SetTimestamp(ts uint64) {
+	m.timestamp = &ts
+}
+
+// SetDurability sets how the mutation is persisted to the WAL before being
+// acknowledged.  By default the durability configured on the table is used.
+func (m *Mutate) SetDurability(d pb.MutationProto_Durability) {
+	m.durability = &d
+}
+
+// GetDurability returns the durability of this mutation, or nil if not set.
+func (m *Mutate) GetDurability() *pb.MutationProto_Durability {
+	return m.durability
+}
+
+// MutationType returns whether this mutation is a put, a delete, an append or
+// an increment.
+func (m *Mutate) MutationType() pb.MutationProto_MutationType {
+	return m.mutationType
+}
+
+// DeleteOneVersion makes this delete only remove the version of each of its
+// cells written at the timestamp set with SetTimestamp, rather than all the
+// versions up to that timestamp.  Deletes of whole families are unaffected.
+func (m *Mutate) DeleteOneVersion() error {
+	if m.mutationType != pb.MutationProto_DELETE || m.timestamp == nil {
+		return errors.New("Only deletes with a timestamp can delete a single version.")
+	}
+	m.oneVersion = true
+	return nil
+}
+
+// SetCondition makes this put or delete conditional: it's only applied if the
+// given column currently has the expected value, or doesn't exist if expected
+// is nil.  Whether it was applied is reported in the Processed field of the
+// response.
+func (m *Mutate) SetCondition(family, qualifier string, expected []byte) error {
+	if m.mutationType != pb.MutationProto_PUT && m.mutationType != pb.MutationProto_DELETE {
+		return errors.New("Conditions can only be set on put and delete operations.")
+	}
+	var comparator filter.Comparator
+	if expected == nil {
+		comparator = filter.NewNullComparator()
+	} else {
+		comparator = filter.NewBinaryComparator(filter.NewByteArrayComparable(expected))
+	}
+	pbComparator, err := comparator.ConstructPBComparator()
+	if err != nil {
+		return err
+	}
+	m.condition = &pb.Condition{
+		Row:         m.key,
+		Family:      []byte(family),
+		Qualifier:   []byte(qualifier),
+		CompareType: pb.CompareType_EQUAL.Enum(),
+		Comparator:  pbComparator,
+	}
+	return nil
+}
+
 // GetName returns the name of this RPC call.
 func (m *Mutate) GetName() string {
 	return "Mutate"
 }
 
+// IsConditional returns whether a condition was set on this mutation.
+func (m *Mutate) IsConditional() bool {
+	return m.condition != nil
+}
+
 // Serialize converts this mutate object into a protobuf message suitable for
 // sending to an HBase server
 func (m *Mutate) Serialize() ([]byte, error) {
+	mutate := &pb.MutateRequest{
+		Region:    m.regionSpecifier(),
+		Mutation:  m.toProto(),
+		Condition: m.condition,
+	}
+	return proto.Marshal(mutate)
+}
+
+// SerializeCellBlock is like Serialize, except that the cells of the mutation
+// aren't part of the protobuf message but returned, to be sent in a cell
+// block.
+func (m *Mutate) SerializeCellBlock() ([]byte, []*keyvalue.KeyValue, error) {
+	mutation, kvs := m.toCellBlockProto()
+	mutate := &pb.MutateRequest{
+		Region:    m.regionSpecifier(),
+		Mutation:  mutation,
+		Condition: m.condition,
+	}
+	data, err := proto.Marshal(mutate)
+	return data, kvs, err
+}
+
+// Converts this mutation to a protobuf MutationProto whose cells are
+// returned as KeyValues, sorted.
+func (m *Mutate) toCellBlockProto() (*pb.MutationProto, []*keyvalue.KeyValue) {
+	ts := uint64(latestTimestamp)
+	if m.timestamp != nil {
+		ts = *m.timestamp
+	}
+	families := make([]string, 0, len(m.values))
+	for family := range m.values {
+		families = append(families, family)
+	}
+	sort.Strings(families)
+	var kvs []*keyvalue.KeyValue
+	for _, family := range families {
+		values := m.values[family]
+		if len(values) == 0 && m.mutationType == pb.MutationProto_DELETE {
+			kvs = append(kvs, &keyvalue.KeyValue{Row: m.key, Family: []byte(family),
+				Timestamp: ts, Type: keyvalue.DeleteFamily})
+			continue
+		}
+		qualifiers := make([]string, 0, len(values))
+		for qualifier := range values {
+			qualifiers = append(qualifiers, qualifier)
+		}
+		sort.Strings(qualifiers)
+		for _, qualifier := range qualifiers {
+			kv := &keyvalue.KeyValue{Row: m.key, Family: []byte(family),
+				Qualifier: []byte(qualifier), Timestamp: ts, Type: keyvalue.Put}
+			if m.oneVersion {
+				// Like DELETE_ONE_VERSION in protobuf cells.
+				kv.Type = keyvalue.Delete
+			} else if m.mutationType == pb.MutationProto_DELETE {
+				// Like DELETE_MULTIPLE_VERSIONS in protobuf cells.
+				kv.Type = keyvalue.DeleteColumn
+			} else {
+				kv.Value = values[qualifier]
+			}
+			kvs = append(kvs, kv)
+		}
+	}
+	return &pb.MutationProto{
+		Row:                 m.key,
+		MutateType:          &m.mutationType,
+		Timestamp:           m.timestamp,
+		Durability:          m.durability,
+		AssociatedCellCount: proto.Int32(int32(len(kvs))),
+	}, kvs
+}
+
+// Converts this mutation to a protobuf MutationProto.
+func (m *Mutate) toProto() *pb.MutationProto {
 	// We need to convert everything in the values field
 	// to a protobuf ColumnValue
 	bytevalues := make([]*pb.MutationProto_ColumnValue, len(m.values))
@@ -90,7 +253,10 @@ func (m *Mutate) Serialize() ([]byte, error) {
 				Qualifier: []byte(k1),
 				Value:     v1,
 			}
-			if m.mutationType == pb.MutationProto_DELETE {
+			if m.oneVersion {
+				tmp := pb.MutationProto_DELETE_ONE_VERSION
+				qualvals[j].DeleteType = &tmp
+			} else if m.mutationType == pb.MutationProto_DELETE {
 				tmp := pb.MutationProto_DELETE_MULTIPLE_VERSIONS
 				qualvals[j].DeleteType = &tmp
 			}
@@ -102,15 +268,13 @@ func (m *Mutate) Serialize() ([]byte, error) {
 		}
 		i++
 	}
-	mutate := &pb.MutateRequest{
-		Region: m.regionSpecifier(),
-		Mutation: &pb.MutationProto{
-			Row:         m.key,
-			MutateType:  &m.mutationType,
-			ColumnValue: bytevalues,
-		},
+	return &pb.MutationProto{
+		Row:         m.key,
+		MutateType:  &m.mutationType,
+		ColumnValue: bytevalues,
+		Timestamp:   m.timestamp,
+		Durability:  m.durability,
 	}
-	return proto.Marshal(mutate)
 }
 
 // NewResponse creates an empty protobuf message to read the response of this
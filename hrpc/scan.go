@@ -6,12 +6,17 @@
 package hrpc
 
 import (
+	"sync"
+
 	"github.com/golang/protobuf/proto"
 	"github.com/tsuna/gohbase/filter"
 	"github.com/tsuna/gohbase/pb"
 	"golang.org/x/net/context"
 )
 
+// Number of rows fetched per RPC unless set with the NumberOfRows option.
+const defaultNumberOfRows = 20
+
 // Scan represents a scanner on an HBase table.
 type Scan struct {
 	base
@@ -21,12 +26,44 @@ type Scan struct {
 
 	closeScanner bool
 
+	// Whether this request only renews the lease of the scanner, without
+	// fetching rows.
+	renew bool
+
 	startRow []byte
 	stopRow  []byte
 
 	scannerID *uint64
 
 	filters filter.Filter
+
+	// Maximum number of versions of each cell to return, 0 for the
+	// server's default (the latest version only).
+	maxVersions uint32
+
+	// Whether the blocks read should be cached by the RegionServer, nil
+	// for the server's default (true).
+	cacheBlocks *bool
+
+	// Consistency required of the reads, nil for the server's default
+	// (strong).
+	consistency *pb.Consistency
+
+	// Whether the RegionServer should send the row it reached in its
+	// heartbeats.
+	needCursor bool
+
+	// Whether rows are returned in descending order, from startRow down to
+	// stopRow (exclusive).
+	reversed bool
+
+	// Number of rows to fetch per RPC, 0 for the default.
+	numberOfRows uint32
+
+	// cursorLock protects cursor, which is updated as the scan progresses
+	// and may be read concurrently.
+	cursorLock sync.Mutex
+	cursor     []byte
 }
 
 // NewScan is called to construct a Scan* object which is then passed as the sole parameter for a
@@ -62,7 +99,7 @@ func NewScanRange(ctx context.Context, table, startRow, stopRow []byte,
 	scan := &Scan{
 		base: base{
 			table: table,
-			key:   stopRow,
+			key:   startRow,
 			ctx:   ctx,
 		},
 		closeScanner: false,
@@ -115,6 +152,21 @@ func NewCloseFromID(ctx context.Context, table []byte, scannerID uint64, startRo
 	}
 }
 
+// NewRenewFromID creates a new Scan request that will renew the lease of the
+// scanner with the given ID without returning any result, to keep it open
+// while no results are being requested.  Requires HBase 1.3 or later.
+func NewRenewFromID(ctx context.Context, table []byte, scannerID uint64, startRow []byte) *Scan {
+	return &Scan{
+		base: base{
+			table: []byte(table),
+			key:   []byte(startRow),
+			ctx:   ctx,
+		},
+		scannerID: &scannerID,
+		renew:     true,
+	}
+}
+
 // GetName returns the name of this RPC call.
 func (s *Scan) GetName() string {
 	return "Scan"
@@ -140,18 +192,87 @@ func (s *Scan) GetRegionStop() []byte {
 	return s.region.StopKey
 }
 
+// GetRegionStart returns the start key of the region currently being scanned.
+func (s *Scan) GetRegionStart() []byte {
+	return s.region.StartKey
+}
+
+// IsReversed returns whether this scan returns rows in descending order.
+func (s *Scan) IsReversed() bool {
+	return s.reversed
+}
+
+// GetNumberOfRows returns the number of rows fetched per RPC, or 0 if not
+// set.
+func (s *Scan) GetNumberOfRows() uint32 {
+	return s.numberOfRows
+}
+
 // GetFilter returns the set filter.
 func (s *Scan) GetFilter() filter.Filter {
 	return s.filters
 }
 
+// GetMaxVersions returns the maximum number of versions of each cell to
+// return, or 0 if not set.
+func (s *Scan) GetMaxVersions() uint32 {
+	return s.maxVersions
+}
+
+// GetCacheBlocks returns whether the blocks read should be cached, or nil if
+// not set.
+func (s *Scan) GetCacheBlocks() *bool {
+	return s.cacheBlocks
+}
+
+// GetConsistency returns the consistency required of the reads, or nil if not
+// set.
+func (s *Scan) GetConsistency() *pb.Consistency {
+	return s.consistency
+}
+
+// IsNeedCursorResult returns whether the RegionServer is asked to send the row
+// it reached in its heartbeats.
+func (s *Scan) IsNeedCursorResult() bool {
+	return s.needCursor
+}
+
+// Cursor returns the row this scan last reached, for progress reporting: the
+// row of the last result returned or, if the RegionServer sent a heartbeat
+// with a cursor since (see NeedCursorResult), the row it had scanned up to.
+// It's nil until the scan reached a row.
+func (s *Scan) Cursor() []byte {
+	s.cursorLock.Lock()
+	defer s.cursorLock.Unlock()
+	return s.cursor
+}
+
+// SetCursor records the row this scan reached.
+func (s *Scan) SetCursor(row []byte) {
+	s.cursorLock.Lock()
+	s.cursor = row
+	s.cursorLock.Unlock()
+}
+
 // Serialize will convert this Scan into a serialized protobuf message ready
 // to be sent to an HBase node.
 func (s *Scan) Serialize() ([]byte, error) {
 	scan := &pb.ScanRequest{
 		Region:       s.regionSpecifier(),
 		CloseScanner: &s.closeScanner,
-		NumberOfRows: proto.Uint32(20), //TODO: make this configurable
+		NumberOfRows: proto.Uint32(defaultNumberOfRows),
+		// Rather than scanning until a row matches, which can take longer
+		// than the RPC timeout with selective filters, the RegionServer
+		// may send responses without results to show it's still making
+		// progress.
+		ClientHandlesHeartbeats: proto.Bool(true),
+	}
+	if s.numberOfRows > 0 {
+		scan.NumberOfRows = proto.Uint32(s.numberOfRows)
+	}
+	if s.renew {
+		scan.Renew = proto.Bool(true)
+		scan.NumberOfRows = proto.Uint32(0)
 	}
 	if s.scannerID == nil {
 		scan.Scan = &pb.Scan{
@@ -159,6 +280,17 @@ func (s *Scan) Serialize() ([]byte, error) {
 			StartRow: s.startRow,
 			StopRow:  s.stopRow,
 		}
+		if s.maxVersions > 0 {
+			scan.Scan.MaxVersions = proto.Uint32(s.maxVersions)
+		}
+		scan.Scan.CacheBlocks = s.cacheBlocks
+		scan.Scan.Consistency = s.consistency
+		if s.needCursor {
+			scan.Scan.NeedCursorResult = proto.Bool(true)
+		}
+		if s.reversed {
+			scan.Scan.Reversed = proto.Bool(true)
+		}
 		if s.filters != nil {
 			pbFilter, err := s.filters.ConstructPBFilter()
 			if err != nil {
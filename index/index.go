@@ -0,0 +1,327 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+// Package index maintains secondary indexes of HBase tables.
+//
+// An index is a separate table with a row for every row of the data table,
+// keyed by the value of the indexed column followed by the key of the data
+// row.  HBase can't update both tables atomically, so the index is written
+// before the data and cleaned up after it: a failure in between leaves a stale
+// index row behind, never a data row missing from the index.  Lookups check
+// every index row against the data row it points to and ignore stale ones,
+// and Repair removes them and restores missing index rows.
+package index
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/tsuna/gohbase"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"golang.org/x/net/context"
+)
+
+// Family and qualifier of the cell of index rows holding the key of the data
+// row.  The index table must have that family.
+const (
+	Family    = "i"
+	qualifier = "k"
+)
+
+// Index is a secondary index of a column of a table.
+type Index struct {
+	client gohbase.Client
+
+	// Table being indexed and column whose values are indexed.
+	table     string
+	family    string
+	qualifier string
+
+	// Table holding the index rows.
+	indexTable string
+}
+
+// New returns the index of the given column of the given table, maintained in
+// indexTable.
+func New(client gohbase.Client, table, family, qualifier, indexTable string) *Index {
+	return &Index{
+		client:     client,
+		table:      table,
+		family:     family,
+		qualifier:  qualifier,
+		indexTable: indexTable,
+	}
+}
+
+// Returns the prefix of the keys of all the index rows for the given value.
+// The value is prefixed with its length, so that no value is a prefix of
+// another one.
+func valuePrefix(value []byte) []byte {
+	prefix := make([]byte, 4, 4+len(value))
+	binary.BigEndian.PutUint32(prefix, uint32(len(value)))
+	return append(prefix, value...)
+}
+
+// Returns the key of the index row for the given value of the given data row.
+func indexKey(value, key []byte) []byte {
+	return append(valuePrefix(value), key...)
+}
+
+// Returns the smallest key greater than all the keys starting with prefix.
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i]++; end[i] != 0 {
+			return end[:i+1]
+		}
+	}
+	return nil // All 0xFF, scan to the end of the table.
+}
+
+// Returns the value of the indexed column in the given row, or nil.
+func (idx *Index) valueOf(row *pb.Result) []byte {
+	if row == nil {
+		return nil
+	}
+	for _, cell := range row.Cell {
+		if string(cell.Family) == idx.family && string(cell.Qualifier) == idx.qualifier {
+			return cell.Value
+		}
+	}
+	return nil
+}
+
+// Fetches the current value of the indexed column in the given data row.
+func (idx *Index) currentValue(ctx context.Context, key string) ([]byte, error) {
+	get, err := hrpc.NewGetStr(ctx, idx.table, key,
+		hrpc.Families(map[string][]string{idx.family: {idx.qualifier}}))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := idx.client.Get(get)
+	if err != nil {
+		return nil, err
+	}
+	return idx.valueOf(resp.Result), nil
+}
+
+func (idx *Index) putIndexRow(ctx context.Context, value, key []byte) error {
+	put, err := hrpc.NewPutStr(ctx, idx.indexTable, string(indexKey(value, key)),
+		map[string]map[string][]byte{Family: {qualifier: key}})
+	if err != nil {
+		return err
+	}
+	_, err = idx.client.Put(put)
+	return err
+}
+
+func (idx *Index) deleteIndexRow(ctx context.Context, value, key []byte) error {
+	del, err := hrpc.NewDelStr(ctx, idx.indexTable, string(indexKey(value, key)), nil)
+	if err != nil {
+		return err
+	}
+	_, err = idx.client.Delete(del)
+	return err
+}
+
+// Put writes the given values in the given row of the data table, and updates
+// the index if they include the indexed column.
+func (idx *Index) Put(ctx context.Context, key string,
+	values map[string]map[string][]byte) error {
+	value, indexed := values[idx.family][idx.qualifier]
+	var old []byte
+	if indexed {
+		var err error
+		if old, err = idx.currentValue(ctx, key); err != nil {
+			return err
+		}
+		if err = idx.putIndexRow(ctx, value, []byte(key)); err != nil {
+			return err
+		}
+	}
+	put, err := hrpc.NewPutStr(ctx, idx.table, key, values)
+	if err != nil {
+		return err
+	}
+	if _, err = idx.client.Put(put); err != nil {
+		return err
+	}
+	if old != nil && !bytes.Equal(old, value) {
+		return idx.deleteIndexRow(ctx, old, []byte(key))
+	}
+	return nil
+}
+
+// Delete deletes the given row of the data table along with its index row.
+func (idx *Index) Delete(ctx context.Context, key string) error {
+	old, err := idx.currentValue(ctx, key)
+	if err != nil {
+		return err
+	}
+	del, err := hrpc.NewDelStr(ctx, idx.table, key, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = idx.client.Delete(del); err != nil {
+		return err
+	}
+	if old != nil {
+		return idx.deleteIndexRow(ctx, old, []byte(key))
+	}
+	return nil
+}
+
+// Lookup returns the data rows in which the indexed column has the given
+// value.  Only the given families are returned, or all of them if families is
+// nil.
+func (idx *Index) Lookup(ctx context.Context, value []byte,
+	families map[string][]string) ([]*pb.Result, error) {
+	prefix := valuePrefix(value)
+	scan, err := hrpc.NewScanRange(ctx, []byte(idx.indexTable), prefix, prefixEnd(prefix))
+	if err != nil {
+		return nil, err
+	}
+	indexRows, err := idx.client.Scan(scan)
+	if err != nil {
+		return nil, err
+	}
+	// The indexed column is needed to tell stale index rows apart.
+	if families != nil {
+		if qualifiers, ok := families[idx.family]; !ok || qualifiers != nil {
+			withIndexed := make(map[string][]string, len(families)+1)
+			for family, qualifiers := range families {
+				withIndexed[family] = qualifiers
+			}
+			withIndexed[idx.family] = append(qualifiers[:len(qualifiers):len(qualifiers)],
+				idx.qualifier)
+			families = withIndexed
+		}
+	}
+	var results []*pb.Result
+	for _, indexRow := range indexRows {
+		key := idx.dataKey(indexRow)
+		if key == nil {
+			continue
+		}
+		var options []func(hrpc.Call) error
+		if families != nil {
+			options = append(options, hrpc.Families(families))
+		}
+		get, err := hrpc.NewGet(ctx, []byte(idx.table), key, options...)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := idx.client.Get(get)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(idx.valueOf(resp.Result), value) {
+			results = append(results, resp.Result)
+		}
+	}
+	return results, nil
+}
+
+// Returns the key of the data row an index row points to, or nil.
+func (idx *Index) dataKey(indexRow *pb.Result) []byte {
+	for _, cell := range indexRow.Cell {
+		if string(cell.Family) == Family && string(cell.Qualifier) == qualifier {
+			return cell.Value
+		}
+	}
+	return nil
+}
+
+// RepairStats reports what Repair fixed.
+type RepairStats struct {
+	// Number of index rows pointing to data rows that don't have the
+	// indexed value anymore, which were deleted.
+	StaleRows int
+	// Number of data rows that weren't indexed, whose index row was added.
+	MissingRows int
+}
+
+// Repair makes the index consistent with the data table, by deleting the index
+// rows that are stale and adding those that are missing.  The whole index and
+// data tables are scanned.  Index rows are checked against the data row again
+// right before being deleted, but rows written concurrently with a repair may
+// still need another one.
+func (idx *Index) Repair(ctx context.Context) (RepairStats, error) {
+	var stats RepairStats
+	scan, err := hrpc.NewScanStr(ctx, idx.indexTable)
+	if err != nil {
+		return stats, err
+	}
+	indexRows, err := idx.client.Scan(scan)
+	if err != nil {
+		return stats, err
+	}
+	indexed := make(map[string]struct{}, len(indexRows))
+	for _, indexRow := range indexRows {
+		if len(indexRow.Cell) == 0 {
+			continue
+		}
+		indexed[string(indexRow.Cell[0].Row)] = struct{}{}
+	}
+
+	scan, err = hrpc.NewScanStr(ctx, idx.table,
+		hrpc.Families(map[string][]string{idx.family: {idx.qualifier}}))
+	if err != nil {
+		return stats, err
+	}
+	dataRows, err := idx.client.Scan(scan)
+	if err != nil {
+		return stats, err
+	}
+	for _, row := range dataRows {
+		value := idx.valueOf(row)
+		if value == nil {
+			continue
+		}
+		key := indexKey(value, row.Cell[0].Row)
+		if _, ok := indexed[string(key)]; ok {
+			delete(indexed, string(key))
+			continue
+		}
+		if err = idx.putIndexRow(ctx, value, row.Cell[0].Row); err != nil {
+			return stats, err
+		}
+		stats.MissingRows++
+	}
+
+	// What's left in indexed doesn't match any data row.
+	for key := range indexed {
+		value, dataKey, err := splitIndexKey([]byte(key))
+		if err != nil {
+			return stats, err
+		}
+		// The data row may have been written since it was scanned.
+		current, err := idx.currentValue(ctx, string(dataKey))
+		if err != nil {
+			return stats, err
+		} else if bytes.Equal(current, value) {
+			continue
+		}
+		if err = idx.deleteIndexRow(ctx, value, dataKey); err != nil {
+			return stats, err
+		}
+		stats.StaleRows++
+	}
+	return stats, nil
+}
+
+// Splits the key of an index row into the indexed value and the data row key.
+func splitIndexKey(key []byte) ([]byte, []byte, error) {
+	if len(key) < 4 {
+		return nil, nil, errors.New("index row key too short")
+	}
+	n := binary.BigEndian.Uint32(key)
+	if uint64(len(key)-4) < uint64(n) {
+		return nil, nil, errors.New("truncated value in index row key")
+	}
+	return key[4 : 4+n], key[4+n:], nil
+}
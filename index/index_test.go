@@ -0,0 +1,40 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package index
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestIndexKey(t *testing.T) {
+	key := indexKey([]byte("value"), []byte("row1"))
+	value, dataKey, err := splitIndexKey(key)
+	if err != nil || string(value) != "value" || string(dataKey) != "row1" {
+		t.Errorf("splitIndexKey returned %q, %q, %v", value, dataKey, err)
+	}
+	// No value is a prefix of another one.
+	if bytes.HasPrefix(indexKey([]byte("val"), []byte("row1")), valuePrefix([]byte("va"))) {
+		t.Error("The keys for \"val\" start with the prefix of \"va\"")
+	}
+	if _, _, err = splitIndexKey([]byte{0, 0, 0, 9, 'a'}); err == nil {
+		t.Error("Expected an error for a truncated key")
+	}
+
+	testcases := []struct {
+		prefix, end []byte
+	}{
+		{prefix: []byte("ab"), end: []byte("ac")},
+		{prefix: []byte{'a', 0xFF}, end: []byte("b")},
+		{prefix: []byte{0xFF, 0xFF}, end: nil},
+	}
+	for i, testcase := range testcases {
+		if end := prefixEnd(testcase.prefix); !bytes.Equal(end, testcase.end) {
+			t.Errorf("[#%d] prefixEnd(%q) = %q, expected %q",
+				i, testcase.prefix, end, testcase.end)
+		}
+	}
+}
@@ -244,7 +244,7 @@ func TestMultiplePutsGetsParallel(t *testing.T) {
 	var wg sync.WaitGroup
 	for i := 0; i < num_ops; i++ {
 		wg.Add(1)
-		go func(client *gohbase.Client, key string) {
+		go func(client gohbase.Client, key string) {
 			defer wg.Done()
 			err := insertKeyValue(client, key, "cf", []byte(key))
 			if err != nil {
@@ -256,7 +256,7 @@ func TestMultiplePutsGetsParallel(t *testing.T) {
 	// All puts are complete. Now do the same for gets.
 	for i := num_ops - 1; i >= 0; i-- {
 		wg.Add(1)
-		go func(client *gohbase.Client, key string) {
+		go func(client gohbase.Client, key string) {
 			defer wg.Done()
 			get, err := hrpc.NewGetStr(context.Background(), table, key, hrpc.Families(headers))
 			rsp, err := c.Get(get)
@@ -415,7 +415,7 @@ func performNPuts(keyPrefix string, num_ops int) error {
 }
 
 // Helper function. Given a client, key, columnFamily, value inserts into the table under column 'a'
-func insertKeyValue(c *gohbase.Client, key, columnFamily string, value []byte) error {
+func insertKeyValue(c gohbase.Client, key, columnFamily string, value []byte) error {
 	values := map[string]map[string][]byte{columnFamily: map[string][]byte{}}
 	values[columnFamily]["a"] = value
 	putRequest, err := hrpc.NewPutStr(context.Background(), table, key, values)
@@ -0,0 +1,292 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// TimeSeriesJournal will return an option that will make the writer append
+// the rows written to a journal in the given directory before buffering them.
+// The rows that weren't written to HBase yet when the process crashes, or when
+// Close gives up, are written again by the next writer created with the same
+// directory, with the same timestamps, which extends at-least-once delivery to
+// all the rows Write accepted.  The journal isn't synced to disk, so it
+// doesn't survive crashes of the machine itself.  A directory must only be
+// used by one writer at a time.
+func TimeSeriesJournal(dir string) TimeSeriesOption {
+	return func(w *TimeSeriesWriter) {
+		w.journalDir = dir
+	}
+}
+
+// Size past which the journal moves on to a new segment.  A segment is deleted
+// once all its rows were written.
+const journalSegmentSize = 16 * 1024 * 1024
+
+// Suffix of the names of the segments of the journal.
+const journalSuffix = ".journal"
+
+var errCorruptJournal = errors.New("corrupt journal record")
+
+// The journal of a TimeSeriesWriter, protected by the writer's lock.
+type timeSeriesJournal struct {
+	dir string
+	// Number of the next segment.
+	next    uint64
+	current *journalSegment
+}
+
+// A file of the journal.
+type journalSegment struct {
+	path string
+	file *os.File
+	size int
+	// Number of rows of the segment not written yet.
+	pending int
+}
+
+// Opens the journal in the given directory, and returns the rows left in it
+// along with the paths of their segments, to be deleted once the rows are
+// added to new segments.
+func openJournal(dir string) (*timeSeriesJournal, []*timeSeriesRow, []string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, nil, err
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	j := &timeSeriesJournal{dir: dir}
+	var paths []string
+	for _, info := range infos {
+		name := info.Name()
+		if !strings.HasSuffix(name, journalSuffix) {
+			continue
+		}
+		var n uint64
+		if _, err = fmt.Sscanf(name, "%016x"+journalSuffix, &n); err != nil {
+			continue
+		}
+		if n >= j.next {
+			j.next = n + 1
+		}
+		paths = append(paths, filepath.Join(dir, name))
+	}
+	// The names are fixed-width, so they sort in the order of the segments.
+	sort.Strings(paths)
+	var rows []*timeSeriesRow
+	for _, path := range paths {
+		segmentRows, err := readJournalSegment(path)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		rows = append(rows, segmentRows...)
+	}
+	return j, rows, paths, nil
+}
+
+// Appends the given row to the journal, and records its segment in it.
+func (j *timeSeriesJournal) append(row *timeSeriesRow) error {
+	if j.current == nil || j.current.size >= journalSegmentSize {
+		if err := j.roll(); err != nil {
+			return err
+		}
+	}
+	record := encodeJournalRecord(row)
+	if _, err := j.current.file.Write(record); err != nil {
+		// The record may have been partly written, so the next rows go
+		// to a new segment.
+		j.current.size = journalSegmentSize
+		return fmt.Errorf("failed to write to the journal: %s", err)
+	}
+	j.current.size += len(record)
+	j.current.pending++
+	row.segment = j.current
+	return nil
+}
+
+// Moves on to a new segment.
+func (j *timeSeriesJournal) roll() error {
+	path := filepath.Join(j.dir, fmt.Sprintf("%016x"+journalSuffix, j.next))
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create a journal segment: %s", err)
+	}
+	j.next++
+	if j.current != nil {
+		j.current.file.Close()
+		j.current.removeIfDone()
+	}
+	j.current = &journalSegment{path: path, file: file}
+	return nil
+}
+
+// Records that the given row, added to the journal, was written.
+func (j *timeSeriesJournal) done(row *timeSeriesRow) {
+	seg := row.segment
+	seg.pending--
+	if seg != j.current {
+		seg.removeIfDone()
+	}
+}
+
+// Closes the journal, whose current segment is deleted if all its rows were
+// written.
+func (j *timeSeriesJournal) close() {
+	if j.current == nil {
+		return
+	}
+	j.current.file.Close()
+	j.current.removeIfDone()
+	j.current = nil
+}
+
+// Deletes the segment, which must be closed, if all its rows were written.
+func (s *journalSegment) removeIfDone() {
+	if s.pending > 0 {
+		return
+	}
+	if err := os.Remove(s.path); err != nil {
+		log.WithFields(log.Fields{
+			"Path":  s.path,
+			"Error": err,
+		}).Warn("Failed to delete a journal segment")
+	}
+}
+
+// Records of the journal are made of their length and CRC-32 (both 4 bytes,
+// big-endian) followed by the timestamp of the row (8 bytes, big-endian) and
+// its key, families, qualifiers and values, prefixed by their length or
+// number as varints.
+func encodeJournalRecord(row *timeSeriesRow) []byte {
+	buf := make([]byte, 16, 16+row.size+8*len(row.values))
+	binary.BigEndian.PutUint64(buf[8:], row.timestamp)
+	buf = appendJournalBytes(buf, []byte(row.key))
+	buf = appendUvarint(buf, uint64(len(row.values)))
+	for family, qualifiers := range row.values {
+		buf = appendJournalBytes(buf, []byte(family))
+		buf = appendUvarint(buf, uint64(len(qualifiers)))
+		for qualifier, value := range qualifiers {
+			buf = appendJournalBytes(buf, []byte(qualifier))
+			buf = appendJournalBytes(buf, value)
+		}
+	}
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-8))
+	binary.BigEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(buf[8:]))
+	return buf
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	return append(buf, tmp[:binary.PutUvarint(tmp[:], v)]...)
+}
+
+func appendJournalBytes(buf, b []byte) []byte {
+	return append(appendUvarint(buf, uint64(len(b))), b...)
+}
+
+// Returns the rows of the given segment.  A truncated or corrupt record, as
+// left by a crash while it was being written, ends the segment.
+func readJournalSegment(path string) ([]*timeSeriesRow, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rows []*timeSeriesRow
+	for len(buf) > 0 {
+		var row *timeSeriesRow
+		if len(buf) >= 8 {
+			n := binary.BigEndian.Uint32(buf)
+			if uint64(n) <= uint64(len(buf)-8) {
+				record := buf[8 : 8+n]
+				if crc32.ChecksumIEEE(record) == binary.BigEndian.Uint32(buf[4:]) {
+					row, err = decodeJournalRecord(record)
+				}
+				buf = buf[8+n:]
+			}
+		}
+		if row == nil {
+			log.WithFields(log.Fields{
+				"Path":  path,
+				"Error": err,
+			}).Warn("Ignoring the end of a truncated or corrupt journal segment")
+			break
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Decodes a record of the journal, without its length and CRC.
+func decodeJournalRecord(record []byte) (*timeSeriesRow, error) {
+	if len(record) < 8 {
+		return nil, errCorruptJournal
+	}
+	d := journalDecoder{buf: record[8:]}
+	key := string(d.bytes())
+	values := make(map[string]map[string][]byte)
+	for families := d.uvarint(); d.err == nil && families > 0; families-- {
+		family := string(d.bytes())
+		qualifiers := make(map[string][]byte)
+		for n := d.uvarint(); d.err == nil && n > 0; n-- {
+			qualifier := string(d.bytes())
+			qualifiers[qualifier] = d.bytes()
+		}
+		values[family] = qualifiers
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return &timeSeriesRow{
+		key:       key,
+		values:    values,
+		timestamp: binary.BigEndian.Uint64(record),
+		size:      rowSize(key, values),
+	}, nil
+}
+
+// Decodes the fields of a record, remembering the first error.
+type journalDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *journalDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = errCorruptJournal
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *journalDecoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	} else if n > uint64(len(d.buf)) {
+		d.err = errCorruptJournal
+		return nil
+	}
+	b := d.buf[:n:n]
+	d.buf = d.buf[n:]
+	return b
+}
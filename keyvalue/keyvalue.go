@@ -0,0 +1,362 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+// Package keyvalue encodes and decodes the binary format of HBase KeyValues,
+// as found in cell blocks, HFiles and WAL edits.
+//
+// A KeyValue is laid out as follows, all integers being big-endian:
+//
+//	key length (4 bytes)
+//	value length (4 bytes)
+//	key:
+//		row length (2 bytes), row
+//		family length (1 byte), family
+//		qualifier
+//		timestamp (8 bytes)
+//		type (1 byte)
+//	value
+//	tags length (2 bytes), tags	(only when tags are enabled)
+//
+// Tags are themselves a sequence of tag length (2 bytes, counting the type),
+// type (1 byte) and value.
+package keyvalue
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/tsuna/gohbase/pb"
+)
+
+// Type is the type of a KeyValue.
+type Type byte
+
+// Types of KeyValues.
+const (
+	Minimum             Type = 0
+	Put                 Type = 4
+	Delete              Type = 8
+	DeleteFamilyVersion Type = 10
+	DeleteColumn        Type = 12
+	DeleteFamily        Type = 14
+	Maximum             Type = 255
+)
+
+// Sizes of the fixed-length parts of a KeyValue.
+const (
+	lengthsSize     = 4 + 4 // Key length and value length.
+	rowLengthSize   = 2
+	familyLenSize   = 1
+	timestampSize   = 8
+	typeSize        = 1
+	tagsLengthSize  = 2
+	tagLengthSize   = 2
+	tagTypeSize     = 1
+	keyInfraSize    = rowLengthSize + familyLenSize + timestampSize + typeSize
+	maxRowLength    = math.MaxInt16
+	maxFamilyLength = math.MaxUint8
+	maxTagsLength   = math.MaxUint16
+)
+
+// ErrShortBuffer is returned when decoding a truncated KeyValue.
+var ErrShortBuffer = errors.New("keyvalue: buffer too short")
+
+// KeyValue is a cell in its HBase binary format.
+type KeyValue struct {
+	Row       []byte
+	Family    []byte
+	Qualifier []byte
+	Timestamp uint64
+	Type      Type
+	Value     []byte
+	// Tags in their binary format, see ParseTags and AppendTags.
+	Tags []byte
+}
+
+// KeyLength returns the length of the key of this KeyValue.
+func (kv *KeyValue) KeyLength() int {
+	return keyInfraSize + len(kv.Row) + len(kv.Family) + len(kv.Qualifier)
+}
+
+// Len returns the length of this KeyValue once encoded, with or without its
+// tags.
+func (kv *KeyValue) Len(withTags bool) int {
+	n := lengthsSize + kv.KeyLength() + len(kv.Value)
+	if withTags {
+		n += tagsLengthSize + len(kv.Tags)
+	}
+	return n
+}
+
+func (kv *KeyValue) check(withTags bool) error {
+	if len(kv.Row) > maxRowLength {
+		return fmt.Errorf("keyvalue: row too long: %d bytes", len(kv.Row))
+	}
+	if len(kv.Family) > maxFamilyLength {
+		return fmt.Errorf("keyvalue: family too long: %d bytes", len(kv.Family))
+	}
+	if withTags && len(kv.Tags) > maxTagsLength {
+		return fmt.Errorf("keyvalue: tags too long: %d bytes", len(kv.Tags))
+	}
+	if kv.KeyLength() > math.MaxInt32 || len(kv.Value) > math.MaxInt32 {
+		return errors.New("keyvalue: KeyValue too long")
+	}
+	return nil
+}
+
+// AppendTo appends this KeyValue, with or without its tags, to the given
+// buffer and returns the extended buffer.
+func (kv *KeyValue) AppendTo(buf []byte, withTags bool) ([]byte, error) {
+	if err := kv.check(withTags); err != nil {
+		return buf, err
+	}
+	buf = appendUint32(buf, uint32(kv.KeyLength()))
+	buf = appendUint32(buf, uint32(len(kv.Value)))
+	buf = kv.appendKey(buf)
+	buf = append(buf, kv.Value...)
+	if withTags {
+		buf = appendUint16(buf, uint16(len(kv.Tags)))
+		buf = append(buf, kv.Tags...)
+	}
+	return buf, nil
+}
+
+// AppendKey appends the key of this KeyValue, as found in the indexes of
+// HFiles, to the given buffer and returns the extended buffer.
+func (kv *KeyValue) AppendKey(buf []byte) ([]byte, error) {
+	if err := kv.check(false); err != nil {
+		return buf, err
+	}
+	return kv.appendKey(buf), nil
+}
+
+func (kv *KeyValue) appendKey(buf []byte) []byte {
+	buf = appendUint16(buf, uint16(len(kv.Row)))
+	buf = append(buf, kv.Row...)
+	buf = append(buf, byte(len(kv.Family)))
+	buf = append(buf, kv.Family...)
+	buf = append(buf, kv.Qualifier...)
+	buf = appendUint64(buf, kv.Timestamp)
+	return append(buf, byte(kv.Type))
+}
+
+// Compare compares the keys of two KeyValues in the order HBase sorts them:
+// by row, family and qualifier, then from the most recent timestamp to the
+// oldest, then by decreasing type so that deletes come before the puts they
+// mask.  It returns a negative number if a comes first, a positive one if b
+// does, and 0 if they have the same key.
+func Compare(a, b *KeyValue) int {
+	if c := bytes.Compare(a.Row, b.Row); c != 0 {
+		return c
+	}
+	// A Minimum type without a column is used to seek past the last cell of
+	// a row, so it sorts after all of them.
+	aLast := len(a.Family)+len(a.Qualifier) == 0 && a.Type == Minimum
+	bLast := len(b.Family)+len(b.Qualifier) == 0 && b.Type == Minimum
+	if aLast != bLast {
+		if aLast {
+			return 1
+		}
+		return -1
+	}
+	if c := bytes.Compare(a.Family, b.Family); c != 0 {
+		return c
+	}
+	if c := bytes.Compare(a.Qualifier, b.Qualifier); c != 0 {
+		return c
+	}
+	if a.Timestamp != b.Timestamp {
+		if a.Timestamp > b.Timestamp {
+			return -1
+		}
+		return 1
+	}
+	return int(b.Type) - int(a.Type)
+}
+
+// Decode decodes the KeyValue at the start of the given buffer, with or
+// without tags, and returns it along with the number of bytes it took.  The
+// slices of the KeyValue point into the buffer.
+func Decode(buf []byte, withTags bool) (*KeyValue, int, error) {
+	if len(buf) < lengthsSize {
+		return nil, 0, ErrShortBuffer
+	}
+	keyLen := uint64(binary.BigEndian.Uint32(buf))
+	valueLen := uint64(binary.BigEndian.Uint32(buf[4:]))
+	if keyLen < keyInfraSize {
+		return nil, 0, fmt.Errorf("keyvalue: invalid key length %d", keyLen)
+	}
+	end := lengthsSize + keyLen + valueLen
+	if uint64(len(buf)) < end {
+		return nil, 0, ErrShortBuffer
+	}
+	key := buf[lengthsSize : lengthsSize+keyLen]
+	kv := &KeyValue{Value: buf[lengthsSize+keyLen : end]}
+
+	rowLen := uint64(binary.BigEndian.Uint16(key))
+	if rowLengthSize+rowLen+familyLenSize > keyLen-timestampSize-typeSize {
+		return nil, 0, fmt.Errorf("keyvalue: invalid row length %d", rowLen)
+	}
+	kv.Row = key[rowLengthSize : rowLengthSize+rowLen]
+	familyStart := rowLengthSize + rowLen + familyLenSize
+	familyLen := uint64(key[familyStart-familyLenSize])
+	qualifierEnd := keyLen - timestampSize - typeSize
+	if familyStart+familyLen > qualifierEnd {
+		return nil, 0, fmt.Errorf("keyvalue: invalid family length %d", familyLen)
+	}
+	kv.Family = key[familyStart : familyStart+familyLen]
+	kv.Qualifier = key[familyStart+familyLen : qualifierEnd]
+	kv.Timestamp = binary.BigEndian.Uint64(key[qualifierEnd:])
+	kv.Type = Type(key[keyLen-typeSize])
+
+	if withTags {
+		if uint64(len(buf)) < end+tagsLengthSize {
+			return nil, 0, ErrShortBuffer
+		}
+		tagsLen := uint64(binary.BigEndian.Uint16(buf[end:]))
+		end += tagsLengthSize
+		if uint64(len(buf)) < end+tagsLen {
+			return nil, 0, ErrShortBuffer
+		}
+		if tagsLen > 0 {
+			kv.Tags = buf[end : end+tagsLen]
+		}
+		end += tagsLen
+	}
+	return kv, int(end), nil
+}
+
+// Tag is a piece of metadata attached to a KeyValue, e.g. its visibility
+// labels or TTL.
+type Tag struct {
+	Type  byte
+	Value []byte
+}
+
+// AppendTags appends the given tags in their binary format to the given
+// buffer and returns the extended buffer.
+func AppendTags(buf []byte, tags []Tag) ([]byte, error) {
+	for _, tag := range tags {
+		if tagTypeSize+len(tag.Value) > math.MaxUint16 {
+			return buf, fmt.Errorf("keyvalue: tag too long: %d bytes", len(tag.Value))
+		}
+		buf = appendUint16(buf, uint16(tagTypeSize+len(tag.Value)))
+		buf = append(buf, tag.Type)
+		buf = append(buf, tag.Value...)
+	}
+	return buf, nil
+}
+
+// ParseTags parses tags in their binary format.  The values of the tags point
+// into the buffer.
+func ParseTags(buf []byte) ([]Tag, error) {
+	var tags []Tag
+	for len(buf) > 0 {
+		if len(buf) < tagLengthSize+tagTypeSize {
+			return nil, ErrShortBuffer
+		}
+		n := int(binary.BigEndian.Uint16(buf))
+		if n < tagTypeSize {
+			return nil, fmt.Errorf("keyvalue: invalid tag length %d", n)
+		}
+		if len(buf) < tagLengthSize+n {
+			return nil, ErrShortBuffer
+		}
+		tags = append(tags, Tag{
+			Type:  buf[tagLengthSize],
+			Value: buf[tagLengthSize+tagTypeSize : tagLengthSize+n],
+		})
+		buf = buf[tagLengthSize+n:]
+	}
+	return tags, nil
+}
+
+// AppendCellBlock appends the given KeyValues to the given buffer as a cell
+// block of KeyValueCodec, or of KeyValueCodecWithTags if withTags is true:
+// each KeyValue is preceded by its length.
+func AppendCellBlock(buf []byte, kvs []*KeyValue, withTags bool) ([]byte, error) {
+	for _, kv := range kvs {
+		n := kv.Len(withTags)
+		if n > math.MaxInt32 {
+			return buf, errors.New("keyvalue: KeyValue too long")
+		}
+		buf = appendUint32(buf, uint32(n))
+		var err error
+		if buf, err = kv.AppendTo(buf, withTags); err != nil {
+			return buf, err
+		}
+	}
+	return buf, nil
+}
+
+// DecodeCellBlock decodes a cell block of KeyValueCodec, or of
+// KeyValueCodecWithTags if withTags is true.  The slices of the KeyValues
+// point into the buffer.
+func DecodeCellBlock(buf []byte, withTags bool) ([]*KeyValue, error) {
+	var kvs []*KeyValue
+	for len(buf) > 0 {
+		if len(buf) < 4 {
+			return nil, ErrShortBuffer
+		}
+		n := uint64(binary.BigEndian.Uint32(buf))
+		if uint64(len(buf)-4) < n {
+			return nil, ErrShortBuffer
+		}
+		kv, read, err := Decode(buf[4:4+n], withTags)
+		if err != nil {
+			return nil, err
+		}
+		if uint64(read) != n {
+			return nil, fmt.Errorf("keyvalue: %d trailing bytes after KeyValue", n-uint64(read))
+		}
+		kvs = append(kvs, kv)
+		buf = buf[4+n:]
+	}
+	return kvs, nil
+}
+
+// FromCell converts a cell of a protobuf result into a KeyValue.
+func FromCell(cell *pb.Cell) *KeyValue {
+	return &KeyValue{
+		Row:       cell.Row,
+		Family:    cell.Family,
+		Qualifier: cell.Qualifier,
+		Timestamp: cell.GetTimestamp(),
+		Type:      Type(cell.GetCellType()),
+		Value:     cell.Value,
+		Tags:      cell.Tags,
+	}
+}
+
+// ToCell converts this KeyValue into a cell of a protobuf result.
+func (kv *KeyValue) ToCell() *pb.Cell {
+	timestamp := kv.Timestamp
+	cellType := pb.CellType(kv.Type)
+	return &pb.Cell{
+		Row:       kv.Row,
+		Family:    kv.Family,
+		Qualifier: kv.Qualifier,
+		Timestamp: &timestamp,
+		CellType:  &cellType,
+		Value:     kv.Value,
+		Tags:      kv.Tags,
+	}
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	return append(buf, byte(v>>8), byte(v))
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	return append(buf, byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32),
+		byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
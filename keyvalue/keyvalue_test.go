@@ -0,0 +1,208 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package keyvalue
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	buf, err := hex.DecodeString(strings.Replace(s, " ", "", -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+// KeyValues along with their encoding by the Java client, e.g.
+// new KeyValue(Bytes.toBytes("row"), Bytes.toBytes("cf"), Bytes.toBytes("q"),
+// 1234L, Bytes.toBytes("value")).
+var fixtures = []struct {
+	kv       *KeyValue
+	withTags bool
+	encoded  string
+}{{
+	kv: &KeyValue{Row: []byte("row"), Family: []byte("cf"), Qualifier: []byte("q"),
+		Timestamp: 1234, Type: Put, Value: []byte("value")},
+	encoded: "00000012 00000005 0003 726f77 02 6366 71 00000000000004d2 04 76616c7565",
+}, {
+	kv: &KeyValue{Row: []byte("row"), Family: []byte("cf"), Qualifier: []byte("q"),
+		Timestamp: 1234, Type: Put, Value: []byte("value")},
+	withTags: true,
+	encoded: "00000012 00000005 0003 726f77 02 6366 71 00000000000004d2 04 76616c7565" +
+		"0000",
+}, {
+	// A delete of a whole family at HConstants.LATEST_TIMESTAMP, with an
+	// ACL tag.
+	kv: &KeyValue{Row: []byte("r"), Family: []byte("f"), Qualifier: []byte{},
+		Timestamp: 1<<63 - 1, Type: DeleteFamily, Value: []byte{},
+		Tags: []byte{0, 3, 1, 'a', 'b'}},
+	withTags: true,
+	encoded:  "0000000e 00000000 0001 72 01 66 7fffffffffffffff 0e 0005 0003 01 6162",
+}, {
+	// Empty row and family, as used for the first key of a region.
+	kv: &KeyValue{Row: []byte{}, Family: []byte{}, Qualifier: []byte{},
+		Timestamp: 0, Type: Maximum, Value: []byte{}},
+	encoded: "0000000c 00000000 0000 00 0000000000000000 ff",
+}}
+
+func TestEncode(t *testing.T) {
+	for i, fixture := range fixtures {
+		expected := unhex(t, fixture.encoded)
+		if n := fixture.kv.Len(fixture.withTags); n != len(expected) {
+			t.Errorf("Fixture %d: expected a length of %d, got %d", i, len(expected), n)
+		}
+		buf, err := fixture.kv.AppendTo([]byte("prefix"), fixture.withTags)
+		if err != nil {
+			t.Errorf("Fixture %d: %s", i, err)
+		} else if !bytes.Equal(buf, append([]byte("prefix"), expected...)) {
+			t.Errorf("Fixture %d: expected %x, got %x", i, expected, buf[len("prefix"):])
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for i, fixture := range fixtures {
+		buf := unhex(t, fixture.encoded)
+		kv, n, err := Decode(append(buf, "trailing"...), fixture.withTags)
+		if err != nil {
+			t.Errorf("Fixture %d: %s", i, err)
+			continue
+		}
+		if n != len(buf) {
+			t.Errorf("Fixture %d: expected to read %d bytes, read %d", i, len(buf), n)
+		}
+		if !reflect.DeepEqual(kv, fixture.kv) {
+			t.Errorf("Fixture %d: expected %+v, got %+v", i, fixture.kv, kv)
+		}
+		// Every truncation must be detected.
+		for j := 0; j < len(buf); j++ {
+			if _, _, err = Decode(buf[:j], fixture.withTags); err != ErrShortBuffer {
+				t.Errorf("Fixture %d: expected ErrShortBuffer when truncated to %d bytes,"+
+					" got %v", i, j, err)
+			}
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, encoded := range []string{
+		// Key too short for the fixed-length parts.
+		"0000000b 00000000 0000 00 00000000000000 ff",
+		// Row longer than the key.
+		"0000000c 00000000 0010 00 0000000000000000 ff",
+		// Family longer than the key.
+		"0000000c 00000000 0000 05 0000000000000000 ff",
+	} {
+		if _, _, err := Decode(unhex(t, encoded), false); err == nil ||
+			err == ErrShortBuffer {
+			t.Errorf("Expected an invalid KeyValue error for %s, got %v", encoded, err)
+		}
+	}
+	kv := &KeyValue{Row: make([]byte, maxRowLength+1)}
+	if _, err := kv.AppendTo(nil, false); err == nil {
+		t.Error("Expected an error encoding a row too long")
+	}
+	kv = &KeyValue{Family: make([]byte, maxFamilyLength+1)}
+	if _, err := kv.AppendTo(nil, false); err == nil {
+		t.Error("Expected an error encoding a family too long")
+	}
+}
+
+func TestTags(t *testing.T) {
+	tags := []Tag{{Type: 1, Value: []byte("ab")}, {Type: 8, Value: []byte{}}}
+	buf, err := AppendTags(nil, tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := unhex(t, "0003 01 6162 0001 08"); !bytes.Equal(buf, expected) {
+		t.Errorf("Expected %x, got %x", expected, buf)
+	}
+	parsed, err := ParseTags(buf)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(parsed, tags) {
+		t.Errorf("Expected %v, got %v", tags, parsed)
+	}
+	for _, invalid := range []string{"00", "0003 01 61", "0000 01"} {
+		if _, err = ParseTags(unhex(t, invalid)); err == nil {
+			t.Errorf("Expected an error parsing %s", invalid)
+		}
+	}
+}
+
+func TestCellBlock(t *testing.T) {
+	kvs := []*KeyValue{fixtures[0].kv, fixtures[3].kv}
+	expected := unhex(t, "0000001f "+fixtures[0].encoded+" 00000014 "+fixtures[3].encoded)
+	buf, err := AppendCellBlock(nil, kvs, false)
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf, expected) {
+		t.Errorf("Expected %x, got %x", expected, buf)
+	}
+	decoded, err := DecodeCellBlock(buf, false)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(decoded, kvs) {
+		t.Errorf("Expected %v, got %v", kvs, decoded)
+	}
+	if _, err = DecodeCellBlock(buf[:len(buf)-1], false); err != ErrShortBuffer {
+		t.Errorf("Expected ErrShortBuffer for a truncated cell block, got %v", err)
+	}
+	// A length prefix covering more than the KeyValue.
+	buf = unhex(t, "00000020 "+fixtures[0].encoded+" 00")
+	if _, err = DecodeCellBlock(buf, false); err == nil {
+		t.Error("Expected an error for trailing bytes after a KeyValue")
+	}
+}
+
+func TestCell(t *testing.T) {
+	for i, fixture := range fixtures {
+		if kv := FromCell(fixture.kv.ToCell()); !reflect.DeepEqual(kv, fixture.kv) {
+			t.Errorf("Fixture %d: expected %+v, got %+v", i, fixture.kv, kv)
+		}
+	}
+}
+
+func TestAppendKey(t *testing.T) {
+	for i, fixture := range fixtures {
+		key, err := fixture.kv.AppendKey(nil)
+		if err != nil {
+			t.Errorf("Fixture %d: %s", i, err)
+			continue
+		}
+		// The key starts right after the key and value lengths.
+		encoded := unhex(t, fixture.encoded)
+		if expected := encoded[8 : 8+fixture.kv.KeyLength()]; !bytes.Equal(key, expected) {
+			t.Errorf("Fixture %d: expected %x, got %x", i, expected, key)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// In the order HBase sorts them.
+	kvs := []*KeyValue{
+		{Row: []byte("a"), Family: []byte("cf"), Qualifier: []byte("q"), Timestamp: 1, Type: Put},
+		{Row: []byte("a"), Type: Minimum},
+		{Row: []byte("b"), Family: []byte("cf"), Qualifier: []byte("a"), Timestamp: 1, Type: Put},
+		{Row: []byte("b"), Family: []byte("cf"), Qualifier: []byte("q"), Timestamp: 2, Type: Put},
+		{Row: []byte("b"), Family: []byte("cf"), Qualifier: []byte("q"), Timestamp: 1, Type: DeleteColumn},
+		{Row: []byte("b"), Family: []byte("cf"), Qualifier: []byte("q"), Timestamp: 1, Type: Put},
+		{Row: []byte("b"), Family: []byte("cf2"), Timestamp: 5, Type: Put},
+	}
+	for i := range kvs {
+		for j := range kvs {
+			c := Compare(kvs[i], kvs[j])
+			if (i < j && c >= 0) || (i > j && c <= 0) || (i == j && c != 0) {
+				t.Errorf("Compare(%d, %d) = %d", i, j, c)
+			}
+		}
+	}
+}
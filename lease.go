@@ -0,0 +1,198 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"golang.org/x/net/context"
+)
+
+var (
+	// ErrLocked is returned by Locker.Acquire when the lock is held by
+	// someone else.
+	ErrLocked = errors.New("lock held by someone else")
+
+	// ErrLeaseLost is returned by Lease.Renew and Lease.Release when the lock
+	// was acquired by someone else after the lease expired.
+	ErrLeaseLost = errors.New("lease lost")
+)
+
+// Qualifiers of the cells of a lock row.
+const (
+	lockOwner   = "owner"   // Random ID of the current holder, if any.
+	lockExpires = "expires" // Expiration of the lease, in ms since the epoch.
+	lockToken   = "token"   // Fencing token of the last lease granted.
+)
+
+// A Locker grants leases on named locks, each stored in a row of a table.
+// Leases expire unless renewed, so that a lock isn't held forever by a
+// process that died.  Expiration is decided with the clocks of the clients,
+// which must be reasonably synchronized.
+//
+// Since a process may keep using a lease it lost (e.g. after a long GC
+// pause), every lease comes with a fencing token, which increases every time
+// the lock is acquired.  Resources protected by the lock should reject
+// requests carrying a token lower than one they've already seen.
+type Locker struct {
+	client Client
+	table  string
+	family string
+	ttl    time.Duration
+}
+
+// NewLocker returns a Locker storing locks in the given family of the given
+// table, and granting leases valid for the given TTL.
+func NewLocker(c Client, table, family string, ttl time.Duration) *Locker {
+	return &Locker{client: c, table: table, family: family, ttl: ttl}
+}
+
+// A Lease is a lock held until it's released or expires.
+type Lease struct {
+	locker *Locker
+	name   string
+	owner  []byte
+	token  uint64
+
+	// When the lease expires, unless renewed.
+	Expires time.Time
+}
+
+// Token returns the fencing token of this lease.
+func (l *Lease) Token() uint64 {
+	return l.token
+}
+
+func encodeUint64(v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, v)
+	return buf
+}
+
+func decodeUint64(buf []byte) uint64 {
+	if len(buf) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(buf)
+}
+
+func millis(t time.Time) uint64 {
+	return uint64(t.UnixNano() / int64(time.Millisecond))
+}
+
+// Acquire acquires the given lock, or returns ErrLocked if it's held by
+// someone else.
+func (l *Locker) Acquire(ctx context.Context, name string) (*Lease, error) {
+	get, err := hrpc.NewGetStr(ctx, l.table, name,
+		hrpc.Families(map[string][]string{l.family: nil}))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := l.client.Get(get)
+	if err != nil {
+		return nil, err
+	}
+	cells := make(map[string][]byte)
+	if resp.Result != nil {
+		for _, cell := range resp.Result.Cell {
+			cells[string(cell.Qualifier)] = cell.Value
+		}
+	}
+	now := time.Now()
+	if cells[lockOwner] != nil && decodeUint64(cells[lockExpires]) > millis(now) {
+		return nil, ErrLocked
+	}
+
+	owner := make([]byte, 16)
+	if _, err = rand.Read(owner); err != nil {
+		return nil, err
+	}
+	owner = []byte(hex.EncodeToString(owner))
+	lease := &Lease{
+		locker:  l,
+		name:    name,
+		owner:   owner,
+		token:   decodeUint64(cells[lockToken]) + 1,
+		Expires: now.Add(l.ttl),
+	}
+	put, err := hrpc.NewPutStr(ctx, l.table, name, map[string]map[string][]byte{
+		l.family: {
+			lockOwner:   owner,
+			lockExpires: encodeUint64(millis(lease.Expires)),
+			lockToken:   encodeUint64(lease.token),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Only succeeds if nobody acquired the lock since we looked at it.
+	if err = put.SetCondition(l.family, lockToken, cells[lockToken]); err != nil {
+		return nil, err
+	}
+	if ok, err := processed(l.client.Put(put)); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrLocked
+	}
+	return lease, nil
+}
+
+// Returns whether a conditional mutation was applied.
+func processed(resp *pb.MutateResponse, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	return resp.GetProcessed(), nil
+}
+
+// Renew extends the lease by the TTL of its Locker.  It fails with
+// ErrLeaseLost if the lock was acquired by someone else in the meantime.
+func (l *Lease) Renew(ctx context.Context) error {
+	expires := time.Now().Add(l.locker.ttl)
+	put, err := hrpc.NewPutStr(ctx, l.locker.table, l.name, map[string]map[string][]byte{
+		l.locker.family: {lockExpires: encodeUint64(millis(expires))},
+	})
+	if err != nil {
+		return err
+	}
+	if err = put.SetCondition(l.locker.family, lockOwner, l.owner); err != nil {
+		return err
+	}
+	if ok, err := processed(l.locker.client.Put(put)); err != nil {
+		return err
+	} else if !ok {
+		return ErrLeaseLost
+	}
+	l.Expires = expires
+	return nil
+}
+
+// Release releases the lock.  It fails with ErrLeaseLost if the lock was
+// acquired by someone else in the meantime.  The fencing token is kept, so
+// that the next lease gets a greater one.
+func (l *Lease) Release(ctx context.Context) error {
+	del, err := hrpc.NewDelStr(ctx, l.locker.table, l.name, map[string]map[string][]byte{
+		l.locker.family: {lockOwner: nil, lockExpires: nil},
+	})
+	if err != nil {
+		return err
+	}
+	if err = del.SetCondition(l.locker.family, lockOwner, l.owner); err != nil {
+		return err
+	}
+	if ok, err := processed(l.locker.client.Delete(del)); err != nil {
+		return err
+	} else if !ok {
+		return ErrLeaseLost
+	}
+	return nil
+}
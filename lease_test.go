@@ -0,0 +1,59 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLocker(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	s.CreateTable("locks", []string{"l"})
+	c := newFakeClient(t, s)
+	defer c.Close()
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	locker := NewLocker(c, "locks", "l", time.Hour)
+	lease, err := locker.Acquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("Acquire failed: %s", err)
+	}
+	if lease.Token() != 1 {
+		t.Errorf("Expected the first token to be 1, got %d", lease.Token())
+	}
+	if _, err = locker.Acquire(ctx, "job"); err != ErrLocked {
+		t.Errorf("Expected ErrLocked while the lock is held, got %v", err)
+	}
+	if err = lease.Renew(ctx); err != nil {
+		t.Errorf("Renew failed: %s", err)
+	}
+	if err = lease.Release(ctx); err != nil {
+		t.Fatalf("Release failed: %s", err)
+	}
+	if err = lease.Release(ctx); err != ErrLeaseLost {
+		t.Errorf("Expected ErrLeaseLost releasing twice, got %v", err)
+	}
+
+	// Leases expire.
+	expiring := NewLocker(c, "locks", "l", -time.Second)
+	lease, err = expiring.Acquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("Acquire failed: %s", err)
+	}
+	next, err := locker.Acquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("Acquire of an expired lock failed: %s", err)
+	}
+	if lease.Token() != 2 || next.Token() != 3 {
+		t.Errorf("Expected tokens 2 and 3, got %d and %d", lease.Token(), next.Token())
+	}
+	if err = lease.Renew(ctx); err != ErrLeaseLost {
+		t.Errorf("Expected ErrLeaseLost renewing a lost lease, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/pb"
+	"golang.org/x/net/context"
+)
+
+// RegionLocality describes where the data of a region is, so that work on it
+// can be scheduled close to it.
+type RegionLocality struct {
+	RegionAssignment
+
+	// Fraction, between 0 and 1, of the HDFS blocks of the files of the
+	// region that are stored on the host of the RegionServer serving it, as
+	// reported by that RegionServer.  Only meaningful if Online is true.
+	Locality float32
+
+	// "host:port" of the favored nodes of the region, in order, if it was
+	// assigned by the favored node balancer.  The first one is where the
+	// region is preferably served, and all of them get a replica of its
+	// HDFS blocks.
+	FavoredNodes []string
+}
+
+// Qualifier of the favored nodes of a region in hbase:meta.
+const favoredNodesQualifier = "fn"
+
+func (a *adminClient) RegionLocality(ctx context.Context, table string) ([]RegionLocality, error) {
+	rows, err := scanTableMeta(ctx, a.cfg, table)
+	if err != nil {
+		return nil, err
+	}
+	status, err := a.ClusterStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	assignments, err := regionAssignments(rows, status)
+	if err != nil {
+		return nil, err
+	}
+	// The locality of the regions, as reported by each RegionServer.
+	localities := make(map[string]map[string]float32)
+	for _, live := range status.LiveServers {
+		addr := net.JoinHostPort(live.Server.GetHostName(),
+			strconv.Itoa(int(live.Server.GetPort())))
+		regions := make(map[string]float32)
+		for _, load := range live.ServerLoad.GetRegionLoads() {
+			regions[string(load.RegionSpecifier.GetValue())] = load.GetDataLocality()
+		}
+		localities[addr] = regions
+	}
+
+	regions := make([]RegionLocality, len(rows))
+	for i, row := range rows {
+		regions[i].RegionAssignment = assignments[i]
+		if assignments[i].Online {
+			regions[i].Locality =
+				localities[assignments[i].Server][string(assignments[i].RegionName)]
+		}
+		if regions[i].FavoredNodes, err = favoredNodes(row); err != nil {
+			return nil, err
+		}
+	}
+	return regions, nil
+}
+
+// Returns the favored nodes found in the given row of hbase:meta, if any.
+func favoredNodes(row *pb.Result) ([]string, error) {
+	for _, cell := range row.Cell {
+		if string(cell.Qualifier) != favoredNodesQualifier {
+			continue
+		}
+		nodes := &pb.FavoredNodes{}
+		if err := proto.Unmarshal(cell.Value, nodes); err != nil {
+			return nil, fmt.Errorf("broken meta: invalid info:fn in %q: %s", cell.Row, err)
+		}
+		addrs := make([]string, len(nodes.FavoredNode))
+		for i, node := range nodes.FavoredNode {
+			addrs[i] = net.JoinHostPort(node.GetHostName(), strconv.Itoa(int(node.GetPort())))
+		}
+		return addrs, nil
+	}
+	return nil, nil
+}
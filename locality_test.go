@@ -0,0 +1,56 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/pb"
+)
+
+func TestRegionLocality(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	defer setFakeMaster(s)()
+	s.CreateTable("test", []string{"cf"})
+	s.CreateTable("other", []string{"cf"})
+	s.SetLocality("test", 0.75, []*pb.ServerName{
+		&pb.ServerName{HostName: proto.String("rs1"), Port: proto.Uint32(16020)},
+		&pb.ServerName{HostName: proto.String("rs2"), Port: proto.Uint32(16020)},
+	})
+	ac := &adminClient{cfg: newFakeClient(t, s), conns: make(map[string]RegionClient)}
+	defer ac.Close()
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	regions, err := ac.RegionLocality(ctx, "test")
+	if err != nil {
+		t.Fatalf("RegionLocality failed: %s", err)
+	}
+	if len(regions) != 1 {
+		t.Fatalf("Expected 1 region, got %v", regions)
+	}
+	r := regions[0]
+	server := net.JoinHostPort(s.Host(), strconv.Itoa(int(s.Port())))
+	if r.Server != server || !r.Online || r.Locality != 0.75 {
+		t.Errorf("Unexpected locality %+v", r)
+	}
+	if expected := []string{"rs1:16020", "rs2:16020"}; !reflect.DeepEqual(r.FavoredNodes, expected) {
+		t.Errorf("Expected favored nodes %v, got %v", expected, r.FavoredNodes)
+	}
+
+	// Without favored nodes.
+	if regions, err = ac.RegionLocality(ctx, "other"); err != nil {
+		t.Fatalf("RegionLocality failed: %s", err)
+	}
+	if len(regions) != 1 || regions[0].FavoredNodes != nil || regions[0].Locality != 0 {
+		t.Errorf("Unexpected locality %+v", regions)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/tsuna/gohbase/filter"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/regioninfo"
+	"golang.org/x/net/context"
+)
+
+// MetaTable is the name of the catalog table listing the regions of all the
+// tables, and where they're assigned.  It can be read with Get, Scan and
+// Scanner like any other table: its rows are keyed by region name and can be
+// decoded with ParseMetaRow.
+const MetaTable = "hbase:meta"
+
+// MetaRow is a row of hbase:meta, describing a region and where it's
+// assigned.
+type MetaRow struct {
+	Region *regioninfo.Info
+	// "host:port" of the RegionServer serving the region, empty if it's not
+	// assigned.
+	Server string
+	// Start code of that RegionServer, 0 if unknown.
+	StartCode uint64
+}
+
+// NewMetaScan creates a Scan of the rows of hbase:meta describing the regions
+// of the given table, or of all the tables if it's empty, reading only the
+// info family.  Additional options can be given, a filter being combined
+// with the one selecting the rows of the table.
+func NewMetaScan(ctx context.Context, table string,
+	options ...func(hrpc.Call) error) (*hrpc.Scan, error) {
+	options = append([]func(hrpc.Call) error{hrpc.Families(infoFamily)}, options...)
+	if table == "" {
+		return hrpc.NewScanRange(ctx, metaTableName, nil, nil, options...)
+	}
+	// The rows of hbase:meta for this table start with "table,", and the
+	// first one is "table,,..." as the first region has an empty start key.
+	scan, err := hrpc.NewScanRange(ctx, metaTableName, []byte(table+",,"), nil, options...)
+	if err != nil {
+		return nil, err
+	}
+	var f filter.Filter = filter.NewPrefixFilter([]byte(table + ","))
+	if scan.GetFilter() != nil {
+		f = filter.NewList(filter.MustPassAll, f, scan.GetFilter())
+	}
+	if err = scan.SetFilter(f); err != nil {
+		return nil, err
+	}
+	return scan, nil
+}
+
+// ParseMetaRow decodes a row of hbase:meta, which must include the
+// info:regioninfo cell.
+func ParseMetaRow(row *pb.Result) (*MetaRow, error) {
+	reg, host, port, err := parseMetaRow(row)
+	if err != nil {
+		return nil, err
+	}
+	meta := &MetaRow{Region: reg}
+	if host != "" {
+		meta.Server = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	for _, cell := range row.Cell {
+		if string(cell.Qualifier) != "serverstartcode" || len(cell.Value) == 0 {
+			continue
+		} else if len(cell.Value) != 8 {
+			return nil, fmt.Errorf("broken meta: invalid info:serverstartcode in %q", cell)
+		}
+		meta.StartCode = binary.BigEndian.Uint64(cell.Value)
+	}
+	return meta, nil
+}
@@ -0,0 +1,74 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/tsuna/gohbase/filter"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+)
+
+func TestMetaTable(t *testing.T) {
+	s, c, ctx, done := newFakeEnv(t, "test", "test2")
+	defer done()
+	server := net.JoinHostPort(s.Host(), strconv.Itoa(int(s.Port())))
+
+	scan, err := NewMetaScan(ctx, "")
+	if err != nil {
+		t.Fatalf("Failed to create the scan: %s", err)
+	}
+	rows, err := c.Scan(scan)
+	if err != nil {
+		t.Fatalf("Scan of hbase:meta failed: %s", err)
+	}
+	var tables []string
+	for _, row := range rows {
+		meta, err := ParseMetaRow(row)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %s", row, err)
+		}
+		if meta.Server != server || meta.StartCode == 0 {
+			t.Errorf("Unexpected location %q, start code %d", meta.Server, meta.StartCode)
+		}
+		tables = append(tables, string(meta.Region.Table))
+	}
+	if len(tables) != 2 || tables[0] != "test" || tables[1] != "test2" {
+		t.Errorf("Expected the regions of test and test2, got %q", tables)
+	}
+
+	// Only the rows of the table are returned, whatever the other filters.
+	scan, err = NewMetaScan(ctx, "test", hrpc.Filters(filter.NewFirstKeyOnlyFilter()))
+	if err != nil {
+		t.Fatalf("Failed to create the scan: %s", err)
+	}
+	if rows, err = c.Scan(scan); err != nil {
+		t.Fatalf("Scan of hbase:meta failed: %s", err)
+	}
+	if len(rows) != 1 || len(rows[0].Cell) != 1 {
+		t.Fatalf("Expected a single cell of the region of test, got %v", rows)
+	}
+
+	get, _ := hrpc.NewGetStr(ctx, MetaTable, string(rows[0].Cell[0].Row))
+	resp, err := c.Get(get)
+	if err != nil {
+		t.Fatalf("Get from hbase:meta failed: %s", err)
+	}
+	meta, err := ParseMetaRow(resp.Result)
+	if err != nil {
+		t.Fatalf("Failed to parse %s: %s", resp.Result, err)
+	}
+	if string(meta.Region.Table) != "test" {
+		t.Errorf("Unexpected region %s", meta.Region)
+	}
+
+	if _, err = ParseMetaRow(&pb.Result{}); err == nil {
+		t.Error("Expected an error for a row without info:regioninfo")
+	}
+}
@@ -9,12 +9,11 @@ import (
 	"reflect"
 	"testing"
 
-	"github.com/tsuna/gohbase/region"
 	"github.com/tsuna/gohbase/regioninfo"
 )
 
 func TestMetaCache(t *testing.T) {
-	client := NewClient("~invalid.quorum~") // We shouldn't connect to ZK.
+	client := newClient("~invalid.quorum~") // We shouldn't connect to ZK.
 	reg := client.getRegion([]byte("test"), []byte("theKey"))
 	if reg != nil {
 		t.Errorf("Found region %#v even though the cache was empty?!", reg)
@@ -26,7 +25,7 @@ func TestMetaCache(t *testing.T) {
 		RegionName: []byte("test,,1234567890042.56f833d5569a27c7a43fbf547b4924a4."),
 		StopKey:    []byte(""),
 	}
-	regClient := &region.Client{}
+	regClient := &mockRegionClient{}
 	client.addRegionToCache(wholeTable, regClient)
 
 	reg = client.getRegion([]byte("test"), []byte("theKey"))
@@ -39,7 +38,7 @@ func TestMetaCache(t *testing.T) {
 	}
 
 	// Clear our client.
-	client = NewClient("~invalid.quorum~")
+	client = newClient("~invalid.quorum~")
 
 	// Inject 3 entries in the cache.
 	region1 := &regioninfo.Info{
@@ -52,6 +51,7 @@ func TestMetaCache(t *testing.T) {
 	region2 := &regioninfo.Info{
 		Table:      []byte("test"),
 		RegionName: []byte("test,foo,1234567890042.56f833d5569a27c7a43fbf547b4924a4."),
+		StartKey:   []byte("foo"),
 		StopKey:    []byte("gohbase"),
 	}
 	client.addRegionToCache(region2, regClient)
@@ -59,6 +59,7 @@ func TestMetaCache(t *testing.T) {
 	region3 := &regioninfo.Info{
 		Table:      []byte("test"),
 		RegionName: []byte("test,gohbase,1234567890042.56f833d5569a27c7a43fbf547b4924a4."),
+		StartKey:   []byte("gohbase"),
 		StopKey:    []byte(""),
 	}
 	client.addRegionToCache(region3, regClient)
@@ -86,6 +87,7 @@ func TestMetaCache(t *testing.T) {
 	region3 = &regioninfo.Info{
 		Table:      []byte("test"),
 		RegionName: []byte("test,gohbase,1234567890042.56f833d5569a27c7a43fbf547b4924a4."),
+		StartKey:   []byte("gohbase"),
 		StopKey:    []byte("zab"),
 	}
 	client.addRegionToCache(region3, regClient)
@@ -0,0 +1,118 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/tsuna/gohbase/filter"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+)
+
+// ErrInvalidPageToken is returned by ScanPage when given a token that wasn't
+// returned for the same table and range.
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// Page is a page of the results of a scan.
+type Page struct {
+	Results []*pb.Result
+
+	// NextToken is the token to pass to ScanPage to get the next page, or
+	// an empty string if this is the last page.
+	NextToken string
+}
+
+// What a page token is made of.  Only the position of the next page is kept,
+// the rest of the scan (families, filters, etc.) is given again along with
+// the token.
+type pageToken struct {
+	Table    []byte `json:"t"`
+	StartRow []byte `json:"s"`
+	StopRow  []byte `json:"e"`
+}
+
+// ScanPage returns up to pageSize rows of the given scan, starting where the
+// page that returned the given token ended, or at the start row of the scan if
+// the token is empty.  Tokens are opaque strings that can be handed to
+// another process, which makes it possible to paginate through a table
+// without keeping a scanner open between pages, e.g. in a REST API.
+func ScanPage(c Client, scan *hrpc.Scan, token string, pageSize int) (*Page, error) {
+	if pageSize < 1 {
+		return nil, errors.New("the page size must be positive")
+	}
+	startRow := scan.GetStartRow()
+	if token != "" {
+		tok, err := decodePageToken(token)
+		if err != nil || !bytes.Equal(tok.Table, scan.Table()) ||
+			!bytes.Equal(tok.StopRow, scan.GetStopRow()) {
+			return nil, ErrInvalidPageToken
+		}
+		startRow = tok.StartRow
+	}
+
+	// One more row than asked for is fetched to know where the next page
+	// starts, if any.
+	var f filter.Filter = filter.NewPageFilter(int64(pageSize + 1))
+	if scan.GetFilter() != nil {
+		f = filter.NewList(filter.MustPassAll, scan.GetFilter(), f)
+	}
+	options := []func(hrpc.Call) error{
+		hrpc.Filters(f),
+		hrpc.MaxVersions(scan.GetMaxVersions()),
+		hrpc.EffectiveUser(scan.User()),
+	}
+	if scan.GetFamilies() != nil {
+		options = append(options, hrpc.Families(scan.GetFamilies()))
+	}
+	pageScan, err := hrpc.NewScanRange(scan.GetContext(), scan.Table(), startRow,
+		scan.GetStopRow(), options...)
+	if err != nil {
+		return nil, err
+	}
+	results, err := c.Scan(pageScan)
+	scan.AddMetadata(pageScan.Metadata())
+	if err != nil {
+		return nil, err
+	}
+	page := &Page{Results: results}
+	if len(results) > pageSize {
+		page.Results = results[:pageSize]
+		next := results[pageSize]
+		if len(next.Cell) == 0 {
+			return nil, errors.New("got a result without any cell")
+		}
+		page.NextToken, err = encodePageToken(&pageToken{
+			Table:    scan.Table(),
+			StartRow: next.Cell[0].Row,
+			StopRow:  scan.GetStopRow(),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+func encodePageToken(tok *pageToken) (string, error) {
+	buf, err := json.Marshal(tok)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func decodePageToken(token string) (*pageToken, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	tok := &pageToken{}
+	return tok, json.Unmarshal(buf, tok)
+}
@@ -0,0 +1,60 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/tsuna/gohbase/hrpc"
+)
+
+func TestScanPage(t *testing.T) {
+	_, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+
+	for i := 0; i < 7; i++ {
+		put, _ := hrpc.NewPutStr(ctx, "test", fmt.Sprintf("row%d", i),
+			map[string]map[string][]byte{"cf": {"a": []byte("1")}})
+		if _, err := c.Put(put); err != nil {
+			t.Fatalf("Put failed: %s", err)
+		}
+	}
+
+	var pages []string
+	token := ""
+	for {
+		scan, _ := hrpc.NewScanRangeStr(ctx, "test", "row1", "")
+		page, err := ScanPage(c, scan, token, 3)
+		if err != nil {
+			t.Fatalf("ScanPage failed: %s", err)
+		}
+		var rows []string
+		for _, result := range page.Results {
+			rows = append(rows, string(result.Cell[0].Row))
+		}
+		pages = append(pages, fmt.Sprint(rows))
+		if token = page.NextToken; token == "" {
+			break
+		}
+	}
+	if fmt.Sprint(pages) != "[[row1 row2 row3] [row4 row5 row6]]" {
+		t.Errorf("Unexpected pages %v", pages)
+	}
+
+	scan, _ := hrpc.NewScanRangeStr(ctx, "test", "row1", "")
+	page, err := ScanPage(c, scan, "", 3)
+	if err != nil {
+		t.Fatalf("ScanPage failed: %s", err)
+	}
+	other, _ := hrpc.NewScanRangeStr(ctx, "other", "row1", "")
+	if _, err = ScanPage(c, other, page.NextToken, 3); err != ErrInvalidPageToken {
+		t.Errorf("Expected ErrInvalidPageToken for another table, got %v", err)
+	}
+	if _, err = ScanPage(c, scan, "garbage!", 3); err != ErrInvalidPageToken {
+		t.Errorf("Expected ErrInvalidPageToken for a corrupt token, got %v", err)
+	}
+}
@@ -0,0 +1,310 @@
+// Code generated by protoc-gen-go.
+// source: Admin.proto
+// DO NOT EDIT!
+
+package pb
+
+import proto "github.com/golang/protobuf/proto"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = math.Inf
+
+type GetRegionInfoResponse_CompactionState int32
+
+const (
+	GetRegionInfoResponse_NONE            GetRegionInfoResponse_CompactionState = 0
+	GetRegionInfoResponse_MINOR           GetRegionInfoResponse_CompactionState = 1
+	GetRegionInfoResponse_MAJOR           GetRegionInfoResponse_CompactionState = 2
+	GetRegionInfoResponse_MAJOR_AND_MINOR GetRegionInfoResponse_CompactionState = 3
+)
+
+var GetRegionInfoResponse_CompactionState_name = map[int32]string{
+	0: "NONE",
+	1: "MINOR",
+	2: "MAJOR",
+	3: "MAJOR_AND_MINOR",
+}
+var GetRegionInfoResponse_CompactionState_value = map[string]int32{
+	"NONE":            0,
+	"MINOR":           1,
+	"MAJOR":           2,
+	"MAJOR_AND_MINOR": 3,
+}
+
+func (x GetRegionInfoResponse_CompactionState) Enum() *GetRegionInfoResponse_CompactionState {
+	p := new(GetRegionInfoResponse_CompactionState)
+	*p = x
+	return p
+}
+func (x GetRegionInfoResponse_CompactionState) String() string {
+	return proto.EnumName(GetRegionInfoResponse_CompactionState_name, int32(x))
+}
+func (x *GetRegionInfoResponse_CompactionState) UnmarshalJSON(data []byte) error {
+	value, err := proto.UnmarshalJSONEnum(GetRegionInfoResponse_CompactionState_value, data, "GetRegionInfoResponse_CompactionState")
+	if err != nil {
+		return err
+	}
+	*x = GetRegionInfoResponse_CompactionState(value)
+	return nil
+}
+
+type GetRegionInfoRequest struct {
+	Region           *RegionSpecifier `protobuf:"bytes,1,req,name=region" json:"region,omitempty"`
+	CompactionState  *bool            `protobuf:"varint,2,opt,name=compaction_state" json:"compaction_state,omitempty"`
+	XXX_unrecognized []byte           `json:"-"`
+}
+
+func (m *GetRegionInfoRequest) Reset()         { *m = GetRegionInfoRequest{} }
+func (m *GetRegionInfoRequest) String() string { return proto.CompactTextString(m) }
+func (*GetRegionInfoRequest) ProtoMessage()    {}
+
+func (m *GetRegionInfoRequest) GetRegion() *RegionSpecifier {
+	if m != nil {
+		return m.Region
+	}
+	return nil
+}
+
+func (m *GetRegionInfoRequest) GetCompactionState() bool {
+	if m != nil && m.CompactionState != nil {
+		return *m.CompactionState
+	}
+	return false
+}
+
+type GetRegionInfoResponse struct {
+	RegionInfo       *RegionInfo                            `protobuf:"bytes,1,req,name=region_info" json:"region_info,omitempty"`
+	CompactionState  *GetRegionInfoResponse_CompactionState `protobuf:"varint,2,opt,name=compaction_state,enum=pb.GetRegionInfoResponse_CompactionState" json:"compaction_state,omitempty"`
+	IsRecovering     *bool                                  `protobuf:"varint,3,opt,name=isRecovering" json:"isRecovering,omitempty"`
+	XXX_unrecognized []byte                                 `json:"-"`
+}
+
+func (m *GetRegionInfoResponse) Reset()         { *m = GetRegionInfoResponse{} }
+func (m *GetRegionInfoResponse) String() string { return proto.CompactTextString(m) }
+func (*GetRegionInfoResponse) ProtoMessage()    {}
+
+func (m *GetRegionInfoResponse) GetRegionInfo() *RegionInfo {
+	if m != nil {
+		return m.RegionInfo
+	}
+	return nil
+}
+
+func (m *GetRegionInfoResponse) GetCompactionState() GetRegionInfoResponse_CompactionState {
+	if m != nil && m.CompactionState != nil {
+		return *m.CompactionState
+	}
+	return GetRegionInfoResponse_NONE
+}
+
+func (m *GetRegionInfoResponse) GetIsRecovering() bool {
+	if m != nil && m.IsRecovering != nil {
+		return *m.IsRecovering
+	}
+	return false
+}
+
+type GetOnlineRegionRequest struct {
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *GetOnlineRegionRequest) Reset()         { *m = GetOnlineRegionRequest{} }
+func (m *GetOnlineRegionRequest) String() string { return proto.CompactTextString(m) }
+func (*GetOnlineRegionRequest) ProtoMessage()    {}
+
+type GetOnlineRegionResponse struct {
+	RegionInfo       []*RegionInfo `protobuf:"bytes,1,rep,name=region_info" json:"region_info,omitempty"`
+	XXX_unrecognized []byte        `json:"-"`
+}
+
+func (m *GetOnlineRegionResponse) Reset()         { *m = GetOnlineRegionResponse{} }
+func (m *GetOnlineRegionResponse) String() string { return proto.CompactTextString(m) }
+func (*GetOnlineRegionResponse) ProtoMessage()    {}
+
+func (m *GetOnlineRegionResponse) GetRegionInfo() []*RegionInfo {
+	if m != nil {
+		return m.RegionInfo
+	}
+	return nil
+}
+
+// *
+// Closes the specified region and will use or not use ZK during the close
+// according to the specified flag.
+type CloseRegionRequest struct {
+	Region               *RegionSpecifier `protobuf:"bytes,1,req,name=region" json:"region,omitempty"`
+	VersionOfClosingNode *uint32          `protobuf:"varint,2,opt,name=version_of_closing_node" json:"version_of_closing_node,omitempty"`
+	TransitionInZK       *bool            `protobuf:"varint,3,opt,name=transition_in_ZK,def=1" json:"transition_in_ZK,omitempty"`
+	DestinationServer    *ServerName      `protobuf:"bytes,4,opt,name=destination_server" json:"destination_server,omitempty"`
+	// the intended server for this RPC.
+	ServerStartCode  *uint64 `protobuf:"varint,5,opt,name=serverStartCode" json:"serverStartCode,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *CloseRegionRequest) Reset()         { *m = CloseRegionRequest{} }
+func (m *CloseRegionRequest) String() string { return proto.CompactTextString(m) }
+func (*CloseRegionRequest) ProtoMessage()    {}
+
+const Default_CloseRegionRequest_TransitionInZK bool = true
+
+func (m *CloseRegionRequest) GetRegion() *RegionSpecifier {
+	if m != nil {
+		return m.Region
+	}
+	return nil
+}
+
+func (m *CloseRegionRequest) GetVersionOfClosingNode() uint32 {
+	if m != nil && m.VersionOfClosingNode != nil {
+		return *m.VersionOfClosingNode
+	}
+	return 0
+}
+
+func (m *CloseRegionRequest) GetTransitionInZK() bool {
+	if m != nil && m.TransitionInZK != nil {
+		return *m.TransitionInZK
+	}
+	return Default_CloseRegionRequest_TransitionInZK
+}
+
+func (m *CloseRegionRequest) GetDestinationServer() *ServerName {
+	if m != nil {
+		return m.DestinationServer
+	}
+	return nil
+}
+
+func (m *CloseRegionRequest) GetServerStartCode() uint64 {
+	if m != nil && m.ServerStartCode != nil {
+		return *m.ServerStartCode
+	}
+	return 0
+}
+
+type CloseRegionResponse struct {
+	Closed           *bool  `protobuf:"varint,1,req,name=closed" json:"closed,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *CloseRegionResponse) Reset()         { *m = CloseRegionResponse{} }
+func (m *CloseRegionResponse) String() string { return proto.CompactTextString(m) }
+func (*CloseRegionResponse) ProtoMessage()    {}
+
+func (m *CloseRegionResponse) GetClosed() bool {
+	if m != nil && m.Closed != nil {
+		return *m.Closed
+	}
+	return false
+}
+
+type ClearRegionBlockCacheRequest struct {
+	Region           []*RegionSpecifier `protobuf:"bytes,1,rep,name=region" json:"region,omitempty"`
+	XXX_unrecognized []byte             `json:"-"`
+}
+
+func (m *ClearRegionBlockCacheRequest) Reset()         { *m = ClearRegionBlockCacheRequest{} }
+func (m *ClearRegionBlockCacheRequest) String() string { return proto.CompactTextString(m) }
+func (*ClearRegionBlockCacheRequest) ProtoMessage()    {}
+
+func (m *ClearRegionBlockCacheRequest) GetRegion() []*RegionSpecifier {
+	if m != nil {
+		return m.Region
+	}
+	return nil
+}
+
+type ClearRegionBlockCacheResponse struct {
+	Stats            *CacheEvictionStats `protobuf:"bytes,1,req,name=stats" json:"stats,omitempty"`
+	XXX_unrecognized []byte              `json:"-"`
+}
+
+func (m *ClearRegionBlockCacheResponse) Reset()         { *m = ClearRegionBlockCacheResponse{} }
+func (m *ClearRegionBlockCacheResponse) String() string { return proto.CompactTextString(m) }
+func (*ClearRegionBlockCacheResponse) ProtoMessage()    {}
+
+func (m *ClearRegionBlockCacheResponse) GetStats() *CacheEvictionStats {
+	if m != nil {
+		return m.Stats
+	}
+	return nil
+}
+
+type RollWALWriterRequest struct {
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *RollWALWriterRequest) Reset()         { *m = RollWALWriterRequest{} }
+func (m *RollWALWriterRequest) String() string { return proto.CompactTextString(m) }
+func (*RollWALWriterRequest) ProtoMessage()    {}
+
+type RollWALWriterResponse struct {
+	// A list of encoded name of regions to flush
+	RegionToFlush    [][]byte `protobuf:"bytes,1,rep,name=region_to_flush" json:"region_to_flush,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+}
+
+func (m *RollWALWriterResponse) Reset()         { *m = RollWALWriterResponse{} }
+func (m *RollWALWriterResponse) String() string { return proto.CompactTextString(m) }
+func (*RollWALWriterResponse) ProtoMessage()    {}
+
+func (m *RollWALWriterResponse) GetRegionToFlush() [][]byte {
+	if m != nil {
+		return m.RegionToFlush
+	}
+	return nil
+}
+
+type GetServerInfoRequest struct {
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *GetServerInfoRequest) Reset()         { *m = GetServerInfoRequest{} }
+func (m *GetServerInfoRequest) String() string { return proto.CompactTextString(m) }
+func (*GetServerInfoRequest) ProtoMessage()    {}
+
+type ServerInfo struct {
+	ServerName       *ServerName `protobuf:"bytes,1,req,name=server_name" json:"server_name,omitempty"`
+	WebuiPort        *uint32     `protobuf:"varint,2,opt,name=webui_port" json:"webui_port,omitempty"`
+	XXX_unrecognized []byte      `json:"-"`
+}
+
+func (m *ServerInfo) Reset()         { *m = ServerInfo{} }
+func (m *ServerInfo) String() string { return proto.CompactTextString(m) }
+func (*ServerInfo) ProtoMessage()    {}
+
+func (m *ServerInfo) GetServerName() *ServerName {
+	if m != nil {
+		return m.ServerName
+	}
+	return nil
+}
+
+func (m *ServerInfo) GetWebuiPort() uint32 {
+	if m != nil && m.WebuiPort != nil {
+		return *m.WebuiPort
+	}
+	return 0
+}
+
+type GetServerInfoResponse struct {
+	ServerInfo       *ServerInfo `protobuf:"bytes,1,req,name=server_info" json:"server_info,omitempty"`
+	XXX_unrecognized []byte      `json:"-"`
+}
+
+func (m *GetServerInfoResponse) Reset()         { *m = GetServerInfoResponse{} }
+func (m *GetServerInfoResponse) String() string { return proto.CompactTextString(m) }
+func (*GetServerInfoResponse) ProtoMessage()    {}
+
+func (m *GetServerInfoResponse) GetServerInfo() *ServerInfo {
+	if m != nil {
+		return m.ServerInfo
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterEnum("pb.GetRegionInfoResponse_CompactionState", GetRegionInfoResponse_CompactionState_name, GetRegionInfoResponse_CompactionState_value)
+}
@@ -777,6 +777,7 @@ type Scan struct {
 	Reversed                   *bool            `protobuf:"varint,15,opt,name=reversed,def=0" json:"reversed,omitempty"`
 	Consistency                *Consistency     `protobuf:"varint,16,opt,name=consistency,enum=pb.Consistency,def=0" json:"consistency,omitempty"`
 	Caching                    *uint32          `protobuf:"varint,17,opt,name=caching" json:"caching,omitempty"`
+	NeedCursorResult           *bool            `protobuf:"varint,24,opt,name=need_cursor_result,def=0" json:"need_cursor_result,omitempty"`
 	XXX_unrecognized           []byte           `json:"-"`
 }
 
@@ -788,6 +789,7 @@ const Default_Scan_MaxVersions uint32 = 1
 const Default_Scan_CacheBlocks bool = true
 const Default_Scan_Reversed bool = false
 const Default_Scan_Consistency Consistency = Consistency_STRONG
+const Default_Scan_NeedCursorResult bool = false
 
 func (m *Scan) GetColumn() []*Column {
 	if m != nil {
@@ -908,6 +910,13 @@ func (m *Scan) GetCaching() uint32 {
 	return 0
 }
 
+func (m *Scan) GetNeedCursorResult() bool {
+	if m != nil && m.NeedCursorResult != nil {
+		return *m.NeedCursorResult
+	}
+	return Default_Scan_NeedCursorResult
+}
+
 // *
 // A scan request. Initially, it should specify a scan. Later on, you
 // can use the scanner id returned to fetch result batches with a different
@@ -927,6 +936,8 @@ type ScanRequest struct {
 	NextCallSeq             *uint64          `protobuf:"varint,6,opt,name=next_call_seq" json:"next_call_seq,omitempty"`
 	ClientHandlesPartials   *bool            `protobuf:"varint,7,opt,name=client_handles_partials" json:"client_handles_partials,omitempty"`
 	ClientHandlesHeartbeats *bool            `protobuf:"varint,8,opt,name=client_handles_heartbeats" json:"client_handles_heartbeats,omitempty"`
+	TrackScanMetrics        *bool            `protobuf:"varint,9,opt,name=track_scan_metrics" json:"track_scan_metrics,omitempty"`
+	Renew                   *bool            `protobuf:"varint,10,opt,name=renew,def=0" json:"renew,omitempty"`
 	XXX_unrecognized        []byte           `json:"-"`
 }
 
@@ -934,6 +945,8 @@ func (m *ScanRequest) Reset()         { *m = ScanRequest{} }
 func (m *ScanRequest) String() string { return proto.CompactTextString(m) }
 func (*ScanRequest) ProtoMessage()    {}
 
+const Default_ScanRequest_Renew bool = false
+
 func (m *ScanRequest) GetRegion() *RegionSpecifier {
 	if m != nil {
 		return m.Region
@@ -990,6 +1003,20 @@ func (m *ScanRequest) GetClientHandlesHeartbeats() bool {
 	return false
 }
 
+func (m *ScanRequest) GetTrackScanMetrics() bool {
+	if m != nil && m.TrackScanMetrics != nil {
+		return *m.TrackScanMetrics
+	}
+	return false
+}
+
+func (m *ScanRequest) GetRenew() bool {
+	if m != nil && m.Renew != nil {
+		return *m.Renew
+	}
+	return Default_ScanRequest_Renew
+}
+
 // *
 // The scan response. If there are no more results, more_results will
 // be false.  If it is not specified, it means there are more.
@@ -1026,8 +1053,11 @@ type ScanResponse struct {
 	// Heartbeat messages are sent back to the client to prevent the scanner from
 	// timing out. Seeing a heartbeat message communicates to the Client that the
 	// server would have continued to scan had the time limit not been reached.
-	HeartbeatMessage *bool  `protobuf:"varint,9,opt,name=heartbeat_message" json:"heartbeat_message,omitempty"`
-	XXX_unrecognized []byte `json:"-"`
+	HeartbeatMessage *bool `protobuf:"varint,9,opt,name=heartbeat_message" json:"heartbeat_message,omitempty"`
+	// If the Scan need cursor, return the row key we are scanning in heartbeat message.
+	// If the Scan doesn't need a cursor, don't set this field to reduce network IO.
+	Cursor           *Cursor `protobuf:"bytes,12,opt,name=cursor" json:"cursor,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
 }
 
 func (m *ScanResponse) Reset()         { *m = ScanResponse{} }
@@ -1097,6 +1127,34 @@ func (m *ScanResponse) GetHeartbeatMessage() bool {
 	return false
 }
 
+func (m *ScanResponse) GetCursor() *Cursor {
+	if m != nil {
+		return m.Cursor
+	}
+	return nil
+}
+
+// *
+// Scan cursor to tell client where server is scanning
+// Scan.setNeedCursorResult(true)
+// Result.isCursor()
+// Result.getCursor()
+type Cursor struct {
+	Row              []byte `protobuf:"bytes,1,opt,name=row" json:"row,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *Cursor) Reset()         { *m = Cursor{} }
+func (m *Cursor) String() string { return proto.CompactTextString(m) }
+func (*Cursor) ProtoMessage()    {}
+
+func (m *Cursor) GetRow() []byte {
+	if m != nil {
+		return m.Row
+	}
+	return nil
+}
+
 // *
 // Atomically bulk load multiple HFiles (say from different column families)
 // into an open region.
@@ -800,6 +800,70 @@ func (m *RegionServerInfo) GetInfoPort() int32 {
 	return 0
 }
 
+type RegionExceptionMessage struct {
+	Region           *RegionSpecifier `protobuf:"bytes,1,req,name=region" json:"region,omitempty"`
+	Exception        *NameBytesPair   `protobuf:"bytes,2,req,name=exception" json:"exception,omitempty"`
+	XXX_unrecognized []byte           `json:"-"`
+}
+
+func (m *RegionExceptionMessage) Reset()         { *m = RegionExceptionMessage{} }
+func (m *RegionExceptionMessage) String() string { return proto.CompactTextString(m) }
+func (*RegionExceptionMessage) ProtoMessage()    {}
+
+func (m *RegionExceptionMessage) GetRegion() *RegionSpecifier {
+	if m != nil {
+		return m.Region
+	}
+	return nil
+}
+
+func (m *RegionExceptionMessage) GetException() *NameBytesPair {
+	if m != nil {
+		return m.Exception
+	}
+	return nil
+}
+
+type CacheEvictionStats struct {
+	EvictionCount    *int64                    `protobuf:"varint,1,opt,name=eviction_count" json:"eviction_count,omitempty"`
+	BytesEvicted     *int64                    `protobuf:"varint,2,opt,name=bytes_evicted" json:"bytes_evicted,omitempty"`
+	MaxCacheSize     *int64                    `protobuf:"varint,3,opt,name=max_cache_size" json:"max_cache_size,omitempty"`
+	Exception        []*RegionExceptionMessage `protobuf:"bytes,4,rep,name=exception" json:"exception,omitempty"`
+	XXX_unrecognized []byte                    `json:"-"`
+}
+
+func (m *CacheEvictionStats) Reset()         { *m = CacheEvictionStats{} }
+func (m *CacheEvictionStats) String() string { return proto.CompactTextString(m) }
+func (*CacheEvictionStats) ProtoMessage()    {}
+
+func (m *CacheEvictionStats) GetEvictionCount() int64 {
+	if m != nil && m.EvictionCount != nil {
+		return *m.EvictionCount
+	}
+	return 0
+}
+
+func (m *CacheEvictionStats) GetBytesEvicted() int64 {
+	if m != nil && m.BytesEvicted != nil {
+		return *m.BytesEvicted
+	}
+	return 0
+}
+
+func (m *CacheEvictionStats) GetMaxCacheSize() int64 {
+	if m != nil && m.MaxCacheSize != nil {
+		return *m.MaxCacheSize
+	}
+	return 0
+}
+
+func (m *CacheEvictionStats) GetException() []*RegionExceptionMessage {
+	if m != nil {
+		return m.Exception
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterEnum("pb.CompareType", CompareType_name, CompareType_value)
 	proto.RegisterEnum("pb.TimeUnit", TimeUnit_name, TimeUnit_value)
@@ -819,6 +819,86 @@ func (m *IsBalancerEnabledResponse) GetEnabled() bool {
 	return false
 }
 
+type NormalizeRequest struct {
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *NormalizeRequest) Reset()         { *m = NormalizeRequest{} }
+func (m *NormalizeRequest) String() string { return proto.CompactTextString(m) }
+func (*NormalizeRequest) ProtoMessage()    {}
+
+type NormalizeResponse struct {
+	NormalizerRan    *bool  `protobuf:"varint,1,req,name=normalizer_ran" json:"normalizer_ran,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *NormalizeResponse) Reset()         { *m = NormalizeResponse{} }
+func (m *NormalizeResponse) String() string { return proto.CompactTextString(m) }
+func (*NormalizeResponse) ProtoMessage()    {}
+
+func (m *NormalizeResponse) GetNormalizerRan() bool {
+	if m != nil && m.NormalizerRan != nil {
+		return *m.NormalizerRan
+	}
+	return false
+}
+
+type SetNormalizerRunningRequest struct {
+	On               *bool  `protobuf:"varint,1,req,name=on" json:"on,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *SetNormalizerRunningRequest) Reset()         { *m = SetNormalizerRunningRequest{} }
+func (m *SetNormalizerRunningRequest) String() string { return proto.CompactTextString(m) }
+func (*SetNormalizerRunningRequest) ProtoMessage()    {}
+
+func (m *SetNormalizerRunningRequest) GetOn() bool {
+	if m != nil && m.On != nil {
+		return *m.On
+	}
+	return false
+}
+
+type SetNormalizerRunningResponse struct {
+	PrevNormalizerValue *bool  `protobuf:"varint,1,opt,name=prev_normalizer_value" json:"prev_normalizer_value,omitempty"`
+	XXX_unrecognized    []byte `json:"-"`
+}
+
+func (m *SetNormalizerRunningResponse) Reset()         { *m = SetNormalizerRunningResponse{} }
+func (m *SetNormalizerRunningResponse) String() string { return proto.CompactTextString(m) }
+func (*SetNormalizerRunningResponse) ProtoMessage()    {}
+
+func (m *SetNormalizerRunningResponse) GetPrevNormalizerValue() bool {
+	if m != nil && m.PrevNormalizerValue != nil {
+		return *m.PrevNormalizerValue
+	}
+	return false
+}
+
+type IsNormalizerEnabledRequest struct {
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *IsNormalizerEnabledRequest) Reset()         { *m = IsNormalizerEnabledRequest{} }
+func (m *IsNormalizerEnabledRequest) String() string { return proto.CompactTextString(m) }
+func (*IsNormalizerEnabledRequest) ProtoMessage()    {}
+
+type IsNormalizerEnabledResponse struct {
+	Enabled          *bool  `protobuf:"varint,1,req,name=enabled" json:"enabled,omitempty"`
+	XXX_unrecognized []byte `json:"-"`
+}
+
+func (m *IsNormalizerEnabledResponse) Reset()         { *m = IsNormalizerEnabledResponse{} }
+func (m *IsNormalizerEnabledResponse) String() string { return proto.CompactTextString(m) }
+func (*IsNormalizerEnabledResponse) ProtoMessage()    {}
+
+func (m *IsNormalizerEnabledResponse) GetEnabled() bool {
+	if m != nil && m.Enabled != nil {
+		return *m.Enabled
+	}
+	return false
+}
+
 type RunCatalogScanRequest struct {
 	XXX_unrecognized []byte `json:"-"`
 }
@@ -1545,6 +1625,38 @@ func (m *MajorCompactionTimestampResponse) GetCompactionTimestamp() int64 {
 	return 0
 }
 
+type ClearDeadServersRequest struct {
+	ServerName       []*ServerName `protobuf:"bytes,1,rep,name=server_name" json:"server_name,omitempty"`
+	XXX_unrecognized []byte        `json:"-"`
+}
+
+func (m *ClearDeadServersRequest) Reset()         { *m = ClearDeadServersRequest{} }
+func (m *ClearDeadServersRequest) String() string { return proto.CompactTextString(m) }
+func (*ClearDeadServersRequest) ProtoMessage()    {}
+
+func (m *ClearDeadServersRequest) GetServerName() []*ServerName {
+	if m != nil {
+		return m.ServerName
+	}
+	return nil
+}
+
+type ClearDeadServersResponse struct {
+	ServerName       []*ServerName `protobuf:"bytes,1,rep,name=server_name" json:"server_name,omitempty"`
+	XXX_unrecognized []byte        `json:"-"`
+}
+
+func (m *ClearDeadServersResponse) Reset()         { *m = ClearDeadServersResponse{} }
+func (m *ClearDeadServersResponse) String() string { return proto.CompactTextString(m) }
+func (*ClearDeadServersResponse) ProtoMessage()    {}
+
+func (m *ClearDeadServersResponse) GetServerName() []*ServerName {
+	if m != nil {
+		return m.ServerName
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterEnum("pb.GetProcedureResultResponse_State", GetProcedureResultResponse_State_name, GetProcedureResultResponse_State_value)
 }
@@ -231,7 +231,10 @@ type RequestHeader struct {
 	CellBlockMeta *CellBlockMeta `protobuf:"bytes,5,opt,name=cell_block_meta" json:"cell_block_meta,omitempty"`
 	// 0 is NORMAL priority.  200 is HIGH.  If no priority, treat it as NORMAL.
 	// See HConstants.
-	Priority         *uint32 `protobuf:"varint,6,opt,name=priority" json:"priority,omitempty"`
+	Priority *uint32 `protobuf:"varint,6,opt,name=priority" json:"priority,omitempty"`
+	// How long the client waits for the response, in milliseconds.  The
+	// server doesn't bother with calls whose timeout expired in its queue.
+	Timeout          *uint32 `protobuf:"varint,7,opt,name=timeout" json:"timeout,omitempty"`
 	XXX_unrecognized []byte  `json:"-"`
 }
 
@@ -281,6 +284,13 @@ func (m *RequestHeader) GetPriority() uint32 {
 	return 0
 }
 
+func (m *RequestHeader) GetTimeout() uint32 {
+	if m != nil && m.Timeout != nil {
+		return *m.Timeout
+	}
+	return 0
+}
+
 type ResponseHeader struct {
 	CallId *uint32 `protobuf:"varint,1,opt,name=call_id" json:"call_id,omitempty"`
 	// If present, then request threw an exception and no response message (else we presume one)
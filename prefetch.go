@@ -0,0 +1,82 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"net"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tsuna/gohbase/pb"
+	"golang.org/x/net/context"
+)
+
+// PrefetchRegions looks up all the regions of the given table in hbase:meta
+// and adds them to the region cache, so that requests to the table don't
+// need to look them up one by one.  If the PreConnect option was given, the
+// RegionServers hosting those regions are connected to as well, otherwise
+// the connections are established lazily.
+func (c *client) PrefetchRegions(ctx context.Context, table string) error {
+	rows, err := scanTableMeta(ctx, c, table)
+	if err != nil {
+		return err
+	}
+	return c.cacheMetaRows(ctx, rows)
+}
+
+// Returns the rows of hbase:meta describing the regions of the given table.
+func scanTableMeta(ctx context.Context, c Client, table string) ([]*pb.Result, error) {
+	scan, err := NewMetaScan(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := c.Scan(scan)
+	if err != nil {
+		return nil, err
+	} else if len(rows) == 0 {
+		return nil, ErrTableNotFound
+	}
+	return rows, nil
+}
+
+// Adds the regions described by the given rows of hbase:meta to the cache.
+func (c *client) cacheMetaRows(ctx context.Context, rows []*pb.Result) error {
+	// Regions hosted by the same RegionServer share the same connection.
+	clients := make(map[string]RegionClient)
+	for _, row := range rows {
+		reg, host, port, err := parseMetaRow(row)
+		if err != nil {
+			return err
+		} else if reg.Offline && !reg.Split {
+			// The table is disabled, see discoverRegion.
+			return ErrTableDisabled
+		} else if reg.Offline || host == "" {
+			// The parent of a split is replaced by its daughters, and
+			// regions not assigned are looked up on demand.
+			continue
+		}
+		addr := net.JoinHostPort(host, strconv.Itoa(int(port)))
+		if !c.preConnect {
+			c.warmRegions.put(reg, addr)
+			c.addRegionToCache(reg, nil)
+			continue
+		}
+		client, ok := clients[addr]
+		if !ok {
+			client, err = c.regionClient(ctx, host, port)
+			if err != nil {
+				return err
+			}
+			clients[addr] = client
+		}
+		c.addRegionToCache(reg, client)
+	}
+	log.WithFields(log.Fields{
+		"Regions": len(rows),
+		"Servers": len(clients),
+	}).Debug("Prefetched regions")
+	return nil
+}
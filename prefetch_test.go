@@ -0,0 +1,130 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/region"
+	"github.com/tsuna/gohbase/regioninfo"
+	"golang.org/x/net/context"
+)
+
+// Returns a row of hbase:meta for the given region of table "test".
+func metaRow(startKey, stopKey, server string) *pb.Result {
+	return metaRowWithID(1234567890042, startKey, stopKey, server, false, false)
+}
+
+// Returns a row of hbase:meta for the region of table "test" with the given
+// id, which may be offline or the parent of a split.
+func metaRowWithID(id uint64, startKey, stopKey, server string,
+	offline, split bool) *pb.Result {
+	regionName := []byte(fmt.Sprintf("test,%s,%d.56f833d5569a27c7a43fbf547b4924a4.",
+		startKey, id))
+	info := pb.MustMarshal(&pb.RegionInfo{
+		RegionId: proto.Uint64(id),
+		TableName: &pb.TableName{
+			Namespace: []byte("default"),
+			Qualifier: []byte("test"),
+		},
+		StartKey: []byte(startKey),
+		EndKey:   []byte(stopKey),
+		Offline:  proto.Bool(offline),
+		Split:    proto.Bool(split),
+	})
+	family := []byte("info")
+	return &pb.Result{Cell: []*pb.Cell{
+		&pb.Cell{
+			Row:       regionName,
+			Family:    family,
+			Qualifier: []byte("regioninfo"),
+			// The last 4 bytes are dropped by InfoFromCell.
+			Value: append(append([]byte("PBUF"), info...), "0\x008\x00"...),
+		},
+		&pb.Cell{
+			Row:       regionName,
+			Family:    family,
+			Qualifier: []byte("server"),
+			Value:     []byte(server),
+		},
+	}}
+}
+
+func TestCacheMetaRows(t *testing.T) {
+	savedNewRegion := newRegion
+	defer func() { newRegion = savedNewRegion }()
+	var dials []string
+	newRegion = func(res chan newRegResult, host string, port uint16, queueSize int,
+		queueTimeout time.Duration, options ...region.Option) {
+		dials = append(dials, host)
+		res <- newRegResult{&mockRegionClient{}, nil}
+	}
+	rows := []*pb.Result{
+		metaRow("", "foo", "rs1:16020"),
+		metaRow("foo", "gohbase", "rs2:16020"),
+		metaRow("gohbase", "", "rs1:16020"),
+		metaRow("zzz", "", ""), // Not assigned.
+		// Parent of the regions above.
+		metaRowWithID(1234567890040, "", "", "rs1:16020", true, true),
+	}
+
+	// Without PreConnect, the connections are established lazily.
+	client := newClient("~invalid.quorum~")
+	// Replaced by the regions in hbase:meta since it was cached.
+	stale := &regioninfo.Info{
+		Table:      []byte("test"),
+		RegionName: []byte("test,,1234567890041.56f833d5569a27c7a43fbf547b4924a4."),
+	}
+	client.addRegionToCache(stale, &mockRegionClient{})
+	if err := client.cacheMetaRows(context.Background(), rows); err != nil {
+		t.Fatalf("Failed to cache the rows: %s", err)
+	}
+	if len(dials) != 0 {
+		t.Errorf("Connected to %v without the PreConnect option", dials)
+	}
+	reg := client.getRegion([]byte("test"), []byte("fop"))
+	if reg == nil || string(reg.StopKey) != "gohbase" {
+		t.Fatalf("Found unexpected region %v", reg)
+	}
+	if addr, ok := client.warmRegions.get(reg); !ok || addr != "rs2:16020" {
+		t.Errorf("Expected the region to be on rs2:16020, got %q", addr)
+	}
+	for _, name := range []string{string(stale.RegionName),
+		string(rows[4].Cell[0].Row)} {
+		if _, reg = client.regions.get([]byte(name)); reg != nil &&
+			string(reg.RegionName) == name {
+			t.Errorf("Expected %q not to be cached", name)
+		}
+	}
+	if client.clientFor(stale) != nil {
+		t.Error("Expected the stale region to be forgotten")
+	}
+
+	// With PreConnect, every RegionServer is connected to once.
+	client = newClient("~invalid.quorum~", PreConnect())
+	if err := client.cacheMetaRows(context.Background(), rows); err != nil {
+		t.Fatalf("Failed to cache the rows: %s", err)
+	}
+	if len(dials) != 2 {
+		t.Errorf("Expected 2 connections to be made, got %v", dials)
+	}
+	first := client.clientFor(client.getRegion([]byte("test"), []byte("bar")))
+	last := client.clientFor(client.getRegion([]byte("test"), []byte("xyz")))
+	if first == nil || first != last {
+		t.Error("Regions on the same RegionServer don't share their connection")
+	}
+
+	// The regions of a disabled table are offline.
+	disabled := []*pb.Result{metaRowWithID(1234567890042, "", "", "", true, false)}
+	if err := newClient("~invalid.quorum~").cacheMetaRows(context.Background(),
+		disabled); err != ErrTableDisabled {
+		t.Errorf("Expected ErrTableDisabled, got %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"golang.org/x/net/context"
+)
+
+// ErrTooManyAttempts is returned when a request was sent as many times as
+// allowed by the profile of its table without succeeding.
+var ErrTooManyAttempts = errors.New("too many attempts")
+
+// TableProfile holds the defaults applied to the requests against a table.
+// Those set on a request itself take precedence.
+type TableProfile struct {
+	// Timeout of the requests whose context has no deadline, 0 for none.
+	Timeout time.Duration
+
+	// MaxAttempts is the number of times a request is sent to a
+	// RegionServer before failing with ErrTooManyAttempts, 0 to retry it
+	// until its deadline.
+	MaxAttempts int
+
+	// Consistency required of Gets and Scans, nil for the server's default.
+	Consistency *pb.Consistency
+
+	// CacheBlocks is whether Gets and Scans fill the block cache of the
+	// RegionServers, nil for the server's default.
+	CacheBlocks *bool
+
+	// Durability of the mutations, nil for the table's default.
+	Durability *pb.MutationProto_Durability
+}
+
+// TableDefaults will return an option that applies the given profile to the
+// requests against the given table.  It can be given once per table.
+func TableDefaults(table string, profile TableProfile) Option {
+	return func(c *client) {
+		if c.tableProfiles == nil {
+			c.tableProfiles = make(map[string]TableProfile)
+		}
+		c.tableProfiles[table] = profile
+	}
+}
+
+// Applies the profile of the table of the given RPC to it, and returns the
+// function to call once it's done with to release its context.
+func (c *client) applyProfile(rpc hrpc.Call) context.CancelFunc {
+	c.applyDefaults(rpc)
+	return c.applyTimeout(rpc)
+}
+
+// Sets the options of the profile of the table of the given RPC that aren't
+// set on the RPC itself.
+func (c *client) applyDefaults(rpc hrpc.Call) {
+	p, ok := c.tableProfiles[string(rpc.Table())]
+	if !ok {
+		return
+	}
+	switch rpc := rpc.(type) {
+	case *hrpc.Get:
+		if p.Consistency != nil && rpc.GetConsistency() == nil {
+			hrpc.Consistency(*p.Consistency)(rpc)
+		}
+		if p.CacheBlocks != nil && rpc.GetCacheBlocks() == nil {
+			hrpc.CacheBlocks(*p.CacheBlocks)(rpc)
+		}
+	case *hrpc.Scan:
+		if p.Consistency != nil && rpc.GetConsistency() == nil {
+			hrpc.Consistency(*p.Consistency)(rpc)
+		}
+		if p.CacheBlocks != nil && rpc.GetCacheBlocks() == nil {
+			hrpc.CacheBlocks(*p.CacheBlocks)(rpc)
+		}
+	case *hrpc.Mutate:
+		if p.Durability != nil && rpc.GetDurability() == nil {
+			rpc.SetDurability(*p.Durability)
+		}
+	}
+}
+
+// Gives the given RPC the timeout of the profile of its table, unless its
+// context already has a deadline.  Returns the function releasing the
+// resources of the new context and giving the RPC its own context back, so
+// that it can be sent again.
+func (c *client) applyTimeout(rpc hrpc.Call) context.CancelFunc {
+	p, ok := c.tableProfiles[string(rpc.Table())]
+	if !ok || p.Timeout <= 0 {
+		return func() {}
+	}
+	orig := rpc.GetContext()
+	if _, ok := orig.Deadline(); ok {
+		return func() {}
+	}
+	ctx, cancel := context.WithTimeout(orig, p.Timeout)
+	rpc.SetContext(ctx)
+	return func() {
+		cancel()
+		rpc.SetContext(orig)
+	}
+}
+
+// Sends the given RPC again after it failed with the given error, unless it
+// was already sent as many times as allowed by the profile of its table.
+// Every attempt counts, even those that failed before the RPC was queued on a
+// region client.
+func (c *client) resendRPC(rpc hrpc.Call, err error) (proto.Message, error) {
+	p, ok := c.tableProfiles[string(rpc.Table())]
+	if ok && p.MaxAttempts > 0 && rpc.Metadata().Retries+1 >= p.MaxAttempts {
+		return nil, c.rpcFailed(rpc, ErrTooManyAttempts)
+	}
+	rpc.AddRetry()
+	if c.listener != nil {
+		c.listener.RPCRetried(rpc, err)
+	}
+	return c.sendRPC(rpc)
+}
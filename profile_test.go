@@ -0,0 +1,123 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/regioninfo"
+	"golang.org/x/net/context"
+)
+
+func TestTableDefaults(t *testing.T) {
+	c := newClient("~invalid.quorum~", TableDefaults("test", TableProfile{
+		Timeout:     time.Minute,
+		Consistency: pb.Consistency_TIMELINE.Enum(),
+		CacheBlocks: proto.Bool(false),
+		Durability:  pb.MutationProto_ASYNC_WAL.Enum(),
+	}))
+	ctx := context.Background()
+
+	get, _ := hrpc.NewGetStr(ctx, "test", "row")
+	cancel := c.applyProfile(get)
+	defer cancel()
+	if _, ok := get.GetContext().Deadline(); !ok {
+		t.Error("Expected the Get to be given a deadline")
+	}
+	if cache := get.GetCacheBlocks(); cache == nil || *cache {
+		t.Errorf("Expected CacheBlocks false, got %v", cache)
+	}
+	if cons := get.GetConsistency(); cons == nil || *cons != pb.Consistency_TIMELINE {
+		t.Errorf("Expected TIMELINE consistency, got %v", cons)
+	}
+
+	// Options set on the request take precedence.
+	deadline := time.Now().Add(time.Hour)
+	dctx, dcancel := context.WithDeadline(ctx, deadline)
+	defer dcancel()
+	scan, _ := hrpc.NewScanStr(dctx, "test", hrpc.CacheBlocks(true))
+	cancel = c.applyProfile(scan)
+	defer cancel()
+	if d, _ := scan.GetContext().Deadline(); !d.Equal(deadline) {
+		t.Errorf("Expected deadline %s, got %s", deadline, d)
+	}
+	if cache := scan.GetCacheBlocks(); cache == nil || !*cache {
+		t.Errorf("Expected CacheBlocks true, got %v", cache)
+	}
+
+	put, _ := hrpc.NewPutStr(ctx, "test", "row",
+		map[string]map[string][]byte{"cf": {"a": []byte("1")}})
+	c.applyDefaults(put)
+	if d := put.GetDurability(); d == nil || *d != pb.MutationProto_ASYNC_WAL {
+		t.Errorf("Expected ASYNC_WAL durability, got %v", d)
+	}
+
+	// Requests against other tables are left alone.
+	other, _ := hrpc.NewGetStr(ctx, "other", "row")
+	cancel = c.applyProfile(other)
+	defer cancel()
+	if _, ok := other.GetContext().Deadline(); ok {
+		t.Error("Expected no deadline for a table without a profile")
+	}
+	if other.GetCacheBlocks() != nil || other.GetConsistency() != nil {
+		t.Error("Expected no defaults for a table without a profile")
+	}
+}
+
+func TestTableDefaultsMaxAttempts(t *testing.T) {
+	c := newClient("~invalid.quorum~",
+		TableDefaults("test", TableProfile{MaxAttempts: 3}))
+	// The RPCs are never queued, as when the client of the region is dead,
+	// but the attempts count all the same.
+	mock := &mockRegionClient{err: errors.New("test")}
+	c.addRegionToCache(&regioninfo.Info{
+		Table:      []byte("test"),
+		RegionName: []byte("test,,1234567890042.56f833d5569a27c7a43fbf547b4924a4."),
+		StopKey:    []byte(""),
+	}, mock)
+	ctx, cancel := newTestContext()
+	defer cancel()
+	get, _ := hrpc.NewGetStr(ctx, "test", "row")
+	if _, err := c.Get(get); err != ErrTooManyAttempts {
+		t.Errorf("Expected ErrTooManyAttempts, got %v", err)
+	}
+	if len(mock.queued) != 3 {
+		t.Errorf("Expected 3 attempts, got %d", len(mock.queued))
+	}
+	if md := get.Metadata(); md.Retries != 2 {
+		t.Errorf("Expected 2 retries, got %d", md.Retries)
+	}
+}
+
+func TestTableDefaultsTimeoutReuse(t *testing.T) {
+	c := newClient("~invalid.quorum~",
+		TableDefaults("test", TableProfile{Timeout: time.Minute}))
+	mock := &mockRegionClient{response: &pb.GetResponse{}}
+	c.addRegionToCache(&regioninfo.Info{
+		Table:      []byte("test"),
+		RegionName: []byte("test,,1234567890042.56f833d5569a27c7a43fbf547b4924a4."),
+		StopKey:    []byte(""),
+	}, mock)
+	ctx := context.Background()
+	get, _ := hrpc.NewGetStr(ctx, "test", "row")
+	// The timeout of the first Get mustn't cancel the second one.
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get(get); err != nil {
+			t.Fatalf("Get #%d failed: %s", i, err)
+		}
+		if get.GetContext() != ctx {
+			t.Errorf("Expected the Get #%d to be given its context back", i)
+		}
+	}
+	if len(mock.queued) != 2 {
+		t.Errorf("Expected 2 Gets to be sent, got %d", len(mock.queued))
+	}
+}
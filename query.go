@@ -0,0 +1,129 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"io"
+	"strings"
+
+	"github.com/tsuna/gohbase/filter"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"golang.org/x/net/context"
+)
+
+// Query builds a Scan for the common cases with less boilerplate, e.g.
+//	results, err := gohbase.NewQuery(client, "table").Range("a", "b").
+//		Columns("cf:q1", "cf:q2").Versions(3).Limit(100).Do(ctx)
+//	for result, err := results.Next(); err != io.EOF; result, err = results.Next() {
+//		...
+//	}
+type Query struct {
+	client Client
+	table  string
+
+	startRow, stopRow string
+	families          map[string][]string
+	versions          uint32
+	limit             int
+	filters           []filter.Filter
+}
+
+// NewQuery returns a query scanning the whole given table.
+func NewQuery(c Client, table string) *Query {
+	return &Query{client: c, table: table}
+}
+
+// Range restricts the query to the rows from startRow (inclusive) to stopRow
+// (exclusive).  An empty stopRow means the end of the table.
+func (q *Query) Range(startRow, stopRow string) *Query {
+	q.startRow = startRow
+	q.stopRow = stopRow
+	return q
+}
+
+// Columns restricts the query to the given columns, as "family:qualifier",
+// or "family" for all the columns of a family.
+func (q *Query) Columns(columns ...string) *Query {
+	if q.families == nil {
+		q.families = make(map[string][]string)
+	}
+	for _, column := range columns {
+		colon := strings.IndexByte(column, ':')
+		if colon < 0 {
+			q.families[column] = nil
+			continue
+		}
+		family := column[:colon]
+		q.families[family] = append(q.families[family], column[colon+1:])
+	}
+	return q
+}
+
+// Versions sets the maximum number of versions of each cell to return.
+func (q *Query) Versions(versions uint32) *Query {
+	q.versions = versions
+	return q
+}
+
+// Limit sets the maximum number of rows to return.  0 means no limit.
+func (q *Query) Limit(rows int) *Query {
+	q.limit = rows
+	return q
+}
+
+// Filter adds a filter the rows must pass.  Filters added by multiple calls
+// must all pass.
+func (q *Query) Filter(f filter.Filter) *Query {
+	q.filters = append(q.filters, f)
+	return q
+}
+
+// Do runs the query and returns an iterator over its results.
+func (q *Query) Do(ctx context.Context) (*QueryResults, error) {
+	options := []func(hrpc.Call) error{hrpc.MaxVersions(q.versions)}
+	if q.families != nil {
+		options = append(options, hrpc.Families(q.families))
+	}
+	filters := q.filters
+	if q.limit > 0 {
+		// Spares the RegionServers from returning more rows than needed.
+		filters = append(filters[:len(filters):len(filters)],
+			filter.NewPageFilter(int64(q.limit)))
+	}
+	if len(filters) == 1 {
+		options = append(options, hrpc.Filters(filters[0]))
+	} else if len(filters) > 1 {
+		options = append(options, hrpc.Filters(filter.NewList(filter.MustPassAll, filters...)))
+	}
+	scan, err := hrpc.NewScanRangeStr(ctx, q.table, q.startRow, q.stopRow, options...)
+	if err != nil {
+		return nil, err
+	}
+	results, err := q.client.Scan(scan)
+	if err != nil {
+		return nil, err
+	}
+	if q.limit > 0 && len(results) > q.limit {
+		results = results[:q.limit]
+	}
+	return &QueryResults{results: results}, nil
+}
+
+// QueryResults iterates over the results of a Query.
+type QueryResults struct {
+	results []*pb.Result
+}
+
+// Next returns the next row, or io.EOF once all the rows have been returned.
+func (r *QueryResults) Next() (*pb.Result, error) {
+	if len(r.results) == 0 {
+		return nil, io.EOF
+	}
+	result := r.results[0]
+	r.results = r.results[1:]
+	return result, nil
+}
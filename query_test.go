@@ -0,0 +1,49 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/tsuna/gohbase/hrpc"
+)
+
+func TestQuery(t *testing.T) {
+	_, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+
+	for i := 0; i < 10; i++ {
+		put, _ := hrpc.NewPutStr(ctx, "test", fmt.Sprintf("row%d", i),
+			map[string]map[string][]byte{"cf": {"a": []byte("1"), "b": []byte("2")}})
+		if _, err := c.Put(put); err != nil {
+			t.Fatalf("Put failed: %s", err)
+		}
+	}
+
+	results, err := NewQuery(c, "test").Range("row2", "row8").
+		Columns("cf:a").Versions(3).Limit(4).Do(ctx)
+	if err != nil {
+		t.Fatalf("Query failed: %s", err)
+	}
+	var rows []string
+	for {
+		result, err := results.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("Next failed: %s", err)
+		}
+		if len(result.Cell) != 1 || string(result.Cell[0].Qualifier) != "a" {
+			t.Errorf("Unexpected cells %v", result.Cell)
+		}
+		rows = append(rows, string(result.Cell[0].Row))
+	}
+	if fmt.Sprint(rows) != "[row2 row3 row4 row5]" {
+		t.Errorf("Unexpected rows %v", rows)
+	}
+}
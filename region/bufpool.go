@@ -0,0 +1,75 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Capacity of the largest buffer put back in the pool.  Larger buffers are
+// left to the garbage collector, so that a few large RPCs don't pin a lot of
+// memory.
+const maxPooledBufferSize = 1 << 20
+
+// Buffers the frames of requests and responses are built and read into,
+// shared by all the Clients.  It holds *[]byte rather than []byte, so that
+// putting a buffer back doesn't allocate.
+var bufferPool sync.Pool
+
+// BufferPoolStats are counters of the use of the pool of buffers the frames
+// of requests and responses are built and read into, to tell whether it
+// saves allocations.
+type BufferPoolStats struct {
+	// Gets is the number of buffers requested.
+	Gets uint64
+	// Misses is the number of buffers allocated because the pool had none
+	// large enough.
+	Misses uint64
+	// Puts is the number of buffers put back in the pool.
+	Puts uint64
+	// Oversized is the number of buffers not put back because they were
+	// larger than the pool keeps.
+	Oversized uint64
+}
+
+// Updated atomically.
+var poolStats BufferPoolStats
+
+// PoolStats returns the counters of the pool of buffers shared by all the
+// Clients since the program started.
+func PoolStats() BufferPoolStats {
+	return BufferPoolStats{
+		Gets:      atomic.LoadUint64(&poolStats.Gets),
+		Misses:    atomic.LoadUint64(&poolStats.Misses),
+		Puts:      atomic.LoadUint64(&poolStats.Puts),
+		Oversized: atomic.LoadUint64(&poolStats.Oversized),
+	}
+}
+
+// Returns a buffer of the given size from the pool, or a new one if the pool
+// has none large enough.
+func getBuffer(size int) []byte {
+	atomic.AddUint64(&poolStats.Gets, 1)
+	if size <= maxPooledBufferSize {
+		if buf, ok := bufferPool.Get().(*[]byte); ok && cap(*buf) >= size {
+			return (*buf)[:size]
+		}
+	}
+	atomic.AddUint64(&poolStats.Misses, 1)
+	return make([]byte, size)
+}
+
+// Puts back in the pool a buffer that's no longer used.
+func putBuffer(buf []byte) {
+	if cap(buf) > maxPooledBufferSize {
+		atomic.AddUint64(&poolStats.Oversized, 1)
+		return
+	}
+	atomic.AddUint64(&poolStats.Puts, 1)
+	buf = buf[:0]
+	bufferPool.Put(&buf)
+}
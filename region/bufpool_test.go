@@ -0,0 +1,35 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import "testing"
+
+func TestBufferPool(t *testing.T) {
+	before := PoolStats()
+	buf := getBuffer(100)
+	if len(buf) != 100 {
+		t.Fatalf("Expected a buffer of 100 bytes, got %d", len(buf))
+	}
+	putBuffer(buf)
+	putBuffer(make([]byte, maxPooledBufferSize+1))
+	if buf = getBuffer(maxPooledBufferSize + 1); len(buf) != maxPooledBufferSize+1 {
+		t.Fatalf("Expected a buffer of %d bytes, got %d", maxPooledBufferSize+1, len(buf))
+	}
+
+	after := PoolStats()
+	if gets := after.Gets - before.Gets; gets < 2 {
+		t.Errorf("Expected at least 2 gets, got %d", gets)
+	}
+	if misses := after.Misses - before.Misses; misses < 1 {
+		t.Errorf("Expected the oversized buffer to be a miss, got %d misses", misses)
+	}
+	if puts := after.Puts - before.Puts; puts < 1 {
+		t.Errorf("Expected at least 1 put, got %d", puts)
+	}
+	if oversized := after.Oversized - before.Oversized; oversized < 1 {
+		t.Errorf("Expected at least 1 oversized buffer, got %d", oversized)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"time"
+
+	"github.com/tsuna/gohbase/hrpc"
+)
+
+// A cancelledRPC was failed because its context was done before its response
+// was received.  It keeps its slot among the RPCs in flight until then, see
+// MaxInFlight.
+type cancelledRPC struct {
+	rpc hrpc.Call
+
+	// Deadline of the context of the RPC, or when it was cancelled if it
+	// had none.
+	deadline time.Time
+}
+
+// watchContext starts watching the context of the given RPC, just sent with
+// the given call ID, if it can be done.  sentRPCsMutex must be held.
+func (c *Client) watchContext(id uint32, rpc hrpc.Call) {
+	done := rpc.GetContext().Done()
+	if done == nil {
+		return
+	}
+	answered := make(chan struct{})
+	if c.watchers == nil {
+		c.watchers = make(map[uint32]chan struct{})
+	}
+	c.watchers[id] = answered
+	go c.cancelOnDone(id, rpc, done, answered)
+}
+
+// cancelOnDone fails the RPC with the given call ID with the error of its
+// context once it's done, unless the RPC was answered or failed before.  Its
+// response is then ignored when it's received, and its slot released only
+// then, as the RegionServer is still working on it.
+func (c *Client) cancelOnDone(id uint32, rpc hrpc.Call, done <-chan struct{},
+	answered <-chan struct{}) {
+	select {
+	case <-answered:
+		return
+	case <-done:
+	}
+	c.sentRPCsMutex.Lock()
+	if c.sentRPCs[id] != rpc {
+		c.sentRPCsMutex.Unlock()
+		return
+	}
+	c.forgetRPC(id)
+	// Kept until the response is received, so that the watchdog still
+	// notices if the RegionServer stopped responding.
+	deadline, ok := rpc.GetContext().Deadline()
+	if !ok {
+		deadline = time.Now()
+	}
+	if c.cancelled == nil {
+		c.cancelled = make(map[uint32]cancelledRPC)
+	}
+	c.cancelled[id] = cancelledRPC{rpc: rpc, deadline: deadline}
+	c.sentRPCsMutex.Unlock()
+
+	err := rpc.GetContext().Err()
+	if c.listener != nil {
+		c.listener.RPCResponse(rpc, c.addr(), id, err)
+	}
+	rpc.GetResultChan() <- hrpc.RPCResult{Error: err}
+}
+
+// forgetRPC removes the RPC with the given call ID from those waiting for
+// their response.  sentRPCsMutex must be held.
+func (c *Client) forgetRPC(id uint32) {
+	delete(c.sentRPCs, id)
+	delete(c.sentTimes, id)
+	if answered, ok := c.watchers[id]; ok {
+		close(answered)
+		delete(c.watchers, id)
+	}
+	if c.drained != nil && len(c.sentRPCs) == 0 {
+		close(c.drained)
+		c.drained = nil
+	}
+}
@@ -6,11 +6,18 @@
 package region
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -18,6 +25,7 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/tsuna/gohbase/hrpc"
 	"github.com/tsuna/gohbase/pb"
+	"golang.org/x/net/context"
 )
 
 var (
@@ -29,6 +37,20 @@ var (
 	// request that we didn't send
 	ErrMissingCallID = errors.New("HBase responded to a nonsensical call ID")
 
+	// ErrClientClosed is used when the client was shut down by Close.
+	// The RPCs it didn't get a response to are failed with an
+	// UnrecoverableError wrapping it.
+	ErrClientClosed = errors.New("region client shut down")
+
+	// ErrClientOverloaded is used when an RPC can't be queued because the
+	// queue of the client is full, see MaxQueueDepth.  The RPC isn't sent,
+	// so that the caller can shed load.
+	ErrClientOverloaded = errors.New("RPC queue full, RegionServer overloaded")
+
+	// ErrStuckRPC is used when RPCs have been waiting for their response for
+	// so long past their deadline that the connection is assumed to be wedged
+	ErrStuckRPC = errors.New("RPCs stuck waiting for a response way past their deadline")
+
 	// javaRetryableExceptions is a map where all Java exceptions that signify
 	// the RPC should be sent again are listed (as keys). If a Java exception
 	// listed here is returned by HBase, the client should attempt to resend
@@ -61,27 +83,105 @@ func (e RetryableError) Error() string {
 	return error(e).Error()
 }
 
+// Information about this client reported to RegionServers in the connection
+// header, so that operators can tell gohbase clients and their versions apart
+// in the server logs and metrics.  Version, Revision and BuildDate can be set
+// at link time, e.g.
+// -ldflags "-X github.com/tsuna/gohbase/region.Version=1.2.3".
+var (
+	Version   = "dev"
+	Revision  = "unknown"
+	BuildDate = "unknown"
+)
+
+// Name and source of this client, reported along with its version.
+const (
+	clientName = "gohbase"
+	clientURL  = "https://github.com/tsuna/gohbase"
+)
+
+// Size of the buffer the RPCs of a batch are written into, flushed when full.
+const writeBufferSize = 64 << 10
+
+// Name of the table RPCs are sent in their own lane for.
+var metaTableName = []byte("hbase:meta")
+
 // Client manages a connection to a RegionServer.
 type Client struct {
+	// Counters of the activity of the connection, updated atomically.
+	// First in the struct so that they're 64-bit aligned on 32-bit
+	// platforms.
+	stats Stats
+
+	// Call ID of the last RPC sent, updated atomically.
 	id uint32
 
+	// conn is the connection to the RegionServer.  It's replaced with
+	// sendMutex and writeMutex held when reconnecting, and read with
+	// either of them held.
 	conn net.Conn
 
+	// reader buffers the reads from conn, so that responses fragmented
+	// across TCP segments are reassembled and small reads don't each cost a
+	// system call.  It's only used by the reader goroutine, and while
+	// setting up the connection before it's started.
+	reader *bufio.Reader
+
+	// writer buffers the frames of the RPCs written in a batch, so that
+	// the batch costs a single write to conn once flushed.
+	writer *bufio.Writer
+
+	// sendMutex serializes the RPCs written to writer, by the writer
+	// goroutine or directly by their callers, and protects headerBuf.
+	sendMutex sync.Mutex
+
+	// Whether RPCs are written by the goroutine queuing them, rather than
+	// by the writer goroutine.
+	directSend bool
+
 	// Hostname or IP address of the RegionServer.
 	host string
 
 	// Port of the RegionServer.
 	port uint16
 
-	// writeMutex is used to prevent multiple threads from writing to the
-	// socket at the same time.
+	// writeMutex protects the queue of RPCs written by the writer
+	// goroutine, and whether the client was shut down.
 	writeMutex *sync.Mutex
 
-	// sendErr is set once a write fails.
+	// sendErr is set once the client is shut down, e.g. because a write
+	// failed, and done is closed then.  Both are protected by writeMutex,
+	// so that no RPC is queued once the queue is failed.
 	sendErr error
+	done    chan struct{}
 
+	// Whether the client is reconnecting to the RegionServer, after the
+	// connection failed, and connLost, closed when that happens and
+	// replaced once reconnected.  Both are also protected by writeMutex.
+	reconnecting bool
+	connLost     chan struct{}
+
+	// Bounds of the delay between the attempts to reconnect, 0 if the
+	// client shuts down when the connection fails instead.
+	minReconnectBackoff time.Duration
+	maxReconnectBackoff time.Duration
+
+	// Tracks the writer and reader goroutines of the connection, which
+	// are waited for before reconnecting.
+	loops sync.WaitGroup
+
+	// RPCs queued to be written by the writer goroutine, unless they're
+	// queued by tenant in fair.  Protected by writeMutex.
 	rpcs []hrpc.Call
 
+	// RPCs against hbase:meta, which are sent in their own lane, ahead of
+	// the others, as routing stalls until they're answered.  Protected by
+	// metaMutex, which is never held while acquiring writeMutex.
+	metaMutex sync.Mutex
+	metaRPCs  []hrpc.Call
+	// Receives a value when RPCs are added to metaRPCs.
+	metaReady chan struct{}
+
 	// Once the rpcs list has grown to a large enough size, this channel is
 	// written to to notify the writer thread that it should stop sleeping and
 	// process the list
@@ -92,117 +192,623 @@ type Client struct {
 	sentRPCs      map[uint32]hrpc.Call
 	sentRPCsMutex *sync.Mutex
 
+	// When each of the sentRPCs was written, also protected by
+	// sentRPCsMutex.
+	sentTimes map[uint32]time.Time
+
+	// Closed once no RPC is in flight anymore when Close waits for
+	// that, nil otherwise.  Also protected by sentRPCsMutex.
+	drained chan struct{}
+
+	// Channels closed once each of the sentRPCs whose context can be done
+	// is answered, and RPCs failed because their context was done before
+	// their response was received, by call ID.  Also protected by
+	// sentRPCsMutex.
+	watchers  map[uint32]chan struct{}
+	cancelled map[uint32]cancelledRPC
+
+	// Scratch space the headers of requests are marshaled in, protected by
+	// sendMutex.
+	headerBuf proto.Buffer
+
+	// tuningMutex protects rpcQueueSize and flushInterval, which can be
+	// changed while the client is in use.  It's never held while acquiring
+	// writeMutex.
+	tuningMutex   sync.Mutex
 	rpcQueueSize  int
 	flushInterval time.Duration
+
+	// Number of RPCs queued past which QueueRPC fails with
+	// ErrClientOverloaded, 0 if unbounded.
+	maxQueueDepth int
+
+	// Holds a value for each RPC queued or waiting for its response,
+	// except lookups in hbase:meta, nil if their number is unbounded.
+	slots chan struct{}
+	// Number of slots held by each RPC, more than one if it was queued
+	// again while its slot was held, protected by slotsMutex.
+	slotsMutex  sync.Mutex
+	slotHolders map[hrpc.Call]int
+
+	// How long past its deadline an RPC may wait for its response before
+	// the connection is considered wedged.  0 if disabled.
+	stuckRPCTimeout time.Duration
+
+	// Connects to the RegionServer, nil to resolve its host name and
+	// connect to its addresses with a net.Dialer.
+	dial DialFunc
+
+	// How long connecting to each address of the RegionServer may take, 0
+	// if unbounded.
+	dialTimeout time.Duration
+
+	// Period of the TCP keepalive probes, negative if disabled, 0 for the
+	// default of the platform.
+	keepAlive time.Duration
+
+	// How long the connection may be idle before it's closed, 0 if it's
+	// never closed for being idle.
+	idleTimeout time.Duration
+	// When an RPC was last queued or answered, protected by sentRPCsMutex.
+	lastActivity time.Time
+
+	// Hooks used by tests to inject faults, nil otherwise.
+	faults FaultInjector
+
+	// Name of the RPC service the client talks to.
+	service string
+
+	// User on behalf of whom all the RPCs of this connection are made.
+	effectiveUser string
+
+	// Java classes of the codec and compressor used for cell blocks, empty
+	// if cells are sent as protobufs.
+	codec      string
+	compressor string
+
+	// Queues the RPCs by tenant, nil to queue them in rpcs and write them
+	// in queue order.
+	fair *fairScheduler
+
+	// Notified of the progress of each RPC, nil if none.
+	listener EventListener
+
+	// Returns the configuration of TLS, nil if the connection isn't
+	// encrypted.
+	tlsConfig func() (*tls.Config, error)
+
+	// Returns the certificates presented over TLS, nil to use those of the
+	// TLS configuration.
+	certificates func() ([]tls.Certificate, error)
+
+	// Returns the credentials to authenticate with using SASL, nil to only
+	// use simple authentication.
+	saslCredentials func(addr string) (*SASLCredentials, error)
+
+	// Whether the preamble of the connection was sent before authenticating
+	// with SASL.
+	sentPreamble bool
 }
 
-// NewClient creates a new RegionClient.
-func NewClient(host string, port uint16, queueSize int, flushInterval time.Duration) (*Client, error) {
-	addr := fmt.Sprintf("%s:%d", host, port)
-	conn, err := net.Dial("tcp", addr)
-	if err != nil {
-		return nil,
-			fmt.Errorf("failed to connect to the RegionServer at %s: %s", addr, err)
+// Option is a functional option used to configure a Client.
+type Option func(*Client)
+
+// StuckRPCTimeout will return an option that will set how long past its
+// deadline an RPC may wait for its response before the connection is
+// considered wedged.  When that happens, diagnostics are logged, the client is
+// shut down and all its RPCs are failed with an UnrecoverableError, so that
+// they're retried on a new connection.  A timeout of 0 disables the watchdog.
+func StuckRPCTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.stuckRPCTimeout = timeout
 	}
+}
+
+// Default value of the StuckRPCTimeout option.
+const defaultStuckRPCTimeout = time.Minute
+
+// Names of the RPC services a Client can talk to.
+const (
+	// ClientService is the service of RegionServers serving data.
+	ClientService = "ClientService"
+	// MasterService is the service of the Master serving admin RPCs.
+	MasterService = "MasterService"
+	// AdminService is the service of RegionServers serving admin RPCs.
+	AdminService = "AdminService"
+)
+
+// Service will return an option that will set the RPC service the client
+// talks to, ClientService by default.
+func Service(name string) Option {
+	return func(c *Client) {
+		c.service = name
+	}
+}
+
+// MaxQueueDepth will return an option that will set how many RPCs may be
+// queued waiting to be written before QueueRPC fails with
+// ErrClientOverloaded, which bounds the memory used when the RegionServer
+// can't keep up.  Lookups in hbase:meta are always queued.  A depth of 0, the
+// default, leaves the queue unbounded.
+func MaxQueueDepth(depth int) Option {
+	return func(c *Client) {
+		c.maxQueueDepth = depth
+	}
+}
+
+// DirectSend will return an option that will make the RPCs be written to the
+// connection by the goroutines queuing them, concurrently, rather than
+// batched and written by the writer goroutine.  This saves latency, the flush
+// interval in particular, at the cost of a write per RPC.  The RPCs aren't
+// ordered by FairScheduling then.
+func DirectSend() Option {
+	return func(c *Client) {
+		c.directSend = true
+	}
+}
+
+// EffectiveUser will return an option that will set the user on behalf of
+// whom all the RPCs sent over the connection are made.
+func EffectiveUser(user string) Option {
+	return func(c *Client) {
+		c.effectiveUser = user
+	}
+}
+
+// Default value of the EffectiveUser option.
+const defaultEffectiveUser = "gopher"
+
+// DialFunc connects to the given network address, like net.Dial.
+type DialFunc func(network, address string) (net.Conn, error)
+
+// Dialer will return an option that will set the function used to connect to
+// the RegionServer, such as the Dial method of a net.Dialer binding a source
+// address, or of a SOCKS proxy.  It's given the host name of the RegionServer
+// unresolved, so that a proxy can resolve it, and the KeepAlive and
+// DialTimeout options don't apply to it.  By default, the host name is
+// resolved and each of its addresses is tried in turn.
+func Dialer(dial DialFunc) Option {
+	return func(c *Client) {
+		c.dial = dial
+	}
+}
+
+// DialTimeout will return an option that will set how long connecting to each
+// of the addresses of the RegionServer may take.  A timeout of 0, the
+// default, leaves it up to the operating system.
+func DialTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.dialTimeout = timeout
+	}
+}
+
+// NewClient creates a new RegionClient.
+func NewClient(host string, port uint16, queueSize int, flushInterval time.Duration,
+	options ...Option) (*Client, error) {
 	c := &Client{
-		conn:          conn,
 		host:          host,
 		port:          port,
 		writeMutex:    &sync.Mutex{},
+		done:          make(chan struct{}),
+		connLost:      make(chan struct{}),
 		process:       make(chan struct{}),
 		sentRPCsMutex: &sync.Mutex{},
 		sentRPCs:      make(map[uint32]hrpc.Call),
+		metaReady:     make(chan struct{}, 1),
 		rpcQueueSize:  queueSize,
 		flushInterval: flushInterval,
+
+		stuckRPCTimeout: defaultStuckRPCTimeout,
+		service:         ClientService,
+		effectiveUser:   defaultEffectiveUser,
 	}
-	err = c.sendHello()
+	for _, option := range options {
+		option(c)
+	}
+	if c.codec != "" && codecRejectedBy(c.addr()) {
+		c.codec = ""
+		c.compressor = ""
+	}
+	conn, err := c.open()
 	if err != nil {
 		return nil, err
 	}
-	go c.processRpcs() // Writer goroutine
-	go c.receiveRpcs() // Reader goroutine
+	c.setConn(conn)
+	if err = c.handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.startLoops()
+	if c.stuckRPCTimeout > 0 {
+		go c.watchdog()
+	}
+	if c.idleTimeout > 0 {
+		c.touch()
+		go c.reaper()
+	}
 	return c, nil
 }
 
+// Opens a new connection to the RegionServer, over TLS if configured.
+func (c *Client) open() (net.Conn, error) {
+	conn, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+	if c.tlsConfig != nil {
+		return c.startTLS(conn)
+	}
+	return conn, nil
+}
+
+// Authenticates over the connection with SASL if configured, and sends the
+// connection header.
+func (c *Client) handshake() error {
+	if c.saslCredentials != nil {
+		if err := c.authenticate(); err != nil {
+			return err
+		}
+	}
+	return c.sendHello()
+}
+
+// watchdog periodically looks for RPCs stuck waiting for their response way
+// past their deadline, which happens if the reader goroutine is wedged or the
+// RegionServer stopped responding without the connection being closed.  It
+// keeps watching the new connection when the client reconnects.
+func (c *Client) watchdog() {
+	ticker := time.NewTicker(c.stuckRPCTimeout / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		if c.Err() != nil {
+			return
+		}
+		c.failStuckRPCs()
+	}
+}
+
+// failStuckRPCs shuts down this client, or makes it reconnect, if any RPC has
+// been waiting for its response for longer than stuckRPCTimeout past its
+// deadline, including the RPCs already failed because their context was done.
+// Returns true if that was the case.
+func (c *Client) failStuckRPCs() bool {
+	now := time.Now()
+	var stuck []uint32
+	var oldest time.Duration
+	check := func(id uint32, deadline time.Time) {
+		if late := now.Sub(deadline); late > c.stuckRPCTimeout {
+			stuck = append(stuck, id)
+			if late > oldest {
+				oldest = late
+			}
+		}
+	}
+	c.sentRPCsMutex.Lock()
+	inFlight := len(c.sentRPCs)
+	for id, rpc := range c.sentRPCs {
+		if deadline, ok := rpc.GetContext().Deadline(); ok {
+			check(id, deadline)
+		}
+	}
+	for id, cancelled := range c.cancelled {
+		check(id, cancelled.deadline)
+	}
+	c.sentRPCsMutex.Unlock()
+	if len(stuck) == 0 {
+		return false
+	}
+	log.WithFields(log.Fields{
+		"Host":         c.host,
+		"Port":         c.port,
+		"StuckCallIDs": stuck,
+		"InFlight":     inFlight,
+		"MostOverdue":  oldest,
+	}).Error("RPCs are stuck way past their deadline, recycling the connection")
+	c.fail(ErrStuckRPC)
+	return true
+}
+
+// lookupHost is used to resolve host names, and can be replaced in tests.
+var lookupHost = net.LookupHost
+
+// Opens a connection to the RegionServer, with the dial function set by the
+// Dialer option if any.
+func (c *Client) connect() (net.Conn, error) {
+	if c.dial == nil {
+		return dial(c.host, c.port, net.Dialer{
+			Timeout:   c.dialTimeout,
+			KeepAlive: c.keepAlive,
+		})
+	}
+	addr := net.JoinHostPort(c.host, strconv.Itoa(int(c.port)))
+	conn, err := c.dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the RegionServer at %s: %s",
+			addr, err)
+	}
+	return conn, nil
+}
+
+// dial resolves the host name of the RegionServer and connects to the first of
+// its addresses that accepts the connection.  The name is resolved anew every
+// time, so that a RegionServer whose IP changed (e.g. after its pod got
+// rescheduled) is reachable again once the client reconnects to it.  Each
+// address is connected to with the given dialer.
+func dial(host string, port uint16, dialer net.Dialer) (net.Conn, error) {
+	addrs, err := lookupHost(host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve the RegionServer %s: %s", host, err)
+	}
+	portStr := strconv.Itoa(int(port))
+	for _, addr := range addrs {
+		var conn net.Conn
+		conn, err = dialer.Dial("tcp", net.JoinHostPort(addr, portStr))
+		if err == nil {
+			log.WithFields(log.Fields{
+				"Host": host,
+				"Addr": conn.RemoteAddr(),
+			}).Debug("Connected to RegionServer")
+			return conn, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to connect to the RegionServer at %s: %s",
+		net.JoinHostPort(host, portStr), err)
+}
+
 func (c *Client) processRpcs() {
+	c.writeMutex.Lock()
+	lost := c.connLost
+	c.writeMutex.Unlock()
+	// Whether RPCs were left queued by the last batch, in which case the
+	// next one is written right away.
+	var more bool
 	for {
-		if c.sendErr != nil {
+		if c.Err() != nil {
 			return
 		}
-
 		select {
-		case <-time.After(c.flushInterval):
+		case <-lost:
+			// The RPCs left queued are written once reconnected.
+			return
+		default:
+		}
+
+		if !more {
+			c.tuningMutex.Lock()
+			flushInterval := c.flushInterval
+			c.tuningMutex.Unlock()
 			select {
+			case <-c.metaReady:
+				if !c.sendMetaRPCs(nil) {
+					return
+				}
+				continue
+			case <-time.After(flushInterval):
 			case <-c.process:
-			// If we got a message on c.process at the same time as our
-			// timeout elapsed, we'll non-deterministically land in either
-			// cases of this outer select.  Here we double-check whether
-			// something was written onto c.process, in which case we don't
-			// grab the lock (see comment below in the other case).
-			default:
-				c.writeMutex.Lock()
+				// QueueRPC found the queue full.
+			case <-lost:
+				return
 			}
-		case <-c.process:
-			// We don't acquire the lock here, because the thread that sent
-			// something on the process channel will have locked the mutex,
-			// and will not release it so as to transfer ownership
 		}
 
-		rpcs := make([]hrpc.Call, len(c.rpcs))
-		for i, rpc := range c.rpcs {
-			rpcs[i] = rpc
-		}
-		c.rpcs = nil
+		c.writeMutex.Lock()
+		rpcs := c.nextBatch()
+		more = c.queueLen() > 0
 		c.writeMutex.Unlock()
 
 		for i, rpc := range rpcs {
-			// If the deadline has been exceeded, don't bother sending the
-			// request. The function that placed the RPC in our queue should
-			// stop waiting for a result and return an error.
+			// Lookups in hbase:meta queued meanwhile don't wait for the
+			// rest of the batch.
 			select {
-			case _, ok := <-rpc.GetContext().Done():
-				if !ok {
-					continue
+			case <-c.metaReady:
+				if !c.sendMetaRPCs(rpcs[i:]) {
+					return
 				}
 			default:
 			}
+			if err := c.send(rpc); err != nil {
+				c.sendFailed(err, rpcs[i:])
+				return
+			}
+		}
+		if err := c.flush(); err != nil {
+			c.sendFailed(err, nil)
+			return
+		}
+	}
+}
 
-			err := c.sendRPC(rpc)
-			if err != nil {
-				_, ok := err.(UnrecoverableError)
-				if ok {
-					c.sendErr = err
+// Queues the given RPCs to be written by the writer goroutine.  Must be
+// called with writeMutex held.
+func (c *Client) enqueue(rpcs ...hrpc.Call) {
+	if c.fair == nil {
+		c.rpcs = append(c.rpcs, rpcs...)
+		return
+	}
+	for _, rpc := range rpcs {
+		c.fair.push(rpc)
+	}
+}
 
-					c.writeMutex.Lock()
-					c.rpcs = append(c.rpcs, rpcs[i:]...)
-					c.writeMutex.Unlock()
+// Returns the number of RPCs queued to be written by the writer goroutine.
+// Must be called with writeMutex held.
+func (c *Client) queueLen() int {
+	if c.fair == nil {
+		return len(c.rpcs)
+	}
+	return c.fair.queued
+}
 
-					c.errorEncountered()
-					return
-				}
-				rpc.GetResultChan() <- hrpc.RPCResult{nil, err}
-			}
+// Removes from the queue the RPCs to write in the next batch and returns
+// them: all of them, or up to the queue size with FairScheduling.  Must be
+// called with writeMutex held.
+func (c *Client) nextBatch() []hrpc.Call {
+	if c.fair == nil {
+		return c.dequeueAll()
+	}
+	c.tuningMutex.Lock()
+	size := c.rpcQueueSize
+	c.tuningMutex.Unlock()
+	if size < 1 {
+		size = 1
+	}
+	return c.fair.pop(size)
+}
+
+// Removes all the RPCs from the queue and returns them.  Must be called with
+// writeMutex held.
+func (c *Client) dequeueAll() []hrpc.Call {
+	if c.fair != nil {
+		return c.fair.pop(c.fair.queued)
+	}
+	rpcs := c.rpcs
+	c.rpcs = nil
+	return rpcs
+}
+
+// Sends the RPCs queued in the lane of hbase:meta.  Returns false if the
+// connection failed, in which case they're failed along with the given RPCs
+// not sent yet.
+func (c *Client) sendMetaRPCs(unsent []hrpc.Call) bool {
+	c.metaMutex.Lock()
+	rpcs := c.metaRPCs
+	c.metaRPCs = nil
+	c.metaMutex.Unlock()
+	for i, rpc := range rpcs {
+		if err := c.send(rpc); err != nil {
+			c.sendFailed(err, append(rpcs[i:], unsent...))
+			return false
 		}
 	}
+	if err := c.flush(); err != nil {
+		c.sendFailed(err, unsent)
+		return false
+	}
+	return true
+}
+
+// Writes to the connection the RPCs buffered since the last flush.  Returns
+// an UnrecoverableError if the connection failed.
+func (c *Client) flush() error {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+	buffered := c.writer.Buffered()
+	if err := c.writer.Flush(); err != nil {
+		return UnrecoverableError{err}
+	}
+	if buffered > 0 {
+		atomic.AddUint64(&c.stats.Flushes, 1)
+	}
+	return nil
+}
+
+// Sends the given RPC, unless its deadline has been exceeded.  Returns an
+// UnrecoverableError if the connection failed, other errors are reported to
+// the RPC.
+func (c *Client) send(rpc hrpc.Call) error {
+	// If the deadline has been exceeded, don't bother sending the
+	// request. The function that placed the RPC in our queue should
+	// stop waiting for a result and return an error.
+	select {
+	case _, ok := <-rpc.GetContext().Done():
+		if !ok {
+			c.releaseSlot(rpc)
+			return nil
+		}
+	default:
+	}
+
+	err := c.sendRPC(rpc)
+	if err != nil {
+		if _, ok := err.(UnrecoverableError); ok {
+			return err
+		}
+		atomic.AddUint64(&c.stats.Failures, 1)
+		c.releaseSlot(rpc)
+		rpc.GetResultChan() <- hrpc.RPCResult{nil, err}
+	}
+	return nil
+}
+
+// Shuts the client down after the connection failed with the given error, and
+// fails the given RPCs not sent yet along with all the others, unless it
+// reconnects.
+func (c *Client) sendFailed(err error, unsent []hrpc.Call) {
+	if c.connectionLost(err, unsent) {
+		return
+	}
+	c.writeMutex.Lock()
+	c.setErr(err)
+	c.enqueue(unsent...)
+	c.writeMutex.Unlock()
+
+	c.errorEncountered()
+}
+
+// Sets the error that shuts down this client, unless it was shut down
+// already.  Returns false if it was.  Must be called with writeMutex held.
+func (c *Client) setErr(err error) bool {
+	if c.sendErr != nil {
+		return false
+	}
+	c.sendErr = err
+	close(c.done)
+	return true
+}
+
+// Shuts down this client because of the given error, unless it was shut down
+// already or it reconnects, and fails all its RPCs.
+func (c *Client) fail(err error) {
+	if c.connectionLost(err, nil) {
+		return
+	}
+	c.writeMutex.Lock()
+	c.setErr(err)
+	c.writeMutex.Unlock()
+	c.errorEncountered()
 }
 
 func (c *Client) receiveRpcs() {
 	var sz [4]byte
+	// The frames of responses are read into pooled buffers, which are put
+	// back once the response is decoded, as nothing decoded from a
+	// response points into its frame.
+	var frame []byte
+	defer func() {
+		if frame != nil {
+			putBuffer(frame)
+		}
+	}()
 	for {
+		if frame != nil {
+			putBuffer(frame)
+			frame = nil
+		}
 		err := c.readFully(sz[:])
 		if err != nil {
-			c.sendErr = err
-			c.errorEncountered()
+			// Unless the connection was closed because the client
+			// was shut down already.
+			c.fail(err)
 			return
 		}
 
-		buf := make([]byte, binary.BigEndian.Uint32(sz[:]))
+		frame = getBuffer(int(binary.BigEndian.Uint32(sz[:])))
+		buf := frame
 		err = c.readFully(buf)
 		if err != nil {
-			c.sendErr = err
-			c.errorEncountered()
+			c.fail(err)
 			return
 		}
+		if c.faults != nil {
+			var action FaultAction
+			buf, action = c.faults.OnRead(buf)
+			if action == DropFrame {
+				continue
+			} else if action == KillConnection {
+				c.fail(ErrInjectedFault)
+				return
+			}
+		}
 
 		resp := &pb.ResponseHeader{}
 		respLen, nb := proto.DecodeVarint(buf)
@@ -211,23 +817,44 @@ func (c *Client) receiveRpcs() {
 		buf = buf[respLen:]
 		if err != nil {
 			// Failed to deserialize the response header
-			c.sendErr = err
-			c.errorEncountered()
+			c.fail(err)
+			return
+		}
+		if resp.Exception != nil && isCodecRejection(resp.Exception) {
+			// The RegionServer closes the connection right after this.
+			c.codecRejected(resp.Exception)
+			c.fail(ErrCodecRejected)
 			return
 		}
 		if resp.CallId == nil {
 			// Response doesn't have a call ID
 			log.Error("Response doesn't have a call ID!")
-			c.sendErr = ErrMissingCallID
-			c.errorEncountered()
+			c.fail(ErrMissingCallID)
 			return
 		}
 
 		c.sentRPCsMutex.Lock()
 		rpc, ok := c.sentRPCs[*resp.CallId]
+		cancelled, late := c.cancelled[*resp.CallId]
+		if ok {
+			// Removed right away, so that the RPC can't also be failed
+			// because its context is done.
+			c.forgetRPC(*resp.CallId)
+			if c.idleTimeout > 0 {
+				c.lastActivity = time.Now()
+			}
+		} else if late {
+			// Late response to an RPC already failed with the error of
+			// its context.
+			delete(c.cancelled, *resp.CallId)
+		}
 		c.sentRPCsMutex.Unlock()
 
-		if !ok {
+		if late {
+			// The RPC no longer weighs on the RegionServer.
+			c.releaseSlot(cancelled.rpc)
+			continue
+		} else if !ok {
 			log.WithFields(log.Fields{
 				"CallId": *resp.CallId,
 			}).Error("Received a response with an unexpected call ID")
@@ -239,8 +866,7 @@ func (c *Client) receiveRpcs() {
 			}
 			c.sentRPCsMutex.Unlock()
 
-			c.sendErr = fmt.Errorf("HBase sent a response with an unexpected call ID: %d", resp.CallId)
-			c.errorEncountered()
+			c.fail(fmt.Errorf("HBase sent a response with an unexpected call ID: %d", resp.CallId))
 			return
 		}
 
@@ -249,42 +875,72 @@ func (c *Client) receiveRpcs() {
 			respLen, nb = proto.DecodeVarint(buf)
 			buf = buf[nb:]
 			rpcResp = rpc.NewResponse()
-			err = proto.UnmarshalMerge(buf, rpcResp)
+			err = proto.UnmarshalMerge(buf[:respLen], rpcResp)
 			buf = buf[respLen:]
-		} else {
-			javaClass := *resp.Exception.ExceptionClassName
-			err = fmt.Errorf("HBase Java exception %s: \n%s", javaClass,
-				*resp.Exception.StackTrace)
-			if _, ok := javaRetryableExceptions[javaClass]; ok {
-				// This is a recoverable error. The client should retry.
-				err = RetryableError{err}
+			if err == nil && resp.CellBlockMeta != nil {
+				err = c.decodeCellBlock(buf, rpcResp)
 			}
+		} else {
+			err = exceptionToError(resp.Exception)
+			atomic.AddUint64(&c.stats.Exceptions, 1)
+		}
+		atomic.AddUint64(&c.stats.ResponsesReceived, 1)
+		if c.listener != nil {
+			c.listener.RPCResponse(rpc, c.addr(), *resp.CallId, err)
 		}
+		c.releaseSlot(rpc)
 		rpc.GetResultChan() <- hrpc.RPCResult{rpcResp, err}
-
-		c.sentRPCsMutex.Lock()
-		delete(c.sentRPCs, *resp.CallId)
-		c.sentRPCsMutex.Unlock()
 	}
 }
 
 func (c *Client) errorEncountered() {
 	c.writeMutex.Lock()
 	res := hrpc.RPCResult{nil, UnrecoverableError{c.sendErr}}
-	for _, rpc := range c.rpcs {
+	conn := c.conn
+	queued := c.dequeueAll()
+	for _, rpc := range queued {
+		c.releaseSlot(rpc)
 		rpc.GetResultChan() <- res
 	}
-	c.rpcs = nil
+	atomic.AddUint64(&c.stats.Failures, uint64(len(queued)))
 	c.writeMutex.Unlock()
 
+	c.metaMutex.Lock()
+	for _, rpc := range c.metaRPCs {
+		rpc.GetResultChan() <- res
+	}
+	atomic.AddUint64(&c.stats.Failures, uint64(len(c.metaRPCs)))
+	c.metaRPCs = nil
+	c.metaMutex.Unlock()
+
+	c.failSent(res)
+	conn.Close()
+}
+
+// Fails all the RPCs written to the connection and waiting for their response
+// with the given result.
+func (c *Client) failSent(res hrpc.RPCResult) {
 	c.sentRPCsMutex.Lock()
 	for _, rpc := range c.sentRPCs {
+		c.releaseSlot(rpc)
 		rpc.GetResultChan() <- res
 	}
+	atomic.AddUint64(&c.stats.Failures, uint64(len(c.sentRPCs)))
 	c.sentRPCs = nil
+	c.sentTimes = nil
+	for _, answered := range c.watchers {
+		close(answered)
+	}
+	c.watchers = nil
+	for _, cancelled := range c.cancelled {
+		c.releaseSlot(cancelled.rpc)
+	}
+	c.cancelled = nil
+	if c.drained != nil {
+		close(c.drained)
+		c.drained = nil
+	}
 	c.sentRPCsMutex.Unlock()
-
-	c.conn.Close()
 }
 
 // Sends the given buffer to the RegionServer.
@@ -300,18 +956,17 @@ func (c *Client) write(buf []byte) error {
 		// TODO: Perhaps handle this in another way than closing down
 		return ErrShortWrite
 	}
+	atomic.AddUint64(&c.stats.BytesSent, uint64(n))
 	return nil
 }
 
-// Tries to read enough data to fully fill up the given buffer.
+// Reads enough data to fully fill up the given buffer, across as many reads
+// from the connection as needed.
 func (c *Client) readFully(buf []byte) error {
-	// TODO: Handle short reads.
-	n, err := c.conn.Read(buf)
-	if err != nil {
+	if _, err := io.ReadFull(c.reader, buf); err != nil {
 		return fmt.Errorf("Failed to read from the RS: %s", err)
-	} else if n != len(buf) {
-		return fmt.Errorf("Failed to read everything from the RS: %s", err)
 	}
+	atomic.AddUint64(&c.stats.BytesReceived, uint64(len(buf)))
 	return nil
 }
 
@@ -319,81 +974,358 @@ func (c *Client) readFully(buf []byte) error {
 func (c *Client) sendHello() error {
 	connHeader := &pb.ConnectionHeader{
 		UserInfo: &pb.UserInformation{
-			EffectiveUser: proto.String("gopher"),
+			EffectiveUser: proto.String(c.effectiveUser),
 		},
-		ServiceName: proto.String("ClientService"),
-		//CellBlockCodecClass: "org.apache.hadoop.hbase.codec.KeyValueCodec",
+		ServiceName: proto.String(c.service),
+		VersionInfo: versionInfo(),
+	}
+	if c.codec != "" {
+		connHeader.CellBlockCodecClass = proto.String(c.codec)
+		if c.compressor != "" {
+			connHeader.CellBlockCompressorClass = proto.String(c.compressor)
+		}
 	}
 	data, err := proto.Marshal(connHeader)
 	if err != nil {
 		return fmt.Errorf("failed to marshal connection header: %s", err)
 	}
 
-	const header = "HBas\x00\x50" // \x50 = Simple Auth.
+	header := "HBas\x00\x50" // \x50 = Simple Auth.
+	if c.sentPreamble {
+		// It was sent before authenticating with SASL.
+		header = ""
+	}
 	buf := make([]byte, 0, len(header)+4+len(data))
 	buf = append(buf, header...)
 	buf = buf[:len(header)+4]
-	binary.BigEndian.PutUint32(buf[6:], uint32(len(data)))
+	binary.BigEndian.PutUint32(buf[len(header):], uint32(len(data)))
 	buf = append(buf, data...)
 
 	return c.write(buf)
 }
 
+// Returns the version information sent in the connection header.  All its
+// fields are required, so those we don't know are left empty.
+func versionInfo() *pb.VersionInfo {
+	return &pb.VersionInfo{
+		Version:     proto.String(Version),
+		Url:         proto.String(clientURL),
+		Revision:    proto.String(Revision),
+		User:        proto.String(clientName),
+		Date:        proto.String(BuildDate),
+		SrcChecksum: proto.String(""),
+	}
+}
+
+// Host returns the host name of the RegionServer this client is connected to.
+func (c *Client) Host() string {
+	return c.host
+}
+
+// Port returns the port of the RegionServer this client is connected to.
+func (c *Client) Port() uint16 {
+	return c.port
+}
+
+// Err returns the error that shut down this client, or nil if it's usable.
+func (c *Client) Err() error {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	return c.sendErr
+}
+
+// Close shuts this client down cleanly: new RPCs are rejected with
+// ErrClientClosed, the RPCs queued but not sent yet are failed, and the
+// responses to the RPCs in flight are waited for until the given context is
+// done, after which the RPCs still waiting for their response are failed.
+// The failed RPCs get an UnrecoverableError wrapping ErrClientClosed.  The
+// connection is then closed, which stops the goroutines of the client.
+// Returns the error of the context if it was done before all the responses
+// were received.  Close does nothing if the client was shut down already, by
+// another call or because of an error.
+func (c *Client) Close(ctx context.Context) error {
+	// The queue is taken along with sendErr being set, so that every RPC
+	// is either queued before and failed here, or rejected by QueueRPC.
+	c.writeMutex.Lock()
+	if !c.setErr(ErrClientClosed) {
+		// Shut down already, or being shut down by another call.
+		c.writeMutex.Unlock()
+		return nil
+	}
+	queued := c.dequeueAll()
+	c.metaMutex.Lock()
+	queued = append(queued, c.metaRPCs...)
+	c.metaRPCs = nil
+	c.metaMutex.Unlock()
+	c.writeMutex.Unlock()
+
+	// The writer goroutine stops after the batch it's writing, if any.
+	res := hrpc.RPCResult{Error: UnrecoverableError{ErrClientClosed}}
+	for _, rpc := range queued {
+		c.releaseSlot(rpc)
+		rpc.GetResultChan() <- res
+	}
+	atomic.AddUint64(&c.stats.Failures, uint64(len(queued)))
+
+	c.sentRPCsMutex.Lock()
+	var drained chan struct{}
+	if len(c.sentRPCs) > 0 {
+		drained = make(chan struct{})
+		c.drained = drained
+	}
+	c.sentRPCsMutex.Unlock()
+	var err error
+	if drained != nil {
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	c.errorEncountered()
+	return err
+}
+
+// SetQueueSize changes the number of RPCs queued past which the queue is
+// flushed right away, rather than after the flush interval.  It takes effect
+// with the next RPC queued.
+func (c *Client) SetQueueSize(size int) {
+	c.tuningMutex.Lock()
+	c.rpcQueueSize = size
+	c.tuningMutex.Unlock()
+}
+
+// SetFlushInterval changes how long RPCs may wait in the queue before it's
+// flushed.  It takes effect after the next flush.
+func (c *Client) SetFlushInterval(interval time.Duration) {
+	c.tuningMutex.Lock()
+	c.flushInterval = interval
+	c.tuningMutex.Unlock()
+}
+
+// Returns the "host:port" address of the RegionServer.
+func (c *Client) addr() string {
+	return net.JoinHostPort(c.host, strconv.Itoa(int(c.port)))
+}
+
 // QueueRPC will add an rpc call to the queue for processing by the writer
 // goroutine
 func (c *Client) QueueRPC(rpc hrpc.Call) error {
-	if c.sendErr != nil {
-		return c.sendErr
+	c.writeMutex.Lock()
+	err, reconnecting := c.sendErr, c.reconnecting
+	c.writeMutex.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := c.acquireSlot(rpc); err != nil {
+		return err
+	}
+	c.touch()
+	rpc.StartAttempt(c.addr())
+	if c.listener != nil {
+		c.listener.RPCQueued(rpc, c.addr())
 	}
+	if c.directSend && !reconnecting {
+		// RPCs are queued while reconnecting, and written once
+		// reconnected.
+		err := c.sendDirectly(rpc)
+		if err != nil {
+			c.releaseSlot(rpc)
+		}
+		return err
+	}
+	// sendErr is checked again with the RPC queued atomically, as the
+	// client may have been shut down meanwhile, in which case the queue was
+	// failed already.
 	c.writeMutex.Lock()
-	c.rpcs = append(c.rpcs, rpc)
-	if len(c.rpcs) > c.rpcQueueSize {
-		c.process <- struct{}{}
-		// We don't release the lock here, because we want to transfer ownership
-		// of the lock to the goroutine that processes the RPCs
-	} else {
+	if c.sendErr != nil {
+		err := c.sendErr
 		c.writeMutex.Unlock()
+		c.releaseSlot(rpc)
+		return err
+	}
+	lost := c.connLost
+	if bytes.Equal(rpc.Table(), metaTableName) {
+		c.metaMutex.Lock()
+		c.metaRPCs = append(c.metaRPCs, rpc)
+		c.metaMutex.Unlock()
+		c.writeMutex.Unlock()
+		select {
+		case c.metaReady <- struct{}{}:
+		default:
+		}
+		return nil
+	}
+	if c.maxQueueDepth > 0 && c.queueLen() >= c.maxQueueDepth {
+		c.writeMutex.Unlock()
+		c.releaseSlot(rpc)
+		return ErrClientOverloaded
+	}
+	c.enqueue(rpc)
+	c.tuningMutex.Lock()
+	full := c.queueLen() > c.rpcQueueSize
+	c.tuningMutex.Unlock()
+	c.writeMutex.Unlock()
+	if full {
+		// Wakes up the writer goroutine, and waits for it to take the
+		// next batch.  The lock isn't held meanwhile, so that the writer
+		// can take it to carry on with the RPCs left queued by
+		// FairScheduling.
+		select {
+		case c.process <- struct{}{}:
+		case <-c.done:
+			// The writer goroutine stopped, and the RPC was failed
+			// along with the rest of the queue.
+		case <-lost:
+			// The writer goroutine stopped, and the RPC is written
+			// once reconnected.
+		}
 	}
 	return nil
 }
 
+// Returns how long, in milliseconds, the RegionServer has to answer an RPC
+// with the given context, or nil if it has no deadline.  An RPC past its
+// deadline gets the shortest timeout, so that the RegionServer drops it.
+func timeout(ctx context.Context) *uint32 {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return nil
+	}
+	ms := (deadline.Sub(time.Now()) + time.Millisecond - 1) / time.Millisecond
+	if ms < 1 {
+		ms = 1
+	} else if ms > math.MaxUint32 {
+		ms = math.MaxUint32
+	}
+	return proto.Uint32(uint32(ms))
+}
+
+// Writes the given RPC to the connection right away, in the goroutine of the
+// caller.
+func (c *Client) sendDirectly(rpc hrpc.Call) error {
+	err := c.send(rpc)
+	if err == nil {
+		err = c.flush()
+	}
+	if err == nil {
+		return nil
+	}
+	// RPCs sent before the connection failed are failed along with the
+	// others in flight.
+	c.sentRPCsMutex.Lock()
+	var sent bool
+	for _, other := range c.sentRPCs {
+		if other == rpc {
+			sent = true
+			break
+		}
+	}
+	c.sentRPCsMutex.Unlock()
+	if !sent && c.connectionLost(err, []hrpc.Call{rpc}) {
+		// Written once reconnected.
+		return nil
+	}
+	c.sendFailed(err, nil)
+	if sent {
+		return nil
+	}
+	return err
+}
+
 // sendRPC sends an RPC out to the wire.
 // Returns the response (for now, as the call is synchronous).
 func (c *Client) sendRPC(rpc hrpc.Call) error {
+	rpc.EndQueueWait()
 	// Header.
-	c.id++
+	id := atomic.AddUint32(&c.id, 1)
 	reqheader := &pb.RequestHeader{
-		CallId:       &c.id,
+		CallId:       proto.Uint32(id),
 		MethodName:   proto.String(rpc.GetName()),
 		RequestParam: proto.Bool(true),
+		Timeout:      timeout(rpc.GetContext()),
+	}
+	if priority := rpc.Priority(); priority != hrpc.NormalPriority {
+		reqheader.Priority = proto.Uint32(priority)
+	} else if bytes.Equal(rpc.Table(), metaTableName) {
+		// Routing stalls until lookups in hbase:meta are answered.
+		reqheader.Priority = proto.Uint32(hrpc.HighPriority)
 	}
 
-	payload, err := rpc.Serialize()
+	// The payload is serialized before taking sendMutex, so that RPCs sent
+	// directly by their callers are serialized concurrently.
+	payload, cellBlock, err := c.serialize(rpc)
 	if err != nil {
 		return fmt.Errorf("Failed to serialize RPC: %s", err)
 	}
-	payloadLen := proto.EncodeVarint(uint64(len(payload)))
+	if cellBlock != nil {
+		reqheader.CellBlockMeta = &pb.CellBlockMeta{
+			Length: proto.Uint32(uint32(len(cellBlock))),
+		}
+	}
 
-	headerData, err := proto.Marshal(reqheader)
-	if err != nil {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+	// The header is marshaled in scratch space reused by the following
+	// RPCs.
+	c.headerBuf.Reset()
+	if err = c.headerBuf.Marshal(reqheader); err != nil {
 		return fmt.Errorf("Failed to marshal Get request: %s", err)
 	}
+	headerData := c.headerBuf.Bytes()
 
-	buf := make([]byte, 5, 4+1+len(headerData)+len(payloadLen)+len(payload))
-	binary.BigEndian.PutUint32(buf, uint32(cap(buf)-4))
-	buf[4] = byte(len(headerData))
+	frame := getBuffer(4 + 2*binary.MaxVarintLen32 + len(headerData) + len(payload) +
+		len(cellBlock))
+	defer putBuffer(frame)
+	var varint [binary.MaxVarintLen32]byte
+	buf := frame[:4]
+	buf = append(buf, varint[:binary.PutUvarint(varint[:], uint64(len(headerData)))]...)
 	buf = append(buf, headerData...)
-	buf = append(buf, payloadLen...)
+	buf = append(buf, varint[:binary.PutUvarint(varint[:], uint64(len(payload)))]...)
 	buf = append(buf, payload...)
+	buf = append(buf, cellBlock...)
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+
+	var action FaultAction
+	if c.faults != nil {
+		buf, action = c.faults.OnWrite(rpc, buf)
+		if action == KillConnection {
+			c.conn.Close()
+			return UnrecoverableError{ErrInjectedFault}
+		}
+	}
 
 	c.sentRPCsMutex.Lock()
-	c.sentRPCs[c.id] = rpc
+	if c.sentRPCs == nil {
+		// The client was shut down by the reader goroutine or the
+		// watchdog, or is reconnecting.
+		c.sentRPCsMutex.Unlock()
+		err = c.Err()
+		if err == nil {
+			err = ErrConnectionLost
+		}
+		return UnrecoverableError{err}
+	}
+	c.sentRPCs[id] = rpc
+	if c.sentTimes == nil {
+		c.sentTimes = make(map[uint32]time.Time)
+	}
+	c.sentTimes[id] = time.Now()
+	c.watchContext(id, rpc)
 	c.sentRPCsMutex.Unlock()
+	if c.listener != nil {
+		c.listener.RPCSent(rpc, c.addr(), id)
+	}
 
-	err = c.write(buf)
-	if err != nil {
+	if action == DropFrame {
+		return nil
+	}
+	// Written to the connection when the batch is flushed.
+	if _, err = c.writer.Write(buf); err != nil {
 		return UnrecoverableError{err}
 	}
+	atomic.AddUint64(&c.stats.BytesSent, uint64(len(buf)))
+	atomic.AddUint64(&c.stats.RPCsSent, 1)
 
 	return nil
 }
@@ -0,0 +1,938 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/regioninfo"
+	"golang.org/x/net/context"
+)
+
+func TestDialResolvesEveryTime(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	defer ln.Close()
+	port := uint16(ln.Addr().(*net.TCPAddr).Port)
+
+	savedLookupHost := lookupHost
+	defer func() { lookupHost = savedLookupHost }()
+	var lookups int
+	var addrs []string
+	lookupHost = func(host string) ([]string, error) {
+		if host != "regionserver" {
+			t.Errorf("Unexpected lookup of %q", host)
+		}
+		lookups++
+		return addrs, nil
+	}
+
+	// Nothing listens on the first address, the second one must be tried.
+	addrs = []string{"127.0.0.2", "127.0.0.1"}
+	conn, err := dial("regionserver", port, net.Dialer{})
+	if err != nil {
+		t.Fatalf("Failed to dial: %s", err)
+	}
+	conn.Close()
+
+	// The RegionServer "moved" and nothing listens at its address anymore.
+	addrs = []string{"127.0.0.2"}
+	if conn, err = dial("regionserver", port, net.Dialer{}); err == nil {
+		conn.Close()
+		t.Error("Dial succeeded even though the host resolved to a dead address")
+	}
+	if lookups != 2 {
+		t.Errorf("Expected the host to be resolved twice, got %d lookups", lookups)
+	}
+}
+
+func TestDialer(t *testing.T) {
+	savedLookupHost := lookupHost
+	defer func() { lookupHost = savedLookupHost }()
+	lookupHost = func(host string) ([]string, error) {
+		t.Errorf("Unexpected lookup of %q", host)
+		return nil, nil
+	}
+
+	conn, server := net.Pipe()
+	defer server.Close()
+	var dialed []string
+	c := &Client{host: "regionserver", port: 16020}
+	Dialer(func(network, address string) (net.Conn, error) {
+		dialed = append(dialed, network+" "+address)
+		return conn, nil
+	})(c)
+	got, err := c.connect()
+	if err != nil {
+		t.Fatalf("Failed to dial: %s", err)
+	}
+	if got != conn {
+		t.Errorf("Expected the connection of the dialer, got %v", got)
+	}
+	if len(dialed) != 1 || dialed[0] != "tcp regionserver:16020" {
+		t.Errorf("Expected the dialer to be given the host name, got %v", dialed)
+	}
+}
+
+// Returns a client connected to one end of an in-memory pipe, without any of
+// its goroutines running.
+func newPipeClient() (*Client, net.Conn) {
+	conn, server := net.Pipe()
+	return &Client{
+		conn:            conn,
+		reader:          bufio.NewReader(conn),
+		writer:          bufio.NewWriter(conn),
+		host:            "regionserver",
+		port:            16020,
+		writeMutex:      &sync.Mutex{},
+		done:            make(chan struct{}),
+		process:         make(chan struct{}),
+		sentRPCsMutex:   &sync.Mutex{},
+		sentRPCs:        make(map[uint32]hrpc.Call),
+		metaReady:       make(chan struct{}, 1),
+		stuckRPCTimeout: time.Minute,
+		effectiveUser:   defaultEffectiveUser,
+	}, server
+}
+
+// Writes the given RPC to the connection right away.
+func sendAndFlush(c *Client, rpc hrpc.Call) error {
+	if err := c.sendRPC(rpc); err != nil {
+		return err
+	}
+	return c.flush()
+}
+
+func TestFailStuckRPCs(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-30*time.Second))
+	defer cancel()
+	late, _ := hrpc.NewGetStr(ctx, "test", "late")
+	onTime, _ := hrpc.NewGetStr(context.Background(), "test", "onTime")
+	c.sentRPCs[1] = late
+	c.sentRPCs[2] = onTime
+	if c.failStuckRPCs() {
+		t.Fatal("RPCs 30s past their deadline were considered stuck")
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-2*time.Minute))
+	defer cancel()
+	stuck, _ := hrpc.NewGetStr(ctx, "test", "stuck")
+	c.sentRPCs[3] = stuck
+	if !c.failStuckRPCs() {
+		t.Fatal("RPCs 2 minutes past their deadline weren't considered stuck")
+	}
+	for _, rpc := range []hrpc.Call{late, onTime, stuck} {
+		select {
+		case res := <-rpc.GetResultChan():
+			if _, ok := res.Error.(UnrecoverableError); !ok {
+				t.Errorf("Expected an UnrecoverableError, got %v", res.Error)
+			}
+		default:
+			t.Errorf("RPC for %q wasn't failed", rpc.Key())
+		}
+	}
+	if err := c.QueueRPC(onTime); err != ErrStuckRPC {
+		t.Errorf("Expected QueueRPC to fail with ErrStuckRPC, got %v", err)
+	}
+}
+
+func TestSetQueueSize(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	c.SetQueueSize(1)
+	c.SetFlushInterval(time.Hour)
+
+	flushed := make(chan struct{})
+	go func() {
+		<-c.process
+		close(flushed)
+	}()
+	get, _ := hrpc.NewGetStr(context.Background(), "test", "a")
+	if err := c.QueueRPC(get); err != nil {
+		t.Fatalf("Failed to queue RPC: %s", err)
+	}
+	select {
+	case <-flushed:
+		t.Fatal("Queue flushed before being full")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	c.SetQueueSize(0)
+	get, _ = hrpc.NewGetStr(context.Background(), "test", "b")
+	if err := c.QueueRPC(get); err != nil {
+		t.Fatalf("Failed to queue RPC: %s", err)
+	}
+	select {
+	case <-flushed:
+	case <-time.After(time.Second):
+		t.Fatal("Queue not flushed once over the new size")
+	}
+}
+
+func TestMetaLane(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	c.SetQueueSize(100)
+	c.SetFlushInterval(time.Hour)
+	go c.processRpcs()
+
+	ctx := context.Background()
+	get, _ := hrpc.NewGetStr(ctx, "test", "queued")
+	get.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+	if err := c.QueueRPC(get); err != nil {
+		t.Fatalf("Failed to queue RPC: %s", err)
+	}
+	meta, _ := hrpc.NewGetStr(ctx, "hbase:meta", "test,,:")
+	meta.SetRegion(&regioninfo.Info{RegionName: []byte("hbase:meta,,1")})
+	if err := c.QueueRPC(meta); err != nil {
+		t.Fatalf("Failed to queue RPC: %s", err)
+	}
+
+	// The lookup is written right away, while the other RPC waits for the
+	// queue to be flushed.
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	var length [4]byte
+	if _, err := io.ReadFull(server, length[:]); err != nil {
+		t.Fatalf("The lookup in hbase:meta wasn't sent: %s", err)
+	}
+	if _, err := io.ReadFull(server, make([]byte, binary.BigEndian.Uint32(length[:]))); err != nil {
+		t.Fatalf("Failed to read the lookup: %s", err)
+	}
+	c.sentRPCsMutex.Lock()
+	sent := c.sentRPCs[atomic.LoadUint32(&c.id)]
+	c.sentRPCsMutex.Unlock()
+	if sent != meta {
+		t.Errorf("Expected the lookup in hbase:meta to be sent, got %v", sent)
+	}
+	if depth := c.State().QueueDepth; depth != 1 {
+		t.Errorf("Expected 1 RPC queued, got %d", depth)
+	}
+}
+
+func TestState(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	queued, _ := hrpc.NewGetStr(context.Background(), "test", "queued")
+	c.rpcs = append(c.rpcs, queued)
+	sent, _ := hrpc.NewGetStr(context.Background(), "test", "sent")
+	c.sentRPCs[42] = sent
+	c.sentTimes = map[uint32]time.Time{42: time.Now().Add(-time.Second)}
+
+	st := c.State()
+	if st.Host != "regionserver" || st.Port != 16020 || st.Err != nil ||
+		st.QueueDepth != 1 {
+		t.Errorf("Unexpected state %+v", st)
+	}
+	if len(st.InFlight) != 1 {
+		t.Fatalf("Expected 1 RPC in flight, got %d", len(st.InFlight))
+	}
+	rpc := st.InFlight[0]
+	if rpc.CallID != 42 || rpc.Name != "Get" || string(rpc.Key) != "sent" ||
+		rpc.Age < time.Second {
+		t.Errorf("Unexpected in-flight RPC %+v", rpc)
+	}
+}
+
+func TestStats(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	done := make(chan struct{})
+	go func() {
+		c.receiveRpcs()
+		close(done)
+	}()
+
+	var calls []hrpc.Call
+	for _, key := range []string{"ok", "exception"} {
+		get, _ := hrpc.NewGetStr(context.Background(), "test", key)
+		get.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+		errs := make(chan error, 1)
+		go func() { errs <- sendAndFlush(c, get) }()
+		if _, _, _, err := readRequest(server); err != nil {
+			t.Fatalf("Failed to read the request: %s", err)
+		}
+		if err := <-errs; err != nil {
+			t.Fatalf("Failed to send the RPC: %s", err)
+		}
+		calls = append(calls, get)
+	}
+	queued, _ := hrpc.NewGetStr(context.Background(), "test", "queued")
+	c.writeMutex.Lock()
+	c.rpcs = append(c.rpcs, queued)
+	c.writeMutex.Unlock()
+
+	st := c.Stats()
+	if st.RPCsSent != 2 || st.Flushes != 2 || st.BytesSent == 0 ||
+		st.RPCsQueued != 1 || st.RPCsInFlight != 2 {
+		t.Errorf("Unexpected stats after sending %+v", st)
+	}
+
+	var received int
+	for _, header := range []*pb.ResponseHeader{
+		{CallId: proto.Uint32(1)},
+		{
+			CallId: proto.Uint32(2),
+			Exception: &pb.ExceptionResponse{
+				ExceptionClassName: proto.String("java.io.IOException"),
+			},
+		},
+	} {
+		headerData, _ := proto.Marshal(header)
+		buf := make([]byte, 4)
+		buf = append(buf, proto.EncodeVarint(uint64(len(headerData)))...)
+		buf = append(buf, headerData...)
+		if header.Exception == nil {
+			payload, _ := proto.Marshal(&pb.GetResponse{})
+			buf = append(buf, proto.EncodeVarint(uint64(len(payload)))...)
+			buf = append(buf, payload...)
+		}
+		binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+		if _, err := server.Write(buf); err != nil {
+			t.Fatalf("Failed to write the response: %s", err)
+		}
+		received += len(buf)
+	}
+	for _, call := range calls {
+		<-call.GetResultChan()
+	}
+	// The queued RPC fails along with the connection.
+	server.Close()
+	<-queued.GetResultChan()
+	<-done
+
+	st = c.Stats()
+	if st.ResponsesReceived != 2 || st.Exceptions != 1 || st.Failures != 1 ||
+		st.BytesReceived != uint64(received) || st.RPCsQueued != 0 ||
+		st.RPCsInFlight != 0 {
+		t.Errorf("Unexpected stats after receiving %+v", st)
+	}
+}
+
+// Reads the connection header sent by the client on the other end of conn.
+func readConnectionHeader(conn net.Conn) (*pb.ConnectionHeader, error) {
+	var preamble [6 + 4]byte
+	if _, err := io.ReadFull(conn, preamble[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint32(preamble[6:]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+	header := &pb.ConnectionHeader{}
+	return header, proto.Unmarshal(buf, header)
+}
+
+func TestSendHelloVersionInfo(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	c.service = ClientService
+
+	savedVersion := Version
+	defer func() { Version = savedVersion }()
+	Version = "1.2.3"
+	errs := make(chan error, 1)
+	go func() { errs <- c.sendHello() }()
+	header, err := readConnectionHeader(server)
+	if err != nil {
+		t.Fatalf("Failed to read the connection header: %s", err)
+	}
+	if err = <-errs; err != nil {
+		t.Fatalf("Failed to send the connection header: %s", err)
+	}
+	info := header.GetVersionInfo()
+	if info.GetVersion() != "1.2.3" || info.GetUser() != "gohbase" ||
+		info.GetUrl() != "https://github.com/tsuna/gohbase" {
+		t.Errorf("Unexpected version info in the connection header: %s", info)
+	}
+}
+
+func TestFragmentedResponses(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	go c.receiveRpcs()
+
+	var frames []byte
+	var gets []*hrpc.Get
+	for i, value := range []string{"a large value", "small"} {
+		get, _ := hrpc.NewGetStr(context.Background(), "test", "row")
+		c.sentRPCs[uint32(i)] = get
+		gets = append(gets, get)
+		header, _ := proto.Marshal(&pb.ResponseHeader{CallId: proto.Uint32(uint32(i))})
+		payload, _ := proto.Marshal(&pb.GetResponse{Result: &pb.Result{
+			Cell: []*pb.Cell{{Value: []byte(value)}},
+		}})
+		buf := make([]byte, 4)
+		buf = append(buf, proto.EncodeVarint(uint64(len(header)))...)
+		buf = append(buf, header...)
+		buf = append(buf, proto.EncodeVarint(uint64(len(payload)))...)
+		buf = append(buf, payload...)
+		binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+		frames = append(frames, buf...)
+	}
+	// Each write is a separate read on the other end of the pipe.
+	go func() {
+		for i := range frames {
+			if _, err := server.Write(frames[i : i+1]); err != nil {
+				return
+			}
+		}
+	}()
+
+	// The buffer the second response is read into is the one of the
+	// first, which mustn't be overwritten.
+	var values []string
+	for _, get := range gets {
+		res := <-get.GetResultChan()
+		if res.Error != nil {
+			t.Fatalf("Get failed: %s", res.Error)
+		}
+		values = append(values, string(res.Msg.(*pb.GetResponse).Result.Cell[0].Value))
+	}
+	if values[0] != "a large value" || values[1] != "small" {
+		t.Errorf("Unexpected values %q", values)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	withDeadline, _ := hrpc.NewGetStr(ctx, "test", "row")
+	withoutDeadline, _ := hrpc.NewGetStr(context.Background(), "test", "row")
+	pastCtx, pastCancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer pastCancel()
+	expired, _ := hrpc.NewGetStr(pastCtx, "test", "row")
+
+	for _, testcase := range []struct {
+		get      *hrpc.Get
+		min, max uint32
+	}{
+		{withDeadline, 9000, 10000},
+		{withoutDeadline, 0, 0},
+		{expired, 1, 1},
+	} {
+		c, server := newPipeClient()
+		testcase.get.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+		errs := make(chan error, 1)
+		go func() { errs <- sendAndFlush(c, testcase.get) }()
+		header, _, _, err := readRequest(server)
+		server.Close()
+		if err != nil {
+			t.Fatalf("Failed to read the request: %s", err)
+		}
+		if err = <-errs; err != nil {
+			t.Fatalf("Failed to send the request: %s", err)
+		}
+		if timeout := header.GetTimeout(); timeout < testcase.min || timeout > testcase.max {
+			t.Errorf("Expected a timeout between %d and %d ms, got %d",
+				testcase.min, testcase.max, timeout)
+		}
+		if testcase.max == 0 && header.Timeout != nil {
+			t.Errorf("Expected no timeout, got %d", header.GetTimeout())
+		}
+	}
+}
+
+// Counts the writes made to a connection.
+type countingConn struct {
+	net.Conn
+
+	m      sync.Mutex
+	writes int
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	c.m.Lock()
+	c.writes++
+	c.m.Unlock()
+	return c.Conn.Write(b)
+}
+
+func TestBatchedWrites(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	conn := &countingConn{Conn: c.conn}
+	c.conn = conn
+	c.writer = bufio.NewWriter(conn)
+	c.rpcQueueSize = 100
+	c.flushInterval = time.Millisecond
+
+	for i := 0; i < 3; i++ {
+		get, _ := hrpc.NewGetStr(context.Background(), "test", "row")
+		get.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+		if err := c.QueueRPC(get); err != nil {
+			t.Fatalf("Failed to queue the RPC: %s", err)
+		}
+	}
+	go c.processRpcs()
+	for i := 0; i < 3; i++ {
+		if _, _, _, err := readRequest(server); err != nil {
+			t.Fatalf("Failed to read request #%d: %s", i, err)
+		}
+	}
+	conn.m.Lock()
+	writes := conn.writes
+	conn.m.Unlock()
+	if writes != 1 {
+		t.Errorf("Expected the batch to be written at once, got %d writes", writes)
+	}
+}
+
+func TestDirectSend(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	DirectSend()(c)
+
+	// No writer goroutine is running, the callers write their RPCs.
+	const n = 10
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			get, _ := hrpc.NewGetStr(context.Background(), "test", "row")
+			get.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+			errs <- c.QueueRPC(get)
+		}()
+	}
+	ids := make(map[uint32]struct{})
+	for i := 0; i < n; i++ {
+		header, _, _, err := readRequest(server)
+		if err != nil {
+			t.Fatalf("Failed to read request #%d: %s", i, err)
+		}
+		ids[header.GetCallId()] = struct{}{}
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("Failed to send the RPC: %s", err)
+		}
+	}
+	if len(ids) != n {
+		t.Errorf("Expected %d distinct call IDs, got %d", n, len(ids))
+	}
+	c.sentRPCsMutex.Lock()
+	inFlight := len(c.sentRPCs)
+	c.sentRPCsMutex.Unlock()
+	if inFlight != n {
+		t.Errorf("Expected %d RPCs in flight, got %d", n, inFlight)
+	}
+}
+
+func TestMaxQueueDepth(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	c.rpcQueueSize = 100
+	MaxQueueDepth(2)(c)
+
+	for i := 0; i < 2; i++ {
+		get, _ := hrpc.NewGetStr(context.Background(), "test", "row")
+		if err := c.QueueRPC(get); err != nil {
+			t.Fatalf("Failed to queue RPC #%d: %s", i, err)
+		}
+	}
+	get, _ := hrpc.NewGetStr(context.Background(), "test", "row")
+	if err := c.QueueRPC(get); err != ErrClientOverloaded {
+		t.Errorf("Expected ErrClientOverloaded, got %v", err)
+	}
+	// Lookups in hbase:meta aren't subject to the limit.
+	meta, _ := hrpc.NewGetStr(context.Background(), "hbase:meta", "row")
+	if err := c.QueueRPC(meta); err != nil {
+		t.Errorf("Failed to queue the lookup in hbase:meta: %s", err)
+	}
+}
+
+func TestMaxInFlight(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	c.rpcQueueSize = 100
+	c.flushInterval = time.Millisecond
+	MaxInFlight(1)(c)
+	go c.processRpcs()
+	go c.receiveRpcs()
+
+	first, _ := hrpc.NewGetStr(context.Background(), "test", "first")
+	first.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+	if err := c.QueueRPC(first); err != nil {
+		t.Fatalf("Failed to queue the RPC: %s", err)
+	}
+	if _, _, _, err := readRequest(server); err != nil {
+		t.Fatalf("Failed to read the request: %s", err)
+	}
+
+	// No room is made before the deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	late, _ := hrpc.NewGetStr(ctx, "test", "late")
+	late.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+	if err := c.QueueRPC(late); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	// Lookups in hbase:meta aren't subject to the limit.
+	meta, _ := hrpc.NewGetStr(context.Background(), "hbase:meta", "row")
+	meta.SetRegion(&regioninfo.Info{RegionName: []byte("hbase:meta,,1")})
+	if err := c.QueueRPC(meta); err != nil {
+		t.Errorf("Failed to queue the lookup in hbase:meta: %s", err)
+	}
+	if _, _, _, err := readRequest(server); err != nil {
+		t.Fatalf("Failed to read the lookup: %s", err)
+	}
+
+	next, _ := hrpc.NewGetStr(context.Background(), "test", "next")
+	next.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+	errs := make(chan error, 1)
+	go func() { errs <- c.QueueRPC(next) }()
+	select {
+	case err := <-errs:
+		t.Fatalf("QueueRPC returned while the RPC in flight wasn't answered: %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	writeGetResponse(t, server, 1)
+	if res := <-first.GetResultChan(); res.Error != nil {
+		t.Errorf("Expected the first RPC to succeed, got %v", res.Error)
+	}
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Errorf("Failed to queue the RPC: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("QueueRPC still blocked once the RPC in flight was answered")
+	}
+	if _, _, _, err := readRequest(server); err != nil {
+		t.Fatalf("Failed to read the request: %s", err)
+	}
+}
+
+func TestReleaseSlotOnce(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	MaxInFlight(2)(c)
+	a, _ := hrpc.NewGetStr(context.Background(), "test", "a")
+	a.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+	b, _ := hrpc.NewGetStr(context.Background(), "test", "b")
+	b.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+	for _, rpc := range []hrpc.Call{a, b} {
+		if err := c.acquireSlot(rpc); err != nil {
+			t.Fatalf("Failed to acquire a slot: %s", err)
+		}
+	}
+	// Releasing the slot of an RPC twice doesn't release that of another.
+	c.releaseSlot(a)
+	c.releaseSlot(a)
+	if n := len(c.slots); n != 1 {
+		t.Errorf("Expected 1 slot held, got %d", n)
+	}
+	c.releaseSlot(b)
+	if n := len(c.slots); n != 0 {
+		t.Errorf("Expected no slot held, got %d", n)
+	}
+
+	// The slot is released when an RPC sent directly fails before being
+	// written.
+	DirectSend()(c)
+	Faults(faultFuncs{onWrite: func(frame []byte) ([]byte, FaultAction) {
+		return frame, KillConnection
+	}})(c)
+	if err := c.QueueRPC(a); err == nil {
+		t.Error("Expected the RPC to fail")
+	}
+	if n := len(c.slots); n != 0 {
+		t.Errorf("Expected the slot of the failed RPC to be released, got %d held", n)
+	}
+}
+
+func TestRequestPriority(t *testing.T) {
+	get, _ := hrpc.NewGetStr(context.Background(), "test", "row")
+	urgent, _ := hrpc.NewGetStr(context.Background(), "test", "row",
+		hrpc.Priority(hrpc.AdminPriority))
+	meta, _ := hrpc.NewGetStr(context.Background(), "hbase:meta", "row")
+	for _, testcase := range []struct {
+		get      *hrpc.Get
+		priority uint32
+	}{
+		{get, hrpc.NormalPriority},
+		{urgent, hrpc.AdminPriority},
+		{meta, hrpc.HighPriority},
+	} {
+		c, server := newPipeClient()
+		testcase.get.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+		errs := make(chan error, 1)
+		go func() { errs <- sendAndFlush(c, testcase.get) }()
+		header, _, _, err := readRequest(server)
+		server.Close()
+		if err != nil {
+			t.Fatalf("Failed to read the request: %s", err)
+		}
+		if err = <-errs; err != nil {
+			t.Fatalf("Failed to send the request: %s", err)
+		}
+		if header.GetPriority() != testcase.priority {
+			t.Errorf("Expected priority %d for %s, got %d", testcase.priority,
+				testcase.get.Table(), header.GetPriority())
+		}
+		if testcase.priority == hrpc.NormalPriority && header.Priority != nil {
+			t.Errorf("Expected no priority, got %d", header.GetPriority())
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	c.rpcQueueSize = 100
+	go c.receiveRpcs()
+
+	inFlight, _ := hrpc.NewGetStr(context.Background(), "test", "inflight")
+	c.sentRPCs[1] = inFlight
+	queued, _ := hrpc.NewGetStr(context.Background(), "test", "queued")
+	if err := c.QueueRPC(queued); err != nil {
+		t.Fatalf("Failed to queue the RPC: %s", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- c.Close(context.Background()) }()
+	res := <-queued.GetResultChan()
+	if e, ok := res.Error.(UnrecoverableError); !ok || e.error != ErrClientClosed {
+		t.Errorf("Expected the queued RPC to fail with ErrClientClosed, got %v", res.Error)
+	}
+	rejected, _ := hrpc.NewGetStr(context.Background(), "test", "rejected")
+	if err := c.QueueRPC(rejected); err != ErrClientClosed {
+		t.Errorf("Expected new RPCs to be rejected with ErrClientClosed, got %v", err)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Close returned before the response was received: %v", err)
+	default:
+	}
+
+	// The response to the RPC in flight is still delivered.
+	header, _ := proto.Marshal(&pb.ResponseHeader{CallId: proto.Uint32(1)})
+	payload, _ := proto.Marshal(&pb.GetResponse{})
+	buf := make([]byte, 4)
+	buf = append(buf, proto.EncodeVarint(uint64(len(header)))...)
+	buf = append(buf, header...)
+	buf = append(buf, proto.EncodeVarint(uint64(len(payload)))...)
+	buf = append(buf, payload...)
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+	if _, err := server.Write(buf); err != nil {
+		t.Fatalf("Failed to write the response: %s", err)
+	}
+	if res = <-inFlight.GetResultChan(); res.Error != nil {
+		t.Errorf("Expected the RPC in flight to succeed, got %v", res.Error)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Close failed: %s", err)
+	}
+	if c.Err() != ErrClientClosed {
+		t.Errorf("Expected the client to be shut down with ErrClientClosed, got %v", c.Err())
+	}
+}
+
+// Writes to the server end of a pipe an empty response to a Get with the given
+// call ID.
+func writeGetResponse(t *testing.T, server net.Conn, id uint32) {
+	header, _ := proto.Marshal(&pb.ResponseHeader{CallId: proto.Uint32(id)})
+	payload, _ := proto.Marshal(&pb.GetResponse{})
+	buf := make([]byte, 4)
+	buf = append(buf, proto.EncodeVarint(uint64(len(header)))...)
+	buf = append(buf, header...)
+	buf = append(buf, proto.EncodeVarint(uint64(len(payload)))...)
+	buf = append(buf, payload...)
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+	if _, err := server.Write(buf); err != nil {
+		t.Fatalf("Failed to write the response: %s", err)
+	}
+}
+
+func TestCancelInFlightRPC(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	go c.receiveRpcs()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var rpcs []hrpc.Call
+	for _, ctx := range []context.Context{ctx, context.Background()} {
+		get, _ := hrpc.NewGetStr(ctx, "test", "row")
+		get.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+		errs := make(chan error, 1)
+		go func() { errs <- sendAndFlush(c, get) }()
+		if _, _, _, err := readRequest(server); err != nil {
+			t.Fatalf("Failed to read the request: %s", err)
+		}
+		if err := <-errs; err != nil {
+			t.Fatalf("Failed to send the RPC: %s", err)
+		}
+		rpcs = append(rpcs, get)
+	}
+
+	cancel()
+	select {
+	case res := <-rpcs[0].GetResultChan():
+		if res.Error != context.Canceled {
+			t.Errorf("Expected the RPC to fail with context.Canceled, got %v", res.Error)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The RPC wasn't failed once its context was cancelled")
+	}
+	if n := c.Stats().RPCsInFlight; n != 1 {
+		t.Errorf("Expected 1 RPC left in flight, got %d", n)
+	}
+
+	// The late response to the cancelled RPC is ignored, and the
+	// connection keeps working.
+	writeGetResponse(t, server, 1)
+	writeGetResponse(t, server, 2)
+	if res := <-rpcs[1].GetResultChan(); res.Error != nil {
+		t.Errorf("Expected the other RPC to succeed, got %v", res.Error)
+	}
+	select {
+	case res := <-rpcs[0].GetResultChan():
+		t.Errorf("Unexpected result for the cancelled RPC %v", res)
+	default:
+	}
+	if err := c.Err(); err != nil {
+		t.Errorf("Expected the client to be usable, got %s", err)
+	}
+	c.sentRPCsMutex.Lock()
+	if len(c.cancelled) != 0 || len(c.watchers) != 0 {
+		t.Errorf("Expected no RPC left to watch, got %v and %v", c.cancelled, c.watchers)
+	}
+	c.sentRPCsMutex.Unlock()
+}
+
+func TestCancelledRPCKeepsSlot(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	MaxInFlight(1)(c)
+	go c.receiveRpcs()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	get, _ := hrpc.NewGetStr(ctx, "test", "row")
+	get.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+	if err := c.acquireSlot(get); err != nil {
+		t.Fatalf("Failed to acquire a slot: %s", err)
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- sendAndFlush(c, get) }()
+	if _, _, _, err := readRequest(server); err != nil {
+		t.Fatalf("Failed to read the request: %s", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Failed to send the RPC: %s", err)
+	}
+
+	cancel()
+	select {
+	case <-get.GetResultChan():
+	case <-time.After(time.Second):
+		t.Fatal("The RPC wasn't failed once its context was cancelled")
+	}
+	// The RegionServer is still working on the RPC.
+	if n := len(c.slots); n != 1 {
+		t.Errorf("Expected the cancelled RPC to keep its slot, got %d held", n)
+	}
+
+	writeGetResponse(t, server, 1)
+	for start := time.Now(); len(c.slots) != 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatal("The slot wasn't released once the late response was received")
+		}
+	}
+}
+
+func TestFailStuckCancelledRPCs(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	stuck, _ := hrpc.NewGetStr(context.Background(), "test", "stuck")
+	c.cancelled = map[uint32]cancelledRPC{
+		1: {rpc: stuck, deadline: time.Now().Add(-2 * time.Minute)},
+	}
+	if !c.failStuckRPCs() {
+		t.Error("A cancelled RPC unanswered 2 minutes past its deadline wasn't considered stuck")
+	}
+}
+
+func TestCloseTimeout(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	go c.receiveRpcs()
+	inFlight, _ := hrpc.NewGetStr(context.Background(), "test", "inflight")
+	c.sentRPCs[1] = inFlight
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected the close to time out, got %v", err)
+	}
+	res := <-inFlight.GetResultChan()
+	if e, ok := res.Error.(UnrecoverableError); !ok || e.error != ErrClientClosed {
+		t.Errorf("Expected the RPC in flight to fail with ErrClientClosed, got %v", res.Error)
+	}
+}
+
+func TestCloseRacingQueueRPC(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	c.rpcQueueSize = 1000
+	go c.receiveRpcs()
+
+	// Every RPC is either rejected by QueueRPC or failed by Close.
+	const n = 100
+	rpcs := make([]hrpc.Call, n)
+	errs := make(chan error, n)
+	for i := range rpcs {
+		rpcs[i], _ = hrpc.NewGetStr(context.Background(), "test", "row")
+		go func(rpc hrpc.Call) {
+			errs <- c.QueueRPC(rpc)
+		}(rpcs[i])
+	}
+	closes := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { closes <- c.Close(context.Background()) }()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-closes; err != nil {
+			t.Errorf("Close failed: %s", err)
+		}
+	}
+	var queued int
+	for i := 0; i < n; i++ {
+		if err := <-errs; err == nil {
+			queued++
+		} else if err != ErrClientClosed {
+			t.Errorf("Expected RPCs to be rejected with ErrClientClosed, got %v", err)
+		}
+	}
+	for _, rpc := range rpcs {
+		select {
+		case res := <-rpc.GetResultChan():
+			if e, ok := res.Error.(UnrecoverableError); !ok || e.error != ErrClientClosed {
+				t.Errorf("Expected the queued RPC to fail with ErrClientClosed, got %v",
+					res.Error)
+			}
+			queued--
+		default:
+		}
+	}
+	if queued != 0 {
+		t.Errorf("%d queued RPCs weren't failed", queued)
+	}
+}
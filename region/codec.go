@@ -0,0 +1,297 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/keyvalue"
+	"github.com/tsuna/gohbase/pb"
+)
+
+// Java classes of the codecs of cell blocks whose format is known, and in
+// which the cells of requests can be sent.
+const (
+	// KeyValueCodec is the codec HBase uses by default to encode cell
+	// blocks.
+	KeyValueCodec = "org.apache.hadoop.hbase.codec.KeyValueCodec"
+	// KeyValueCodecWithTags is like KeyValueCodec, with the tags of cells.
+	KeyValueCodecWithTags = "org.apache.hadoop.hbase.codec.KeyValueCodecWithTags"
+)
+
+// Java classes of the compressors of cell blocks supported for requests.
+const (
+	// GzipCodec compresses cell blocks in the gzip format.
+	GzipCodec = "org.apache.hadoop.io.compress.GzipCodec"
+	// DefaultCodec compresses cell blocks in the zlib format.
+	DefaultCodec = "org.apache.hadoop.io.compress.DefaultCodec"
+)
+
+// Java classes of the exceptions a RegionServer fails the connection with when
+// it doesn't support the codec or compressor requested in the connection
+// header.
+const (
+	unsupportedCellCodecException        = "org.apache.hadoop.hbase.ipc.UnsupportedCellCodecException"
+	unsupportedCompressionCodecException = "org.apache.hadoop.hbase.ipc.UnsupportedCompressionCodecException"
+)
+
+// ErrCodecRejected is used when the RegionServer closed the connection because
+// it doesn't support the cell block codec or compressor we asked for.  The
+// next connection to that RegionServer doesn't use cell blocks.
+var ErrCodecRejected = errors.New("RegionServer rejected the cell block codec")
+
+// CellBlockCodec will return an option that will set the Java classes of the
+// codec, and optionally of the compressor, the RegionServer is asked to use for
+// cell blocks.  If the RegionServer rejects them, the connection is re-opened
+// without cell blocks (pure protobuf cells), and cell blocks are no longer
+// requested from that RegionServer.  An empty codec, the default, disables
+// cell blocks.  With KeyValueCodec or KeyValueCodecWithTags, and no
+// compressor or one of GzipCodec and DefaultCodec, the cells of mutations are
+// also sent in cell blocks.  The cells of results received in cell blocks are
+// decoded into the results of responses, the cell blocks being compressed
+// with GzipCodec, DefaultCodec, SnappyCodec or Lz4Codec.  Compression shrinks
+// large scans, at the cost of CPU on both ends.
+func CellBlockCodec(codec, compressor string) Option {
+	return func(c *Client) {
+		c.codec = codec
+		c.compressor = compressor
+	}
+}
+
+var (
+	// Protects rejectedCodecs.
+	rejectedCodecsMutex sync.Mutex
+	// The "host:port" addresses of the RegionServers that rejected the
+	// codec or compressor they were asked to use.
+	rejectedCodecs = make(map[string]struct{})
+)
+
+// Returns true if the RegionServer at the given address rejected a codec.
+func codecRejectedBy(addr string) bool {
+	rejectedCodecsMutex.Lock()
+	defer rejectedCodecsMutex.Unlock()
+	_, ok := rejectedCodecs[addr]
+	return ok
+}
+
+// Returns true if the given exception means the RegionServer rejected the
+// codec or compressor in the connection header.
+func isCodecRejection(exc *pb.ExceptionResponse) bool {
+	switch exc.GetExceptionClassName() {
+	case unsupportedCellCodecException, unsupportedCompressionCodecException:
+		return true
+	}
+	return false
+}
+
+// Remembers that the RegionServer rejected the codec of this client, so that
+// the following connections to it don't use cell blocks.
+func (c *Client) codecRejected(exc *pb.ExceptionResponse) {
+	log.WithFields(log.Fields{
+		"Host":       c.host,
+		"Port":       c.port,
+		"Codec":      c.codec,
+		"Compressor": c.compressor,
+		"Exception":  exc.GetExceptionClassName(),
+	}).Warn("RegionServer rejected the cell block codec, falling back to protobuf cells")
+	rejectedCodecsMutex.Lock()
+	rejectedCodecs[c.addr()] = struct{}{}
+	rejectedCodecsMutex.Unlock()
+}
+
+// CellBlockCodec returns the Java class of the codec used for cell blocks on
+// this connection, or an empty string if cells are sent as protobufs.
+func (c *Client) CellBlockCodec() string {
+	return c.codec
+}
+
+// CellBlockCompressor returns the Java class of the compressor used for cell
+// blocks on this connection, or an empty string if they aren't compressed.
+func (c *Client) CellBlockCompressor() string {
+	return c.compressor
+}
+
+// Returns true if the cells of requests can be sent in cell blocks on this
+// connection.
+func (c *Client) requestCellBlocks() bool {
+	switch c.codec {
+	case KeyValueCodec, KeyValueCodecWithTags:
+	default:
+		return false
+	}
+	switch c.compressor {
+	case "", GzipCodec, DefaultCodec:
+		return true
+	}
+	return false
+}
+
+// Serializes the given RPC, and returns its cell block if its cells are sent
+// in one, nil otherwise.
+func (c *Client) serialize(rpc hrpc.Call) ([]byte, []byte, error) {
+	cbc, ok := rpc.(hrpc.CellBlockCall)
+	if !ok || !c.requestCellBlocks() {
+		payload, err := rpc.Serialize()
+		return payload, nil, err
+	}
+	payload, kvs, err := cbc.SerializeCellBlock()
+	if err != nil || len(kvs) == 0 {
+		return payload, nil, err
+	}
+	block, err := keyvalue.AppendCellBlock(nil, kvs, c.codec == KeyValueCodecWithTags)
+	if err != nil {
+		return nil, nil, err
+	}
+	if block, err = compress(c.compressor, block); err != nil {
+		return nil, nil, err
+	}
+	return payload, block, nil
+}
+
+// Compresses a cell block with the given compressor, if any.
+func compress(compressor string, block []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch compressor {
+	case "":
+		return block, nil
+	case GzipCodec:
+		w = gzip.NewWriter(&buf)
+	case DefaultCodec:
+		w = zlib.NewWriter(&buf)
+	default:
+		return nil, errors.New("unsupported cell block compressor " + compressor)
+	}
+	if _, err := w.Write(block); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompresses a cell block compressed with the given compressor, if any.
+func decompress(compressor string, block []byte) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+	switch compressor {
+	case "":
+		return block, nil
+	case GzipCodec:
+		r, err = gzip.NewReader(bytes.NewReader(block))
+	case DefaultCodec:
+		r, err = zlib.NewReader(bytes.NewReader(block))
+	case SnappyCodec:
+		return decompressBlocks(block, snappyDecode)
+	case Lz4Codec:
+		return decompressBlocks(block, lz4Decode)
+	default:
+		return nil, errors.New("unsupported cell block compressor " + compressor)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// Decodes the cell block of a response, and adds its cells to the results of
+// the response, so that they look as if they had been sent as protobufs.
+func (c *Client) decodeCellBlock(block []byte, resp proto.Message) error {
+	switch c.codec {
+	case KeyValueCodec, KeyValueCodecWithTags:
+	default:
+		return errors.New("unsupported cell block codec " + c.codec)
+	}
+	var err error
+	if c.compressor == "" {
+		// The cells point into the block, which is in the buffer the
+		// following responses are read into.
+		block = append([]byte(nil), block...)
+	} else if block, err = decompress(c.compressor, block); err != nil {
+		return err
+	}
+	kvs, err := keyvalue.DecodeCellBlock(block, c.codec == KeyValueCodecWithTags)
+	if err != nil {
+		return err
+	}
+	cells := make([]*pb.Cell, len(kvs))
+	for i, kv := range kvs {
+		cells[i] = kv.ToCell()
+	}
+	if cells, err = attachCells(resp, cells); err != nil {
+		return err
+	} else if len(cells) != 0 {
+		return fmt.Errorf("%d cells of the cell block aren't in any result", len(cells))
+	}
+	return nil
+}
+
+// Adds the given cells to the results of a response, in order, and returns
+// the cells left.
+func attachCells(resp proto.Message, cells []*pb.Cell) ([]*pb.Cell, error) {
+	var err error
+	switch resp := resp.(type) {
+	case *pb.GetResponse:
+		return takeCells(resp.Result, cells)
+	case *pb.MutateResponse:
+		return takeCells(resp.Result, cells)
+	case *pb.ScanResponse:
+		// The results of scans are entirely in the cell block, only
+		// their number of cells is in the response.
+		for i, n := range resp.CellsPerResult {
+			if int(n) > len(cells) {
+				return nil, errors.New("result with more cells than the cell block")
+			}
+			result := &pb.Result{Cell: cells[:n:n]}
+			if i < len(resp.PartialFlagPerResult) {
+				result.Partial = proto.Bool(resp.PartialFlagPerResult[i])
+			}
+			resp.Results = append(resp.Results, result)
+			cells = cells[n:]
+		}
+		resp.CellsPerResult = nil
+		resp.PartialFlagPerResult = nil
+		return cells, nil
+	case *pb.MultiResponse:
+		for _, regionResult := range resp.RegionActionResult {
+			for _, roe := range regionResult.ResultOrException {
+				if cells, err = takeCells(roe.Result, cells); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return cells, nil
+	}
+	return cells, nil
+}
+
+// Adds to the given result as many of the given cells as it's associated
+// with, and returns the cells left.
+func takeCells(result *pb.Result, cells []*pb.Cell) ([]*pb.Cell, error) {
+	if result == nil || result.AssociatedCellCount == nil {
+		return cells, nil
+	}
+	n := int(result.GetAssociatedCellCount())
+	if n < 0 || n > len(cells) {
+		return nil, fmt.Errorf("result associated with %d cells, but %d left in the cell block",
+			n, len(cells))
+	}
+	result.Cell = append(result.Cell, cells[:n]...)
+	result.AssociatedCellCount = nil
+	return cells[n:], nil
+}
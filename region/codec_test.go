@@ -0,0 +1,247 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/keyvalue"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/regioninfo"
+	"golang.org/x/net/context"
+)
+
+func TestCellBlockCodecInHello(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	CellBlockCodec(KeyValueCodec, "org.apache.hadoop.io.compress.GzipCodec")(c)
+
+	errs := make(chan error, 1)
+	go func() { errs <- c.sendHello() }()
+	header, err := readConnectionHeader(server)
+	if err != nil {
+		t.Fatalf("Failed to read the connection header: %s", err)
+	}
+	if err = <-errs; err != nil {
+		t.Fatalf("Failed to send the connection header: %s", err)
+	}
+	if header.GetCellBlockCodecClass() != KeyValueCodec ||
+		header.GetCellBlockCompressorClass() != "org.apache.hadoop.io.compress.GzipCodec" {
+		t.Errorf("Unexpected codec in the connection header: %s", header)
+	}
+}
+
+func TestCodecRejected(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	CellBlockCodec(KeyValueCodec, "")(c)
+	defer func() {
+		rejectedCodecsMutex.Lock()
+		delete(rejectedCodecs, c.addr())
+		rejectedCodecsMutex.Unlock()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		c.receiveRpcs()
+		close(done)
+	}()
+	header, err := proto.Marshal(&pb.ResponseHeader{
+		Exception: &pb.ExceptionResponse{
+			ExceptionClassName: proto.String(unsupportedCellCodecException),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal the response header: %s", err)
+	}
+	buf := make([]byte, 4, 4+1+len(header))
+	buf = append(buf, proto.EncodeVarint(uint64(len(header)))...)
+	buf = append(buf, header...)
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+	if _, err = server.Write(buf); err != nil {
+		t.Fatalf("Failed to write the response: %s", err)
+	}
+	<-done
+
+	if c.Err() != ErrCodecRejected {
+		t.Errorf("Expected the client to fail with ErrCodecRejected, got %v", c.Err())
+	}
+	if !codecRejectedBy(c.addr()) {
+		t.Error("The rejection of the codec wasn't remembered")
+	}
+}
+
+// Reads a request, and returns its header, its payload and its cell block.
+func readRequest(conn net.Conn) (*pb.RequestHeader, []byte, []byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(conn, size[:]); err != nil {
+		return nil, nil, nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, nil, nil, err
+	}
+	header := &pb.RequestHeader{}
+	headerLen, n := proto.DecodeVarint(buf)
+	if err := proto.Unmarshal(buf[n:n+int(headerLen)], header); err != nil {
+		return nil, nil, nil, err
+	}
+	buf = buf[n+int(headerLen):]
+	payloadLen, n := proto.DecodeVarint(buf)
+	payload := buf[n : n+int(payloadLen)]
+	return header, payload, buf[n+int(payloadLen):], nil
+}
+
+func TestRequestCellBlocks(t *testing.T) {
+	put, _ := hrpc.NewPutStr(context.Background(), "test", "row",
+		map[string]map[string][]byte{"cf": {"a": []byte("1"), "b": []byte("2")}})
+	put.SetTimestamp(42)
+	put.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+
+	for _, compressor := range []string{"", GzipCodec, SnappyCodec} {
+		c, server := newPipeClient()
+		CellBlockCodec(KeyValueCodec, compressor)(c)
+		errs := make(chan error, 1)
+		go func() { errs <- sendAndFlush(c, put) }()
+		header, payload, cellBlock, err := readRequest(server)
+		server.Close()
+		if err != nil {
+			t.Fatalf("Failed to read the request: %s", err)
+		}
+		if err = <-errs; err != nil {
+			t.Fatalf("Failed to send the request: %s", err)
+		}
+		req := &pb.MutateRequest{}
+		if err = proto.Unmarshal(payload, req); err != nil {
+			t.Fatalf("Failed to unmarshal the request: %s", err)
+		}
+
+		if compressor == SnappyCodec {
+			// Not supported, the cells are sent in the request.
+			if header.CellBlockMeta != nil || len(cellBlock) != 0 ||
+				len(req.Mutation.ColumnValue) != 1 {
+				t.Errorf("Expected cells in the request with %s, got %s", compressor, req)
+			}
+			continue
+		}
+		if int(header.GetCellBlockMeta().GetLength()) != len(cellBlock) {
+			t.Errorf("Cell block of %d bytes, but %d in its metadata",
+				len(cellBlock), header.GetCellBlockMeta().GetLength())
+		}
+		if len(req.Mutation.ColumnValue) != 0 || req.Mutation.GetAssociatedCellCount() != 2 {
+			t.Errorf("Expected 2 cells in the cell block, got %s", req.Mutation)
+		}
+		if compressor == GzipCodec {
+			r, err := gzip.NewReader(bytes.NewReader(cellBlock))
+			if err != nil {
+				t.Fatalf("Invalid gzip cell block: %s", err)
+			}
+			if cellBlock, err = ioutil.ReadAll(r); err != nil {
+				t.Fatalf("Invalid gzip cell block: %s", err)
+			}
+		}
+		kvs, err := keyvalue.DecodeCellBlock(cellBlock, false)
+		if err != nil {
+			t.Fatalf("Failed to decode the cell block: %s", err)
+		}
+		if len(kvs) != 2 ||
+			string(kvs[0].Qualifier) != "a" || string(kvs[0].Value) != "1" ||
+			string(kvs[1].Qualifier) != "b" || string(kvs[1].Value) != "2" ||
+			kvs[0].Timestamp != 42 || kvs[0].Type != keyvalue.Put {
+			t.Errorf("Unexpected cells with %q: %v", compressor, kvs)
+		}
+	}
+}
+
+func TestResponseCellBlocks(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	CellBlockCodec(KeyValueCodec, GzipCodec)(c)
+	get, _ := hrpc.NewGetStr(context.Background(), "test", "row")
+	c.sentRPCs[42] = get
+	go c.receiveRpcs()
+
+	kvs := []*keyvalue.KeyValue{
+		{Row: []byte("row"), Family: []byte("cf"), Qualifier: []byte("a"),
+			Timestamp: 42, Type: keyvalue.Put, Value: []byte("1")},
+		{Row: []byte("row"), Family: []byte("cf"), Qualifier: []byte("b"),
+			Timestamp: 42, Type: keyvalue.Put, Value: []byte("2")},
+	}
+	cellBlock, err := keyvalue.AppendCellBlock(nil, kvs, false)
+	if err != nil {
+		t.Fatalf("Failed to encode the cell block: %s", err)
+	}
+	if cellBlock, err = compress(GzipCodec, cellBlock); err != nil {
+		t.Fatalf("Failed to compress the cell block: %s", err)
+	}
+	header, _ := proto.Marshal(&pb.ResponseHeader{
+		CallId:        proto.Uint32(42),
+		CellBlockMeta: &pb.CellBlockMeta{Length: proto.Uint32(uint32(len(cellBlock)))},
+	})
+	payload, _ := proto.Marshal(&pb.GetResponse{
+		Result: &pb.Result{AssociatedCellCount: proto.Int32(2)},
+	})
+	buf := make([]byte, 4)
+	buf = append(buf, proto.EncodeVarint(uint64(len(header)))...)
+	buf = append(buf, header...)
+	buf = append(buf, proto.EncodeVarint(uint64(len(payload)))...)
+	buf = append(buf, payload...)
+	buf = append(buf, cellBlock...)
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+	if _, err = server.Write(buf); err != nil {
+		t.Fatalf("Failed to write the response: %s", err)
+	}
+
+	res := <-get.GetResultChan()
+	if res.Error != nil {
+		t.Fatalf("Get failed: %s", res.Error)
+	}
+	cells := res.Msg.(*pb.GetResponse).Result.Cell
+	if len(cells) != 2 ||
+		string(cells[0].Qualifier) != "a" || string(cells[0].Value) != "1" ||
+		string(cells[1].Qualifier) != "b" || string(cells[1].Value) != "2" ||
+		cells[1].GetTimestamp() != 42 {
+		t.Errorf("Unexpected cells %v", cells)
+	}
+}
+
+func TestAttachCells(t *testing.T) {
+	cells := []*pb.Cell{
+		{Row: []byte("a")}, {Row: []byte("b")}, {Row: []byte("b")},
+	}
+	scan := &pb.ScanResponse{
+		CellsPerResult:       []uint32{1, 2},
+		PartialFlagPerResult: []bool{false, true},
+	}
+	left, err := attachCells(scan, cells)
+	if err != nil || len(left) != 0 {
+		t.Fatalf("Expected all cells to be attached, got %v, %v", left, err)
+	}
+	if len(scan.Results) != 2 || len(scan.Results[0].Cell) != 1 ||
+		len(scan.Results[1].Cell) != 2 || !scan.Results[1].GetPartial() ||
+		scan.CellsPerResult != nil {
+		t.Errorf("Unexpected scan response %s", scan)
+	}
+
+	multi := &pb.MultiResponse{RegionActionResult: []*pb.RegionActionResult{{
+		ResultOrException: []*pb.ResultOrException{
+			{Result: &pb.Result{AssociatedCellCount: proto.Int32(2)}},
+			{Result: &pb.Result{}},
+			{Result: &pb.Result{AssociatedCellCount: proto.Int32(2)}},
+		},
+	}}}
+	if _, err = attachCells(multi, cells); err == nil {
+		t.Error("Expected an error for a result with more cells than the cell block")
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Java classes of the compressors of cell blocks supported only for
+// responses: the cells of requests aren't sent in cell blocks with those.
+const (
+	// SnappyCodec compresses cell blocks with Snappy.
+	SnappyCodec = "org.apache.hadoop.io.compress.SnappyCodec"
+	// Lz4Codec compresses cell blocks with LZ4.
+	Lz4Codec = "org.apache.hadoop.io.compress.Lz4Codec"
+)
+
+var errCorruptBlock = errors.New("corrupt compressed cell block")
+
+// Neither Snappy nor LZ4 decompress a byte in more than that many bytes, which
+// bounds what's allocated for a chunk, whatever length the block claims.
+const maxExpansion = 255
+
+// Decompresses a cell block compressed by one of Hadoop's block compressors,
+// such as SnappyCodec and Lz4Codec.  Those split the data in blocks, each
+// made of its uncompressed length followed by chunks, each made of its
+// compressed length and of the compressed data, all lengths being 32-bit big
+// endian integers.  decode decompresses a chunk into dst, whose length bounds the
+// number of uncompressed bytes expected, and returns the number of bytes
+// written.
+func decompressBlocks(block []byte, decode func(dst, src []byte) (int, error)) ([]byte, error) {
+	var out []byte
+	for len(block) > 0 {
+		if len(block) < 4 {
+			return nil, errCorruptBlock
+		}
+		left := int(binary.BigEndian.Uint32(block))
+		block = block[4:]
+		for left > 0 {
+			if len(block) < 4 {
+				return nil, errCorruptBlock
+			}
+			n := int(binary.BigEndian.Uint32(block))
+			block = block[4:]
+			if n < 0 || n > len(block) {
+				return nil, errCorruptBlock
+			}
+			size := left
+			if size > n*maxExpansion {
+				size = n * maxExpansion
+			}
+			start := len(out)
+			out = append(out, make([]byte, size)...)
+			written, err := decode(out[start:], block[:n])
+			if err != nil {
+				return nil, err
+			}
+			out = out[:start+written]
+			left -= written
+			block = block[n:]
+		}
+	}
+	return out, nil
+}
+
+// Decodes a raw Snappy block into dst.
+func snappyDecode(dst, src []byte) (int, error) {
+	length, n := binary.Uvarint(src)
+	if n <= 0 || length > uint64(len(dst)) {
+		return 0, errCorruptBlock
+	}
+	dst = dst[:length]
+	src = src[n:]
+	var d int
+	for len(src) > 0 {
+		tag := src[0]
+		var offset, size int
+		switch tag & 0x03 {
+		case 0: // Literal.
+			size = int(tag >> 2)
+			src = src[1:]
+			if size >= 60 {
+				extra := size - 59
+				if len(src) < extra {
+					return 0, errCorruptBlock
+				}
+				size = 0
+				for i := extra - 1; i >= 0; i-- {
+					size = size<<8 | int(src[i])
+				}
+				src = src[extra:]
+			}
+			size++
+			if size <= 0 || size > len(src) || size > len(dst)-d {
+				return 0, errCorruptBlock
+			}
+			d += copy(dst[d:], src[:size])
+			src = src[size:]
+			continue
+		case 1: // Copy with a 1-byte offset.
+			if len(src) < 2 {
+				return 0, errCorruptBlock
+			}
+			size = 4 + int(tag>>2&0x07)
+			offset = int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+		case 2: // Copy with a 2-byte offset.
+			if len(src) < 3 {
+				return 0, errCorruptBlock
+			}
+			size = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case 3: // Copy with a 4-byte offset.
+			if len(src) < 5 {
+				return 0, errCorruptBlock
+			}
+			size = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if offset <= 0 || offset > d || size > len(dst)-d {
+			return 0, errCorruptBlock
+		}
+		// The source and destination of copies may overlap.
+		for i := 0; i < size; i++ {
+			dst[d+i] = dst[d-offset+i]
+		}
+		d += size
+	}
+	if d != len(dst) {
+		return 0, errCorruptBlock
+	}
+	return d, nil
+}
+
+// Decodes a raw LZ4 block into dst.
+func lz4Decode(dst, src []byte) (int, error) {
+	var d int
+	// Reads the extension of a length, made of bytes added to it until one
+	// isn't 255.
+	readLength := func(length int) (int, bool) {
+		for {
+			if len(src) == 0 {
+				return 0, false
+			}
+			b := src[0]
+			src = src[1:]
+			length += int(b)
+			if b != 255 {
+				return length, true
+			}
+		}
+	}
+	for len(src) > 0 {
+		token := src[0]
+		src = src[1:]
+		literals := int(token >> 4)
+		if literals == 15 {
+			var ok bool
+			if literals, ok = readLength(literals); !ok {
+				return 0, errCorruptBlock
+			}
+		}
+		if literals > len(src) || literals > len(dst)-d {
+			return 0, errCorruptBlock
+		}
+		d += copy(dst[d:], src[:literals])
+		src = src[literals:]
+		if len(src) == 0 {
+			// The last sequence only has literals.
+			break
+		} else if len(src) < 2 {
+			return 0, errCorruptBlock
+		}
+		offset := int(binary.LittleEndian.Uint16(src))
+		src = src[2:]
+		size := int(token & 0x0f)
+		if size == 15 {
+			var ok bool
+			if size, ok = readLength(size); !ok {
+				return 0, errCorruptBlock
+			}
+		}
+		size += 4
+		if offset <= 0 || offset > d || size > len(dst)-d {
+			return 0, errCorruptBlock
+		}
+		// The source and destination of matches may overlap.
+		for i := 0; i < size; i++ {
+			dst[d+i] = dst[d-offset+i]
+		}
+		d += size
+	}
+	return d, nil
+}
@@ -0,0 +1,69 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// Frames the given chunks like Hadoop's block compressors do, as a single
+// block of the given uncompressed length.
+func hadoopBlock(length int, chunks ...[]byte) []byte {
+	block := make([]byte, 4)
+	binary.BigEndian.PutUint32(block, uint32(length))
+	for _, chunk := range chunks {
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], uint32(len(chunk)))
+		block = append(block, n[:]...)
+		block = append(block, chunk...)
+	}
+	return block
+}
+
+func TestDecompress(t *testing.T) {
+	// "abc", then a copy of 9 bytes at offset 3.
+	snappy := []byte{12, 0x08, 'a', 'b', 'c', 0x15, 0x03}
+	// "abc" and a match of 9 bytes at offset 3, then "xyz".
+	lz4 := []byte{0x35, 'a', 'b', 'c', 3, 0, 0x30, 'x', 'y', 'z'}
+	for _, testcase := range []struct {
+		compressor string
+		block      []byte
+		expected   string
+	}{
+		{SnappyCodec, hadoopBlock(12, snappy), "abcabcabcabc"},
+		{SnappyCodec, append(hadoopBlock(12, snappy), hadoopBlock(12, snappy)...),
+			"abcabcabcabcabcabcabcabc"},
+		{Lz4Codec, hadoopBlock(15, lz4), "abcabcabcabcxyz"},
+		{Lz4Codec, hadoopBlock(30, lz4, lz4), "abcabcabcabcxyzabcabcabcabcxyz"},
+	} {
+		out, err := decompress(testcase.compressor, testcase.block)
+		if err != nil {
+			t.Errorf("Failed to decompress with %s: %s", testcase.compressor, err)
+		} else if string(out) != testcase.expected {
+			t.Errorf("Expected %q with %s, got %q",
+				testcase.expected, testcase.compressor, out)
+		}
+	}
+
+	for _, testcase := range []struct {
+		compressor string
+		block      []byte
+	}{
+		{SnappyCodec, hadoopBlock(12, snappy[:5])},
+		{SnappyCodec, hadoopBlock(12, []byte{12, 0x08, 'a', 'b', 'c', 0x15, 0x04})},
+		{SnappyCodec, hadoopBlock(12, snappy)[:10]},
+		{Lz4Codec, hadoopBlock(15, lz4[:5])},
+		{Lz4Codec, hadoopBlock(15, []byte{0x35, 'a', 'b', 'c', 4, 0})},
+		// Far more bytes than the chunks can hold.
+		{SnappyCodec, hadoopBlock(1<<32-1, snappy)},
+		{Lz4Codec, hadoopBlock(1<<32-1, lz4)},
+	} {
+		if _, err := decompress(testcase.compressor, testcase.block); err == nil {
+			t.Errorf("Expected an error for the corrupt block %v", testcase.block)
+		}
+	}
+}
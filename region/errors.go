@@ -0,0 +1,115 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/pb"
+)
+
+// Names of some of the Java exceptions in the DoNotRetryIOException
+// hierarchy, as found in DoNotRetryError.Exception.
+const (
+	DoNotRetryIOException           = "org.apache.hadoop.hbase.DoNotRetryIOException"
+	AccessDeniedException           = "org.apache.hadoop.hbase.security.AccessDeniedException"
+	NoSuchColumnFamilyException     = "org.apache.hadoop.hbase.regionserver.NoSuchColumnFamilyException"
+	InvalidFamilyOperationException = "org.apache.hadoop.hbase.InvalidFamilyOperationException"
+	FailedSanityCheckException      = "org.apache.hadoop.hbase.exceptions.FailedSanityCheckException"
+	UnknownScannerException         = "org.apache.hadoop.hbase.UnknownScannerException"
+	UnknownProtocolException        = "org.apache.hadoop.hbase.exceptions.UnknownProtocolException"
+	NamespaceNotFoundException      = "org.apache.hadoop.hbase.NamespaceNotFoundException"
+	OperationConflictException      = "org.apache.hadoop.hbase.exceptions.OperationConflictException"
+	QuotaExceededException          = "org.apache.hadoop.hbase.quotas.QuotaExceededException"
+	CoprocessorException            = "org.apache.hadoop.hbase.coprocessor.CoprocessorException"
+	TableNotFoundException          = "org.apache.hadoop.hbase.TableNotFoundException"
+	TableNotEnabledException        = "org.apache.hadoop.hbase.TableNotEnabledException"
+	TableNotDisabledException       = "org.apache.hadoop.hbase.TableNotDisabledException"
+)
+
+// javaDoNotRetryExceptions lists the Java exceptions that signify the RPC
+// must not be retried.  HBase normally also sets the do_not_retry field of
+// the exception for those, but older servers don't always do so.
+var javaDoNotRetryExceptions = map[string]struct{}{
+	DoNotRetryIOException:           struct{}{},
+	AccessDeniedException:           struct{}{},
+	NoSuchColumnFamilyException:     struct{}{},
+	InvalidFamilyOperationException: struct{}{},
+	FailedSanityCheckException:      struct{}{},
+	UnknownScannerException:         struct{}{},
+	UnknownProtocolException:        struct{}{},
+	NamespaceNotFoundException:      struct{}{},
+	OperationConflictException:      struct{}{},
+	QuotaExceededException:          struct{}{},
+	CoprocessorException:            struct{}{},
+	TableNotFoundException:          struct{}{},
+	TableNotEnabledException:        struct{}{},
+	TableNotDisabledException:       struct{}{},
+}
+
+// DoNotRetryError is returned when HBase failed an RPC with an exception from
+// the DoNotRetryIOException hierarchy.  Retrying such an RPC is pointless, it
+// would fail again in the same way.
+type DoNotRetryError struct {
+	error
+
+	// Exception is the fully qualified name of the Java exception class,
+	// e.g. AccessDeniedException.
+	Exception string
+}
+
+func (e DoNotRetryError) Error() string {
+	return e.error.Error()
+}
+
+// RegionMovedError is returned when the region an RPC was sent to has moved
+// to another RegionServer, whose address HBase sent along with the exception.
+// Like for a RetryableError the RPC should be retried, but the region doesn't
+// need to be looked up again in hbase:meta.
+type RegionMovedError struct {
+	error
+
+	// Host and Port of the RegionServer now serving the region.
+	Host string
+	Port uint16
+}
+
+func (e RegionMovedError) Error() string {
+	return e.error.Error()
+}
+
+// Java class of the exception sent when a region moved to another server.
+const regionMovedException = "org.apache.hadoop.hbase.exceptions.RegionMovedException"
+
+// exceptionToError converts an exception sent by HBase into the appropriate
+// error type.
+func exceptionToError(exc *pb.ExceptionResponse) error {
+	javaClass := exc.GetExceptionClassName()
+	err := fmt.Errorf("HBase Java exception %s: \n%s", javaClass,
+		exc.GetStackTrace())
+	if _, ok := javaDoNotRetryExceptions[javaClass]; ok || exc.GetDoNotRetry() {
+		return DoNotRetryError{error: err, Exception: javaClass}
+	} else if javaClass == regionMovedException && exc.GetHostname() != "" &&
+		exc.GetPort() > 0 && exc.GetPort() <= 0xFFFF {
+		return RegionMovedError{error: err, Host: exc.GetHostname(),
+			Port: uint16(exc.GetPort())}
+	} else if _, ok := javaRetryableExceptions[javaClass]; ok {
+		// This is a recoverable error. The client should retry.
+		return RetryableError{err}
+	}
+	return err
+}
+
+// ActionError converts an exception sent by HBase for one of the actions of a
+// Multi RPC, or for all the actions on one of its regions, into the
+// appropriate error type.  Such exceptions don't say where a region moved.
+func ActionError(exc *pb.NameBytesPair) error {
+	return exceptionToError(&pb.ExceptionResponse{
+		ExceptionClassName: exc.Name,
+		StackTrace:         proto.String(string(exc.Value)),
+	})
+}
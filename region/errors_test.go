@@ -0,0 +1,94 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/pb"
+)
+
+func TestExceptionToError(t *testing.T) {
+	testcases := []struct {
+		class      string
+		doNotRetry bool
+		hostname   string
+		port       int32
+		check      func(error) bool
+	}{{
+		class: AccessDeniedException,
+		check: func(err error) bool {
+			e, ok := err.(DoNotRetryError)
+			return ok && e.Exception == AccessDeniedException
+		},
+	}, {
+		class:      "org.apache.hadoop.hbase.SomeNewException",
+		doNotRetry: true,
+		check: func(err error) bool {
+			_, ok := err.(DoNotRetryError)
+			return ok
+		},
+	}, {
+		class: "org.apache.hadoop.hbase.NotServingRegionException",
+		check: func(err error) bool {
+			_, ok := err.(RetryableError)
+			return ok
+		},
+	}, {
+		class:    regionMovedException,
+		hostname: "rs2",
+		port:     16020,
+		check: func(err error) bool {
+			e, ok := err.(RegionMovedError)
+			return ok && e.Host == "rs2" && e.Port == 16020
+		},
+	}, {
+		// Older servers don't say where the region moved.
+		class: regionMovedException,
+		check: func(err error) bool {
+			_, ok := err.(RetryableError)
+			return ok
+		},
+	}, {
+		class: "java.io.IOException",
+		check: func(err error) bool {
+			switch err.(type) {
+			case DoNotRetryError, RetryableError:
+				return false
+			}
+			return err != nil
+		},
+	}}
+	for i, testcase := range testcases {
+		exc := &pb.ExceptionResponse{
+			ExceptionClassName: proto.String(testcase.class),
+			StackTrace:         proto.String("stack trace"),
+			DoNotRetry:         proto.Bool(testcase.doNotRetry),
+		}
+		if testcase.hostname != "" {
+			exc.Hostname = proto.String(testcase.hostname)
+			exc.Port = proto.Int32(testcase.port)
+		}
+		if err := exceptionToError(exc); !testcase.check(err) {
+			t.Errorf("[#%d] Unexpected error for %s: %#v", i, testcase.class, err)
+		}
+	}
+}
+
+func TestActionError(t *testing.T) {
+	err := ActionError(&pb.NameBytesPair{
+		Name:  proto.String("org.apache.hadoop.hbase.NotServingRegionException"),
+		Value: []byte("stack trace"),
+	})
+	if _, ok := err.(RetryableError); !ok {
+		t.Errorf("Expected a RetryableError, got %#v", err)
+	}
+	err = ActionError(&pb.NameBytesPair{Name: proto.String(NoSuchColumnFamilyException)})
+	if e, ok := err.(DoNotRetryError); !ok || e.Exception != NoSuchColumnFamilyException {
+		t.Errorf("Expected a DoNotRetryError, got %#v", err)
+	}
+}
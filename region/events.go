@@ -0,0 +1,33 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import "github.com/tsuna/gohbase/hrpc"
+
+// EventListener is notified of the progress of the RPCs going through a
+// Client.  addr is the "host:port" of the RegionServer, and the metadata of
+// the RPC so far is available from rpc.Metadata().  The methods are called
+// synchronously from the goroutines handling the RPCs, so they must be fast
+// and must not block.
+type EventListener interface {
+	// RPCQueued is called when the RPC is queued, before being written.
+	RPCQueued(rpc hrpc.Call, addr string)
+
+	// RPCSent is called when the RPC is written with the given call ID.
+	RPCSent(rpc hrpc.Call, addr string, callID uint32)
+
+	// RPCResponse is called when the response to the RPC is received, err
+	// being the exception it carries, if any.
+	RPCResponse(rpc hrpc.Call, addr string, callID uint32, err error)
+}
+
+// Listener will return an option that will make the client notify the given
+// listener of the progress of its RPCs.
+func Listener(listener EventListener) Option {
+	return func(c *Client) {
+		c.listener = listener
+	}
+}
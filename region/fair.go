@@ -0,0 +1,94 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import "github.com/tsuna/gohbase/hrpc"
+
+// FairScheduling will return an option that will make the client queue the
+// RPCs by tenant, so that a tenant flooding the queue doesn't delay the RPCs
+// of the others behind all of its own.  The tenant of an RPC is its
+// hrpc.Tenant tag, or its table if it has none.  Each time the queue is
+// flushed, up to the queue size RPCs are written, tenants taking turns to
+// write up to their weight in RPCs, in the order they were queued.  The turns
+// carry on with the next batch, which is written right away if RPCs are left
+// queued.  Tenants missing from weights, or with a weight below 1, have a
+// weight of 1.
+func FairScheduling(weights map[string]int) Option {
+	return func(c *Client) {
+		c.fair = &fairScheduler{
+			weights: weights,
+			queues:  make(map[string][]hrpc.Call),
+		}
+	}
+}
+
+// fairScheduler queues RPCs by tenant, and dequeues them with weighted
+// round-robin.  It's protected by the writeMutex of the client.
+type fairScheduler struct {
+	weights map[string]int
+
+	// RPCs queued by tenant, and the tenants having some in the order in
+	// which they take turns.
+	queues  map[string][]hrpc.Call
+	tenants []string
+
+	// Number of RPCs queued across tenants.
+	queued int
+}
+
+// Returns the tenant of the given RPC.
+func tenant(rpc hrpc.Call) string {
+	if tenant := rpc.Tenant(); tenant != "" {
+		return tenant
+	}
+	return string(rpc.Table())
+}
+
+func (f *fairScheduler) weight(tenant string) int {
+	if w := f.weights[tenant]; w > 1 {
+		return w
+	}
+	return 1
+}
+
+// Queues the given RPC.  A tenant without RPCs queued takes its first turn
+// after those that have some.
+func (f *fairScheduler) push(rpc hrpc.Call) {
+	t := tenant(rpc)
+	queue, ok := f.queues[t]
+	if !ok {
+		f.tenants = append(f.tenants, t)
+	}
+	f.queues[t] = append(queue, rpc)
+	f.queued++
+}
+
+// Removes up to max of the queued RPCs and returns them in the order in
+// which they should be written.
+func (f *fairScheduler) pop(max int) []hrpc.Call {
+	var rpcs []hrpc.Call
+	for len(rpcs) < max && len(f.tenants) > 0 {
+		t := f.tenants[0]
+		queue := f.queues[t]
+		n := f.weight(t)
+		if n > len(queue) {
+			n = len(queue)
+		}
+		if n > max-len(rpcs) {
+			n = max - len(rpcs)
+		}
+		rpcs = append(rpcs, queue[:n]...)
+		f.tenants = f.tenants[1:]
+		if len(queue) == n {
+			delete(f.queues, t)
+		} else {
+			f.queues[t] = queue[n:]
+			f.tenants = append(f.tenants, t)
+		}
+	}
+	f.queued -= len(rpcs)
+	return rpcs
+}
@@ -0,0 +1,143 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/regioninfo"
+	"golang.org/x/net/context"
+)
+
+// Returns a Get described by its table, optionally followed by a tenant, and
+// its key.
+func tenantGet(desc string) hrpc.Call {
+	parts := strings.Split(desc, ":")
+	get, _ := hrpc.NewGetStr(context.Background(), parts[0], parts[len(parts)-1])
+	if len(parts) == 3 {
+		get.SetTenant(parts[1])
+	}
+	get.SetRegion(&regioninfo.Info{RegionName: []byte(parts[0] + ",,1")})
+	return get
+}
+
+// Returns the description of the given Get, as given to tenantGet.
+func describeGet(rpc hrpc.Call) string {
+	if rpc.Tenant() != "" {
+		return string(rpc.Table()) + ":" + rpc.Tenant() + ":" + string(rpc.Key())
+	}
+	return string(rpc.Table()) + ":" + string(rpc.Key())
+}
+
+func TestFairScheduling(t *testing.T) {
+	testcases := []struct {
+		weights  map[string]int
+		rpcs     []string
+		expected []string
+	}{{
+		rpcs:     []string{"a:1", "a:2", "a:3"},
+		expected: []string{"a:1", "a:2", "a:3"},
+	}, {
+		rpcs:     []string{"a:1", "a:2", "a:3", "a:4", "b:1", "b:2", "c:1"},
+		expected: []string{"a:1", "b:1", "c:1", "a:2", "b:2", "a:3", "a:4"},
+	}, {
+		weights:  map[string]int{"a": 2, "b": 0},
+		rpcs:     []string{"a:1", "a:2", "a:3", "a:4", "a:5", "b:1", "b:2"},
+		expected: []string{"a:1", "a:2", "b:1", "a:3", "a:4", "b:2", "a:5"},
+	}, {
+		// Tenants share tables.
+		weights:  map[string]int{"batch": 1, "web": 3},
+		rpcs:     []string{"t:batch:1", "t:batch:2", "t:batch:3", "t:web:1", "t:web:2"},
+		expected: []string{"t:batch:1", "t:web:1", "t:web:2", "t:batch:2", "t:batch:3"},
+	}}
+	for i, testcase := range testcases {
+		c, server := newPipeClient()
+		server.Close()
+		FairScheduling(testcase.weights)(c)
+		for _, desc := range testcase.rpcs {
+			c.enqueue(tenantGet(desc))
+		}
+		if n := c.queueLen(); n != len(testcase.rpcs) {
+			t.Errorf("[#%d] Expected %d RPCs queued, got %d", i, len(testcase.rpcs), n)
+		}
+		scheduled := c.dequeueAll()
+		if len(scheduled) != len(testcase.expected) {
+			t.Fatalf("[#%d] Expected %d RPCs, got %d", i, len(testcase.expected), len(scheduled))
+		}
+		for j, rpc := range scheduled {
+			if desc := describeGet(rpc); desc != testcase.expected[j] {
+				t.Errorf("[#%d] Expected %s at %d, got %s", i, testcase.expected[j], j, desc)
+			}
+		}
+		if n := c.queueLen(); n != 0 {
+			t.Errorf("[#%d] Expected no RPC left queued, got %d", i, n)
+		}
+	}
+}
+
+func TestFairSchedulingBatches(t *testing.T) {
+	f := &fairScheduler{queues: make(map[string][]hrpc.Call)}
+	for _, desc := range []string{"a:1", "a:2", "a:3", "a:4", "b:1"} {
+		f.push(tenantGet(desc))
+	}
+	// The turns carry on from one batch to the next, and a tenant that
+	// shows up gets its turn in the next batch.
+	var batches [][]string
+	for i := 0; f.queued > 0; i++ {
+		if i == 1 {
+			f.push(tenantGet("c:1"))
+		}
+		var batch []string
+		for _, rpc := range f.pop(2) {
+			batch = append(batch, describeGet(rpc))
+		}
+		batches = append(batches, batch)
+	}
+	expected := "[[a:1 b:1] [a:2 c:1] [a:3 a:4]]"
+	if got := fmt.Sprint(batches); got != expected {
+		t.Errorf("Expected batches %s, got %s", expected, got)
+	}
+}
+
+func TestFairSchedulingFlood(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	FairScheduling(nil)(c)
+	c.rpcQueueSize = 100
+	c.flushInterval = time.Millisecond
+
+	// The flood is queued before the Get of the other table.
+	for i := 0; i < 20; i++ {
+		if err := c.QueueRPC(tenantGet(fmt.Sprintf("flood:%d", i))); err != nil {
+			t.Fatalf("Failed to queue RPC #%d: %s", i, err)
+		}
+	}
+	quiet := tenantGet("quiet:1")
+	if err := c.QueueRPC(quiet); err != nil {
+		t.Fatalf("Failed to queue RPC: %s", err)
+	}
+	c.SetQueueSize(4)
+	go c.processRpcs()
+
+	// The first flush writes a batch of 4 RPCs, the Get among them.
+	for i := 0; i < 4; i++ {
+		header, _, _, err := readRequest(server)
+		if err != nil {
+			t.Fatalf("Failed to read request #%d: %s", i, err)
+		}
+		c.sentRPCsMutex.Lock()
+		rpc := c.sentRPCs[header.GetCallId()]
+		c.sentRPCsMutex.Unlock()
+		if rpc == quiet {
+			return
+		}
+	}
+	t.Error("Expected the Get to be written with the first batch")
+}
@@ -0,0 +1,51 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"errors"
+
+	"github.com/tsuna/gohbase/hrpc"
+)
+
+// ErrInjectedFault is the error a connection killed by a FaultInjector fails
+// with.
+var ErrInjectedFault = errors.New("connection killed by the fault injector")
+
+// FaultAction tells a Client what to do with a frame given to a FaultInjector.
+type FaultAction int
+
+const (
+	// PassFrame handles the frame normally, possibly after it was altered.
+	PassFrame FaultAction = iota
+	// DropFrame silently drops the frame, as if it was lost on the way.
+	DropFrame
+	// KillConnection closes the connection, as if the RegionServer died.
+	KillConnection
+)
+
+// FaultInjector is given every frame a Client sends or receives, so that
+// tests can deterministically exercise how failures are handled.  A frame
+// can be corrupted by altering or replacing it, and delayed by sleeping
+// before returning.
+type FaultInjector interface {
+	// OnWrite is called with the frame of a request, including its length
+	// prefix, before it's written.  A dropped request waits forever for its
+	// response.
+	OnWrite(rpc hrpc.Call, frame []byte) ([]byte, FaultAction)
+
+	// OnRead is called with the frame of a response, without its length
+	// prefix, before it's decoded.
+	OnRead(frame []byte) ([]byte, FaultAction)
+}
+
+// Faults will return an option that will make the Client pass all its frames
+// through the given FaultInjector.  It's meant for tests only.
+func Faults(f FaultInjector) Option {
+	return func(c *Client) {
+		c.faults = f
+	}
+}
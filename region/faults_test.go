@@ -0,0 +1,94 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/regioninfo"
+	"github.com/tsuna/gohbase/test/fakehbase"
+	"golang.org/x/net/context"
+)
+
+// A FaultInjector applying the given functions.
+type faultFuncs struct {
+	onWrite func(frame []byte) ([]byte, FaultAction)
+	onRead  func(frame []byte) ([]byte, FaultAction)
+}
+
+func (f faultFuncs) OnWrite(rpc hrpc.Call, frame []byte) ([]byte, FaultAction) {
+	if f.onWrite == nil {
+		return frame, PassFrame
+	}
+	return f.onWrite(frame)
+}
+
+func (f faultFuncs) OnRead(frame []byte) ([]byte, FaultAction) {
+	if f.onRead == nil {
+		return frame, PassFrame
+	}
+	return f.onRead(frame)
+}
+
+func TestFaults(t *testing.T) {
+	s, err := fakehbase.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start the fake server: %s", err)
+	}
+	defer s.Close()
+
+	kill := func(frame []byte) ([]byte, FaultAction) { return frame, KillConnection }
+	drop := func(frame []byte) ([]byte, FaultAction) { return frame, DropFrame }
+	tests := []struct {
+		faults faultFuncs
+		// Whether the error must be unrecoverable, or is the
+		// RetryableError for the unknown region otherwise.
+		unrecoverable bool
+		// Whether the RPC must never get a response.
+		lost bool
+	}{
+		{faults: faultFuncs{}},
+		{faults: faultFuncs{onWrite: kill}, unrecoverable: true},
+		{faults: faultFuncs{onRead: kill}, unrecoverable: true},
+		{faults: faultFuncs{onWrite: drop}, lost: true},
+		{faults: faultFuncs{onRead: drop}, lost: true},
+		{faults: faultFuncs{onRead: func([]byte) ([]byte, FaultAction) {
+			return []byte{}, PassFrame // Corrupt: no response header.
+		}}, unrecoverable: true},
+	}
+	for i, test := range tests {
+		c, err := NewClient(s.Host(), s.Port(), 0, 0, Faults(test.faults))
+		if err != nil {
+			t.Fatalf("Failed to connect: %s", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		get, _ := hrpc.NewGetStr(ctx, "test", "foo")
+		get.SetRegion(&regioninfo.Info{RegionName: []byte("unknown")})
+		if err = c.QueueRPC(get); err != nil {
+			t.Fatalf("Failed to queue RPC: %s", err)
+		}
+		select {
+		case res := <-get.GetResultChan():
+			_, unrecoverable := res.Error.(UnrecoverableError)
+			_, retryable := res.Error.(RetryableError)
+			if test.lost {
+				t.Errorf("Test %d: got a result for a lost RPC: %v", i, res)
+			} else if unrecoverable != test.unrecoverable ||
+				(!test.unrecoverable && !retryable) {
+				t.Errorf("Test %d: unexpected error %T: %v", i, res.Error, res.Error)
+			}
+		case <-time.After(200 * time.Millisecond):
+			if !test.lost {
+				t.Errorf("Test %d: no result received", i)
+			}
+		}
+		cancel()
+		// The context being done, the lost RPC is failed right away.
+		c.Close(ctx)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// ErrIdle is used when a connection was closed because it had been idle for
+// longer than its idle timeout.
+var ErrIdle = errors.New("connection closed after being idle")
+
+// KeepAlive will return an option that will set the period of the TCP
+// keepalive probes sent on the connection, so that a RegionServer that went
+// away, or a NAT or firewall that dropped the connection, is noticed even
+// when no RPC is sent.  A negative period disables keepalives, 0 leaves the
+// default of the platform.
+func KeepAlive(period time.Duration) Option {
+	return func(c *Client) {
+		c.keepAlive = period
+	}
+}
+
+// IdleTimeout will return an option that will set how long the connection
+// may go without any RPC before it's closed.  The client is then shut down
+// with ErrIdle, and a new connection is opened the next time the
+// RegionServer is needed.  This keeps long-lived applications from holding
+// on to connections a NAT or firewall silently dropped in the meantime.  A
+// timeout of 0, the default, keeps idle connections open.
+func IdleTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.idleTimeout = timeout
+	}
+}
+
+// Records that the connection is in use, unless it's never closed when idle.
+func (c *Client) touch() {
+	if c.idleTimeout <= 0 {
+		return
+	}
+	c.sentRPCsMutex.Lock()
+	c.lastActivity = time.Now()
+	c.sentRPCsMutex.Unlock()
+}
+
+// reaper periodically checks whether the connection has been idle for longer
+// than idleTimeout, and closes it if so.
+func (c *Client) reaper() {
+	ticker := time.NewTicker(c.idleTimeout / 2)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if c.Err() != nil || c.closeIfIdle(now) {
+			return
+		}
+	}
+}
+
+// closeIfIdle shuts down this client if no RPC is queued or in flight and
+// none was queued or answered for longer than idleTimeout.  Returns true if
+// that was the case.
+func (c *Client) closeIfIdle(now time.Time) bool {
+	// The client is shut down with writeMutex held, so that RPCs are
+	// either queued before and failed, or rejected with ErrIdle.
+	c.writeMutex.Lock()
+	c.sentRPCsMutex.Lock()
+	idleFor := now.Sub(c.lastActivity)
+	idle := c.queueLen() == 0 && len(c.sentRPCs) == 0 && idleFor >= c.idleTimeout
+	c.sentRPCsMutex.Unlock()
+	if idle {
+		idle = c.setErr(ErrIdle)
+	}
+	c.writeMutex.Unlock()
+	if !idle {
+		return false
+	}
+	log.WithFields(log.Fields{
+		"Host":    c.host,
+		"Port":    c.port,
+		"IdleFor": idleFor,
+	}).Debug("Closing idle connection to RegionServer")
+	// Lookups in hbase:meta queued meanwhile are failed with an
+	// UnrecoverableError, and retried on a new connection.
+	c.errorEncountered()
+	return true
+}
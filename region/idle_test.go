@@ -0,0 +1,87 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"golang.org/x/net/context"
+)
+
+func TestCloseIfIdle(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	IdleTimeout(time.Minute)(c)
+	now := time.Now()
+	c.lastActivity = now.Add(-2 * time.Minute)
+
+	// Not idle while an RPC is in flight.
+	get, _ := hrpc.NewGetStr(context.Background(), "test", "row")
+	c.sentRPCs[1] = get
+	if c.closeIfIdle(now) {
+		t.Fatal("Connection closed with an RPC in flight")
+	}
+	delete(c.sentRPCs, 1)
+
+	c.touch()
+	if c.closeIfIdle(now.Add(30 * time.Second)) {
+		t.Fatal("Connection closed before the idle timeout")
+	}
+	if !c.closeIfIdle(now.Add(2 * time.Minute)) {
+		t.Fatal("Idle connection wasn't closed")
+	}
+	if c.Err() != ErrIdle {
+		t.Errorf("Expected the client to be shut down with ErrIdle, got %v", c.Err())
+	}
+	if err := c.QueueRPC(get); err != ErrIdle {
+		t.Errorf("Expected RPCs to be rejected with ErrIdle, got %v", err)
+	}
+}
+
+func TestCloseIfIdleQueuedRPC(t *testing.T) {
+	c, server := newPipeClient()
+	defer server.Close()
+	IdleTimeout(time.Minute)(c)
+	now := time.Now()
+	// No writer goroutine is running: a full queue blocks QueueRPC until
+	// the client is shut down.
+	c.rpcQueueSize = 0
+
+	get, _ := hrpc.NewGetStr(context.Background(), "test", "row")
+	queued := make(chan error, 1)
+	go func() {
+		queued <- c.QueueRPC(get)
+	}()
+	for {
+		c.writeMutex.Lock()
+		n := c.queueLen()
+		c.writeMutex.Unlock()
+		if n != 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Not idle while an RPC is queued.
+	if c.closeIfIdle(now.Add(2 * time.Minute)) {
+		t.Fatal("Connection closed with an RPC queued")
+	}
+
+	c.fail(ErrIdle)
+	select {
+	case err := <-queued:
+		if err != nil {
+			t.Errorf("Expected the RPC to be queued, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("QueueRPC still blocked after the client was shut down")
+	}
+	res := <-get.GetResultChan()
+	if err, ok := res.Error.(UnrecoverableError); !ok || err.error != ErrIdle {
+		t.Errorf("Expected the queued RPC to fail with ErrIdle, got %v", res.Error)
+	}
+}
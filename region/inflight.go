@@ -0,0 +1,76 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"bytes"
+
+	"github.com/tsuna/gohbase/hrpc"
+)
+
+// MaxInFlight will return an option that will set how many RPCs may be queued
+// or waiting for their response at once.  Past that, QueueRPC blocks until
+// one of them is answered, or fails with the error of the context of the RPC
+// once it's done.  This keeps the call queue of the RegionServer from
+// overflowing, and bounds the memory used by the client.  Lookups in
+// hbase:meta aren't counted, so that routing never waits.  A limit of 0, the
+// default, leaves their number unbounded.
+func MaxInFlight(limit int) Option {
+	return func(c *Client) {
+		if limit > 0 {
+			c.slots = make(chan struct{}, limit)
+		} else {
+			c.slots = nil
+		}
+	}
+}
+
+// acquireSlot takes a slot for the given RPC, waiting for one to be released
+// if they're all taken.  Returns the error of the context of the RPC if it's
+// done first, or the error that shut down the client meanwhile.
+func (c *Client) acquireSlot(rpc hrpc.Call) error {
+	if c.slots == nil || bytes.Equal(rpc.Table(), metaTableName) {
+		return nil
+	}
+	select {
+	case c.slots <- struct{}{}:
+	case <-rpc.GetContext().Done():
+		return rpc.GetContext().Err()
+	}
+	c.slotsMutex.Lock()
+	if c.slotHolders == nil {
+		c.slotHolders = make(map[hrpc.Call]int)
+	}
+	c.slotHolders[rpc]++
+	c.slotsMutex.Unlock()
+	if err := c.Err(); err != nil {
+		// The slots were released by the RPCs failed along with the
+		// connection.
+		c.releaseSlot(rpc)
+		return err
+	}
+	return nil
+}
+
+// releaseSlot releases the slot taken by the given RPC, once it's answered or
+// failed.  It does nothing if the RPC holds no slot, e.g. because it was
+// released already.
+func (c *Client) releaseSlot(rpc hrpc.Call) {
+	if c.slots == nil || bytes.Equal(rpc.Table(), metaTableName) {
+		return
+	}
+	c.slotsMutex.Lock()
+	held := c.slotHolders[rpc]
+	if held == 1 {
+		delete(c.slotHolders, rpc)
+	} else if held > 1 {
+		c.slotHolders[rpc] = held - 1
+	}
+	c.slotsMutex.Unlock()
+	if held > 0 {
+		<-c.slots
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"bufio"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tsuna/gohbase/hrpc"
+)
+
+// ErrConnectionLost is returned for the RPCs written to a connection that
+// failed before their response was received, when the client reconnects
+// rather than shuts down.  They're not written again, as the RegionServer may
+// have applied them already.
+var ErrConnectionLost = errors.New("connection to the RegionServer lost before the response")
+
+// Reconnect will return an option that will make the client reconnect to the
+// RegionServer when its connection fails, rather than shut down.  The
+// RegionServer is re-dialed first after min, then after twice as long as the
+// previous time, up to max, each delay being shortened by up to half at
+// random so that the clients of a RegionServer that went away don't all
+// re-dial it at once.  RPCs keep being queued meanwhile, and the RPCs queued
+// but not written yet are written once reconnected, unless their context is
+// done first.  The RPCs written already are failed with ErrConnectionLost.  A
+// min that isn't positive, the default, disables reconnecting, and a max
+// lower than min is replaced by min.  The client still shuts down when the
+// RegionServer rejects its cell block codec.
+func Reconnect(min, max time.Duration) Option {
+	return func(c *Client) {
+		if max < min {
+			max = min
+		}
+		c.minReconnectBackoff = min
+		c.maxReconnectBackoff = max
+	}
+}
+
+// Returns a random duration between half the given one and the given one.
+func jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Records that the current connection failed with the given error, and
+// starts reconnecting unless that's under way already.  The given RPCs not
+// written yet are queued again, to be written once reconnected.  Returns
+// false, without queuing them, if the client doesn't reconnect and has to be
+// shut down instead.
+func (c *Client) connectionLost(err error, unsent []hrpc.Call) bool {
+	if c.minReconnectBackoff <= 0 || err == ErrCodecRejected {
+		return false
+	}
+	c.writeMutex.Lock()
+	if c.sendErr != nil {
+		c.writeMutex.Unlock()
+		return false
+	}
+	c.enqueue(unsent...)
+	if c.reconnecting {
+		// Reported by another goroutine of the lost connection.
+		c.writeMutex.Unlock()
+		return true
+	}
+	c.reconnecting = true
+	close(c.connLost)
+	conn := c.conn
+	c.writeMutex.Unlock()
+
+	log.WithFields(log.Fields{
+		"Host":  c.host,
+		"Port":  c.port,
+		"Error": err,
+	}).Warn("Lost the connection to the RegionServer, reconnecting")
+	c.failSent(hrpc.RPCResult{Error: ErrConnectionLost})
+	conn.Close()
+	go c.reconnect()
+	return true
+}
+
+// reconnect re-dials the RegionServer, backing off exponentially between
+// the attempts, until it succeeds or the client is shut down.
+func (c *Client) reconnect() {
+	// The goroutines of the lost connection stop once it's closed.
+	c.loops.Wait()
+	backoff := c.minReconnectBackoff
+	for {
+		select {
+		case <-time.After(jitter(backoff)):
+		case <-c.done:
+			return
+		}
+		c.dropExpired()
+		err := c.reopen()
+		if err == nil {
+			return
+		}
+		log.WithFields(log.Fields{
+			"Host":    c.host,
+			"Port":    c.port,
+			"Error":   err,
+			"Backoff": backoff,
+		}).Debug("Failed to reconnect to the RegionServer, backing off.")
+		if backoff *= 2; backoff > c.maxReconnectBackoff {
+			backoff = c.maxReconnectBackoff
+		}
+	}
+}
+
+// Opens a new connection to the RegionServer and starts writing the RPCs
+// queued over it, unless the client was shut down meanwhile.
+func (c *Client) reopen() error {
+	conn, err := c.open()
+	if err != nil {
+		return err
+	}
+	// RPCs racing to be written directly by their callers are held up
+	// until the connection is set up.
+	c.sendMutex.Lock()
+	c.writeMutex.Lock()
+	c.setConn(conn)
+	c.writeMutex.Unlock()
+	err = c.handshake()
+	c.sendMutex.Unlock()
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	c.writeMutex.Lock()
+	if c.sendErr != nil {
+		c.writeMutex.Unlock()
+		conn.Close()
+		return nil
+	}
+	c.sentRPCsMutex.Lock()
+	c.sentRPCs = make(map[uint32]hrpc.Call)
+	c.sentRPCsMutex.Unlock()
+	c.reconnecting = false
+	lost := make(chan struct{})
+	c.connLost = lost
+	queued := c.queueLen() > 0
+	c.writeMutex.Unlock()
+
+	log.WithFields(log.Fields{
+		"Host": c.host,
+		"Port": c.port,
+	}).Info("Reconnected to the RegionServer")
+	c.startLoops()
+	// The RPCs queued meanwhile are written right away.
+	select {
+	case c.metaReady <- struct{}{}:
+	default:
+	}
+	if queued {
+		select {
+		case c.process <- struct{}{}:
+		case <-c.done:
+		case <-lost:
+		}
+	}
+	return nil
+}
+
+// Removes from the queues the RPCs whose context is done, as their callers
+// stopped waiting for them, so that they don't hold up the others while the
+// client reconnects.
+func (c *Client) dropExpired() {
+	c.writeMutex.Lock()
+	for _, rpc := range c.dequeueAll() {
+		if !c.dropIfExpired(rpc) {
+			c.enqueue(rpc)
+		}
+	}
+	c.writeMutex.Unlock()
+
+	c.metaMutex.Lock()
+	rpcs := c.metaRPCs[:0]
+	for _, rpc := range c.metaRPCs {
+		if !c.dropIfExpired(rpc) {
+			rpcs = append(rpcs, rpc)
+		}
+	}
+	c.metaRPCs = rpcs
+	c.metaMutex.Unlock()
+}
+
+// Releases the slot of the given RPC if its context is done.  Returns true if
+// it was.
+func (c *Client) dropIfExpired(rpc hrpc.Call) bool {
+	select {
+	case <-rpc.GetContext().Done():
+		c.releaseSlot(rpc)
+		return true
+	default:
+		return false
+	}
+}
+
+// Sets up the client to use the given connection.  Must be called with
+// sendMutex and writeMutex held once the writer and reader goroutines are
+// started.
+func (c *Client) setConn(conn net.Conn) {
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+	c.writer = bufio.NewWriterSize(conn, writeBufferSize)
+	c.sentPreamble = false
+}
+
+// Starts the writer and reader goroutines of the current connection.
+func (c *Client) startLoops() {
+	c.loops.Add(2)
+	go func() { // Writer goroutine
+		defer c.loops.Done()
+		c.processRpcs()
+	}()
+	go func() { // Reader goroutine
+		defer c.loops.Done()
+		c.receiveRpcs()
+	}()
+}
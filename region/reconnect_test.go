@@ -0,0 +1,192 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/regioninfo"
+	"github.com/tsuna/gohbase/test/fakehbase"
+	"golang.org/x/net/context"
+)
+
+// Returns a function killing the connection the first time it's called.
+func killFirst(calls *int32) func([]byte) ([]byte, FaultAction) {
+	return func(frame []byte) ([]byte, FaultAction) {
+		if atomic.AddInt32(calls, 1) == 1 {
+			return frame, KillConnection
+		}
+		return frame, PassFrame
+	}
+}
+
+// Waits for the client to notice that its connection was lost.
+func waitReconnecting(t *testing.T, c *Client) {
+	for i := 0; i < 500; i++ {
+		c.writeMutex.Lock()
+		reconnecting := c.reconnecting
+		c.writeMutex.Unlock()
+		if reconnecting {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("The client didn't notice that its connection was lost")
+}
+
+func newReconnectGet(t *testing.T, ctx context.Context, c *Client) *hrpc.Get {
+	get, _ := hrpc.NewGetStr(ctx, "test", "foo")
+	get.SetRegion(&regioninfo.Info{RegionName: []byte("unknown")})
+	if err := c.QueueRPC(get); err != nil {
+		t.Fatalf("Failed to queue RPC: %s", err)
+	}
+	return get
+}
+
+func TestReconnectReplaysUnsentRPCs(t *testing.T) {
+	s, err := fakehbase.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start the fake server: %s", err)
+	}
+	defer s.Close()
+	var writes int32
+	c, err := NewClient(s.Host(), s.Port(), 0, 0,
+		Faults(faultFuncs{onWrite: killFirst(&writes)}),
+		Reconnect(time.Millisecond, 10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to connect: %s", err)
+	}
+	defer c.Close(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The connection dies as the RPC is written, which is written again
+	// once reconnected, and answered with the RetryableError of the
+	// unknown region.
+	get := newReconnectGet(t, ctx, c)
+	select {
+	case res := <-get.GetResultChan():
+		if _, ok := res.Error.(RetryableError); !ok {
+			t.Errorf("Expected the RPC to be answered once reconnected, got %T", res.Error)
+		}
+	case <-ctx.Done():
+		t.Fatal("The RPC wasn't written again once reconnected")
+	}
+	if sent := c.Stats().RPCsSent; sent != 1 {
+		t.Errorf("Expected the RPC to be sent once, got %d RPCs sent", sent)
+	}
+	if c.Err() != nil {
+		t.Errorf("Expected the client to be usable after reconnecting, got %v", c.Err())
+	}
+}
+
+func TestReconnectFailsSentRPCs(t *testing.T) {
+	s, err := fakehbase.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start the fake server: %s", err)
+	}
+	defer s.Close()
+	var reads int32
+	c, err := NewClient(s.Host(), s.Port(), 0, 0,
+		Faults(faultFuncs{onRead: killFirst(&reads)}),
+		Reconnect(time.Millisecond, 10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to connect: %s", err)
+	}
+	defer c.Close(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The connection dies as the response is received, so the RPC may
+	// have been applied and isn't written again.
+	get := newReconnectGet(t, ctx, c)
+	select {
+	case res := <-get.GetResultChan():
+		if res.Error != ErrConnectionLost {
+			t.Errorf("Expected ErrConnectionLost, got %T", res.Error)
+		}
+	case <-ctx.Done():
+		t.Fatal("The RPC in flight wasn't failed")
+	}
+
+	// The following RPCs are sent over the new connection.
+	get = newReconnectGet(t, ctx, c)
+	select {
+	case res := <-get.GetResultChan():
+		if _, ok := res.Error.(RetryableError); !ok {
+			t.Errorf("Expected the RPC to be answered once reconnected, got %T", res.Error)
+		}
+	case <-ctx.Done():
+		t.Fatal("The RPC wasn't written once reconnected")
+	}
+	if sent := c.Stats().RPCsSent; sent != 2 {
+		t.Errorf("Expected each RPC to be sent once, got %d RPCs sent", sent)
+	}
+}
+
+func TestReconnectDropsExpiredRPCs(t *testing.T) {
+	s, err := fakehbase.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start the fake server: %s", err)
+	}
+	c, err := NewClient(s.Host(), s.Port(), 0, 0, MaxInFlight(1),
+		Reconnect(time.Millisecond, 10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to connect: %s", err)
+	}
+	defer c.Close(context.Background())
+	// The RegionServer is gone, so the client keeps reconnecting.
+	s.Close()
+	waitReconnecting(t, c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	newReconnectGet(t, ctx, c)
+	// The slot of the RPC is released once its context is done, while
+	// the client is still reconnecting.
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	newReconnectGet(t, ctx, c)
+	if c.Err() != nil {
+		t.Errorf("Expected the client to still be reconnecting, got %v", c.Err())
+	}
+}
+
+func TestCloseStopsReconnecting(t *testing.T) {
+	s, err := fakehbase.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start the fake server: %s", err)
+	}
+	c, err := NewClient(s.Host(), s.Port(), 0, 0,
+		Reconnect(time.Millisecond, 10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Failed to connect: %s", err)
+	}
+	s.Close()
+	waitReconnecting(t, c)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	get := newReconnectGet(t, ctx, c)
+	time.Sleep(20 * time.Millisecond)
+	if err = c.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %s", err)
+	}
+	select {
+	case res := <-get.GetResultChan():
+		if e, ok := res.Error.(UnrecoverableError); !ok || e.error != ErrClientClosed {
+			t.Errorf("Expected the queued RPC to fail with ErrClientClosed, got %T", res.Error)
+		}
+	case <-ctx.Done():
+		t.Fatal("The queued RPC wasn't failed")
+	}
+	if err = c.QueueRPC(get); err != ErrClientClosed {
+		t.Errorf("Expected ErrClientClosed once closed, got %v", err)
+	}
+}
@@ -0,0 +1,412 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DigestMD5 is the name of the SASL mechanism used to authenticate with
+// delegation tokens.
+const DigestMD5 = "DIGEST-MD5"
+
+// GSSAPI is the name of the SASL mechanism used to authenticate with Kerberos
+// (RFC 4752).
+const GSSAPI = "GSSAPI"
+
+// Authentication methods announced in the connection preamble.
+const (
+	simpleAuth   = 0x50
+	kerberosAuth = 0x51
+	digestAuth   = 0x52
+)
+
+// Security layers offered by the server at the end of the GSSAPI exchange.
+// Only the absence of security layer is supported.
+const gssapiNoSecurityLayer = 1
+
+// Status of the responses of the server during the SASL exchange.
+const saslSuccess = 0
+
+// Length of the response of a server that doesn't require SASL, telling the
+// client to send its connection header right away.
+const switchToSimpleAuth = -88
+
+// Maximum length of the tokens and strings sent by the server during the SASL
+// exchange, to not trust a malformed frame with the size of an allocation.
+const maxSASLLength = 1 << 20
+
+// Digest URI used by HBase, whose SASL servers have no protocol and the
+// default realm as name.
+const digestURI = "null/default"
+
+// SASLCredentials are the credentials a client authenticates with using SASL.
+type SASLCredentials struct {
+	// Mechanism is the SASL mechanism, DigestMD5 or GSSAPI.
+	Mechanism string
+
+	// Credentials used by DigestMD5.
+	Username string
+	Password []byte
+
+	// NewSecurityContext returns a new Kerberos security context to
+	// authenticate with the RegionServer on the given host, for GSSAPI.
+	// It's typically the principal "hbase/<host>@<REALM>" of the
+	// RegionServer that the context is initiated with.
+	NewSecurityContext func(host string) (SecurityContext, error)
+}
+
+// A SecurityContext is a GSS-API security context (RFC 2743) established by
+// a Kerberos implementation, such as that of the system's libgssapi or a
+// pure Go one.  gohbase doesn't implement Kerberos itself.
+type SecurityContext interface {
+	// Step processes the token sent by the server, nil at first, and
+	// returns the token to send to the server, if any, and whether the
+	// context is established (GSS_Init_sec_context).
+	Step(token []byte) (output []byte, established bool, err error)
+
+	// Wrap protects the integrity of the given message (GSS_Wrap without
+	// confidentiality).
+	Wrap(message []byte) ([]byte, error)
+
+	// Unwrap returns the message of a token made by GSS_Wrap on the server
+	// side, once its integrity is checked.
+	Unwrap(token []byte) ([]byte, error)
+}
+
+// SASL will return an option that will make the client authenticate with
+// SASL, using the credentials returned by the given function every time a
+// connection is established.  It's given the "host:port" address of the
+// server, and when it returns nil credentials, the client connects with simple
+// authentication.  Only the "auth" quality of protection is supported: use TLS
+// to protect the connection.
+func SASL(credentials func(addr string) (*SASLCredentials, error)) Option {
+	return func(c *Client) {
+		c.saslCredentials = credentials
+	}
+}
+
+// authenticate authenticates with SASL if there are credentials to do so.
+func (c *Client) authenticate() error {
+	creds, err := c.saslCredentials(c.addr())
+	if err != nil {
+		return fmt.Errorf("failed to get the SASL credentials: %s", err)
+	} else if creds == nil {
+		return nil
+	}
+	if err = c.saslConnect(creds); err != nil {
+		return fmt.Errorf("SASL authentication with the RegionServer at %s failed: %s",
+			c.addr(), err)
+	}
+	return nil
+}
+
+// saslConnect sends the preamble of the connection and authenticates with the
+// given credentials.  The connection header must be sent afterwards without
+// preamble.
+func (c *Client) saslConnect(creds *SASLCredentials) error {
+	switch creds.Mechanism {
+	case DigestMD5:
+		return c.digestMD5Connect(creds)
+	case GSSAPI:
+		return c.gssapiConnect(creds)
+	}
+	return fmt.Errorf("unsupported SASL mechanism %q", creds.Mechanism)
+}
+
+// writePreamble sends the preamble of the connection, announcing the given
+// authentication method.
+func (c *Client) writePreamble(auth byte) error {
+	buf := []byte("HBas\x00\x00")
+	buf[5] = auth
+	if err := c.write(buf); err != nil {
+		return err
+	}
+	c.sentPreamble = true
+	return nil
+}
+
+// writeSASLToken sends a token to the server during the SASL exchange.
+func (c *Client) writeSASLToken(token []byte) error {
+	buf := make([]byte, 4, 4+len(token))
+	binary.BigEndian.PutUint32(buf, uint32(len(token)))
+	return c.write(append(buf, token...))
+}
+
+// digestMD5Connect authenticates with DIGEST-MD5.
+func (c *Client) digestMD5Connect(creds *SASLCredentials) error {
+	if err := c.writePreamble(digestAuth); err != nil {
+		return err
+	}
+	// The DIGEST-MD5 exchange starts with an empty token.
+	if err := c.writeSASLToken(nil); err != nil {
+		return err
+	}
+	challenge, simple, err := c.readSASLToken()
+	if err != nil || simple {
+		return err
+	}
+	response, rspauth, err := digestMD5Response(creds, challenge)
+	if err != nil {
+		return err
+	}
+	if err = c.writeSASLToken(response); err != nil {
+		return err
+	}
+	final, _, err := c.readSASLToken()
+	if err != nil {
+		return err
+	}
+	fields, err := parseDigestChallenge(final)
+	if err != nil {
+		return err
+	}
+	if fields["rspauth"] != rspauth {
+		return errors.New("the RegionServer failed to prove it knows the SASL credentials")
+	}
+	return nil
+}
+
+// gssapiConnect authenticates with GSSAPI: tokens are exchanged until the
+// security context is established, after which the server offers security
+// layers, and the client picks none (RFC 4752).
+func (c *Client) gssapiConnect(creds *SASLCredentials) error {
+	if creds.NewSecurityContext == nil {
+		return errors.New("no Kerberos security context for GSSAPI")
+	}
+	ctx, err := creds.NewSecurityContext(c.host)
+	if err != nil {
+		return err
+	}
+	if err = c.writePreamble(kerberosAuth); err != nil {
+		return err
+	}
+	token, established, err := ctx.Step(nil)
+	if err != nil {
+		return err
+	}
+	if err = c.writeSASLToken(token); err != nil {
+		return err
+	}
+	for !established {
+		challenge, simple, err := c.readSASLToken()
+		if err != nil || simple {
+			return err
+		}
+		if token, established, err = ctx.Step(challenge); err != nil {
+			return err
+		}
+		// The last token may be empty, it's sent all the same.
+		if err = c.writeSASLToken(token); err != nil {
+			return err
+		}
+	}
+	challenge, _, err := c.readSASLToken()
+	if err != nil {
+		return err
+	}
+	layers, err := ctx.Unwrap(challenge)
+	if err != nil {
+		return err
+	} else if len(layers) != 4 {
+		return fmt.Errorf("invalid GSSAPI security layers %q", layers)
+	} else if layers[0]&gssapiNoSecurityLayer == 0 {
+		return errors.New("the RegionServer requires a SASL security layer: " +
+			"set hbase.rpc.protection to authentication")
+	}
+	// No security layer, and thus no maximum message size.
+	response, err := ctx.Wrap([]byte{gssapiNoSecurityLayer, 0, 0, 0})
+	if err != nil {
+		return err
+	}
+	return c.writeSASLToken(response)
+}
+
+// readSASLToken reads a token sent by the server during the SASL exchange.
+// simple is true if the server doesn't require SASL.
+func (c *Client) readSASLToken() (token []byte, simple bool, err error) {
+	var buf [4]byte
+	if err = c.readFully(buf[:]); err != nil {
+		return nil, false, err
+	}
+	if status := binary.BigEndian.Uint32(buf[:]); status != saslSuccess {
+		class, err := c.readWritableString()
+		if err != nil {
+			return nil, false, err
+		}
+		message, err := c.readWritableString()
+		if err != nil {
+			return nil, false, err
+		}
+		return nil, false, fmt.Errorf("%s: %s", class, message)
+	}
+	if err = c.readFully(buf[:]); err != nil {
+		return nil, false, err
+	}
+	n := int32(binary.BigEndian.Uint32(buf[:]))
+	if n == switchToSimpleAuth {
+		return nil, true, nil
+	} else if n < 0 || n > maxSASLLength {
+		return nil, false, fmt.Errorf("invalid SASL token length %d", n)
+	}
+	token = make([]byte, n)
+	if err = c.readFully(token); err != nil {
+		return nil, false, err
+	}
+	return token, false, nil
+}
+
+// readWritableString reads a string serialized by Hadoop's WritableUtils: its
+// length as a variable-length integer, then its bytes.
+func (c *Client) readWritableString() (string, error) {
+	var b [1]byte
+	if err := c.readFully(b[:]); err != nil {
+		return "", err
+	}
+	first := int8(b[0])
+	n := int64(first)
+	if first < -112 {
+		// The first byte is followed by the big-endian integer, whose
+		// number of bytes and sign it encodes.
+		negative := first < -120
+		size := -112 - int(first)
+		if negative {
+			size = -120 - int(first)
+		}
+		buf := make([]byte, size)
+		if err := c.readFully(buf); err != nil {
+			return "", err
+		}
+		n = 0
+		for _, v := range buf {
+			n = n<<8 | int64(v)
+		}
+		if negative {
+			n = ^n
+		}
+	}
+	if n == -1 {
+		return "", nil // A null string.
+	} else if n < 0 || n > maxSASLLength {
+		return "", fmt.Errorf("invalid SASL string length %d", n)
+	}
+	buf := make([]byte, n)
+	if err := c.readFully(buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// digestMD5Response returns the response to the given DIGEST-MD5 challenge
+// (RFC 2831), and the rspauth the server must answer with.
+func digestMD5Response(creds *SASLCredentials, challenge []byte) ([]byte, string, error) {
+	fields, err := parseDigestChallenge(challenge)
+	if err != nil {
+		return nil, "", err
+	}
+	nonce := fields["nonce"]
+	if nonce == "" {
+		return nil, "", errors.New("no nonce in the DIGEST-MD5 challenge")
+	}
+	if qop, ok := fields["qop"]; ok && !hasToken(qop, "auth") {
+		return nil, "", fmt.Errorf("unsupported SASL quality of protection %q", qop)
+	}
+	realm := fields["realm"]
+	var random [16]byte
+	if _, err = rand.Read(random[:]); err != nil {
+		return nil, "", err
+	}
+	cnonce := base64.StdEncoding.EncodeToString(random[:])
+	const nc = "00000001"
+	response := digestMD5(creds.Username, realm, creds.Password, nonce, cnonce, nc,
+		"AUTHENTICATE:"+digestURI)
+	rspauth := digestMD5(creds.Username, realm, creds.Password, nonce, cnonce, nc,
+		":"+digestURI)
+	resp := fmt.Sprintf(`charset=utf-8,username="%s",realm="%s",nonce="%s",nc=%s,`+
+		`cnonce="%s",digest-uri="%s",maxbuf=65536,response=%s,qop=auth`,
+		quoteDigest(creds.Username), quoteDigest(realm), quoteDigest(nonce), nc,
+		cnonce, digestURI, response)
+	return []byte(resp), rspauth, nil
+}
+
+// digestMD5 computes the response of DIGEST-MD5 with the "auth" quality of
+// protection for the given A2.
+func digestMD5(username, realm string, password []byte, nonce, cnonce, nc, a2 string) string {
+	h := md5.New()
+	fmt.Fprintf(h, "%s:%s:", username, realm)
+	h.Write(password)
+	a1 := append(h.Sum(nil), ":"+nonce+":"+cnonce...)
+	kd := hex.EncodeToString(md5sum(a1)) + ":" + nonce + ":" + nc + ":" + cnonce +
+		":auth:" + hex.EncodeToString(md5sum([]byte(a2)))
+	return hex.EncodeToString(md5sum([]byte(kd)))
+}
+
+func md5sum(data []byte) []byte {
+	sum := md5.Sum(data)
+	return sum[:]
+}
+
+// parseDigestChallenge parses the comma-separated key=value pairs of a
+// DIGEST-MD5 challenge, whose values may be quoted.
+func parseDigestChallenge(challenge []byte) (map[string]string, error) {
+	fields := make(map[string]string)
+	s := string(challenge)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return fields, nil
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("invalid DIGEST-MD5 challenge %q", challenge)
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = s[eq+1:]
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var buf []byte
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				buf = append(buf, s[i])
+			}
+			if i == len(s) {
+				return nil, fmt.Errorf("unterminated quoted value in DIGEST-MD5 challenge %q",
+					challenge)
+			}
+			value, s = string(buf), s[i+1:]
+		} else if comma := strings.IndexByte(s, ','); comma >= 0 {
+			value, s = strings.TrimSpace(s[:comma]), s[comma:]
+		} else {
+			value, s = strings.TrimSpace(s), ""
+		}
+		fields[key] = value
+	}
+}
+
+// Returns true if the given comma-separated list contains the given token.
+func hasToken(list, token string) bool {
+	for _, t := range strings.Split(list, ",") {
+		if strings.TrimSpace(t) == token {
+			return true
+		}
+	}
+	return false
+}
+
+// Escapes the quotes and backslashes of a quoted value.
+func quoteDigest(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
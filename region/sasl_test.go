@@ -0,0 +1,266 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestDigestMD5(t *testing.T) {
+	// Example of RFC 2831.
+	password := []byte("secret")
+	response := digestMD5("chris", "elwood.innosoft.com", password, "OA6MG9tEQGm2hh",
+		"OA6MHXh6VqTrRk", "00000001", "AUTHENTICATE:imap/elwood.innosoft.com")
+	if response != "d388dad90d4bbd760a152321f2143af7" {
+		t.Errorf("Unexpected response %s", response)
+	}
+	rspauth := digestMD5("chris", "elwood.innosoft.com", password, "OA6MG9tEQGm2hh",
+		"OA6MHXh6VqTrRk", "00000001", ":imap/elwood.innosoft.com")
+	if rspauth != "ea40f60335c427b5527b84dbabcdfffd" {
+		t.Errorf("Unexpected rspauth %s", rspauth)
+	}
+}
+
+func TestParseDigestChallenge(t *testing.T) {
+	fields, err := parseDigestChallenge([]byte(
+		`realm="a \"b\", c",nonce="OA6MG9tEQGm2hh", qop="auth,auth-int",charset=utf-8,` +
+			`algorithm=md5-sess`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"realm":     `a "b", c`,
+		"nonce":     "OA6MG9tEQGm2hh",
+		"qop":       "auth,auth-int",
+		"charset":   "utf-8",
+		"algorithm": "md5-sess",
+	}
+	if len(fields) != len(expected) {
+		t.Errorf("Expected %v, got %v", expected, fields)
+	}
+	for k, v := range expected {
+		if fields[k] != v {
+			t.Errorf("Expected %s=%q, got %q", k, v, fields[k])
+		}
+	}
+	if _, err = parseDigestChallenge([]byte(`nonce="abc`)); err == nil {
+		t.Error("Expected an error for an unterminated value")
+	}
+}
+
+// Writes a successful SASL response with the given token.
+func writeSASLToken(t *testing.T, conn net.Conn, token []byte) {
+	buf := make([]byte, 8, 8+len(token))
+	binary.BigEndian.PutUint32(buf[4:], uint32(len(token)))
+	if _, err := conn.Write(append(buf, token...)); err != nil {
+		t.Errorf("Failed to write the SASL token: %s", err)
+	}
+}
+
+func TestSASLConnect(t *testing.T) {
+	creds := &SASLCredentials{Mechanism: DigestMD5, Username: "user",
+		Password: []byte("password")}
+	c, server := newPipeClient()
+	c.saslCredentials = func(addr string) (*SASLCredentials, error) {
+		if addr != "regionserver:16020" {
+			t.Errorf("Unexpected address %s", addr)
+		}
+		return creds, nil
+	}
+	done := make(chan error)
+	go func() {
+		done <- c.authenticate()
+	}()
+
+	preamble := make([]byte, 10)
+	if _, err := io.ReadFull(server, preamble); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(preamble, []byte("HBas\x00\x52\x00\x00\x00\x00")) {
+		t.Fatalf("Unexpected preamble %q", preamble)
+	}
+	writeSASLToken(t, server, []byte(`realm="default",nonce="nonce",qop="auth",`+
+		`charset=utf-8,algorithm=md5-sess`))
+
+	var length [4]byte
+	if _, err := io.ReadFull(server, length[:]); err != nil {
+		t.Fatal(err)
+	}
+	response := make([]byte, binary.BigEndian.Uint32(length[:]))
+	if _, err := io.ReadFull(server, response); err != nil {
+		t.Fatal(err)
+	}
+	fields, err := parseDigestChallenge(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields["username"] != "user" || fields["digest-uri"] != digestURI {
+		t.Errorf("Unexpected response %s", response)
+	}
+	expected := digestMD5("user", "default", creds.Password, "nonce", fields["cnonce"],
+		fields["nc"], "AUTHENTICATE:"+digestURI)
+	if fields["response"] != expected {
+		t.Errorf("Expected the response %s, got %s", expected, fields["response"])
+	}
+	rspauth := digestMD5("user", "default", creds.Password, "nonce", fields["cnonce"],
+		fields["nc"], ":"+digestURI)
+	writeSASLToken(t, server, []byte("rspauth="+rspauth))
+	if err = <-done; err != nil {
+		t.Fatalf("Authentication failed: %s", err)
+	}
+	if !c.sentPreamble {
+		t.Error("Expected the preamble to be sent")
+	}
+
+	// The server rejects the credentials.
+	c, server = newPipeClient()
+	c.saslCredentials = func(string) (*SASLCredentials, error) { return creds, nil }
+	go func() {
+		done <- c.authenticate()
+	}()
+	if _, err = io.ReadFull(server, preamble); err != nil {
+		t.Fatal(err)
+	}
+	class, message := "javax.security.sasl.SaslException", "DIGEST-MD5: digest response"
+	// Both strings are shorter than 112 bytes, so their length fits in a byte.
+	rejection := []byte{0, 0, 0, 1, byte(len(class))}
+	rejection = append(rejection, class...)
+	rejection = append(append(rejection, byte(len(message))), message...)
+	if _, err = server.Write(rejection); err != nil {
+		t.Fatal(err)
+	}
+	if err = <-done; err == nil || !strings.Contains(err.Error(), class) {
+		t.Errorf("Expected a SaslException, got %v", err)
+	}
+}
+
+func TestSASLInvalidLengths(t *testing.T) {
+	creds := &SASLCredentials{Mechanism: DigestMD5, Username: "user",
+		Password: []byte("password")}
+	for i, response := range [][]byte{
+		// A token larger than any the server would send.
+		{0, 0, 0, 0, 0x7f, 0xff, 0xff, 0xff},
+		{0, 0, 0, 0, 0xff, 0xff, 0xff, 0xfe},
+		// An exception whose class name is a vlong of 8 bytes.
+		{0, 0, 0, 1, 0x88, 0x7f, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		// Or is negative.
+		{0, 0, 0, 1, 0x87, 0x7f},
+	} {
+		c, server := newPipeClient()
+		c.saslCredentials = func(string) (*SASLCredentials, error) { return creds, nil }
+		done := make(chan error)
+		go func() {
+			done <- c.authenticate()
+		}()
+		preamble := make([]byte, 10)
+		if _, err := io.ReadFull(server, preamble); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := server.Write(response); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-done; err == nil || !strings.Contains(err.Error(), "length") {
+			t.Errorf("#%d: Expected an invalid length error, got %v", i, err)
+		}
+		server.Close()
+	}
+}
+
+// A security context exchanging fixed tokens, whose wrapped messages are
+// prefixed with "wrap:".
+type fakeSecurityContext struct {
+	steps int
+}
+
+func (ctx *fakeSecurityContext) Step(token []byte) ([]byte, bool, error) {
+	ctx.steps++
+	if ctx.steps == 1 {
+		return []byte("init"), false, nil
+	} else if string(token) != "challenge" {
+		return nil, false, errors.New("unexpected token")
+	}
+	return nil, true, nil
+}
+
+func (ctx *fakeSecurityContext) Wrap(message []byte) ([]byte, error) {
+	return append([]byte("wrap:"), message...), nil
+}
+
+func (ctx *fakeSecurityContext) Unwrap(token []byte) ([]byte, error) {
+	if !bytes.HasPrefix(token, []byte("wrap:")) {
+		return nil, errors.New("invalid token")
+	}
+	return token[len("wrap:"):], nil
+}
+
+// Reads a token sent by the client during the SASL exchange.
+func readSASLToken(t *testing.T, conn net.Conn) []byte {
+	var length [4]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		t.Fatal(err)
+	}
+	token := make([]byte, binary.BigEndian.Uint32(length[:]))
+	if _, err := io.ReadFull(conn, token); err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestGSSAPIConnect(t *testing.T) {
+	for _, layers := range []byte{gssapiNoSecurityLayer, 4} {
+		c, server := newPipeClient()
+		c.saslCredentials = func(string) (*SASLCredentials, error) {
+			return &SASLCredentials{
+				Mechanism: GSSAPI,
+				NewSecurityContext: func(host string) (SecurityContext, error) {
+					if host != "regionserver" {
+						t.Errorf("Unexpected host %s", host)
+					}
+					return &fakeSecurityContext{}, nil
+				},
+			}, nil
+		}
+		done := make(chan error)
+		go func() {
+			done <- c.authenticate()
+		}()
+
+		preamble := make([]byte, 6)
+		if _, err := io.ReadFull(server, preamble); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(preamble, []byte("HBas\x00\x51")) {
+			t.Fatalf("Unexpected preamble %q", preamble)
+		}
+		if token := readSASLToken(t, server); string(token) != "init" {
+			t.Fatalf("Unexpected initial token %q", token)
+		}
+		writeSASLToken(t, server, []byte("challenge"))
+		// The context is established, with an empty last token.
+		if token := readSASLToken(t, server); len(token) != 0 {
+			t.Fatalf("Unexpected last token %q", token)
+		}
+		writeSASLToken(t, server, []byte{'w', 'r', 'a', 'p', ':', layers, 0, 1, 0})
+		if layers != gssapiNoSecurityLayer {
+			if err := <-done; err == nil {
+				t.Error("Expected an error when a security layer is required")
+			}
+			continue
+		}
+		if token := readSASLToken(t, server); !bytes.Equal(token, []byte("wrap:\x01\x00\x00\x00")) {
+			t.Errorf("Unexpected choice of security layer %q", token)
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("Authentication failed: %s", err)
+		}
+	}
+}
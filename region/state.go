@@ -0,0 +1,86 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"sort"
+	"time"
+)
+
+// State is a snapshot of the state of a Client, meant for diagnostics.
+type State struct {
+	// Address of the RegionServer.
+	Host string
+	Port uint16
+
+	// Service and effective user of the connection.
+	Service string
+	User    string
+
+	// Err is the error that shut down the client, nil if it's usable.
+	Err error
+
+	// QueueDepth is the number of RPCs queued but not written yet.
+	QueueDepth int
+
+	// InFlight lists the RPCs written and waiting for their response, by
+	// call ID.
+	InFlight []InFlightRPC
+}
+
+// InFlightRPC describes an RPC waiting for its response.
+type InFlightRPC struct {
+	CallID uint32
+
+	// Name of the RPC (e.g. "Get") and the row it targets.
+	Name  string
+	Table []byte
+	Key   []byte
+
+	// Age is how long ago the RPC was written.
+	Age time.Duration
+}
+
+// State returns a snapshot of the state of this client.
+func (c *Client) State() State {
+	st := State{
+		Host:    c.host,
+		Port:    c.port,
+		Service: c.service,
+		User:    c.effectiveUser,
+		Err:     c.Err(),
+	}
+	c.writeMutex.Lock()
+	st.QueueDepth = c.queueLen()
+	c.writeMutex.Unlock()
+	c.metaMutex.Lock()
+	st.QueueDepth += len(c.metaRPCs)
+	c.metaMutex.Unlock()
+
+	now := time.Now()
+	c.sentRPCsMutex.Lock()
+	for id, rpc := range c.sentRPCs {
+		inFlight := InFlightRPC{
+			CallID: id,
+			Name:   rpc.GetName(),
+			Table:  rpc.Table(),
+			Key:    rpc.Key(),
+		}
+		if sent, ok := c.sentTimes[id]; ok {
+			inFlight.Age = now.Sub(sent)
+		}
+		st.InFlight = append(st.InFlight, inFlight)
+	}
+	c.sentRPCsMutex.Unlock()
+	sort.Sort(byCallID(st.InFlight))
+	return st
+}
+
+type byCallID []InFlightRPC
+
+func (b byCallID) Len() int           { return len(b) }
+func (b byCallID) Less(i, j int) bool { return b[i].CallID < b[j].CallID }
+func (b byCallID) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
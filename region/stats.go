@@ -0,0 +1,61 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import "sync/atomic"
+
+// Stats are counters of the activity of a Client since it connected, meant
+// to tell which RegionServer connection is hot or stuck.
+type Stats struct {
+	// BytesSent and BytesReceived are the number of bytes written to and
+	// read from the connection, including its setup.
+	BytesSent     uint64
+	BytesReceived uint64
+
+	// RPCsSent is the number of RPCs written, and ResponsesReceived the
+	// number of responses read for them.
+	RPCsSent          uint64
+	ResponsesReceived uint64
+
+	// Flushes is the number of times RPCs buffered were written to the
+	// connection.
+	Flushes uint64
+
+	// Exceptions is the number of responses carrying an exception from
+	// the RegionServer, and Failures the number of RPCs failed without a
+	// response, because they couldn't be sent or the connection failed.
+	Exceptions uint64
+	Failures   uint64
+
+	// RPCsQueued is the number of RPCs queued but not written yet, and
+	// RPCsInFlight the number of those written and waiting for their
+	// response.
+	RPCsQueued   int
+	RPCsInFlight int
+}
+
+// Stats returns the counters of the activity of this client.
+func (c *Client) Stats() Stats {
+	st := Stats{
+		BytesSent:         atomic.LoadUint64(&c.stats.BytesSent),
+		BytesReceived:     atomic.LoadUint64(&c.stats.BytesReceived),
+		RPCsSent:          atomic.LoadUint64(&c.stats.RPCsSent),
+		ResponsesReceived: atomic.LoadUint64(&c.stats.ResponsesReceived),
+		Flushes:           atomic.LoadUint64(&c.stats.Flushes),
+		Exceptions:        atomic.LoadUint64(&c.stats.Exceptions),
+		Failures:          atomic.LoadUint64(&c.stats.Failures),
+	}
+	c.writeMutex.Lock()
+	st.RPCsQueued = c.queueLen()
+	c.writeMutex.Unlock()
+	c.metaMutex.Lock()
+	st.RPCsQueued += len(c.metaRPCs)
+	c.metaMutex.Unlock()
+	c.sentRPCsMutex.Lock()
+	st.RPCsInFlight = len(c.sentRPCs)
+	c.sentRPCsMutex.Unlock()
+	return st
+}
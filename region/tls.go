@@ -0,0 +1,67 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+)
+
+// TLS will return an option that will make the client connect over TLS, with
+// the configuration returned by the given function.  It's called every time
+// a connection is established, so that the configuration can change, e.g. to
+// rotate the certificate of the client for mutual TLS, without affecting the
+// connections already established.  The name of the server verified defaults
+// to the host of the RegionServer.
+func TLS(config func() (*tls.Config, error)) Option {
+	return func(c *Client) {
+		c.tlsConfig = config
+	}
+}
+
+// ClientCertificates will return an option that will make the client present
+// the certificates returned by the given function when connecting over TLS,
+// instead of those of the TLS configuration, unless it returns none.  It's
+// called every time a connection is established.
+func ClientCertificates(certificates func() ([]tls.Certificate, error)) Option {
+	return func(c *Client) {
+		c.certificates = certificates
+	}
+}
+
+// startTLS wraps the given connection with TLS and carries out the handshake.
+// The connection is closed if that fails.
+func (c *Client) startTLS(conn net.Conn) (net.Conn, error) {
+	config, err := c.tlsConfig()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to get the TLS configuration: %s", err)
+	}
+	if config.ServerName == "" && !config.InsecureSkipVerify {
+		config = config.Clone()
+		config.ServerName = c.host
+	}
+	if c.certificates != nil {
+		certs, err := c.certificates()
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to get the TLS certificates: %s", err)
+		}
+		if len(certs) != 0 {
+			config = config.Clone()
+			config.Certificates = certs
+			config.GetClientCertificate = nil
+		}
+	}
+	tlsConn := tls.Client(conn, config)
+	if err = tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with the RegionServer at %s failed: %s",
+			c.addr(), err)
+	}
+	return tlsConn, nil
+}
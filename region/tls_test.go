@@ -0,0 +1,131 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package region
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+// Returns a certificate made from the given template, signed by the given
+// parent or self-signed if nil.
+func newTestCertificate(t *testing.T, template *x509.Certificate,
+	parent *tls.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate a key: %s", err)
+	}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("Failed to create a certificate: %s", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse a certificate: %s", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestTLS(t *testing.T) {
+	ca := newTestCertificate(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil)
+	serverCert := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "regionserver"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, &ca)
+	clientCert := newTestCertificate(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "client"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, &ca)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Leaf)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	defer ln.Close()
+	port := uint16(ln.Addr().(*net.TCPAddr).Port)
+	peers := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tlsConn := conn.(*tls.Conn)
+		if err = tlsConn.Handshake(); err != nil {
+			peers <- err.Error()
+			return
+		}
+		peers <- tlsConn.ConnectionState().PeerCertificates[0].Subject.CommonName
+	}()
+
+	var configs int
+	config := func() (*tls.Config, error) {
+		configs++
+		return &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{clientCert}}, nil
+	}
+	c := &Client{host: "127.0.0.1", port: port}
+	TLS(config)(c)
+	conn, err := c.connect()
+	if err != nil {
+		t.Fatalf("Failed to dial: %s", err)
+	}
+	if conn, err = c.startTLS(conn); err != nil {
+		t.Fatalf("Failed to start TLS: %s", err)
+	}
+	defer conn.Close()
+	if peer := <-peers; peer != "client" {
+		t.Errorf("Expected the server to see the client certificate, got %q", peer)
+	}
+	if configs != 1 {
+		t.Errorf("Expected the configuration to be fetched once, got %d", configs)
+	}
+
+	// The certificate of the server is verified against its host name.
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	c = &Client{host: "regionserver", port: port}
+	TLS(config)(c)
+	if conn, err = net.Dial("tcp", ln.Addr().String()); err != nil {
+		t.Fatalf("Failed to dial: %s", err)
+	}
+	if conn, err = c.startTLS(conn); err == nil {
+		conn.Close()
+		t.Error("Expected the handshake to fail for a server with another name")
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tsuna/gohbase/regioninfo"
+	"golang.org/x/net/context"
+)
+
+// region -> address of the RegionServer it was served by when the region
+// cache was saved.
+type warmRegionCache struct {
+	m sync.Mutex
+
+	addrs map[*regioninfo.Info]string
+}
+
+func (wrc *warmRegionCache) get(r *regioninfo.Info) (string, bool) {
+	wrc.m.Lock()
+	addr, ok := wrc.addrs[r]
+	wrc.m.Unlock()
+	return addr, ok
+}
+
+func (wrc *warmRegionCache) put(r *regioninfo.Info, addr string) {
+	wrc.m.Lock()
+	wrc.addrs[r] = addr
+	wrc.m.Unlock()
+}
+
+func (wrc *warmRegionCache) del(r *regioninfo.Info) {
+	wrc.m.Lock()
+	delete(wrc.addrs, r)
+	wrc.m.Unlock()
+}
+
+// An entry of the region cache file.
+type cachedRegion struct {
+	Table      []byte
+	RegionName []byte
+	StartKey   []byte
+	StopKey    []byte
+	Server     string
+}
+
+// Writes the region cache to the region cache file.
+func (c *client) saveRegionCache() error {
+	var entries []cachedRegion
+	c.regions.m.Lock()
+	enum, err := c.regions.regions.SeekFirst()
+	for err == nil {
+		var v interface{}
+		_, v, err = enum.Next()
+		if err != nil {
+			break
+		}
+		reg := v.(*regioninfo.Info)
+		var server string
+		if client := c.clients.get(reg); client != nil {
+			server = net.JoinHostPort(client.Host(), strconv.Itoa(int(client.Port())))
+		} else if addr, ok := c.warmRegions.get(reg); ok {
+			server = addr
+		} else {
+			continue // We don't know where this region is.
+		}
+		entries = append(entries, cachedRegion{
+			Table:      reg.Table,
+			RegionName: reg.RegionName,
+			StartKey:   reg.StartKey,
+			StopKey:    reg.StopKey,
+			Server:     server,
+		})
+	}
+	c.regions.m.Unlock()
+
+	buf, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so as to never leave a truncated
+	// cache file behind.
+	tmp := c.regionCacheFile + ".tmp"
+	if err = ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.regionCacheFile)
+}
+
+// Loads the region cache file into the region cache.  A missing file isn't
+// an error.
+func (c *client) loadRegionCache() error {
+	buf, err := ioutil.ReadFile(c.regionCacheFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var entries []cachedRegion
+	if err = json.Unmarshal(buf, &entries); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		reg := &regioninfo.Info{
+			Table:      entry.Table,
+			RegionName: entry.RegionName,
+			StartKey:   entry.StartKey,
+			StopKey:    entry.StopKey,
+		}
+		c.warmRegions.put(reg, entry.Server)
+		c.regions.put(reg.RegionName, reg)
+	}
+	log.WithFields(log.Fields{
+		"File":    c.regionCacheFile,
+		"Regions": len(entries),
+	}).Debug("Loaded the region cache")
+	return nil
+}
+
+// errNotWarm is returned by connectWarmRegion for regions that weren't loaded
+// from the region cache file.
+var errNotWarm = errors.New("region not loaded from the region cache file")
+
+// Connects to the RegionServer that was serving the given region when the
+// region cache was saved.  If that fails, the region is looked up again.
+func (c *client) connectWarmRegion(ctx context.Context, reg *regioninfo.Info) (RegionClient, error) {
+	addr, ok := c.warmRegions.get(reg)
+	if !ok {
+		return nil, errNotWarm
+	}
+	host, portStr, err := net.SplitHostPort(addr)
+	var port uint64
+	if err == nil {
+		port, err = strconv.ParseUint(portStr, 10, 16)
+	}
+	if err == nil {
+		var client RegionClient
+		client, err = c.regionClient(ctx, host, uint16(port))
+		if err == ErrDeadline {
+			return nil, err
+		} else if err == nil {
+			c.warmRegions.del(reg)
+			c.clients.put(reg, client)
+			return client, nil
+		}
+	}
+	log.WithFields(log.Fields{
+		"Region": reg,
+		"Server": addr,
+		"Error":  err,
+	}).Debug("Failed to connect to the cached location of the region")
+	c.warmRegions.del(reg)
+	if reg.MarkUnavailable() {
+		go c.reestablishRegion(reg)
+	}
+	return nil, err
+}
@@ -0,0 +1,74 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/tsuna/gohbase/regioninfo"
+)
+
+func TestRegionCachePersistence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohbase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := path.Join(dir, "regions.json")
+
+	// Loading a nonexistent file leaves the cache empty.
+	client := newClient("~invalid.quorum~", RegionCacheFile(file))
+	if reg := client.getRegion([]byte("test"), []byte("theKey")); reg != nil {
+		t.Fatalf("Found region %#v even though the cache was empty?!", reg)
+	}
+
+	region1 := &regioninfo.Info{
+		Table:      []byte("test"),
+		RegionName: []byte("test,,1234567890042.56f833d5569a27c7a43fbf547b4924a4."),
+		StartKey:   []byte(""),
+		StopKey:    []byte("foo"),
+	}
+	region2 := &regioninfo.Info{
+		Table:      []byte("test"),
+		RegionName: []byte("test,foo,1234567890042.56f833d5569a27c7a43fbf547b4924a4."),
+		StartKey:   []byte("foo"),
+		StopKey:    []byte(""),
+	}
+	for i, reg := range []*regioninfo.Info{region1, region2} {
+		client.regions.put(reg.RegionName, reg)
+		client.warmRegions.put(reg, []string{"rs1:16020", "rs2:16020"}[i])
+	}
+	if err = client.Close(); err != nil {
+		t.Fatalf("Failed to save the region cache: %s", err)
+	}
+
+	client = newClient("~invalid.quorum~", RegionCacheFile(file))
+	testcases := []struct {
+		key    string
+		reg    *regioninfo.Info
+		server string
+	}{
+		{key: "bar", reg: region1, server: "rs1:16020"},
+		{key: "foo", reg: region2, server: "rs2:16020"},
+		{key: "theKey", reg: region2, server: "rs2:16020"},
+	}
+	for i, testcase := range testcases {
+		reg := client.getRegion([]byte("test"), []byte(testcase.key))
+		if reg == nil || !reflect.DeepEqual(reg.RegionName, testcase.reg.RegionName) ||
+			!reflect.DeepEqual(reg.StopKey, testcase.reg.StopKey) {
+			t.Errorf("[#%d] Found region %#v but expected %#v", i, reg, testcase.reg)
+			continue
+		}
+		if addr, _ := client.warmRegions.get(reg); addr != testcase.server {
+			t.Errorf("[#%d] Expected region to be on %s, but found %s",
+				i, testcase.server, addr)
+		}
+	}
+}
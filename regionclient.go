@@ -0,0 +1,76 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"time"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/region"
+	"golang.org/x/net/context"
+)
+
+// A RegionClient sends RPCs to a RegionServer or to the Master.  The client
+// routes RPCs to RegionClients, which are *region.Client unless another
+// implementation, such as a mock or an alternative transport, is created with
+// the RegionClientFactory option.
+type RegionClient interface {
+	// Host and Port are the address of the server.
+	Host() string
+	Port() uint16
+
+	// QueueRPC sends the given RPC, whose result is sent on its result
+	// channel, or returns an error if it can't be sent.  RPCs failing with
+	// a region.UnrecoverableError are retried on a new RegionClient.
+	QueueRPC(rpc hrpc.Call) error
+
+	// Err returns the error that shut down the RegionClient, nil if it's
+	// usable.
+	Err() error
+
+	// Close shuts down the RegionClient, failing the RPCs not answered
+	// by the time the given context is done.
+	Close(ctx context.Context) error
+
+	// State returns a snapshot of the state of the RegionClient, for
+	// diagnostics.
+	State() region.State
+
+	// SetQueueSize and SetFlushInterval tune how RPCs are batched, see
+	// SetRpcQueueSize and SetFlushInterval.
+	SetQueueSize(size int)
+	SetFlushInterval(interval time.Duration)
+}
+
+// A NewRegionClientFunc creates a RegionClient connected to the given server,
+// like region.NewClient.
+type NewRegionClientFunc func(host string, port uint16, queueSize int,
+	flushInterval time.Duration, options ...region.Option) (RegionClient, error)
+
+// RegionClientFactory will return an option that will set the function
+// creating the RegionClients of the RegionServers and of the Master, instead
+// of region.NewClient.  It's given the region options set by the other
+// options.
+func RegionClientFactory(newClient NewRegionClientFunc) Option {
+	return func(c *client) {
+		c.regionClientFactory = newClient
+	}
+}
+
+// Creates a RegionClient connected to the given server, with the factory set
+// by the RegionClientFactory option if any.
+func (c *client) newRegionClient(host string, port uint16, queueSize int,
+	flushInterval time.Duration, options ...region.Option) (RegionClient, error) {
+	if c.regionClientFactory != nil {
+		return c.regionClientFactory(host, port, queueSize, flushInterval, options...)
+	}
+	rc, err := region.NewClient(host, port, queueSize, flushInterval, options...)
+	if err != nil {
+		// Rather than a nil *region.Client in a non-nil RegionClient.
+		return nil, err
+	}
+	return rc, nil
+}
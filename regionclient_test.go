@@ -0,0 +1,114 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/region"
+	"github.com/tsuna/gohbase/regioninfo"
+	"golang.org/x/net/context"
+)
+
+// A RegionClient answering all the RPCs queued with the same response,
+// without any server, or failing to queue them with err if it's set.  Both
+// can be changed with m held.
+type mockRegionClient struct {
+	m        sync.Mutex
+	response proto.Message
+	err      error
+	queued   []hrpc.Call
+}
+
+func (c *mockRegionClient) Host() string { return "mock" }
+func (c *mockRegionClient) Port() uint16 { return 16020 }
+func (c *mockRegionClient) Err() error   { return nil }
+
+func (c *mockRegionClient) QueueRPC(rpc hrpc.Call) error {
+	c.m.Lock()
+	c.queued = append(c.queued, rpc)
+	response, err := c.response, c.err
+	c.m.Unlock()
+	if err != nil {
+		return err
+	}
+	rpc.GetResultChan() <- hrpc.RPCResult{Msg: response}
+	return nil
+}
+
+func (c *mockRegionClient) Close(context.Context) error { return nil }
+
+func (c *mockRegionClient) State() region.State {
+	return region.State{Host: c.Host(), Port: c.Port()}
+}
+
+func (c *mockRegionClient) SetQueueSize(int)               {}
+func (c *mockRegionClient) SetFlushInterval(time.Duration) {}
+
+func TestMockRegionClient(t *testing.T) {
+	client := newClient("~invalid.quorum~") // We shouldn't connect to ZK.
+	mock := &mockRegionClient{response: &pb.GetResponse{Result: &pb.Result{
+		Cell: []*pb.Cell{{Row: []byte("row"), Value: []byte("value")}},
+	}}}
+	client.addRegionToCache(&regioninfo.Info{
+		Table:      []byte("test"),
+		RegionName: []byte("test,,1234567890042.56f833d5569a27c7a43fbf547b4924a4."),
+		StopKey:    []byte(""),
+	}, mock)
+
+	ctx, cancel := newTestContext()
+	defer cancel()
+	get, _ := hrpc.NewGetStr(ctx, "test", "row")
+	resp, err := client.Get(get)
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	if len(resp.Result.Cell) != 1 || string(resp.Result.Cell[0].Value) != "value" {
+		t.Errorf("Unexpected response %v", resp)
+	}
+	if len(mock.queued) != 1 || mock.queued[0] != get {
+		t.Errorf("Expected the Get to be queued on the mock, got %v", mock.queued)
+	}
+}
+
+func TestRegionClientFactory(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	s.CreateTable("test", []string{"cf"})
+	var m sync.Mutex
+	var created []string
+	client := newFakeClient(t, s, RegionClientFactory(func(host string, port uint16,
+		queueSize int, flushInterval time.Duration,
+		options ...region.Option) (RegionClient, error) {
+		m.Lock()
+		created = append(created, host)
+		m.Unlock()
+		rc, err := region.NewClient(host, port, queueSize, flushInterval, options...)
+		if err != nil {
+			return nil, err
+		}
+		return rc, nil
+	}))
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	get, _ := hrpc.NewGetStr(ctx, "test", "row")
+	if _, err := client.Get(get); err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	m.Lock()
+	defer m.Unlock()
+	if len(created) != 1 || created[0] != s.Host() {
+		t.Errorf("Expected the RegionServer's client to be made by the factory, got %v",
+			created)
+	}
+}
@@ -29,6 +29,12 @@ type Info struct {
 	// StopKey.
 	StopKey []byte
 
+	// Whether the region is offline, and whether it was split.  The parent
+	// of a split stays in hbase:meta, offline, until its daughters are
+	// compacted.
+	Offline bool
+	Split   bool
+
 	// Once a region becomes unreachable, this channel is created, and any
 	// functions that wish to be notified when the region becomes available
 	// again can read from this channel, which will be closed when the region
@@ -62,6 +68,8 @@ func InfoFromCell(cell *pb.Cell) (*Info, error) {
 		RegionName:    cell.Row,
 		StartKey:      regInfo.StartKey,
 		StopKey:       regInfo.EndKey,
+		Offline:       regInfo.GetOffline(),
+		Split:         regInfo.GetSplit(),
 		availableLock: sync.Mutex{},
 	}, nil
 }
@@ -0,0 +1,142 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"net"
+	"strconv"
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// A RegionClientRegistry holds connections to RegionServers, keyed by
+// "host:port", so that they can be shared by several Clients talking to the
+// same cluster.  See the SharedRegionClients option.  There may be several
+// connections to each RegionServer, which are used in turn, see the
+// ConnectionsPerRegionServer option.
+type RegionClientRegistry struct {
+	m sync.Mutex
+
+	clients map[string][]*registryEntry
+	// Index of the next connection to use, by "host:port".
+	next map[string]int
+}
+
+// A connection to a RegionServer, possibly still being established.
+type registryEntry struct {
+	// Closed once client and err are set.
+	ready chan struct{}
+
+	client RegionClient
+	err    error
+}
+
+// NewRegionClientRegistry creates a new, empty registry.
+func NewRegionClientRegistry() *RegionClientRegistry {
+	return &RegionClientRegistry{
+		clients: make(map[string][]*registryEntry),
+		next:    make(map[string]int),
+	}
+}
+
+// Returns a client connected to the given RegionServer, using dial to create
+// it if there is no such client or if the existing one was shut down.  Up to
+// conns connections are made to each RegionServer, and returned in turn.
+func (r *RegionClientRegistry) get(ctx context.Context, host string, port uint16, conns int,
+	dial func(context.Context, string, uint16) (RegionClient, error)) (RegionClient, error) {
+	addr := net.JoinHostPort(host, strconv.Itoa(int(port)))
+	if conns < 1 {
+		conns = 1
+	}
+	r.m.Lock()
+	entries := r.clients[addr]
+	for len(entries) < conns {
+		entries = append(entries, nil)
+	}
+	r.clients[addr] = entries
+	i := r.next[addr] % conns
+	r.next[addr] = i + 1
+	entry := entries[i]
+	if entry != nil {
+		select {
+		case <-entry.ready:
+			if entry.err != nil || entry.client.Err() != nil {
+				entry = nil // Dead, make a new one.
+			}
+		default: // Someone else is connecting, we'll wait for them.
+		}
+	}
+	if entry == nil {
+		entry = &registryEntry{ready: make(chan struct{})}
+		entries[i] = entry
+		// Connect in the background, as the context of this request must
+		// not interfere with the other requests waiting on this entry.
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), regionLookupTimeout)
+			defer cancel()
+			entry.client, entry.err = dial(ctx, host, port)
+			close(entry.ready)
+		}()
+	}
+	r.m.Unlock()
+
+	select {
+	case <-entry.ready:
+		return entry.client, entry.err
+	case <-ctx.Done():
+		return nil, ErrDeadline
+	}
+}
+
+// Calls f with each of the established connections of this registry.
+func (r *RegionClientRegistry) each(f func(RegionClient)) {
+	r.m.Lock()
+	for _, entries := range r.clients {
+		for _, entry := range entries {
+			if entry == nil {
+				continue
+			}
+			select {
+			case <-entry.ready:
+				if entry.client != nil {
+					f(entry.client)
+				}
+			default:
+			}
+		}
+	}
+	r.m.Unlock()
+}
+
+// Close closes all the connections held by this registry, after waiting a
+// little for the responses to the RPCs in flight.
+func (r *RegionClientRegistry) Close() {
+	var clients []RegionClient
+	r.m.Lock()
+	for addr, entries := range r.clients {
+		for _, entry := range entries {
+			if entry == nil {
+				continue
+			}
+			select {
+			case <-entry.ready:
+				if entry.client != nil {
+					clients = append(clients, entry.client)
+				}
+			default:
+			}
+		}
+		delete(r.clients, addr)
+		delete(r.next, addr)
+	}
+	r.m.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	for _, client := range clients {
+		client.Close(ctx)
+	}
+}
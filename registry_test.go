@@ -0,0 +1,92 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tsuna/gohbase/region"
+	"golang.org/x/net/context"
+)
+
+func TestSharedRegionClients(t *testing.T) {
+	savedNewRegion := newRegion
+	defer func() { newRegion = savedNewRegion }()
+	var dials int32
+	newRegion = func(res chan newRegResult, host string, port uint16, queueSize int,
+		queueTimeout time.Duration, options ...region.Option) {
+		atomic.AddInt32(&dials, 1)
+		res <- newRegResult{&mockRegionClient{}, nil}
+	}
+
+	registry := NewRegionClientRegistry()
+	client1 := newClient("~invalid.quorum~", SharedRegionClients(registry))
+	client2 := newClient("~invalid.quorum~", SharedRegionClients(registry))
+	ctx := context.Background()
+
+	rc1, err := client1.regionClient(ctx, "rs1", 16020)
+	if err != nil {
+		t.Fatalf("Failed to get a region client: %s", err)
+	}
+	rc2, err := client2.regionClient(ctx, "rs1", 16020)
+	if err != nil {
+		t.Fatalf("Failed to get a region client: %s", err)
+	}
+	if rc1 != rc2 {
+		t.Error("Clients sharing a registry didn't share their connection")
+	}
+	rc3, err := client2.regionClient(ctx, "rs2", 16020)
+	if err != nil {
+		t.Fatalf("Failed to get a region client: %s", err)
+	}
+	if rc3 == rc1 {
+		t.Error("Got the same connection for two different RegionServers")
+	}
+	if n := atomic.LoadInt32(&dials); n != 2 {
+		t.Errorf("Expected 2 connections to be made, got %d", n)
+	}
+
+	// Without a registry, every client makes its own connections.
+	client3 := newClient("~invalid.quorum~")
+	if rc4, _ := client3.regionClient(ctx, "rs1", 16020); rc4 == rc1 {
+		t.Error("Client without a registry reused a shared connection")
+	}
+}
+
+func TestConnectionsPerRegionServer(t *testing.T) {
+	savedNewRegion := newRegion
+	defer func() { newRegion = savedNewRegion }()
+	var dials int32
+	newRegion = func(res chan newRegResult, host string, port uint16, queueSize int,
+		queueTimeout time.Duration, options ...region.Option) {
+		atomic.AddInt32(&dials, 1)
+		res <- newRegResult{&mockRegionClient{}, nil}
+	}
+
+	client := newClient("~invalid.quorum~", ConnectionsPerRegionServer(3))
+	ctx := context.Background()
+	var conns []RegionClient
+	for i := 0; i < 6; i++ {
+		rc, err := client.regionClient(ctx, "rs1", 16020)
+		if err != nil {
+			t.Fatalf("Failed to get a region client: %s", err)
+		}
+		conns = append(conns, rc)
+	}
+	if conns[0] == conns[1] || conns[1] == conns[2] || conns[0] == conns[2] {
+		t.Error("Expected 3 different connections to be used in turn")
+	}
+	for i := 3; i < 6; i++ {
+		if conns[i] != conns[i-3] {
+			t.Errorf("Expected connection #%d to be reused", i-3)
+		}
+	}
+	if n := atomic.LoadInt32(&dials); n != 3 {
+		t.Errorf("Expected 3 connections to be made, got %d", n)
+	}
+}
@@ -0,0 +1,508 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+// Package rest serves HBase tables over HTTP, with a subset of the REST API
+// of HBase's REST server (also known as Stargate), so that clients written in
+// other languages or running in browsers can reach HBase through a light
+// gateway backed by gohbase.
+//
+// The following requests are supported, with JSON bodies in which row keys,
+// columns and values are encoded in base64, as done by Stargate:
+//
+//	GET    /<table>/<row>[/<column>,...][?v=<versions>]  reads a row
+//	PUT    /<table>/<row>                                writes the cells of
+//	POST   /<table>/<row>                                a CellSet
+//	PUT    /<table>/<row>/<column>                       writes the raw body
+//	                                                     (application/octet-stream)
+//	DELETE /<table>/<row>[/<column>]                     deletes a row, family
+//	                                                     or column
+//	PUT    /<table>/scanner                              opens a scanner
+//	POST   /<table>/scanner
+//	GET    /<table>/scanner/<id>                         reads from a scanner
+//	DELETE /<table>/scanner/<id>                         closes a scanner
+//	GET    /version/rest                                 describes the server
+//
+// Columns are given as "family" or "family:qualifier".  Unlike with
+// Stargate, the filter of a scanner is described with a filter.Spec.  Neither
+// XML nor protobuf bodies, multi-row gets, schema and cluster administration
+// are supported, nor is the Thrift API.
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tsuna/gohbase"
+	"github.com/tsuna/gohbase/filter"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"golang.org/x/net/context"
+)
+
+// Version is the version of the REST API reported by /version/rest.
+const Version = "0.0.3"
+
+// Timeout of the RPCs made to serve a request.
+const requestTimeout = 30 * time.Second
+
+// How long a scanner can go unused before it's closed, as done by Stargate.
+var scannerTimeout = time.Minute
+
+// Number of cells returned per request by scanners whose batch size isn't
+// given.
+const defaultBatch = 100
+
+// A CellSet is the body of the requests and responses holding rows.
+type CellSet struct {
+	Rows []Row `json:"Row"`
+}
+
+// A Row is a row of a CellSet.
+type Row struct {
+	Key   []byte `json:"key"`
+	Cells []Cell `json:"Cell"`
+}
+
+// A Cell is a cell of a Row, whose column is "family:qualifier".
+type Cell struct {
+	Column    []byte `json:"column"`
+	Timestamp uint64 `json:"timestamp,omitempty"`
+	Value     []byte `json:"$"`
+}
+
+// A ScannerSpec is the body of the requests opening a scanner.
+type ScannerSpec struct {
+	StartRow []byte `json:"startRow,omitempty"`
+	EndRow   []byte `json:"endRow,omitempty"`
+	// Columns to return, as "family" or "family:qualifier".
+	Columns [][]byte `json:"column,omitempty"`
+	// Maximum number of cells returned per request.
+	Batch       int    `json:"batch,omitempty"`
+	MaxVersions uint32 `json:"maxVersions,omitempty"`
+	// JSON description of the filter, see filter.ParseJSON.
+	Filter string `json:"filter,omitempty"`
+}
+
+// Server is an http.Handler serving the tables of an HBase cluster.
+type Server struct {
+	client gohbase.Client
+
+	m        sync.Mutex
+	scanners map[string]*scanner
+	lastID   uint64
+}
+
+// An open scanner.
+type scanner struct {
+	scanner *gohbase.Scanner
+	cancel  context.CancelFunc
+	batch   int
+	// Closes the scanner once it's been unused for scannerTimeout.
+	timer *time.Timer
+
+	// Serializes the requests reading from the scanner.
+	m sync.Mutex
+	// Cells of the last row received that weren't returned yet.
+	pending []*pb.Cell
+}
+
+// NewServer returns a Server serving the tables of the cluster the given
+// client is connected to.
+func NewServer(client gohbase.Client) *Server {
+	return &Server{
+		client:   client,
+		scanners: make(map[string]*scanner),
+	}
+}
+
+// Close closes all the open scanners.
+func (s *Server) Close() error {
+	s.m.Lock()
+	scanners := s.scanners
+	s.scanners = make(map[string]*scanner)
+	s.m.Unlock()
+	for _, sc := range scanners {
+		sc.close()
+	}
+	return nil
+}
+
+// An error to report to the client with the given HTTP status.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e httpError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return httpError{http.StatusBadRequest, fmt.Errorf(format, args...)}
+}
+
+var errNotFound = httpError{http.StatusNotFound, errors.New("not found")}
+
+// ServeHTTP serves a request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := s.serve(w, r)
+	if err == nil {
+		return
+	}
+	status := http.StatusInternalServerError
+	if e, ok := err.(httpError); ok {
+		status = e.status
+	} else if err == gohbase.ErrTableNotFound {
+		status = http.StatusNotFound
+	} else if err == gohbase.ErrDeadline {
+		status = http.StatusServiceUnavailable
+	} else {
+		log.WithFields(log.Fields{
+			"Method": r.Method,
+			"URL":    r.URL.String(),
+			"Error":  err,
+		}).Warn("Failed to serve a REST request")
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) error {
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(path) < 2 || path[0] == "" {
+		return errNotFound
+	}
+	if path[0] == "version" && path[1] == "rest" && len(path) == 2 {
+		if r.Method != "GET" {
+			return httpError{http.StatusMethodNotAllowed, errors.New("method not allowed")}
+		}
+		return writeJSON(w, http.StatusOK, map[string]string{
+			"REST":   Version,
+			"Server": "gohbase",
+		})
+	}
+	table := path[0]
+	if path[1] == "scanner" {
+		switch {
+		case len(path) == 2 && (r.Method == "PUT" || r.Method == "POST"):
+			return s.openScanner(w, r, table)
+		case len(path) == 3 && r.Method == "GET":
+			return s.readScanner(w, path[2])
+		case len(path) == 3 && r.Method == "DELETE":
+			return s.closeScanner(path[2])
+		}
+		return errNotFound
+	}
+	if len(path) > 3 {
+		return errNotFound
+	}
+	row := path[1]
+	var columns []string
+	if len(path) == 3 && path[2] != "" {
+		columns = strings.Split(path[2], ",")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	switch r.Method {
+	case "GET":
+		return s.get(ctx, w, r, table, row, columns)
+	case "PUT", "POST":
+		return s.put(ctx, r, table, row, columns)
+	case "DELETE":
+		return s.delete(ctx, table, row, columns)
+	}
+	return httpError{http.StatusMethodNotAllowed, errors.New("method not allowed")}
+}
+
+// Splits a "family:qualifier" column, the qualifier being empty if there's no
+// colon.
+func splitColumn(column string) (string, string, bool) {
+	if i := strings.IndexByte(column, ':'); i >= 0 {
+		return column[:i], column[i+1:], true
+	}
+	return column, "", false
+}
+
+// Returns the families to get for the given columns, or nil for all of them.
+func familiesFor(columns []string) map[string][]string {
+	if len(columns) == 0 {
+		return nil
+	}
+	families := make(map[string][]string)
+	for _, column := range columns {
+		family, qualifier, ok := splitColumn(column)
+		if !ok {
+			// The whole family, even if some of its columns were
+			// given too.
+			families[family] = nil
+		} else if qualifiers, ok := families[family]; !ok || qualifiers != nil {
+			families[family] = append(qualifiers, qualifier)
+		}
+	}
+	return families
+}
+
+func (s *Server) get(ctx context.Context, w http.ResponseWriter, r *http.Request,
+	table, row string, columns []string) error {
+	options := []func(hrpc.Call) error{}
+	if families := familiesFor(columns); families != nil {
+		options = append(options, hrpc.Families(families))
+	}
+	if v := r.URL.Query().Get("v"); v != "" {
+		versions, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || versions == 0 {
+			return badRequest("invalid number of versions %q", v)
+		}
+		options = append(options, hrpc.MaxVersions(uint32(versions)))
+	}
+	get, err := hrpc.NewGetStr(ctx, table, row, options...)
+	if err != nil {
+		return badRequest("%s", err)
+	}
+	resp, err := s.client.Get(get)
+	if err != nil {
+		return err
+	}
+	if resp.Result == nil || len(resp.Result.Cell) == 0 {
+		return errNotFound
+	}
+	return writeJSON(w, http.StatusOK, &CellSet{Rows: toRows(resp.Result.Cell)})
+}
+
+// Groups the given cells, sorted by row, into rows.
+func toRows(cells []*pb.Cell) []Row {
+	var rows []Row
+	for _, cell := range cells {
+		if len(rows) == 0 || !bytes.Equal(rows[len(rows)-1].Key, cell.Row) {
+			rows = append(rows, Row{Key: cell.Row})
+		}
+		last := &rows[len(rows)-1]
+		column := make([]byte, 0, len(cell.Family)+1+len(cell.Qualifier))
+		column = append(append(append(column, cell.Family...), ':'), cell.Qualifier...)
+		last.Cells = append(last.Cells, Cell{
+			Column:    column,
+			Timestamp: cell.GetTimestamp(),
+			Value:     cell.Value,
+		})
+	}
+	return rows
+}
+
+func (s *Server) put(ctx context.Context, r *http.Request, table, row string,
+	columns []string) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if r.Header.Get("Content-Type") == "application/octet-stream" {
+		if len(columns) != 1 {
+			return badRequest("a single column must be given to write a raw value")
+		}
+		family, qualifier, _ := splitColumn(columns[0])
+		return s.putCells(ctx, table, row, map[string]map[string][]byte{
+			family: {qualifier: body},
+		}, 0)
+	}
+	var cellSet CellSet
+	if err = json.Unmarshal(body, &cellSet); err != nil {
+		return badRequest("invalid CellSet: %s", err)
+	}
+	// The cells of each timestamp are written together, as they are in a
+	// mutation.
+	for _, cellRow := range cellSet.Rows {
+		key := string(cellRow.Key)
+		if len(cellRow.Key) == 0 {
+			key = row
+		}
+		values := make(map[uint64]map[string]map[string][]byte)
+		for _, cell := range cellRow.Cells {
+			family, qualifier, _ := splitColumn(string(cell.Column))
+			if family == "" {
+				return badRequest("cell without a family in row %q", key)
+			}
+			if values[cell.Timestamp] == nil {
+				values[cell.Timestamp] = make(map[string]map[string][]byte)
+			}
+			if values[cell.Timestamp][family] == nil {
+				values[cell.Timestamp][family] = make(map[string][]byte)
+			}
+			values[cell.Timestamp][family][qualifier] = cell.Value
+		}
+		for ts, v := range values {
+			if err = s.putCells(ctx, table, key, v, ts); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Writes the given cells, at the given timestamp unless it's 0.
+func (s *Server) putCells(ctx context.Context, table, row string,
+	values map[string]map[string][]byte, ts uint64) error {
+	put, err := hrpc.NewPutStr(ctx, table, row, values)
+	if err != nil {
+		return badRequest("%s", err)
+	}
+	if ts != 0 {
+		put.SetTimestamp(ts)
+	}
+	_, err = s.client.Put(put)
+	return err
+}
+
+func (s *Server) delete(ctx context.Context, table, row string, columns []string) error {
+	var values map[string]map[string][]byte
+	if len(columns) != 0 {
+		values = make(map[string]map[string][]byte)
+		for _, column := range columns {
+			family, qualifier, ok := splitColumn(column)
+			if values[family] == nil {
+				values[family] = make(map[string][]byte)
+			}
+			if ok {
+				values[family][qualifier] = nil
+			}
+		}
+	}
+	del, err := hrpc.NewDelStr(ctx, table, row, values)
+	if err != nil {
+		return badRequest("%s", err)
+	}
+	_, err = s.client.Delete(del)
+	return err
+}
+
+func (s *Server) openScanner(w http.ResponseWriter, r *http.Request, table string) error {
+	var spec ScannerSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		return badRequest("invalid scanner: %s", err)
+	}
+	var options []func(hrpc.Call) error
+	var columns []string
+	for _, column := range spec.Columns {
+		columns = append(columns, string(column))
+	}
+	if families := familiesFor(columns); families != nil {
+		options = append(options, hrpc.Families(families))
+	}
+	if spec.MaxVersions > 0 {
+		options = append(options, hrpc.MaxVersions(spec.MaxVersions))
+	}
+	if spec.Filter != "" {
+		f, err := filter.ParseJSON([]byte(spec.Filter))
+		if err != nil {
+			return badRequest("invalid filter: %s", err)
+		}
+		options = append(options, hrpc.Filters(f))
+	}
+	batch := spec.Batch
+	if batch <= 0 {
+		batch = defaultBatch
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	scan, err := hrpc.NewScanRange(ctx, []byte(table), spec.StartRow, spec.EndRow, options...)
+	if err != nil {
+		cancel()
+		return badRequest("%s", err)
+	}
+	sc := &scanner{
+		scanner: s.client.Scanner(scan, 1),
+		cancel:  cancel,
+		batch:   batch,
+	}
+	s.m.Lock()
+	s.lastID++
+	id := strconv.FormatUint(s.lastID, 10)
+	sc.timer = time.AfterFunc(scannerTimeout, func() { s.closeScanner(id) })
+	s.scanners[id] = sc
+	s.m.Unlock()
+
+	w.Header().Set("Location", "/"+table+"/scanner/"+id)
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+func (s *Server) readScanner(w http.ResponseWriter, id string) error {
+	s.m.Lock()
+	sc, ok := s.scanners[id]
+	s.m.Unlock()
+	if !ok {
+		return errNotFound
+	}
+	sc.timer.Reset(scannerTimeout)
+	sc.m.Lock()
+	cells, err := sc.next()
+	sc.m.Unlock()
+	if err != nil {
+		s.closeScanner(id)
+		return err
+	}
+	if len(cells) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return writeJSON(w, http.StatusOK, &CellSet{Rows: toRows(cells)})
+}
+
+// Returns the next batch of cells, none once the scan is over.  Rows larger
+// than the batch are split across batches.
+func (sc *scanner) next() ([]*pb.Cell, error) {
+	var cells []*pb.Cell
+	for len(cells) < sc.batch {
+		if len(sc.pending) == 0 {
+			result, ok := <-sc.scanner.Rows()
+			if !ok {
+				return cells, sc.scanner.Err()
+			}
+			sc.pending = result.Cell
+			continue
+		}
+		n := sc.batch - len(cells)
+		if n > len(sc.pending) {
+			n = len(sc.pending)
+		}
+		cells = append(cells, sc.pending[:n]...)
+		sc.pending = sc.pending[n:]
+	}
+	return cells, nil
+}
+
+func (s *Server) closeScanner(id string) error {
+	s.m.Lock()
+	sc, ok := s.scanners[id]
+	delete(s.scanners, id)
+	s.m.Unlock()
+	if !ok {
+		return errNotFound
+	}
+	sc.close()
+	return nil
+}
+
+func (sc *scanner) close() {
+	sc.timer.Stop()
+	sc.cancel()
+	sc.scanner.Close()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(buf)
+	return err
+}
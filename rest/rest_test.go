@@ -0,0 +1,211 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/regioninfo"
+)
+
+// A client keeping the cells of a single table in memory.  Only Get, Put and
+// Delete are implemented.
+type memClient struct {
+	gohbase.Client
+
+	// row -> "family:qualifier" -> value
+	rows map[string]map[string][]byte
+}
+
+// Returns the mutation sent by the given RPC.
+func mutation(m *hrpc.Mutate) *pb.MutationProto {
+	m.SetRegion(&regioninfo.Info{RegionName: []byte("test,,1")})
+	buf, _ := m.Serialize()
+	req := &pb.MutateRequest{}
+	proto.Unmarshal(buf, req)
+	return req.Mutation
+}
+
+func (c *memClient) Put(m *hrpc.Mutate) (*pb.MutateResponse, error) {
+	if string(m.Table()) != "test" {
+		return nil, gohbase.ErrTableNotFound
+	}
+	row := c.rows[string(m.Key())]
+	if row == nil {
+		row = make(map[string][]byte)
+		c.rows[string(m.Key())] = row
+	}
+	for _, cv := range mutation(m).ColumnValue {
+		for _, qv := range cv.QualifierValue {
+			row[string(cv.Family)+":"+string(qv.Qualifier)] = qv.Value
+		}
+	}
+	return &pb.MutateResponse{}, nil
+}
+
+func (c *memClient) Delete(m *hrpc.Mutate) (*pb.MutateResponse, error) {
+	columns := mutation(m).ColumnValue
+	if len(columns) == 0 {
+		delete(c.rows, string(m.Key()))
+	}
+	row := c.rows[string(m.Key())]
+	for _, cv := range columns {
+		for column := range row {
+			if len(cv.QualifierValue) == 0 &&
+				strings.HasPrefix(column, string(cv.Family)+":") {
+				delete(row, column)
+			}
+		}
+		for _, qv := range cv.QualifierValue {
+			delete(row, string(cv.Family)+":"+string(qv.Qualifier))
+		}
+	}
+	return &pb.MutateResponse{}, nil
+}
+
+func (c *memClient) Get(get *hrpc.Get) (*pb.GetResponse, error) {
+	if string(get.Table()) != "test" {
+		return nil, gohbase.ErrTableNotFound
+	}
+	row := c.rows[string(get.Key())]
+	var columns []string
+	for column := range row {
+		family, qualifier, _ := splitColumn(column)
+		if families := get.GetFamilies(); families != nil {
+			qualifiers, ok := families[family]
+			if !ok {
+				continue
+			}
+			found := qualifiers == nil
+			for _, q := range qualifiers {
+				found = found || q == qualifier
+			}
+			if !found {
+				continue
+			}
+		}
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	result := &pb.Result{}
+	for _, column := range columns {
+		family, qualifier, _ := splitColumn(column)
+		result.Cell = append(result.Cell, &pb.Cell{
+			Row:       get.Key(),
+			Family:    []byte(family),
+			Qualifier: []byte(qualifier),
+			Value:     row[column],
+		})
+	}
+	return &pb.GetResponse{Result: result}, nil
+}
+
+func TestServer(t *testing.T) {
+	client := &memClient{rows: make(map[string]map[string][]byte)}
+	server := httptest.NewServer(NewServer(client))
+	defer server.Close()
+
+	do := func(method, path, contentType string, body []byte) (int, []byte) {
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %s", method, path, err)
+		}
+		defer resp.Body.Close()
+		var buf bytes.Buffer
+		buf.ReadFrom(resp.Body)
+		return resp.StatusCode, buf.Bytes()
+	}
+	getRow := func(path string) []Cell {
+		status, body := do("GET", path, "", nil)
+		if status == http.StatusNotFound {
+			return nil
+		} else if status != http.StatusOK {
+			t.Fatalf("GET %s failed with status %d: %s", path, status, body)
+		}
+		var cellSet CellSet
+		if err := json.Unmarshal(body, &cellSet); err != nil {
+			t.Fatalf("Invalid CellSet %s: %s", body, err)
+		}
+		if len(cellSet.Rows) != 1 {
+			t.Fatalf("Expected 1 row, got %d", len(cellSet.Rows))
+		}
+		return cellSet.Rows[0].Cells
+	}
+
+	cellSet, _ := json.Marshal(&CellSet{Rows: []Row{{
+		Key: []byte("row1"),
+		Cells: []Cell{
+			{Column: []byte("a:x"), Value: []byte("1")},
+			{Column: []byte("a:y"), Value: []byte("2")},
+			{Column: []byte("b:z"), Value: []byte("3")},
+		},
+	}}})
+	if status, body := do("PUT", "/test/row1", "application/json", cellSet); status != http.StatusOK {
+		t.Fatalf("PUT failed with status %d: %s", status, body)
+	}
+	if status, body := do("PUT", "/test/row1/b:raw", "application/octet-stream",
+		[]byte("raw value")); status != http.StatusOK {
+		t.Fatalf("PUT failed with status %d: %s", status, body)
+	}
+
+	expected := []Cell{
+		{Column: []byte("a:x"), Value: []byte("1")},
+		{Column: []byte("a:y"), Value: []byte("2")},
+		{Column: []byte("b:raw"), Value: []byte("raw value")},
+		{Column: []byte("b:z"), Value: []byte("3")},
+	}
+	if cells := getRow("/test/row1"); !reflect.DeepEqual(cells, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, cells)
+	}
+	if cells := getRow("/test/row1/a:y,b"); !reflect.DeepEqual(cells, expected[1:]) {
+		t.Errorf("Expected %+v, got %+v", expected[1:], cells)
+	}
+
+	if status, _ := do("DELETE", "/test/row1/b", "", nil); status != http.StatusOK {
+		t.Errorf("DELETE failed with status %d", status)
+	}
+	if cells := getRow("/test/row1"); !reflect.DeepEqual(cells, expected[:2]) {
+		t.Errorf("Expected %+v, got %+v", expected[:2], cells)
+	}
+	if status, _ := do("DELETE", "/test/row1", "", nil); status != http.StatusOK {
+		t.Errorf("DELETE failed with status %d", status)
+	}
+	if cells := getRow("/test/row1"); cells != nil {
+		t.Errorf("Expected the row to be deleted, got %+v", cells)
+	}
+
+	for _, testcase := range []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/nonexistent/row1", http.StatusNotFound},
+		{"GET", "/test/row1?v=0", http.StatusBadRequest},
+		{"PUT", "/test/row1", http.StatusBadRequest},
+		{"PATCH", "/test/row1", http.StatusMethodNotAllowed},
+		{"GET", "/test/scanner/42", http.StatusNotFound},
+		{"GET", "/version/rest", http.StatusOK},
+	} {
+		if status, _ := do(testcase.method, testcase.path, "", nil); status != testcase.status {
+			t.Errorf("%s %s: expected status %d, got %d",
+				testcase.method, testcase.path, testcase.status, status)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"sync"
+
+	"github.com/tsuna/gohbase/filter"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/regioninfo"
+	"golang.org/x/net/context"
+)
+
+// RegionCount is the number of rows CountRows found in a region.
+type RegionCount struct {
+	// Name of the region.
+	Region []byte
+	// Number of rows in the region.
+	Rows int
+	// Error encountered while scanning the region, if any.
+	Err error
+}
+
+// CountRows counts the rows of the given table.  Up to parallelism regions
+// are scanned at the same time, with a FirstKeyOnlyFilter so that only the
+// first cell of each row is returned.  If progress isn't nil, it's called
+// once each region has been counted, from a single goroutine.
+func CountRows(ctx context.Context, c Client, table string, parallelism int,
+	progress func(RegionCount)) (int, error) {
+	rows, err := scanTableMeta(ctx, c, table)
+	if err != nil {
+		return 0, err
+	}
+	regions := make([]*regioninfo.Info, len(rows))
+	for i, row := range rows {
+		if regions[i], _, _, err = parseMetaRow(row); err != nil {
+			return 0, err
+		}
+	}
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	counts := make(chan RegionCount)
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for _, reg := range regions {
+		wg.Add(1)
+		go func(name, start, stop []byte) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			count := RegionCount{Region: name}
+			var scan *hrpc.Scan
+			scan, count.Err = hrpc.NewScanRange(ctx, []byte(table), start, stop,
+				hrpc.Filters(filter.NewFirstKeyOnlyFilter()))
+			if count.Err == nil {
+				// The scan begins in the region of its start row, and the rows
+				// are counted as they come rather than buffered.
+				scanner := c.Scanner(scan, 0)
+				for range scanner.Rows() {
+					count.Rows++
+				}
+				count.Err = scanner.Err()
+			}
+			counts <- count
+		}(reg.RegionName, reg.StartKey, reg.StopKey)
+	}
+	go func() {
+		wg.Wait()
+		close(counts)
+	}()
+
+	total := 0
+	for count := range counts {
+		if count.Err != nil && err == nil {
+			err = count.Err
+		}
+		total += count.Rows
+		if progress != nil {
+			progress(count)
+		}
+	}
+	return total, err
+}
@@ -0,0 +1,73 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tsuna/gohbase/hrpc"
+)
+
+func TestCountRows(t *testing.T) {
+	s, c, ctx, done := newFakeEnv(t, "test", "test2")
+	defer done()
+
+	for i := 0; i < 42; i++ {
+		put, _ := hrpc.NewPutStr(ctx, "test", fmt.Sprintf("row%02d", i),
+			map[string]map[string][]byte{"cf": {"a": []byte("1"), "b": []byte("2")}})
+		if _, err := c.Put(put); err != nil {
+			t.Fatalf("Put failed: %s", err)
+		}
+	}
+	put, _ := hrpc.NewPutStr(ctx, "test2", "row",
+		map[string]map[string][]byte{"cf": {"a": []byte("1")}})
+	if _, err := c.Put(put); err != nil {
+		t.Fatalf("Put failed: %s", err)
+	}
+
+	var progress []RegionCount
+	n, err := CountRows(ctx, c, "test", 4, func(count RegionCount) {
+		progress = append(progress, count)
+	})
+	if err != nil {
+		t.Fatalf("CountRows failed: %s", err)
+	}
+	if n != 42 {
+		t.Errorf("Expected 42 rows, got %d", n)
+	}
+	if len(progress) != 1 || progress[0].Rows != 42 {
+		t.Errorf("Unexpected progress %v", progress)
+	}
+
+	// Every region is counted on its own.
+	s.SplitTable("test", "row10", "row30")
+	progress = nil
+	n, err = CountRows(ctx, c, "test", 2, func(count RegionCount) {
+		progress = append(progress, count)
+	})
+	if err != nil {
+		t.Fatalf("CountRows failed: %s", err)
+	}
+	if n != 42 {
+		t.Errorf("Expected 42 rows, got %d", n)
+	}
+	expected := map[string]int{"": 10, "row10": 20, "row30": 12} // By start key.
+	if len(progress) != len(expected) {
+		t.Fatalf("Unexpected progress %v", progress)
+	}
+	for _, count := range progress {
+		start := strings.Split(string(count.Region), ",")[1]
+		if rows, ok := expected[start]; !ok || rows != count.Rows {
+			t.Errorf("Unexpected count %v", count)
+		}
+	}
+
+	if _, err = CountRows(ctx, c, "nonexistent", 4, nil); err != ErrTableNotFound {
+		t.Errorf("Expected ErrTableNotFound, got %v", err)
+	}
+}
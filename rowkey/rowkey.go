@@ -0,0 +1,212 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+// Package rowkey encodes values into row keys that sort, byte by byte as
+// HBase does, in the same order as the values themselves.
+//
+// Composite keys are built by appending their components one after the
+// other, each in ascending or descending order, and decoded in the same
+// order:
+//
+//	key := rowkey.AppendString(nil, "sensor42", rowkey.Ascending)
+//	key = rowkey.AppendTime(key, ts, rowkey.Descending)
+//
+// makes the most recent rows of each sensor come first in scans.  Strings and
+// byte slices are escaped and terminated, so that no encoded value is a
+// prefix of another one and the following components don't affect the order.
+// Numbers are encoded in big-endian with their sign bit flipped, so that
+// negative values sort before positive ones.
+package rowkey
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+// Order is the order in which encoded values sort.
+type Order int
+
+const (
+	// Ascending makes smaller values sort first.
+	Ascending Order = iota
+	// Descending makes greater values sort first.
+	Descending
+)
+
+// ErrTruncated is returned when decoding a key that ends in the middle of a
+// value.
+var ErrTruncated = errors.New("truncated row key")
+
+// ErrInvalidEscape is returned when decoding a string or byte slice whose
+// escaping is broken, which usually means the key was encoded differently.
+var ErrInvalidEscape = errors.New("invalid escape sequence in row key")
+
+// Bytes escaping a zero byte in strings, and terminating them.
+const (
+	escape     = 0x00
+	escapedNul = 0xFF
+	terminator = 0x01
+)
+
+// Returns the mask XORed with the bytes of values encoded in the given order:
+// inverting them reverses the order.
+func (o Order) mask() byte {
+	if o == Descending {
+		return 0xFF
+	}
+	return 0
+}
+
+// Inverts the bytes of buf if the order is descending.
+func (o Order) apply(buf []byte) {
+	if o == Descending {
+		for i := range buf {
+			buf[i] = ^buf[i]
+		}
+	}
+}
+
+// AppendUint64 appends the encoding of v, which takes 8 bytes.
+func AppendUint64(buf []byte, v uint64, o Order) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	o.apply(b[:])
+	return append(buf, b[:]...)
+}
+
+// DecodeUint64 decodes a value encoded with AppendUint64, and returns it
+// along with the rest of the key.
+func DecodeUint64(buf []byte, o Order) (uint64, []byte, error) {
+	if len(buf) < 8 {
+		return 0, buf, ErrTruncated
+	}
+	v := binary.BigEndian.Uint64(buf)
+	if o == Descending {
+		v = ^v
+	}
+	return v, buf[8:], nil
+}
+
+// AppendInt64 appends the encoding of v, which takes 8 bytes.
+func AppendInt64(buf []byte, v int64, o Order) []byte {
+	return AppendUint64(buf, uint64(v)^(1<<63), o)
+}
+
+// DecodeInt64 decodes a value encoded with AppendInt64, and returns it along
+// with the rest of the key.
+func DecodeInt64(buf []byte, o Order) (int64, []byte, error) {
+	v, rest, err := DecodeUint64(buf, o)
+	if err != nil {
+		return 0, rest, err
+	}
+	return int64(v ^ (1 << 63)), rest, nil
+}
+
+// AppendFloat64 appends the encoding of v, which takes 8 bytes.  Negative
+// zero sorts right before zero, and NaNs after positive infinity.
+func AppendFloat64(buf []byte, v float64, o Order) []byte {
+	bits := math.Float64bits(v)
+	if bits>>63 == 1 {
+		// Negative numbers are stored as their absolute value, which must
+		// be inverted for greater ones to sort first.
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	return AppendUint64(buf, bits, o)
+}
+
+// DecodeFloat64 decodes a value encoded with AppendFloat64, and returns it
+// along with the rest of the key.
+func DecodeFloat64(buf []byte, o Order) (float64, []byte, error) {
+	bits, rest, err := DecodeUint64(buf, o)
+	if err != nil {
+		return 0, rest, err
+	}
+	if bits>>63 == 1 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits), rest, nil
+}
+
+// AppendTime appends the encoding of t, with a precision of a nanosecond,
+// which takes 8 bytes.  Only times between the years 1678 and 2262 can be
+// encoded.
+func AppendTime(buf []byte, t time.Time, o Order) []byte {
+	return AppendInt64(buf, t.UnixNano(), o)
+}
+
+// DecodeTime decodes a time encoded with AppendTime, in UTC, and returns it
+// along with the rest of the key.
+func DecodeTime(buf []byte, o Order) (time.Time, []byte, error) {
+	nanos, rest, err := DecodeInt64(buf, o)
+	if err != nil {
+		return time.Time{}, rest, err
+	}
+	return time.Unix(0, nanos).UTC(), rest, nil
+}
+
+// AppendBytes appends the encoding of v, in which zero bytes are escaped and
+// which is terminated, so that it takes len(v) + 2 bytes when v doesn't
+// contain any zero byte.
+func AppendBytes(buf []byte, v []byte, o Order) []byte {
+	start := len(buf)
+	for _, b := range v {
+		if b == escape {
+			buf = append(buf, escape, escapedNul)
+		} else {
+			buf = append(buf, b)
+		}
+	}
+	buf = append(buf, escape, terminator)
+	o.apply(buf[start:])
+	return buf
+}
+
+// DecodeBytes decodes a value encoded with AppendBytes, and returns it along
+// with the rest of the key.
+func DecodeBytes(buf []byte, o Order) ([]byte, []byte, error) {
+	mask := o.mask()
+	var v []byte
+	for i := 0; i < len(buf); i++ {
+		b := buf[i] ^ mask
+		if b != escape {
+			v = append(v, b)
+			continue
+		}
+		if i+1 == len(buf) {
+			break
+		}
+		switch buf[i+1] ^ mask {
+		case escapedNul:
+			v = append(v, 0)
+			i++
+		case terminator:
+			if v == nil {
+				v = []byte{}
+			}
+			return v, buf[i+2:], nil
+		default:
+			return nil, buf, ErrInvalidEscape
+		}
+	}
+	return nil, buf, ErrTruncated
+}
+
+// AppendString appends the encoding of s, like AppendBytes.
+func AppendString(buf []byte, s string, o Order) []byte {
+	return AppendBytes(buf, []byte(s), o)
+}
+
+// DecodeString decodes a value encoded with AppendString, and returns it
+// along with the rest of the key.
+func DecodeString(buf []byte, o Order) (string, []byte, error) {
+	v, rest, err := DecodeBytes(buf, o)
+	return string(v), rest, err
+}
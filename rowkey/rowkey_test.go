@@ -0,0 +1,156 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package rowkey
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+)
+
+// Checks that the given keys, encoding values in ascending order, sort in
+// that order.
+func checkSorted(t *testing.T, name string, keys [][]byte) {
+	for i := 1; i < len(keys); i++ {
+		if bytes.Compare(keys[i-1], keys[i]) >= 0 {
+			t.Errorf("%s: key #%d %q doesn't sort before key #%d %q",
+				name, i-1, keys[i-1], i, keys[i])
+		}
+	}
+}
+
+// Returns the given keys in reverse order.
+func reverse(keys [][]byte) [][]byte {
+	reversed := make([][]byte, len(keys))
+	for i, key := range keys {
+		reversed[len(keys)-1-i] = key
+	}
+	return reversed
+}
+
+func TestInt64(t *testing.T) {
+	values := []int64{math.MinInt64, -1 << 40, -256, -1, 0, 1, 255, 1 << 40, math.MaxInt64}
+	for _, o := range []Order{Ascending, Descending} {
+		var keys [][]byte
+		for _, v := range values {
+			key := AppendInt64([]byte("p"), v, o)
+			got, rest, err := DecodeInt64(key[1:], o)
+			if err != nil || got != v || len(rest) != 0 {
+				t.Errorf("DecodeInt64 returned %d, %q, %v; expected %d", got, rest, err, v)
+			}
+			keys = append(keys, key)
+		}
+		if o == Descending {
+			keys = reverse(keys)
+		}
+		checkSorted(t, "int64", keys)
+	}
+	if _, _, err := DecodeInt64([]byte{1, 2, 3}, Ascending); err != ErrTruncated {
+		t.Errorf("Expected ErrTruncated, got %v", err)
+	}
+}
+
+func TestFloat64(t *testing.T) {
+	values := []float64{math.Inf(-1), -math.MaxFloat64, -1.5, -math.SmallestNonzeroFloat64,
+		math.Copysign(0, -1), 0, math.SmallestNonzeroFloat64, 1.5, math.MaxFloat64,
+		math.Inf(1), math.NaN()}
+	for _, o := range []Order{Ascending, Descending} {
+		var keys [][]byte
+		for _, v := range values {
+			key := AppendFloat64(nil, v, o)
+			got, rest, err := DecodeFloat64(key, o)
+			if err != nil || len(rest) != 0 ||
+				math.Float64bits(got) != math.Float64bits(v) {
+				t.Errorf("DecodeFloat64 returned %g, %q, %v; expected %g", got, rest, err, v)
+			}
+			keys = append(keys, key)
+		}
+		if o == Descending {
+			keys = reverse(keys)
+		}
+		checkSorted(t, "float64", keys)
+	}
+}
+
+func TestTime(t *testing.T) {
+	now := time.Now()
+	values := []time.Time{time.Unix(-1, 0), time.Unix(0, 0), now, now.Add(time.Nanosecond)}
+	for _, o := range []Order{Ascending, Descending} {
+		var keys [][]byte
+		for _, v := range values {
+			key := AppendTime(nil, v, o)
+			got, _, err := DecodeTime(key, o)
+			if err != nil || !got.Equal(v) || got.Location() != time.UTC {
+				t.Errorf("DecodeTime returned %s, %v; expected %s", got, err, v)
+			}
+			keys = append(keys, key)
+		}
+		if o == Descending {
+			keys = reverse(keys)
+		}
+		checkSorted(t, "time", keys)
+	}
+}
+
+func TestString(t *testing.T) {
+	values := []string{"", "\x00", "\x00\x00", "\x00\x01", "\x01", "a", "a\x00",
+		"a\x00b", "a\x01", "ab", "b", "\xff", "\xff\xff"}
+	for _, o := range []Order{Ascending, Descending} {
+		var keys [][]byte
+		for _, v := range values {
+			// The component after the string must not affect the order.
+			key := AppendString(nil, v, o)
+			key = AppendInt64(key, -int64(len(keys)), Ascending)
+			got, rest, err := DecodeString(key, o)
+			if err != nil || got != v || len(rest) != 8 {
+				t.Errorf("DecodeString returned %q, %q, %v; expected %q", got, rest, err, v)
+			}
+			keys = append(keys, key)
+		}
+		if o == Descending {
+			keys = reverse(keys)
+		}
+		checkSorted(t, "string", keys)
+	}
+
+	for i, key := range [][]byte{[]byte("abc"), []byte("abc\x00"), {}} {
+		if _, _, err := DecodeBytes(key, Ascending); err != ErrTruncated {
+			t.Errorf("[#%d] Expected ErrTruncated, got %v", i, err)
+		}
+	}
+	if _, _, err := DecodeBytes([]byte("a\x00b"), Ascending); err != ErrInvalidEscape {
+		t.Errorf("Expected ErrInvalidEscape, got %v", err)
+	}
+	if v, _, err := DecodeBytes(AppendBytes(nil, nil, Ascending), Ascending); err != nil ||
+		v == nil || len(v) != 0 {
+		t.Errorf("DecodeBytes returned %q, %v for an empty value", v, err)
+	}
+}
+
+func TestCompositeKey(t *testing.T) {
+	// Rows of a sensor, most recent first.
+	now := time.Now()
+	key := func(sensor string, ts time.Time) []byte {
+		return AppendTime(AppendString(nil, sensor, Ascending), ts, Descending)
+	}
+	checkSorted(t, "composite", [][]byte{
+		key("s1", now),
+		key("s1", now.Add(-time.Second)),
+		key("s1\x00", now),
+		key("s2", now.Add(time.Hour)),
+		key("s2", now),
+	})
+
+	sensor, rest, err := DecodeString(key("s1", now), Ascending)
+	if err != nil || sensor != "s1" {
+		t.Fatalf("DecodeString returned %q, %v", sensor, err)
+	}
+	ts, rest, err := DecodeTime(rest, Descending)
+	if err != nil || !ts.Equal(now) || len(rest) != 0 {
+		t.Errorf("DecodeTime returned %s, %q, %v", ts, rest, err)
+	}
+}
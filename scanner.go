@@ -0,0 +1,152 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"golang.org/x/net/context"
+)
+
+// Returned by the callback of a streaming scan when its Scanner is closed.
+var errScannerClosed = errors.New("scanner closed")
+
+// Interval at which the lease of the RegionServer's scanner is renewed while
+// a Scanner waits for its consumer, well within the default lease period of
+// 60s.
+var scannerRenewInterval = 20 * time.Second
+
+// A Scanner streams the results of a scan, see Client.Scanner.
+type Scanner struct {
+	rows chan *pb.Result
+	stop chan struct{}
+	once sync.Once
+
+	// pauseMutex protects resume, which is closed by Resume and is nil
+	// unless the Scanner is paused.
+	pauseMutex sync.Mutex
+	resume     chan struct{}
+
+	// Only read once rows is closed.
+	err error
+}
+
+// Scanner starts the given scan and returns a Scanner streaming its results.
+// At most buffer results are buffered: when the consumer falls behind, the
+// next batch of results isn't requested from the RegionServer until there's
+// room for it, and the RegionServer's scanner is kept open meanwhile.  The
+// metadata of all the RPCs issued is accumulated in s once the scan is over.
+func (c *client) Scanner(s *hrpc.Scan, buffer int) *Scanner {
+	sc := &Scanner{
+		rows: make(chan *pb.Result, buffer),
+		stop: make(chan struct{}),
+	}
+	cancel := c.applyProfile(s)
+	ctx := s.GetContext()
+	go func() {
+		defer cancel()
+		err := c.scan(s, func(results []*pb.Result, renew func() error) error {
+			return sc.deliver(ctx, results, renew)
+		})
+		if err != errScannerClosed {
+			sc.err = err
+		}
+		close(sc.rows)
+	}()
+	return sc
+}
+
+// Sends the given results to the consumer, then waits until the Scanner
+// isn't paused, renewing the lease of the RegionServer's scanner every
+// scannerRenewInterval meanwhile.
+func (sc *Scanner) deliver(ctx context.Context, results []*pb.Result,
+	renew func() error) error {
+	ticker := time.NewTicker(scannerRenewInterval)
+	defer ticker.Stop()
+	for {
+		var rows chan<- *pb.Result
+		var next *pb.Result
+		if len(results) != 0 {
+			rows = sc.rows
+			next = results[0]
+		}
+		sc.pauseMutex.Lock()
+		resume := sc.resume
+		sc.pauseMutex.Unlock()
+		if rows == nil && resume == nil {
+			return nil
+		}
+		// Don't keep going once the context is done, even if there's
+		// room in the buffer.
+		select {
+		case <-ctx.Done():
+			return ErrDeadline
+		default:
+		}
+		select {
+		case rows <- next:
+			results = results[1:]
+		case <-resume:
+		case <-sc.stop:
+			return errScannerClosed
+		case <-ctx.Done():
+			return ErrDeadline
+		case <-ticker.C:
+			if err := renew(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Pause stops requesting results from the RegionServer, e.g. when the
+// consumer needs to apply backpressure for longer than the lease period of
+// the RegionServer's scanner.  The results already received are still sent
+// on Rows, and the scanner is kept open until Resume is called.  Pausing a
+// paused Scanner does nothing.
+func (sc *Scanner) Pause() {
+	sc.pauseMutex.Lock()
+	if sc.resume == nil {
+		sc.resume = make(chan struct{})
+	}
+	sc.pauseMutex.Unlock()
+}
+
+// Resume continues a paused scan exactly where it left off.  Resuming a
+// Scanner that isn't paused does nothing.
+func (sc *Scanner) Resume() {
+	sc.pauseMutex.Lock()
+	if sc.resume != nil {
+		close(sc.resume)
+		sc.resume = nil
+	}
+	sc.pauseMutex.Unlock()
+}
+
+// Rows returns the channel the results are sent on, in order.  It's closed
+// once the scan is over, failed, or the Scanner is closed.
+func (sc *Scanner) Rows() <-chan *pb.Result {
+	return sc.rows
+}
+
+// Err returns the error that ended the scan, if any.  It must only be called
+// once Rows is closed.
+func (sc *Scanner) Err() error {
+	return sc.err
+}
+
+// Close stops the scan, and returns once the RegionServer's scanner is
+// released.  Results that weren't received yet are dropped.  It's safe to
+// call Close several times, or after the scan is over.
+func (sc *Scanner) Close() {
+	sc.once.Do(func() { close(sc.stop) })
+	for range sc.rows {
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"golang.org/x/net/context"
+)
+
+func TestScanner(t *testing.T) {
+	_, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+
+	for i := 0; i < 50; i++ {
+		put, _ := hrpc.NewPutStr(ctx, "test", fmt.Sprintf("row%02d", i),
+			map[string]map[string][]byte{"cf": {"a": []byte("1")}})
+		if _, err := c.Put(put); err != nil {
+			t.Fatalf("Put failed: %s", err)
+		}
+	}
+
+	scan, _ := hrpc.NewScanStr(ctx, "test")
+	sc := c.Scanner(scan, 5)
+	var i int
+	for result := range sc.Rows() {
+		if key := fmt.Sprintf("row%02d", i); string(result.Cell[0].Row) != key {
+			t.Errorf("Expected %s, got %s", key, result.Cell[0].Row)
+		}
+		i++
+	}
+	if err := sc.Err(); err != nil {
+		t.Errorf("Scan failed: %s", err)
+	}
+	if i != 50 {
+		t.Errorf("Expected 50 rows, got %d", i)
+	}
+
+	// Stopping early.
+	scan, _ = hrpc.NewScanStr(ctx, "test")
+	sc = c.Scanner(scan, 1)
+	result := <-sc.Rows()
+	if string(result.Cell[0].Row) != "row00" {
+		t.Errorf("Expected row00, got %s", result.Cell[0].Row)
+	}
+	sc.Close()
+	sc.Close()
+	if _, ok := <-sc.Rows(); ok {
+		t.Error("Expected Rows to be closed")
+	}
+	if err := sc.Err(); err != nil {
+		t.Errorf("Expected no error after Close, got %s", err)
+	}
+
+	// The scan stops when its context is done.
+	scanCtx, scanCancel := context.WithCancel(ctx)
+	scan, _ = hrpc.NewScanStr(scanCtx, "test")
+	sc = c.Scanner(scan, 1)
+	<-sc.Rows()
+	scanCancel()
+	for range sc.Rows() {
+	}
+	if err := sc.Err(); err != ErrDeadline {
+		t.Errorf("Expected ErrDeadline, got %v", err)
+	}
+}
+
+func TestScannerPause(t *testing.T) {
+	defer func(interval time.Duration) {
+		scannerRenewInterval = interval
+	}(scannerRenewInterval)
+	scannerRenewInterval = 10 * time.Millisecond
+
+	s, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+
+	for i := 0; i < 50; i++ {
+		put, _ := hrpc.NewPutStr(ctx, "test", fmt.Sprintf("row%02d", i),
+			map[string]map[string][]byte{"cf": {"a": []byte("1")}})
+		if _, err := c.Put(put); err != nil {
+			t.Fatalf("Put failed: %s", err)
+		}
+	}
+
+	scan, _ := hrpc.NewScanStr(ctx, "test", hrpc.NumberOfRows(5))
+	sc := c.Scanner(scan, 1)
+	sc.Pause()
+	sc.Pause()
+	// The first batch may have been requested before the pause, but no
+	// more.
+	var rows []string
+	timeout := time.After(200 * time.Millisecond)
+paused:
+	for {
+		select {
+		case result := <-sc.Rows():
+			rows = append(rows, string(result.Cell[0].Row))
+		case <-timeout:
+			break paused
+		}
+	}
+	if len(rows) > 5 {
+		t.Errorf("Expected at most 5 rows while paused, got %d", len(rows))
+	}
+	if s.ScannerRenewals() == 0 {
+		t.Error("Expected the lease of the scanner to be renewed while paused")
+	}
+
+	sc.Resume()
+	sc.Resume()
+	for result := range sc.Rows() {
+		rows = append(rows, string(result.Cell[0].Row))
+	}
+	if err := sc.Err(); err != nil {
+		t.Errorf("Scan failed: %s", err)
+	}
+	if len(rows) != 50 {
+		t.Fatalf("Expected 50 rows, got %d", len(rows))
+	}
+	for i, row := range rows {
+		if key := fmt.Sprintf("row%02d", i); row != key {
+			t.Errorf("Expected %s, got %s", key, row)
+		}
+	}
+}
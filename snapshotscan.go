@@ -0,0 +1,147 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"golang.org/x/net/context"
+)
+
+// Interval between the polls of the Master while waiting for a snapshot, a
+// clone or a procedure to complete.
+const snapshotPollInterval = 100 * time.Millisecond
+
+// Time given to SnapshotScan to clean up, whether or not the context of the
+// caller is done.
+const snapshotCleanupTimeout = time.Minute
+
+func (a *adminClient) SnapshotScan(ctx context.Context, table string,
+	scan func(c Client, clone string) error) (err error) {
+	// Snapshot names can't contain the colon of namespaced table names.
+	clone := table + "_scan_" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	snapshot := strings.Replace(clone, ":", "_", -1)
+	if _, err = a.sendRPC(hrpc.NewSnapshot(ctx, snapshot, table), masterAddr); err != nil {
+		return err
+	}
+	cloned := false
+	defer func() {
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), snapshotCleanupTimeout)
+		defer cancel()
+		var cleanupErr error
+		if cloned {
+			cleanupErr = a.dropTable(cleanupCtx, clone)
+		}
+		if _, e := a.sendRPC(hrpc.NewDeleteSnapshot(cleanupCtx, snapshot), masterAddr); cleanupErr == nil {
+			cleanupErr = e
+		}
+		if cleanupErr == nil {
+			return
+		}
+		log.WithFields(log.Fields{
+			"Table":    table,
+			"Snapshot": snapshot,
+			"Clone":    clone,
+			"Error":    cleanupErr,
+		}).Warn("Failed to clean up after a snapshot scan")
+		if err == nil {
+			err = cleanupErr
+		}
+	}()
+	err = a.poll(ctx, func() (bool, error) {
+		res, err := a.sendRPC(hrpc.NewIsSnapshotDone(ctx, snapshot, table), masterAddr)
+		if err != nil {
+			return false, err
+		}
+		return res.(*pb.IsSnapshotDoneResponse).GetDone(), nil
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = a.sendRPC(hrpc.NewCloneSnapshot(ctx, snapshot, clone), masterAddr); err != nil {
+		return err
+	}
+	cloned = true
+	err = a.poll(ctx, func() (bool, error) {
+		res, err := a.sendRPC(hrpc.NewIsRestoreSnapshotDone(ctx, snapshot, clone), masterAddr)
+		if err != nil {
+			return false, err
+		}
+		return res.(*pb.IsRestoreSnapshotDoneResponse).GetDone(), nil
+	})
+	if err != nil {
+		return err
+	}
+	return scan(a.cfg, clone)
+}
+
+// Calls done until it returns true or fails, waiting snapshotPollInterval
+// between calls.
+func (a *adminClient) poll(ctx context.Context, done func() (bool, error)) error {
+	for {
+		if ok, err := done(); err != nil || ok {
+			return err
+		}
+		select {
+		case <-time.After(snapshotPollInterval):
+		case <-ctx.Done():
+			return ErrDeadline
+		}
+	}
+}
+
+// Disables and deletes the given table.
+func (a *adminClient) dropTable(ctx context.Context, table string) error {
+	res, err := a.sendRPC(hrpc.NewDisableTable(ctx, table), masterAddr)
+	if err != nil {
+		return err
+	}
+	if err = a.waitForProcedure(ctx, res.(*pb.DisableTableResponse).GetProcId()); err != nil {
+		return err
+	}
+	if res, err = a.sendRPC(hrpc.NewDeleteTable(ctx, table), masterAddr); err != nil {
+		return err
+	}
+	return a.waitForProcedure(ctx, res.(*pb.DeleteTableResponse).GetProcId())
+}
+
+// Waits for the procedure with the given ID to complete, and returns the
+// error it failed with, if any.  Procedures that completed a while ago are
+// forgotten by the Master, so a procedure that isn't found is considered
+// complete.
+func (a *adminClient) waitForProcedure(ctx context.Context, procID uint64) error {
+	if procID == 0 {
+		// Masters older than HBase 1.1 complete these operations before
+		// responding.
+		return nil
+	}
+	var procErr error
+	err := a.poll(ctx, func() (bool, error) {
+		res, err := a.sendRPC(hrpc.NewGetProcedureResult(ctx, procID), masterAddr)
+		if err != nil {
+			return false, err
+		}
+		result := res.(*pb.GetProcedureResultResponse)
+		if result.GetState() == pb.GetProcedureResultResponse_RUNNING {
+			return false, nil
+		}
+		if exc := result.GetException().GetGenericException(); exc != nil {
+			procErr = fmt.Errorf("procedure %d failed: %s: %s", procID,
+				exc.GetClassName(), exc.GetMessage())
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	return procErr
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tsuna/gohbase/hrpc"
+)
+
+func TestSnapshotScan(t *testing.T) {
+	s, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+	defer setFakeMaster(s)()
+	ac := &adminClient{cfg: c, conns: make(map[string]RegionClient)}
+	defer ac.Close()
+
+	put, _ := hrpc.NewPutStr(ctx, "test", "before",
+		map[string]map[string][]byte{"cf": {"a": []byte("1")}})
+	if _, err := ac.cfg.Put(put); err != nil {
+		t.Fatalf("Put failed: %s", err)
+	}
+	var keys []string
+	err := ac.SnapshotScan(ctx, "test", func(c Client, clone string) error {
+		if !strings.HasPrefix(clone, "test_scan_") {
+			t.Errorf("Unexpected name of the clone %q", clone)
+		}
+		// Writes to the table don't affect the clone.
+		put, _ := hrpc.NewPutStr(ctx, "test", "after",
+			map[string]map[string][]byte{"cf": {"a": []byte("2")}})
+		if _, err := c.Put(put); err != nil {
+			return err
+		}
+		scan, _ := hrpc.NewScanStr(ctx, clone)
+		rows, err := c.Scan(scan)
+		for _, row := range rows {
+			keys = append(keys, string(row.Cell[0].Row))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("SnapshotScan failed: %s", err)
+	}
+	if !reflect.DeepEqual(keys, []string{"before"}) {
+		t.Errorf("Expected to scan the row written before the snapshot, got %q", keys)
+	}
+	if tables := s.Tables(); !reflect.DeepEqual(tables, []string{"test"}) {
+		t.Errorf("Expected the clone to be deleted, got tables %q", tables)
+	}
+	if snapshots := s.Snapshots(); len(snapshots) != 0 {
+		t.Errorf("Expected the snapshot to be deleted, got %q", snapshots)
+	}
+
+	// Errors of the scan are returned, after cleaning up.
+	failure := errors.New("scan failed")
+	err = ac.SnapshotScan(ctx, "test", func(c Client, clone string) error {
+		return failure
+	})
+	if err != failure {
+		t.Errorf("Expected the error of the scan, got %v", err)
+	}
+	if tables := s.Tables(); len(tables) != 1 || len(s.Snapshots()) != 0 {
+		t.Errorf("Expected everything to be cleaned up, got tables %q and snapshots %q",
+			tables, s.Snapshots())
+	}
+
+	if err := ac.SnapshotScan(ctx, "nonexistent", func(c Client, clone string) error {
+		t.Error("Scan called for a nonexistent table")
+		return nil
+	}); err == nil {
+		t.Error("Expected an error for a nonexistent table")
+	}
+}
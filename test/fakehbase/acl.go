@@ -0,0 +1,170 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package fakehbase
+
+import (
+	"bytes"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/pb"
+)
+
+// Full name of the coprocessor service managing permissions.
+const accessControlService = "hbase.pb.AccessControlService"
+
+// Grant grants the given permission to the given user, as reported by the
+// AccessControlService and checked against the user of the connection.
+func (s *Server) Grant(user string, perm *pb.Permission) {
+	s.m.Lock()
+	s.permissions = append(s.permissions, &pb.UserPermission{
+		User:       []byte(user),
+		Permission: perm,
+	})
+	s.m.Unlock()
+}
+
+// Handles a call to a coprocessor service of the Master.
+func (s *Server) execMasterService(user string, req *pb.CoprocessorServiceRequest) (proto.Message, error) {
+	call := req.Call
+	if call.GetServiceName() != accessControlService {
+		return nil, &exception{class: unknownProtocolException,
+			message: "no registered master coprocessor service found for name " +
+				call.GetServiceName()}
+	}
+	var resp proto.Message
+	switch call.GetMethodName() {
+	case "GetUserPermissions":
+		getReq := &pb.GetUserPermissionsRequest{}
+		if err := proto.Unmarshal(call.Request, getReq); err != nil {
+			return nil, err
+		}
+		resp = s.userPermissions(getReq)
+	case "CheckPermissions":
+		checkReq := &pb.CheckPermissionsRequest{}
+		if err := proto.Unmarshal(call.Request, checkReq); err != nil {
+			return nil, err
+		}
+		for _, perm := range checkReq.Permission {
+			if !s.hasPermission(user, perm) {
+				return nil, &exception{class: accessDeniedException,
+					message: "insufficient permissions for user '" + user + "'"}
+			}
+		}
+		resp = &pb.CheckPermissionsResponse{}
+	default:
+		return nil, &exception{class: unsupportedException,
+			message: "unsupported method " + call.GetMethodName()}
+	}
+	value, err := proto.Marshal(resp)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CoprocessorServiceResponse{
+		Region: req.Region,
+		Value:  &pb.NameBytesPair{Name: proto.String(""), Value: value},
+	}, nil
+}
+
+// Returns the permissions granted on the scope of the given request.
+func (s *Server) userPermissions(req *pb.GetUserPermissionsRequest) *pb.GetUserPermissionsResponse {
+	resp := &pb.GetUserPermissionsResponse{}
+	for _, perm := range s.permissions {
+		p := perm.Permission
+		if p.GetType() != req.GetType() {
+			continue
+		}
+		switch p.GetType() {
+		case pb.Permission_Namespace:
+			if !bytes.Equal(p.NamespacePermission.GetNamespaceName(), req.NamespaceName) {
+				continue
+			}
+		case pb.Permission_Table:
+			if !sameTable(p.TablePermission.GetTableName(), req.TableName) {
+				continue
+			}
+		}
+		resp.UserPermission = append(resp.UserPermission, perm)
+	}
+	return resp
+}
+
+// Returns whether the permissions granted to the given user imply the
+// requested one.
+func (s *Server) hasPermission(user string, requested *pb.Permission) bool {
+	for _, perm := range s.permissions {
+		if string(perm.User) == user && implies(perm.Permission, requested) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns whether the granted permission implies the requested one: it must
+// cover at least the same scope, and allow all the requested actions.
+func implies(granted, requested *pb.Permission) bool {
+	var actions []pb.Permission_Action
+	switch granted.GetType() {
+	case pb.Permission_Global:
+		actions = granted.GlobalPermission.GetAction()
+	case pb.Permission_Namespace:
+		namespace := granted.NamespacePermission.GetNamespaceName()
+		switch requested.GetType() {
+		case pb.Permission_Namespace:
+			if !bytes.Equal(namespace, requested.NamespacePermission.GetNamespaceName()) {
+				return false
+			}
+		case pb.Permission_Table:
+			if !bytes.Equal(namespace, requested.TablePermission.GetTableName().GetNamespace()) {
+				return false
+			}
+		default:
+			return false
+		}
+		actions = granted.NamespacePermission.GetAction()
+	case pb.Permission_Table:
+		if requested.GetType() != pb.Permission_Table {
+			return false
+		}
+		g, r := granted.TablePermission, requested.TablePermission
+		if !sameTable(g.GetTableName(), r.GetTableName()) ||
+			(len(g.Family) != 0 && !bytes.Equal(g.Family, r.Family)) ||
+			(len(g.Qualifier) != 0 && !bytes.Equal(g.Qualifier, r.Qualifier)) {
+			return false
+		}
+		actions = g.GetAction()
+	}
+	for _, action := range requestedActions(requested) {
+		if !hasAction(actions, action) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the actions of the given permission, whatever its scope.
+func requestedActions(perm *pb.Permission) []pb.Permission_Action {
+	switch perm.GetType() {
+	case pb.Permission_Namespace:
+		return perm.NamespacePermission.GetAction()
+	case pb.Permission_Table:
+		return perm.TablePermission.GetAction()
+	}
+	return perm.GlobalPermission.GetAction()
+}
+
+func hasAction(actions []pb.Permission_Action, action pb.Permission_Action) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+func sameTable(a, b *pb.TableName) bool {
+	return bytes.Equal(a.GetNamespace(), b.GetNamespace()) &&
+		bytes.Equal(a.GetQualifier(), b.GetQualifier())
+}
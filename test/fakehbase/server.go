@@ -0,0 +1,1533 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+// Package fakehbase implements an in-memory fake of an HBase RegionServer,
+// speaking enough of the wire protocol for region.Client and gohbase.Client
+// to be tested end-to-end without running HBase.
+//
+// The fake also serves hbase:meta, in which each table created has a single
+// region covering its whole key space, unless it's split with SplitTable.  It supports the Get, Mutate and Scan
+// RPCs, but ignores time ranges and versions (only the latest version of each
+// cell is kept), and all filters but PrefixFilter, FirstKeyOnlyFilter,
+// FamilyFilter with a BinaryComparator, ColumnPaginationFilter and FilterList
+// with MUST_PASS_ALL.
+//
+// For admin requests, the fake answers GetRegionInfo, GetOnlineRegion,
+// GetServerInfo, CloseRegion, ClearRegionBlockCache and RollWALWriter, and acts
+// as the Master for the cluster status, clearing dead servers, table
+// descriptors, disabling and deleting tables, taking, cloning and deleting
+// snapshots, the balancer and normalizer switches, and the GetUserPermissions
+// and CheckPermissions methods of the AccessControlService.
+package fakehbase
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/regioninfo"
+)
+
+// Name of the meta table and of its only region.
+const (
+	metaTableName  = "hbase:meta"
+	metaRegionName = "hbase:meta,,1"
+)
+
+// Start code and web UI port reported by the fake RegionServer, and sizes of
+// its block cache and blocks.
+const (
+	startCode      = 1234567890123
+	webUIPort      = 16030
+	blockCacheSize = 64 << 20
+	blockSize      = 64 << 10
+)
+
+// Names of the Java exceptions sent by the fake.
+const (
+	notServingRegionException   = "org.apache.hadoop.hbase.NotServingRegionException"
+	noSuchColumnFamilyException = "org.apache.hadoop.hbase.regionserver.NoSuchColumnFamilyException"
+	unknownScannerException     = "org.apache.hadoop.hbase.UnknownScannerException"
+	unsupportedException        = "java.lang.UnsupportedOperationException"
+	unknownProtocolException    = "org.apache.hadoop.hbase.exceptions.UnknownProtocolException"
+	accessDeniedException       = "org.apache.hadoop.hbase.security.AccessDeniedException"
+	ioException                 = "java.io.IOException"
+	doNotRetryIOException       = "org.apache.hadoop.hbase.DoNotRetryIOException"
+	tableNotFoundException      = "org.apache.hadoop.hbase.TableNotFoundException"
+	tableExistsException        = "org.apache.hadoop.hbase.TableExistsException"
+	tableNotDisabledException   = "org.apache.hadoop.hbase.TableNotDisabledException"
+	snapshotExistsException     = "org.apache.hadoop.hbase.snapshot.SnapshotExistsException"
+	snapshotNotFoundException   = "org.apache.hadoop.hbase.snapshot.SnapshotDoesNotExistException"
+)
+
+// Names of the filters supported.
+const (
+	prefixFilter           = "org.apache.hadoop.hbase.filter.PrefixFilter"
+	firstKeyOnlyFilter     = "org.apache.hadoop.hbase.filter.FirstKeyOnlyFilter"
+	familyFilter           = "org.apache.hadoop.hbase.filter.FamilyFilter"
+	columnPaginationFilter = "org.apache.hadoop.hbase.filter.ColumnPaginationFilter"
+	filterList             = "org.apache.hadoop.hbase.filter.FilterList"
+)
+
+// Names of the comparators supported in the conditions of mutations.
+const (
+	binaryComparator = "org.apache.hadoop.hbase.filter.BinaryComparator"
+	nullComparator   = "org.apache.hadoop.hbase.filter.NullComparator"
+)
+
+// The latest version of a cell, and its older versions.
+type cell struct {
+	value     []byte
+	timestamp uint64
+
+	// Older versions of the cell, newest first.
+	older []cell
+}
+
+// Returns the cell with the given version added, replacing any version with
+// the same timestamp.
+func (c cell) with(value []byte, ts uint64) cell {
+	versions := c.versions()
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].timestamp <= ts })
+	if i < len(versions) && versions[i].timestamp == ts {
+		versions[i].value = value
+	} else {
+		versions = append(versions, cell{})
+		copy(versions[i+1:], versions[i:])
+		versions[i] = cell{value: value, timestamp: ts}
+	}
+	return fromVersions(versions)
+}
+
+// Returns the cell without the versions selected by drop, and whether any
+// version is left.
+func (c cell) without(drop func(ts uint64) bool) (cell, bool) {
+	var versions []cell
+	for _, v := range c.versions() {
+		if !drop(v.timestamp) {
+			versions = append(versions, v)
+		}
+	}
+	if len(versions) == 0 {
+		return cell{}, false
+	}
+	return fromVersions(versions), true
+}
+
+// Returns all the versions of the cell, newest first.
+func (c cell) versions() []cell {
+	return append([]cell{{value: c.value, timestamp: c.timestamp}}, c.older...)
+}
+
+// Adds a version to the given cell of a family.
+func putVersion(family map[string]cell, qualifier string, value []byte, ts uint64) {
+	if c, ok := family[qualifier]; ok {
+		family[qualifier] = c.with(value, ts)
+	} else {
+		family[qualifier] = cell{value: value, timestamp: ts}
+	}
+}
+
+func fromVersions(versions []cell) cell {
+	c := versions[0]
+	c.older = versions[1:]
+	return c
+}
+
+// row -> family -> qualifier -> cell
+type row map[string]map[string]cell
+
+type table struct {
+	name       string
+	regionName string // Name of its first region.
+	regionID   uint64
+	families   map[string]struct{}
+	rows       map[string]row
+	compaction pb.GetRegionInfoResponse_CompactionState
+	transition *pb.RegionState_State // Nil unless in transition.
+	disabled   bool
+
+	// Locality of the data of the region, and its favored nodes.
+	locality     float32
+	favoredNodes []*pb.ServerName
+
+	// Start keys of the regions after the first one, sorted.  All the
+	// regions have the same id, which changes each time the table is split.
+	splits []string
+}
+
+// An open scanner.
+type scanner struct {
+	table   *table
+	keys    []string // Keys of the rows left to return, sorted.
+	columns []*pb.Column
+	filter  *pb.Filter
+
+	// Maximum number of versions of each cell returned.
+	maxVersions uint32
+
+	// Whether to send the row reached in heartbeats, and that row.
+	needCursor bool
+	lastKey    string
+}
+
+// An exception to send back to the client.
+type exception struct {
+	class   string
+	message string
+}
+
+func (e *exception) Error() string {
+	return e.class + ": " + e.message
+}
+
+// Server is a fake RegionServer listening on the loopback interface.
+type Server struct {
+	ln   net.Listener
+	host string
+	port uint16
+
+	// Protects everything below.
+	m sync.Mutex
+
+	tables        map[string]*table // Keyed by table name.
+	regions       map[string]*table // Keyed by region name.
+	scanners      map[uint64]*scanner
+	nextScannerID uint64
+	lastTimestamp uint64
+	conns         map[net.Conn]struct{}
+
+	// Number of times the write-ahead log was rolled.
+	walRolls int
+
+	// Dead RegionServers reported in the cluster status.
+	deadServers []*pb.ServerName
+
+	// Snapshots of tables, keyed by name, and ID of the last procedure run
+	// by the Master.
+	snapshots  map[string]*table
+	lastProcID uint64
+
+	// Master switches.
+	balancerOn   bool
+	normalizerOn bool
+
+	// Permissions granted to users.
+	permissions []*pb.UserPermission
+
+	// Number of actions of Multi RPCs still to reject, by table and row.
+	rejectedActions map[string]int
+
+	// Number of rows examined by a scanner past which it sends a heartbeat,
+	// 0 to never send heartbeats.
+	heartbeatRows int
+
+	// Whether Gets of the row before a key are rejected, outside hbase:meta.
+	noClosestRowBefore bool
+
+	// Number of times the lease of a scanner was renewed.
+	scannerRenewals int
+}
+
+// NewServer creates a fake RegionServer and starts serving.
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	addr := ln.Addr().(*net.TCPAddr)
+	s := &Server{
+		ln:       ln,
+		host:     addr.IP.String(),
+		port:     uint16(addr.Port),
+		tables:   make(map[string]*table),
+		regions:  make(map[string]*table),
+		scanners: make(map[uint64]*scanner),
+		conns:    make(map[net.Conn]struct{}),
+
+		snapshots:       make(map[string]*table),
+		rejectedActions: make(map[string]int),
+
+		balancerOn:   true,
+		normalizerOn: true,
+	}
+	go s.serve()
+	return s, nil
+}
+
+// Host returns the IP address the server listens on.
+func (s *Server) Host() string {
+	return s.host
+}
+
+// Port returns the port the server listens on.
+func (s *Server) Port() uint16 {
+	return s.port
+}
+
+// Close stops the server and closes all the connections to it.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.m.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.m.Unlock()
+	return err
+}
+
+// CreateTable creates a table with the given column families.  If the table
+// already exists, it's emptied.
+func (s *Server) CreateTable(name string, families []string) {
+	t := &table{
+		name:       name,
+		regionName: regionName(name, "", firstRegionID),
+		regionID:   firstRegionID,
+		families:   make(map[string]struct{}, len(families)),
+		rows:       make(map[string]row),
+	}
+	for _, family := range families {
+		t.families[family] = struct{}{}
+	}
+	s.m.Lock()
+	if old, ok := s.tables[name]; ok {
+		s.unregister(old)
+	}
+	s.tables[name] = t
+	s.register(t)
+	s.m.Unlock()
+}
+
+// DeleteTable deletes the given table, if it exists.
+func (s *Server) DeleteTable(name string) {
+	s.m.Lock()
+	if t, ok := s.tables[name]; ok {
+		s.unregister(t)
+		delete(s.tables, name)
+	}
+	s.m.Unlock()
+}
+
+// SplitTable splits the given table, if it exists, in regions starting with
+// the given keys after its first region.  The regions get new names, so that
+// the old ones are no longer served, and scanners only return the rows of the
+// region they were opened in.
+func (s *Server) SplitTable(name string, keys ...string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	t, ok := s.tables[name]
+	if !ok {
+		return
+	}
+	s.unregister(t)
+	t.regionID++
+	t.regionName = regionName(t.name, "", t.regionID)
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+	t.splits = nil
+	for _, key := range sorted {
+		if key != "" && (len(t.splits) == 0 || t.splits[len(t.splits)-1] != key) {
+			t.splits = append(t.splits, key)
+		}
+	}
+	s.register(t)
+}
+
+// Serves the regions of the given table.
+func (s *Server) register(t *table) {
+	for _, name := range t.regionNames() {
+		s.regions[name] = t
+	}
+}
+
+// Stops serving the regions of the given table.
+func (s *Server) unregister(t *table) {
+	for _, name := range t.regionNames() {
+		delete(s.regions, name)
+	}
+}
+
+// SetCompactionState sets the compaction state reported for the region of
+// the given table, if it exists.
+func (s *Server) SetCompactionState(name string, state pb.GetRegionInfoResponse_CompactionState) {
+	s.m.Lock()
+	if t, ok := s.tables[name]; ok {
+		t.compaction = state
+	}
+	s.m.Unlock()
+}
+
+// SetRegionInTransition sets the state of the region of the given table, if
+// it exists, as in transition.  A nil state ends the transition.
+func (s *Server) SetRegionInTransition(name string, state *pb.RegionState_State) {
+	s.m.Lock()
+	if t, ok := s.tables[name]; ok {
+		t.transition = state
+	}
+	s.m.Unlock()
+}
+
+// RejectActions makes the next n actions of Multi RPCs on the given row fail
+// with a NotServingRegionException, as they would while the region moves.
+func (s *Server) RejectActions(table, row string, n int) {
+	s.m.Lock()
+	s.rejectedActions[table+"\x00"+row] = n
+	s.m.Unlock()
+}
+
+// SetHeartbeatRows makes scanners of clients handling heartbeats send one
+// after examining n rows without filling their response, as a RegionServer
+// does once its time limit is hit.  0 disables heartbeats.
+func (s *Server) SetHeartbeatRows(n int) {
+	s.m.Lock()
+	s.heartbeatRows = n
+	s.m.Unlock()
+}
+
+// RejectClosestRowBefore makes the server reject the Gets of the row before a
+// key on tables other than hbase:meta, like HBase 2.0 RegionServers do.
+func (s *Server) RejectClosestRowBefore() {
+	s.m.Lock()
+	s.noClosestRowBefore = true
+	s.m.Unlock()
+}
+
+// ScannerRenewals returns the number of times the lease of a scanner was
+// renewed.
+func (s *Server) ScannerRenewals() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.scannerRenewals
+}
+
+// SetLocality sets the data locality reported for the region of the given
+// table, if it exists, and its favored nodes in hbase:meta.
+func (s *Server) SetLocality(name string, locality float32, favoredNodes []*pb.ServerName) {
+	s.m.Lock()
+	if t, ok := s.tables[name]; ok {
+		t.locality = locality
+		t.favoredNodes = favoredNodes
+	}
+	s.m.Unlock()
+}
+
+// WALRolls returns the number of times the write-ahead log was rolled.
+func (s *Server) WALRolls() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.walRolls
+}
+
+// Snapshots returns the names of the snapshots taken, sorted.
+func (s *Server) Snapshots() []string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	var names []string
+	for name := range s.snapshots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Tables returns the names of the tables, sorted.
+func (s *Server) Tables() []string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	var names []string
+	for name := range s.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AddDeadServer adds a RegionServer to the dead ones reported in the cluster
+// status, until it's cleared.
+func (s *Server) AddDeadServer(server *pb.ServerName) {
+	s.m.Lock()
+	s.deadServers = append(s.deadServers, server)
+	s.m.Unlock()
+}
+
+// Id of the regions of a table that was never split.
+const firstRegionID = 1234567890042
+
+// Returns the name of the region of the given table starting with the given
+// key.
+func regionName(table, start string, id uint64) string {
+	name := fmt.Sprintf("%s,%s,%d.", table, start, id)
+	hash := md5.Sum([]byte(name))
+	return name + hex.EncodeToString(hash[:]) + "."
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.m.Lock()
+		s.conns[conn] = struct{}{}
+		s.m.Unlock()
+		go s.handleConn(conn)
+	}
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer func() {
+		s.m.Lock()
+		delete(s.conns, conn)
+		s.m.Unlock()
+		conn.Close()
+	}()
+	hello, err := readHello(conn)
+	if err != nil {
+		return
+	}
+	user := hello.GetUserInfo().GetEffectiveUser()
+	var sz [4]byte
+	for {
+		if _, err := io.ReadFull(conn, sz[:]); err != nil {
+			return
+		}
+		buf := make([]byte, binary.BigEndian.Uint32(sz[:]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+		header := &pb.RequestHeader{}
+		buf, err := readDelimited(buf, header)
+		if err != nil {
+			return
+		}
+		var param []byte
+		if header.GetRequestParam() {
+			n, nb := proto.DecodeVarint(buf)
+			if nb == 0 || uint64(len(buf)-nb) < n {
+				return
+			}
+			param = buf[nb : nb+int(n)]
+		}
+		resp, err := s.handleRPC(user, header.GetMethodName(), param)
+		if err = writeResponse(conn, header.GetCallId(), resp, err); err != nil {
+			return
+		}
+	}
+}
+
+// Reads the connection preamble and header.
+func readHello(conn net.Conn) (*pb.ConnectionHeader, error) {
+	var preamble [6 + 4]byte
+	if _, err := io.ReadFull(conn, preamble[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(preamble[:4], []byte("HBas")) {
+		return nil, fmt.Errorf("invalid preamble %q", preamble[:6])
+	}
+	buf := make([]byte, binary.BigEndian.Uint32(preamble[6:]))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil, err
+	}
+	header := &pb.ConnectionHeader{}
+	return header, proto.Unmarshal(buf, header)
+}
+
+// Decodes a varint-delimited protobuf at the beginning of buf, and returns
+// what follows it.
+func readDelimited(buf []byte, msg proto.Message) ([]byte, error) {
+	n, nb := proto.DecodeVarint(buf)
+	if nb == 0 || uint64(len(buf)-nb) < n {
+		return nil, errors.New("truncated message")
+	}
+	buf = buf[nb:]
+	return buf[n:], proto.Unmarshal(buf[:n], msg)
+}
+
+func writeResponse(conn net.Conn, callID uint32, resp proto.Message, err error) error {
+	header := &pb.ResponseHeader{CallId: &callID}
+	if err != nil {
+		exc, ok := err.(*exception)
+		if !ok {
+			exc = &exception{class: ioException, message: err.Error()}
+		}
+		header.Exception = &pb.ExceptionResponse{
+			ExceptionClassName: proto.String(exc.class),
+			StackTrace:         proto.String(exc.Error() + "\n\tat fakehbase"),
+		}
+	}
+	headerData, err := proto.Marshal(header)
+	if err != nil {
+		return err
+	}
+	var respData []byte
+	if header.Exception == nil {
+		if respData, err = proto.Marshal(resp); err != nil {
+			return err
+		}
+	}
+	buf := make([]byte, 4, 4+10+len(headerData)+10+len(respData))
+	buf = append(buf, proto.EncodeVarint(uint64(len(headerData)))...)
+	buf = append(buf, headerData...)
+	if header.Exception == nil {
+		buf = append(buf, proto.EncodeVarint(uint64(len(respData)))...)
+		buf = append(buf, respData...)
+	}
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+	_, err = conn.Write(buf)
+	return err
+}
+
+func (s *Server) handleRPC(user, method string, param []byte) (proto.Message, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	switch method {
+	case "Get":
+		req := &pb.GetRequest{}
+		if err := proto.Unmarshal(param, req); err != nil {
+			return nil, err
+		}
+		return s.get(req)
+	case "Mutate":
+		req := &pb.MutateRequest{}
+		if err := proto.Unmarshal(param, req); err != nil {
+			return nil, err
+		}
+		return s.mutate(req)
+	case "Multi":
+		req := &pb.MultiRequest{}
+		if err := proto.Unmarshal(param, req); err != nil {
+			return nil, err
+		}
+		return s.multi(req), nil
+	case "Scan":
+		req := &pb.ScanRequest{}
+		if err := proto.Unmarshal(param, req); err != nil {
+			return nil, err
+		}
+		return s.scan(req)
+	case "GetRegionInfo":
+		req := &pb.GetRegionInfoRequest{}
+		if err := proto.Unmarshal(param, req); err != nil {
+			return nil, err
+		}
+		t, err := s.tableFor(req.Region)
+		if err != nil {
+			return nil, err
+		}
+		resp := &pb.GetRegionInfoResponse{
+			RegionInfo: t.regionInfo(string(req.Region.GetValue()))}
+		if req.GetCompactionState() {
+			resp.CompactionState = t.compaction.Enum()
+		}
+		return resp, nil
+	case "RollWALWriter":
+		s.walRolls++
+		return &pb.RollWALWriterResponse{}, nil
+	case "GetOnlineRegion":
+		names := make([]string, 0, len(s.regions))
+		for name := range s.regions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		resp := &pb.GetOnlineRegionResponse{}
+		for _, name := range names {
+			resp.RegionInfo = append(resp.RegionInfo, s.regions[name].regionInfo(name))
+		}
+		return resp, nil
+	case "GetServerInfo":
+		return &pb.GetServerInfoResponse{ServerInfo: &pb.ServerInfo{
+			ServerName: &pb.ServerName{
+				HostName:  proto.String(s.host),
+				Port:      proto.Uint32(uint32(s.port)),
+				StartCode: proto.Uint64(startCode),
+			},
+			WebuiPort: proto.Uint32(webUIPort),
+		}}, nil
+	case "CloseRegion":
+		req := &pb.CloseRegionRequest{}
+		if err := proto.Unmarshal(param, req); err != nil {
+			return nil, err
+		}
+		if _, err := s.tableFor(req.Region); err != nil {
+			return nil, err
+		}
+		// The table stays, but its region is no longer served.
+		delete(s.regions, string(req.Region.GetValue()))
+		return &pb.CloseRegionResponse{Closed: proto.Bool(true)}, nil
+	case "ClearRegionBlockCache":
+		req := &pb.ClearRegionBlockCacheRequest{}
+		if err := proto.Unmarshal(param, req); err != nil {
+			return nil, err
+		}
+		// Each region has a single block cached.
+		var evicted int64
+		stats := &pb.CacheEvictionStats{MaxCacheSize: proto.Int64(blockCacheSize)}
+		for _, region := range req.Region {
+			if _, err := s.tableFor(region); err != nil {
+				stats.Exception = append(stats.Exception, &pb.RegionExceptionMessage{
+					Region: region,
+					Exception: &pb.NameBytesPair{
+						Name:  proto.String(notServingRegionException),
+						Value: []byte(err.Error()),
+					},
+				})
+				continue
+			}
+			evicted++
+		}
+		stats.EvictionCount = proto.Int64(evicted)
+		stats.BytesEvicted = proto.Int64(evicted * blockSize)
+		return &pb.ClearRegionBlockCacheResponse{Stats: stats}, nil
+	case "GetClusterStatus":
+		load := &pb.ServerLoad{RegionLoads: []*pb.RegionLoad{&pb.RegionLoad{
+			RegionSpecifier: &pb.RegionSpecifier{
+				Type:  pb.RegionSpecifier_REGION_NAME.Enum(),
+				Value: []byte(metaRegionName),
+			},
+		}}}
+		var rits []*pb.RegionInTransition
+		for _, t := range s.tables {
+			spec := &pb.RegionSpecifier{
+				Type:  pb.RegionSpecifier_REGION_NAME.Enum(),
+				Value: []byte(t.regionName),
+			}
+			if t.transition != nil {
+				rits = append(rits, &pb.RegionInTransition{
+					Spec: spec,
+					RegionState: &pb.RegionState{
+						RegionInfo: t.regionInfo(t.regionName),
+						State:      t.transition,
+					},
+				})
+				continue
+			}
+			load.RegionLoads = append(load.RegionLoads, &pb.RegionLoad{
+				RegionSpecifier: spec,
+				DataLocality:    proto.Float32(t.locality),
+			})
+		}
+		return &pb.GetClusterStatusResponse{ClusterStatus: &pb.ClusterStatus{
+			RegionsInTransition: rits,
+			LiveServers: []*pb.LiveServerInfo{&pb.LiveServerInfo{
+				Server: &pb.ServerName{
+					HostName: proto.String(s.host),
+					Port:     proto.Uint32(uint32(s.port)),
+				},
+				ServerLoad: load,
+			}},
+			DeadServers: append([]*pb.ServerName(nil), s.deadServers...),
+			BalancerOn:  proto.Bool(s.balancerOn),
+		}}, nil
+	case "ClearDeadServers":
+		req := &pb.ClearDeadServersRequest{}
+		if err := proto.Unmarshal(param, req); err != nil {
+			return nil, err
+		}
+		resp := &pb.ClearDeadServersResponse{}
+		for _, server := range req.ServerName {
+			cleared := false
+			for i, dead := range s.deadServers {
+				if proto.Equal(server, dead) {
+					s.deadServers = append(s.deadServers[:i], s.deadServers[i+1:]...)
+					cleared = true
+					break
+				}
+			}
+			if !cleared {
+				resp.ServerName = append(resp.ServerName, server)
+			}
+		}
+		return resp, nil
+	case "GetTableDescriptors":
+		req := &pb.GetTableDescriptorsRequest{}
+		if err := proto.Unmarshal(param, req); err != nil {
+			return nil, err
+		}
+		resp := &pb.GetTableDescriptorsResponse{}
+		for _, name := range req.TableNames {
+			if string(name.Namespace) != "default" {
+				continue
+			}
+			if t, ok := s.tables[string(name.Qualifier)]; ok {
+				resp.TableSchema = append(resp.TableSchema, t.schema())
+			}
+		}
+		return resp, nil
+	case "ExecMasterService":
+		req := &pb.CoprocessorServiceRequest{}
+		if err := proto.Unmarshal(param, req); err != nil {
+			return nil, err
+		}
+		return s.execMasterService(user, req)
+	case "DisableTable":
+		req := &pb.DisableTableRequest{}
+		if err := proto.Unmarshal(param, req); err != nil {
+			return nil, err
+		}
+		t, err := s.masterTable(req.TableName)
+		if err != nil {
+			return nil, err
+		}
+		t.disabled = true
+		s.lastProcID++
+		return &pb.DisableTableResponse{ProcId: proto.Uint64(s.lastProcID)}, nil
+	case "DeleteTable":
+		req := &pb.DeleteTableRequest{}
+		if err := proto.Unmarshal(param, req); err != nil {
+			return nil, err
+		}
+		t, err := s.masterTable(req.TableName)
+		if err != nil {
+			return nil, err
+		} else if !t.disabled {
+			return nil, &exception{class: tableNotDisabledException, message: t.name}
+		}
+		s.unregister(t)
+		delete(s.tables, t.name)
+		s.lastProcID++
+		return &pb.DeleteTableResponse{ProcId: proto.Uint64(s.lastProcID)}, nil
+	case "getProcedureResult":
+		req := &pb.GetProcedureResultRequest{}
+		if err := proto.Unmarshal(param, req); err != nil {
+			return nil, err
+		}
+		// Procedures complete right away.
+		state := pb.GetProcedureResultResponse_FINISHED
+		if req.GetProcId() > s.lastProcID {
+			state = pb.GetProcedureResultResponse_NOT_FOUND
+		}
+		return &pb.GetProcedureResultResponse{State: state.Enum()}, nil
+	case "Snapshot":
+		req := &pb.SnapshotRequest{}
+		if err := proto.Unmarshal(param, req); err != nil {
+			return nil, err
+		}
+		name := req.Snapshot.GetName()
+		t, ok := s.tables[req.Snapshot.GetTable()]
+		if !ok {
+			return nil, &exception{class: tableNotFoundException, message: req.Snapshot.GetTable()}
+		} else if _, ok = s.snapshots[name]; ok {
+			return nil, &exception{class: snapshotExistsException, message: name}
+		}
+		s.snapshots[name] = t.clone(t.name)
+		return &pb.SnapshotResponse{ExpectedTimeout: proto.Int64(60000)}, nil
+	case "IsSnapshotDone":
+		return &pb.IsSnapshotDoneResponse{Done: proto.Bool(true)}, nil
+	case "RestoreSnapshot":
+		req := &pb.RestoreSnapshotRequest{}
+		if err := proto.Unmarshal(param, req); err != nil {
+			return nil, err
+		}
+		// Only clones are supported.
+		name, table := req.Snapshot.GetName(), req.Snapshot.GetTable()
+		snapshot, ok := s.snapshots[name]
+		if !ok {
+			return nil, &exception{class: snapshotNotFoundException, message: name}
+		} else if _, ok = s.tables[table]; ok {
+			return nil, &exception{class: tableExistsException, message: table}
+		}
+		t := snapshot.clone(table)
+		s.tables[table] = t
+		s.register(t)
+		return &pb.RestoreSnapshotResponse{}, nil
+	case "IsRestoreSnapshotDone":
+		return &pb.IsRestoreSnapshotDoneResponse{Done: proto.Bool(true)}, nil
+	case "DeleteSnapshot":
+		req := &pb.DeleteSnapshotRequest{}
+		if err := proto.Unmarshal(param, req); err != nil {
+			return nil, err
+		}
+		name := req.Snapshot.GetName()
+		if _, ok := s.snapshots[name]; !ok {
+			return nil, &exception{class: snapshotNotFoundException, message: name}
+		}
+		delete(s.snapshots, name)
+		return &pb.DeleteSnapshotResponse{}, nil
+	case "SetBalancerRunning":
+		req := &pb.SetBalancerRunningRequest{}
+		if err := proto.Unmarshal(param, req); err != nil {
+			return nil, err
+		}
+		prev := s.balancerOn
+		s.balancerOn = req.GetOn()
+		return &pb.SetBalancerRunningResponse{PrevBalanceValue: &prev}, nil
+	case "IsBalancerEnabled":
+		return &pb.IsBalancerEnabledResponse{Enabled: proto.Bool(s.balancerOn)}, nil
+	case "SetNormalizerRunning":
+		req := &pb.SetNormalizerRunningRequest{}
+		if err := proto.Unmarshal(param, req); err != nil {
+			return nil, err
+		}
+		prev := s.normalizerOn
+		s.normalizerOn = req.GetOn()
+		return &pb.SetNormalizerRunningResponse{PrevNormalizerValue: &prev}, nil
+	case "IsNormalizerEnabled":
+		return &pb.IsNormalizerEnabledResponse{Enabled: proto.Bool(s.normalizerOn)}, nil
+	case "Normalize":
+		return &pb.NormalizeResponse{NormalizerRan: proto.Bool(s.normalizerOn)}, nil
+	}
+	return nil, &exception{class: unsupportedException, message: "unsupported method " + method}
+}
+
+// Returns the given table, as the Master would.
+func (s *Server) masterTable(name *pb.TableName) (*table, error) {
+	if string(name.GetNamespace()) == "default" {
+		if t, ok := s.tables[string(name.GetQualifier())]; ok {
+			return t, nil
+		}
+	}
+	return nil, &exception{class: tableNotFoundException,
+		message: fmt.Sprintf("%s:%s", name.GetNamespace(), name.GetQualifier())}
+}
+
+// Returns the table served by the given region.
+func (s *Server) tableFor(region *pb.RegionSpecifier) (*table, error) {
+	if t, ok := s.regions[string(region.GetValue())]; ok {
+		return t, nil
+	}
+	return nil, &exception{
+		class:   notServingRegionException,
+		message: fmt.Sprintf("region %q is not online", region.GetValue()),
+	}
+}
+
+// Returns a timestamp for a new cell, never smaller than the previous one.
+func (s *Server) timestamp() uint64 {
+	ts := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	if ts <= s.lastTimestamp {
+		ts = s.lastTimestamp + 1
+	}
+	s.lastTimestamp = ts
+	return ts
+}
+
+func (s *Server) get(req *pb.GetRequest) (proto.Message, error) {
+	get := req.Get
+	var t *table
+	var err error
+	if string(req.Region.GetValue()) == metaRegionName {
+		if get.GetClosestRowBefore() {
+			return &pb.GetResponse{Result: s.metaRowBefore(get.Row)}, nil
+		}
+		t = s.metaTable()
+	} else if t, err = s.tableFor(req.Region); err != nil {
+		return nil, err
+	}
+	if err = t.checkColumns(get.Column); err != nil {
+		return nil, err
+	}
+	key := string(get.Row)
+	if get.GetClosestRowBefore() {
+		if s.noClosestRowBefore {
+			return nil, &exception{class: doNotRetryIOException,
+				message: "closest_row_before is no longer supported"}
+		}
+		key = ""
+		for k := range t.rows {
+			if k <= string(get.Row) && k >= key {
+				key = k
+			}
+		}
+	}
+	result := filter(get.Filter, t.result(key, get.Column, get.GetMaxVersions()))
+	if get.GetExistenceOnly() {
+		result = &pb.Result{Exists: proto.Bool(len(result.Cell) != 0)}
+	}
+	return &pb.GetResponse{Result: result}, nil
+}
+
+// Returns the row of hbase:meta right before the given key, if any.
+func (s *Server) metaRowBefore(key []byte) *pb.Result {
+	var found []byte
+	for name := range s.regions {
+		if regioninfo.Compare([]byte(name), key) <= 0 &&
+			(found == nil || regioninfo.Compare([]byte(name), found) > 0) {
+			found = []byte(name)
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	return s.metaTable().result(string(found), nil, 1)
+}
+
+// Returns a snapshot of hbase:meta, listing the regions of every table.
+func (s *Server) metaTable() *table {
+	meta := &table{
+		name:       metaTableName,
+		regionName: metaRegionName,
+		families:   map[string]struct{}{"info": struct{}{}},
+		rows:       make(map[string]row, len(s.tables)),
+	}
+	server := []byte(net.JoinHostPort(s.host, strconv.Itoa(int(s.port))))
+	code := make([]byte, 8)
+	binary.BigEndian.PutUint64(code, startCode)
+	for _, t := range s.tables {
+		for _, name := range t.regionNames() {
+			info := pb.MustMarshal(t.regionInfo(name))
+			meta.rows[name] = row{"info": {
+				"regioninfo":      cell{value: append([]byte("PBUF"), info...)},
+				"server":          cell{value: server},
+				"serverstartcode": cell{value: code},
+			}}
+			if t.favoredNodes != nil {
+				meta.rows[name]["info"]["fn"] = cell{value: pb.MustMarshal(
+					&pb.FavoredNodes{FavoredNode: t.favoredNodes})}
+			}
+		}
+	}
+	return meta
+}
+
+// Returns the names of the regions of the table, in order.
+func (t *table) regionNames() []string {
+	names := []string{t.regionName}
+	for _, split := range t.splits {
+		names = append(names, regionName(t.name, split, t.regionID))
+	}
+	return names
+}
+
+// Returns the start and stop keys of the region of the table with the given
+// name, empty at the ends of the table.
+func (t *table) bounds(region string) (start, stop string) {
+	for i, name := range t.regionNames() {
+		if name != region {
+			continue
+		}
+		if i > 0 {
+			start = t.splits[i-1]
+		}
+		if i < len(t.splits) {
+			stop = t.splits[i]
+		}
+		break
+	}
+	return start, stop
+}
+
+// Returns the description of the region of the table with the given name.
+func (t *table) regionInfo(region string) *pb.RegionInfo {
+	start, stop := t.bounds(region)
+	return &pb.RegionInfo{
+		RegionId:  proto.Uint64(t.regionID),
+		TableName: &pb.TableName{Namespace: []byte("default"), Qualifier: []byte(t.name)},
+		StartKey:  []byte(start),
+		EndKey:    []byte(stop),
+		Offline:   proto.Bool(false),
+		Split:     proto.Bool(false),
+		ReplicaId: proto.Int32(0),
+	}
+}
+
+// Returns a copy of the table with the given name, sharing its cells.
+func (t *table) clone(name string) *table {
+	c := &table{
+		name:       name,
+		regionName: regionName(name, "", t.regionID),
+		regionID:   t.regionID,
+		families:   make(map[string]struct{}, len(t.families)),
+		rows:       make(map[string]row, len(t.rows)),
+		splits:     t.splits,
+	}
+	for family := range t.families {
+		c.families[family] = struct{}{}
+	}
+	for key, r := range t.rows {
+		copied := make(row, len(r))
+		for family, cells := range r {
+			copied[family] = make(map[string]cell, len(cells))
+			for qualifier, cell := range cells {
+				copied[family][qualifier] = cell
+			}
+		}
+		c.rows[key] = copied
+	}
+	return c
+}
+
+// Returns the schema of the table.
+func (t *table) schema() *pb.TableSchema {
+	schema := &pb.TableSchema{TableName: t.regionInfo(t.regionName).TableName}
+	for family := range t.families {
+		schema.ColumnFamilies = append(schema.ColumnFamilies,
+			&pb.ColumnFamilySchema{Name: []byte(family)})
+	}
+	return schema
+}
+
+// Returns an error if the given columns refer to a nonexistent family.
+func (t *table) checkColumns(columns []*pb.Column) error {
+	for _, column := range columns {
+		if _, ok := t.families[string(column.Family)]; !ok {
+			return &exception{
+				class: noSuchColumnFamilyException,
+				message: fmt.Sprintf("column family %s does not exist in table %s",
+					column.Family, t.name),
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the cells of the given row restricted to the given columns (all the
+// columns if none are given), sorted by family and qualifier, with at most
+// the given number of versions each, newest first.
+func (t *table) result(key string, columns []*pb.Column, maxVersions uint32) *pb.Result {
+	result := &pb.Result{}
+	r, ok := t.rows[key]
+	if !ok {
+		return result
+	}
+	families := make([]string, 0, len(r))
+	for family := range r {
+		families = append(families, family)
+	}
+	sort.Strings(families)
+	put := pb.CellType_PUT
+	for _, family := range families {
+		qualifiers := make([]string, 0, len(r[family]))
+		for qualifier := range r[family] {
+			if wanted(columns, family, qualifier) {
+				qualifiers = append(qualifiers, qualifier)
+			}
+		}
+		sort.Strings(qualifiers)
+		for _, qualifier := range qualifiers {
+			versions := r[family][qualifier].versions()
+			if uint32(len(versions)) > maxVersions {
+				versions = versions[:maxVersions]
+			}
+			for _, c := range versions {
+				result.Cell = append(result.Cell, &pb.Cell{
+					Row:       []byte(key),
+					Family:    []byte(family),
+					Qualifier: []byte(qualifier),
+					Timestamp: proto.Uint64(c.timestamp),
+					CellType:  &put,
+					Value:     c.value,
+				})
+			}
+		}
+	}
+	return result
+}
+
+// Returns true if the given cell is selected by the given columns.
+func wanted(columns []*pb.Column, family, qualifier string) bool {
+	if len(columns) == 0 {
+		return true
+	}
+	for _, column := range columns {
+		if string(column.Family) != family {
+			continue
+		} else if len(column.Qualifier) == 0 {
+			return true
+		}
+		for _, q := range column.Qualifier {
+			if string(q) == qualifier {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *Server) mutate(req *pb.MutateRequest) (proto.Message, error) {
+	t, err := s.tableFor(req.Region)
+	if err != nil {
+		return nil, err
+	}
+	mutation := req.Mutation
+	for _, cv := range mutation.ColumnValue {
+		if _, ok := t.families[string(cv.Family)]; !ok {
+			return nil, &exception{
+				class: noSuchColumnFamilyException,
+				message: fmt.Sprintf("column family %s does not exist in table %s",
+					cv.Family, t.name),
+			}
+		}
+	}
+	key := string(mutation.Row)
+	if req.Condition != nil {
+		matches, err := t.matches(req.Condition)
+		if err != nil {
+			return nil, err
+		} else if !matches {
+			return &pb.MutateResponse{Processed: proto.Bool(false)}, nil
+		}
+	}
+	r, ok := t.rows[key]
+	if !ok {
+		r = make(row)
+		t.rows[key] = r
+	}
+	ts := mutation.GetTimestamp()
+	explicit := ts != 0
+	if !explicit {
+		ts = s.timestamp()
+	}
+	resp := &pb.MutateResponse{Processed: proto.Bool(true)}
+	var changed []*pb.Column
+	switch mutation.GetMutateType() {
+	case pb.MutationProto_PUT:
+		for _, cv := range mutation.ColumnValue {
+			family := r.family(string(cv.Family))
+			for _, qv := range cv.QualifierValue {
+				putVersion(family, string(qv.Qualifier), qv.Value, ts)
+			}
+		}
+	case pb.MutationProto_DELETE:
+		if len(mutation.ColumnValue) == 0 {
+			delete(t.rows, key)
+			break
+		}
+		for _, cv := range mutation.ColumnValue {
+			if len(cv.QualifierValue) == 0 {
+				delete(r, string(cv.Family))
+				continue
+			}
+			family := r[string(cv.Family)]
+			for _, qv := range cv.QualifierValue {
+				c, ok := family[string(qv.Qualifier)]
+				if !ok {
+					continue
+				}
+				// Without timestamp, all the versions are deleted.
+				drop := func(v uint64) bool { return !explicit || v <= ts }
+				if qv.GetDeleteType() == pb.MutationProto_DELETE_ONE_VERSION &&
+					qv.DeleteType != nil {
+					drop = func(v uint64) bool { return v == ts }
+				}
+				if c, ok = c.without(drop); ok {
+					family[string(qv.Qualifier)] = c
+				} else {
+					delete(family, string(qv.Qualifier))
+				}
+			}
+			if len(family) == 0 {
+				delete(r, string(cv.Family))
+			}
+		}
+	case pb.MutationProto_APPEND, pb.MutationProto_INCREMENT:
+		for _, cv := range mutation.ColumnValue {
+			family := r.family(string(cv.Family))
+			column := &pb.Column{Family: cv.Family}
+			for _, qv := range cv.QualifierValue {
+				old := family[string(qv.Qualifier)].value
+				value, err := combine(mutation.GetMutateType(), old, qv.Value)
+				if err != nil {
+					return nil, err
+				}
+				putVersion(family, string(qv.Qualifier), value, ts)
+				column.Qualifier = append(column.Qualifier, qv.Qualifier)
+			}
+			changed = append(changed, column)
+		}
+		resp.Result = t.result(key, changed, 1)
+	default:
+		return nil, &exception{class: unsupportedException,
+			message: fmt.Sprintf("unsupported mutation %s", mutation.GetMutateType())}
+	}
+	if len(r) == 0 {
+		delete(t.rows, key)
+	}
+	return resp, nil
+}
+
+// Applies the mutations of a Multi RPC, each on its own.
+func (s *Server) multi(req *pb.MultiRequest) *pb.MultiResponse {
+	resp := &pb.MultiResponse{}
+	for _, regionAction := range req.RegionAction {
+		result := &pb.RegionActionResult{}
+		resp.RegionActionResult = append(resp.RegionActionResult, result)
+		t, err := s.tableFor(regionAction.Region)
+		if err != nil {
+			result.Exception = actionException(err)
+			continue
+		}
+		for _, action := range regionAction.Action {
+			roe := &pb.ResultOrException{Index: action.Index}
+			result.ResultOrException = append(result.ResultOrException, roe)
+			key := t.name + "\x00" + string(action.Mutation.GetRow())
+			if s.rejectedActions[key] > 0 {
+				s.rejectedActions[key]--
+				roe.Exception = actionException(&exception{
+					class:   notServingRegionException,
+					message: fmt.Sprintf("region %q is moving", t.regionName),
+				})
+				continue
+			}
+			mutateResp, err := s.mutate(&pb.MutateRequest{
+				Region:   regionAction.Region,
+				Mutation: action.Mutation,
+			})
+			if err != nil {
+				roe.Exception = actionException(err)
+				continue
+			}
+			roe.Result = mutateResp.(*pb.MutateResponse).Result
+		}
+	}
+	return resp
+}
+
+// Returns the exception of an action of a Multi RPC.
+func actionException(err error) *pb.NameBytesPair {
+	class, message := "java.io.IOException", err.Error()
+	if e, ok := err.(*exception); ok {
+		class, message = e.class, e.message
+	}
+	return &pb.NameBytesPair{Name: proto.String(class), Value: []byte(message)}
+}
+
+// Returns true if the given condition of a mutation holds.
+func (t *table) matches(cond *pb.Condition) (bool, error) {
+	if cond.GetCompareType() != pb.CompareType_EQUAL {
+		return false, &exception{class: unsupportedException,
+			message: fmt.Sprintf("unsupported comparison %s", cond.GetCompareType())}
+	}
+	c, exists := t.rows[string(cond.Row)][string(cond.Family)][string(cond.Qualifier)]
+	switch cond.Comparator.GetName() {
+	case nullComparator:
+		return !exists, nil
+	case binaryComparator:
+		comparator := &pb.BinaryComparator{}
+		if err := proto.Unmarshal(cond.Comparator.SerializedComparator, comparator); err != nil {
+			return false, err
+		}
+		return exists && bytes.Equal(c.value, comparator.Comparable.Value), nil
+	}
+	return false, &exception{class: unsupportedException,
+		message: "unsupported comparator " + cond.Comparator.GetName()}
+}
+
+// Returns the given family of the row, creating it if needed.
+func (r row) family(name string) map[string]cell {
+	family, ok := r[name]
+	if !ok {
+		family = make(map[string]cell)
+		r[name] = family
+	}
+	return family
+}
+
+// Applies an append or an increment to a value.
+func combine(op pb.MutationProto_MutationType, old, delta []byte) ([]byte, error) {
+	if op == pb.MutationProto_APPEND {
+		return append(append([]byte(nil), old...), delta...), nil
+	}
+	if (len(old) != 0 && len(old) != 8) || len(delta) != 8 {
+		return nil, &exception{class: ioException,
+			message: "attempted to increment a field that isn't 64 bits wide"}
+	}
+	var sum int64
+	if len(old) == 8 {
+		sum = int64(binary.BigEndian.Uint64(old))
+	}
+	sum += int64(binary.BigEndian.Uint64(delta))
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, uint64(sum))
+	return value, nil
+}
+
+func (s *Server) scan(req *pb.ScanRequest) (proto.Message, error) {
+	var id uint64
+	var sc *scanner
+	if req.ScannerId != nil {
+		id = *req.ScannerId
+		var ok bool
+		if sc, ok = s.scanners[id]; !ok {
+			return nil, &exception{class: unknownScannerException,
+				message: fmt.Sprintf("unknown scanner %d", id)}
+		}
+	} else {
+		var t *table
+		var err error
+		if string(req.Region.GetValue()) == metaRegionName {
+			t = s.metaTable()
+		} else if t, err = s.tableFor(req.Region); err != nil {
+			return nil, err
+		}
+		scan := req.Scan
+		if err = t.checkColumns(scan.Column); err != nil {
+			return nil, err
+		}
+		sc = &scanner{table: t, columns: scan.Column, filter: scan.Filter,
+			maxVersions: scan.GetMaxVersions(), needCursor: scan.GetNeedCursorResult()}
+		// Only the rows of the region are scanned.
+		start, stop := t.bounds(string(req.Region.GetValue()))
+		inRegion := func(key string) bool {
+			return key >= start && (stop == "" || key < stop)
+		}
+		if scan.GetReversed() {
+			for key := range t.rows {
+				if inRegion(key) && (len(scan.StartRow) == 0 || key <= string(scan.StartRow)) &&
+					key > string(scan.StopRow) {
+					sc.keys = append(sc.keys, key)
+				}
+			}
+			sort.Sort(sort.Reverse(sort.StringSlice(sc.keys)))
+		} else {
+			for key := range t.rows {
+				if inRegion(key) && key >= string(scan.StartRow) &&
+					(len(scan.StopRow) == 0 || key < string(scan.StopRow)) {
+					sc.keys = append(sc.keys, key)
+				}
+			}
+			sort.Strings(sc.keys)
+		}
+		s.nextScannerID++
+		id = s.nextScannerID
+		s.scanners[id] = sc
+	}
+	resp := &pb.ScanResponse{ScannerId: proto.Uint64(id)}
+	if req.GetCloseScanner() {
+		delete(s.scanners, id)
+		resp.MoreResults = proto.Bool(false)
+		return resp, nil
+	}
+	if req.GetRenew() {
+		s.scannerRenewals++
+		resp.MoreResults = proto.Bool(len(sc.keys) != 0)
+		return resp, nil
+	}
+	n := int(req.GetNumberOfRows())
+	var examined int
+	for n > 0 && len(sc.keys) > 0 {
+		if s.heartbeatRows > 0 && examined == s.heartbeatRows &&
+			req.GetClientHandlesHeartbeats() {
+			resp.HeartbeatMessage = proto.Bool(true)
+			if sc.needCursor && len(resp.Results) == 0 {
+				resp.Cursor = &pb.Cursor{Row: []byte(sc.lastKey)}
+			}
+			break
+		}
+		sc.lastKey = sc.keys[0]
+		result := filter(sc.filter, sc.table.result(sc.keys[0], sc.columns, sc.maxVersions))
+		sc.keys = sc.keys[1:]
+		examined++
+		if len(result.Cell) != 0 {
+			resp.Results = append(resp.Results, result)
+			n--
+		}
+	}
+	// Like RegionServers, the scanner is closed once it reached the end of
+	// its region.
+	more := len(sc.keys) != 0
+	resp.MoreResults = proto.Bool(more)
+	resp.MoreResultsInRegion = proto.Bool(more)
+	if !more {
+		delete(s.scanners, id)
+	}
+	return resp, nil
+}
+
+// Applies the given filter, if supported, to a row.
+func filter(f *pb.Filter, result *pb.Result) *pb.Result {
+	if f == nil || len(result.Cell) == 0 {
+		return result
+	}
+	switch f.GetName() {
+	case prefixFilter:
+		prefix := &pb.PrefixFilter{}
+		if proto.Unmarshal(f.SerializedFilter, prefix) == nil &&
+			!bytes.HasPrefix(result.Cell[0].Row, prefix.Prefix) {
+			return &pb.Result{}
+		}
+	case firstKeyOnlyFilter:
+		result.Cell = result.Cell[:1]
+	case familyFilter:
+		family := &pb.FamilyFilter{}
+		if proto.Unmarshal(f.SerializedFilter, family) != nil {
+			break
+		}
+		compare := family.GetCompareFilter()
+		comparator := &pb.BinaryComparator{}
+		if compare.GetComparator().GetName() != binaryComparator ||
+			proto.Unmarshal(compare.GetComparator().SerializedComparator, comparator) != nil {
+			break
+		}
+		value := comparator.GetComparable().GetValue()
+		var cells []*pb.Cell
+		for _, c := range result.Cell {
+			if compareMatches(compare.GetCompareOp(), bytes.Compare(c.Family, value)) {
+				cells = append(cells, c)
+			}
+		}
+		result.Cell = cells
+	case columnPaginationFilter:
+		pagination := &pb.ColumnPaginationFilter{}
+		if proto.Unmarshal(f.SerializedFilter, pagination) != nil {
+			break
+		}
+		// The column offset, if any, replaces the offset, and applies to
+		// each family.
+		skip := int(pagination.GetOffset())
+		if pagination.ColumnOffset != nil {
+			skip = 0
+		}
+		var cells []*pb.Cell
+		var last *pb.Cell
+		columns := 0
+		for _, c := range result.Cell {
+			if pagination.ColumnOffset != nil &&
+				bytes.Compare(c.Qualifier, pagination.ColumnOffset) < 0 {
+				continue
+			}
+			if last == nil || !bytes.Equal(c.Family, last.Family) ||
+				!bytes.Equal(c.Qualifier, last.Qualifier) {
+				columns++
+			}
+			last = c
+			if columns > skip+int(pagination.GetLimit()) {
+				break
+			} else if columns > skip {
+				cells = append(cells, c)
+			}
+		}
+		result.Cell = cells
+	case filterList:
+		list := &pb.FilterList{}
+		if proto.Unmarshal(f.SerializedFilter, list) != nil ||
+			list.GetOperator() != pb.FilterList_MUST_PASS_ALL {
+			break
+		}
+		for _, f := range list.Filters {
+			result = filter(f, result)
+		}
+	}
+	return result
+}
+
+// Returns true if the given result of a comparison matches the given operator.
+func compareMatches(op pb.CompareType, cmp int) bool {
+	switch op {
+	case pb.CompareType_LESS:
+		return cmp < 0
+	case pb.CompareType_LESS_OR_EQUAL:
+		return cmp <= 0
+	case pb.CompareType_EQUAL:
+		return cmp == 0
+	case pb.CompareType_NOT_EQUAL:
+		return cmp != 0
+	case pb.CompareType_GREATER_OR_EQUAL:
+		return cmp >= 0
+	case pb.CompareType_GREATER:
+		return cmp > 0
+	}
+	return true
+}
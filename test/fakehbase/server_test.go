@@ -0,0 +1,107 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package fakehbase
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/region"
+	"github.com/tsuna/gohbase/regioninfo"
+	"golang.org/x/net/context"
+)
+
+// Sends the given RPC to the given region and waits for its result.
+func call(t *testing.T, c *region.Client, reg *regioninfo.Info, rpc hrpc.Call) (proto.Message, error) {
+	rpc.SetRegion(reg)
+	if err := c.QueueRPC(rpc); err != nil {
+		t.Fatalf("Failed to queue RPC: %s", err)
+	}
+	res := <-rpc.GetResultChan()
+	return res.Msg, res.Error
+}
+
+func TestServer(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start the server: %s", err)
+	}
+	defer s.Close()
+	s.CreateTable("test", []string{"cf"})
+
+	c, err := region.NewClient(s.Host(), s.Port(), 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to connect: %s", err)
+	}
+	defer c.Close(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Look up the region of the table in meta.
+	meta := &regioninfo.Info{Table: []byte("hbase:meta"), RegionName: []byte("hbase:meta,,1")}
+	get, _ := hrpc.NewGetBefore(ctx, []byte("hbase:meta"), []byte("test,foo,:"))
+	msg, err := call(t, c, meta, get)
+	if err != nil {
+		t.Fatalf("Meta lookup failed: %s", err)
+	}
+	cells := msg.(*pb.GetResponse).Result.Cell
+	if len(cells) != 3 {
+		t.Fatalf("Expected 3 cells in the meta row, got %d", len(cells))
+	}
+	reg, err := regioninfo.InfoFromCell(cells[0])
+	if err != nil {
+		t.Fatalf("Failed to decode the region info: %s", err)
+	}
+	if string(reg.Table) != "test" || string(reg.RegionName) != regionName("test", "", firstRegionID) {
+		t.Errorf("Unexpected region %s", reg)
+	}
+
+	put, _ := hrpc.NewPutStr(ctx, "test", "foo",
+		map[string]map[string][]byte{"cf": {"a": []byte("1")}})
+	if _, err = call(t, c, reg, put); err != nil {
+		t.Fatalf("Put failed: %s", err)
+	}
+	get, _ = hrpc.NewGetStr(ctx, "test", "foo")
+	if msg, err = call(t, c, reg, get); err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	cells = msg.(*pb.GetResponse).Result.Cell
+	if len(cells) != 1 || !bytes.Equal(cells[0].Value, []byte("1")) {
+		t.Errorf("Unexpected cells %v", cells)
+	}
+
+	inc, _ := hrpc.NewIncStr(ctx, "test", "foo",
+		map[string]map[string][]byte{"cf": {"n": {0, 0, 0, 0, 0, 0, 0, 2}}})
+	for i := 0; i < 2; i++ {
+		if msg, err = call(t, c, reg, inc); err != nil {
+			t.Fatalf("Increment failed: %s", err)
+		}
+	}
+	cells = msg.(*pb.MutateResponse).Result.Cell
+	if len(cells) != 1 || !bytes.Equal(cells[0].Value, []byte{0, 0, 0, 0, 0, 0, 0, 4}) {
+		t.Errorf("Unexpected cells after increment %v", cells)
+	}
+
+	put, _ = hrpc.NewPutStr(ctx, "test", "foo",
+		map[string]map[string][]byte{"nope": {"a": []byte("1")}})
+	if _, err = call(t, c, reg, put); err == nil {
+		t.Error("Put to a nonexistent family succeeded")
+	} else if _, ok := err.(region.DoNotRetryError); !ok {
+		t.Errorf("Expected a DoNotRetryError, got %T: %s", err, err)
+	}
+
+	s.DeleteTable("test")
+	get, _ = hrpc.NewGetStr(ctx, "test", "foo")
+	if _, err = call(t, c, reg, get); err == nil {
+		t.Error("Get to a deleted table succeeded")
+	} else if _, ok := err.(region.RetryableError); !ok {
+		t.Errorf("Expected a RetryableError, got %T: %s", err, err)
+	}
+}
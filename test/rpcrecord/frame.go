@@ -0,0 +1,197 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package rpcrecord
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/pb"
+)
+
+// Name of the only region of hbase:meta.
+const metaRegionName = "hbase:meta,,1"
+
+var errTruncated = errors.New("truncated frame")
+
+// Reads the connection preamble and header, and returns them unparsed.
+func readHello(r io.Reader) ([]byte, error) {
+	hello := make([]byte, 6+4)
+	if _, err := io.ReadFull(r, hello); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(hello[:4], []byte("HBas")) {
+		return nil, fmt.Errorf("invalid preamble %q", hello[:6])
+	}
+	header := make([]byte, binary.BigEndian.Uint32(hello[6:]))
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	return append(hello, header...), nil
+}
+
+// Reads a frame, without its length prefix.
+func readFrame(r io.Reader) ([]byte, error) {
+	var sz [4]byte
+	if _, err := io.ReadFull(r, sz[:]); err != nil {
+		return nil, err
+	}
+	frame := make([]byte, binary.BigEndian.Uint32(sz[:]))
+	_, err := io.ReadFull(r, frame)
+	return frame, err
+}
+
+// Writes the given parts as a single frame.
+func writeFrame(w io.Writer, parts ...[]byte) error {
+	n := 0
+	for _, part := range parts {
+		n += len(part)
+	}
+	buf := make([]byte, 4, 4+n)
+	binary.BigEndian.PutUint32(buf, uint32(n))
+	for _, part := range parts {
+		buf = append(buf, part...)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// Decodes a varint-delimited message at the beginning of buf, and returns its
+// bytes and what follows it.
+func splitDelimited(buf []byte) ([]byte, []byte, error) {
+	n, nb := proto.DecodeVarint(buf)
+	if nb == 0 || uint64(len(buf)-nb) < n {
+		return nil, nil, errTruncated
+	}
+	buf = buf[nb:]
+	return buf[:n], buf[n:], nil
+}
+
+func delimited(msg []byte) []byte {
+	return append(proto.EncodeVarint(uint64(len(msg))), msg...)
+}
+
+// A request read from a frame.
+type request struct {
+	callID uint32
+	method string
+	param  []byte
+}
+
+func parseRequest(frame []byte) (*request, error) {
+	headerData, rest, err := splitDelimited(frame)
+	if err != nil {
+		return nil, err
+	}
+	header := &pb.RequestHeader{}
+	if err = proto.Unmarshal(headerData, header); err != nil {
+		return nil, err
+	}
+	req := &request{callID: header.GetCallId(), method: header.GetMethodName()}
+	if header.GetRequestParam() {
+		if req.param, _, err = splitDelimited(rest); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+// Returns true if the given request targets hbase:meta.
+func (r *request) isMeta() bool {
+	var region *pb.RegionSpecifier
+	switch r.method {
+	case "Get":
+		get := &pb.GetRequest{}
+		if proto.Unmarshal(r.param, get) != nil {
+			return false
+		}
+		region = get.Region
+	case "Scan":
+		scan := &pb.ScanRequest{}
+		if proto.Unmarshal(r.param, scan) != nil {
+			return false
+		}
+		region = scan.Region
+	}
+	return region != nil && string(region.GetValue()) == metaRegionName
+}
+
+// Returns the response header, with its call ID, and what follows it.
+func parseResponse(frame []byte) (*pb.ResponseHeader, []byte, error) {
+	headerData, rest, err := splitDelimited(frame)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := &pb.ResponseHeader{}
+	if err = proto.Unmarshal(headerData, header); err != nil {
+		return nil, nil, err
+	}
+	return header, rest, nil
+}
+
+// Tracks the scanners opened on hbase:meta in a connection, whose later
+// responses also need their server locations rewritten.
+type metaScanners map[uint64]struct{}
+
+// Returns the response of a meta lookup or scan with the location of all the
+// regions replaced by the given server, and the ID of the scanner opened.
+func rewriteLocations(method string, response []byte, server string) ([]byte, uint64, error) {
+	msgData, rest, err := splitDelimited(response)
+	if err != nil {
+		return nil, 0, err
+	}
+	var results []*pb.Result
+	var msg proto.Message
+	var scannerID uint64
+	switch method {
+	case "Get":
+		get := &pb.GetResponse{}
+		if err = proto.Unmarshal(msgData, get); err != nil {
+			return nil, 0, err
+		}
+		if get.Result != nil {
+			results = []*pb.Result{get.Result}
+		}
+		msg = get
+	case "Scan":
+		scan := &pb.ScanResponse{}
+		if err = proto.Unmarshal(msgData, scan); err != nil {
+			return nil, 0, err
+		}
+		results = scan.Results
+		scannerID = scan.GetScannerId()
+		msg = scan
+	default:
+		return response, 0, nil
+	}
+	for _, result := range results {
+		for _, cell := range result.Cell {
+			if string(cell.Family) == "info" && string(cell.Qualifier) == "server" {
+				cell.Value = []byte(server)
+			}
+		}
+	}
+	if msgData, err = proto.Marshal(msg); err != nil {
+		return nil, 0, err
+	}
+	return append(delimited(msgData), rest...), scannerID, nil
+}
+
+// Returns true if the given request continues or opens a scan of hbase:meta.
+func (s metaScanners) isMeta(req *request) bool {
+	if req.method == "Scan" {
+		scan := &pb.ScanRequest{}
+		if proto.Unmarshal(req.param, scan) == nil && scan.ScannerId != nil {
+			_, ok := s[*scan.ScannerId]
+			return ok
+		}
+	}
+	return req.isMeta()
+}
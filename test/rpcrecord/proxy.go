@@ -0,0 +1,187 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package rpcrecord
+
+import (
+	"net"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/golang/protobuf/proto"
+)
+
+// Proxy forwards connections to a RegionServer and records the RPCs
+// exchanged.
+type Proxy struct {
+	ln       net.Listener
+	upstream string
+	rec      *Recording
+
+	// Protects conns.
+	m     sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+// NewProxy creates a Proxy listening on the given address, which forwards
+// connections to the RegionServer at the given host:port.
+func NewProxy(listen, upstream string) (*Proxy, error) {
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, err
+	}
+	p := &Proxy{
+		ln:       ln,
+		upstream: upstream,
+		rec:      &Recording{},
+		conns:    make(map[net.Conn]struct{}),
+	}
+	go p.serve()
+	return p, nil
+}
+
+// Addr returns the address the proxy listens on.
+func (p *Proxy) Addr() *net.TCPAddr {
+	return p.ln.Addr().(*net.TCPAddr)
+}
+
+// Recording returns the RPCs recorded so far.
+func (p *Proxy) Recording() *Recording {
+	return p.rec
+}
+
+// Close stops the proxy and closes all the connections going through it.
+func (p *Proxy) Close() error {
+	err := p.ln.Close()
+	p.m.Lock()
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.m.Unlock()
+	return err
+}
+
+func (p *Proxy) track(conn net.Conn, open bool) {
+	p.m.Lock()
+	if open {
+		p.conns[conn] = struct{}{}
+	} else {
+		delete(p.conns, conn)
+	}
+	p.m.Unlock()
+}
+
+func (p *Proxy) serve() {
+	for {
+		conn, err := p.ln.Accept()
+		if err != nil {
+			return
+		}
+		go p.forward(conn)
+	}
+}
+
+func (p *Proxy) forward(client net.Conn) {
+	upstream, err := net.Dial("tcp", p.upstream)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"upstream": p.upstream,
+			"err":      err,
+		}).Error("Failed to connect to the RegionServer")
+		client.Close()
+		return
+	}
+	for _, conn := range []net.Conn{client, upstream} {
+		p.track(conn, true)
+		defer p.track(conn, false)
+		defer conn.Close()
+	}
+
+	// Requests waiting for their response, by call ID.
+	var pendingLock sync.Mutex
+	pending := make(map[uint32]*request)
+	metaScans := make(metaScanners)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer upstream.Close()
+		hello, err := readHello(client)
+		if err != nil {
+			return
+		}
+		if _, err = upstream.Write(hello); err != nil {
+			return
+		}
+		for {
+			frame, err := readFrame(client)
+			if err != nil {
+				return
+			}
+			req, err := parseRequest(frame)
+			if err != nil {
+				return
+			}
+			pendingLock.Lock()
+			pending[req.callID] = req
+			pendingLock.Unlock()
+			if err = writeFrame(upstream, frame); err != nil {
+				return
+			}
+		}
+	}()
+
+	self := p.Addr().String()
+	for {
+		frame, err := readFrame(upstream)
+		if err != nil {
+			break
+		}
+		header, response, err := parseResponse(frame)
+		if err != nil {
+			break
+		}
+		pendingLock.Lock()
+		req, ok := pending[header.GetCallId()]
+		delete(pending, header.GetCallId())
+		isMeta := ok && metaScans.isMeta(req)
+		pendingLock.Unlock()
+		if !ok {
+			break
+		}
+		callID := header.GetCallId()
+		header.CallId = nil
+		headerData, err := proto.Marshal(header)
+		if err != nil {
+			break
+		}
+		p.rec.add(Exchange{
+			Method:   req.method,
+			Request:  req.param,
+			Header:   headerData,
+			Response: response,
+		})
+		if isMeta && header.Exception == nil {
+			var scannerID uint64
+			response, scannerID, err = rewriteLocations(req.method, response, self)
+			if err != nil {
+				break
+			}
+			if req.method == "Scan" {
+				pendingLock.Lock()
+				metaScans[scannerID] = struct{}{}
+				pendingLock.Unlock()
+			}
+		}
+		header.CallId = &callID
+		if headerData, err = proto.Marshal(header); err != nil {
+			break
+		}
+		if err = writeFrame(client, delimited(headerData), response); err != nil {
+			break
+		}
+	}
+	client.Close()
+	<-done
+}
@@ -0,0 +1,81 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+// Package rpcrecord records the RPCs exchanged with a live RegionServer
+// through a Proxy, and replays the responses later from a Server, so that
+// regression tests can run against real server behavior without any live
+// infrastructure.
+//
+// Only a single RegionServer can be recorded, which is enough for standalone
+// clusters.  The location of regions in hbase:meta is rewritten to point to
+// the Proxy or the Server, so that clients talk to them only.
+package rpcrecord
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// Exchange is a recorded RPC.
+type Exchange struct {
+	// Name of the RPC method called.
+	Method string `json:"method"`
+	// Serialized request.
+	Request []byte `json:"request"`
+	// Serialized response header, without call ID.
+	Header []byte `json:"header"`
+	// What followed the response header in its frame.
+	Response []byte `json:"response,omitempty"`
+}
+
+// Recording is a list of RPCs exchanged with a RegionServer.
+type Recording struct {
+	m         sync.Mutex
+	exchanges []Exchange
+}
+
+// Load reads a recording saved in the given file.
+func Load(path string) (*Recording, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &Recording{}
+	if err = json.Unmarshal(data, &r.exchanges); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Save writes the recording to the given file.
+func (r *Recording) Save(path string) error {
+	r.m.Lock()
+	data, err := json.MarshalIndent(r.exchanges, "", "\t")
+	r.m.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Exchanges returns the RPCs recorded, in the order their responses were
+// received.
+func (r *Recording) Exchanges() []Exchange {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return append([]Exchange(nil), r.exchanges...)
+}
+
+func (r *Recording) add(e Exchange) {
+	r.m.Lock()
+	r.exchanges = append(r.exchanges, e)
+	r.m.Unlock()
+}
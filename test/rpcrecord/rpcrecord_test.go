@@ -0,0 +1,111 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package rpcrecord
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"github.com/tsuna/gohbase/region"
+	"github.com/tsuna/gohbase/regioninfo"
+	"github.com/tsuna/gohbase/test/fakehbase"
+	"golang.org/x/net/context"
+)
+
+// Runs a meta lookup, a put and a get against the server at the given
+// address, and returns the value read back.
+func roundTrip(t *testing.T, addr *net.TCPAddr) string {
+	c, err := region.NewClient(addr.IP.String(), uint16(addr.Port), 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to connect: %s", err)
+	}
+	defer c.Close(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	call := func(reg *regioninfo.Info, rpc hrpc.Call) *hrpc.RPCResult {
+		rpc.SetRegion(reg)
+		if err := c.QueueRPC(rpc); err != nil {
+			t.Fatalf("Failed to queue RPC: %s", err)
+		}
+		res := <-rpc.GetResultChan()
+		if res.Error != nil {
+			t.Fatalf("%s RPC failed: %s", rpc.GetName(), res.Error)
+		}
+		return &res
+	}
+
+	meta := &regioninfo.Info{Table: []byte("hbase:meta"), RegionName: []byte("hbase:meta,,1")}
+	get, _ := hrpc.NewGetBefore(ctx, []byte("hbase:meta"), []byte("test,foo,:"))
+	cells := call(meta, get).Msg.(*pb.GetResponse).Result.Cell
+	reg, err := regioninfo.InfoFromCell(cells[0])
+	if err != nil {
+		t.Fatalf("Failed to decode the region info: %s", err)
+	}
+	if server := string(cells[1].Value); server != addr.String() {
+		t.Errorf("Expected the region to be located at %s, got %s", addr, server)
+	}
+
+	put, _ := hrpc.NewPutStr(ctx, "test", "foo",
+		map[string]map[string][]byte{"cf": {"a": []byte("bar")}})
+	call(reg, put)
+	get, _ = hrpc.NewGetStr(ctx, "test", "foo")
+	cells = call(reg, get).Msg.(*pb.GetResponse).Result.Cell
+	if len(cells) != 1 {
+		t.Fatalf("Expected 1 cell, got %v", cells)
+	}
+	return string(cells[0].Value)
+}
+
+func TestRecordReplay(t *testing.T) {
+	fake, err := fakehbase.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start the fake server: %s", err)
+	}
+	fake.CreateTable("test", []string{"cf"})
+	proxy, err := NewProxy("127.0.0.1:0",
+		net.JoinHostPort(fake.Host(), strconv.Itoa(int(fake.Port()))))
+	if err != nil {
+		t.Fatalf("Failed to start the proxy: %s", err)
+	}
+	if value := roundTrip(t, proxy.Addr()); value != "bar" {
+		t.Errorf("Expected to read back bar, got %q", value)
+	}
+	proxy.Close()
+	fake.Close()
+	if n := len(proxy.Recording().Exchanges()); n != 3 {
+		t.Errorf("Expected 3 RPCs recorded, got %d", n)
+	}
+
+	dir, err := ioutil.TempDir("", "rpcrecord")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "recording.json")
+	if err = proxy.Recording().Save(path); err != nil {
+		t.Fatalf("Failed to save the recording: %s", err)
+	}
+	rec, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load the recording: %s", err)
+	}
+
+	server, err := NewServer("127.0.0.1:0", rec)
+	if err != nil {
+		t.Fatalf("Failed to start the replay server: %s", err)
+	}
+	defer server.Close()
+	if value := roundTrip(t, server.Addr()); value != "bar" {
+		t.Errorf("Expected to replay bar, got %q", value)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package rpcrecord
+
+import (
+	"net"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/pb"
+)
+
+// Class of the exception sent for RPCs that weren't recorded.
+const notRecordedException = "java.io.IOException"
+
+// Server replays the responses of a Recording.  Each request gets the
+// response recorded for the same method and request, in the order they were
+// recorded.  Once all the responses to a request have been replayed, the last
+// one is repeated.
+type Server struct {
+	ln net.Listener
+
+	// Protects everything below.
+	m sync.Mutex
+	// Recorded exchanges, by method and request.
+	exchanges map[string][]Exchange
+	conns     map[net.Conn]struct{}
+}
+
+// NewServer creates a Server listening on the given address, which replays
+// the given recording.
+func NewServer(listen string, rec *Recording) (*Server, error) {
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:        ln,
+		exchanges: make(map[string][]Exchange),
+		conns:     make(map[net.Conn]struct{}),
+	}
+	for _, e := range rec.Exchanges() {
+		key := exchangeKey(e.Method, e.Request)
+		s.exchanges[key] = append(s.exchanges[key], e)
+	}
+	go s.serve()
+	return s, nil
+}
+
+func exchangeKey(method string, request []byte) string {
+	return method + "\x00" + string(request)
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() *net.TCPAddr {
+	return s.ln.Addr().(*net.TCPAddr)
+}
+
+// Close stops the server and closes all the connections to it.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+	s.m.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.m.Unlock()
+	return err
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.m.Lock()
+		s.conns[conn] = struct{}{}
+		s.m.Unlock()
+		go s.handleConn(conn)
+	}
+}
+
+// Returns the next exchange recorded for the given request, if any.
+func (s *Server) next(req *request) (Exchange, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	key := exchangeKey(req.method, req.param)
+	exchanges := s.exchanges[key]
+	if len(exchanges) == 0 {
+		return Exchange{}, false
+	}
+	e := exchanges[0]
+	if len(exchanges) > 1 {
+		s.exchanges[key] = exchanges[1:]
+	}
+	return e, true
+}
+
+func (s *Server) handleConn(conn net.Conn) {
+	defer func() {
+		s.m.Lock()
+		delete(s.conns, conn)
+		s.m.Unlock()
+		conn.Close()
+	}()
+	if _, err := readHello(conn); err != nil {
+		return
+	}
+	self := s.Addr().String()
+	metaScans := make(metaScanners)
+	for {
+		frame, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+		req, err := parseRequest(frame)
+		if err != nil {
+			return
+		}
+		header := &pb.ResponseHeader{}
+		response := []byte(nil)
+		if e, ok := s.next(req); ok {
+			if err = proto.Unmarshal(e.Header, header); err != nil {
+				return
+			}
+			response = e.Response
+			if metaScans.isMeta(req) && header.Exception == nil {
+				var scannerID uint64
+				response, scannerID, err = rewriteLocations(req.method, response, self)
+				if err != nil {
+					return
+				}
+				if req.method == "Scan" {
+					metaScans[scannerID] = struct{}{}
+				}
+			}
+		} else {
+			header.Exception = &pb.ExceptionResponse{
+				ExceptionClassName: proto.String(notRecordedException),
+				StackTrace: proto.String("no response recorded for " +
+					req.method + " RPC"),
+			}
+		}
+		header.CallId = &req.callID
+		headerData, err := proto.Marshal(header)
+		if err != nil {
+			return
+		}
+		if err = writeFrame(conn, delimited(headerData), response); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+// Package testutil helps running integration tests against a real HBase,
+// either a standalone instance found via the HBASE_HOME environment variable,
+// or one started in a Docker container.
+package testutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuna/gohbase"
+	"github.com/tsuna/gohbase/hrpc"
+	"golang.org/x/net/context"
+)
+
+// DefaultImage is the Docker image started when HBASE_HOME is unset and the
+// GOHBASE_DOCKER_IMAGE environment variable doesn't name another one.  It
+// must run a standalone HBase with ZooKeeper listening on port 2181.
+const DefaultImage = "harisekhon/hbase:1.1"
+
+// How long to wait for a freshly started HBase to become ready.
+const startTimeout = 2 * time.Minute
+
+// ErrNoHBase is returned when neither HBASE_HOME is set nor Docker available.
+var ErrNoHBase = errors.New("HBASE_HOME is not set and docker is not available")
+
+// Cluster is an HBase to run integration tests against.
+type Cluster struct {
+	// ZooKeeper quorum to give to gohbase.NewClient.
+	Quorum string
+
+	hbaseHome string
+	container string // ID of the container we started, if any.
+
+	// Protects tables.
+	m sync.Mutex
+	// Throwaway tables created, to drop on Close.
+	tables map[string]struct{}
+}
+
+// Start returns a Cluster using the standalone HBase of HBASE_HOME if set, or
+// starts one in Docker otherwise.  The caller must Close it once done.
+func Start() (*Cluster, error) {
+	c := &Cluster{
+		Quorum: "localhost",
+		tables: make(map[string]struct{}),
+	}
+	if c.hbaseHome = os.Getenv("HBASE_HOME"); c.hbaseHome != "" {
+		return c, nil
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		return nil, ErrNoHBase
+	}
+	image := os.Getenv("GOHBASE_DOCKER_IMAGE")
+	if image == "" {
+		image = DefaultImage
+	}
+	// The host network is used as the RegionServer advertises its hostname
+	// in ZooKeeper and meta, which must be reachable from the tests.
+	out, err := exec.Command("docker", "run", "-d", "--net=host", image).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s: %s", image, err)
+	}
+	c.container = strings.TrimSpace(string(out))
+	if err = c.waitReady(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Waits until the shell reports a live RegionServer.
+func (c *Cluster) waitReady() error {
+	deadline := time.Now().Add(startTimeout)
+	for {
+		out, err := c.Shell("status")
+		if err == nil && bytes.Contains(out, []byte("1 servers")) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("HBase wasn't ready after %s: %s", startTimeout, out)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// Shell runs the given commands in the HBase shell and returns its output.
+func (c *Cluster) Shell(commands ...string) ([]byte, error) {
+	var cmd *exec.Cmd
+	if c.container != "" {
+		cmd = exec.Command("docker", "exec", "-i", c.container, "hbase", "shell")
+	} else {
+		cmd = exec.Command(path.Join(c.hbaseHome, "bin", "hbase"), "shell")
+	}
+	cmd.Stdin = strings.NewReader(strings.Join(commands, "\n") + "\nexit\n")
+	return cmd.CombinedOutput()
+}
+
+// CreateTable creates the given table with the given families, dropping it
+// first if it already exists.
+func (c *Cluster) CreateTable(table string, families []string) error {
+	c.DeleteTable(table) // Drop the table in case it already exists
+	create := "create '" + table + "'"
+	for _, family := range families {
+		create += ", '" + family + "'"
+	}
+	out, err := c.Shell(create)
+	if err == nil && bytes.Contains(out, []byte("ERROR")) {
+		err = fmt.Errorf("failed to create table %s: %s", table, out)
+	}
+	return err
+}
+
+// DeleteTable disables and drops the given table.
+func (c *Cluster) DeleteTable(table string) error {
+	_, err := c.Shell("disable '"+table+"'", "drop '"+table+"'")
+	c.m.Lock()
+	delete(c.tables, table)
+	c.m.Unlock()
+	return err
+}
+
+// CreateTempTable creates a table with a random name and the given families,
+// which will be dropped on Close, and returns its name.
+func (c *Cluster) CreateTempTable(families []string) (string, error) {
+	var suffix [8]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return "", err
+	}
+	table := "gohbase_test_" + hex.EncodeToString(suffix[:])
+	if err := c.CreateTable(table, families); err != nil {
+		return "", err
+	}
+	c.m.Lock()
+	c.tables[table] = struct{}{}
+	c.m.Unlock()
+	return table, nil
+}
+
+// Close drops the throwaway tables and stops the container started, if any.
+func (c *Cluster) Close() error {
+	c.m.Lock()
+	tables := make([]string, 0, len(c.tables))
+	for table := range c.tables {
+		tables = append(tables, table)
+	}
+	c.m.Unlock()
+	var err error
+	if c.container != "" {
+		// The whole HBase goes away with the container.
+		err = exec.Command("docker", "rm", "-f", c.container).Run()
+		c.container = ""
+	} else {
+		for _, table := range tables {
+			if e := c.DeleteTable(table); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// Seed puts the given rows (row -> family -> qualifier -> value) in a table.
+func Seed(ctx context.Context, client gohbase.Client, table string,
+	rows map[string]map[string]map[string][]byte) error {
+	for key, values := range rows {
+		put, err := hrpc.NewPutStr(ctx, table, key, values)
+		if err != nil {
+			return err
+		}
+		if _, err = client.Put(put); err != nil {
+			return fmt.Errorf("failed to seed row %q of %s: %s", key, table, err)
+		}
+	}
+	return nil
+}
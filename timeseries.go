@@ -0,0 +1,431 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tsuna/gohbase/hrpc"
+	"golang.org/x/net/context"
+)
+
+// ErrWriterClosed is returned when writing to a TimeSeriesWriter that was
+// closed.
+var ErrWriterClosed = errors.New("writer closed")
+
+// Bounds of the delay between attempts to write a row that failed.
+const (
+	minWriteBackoff = 10 * time.Millisecond
+	maxWriteBackoff = 5 * time.Second
+)
+
+// TimeSeriesOption is a functional option used to configure a
+// TimeSeriesWriter.
+type TimeSeriesOption func(*TimeSeriesWriter)
+
+// TimeSeriesBufferSize will return an option that will set the maximum number
+// of bytes of keys and values buffered before Write blocks.
+func TimeSeriesBufferSize(bytes int) TimeSeriesOption {
+	return func(w *TimeSeriesWriter) {
+		w.maxBuffered = bytes
+	}
+}
+
+// TimeSeriesBatchSize will return an option that will set the maximum number of
+// rows of a region sent at the same time.
+func TimeSeriesBatchSize(rows int) TimeSeriesOption {
+	return func(w *TimeSeriesWriter) {
+		w.batchSize = rows
+	}
+}
+
+// TimeSeriesErrorHandler will return an option that will set the function
+// called when writing a row failed and will be retried.  By default failures
+// are logged.
+func TimeSeriesErrorHandler(handler func(key string, err error)) TimeSeriesOption {
+	return func(w *TimeSeriesWriter) {
+		w.onError = handler
+	}
+}
+
+// TimeSeriesWriter buffers rows and writes them in the background, for
+// ingestion workloads like time series and events where many rows are written
+// from a single process.
+//
+// Rows are buffered per region of the table, and each region's buffer is
+// flushed independently, in the order the rows were written: rows written
+// twice are always written in order, others are sent in batches.  Every row
+// is given a timestamp when it's written to the buffer, so that writing it
+// again after a failure yields the same cells.  Failures are retried until
+// the row is written or the writer is closed, which gives at-least-once
+// delivery for the rows written before a successful Flush or Close.
+//
+// The regions are those of the table when the writer is created.  Rows are
+// still written correctly after splits, just with less parallelism.
+type TimeSeriesWriter struct {
+	client Client
+	table  string
+
+	maxBuffered int
+	batchSize   int
+	onError     func(key string, err error)
+	journalDir  string
+
+	// Start keys of the regions, sorted, and buffer of each of them.
+	startKeys [][]byte
+	shards    []*timeSeriesShard
+
+	// Context of the Puts, canceled by Close.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// Protects everything below.
+	m        sync.Mutex
+	closed   bool
+	buffered int
+	// Sequence number of the last row written, and of the last timestamp
+	// assigned, to keep timestamps increasing.
+	seq    uint64
+	lastTs uint64
+	// Closed and replaced every time rows are written to HBase, to wake up
+	// the goroutines blocked in Write or Flush.
+	progress chan struct{}
+	// Journal of the rows not written yet, nil if disabled.
+	journal *timeSeriesJournal
+}
+
+// A row waiting to be written.
+type timeSeriesRow struct {
+	seq       uint64
+	key       string
+	values    map[string]map[string][]byte
+	timestamp uint64
+	size      int
+	// Segment of the journal the row is in, nil if there's no journal.
+	segment *journalSegment
+}
+
+// The buffer of a region.
+type timeSeriesShard struct {
+	// Rows waiting to be written, in order, protected by the writer's lock.
+	rows []*timeSeriesRow
+	// Receives a value when rows are added.
+	wake chan struct{}
+}
+
+// NewTimeSeriesWriter returns a writer writing rows to the given table.
+func NewTimeSeriesWriter(ctx context.Context, c Client, table string,
+	options ...TimeSeriesOption) (*TimeSeriesWriter, error) {
+	rows, err := scanTableMeta(ctx, c, table)
+	if err != nil {
+		return nil, err
+	}
+	w := &TimeSeriesWriter{
+		client:      c,
+		table:       table,
+		maxBuffered: 64 * 1024 * 1024,
+		batchSize:   1000,
+		onError: func(key string, err error) {
+			log.WithFields(log.Fields{
+				"Table": table,
+				"Key":   key,
+				"Error": err,
+			}).Warn("Failed to write a row, retrying")
+		},
+		progress: make(chan struct{}),
+	}
+	for _, option := range options {
+		option(w)
+	}
+	for _, row := range rows {
+		reg, _, _, err := parseMetaRow(row)
+		if err != nil {
+			return nil, err
+		}
+		w.startKeys = append(w.startKeys, reg.StartKey)
+	}
+	sort.Sort(byteSlices(w.startKeys))
+	for range w.startKeys {
+		w.shards = append(w.shards, &timeSeriesShard{wake: make(chan struct{}, 1)})
+	}
+	if w.journalDir != "" {
+		if err = w.recover(); err != nil {
+			return nil, err
+		}
+	}
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	for _, shard := range w.shards {
+		w.wg.Add(1)
+		go w.flushShard(shard)
+	}
+	return w, nil
+}
+
+// Opens the journal and buffers the rows left in it, which are added to new
+// segments before the old ones are deleted.
+func (w *TimeSeriesWriter) recover() error {
+	journal, rows, paths, err := openJournal(w.journalDir)
+	if err != nil {
+		return err
+	}
+	w.journal = journal
+	for _, row := range rows {
+		if err = w.enqueue(row); err != nil {
+			w.journal.close()
+			return err
+		}
+		if row.timestamp > w.lastTs {
+			w.lastTs = row.timestamp
+		}
+	}
+	for _, path := range paths {
+		if err = os.Remove(path); err != nil {
+			w.journal.close()
+			return err
+		}
+	}
+	return nil
+}
+
+type byteSlices [][]byte
+
+func (b byteSlices) Len() int           { return len(b) }
+func (b byteSlices) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byteSlices) Less(i, j int) bool { return bytes.Compare(b[i], b[j]) < 0 }
+
+// Returns the buffer of the region of the given key.
+func (w *TimeSeriesWriter) shardFor(key string) *timeSeriesShard {
+	i := sort.Search(len(w.startKeys), func(i int) bool {
+		return bytes.Compare(w.startKeys[i], []byte(key)) > 0
+	})
+	if i > 0 {
+		i--
+	}
+	return w.shards[i]
+}
+
+// Wakes up the goroutines waiting for progress.  Must be called with the lock
+// held.
+func (w *TimeSeriesWriter) notifyProgress() {
+	close(w.progress)
+	w.progress = make(chan struct{})
+}
+
+// Write buffers the given values to be written in the given row, and returns
+// the timestamp, in milliseconds since the epoch, given to their cells.  It
+// blocks while the buffer is full, until the context is done.
+func (w *TimeSeriesWriter) Write(ctx context.Context, key string,
+	values map[string]map[string][]byte) (uint64, error) {
+	size := rowSize(key, values)
+	w.m.Lock()
+	// A row larger than the buffer is accepted once the buffer is empty.
+	for !w.closed && w.buffered > 0 && w.buffered+size > w.maxBuffered {
+		progress := w.progress
+		w.m.Unlock()
+		select {
+		case <-progress:
+		case <-ctx.Done():
+			return 0, ErrDeadline
+		}
+		w.m.Lock()
+	}
+	if w.closed {
+		w.m.Unlock()
+		return 0, ErrWriterClosed
+	}
+	ts := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	if ts < w.lastTs {
+		ts = w.lastTs // The clock went back.
+	}
+	err := w.enqueue(&timeSeriesRow{
+		key:       key,
+		values:    values,
+		timestamp: ts,
+		size:      size,
+	})
+	if err != nil {
+		w.m.Unlock()
+		return 0, err
+	}
+	w.lastTs = ts
+	w.m.Unlock()
+	return ts, nil
+}
+
+// Returns the number of bytes of the keys and values of a row.
+func rowSize(key string, values map[string]map[string][]byte) int {
+	size := len(key)
+	for family, qualifiers := range values {
+		for qualifier, value := range qualifiers {
+			size += len(family) + len(qualifier) + len(value)
+		}
+	}
+	return size
+}
+
+// Adds a row to the journal, if any, and to the buffer of its region.  Must be
+// called with the lock held.
+func (w *TimeSeriesWriter) enqueue(row *timeSeriesRow) error {
+	if w.journal != nil {
+		if err := w.journal.append(row); err != nil {
+			return err
+		}
+	}
+	w.seq++
+	row.seq = w.seq
+	shard := w.shardFor(row.key)
+	shard.rows = append(shard.rows, row)
+	w.buffered += row.size
+	select {
+	case shard.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Returns the next rows of the given region to write: up to batchSize rows
+// from the head of its buffer, stopping before a row that's already in the
+// batch.
+func (w *TimeSeriesWriter) nextBatch(shard *timeSeriesShard) []*timeSeriesRow {
+	w.m.Lock()
+	defer w.m.Unlock()
+	keys := make(map[string]struct{})
+	n := 0
+	for n < len(shard.rows) && n < w.batchSize {
+		key := shard.rows[n].key
+		if _, ok := keys[key]; ok {
+			break
+		}
+		keys[key] = struct{}{}
+		n++
+	}
+	return shard.rows[:n:n]
+}
+
+// Writes the rows buffered for a region until the writer is closed.
+func (w *TimeSeriesWriter) flushShard(shard *timeSeriesShard) {
+	defer w.wg.Done()
+	for {
+		batch := w.nextBatch(shard)
+		if len(batch) == 0 {
+			select {
+			case <-shard.wake:
+				continue
+			case <-w.ctx.Done():
+				return
+			}
+		}
+		var wg sync.WaitGroup
+		for _, row := range batch {
+			wg.Add(1)
+			go func(row *timeSeriesRow) {
+				defer wg.Done()
+				w.writeRow(row)
+			}(row)
+		}
+		wg.Wait()
+		if w.ctx.Err() != nil {
+			return
+		}
+		w.m.Lock()
+		shard.rows = shard.rows[len(batch):]
+		for _, row := range batch {
+			w.buffered -= row.size
+			if w.journal != nil {
+				w.journal.done(row)
+			}
+		}
+		w.notifyProgress()
+		w.m.Unlock()
+	}
+}
+
+// Writes a row, retrying until it's written or the writer is closed.
+func (w *TimeSeriesWriter) writeRow(row *timeSeriesRow) {
+	backoff := minWriteBackoff
+	for {
+		put, err := hrpc.NewPutStr(w.ctx, w.table, row.key, row.values)
+		if err == nil {
+			put.SetTimestamp(row.timestamp)
+			if _, err = w.client.Put(put); err == nil {
+				return
+			}
+		}
+		if w.ctx.Err() != nil {
+			return
+		}
+		w.onError(row.key, err)
+		select {
+		case <-time.After(backoff):
+		case <-w.ctx.Done():
+			return
+		}
+		if backoff *= 2; backoff > maxWriteBackoff {
+			backoff = maxWriteBackoff
+		}
+	}
+}
+
+// Returns true if all the rows up to the given sequence number were written.
+// Must be called with the lock held.
+func (w *TimeSeriesWriter) writtenUpTo(seq uint64) bool {
+	for _, shard := range w.shards {
+		if len(shard.rows) > 0 && shard.rows[0].seq <= seq {
+			return false
+		}
+	}
+	return true
+}
+
+// Flush blocks until all the rows written before it are written to HBase, or
+// the context is done.
+func (w *TimeSeriesWriter) Flush(ctx context.Context) error {
+	w.m.Lock()
+	seq := w.seq
+	for !w.writtenUpTo(seq) {
+		progress := w.progress
+		w.m.Unlock()
+		select {
+		case <-progress:
+		case <-ctx.Done():
+			return ErrDeadline
+		}
+		w.m.Lock()
+	}
+	w.m.Unlock()
+	return nil
+}
+
+// Close flushes the buffered rows and stops the writer.  If the context is
+// done before all the rows are written, the remaining ones are dropped, unless
+// they're in the journal, and ErrDeadline is returned.
+func (w *TimeSeriesWriter) Close(ctx context.Context) error {
+	w.m.Lock()
+	if w.closed {
+		w.m.Unlock()
+		return ErrWriterClosed
+	}
+	w.closed = true
+	// Writers blocked on a full buffer give up.
+	w.notifyProgress()
+	w.m.Unlock()
+	err := w.Flush(ctx)
+	w.cancel()
+	w.wg.Wait()
+	if w.journal != nil {
+		w.m.Lock()
+		w.journal.close()
+		w.m.Unlock()
+	}
+	return err
+}
@@ -0,0 +1,195 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"golang.org/x/net/context"
+)
+
+func TestTimeSeriesWriter(t *testing.T) {
+	_, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+
+	w, err := NewTimeSeriesWriter(ctx, c, "test", TimeSeriesBatchSize(7))
+	if err != nil {
+		t.Fatalf("NewTimeSeriesWriter failed: %s", err)
+	}
+	timestamps := make(map[string]uint64)
+	for i := 0; i < 100; i++ {
+		// Rows written several times must end up with the last value.
+		key := fmt.Sprintf("row%d", i%30)
+		ts, err := w.Write(ctx, key, map[string]map[string][]byte{
+			"cf": {"v": []byte(fmt.Sprint(i))},
+		})
+		if err != nil {
+			t.Fatalf("Write failed: %s", err)
+		}
+		timestamps[key] = ts
+	}
+	if err = w.Flush(ctx); err != nil {
+		t.Fatalf("Flush failed: %s", err)
+	}
+	for i := 70; i < 100; i++ {
+		key := fmt.Sprintf("row%d", i%30)
+		get, _ := hrpc.NewGetStr(ctx, "test", key)
+		resp, err := c.Get(get)
+		if err != nil {
+			t.Fatalf("Get failed: %s", err)
+		}
+		if len(resp.Result.Cell) != 1 {
+			t.Fatalf("Expected 1 cell in %s, got %v", key, resp.Result)
+		}
+		cell := resp.Result.Cell[0]
+		if string(cell.Value) != fmt.Sprint(i) || cell.GetTimestamp() != timestamps[key] {
+			t.Errorf("Expected %d at %d in %s, got %s at %d", i, timestamps[key], key,
+				cell.Value, cell.GetTimestamp())
+		}
+	}
+	if err = w.Close(ctx); err != nil {
+		t.Errorf("Close failed: %s", err)
+	}
+	if _, err = w.Write(ctx, "row", nil); err != ErrWriterClosed {
+		t.Errorf("Expected ErrWriterClosed, got %v", err)
+	}
+}
+
+func TestTimeSeriesWriterRetries(t *testing.T) {
+	_, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+
+	failures := make(chan string, 100)
+	w, err := NewTimeSeriesWriter(ctx, c, "test", TimeSeriesBufferSize(10),
+		TimeSeriesErrorHandler(func(key string, err error) {
+			failures <- key
+		}))
+	if err != nil {
+		t.Fatalf("NewTimeSeriesWriter failed: %s", err)
+	}
+	// The family doesn't exist, so the row is retried forever.
+	if _, err = w.Write(ctx, "row", map[string]map[string][]byte{
+		"nope": {"v": []byte("1")},
+	}); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	if key := <-failures; key != "row" {
+		t.Errorf("Expected a failure for row, got %s", key)
+	}
+
+	// The buffer is full.
+	shortCtx, shortCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer shortCancel()
+	if _, err = w.Write(shortCtx, "row2", nil); err != ErrDeadline {
+		t.Errorf("Expected ErrDeadline on a full buffer, got %v", err)
+	}
+	if err = w.Flush(shortCtx); err != ErrDeadline {
+		t.Errorf("Expected ErrDeadline flushing, got %v", err)
+	}
+	if err = w.Close(shortCtx); err != ErrDeadline {
+		t.Errorf("Expected ErrDeadline closing, got %v", err)
+	}
+}
+
+func TestTimeSeriesWriterJournal(t *testing.T) {
+	s, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+	dir, err := ioutil.TempDir("", "gohbase")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	failures := make(chan string, 100)
+	w, err := NewTimeSeriesWriter(ctx, c, "test", TimeSeriesJournal(dir),
+		TimeSeriesErrorHandler(func(key string, err error) {
+			failures <- key
+		}))
+	if err != nil {
+		t.Fatalf("NewTimeSeriesWriter failed: %s", err)
+	}
+	// The family doesn't exist yet, so the row can't be written.
+	ts, err := w.Write(ctx, "row", map[string]map[string][]byte{
+		"new": {"v": []byte("1")},
+	})
+	if err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	if _, err = w.Write(ctx, "other", map[string]map[string][]byte{
+		"cf": {"v": []byte("2")},
+	}); err != nil {
+		t.Fatalf("Write failed: %s", err)
+	}
+	<-failures
+	shortCtx, shortCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer shortCancel()
+	if err = w.Close(shortCtx); err != ErrDeadline {
+		t.Fatalf("Expected ErrDeadline closing, got %v", err)
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+journalSuffix))
+	if len(segments) != 1 {
+		t.Fatalf("Expected a journal segment, got %v", segments)
+	}
+	// A record partly written when the process crashed is ignored.
+	f, err := os.OpenFile(segments[0], os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 1, 0, 42})
+	f.Close()
+
+	// The row is written once the family exists.
+	s.CreateTable("test", []string{"cf", "new"})
+	w, err = NewTimeSeriesWriter(ctx, c, "test", TimeSeriesJournal(dir))
+	if err != nil {
+		t.Fatalf("NewTimeSeriesWriter failed: %s", err)
+	}
+	if err = w.Close(ctx); err != nil {
+		t.Fatalf("Close failed: %s", err)
+	}
+	get, _ := hrpc.NewGetStr(ctx, "test", "row")
+	resp, err := c.Get(get)
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	if len(resp.Result.Cell) != 1 || string(resp.Result.Cell[0].Value) != "1" ||
+		resp.Result.Cell[0].GetTimestamp() != ts {
+		t.Errorf("Expected 1 at %d, got %v", ts, resp.Result)
+	}
+	if segments, _ = filepath.Glob(filepath.Join(dir, "*")); len(segments) != 0 {
+		t.Errorf("Expected the journal to be empty, got %v", segments)
+	}
+}
+
+func TestJournalRecord(t *testing.T) {
+	row := &timeSeriesRow{
+		key: "row",
+		values: map[string]map[string][]byte{
+			"cf":  {"a": []byte("1"), "b": nil},
+			"cf2": {"c": []byte("3")},
+		},
+		timestamp: 42,
+	}
+	record := encodeJournalRecord(row)
+	decoded, err := decodeJournalRecord(record[8:])
+	if err != nil {
+		t.Fatalf("Failed to decode the record: %s", err)
+	}
+	if decoded.key != "row" || decoded.timestamp != 42 ||
+		len(decoded.values) != 2 || string(decoded.values["cf"]["a"]) != "1" ||
+		len(decoded.values["cf"]["b"]) != 0 || string(decoded.values["cf2"]["c"]) != "3" {
+		t.Errorf("Expected %+v, got %+v", row, decoded)
+	}
+	if _, err = decodeJournalRecord(record[8 : len(record)-1]); err != errCorruptJournal {
+		t.Errorf("Expected errCorruptJournal for a truncated record, got %v", err)
+	}
+}
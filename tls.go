@@ -0,0 +1,129 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/tsuna/gohbase/region"
+)
+
+// TLS will return an option that will make the client connect to the
+// RegionServers and the Master over TLS, with the given configuration.  For
+// mutual TLS, set its Certificates, or its GetClientCertificate to present a
+// certificate that can be rotated, e.g. with a KeyPairReloader.
+func TLS(config *tls.Config) Option {
+	return TLSConfigFunc(func() (*tls.Config, error) {
+		return config, nil
+	})
+}
+
+// TLSConfigFunc will return an option that will make the client connect to
+// the RegionServers and the Master over TLS, with the configuration returned
+// by the given function.  It's called every time a connection is
+// established, so that everything from the certificates trusted to those
+// presented can change without dropping the connections already established.
+func TLSConfigFunc(config func() (*tls.Config, error)) Option {
+	return func(c *client) {
+		c.regionOptions = append(c.regionOptions, region.TLS(config))
+	}
+}
+
+// A KeyPairReloader provides a certificate and its private key loaded from
+// PEM files, which are loaded again once they change, so that they can be
+// rotated without restarting.  The files are only checked when a connection
+// is established, at most once per interval.  While the files can't be
+// loaded, e.g. when only one of them was replaced yet, the previous pair is
+// kept.
+type KeyPairReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+
+	// Protects everything below.
+	m sync.Mutex
+
+	cert *tls.Certificate
+	// Time the files loaded were last modified.
+	modTime time.Time
+	// Last time the files were checked.
+	checked time.Time
+}
+
+// NewKeyPairReloader loads the given certificate and key files, and returns a
+// KeyPairReloader checking them for changes at most once per interval.
+func NewKeyPairReloader(certFile, keyFile string, interval time.Duration) (*KeyPairReloader, error) {
+	r := &KeyPairReloader{certFile: certFile, keyFile: keyFile, interval: interval}
+	modTime, err := r.modified()
+	if err != nil {
+		return nil, err
+	}
+	if err = r.load(modTime); err != nil {
+		return nil, err
+	}
+	r.checked = time.Now()
+	return r, nil
+}
+
+// Returns the time the last of the files was modified.
+func (r *KeyPairReloader) modified() (time.Time, error) {
+	var modTime time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime, nil
+}
+
+// Loads the key pair, last modified at the given time.
+func (r *KeyPairReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// Certificate returns the current key pair, loading the files again first if
+// they changed since they were last checked.
+func (r *KeyPairReloader) Certificate() *tls.Certificate {
+	r.m.Lock()
+	defer r.m.Unlock()
+	now := time.Now()
+	if now.Sub(r.checked) < r.interval {
+		return r.cert
+	}
+	r.checked = now
+	modTime, err := r.modified()
+	if err == nil && !modTime.Equal(r.modTime) {
+		err = r.load(modTime)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"Cert":  r.certFile,
+			"Key":   r.keyFile,
+			"Error": err,
+		}).Warn("Failed to reload the TLS key pair, keeping the previous one")
+	}
+	return r.cert
+}
+
+// GetClientCertificate returns the current key pair, and is meant to be used
+// as the GetClientCertificate function of a tls.Config.
+func (r *KeyPairReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
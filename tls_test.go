@@ -0,0 +1,114 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Writes a self-signed certificate with the given common name and its key to
+// the given files, and sets their modification time.
+func writeKeyPair(t *testing.T, certFile, keyFile, name string, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate a key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create a certificate: %s", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal the key: %s", err)
+	}
+	err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err == nil {
+		err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	}
+	if err != nil {
+		t.Fatalf("Failed to write the key pair: %s", err)
+	}
+	for _, file := range []string{certFile, keyFile} {
+		if err = os.Chtimes(file, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set the modification time of %s: %s", file, err)
+		}
+	}
+}
+
+func TestKeyPairReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohbase")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	modTime := time.Now().Add(-time.Hour)
+	writeKeyPair(t, certFile, keyFile, "first", modTime)
+
+	r, err := NewKeyPairReloader(certFile, keyFile, 0)
+	if err != nil {
+		t.Fatalf("NewKeyPairReloader failed: %s", err)
+	}
+	name := func() string {
+		cert, err := r.GetClientCertificate(nil)
+		if err != nil {
+			t.Fatalf("GetClientCertificate failed: %s", err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("Failed to parse the certificate: %s", err)
+		}
+		return leaf.Subject.CommonName
+	}
+	if n := name(); n != "first" {
+		t.Errorf("Expected the first certificate, got %q", n)
+	}
+
+	modTime = modTime.Add(time.Minute)
+	writeKeyPair(t, certFile, keyFile, "second", modTime)
+	if n := name(); n != "second" {
+		t.Errorf("Expected the rotated certificate, got %q", n)
+	}
+
+	// A key pair that can't be loaded is ignored.
+	if err = ioutil.WriteFile(keyFile, []byte("garbage"), 0600); err != nil {
+		t.Fatalf("Failed to write the key: %s", err)
+	}
+	if err = os.Chtimes(keyFile, modTime.Add(time.Minute), modTime.Add(time.Minute)); err != nil {
+		t.Fatalf("Failed to set the modification time of the key: %s", err)
+	}
+	if n := name(); n != "second" {
+		t.Errorf("Expected the previous certificate to be kept, got %q", n)
+	}
+
+	// The files are only checked once per interval.
+	r.interval = time.Hour
+	writeKeyPair(t, certFile, keyFile, "third", modTime.Add(2*time.Minute))
+	if n := name(); n != "second" {
+		t.Errorf("Expected the files not to be checked again yet, got %q", n)
+	}
+	if _, err = NewKeyPairReloader(filepath.Join(dir, "missing.crt"), keyFile, 0); err == nil {
+		t.Error("Expected an error for a missing certificate")
+	}
+}
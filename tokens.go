@@ -0,0 +1,247 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/tsuna/gohbase/region"
+)
+
+// HBaseTokenKind is the kind of the delegation tokens of HBase.
+const HBaseTokenKind = "HBASE_AUTH_TOKEN"
+
+// Magic number and versions of Hadoop's token storage files.
+const (
+	tokenStorageMagic = "HDTS"
+
+	tokenStorageWritable = 0
+	tokenStorageProtobuf = 1
+)
+
+var errTruncatedTokenStorage = errors.New("truncated token storage")
+
+// ReadTokenStorage returns the tokens of a Hadoop token storage file, such as
+// the one HADOOP_TOKEN_FILE_LOCATION points to in the containers of batch
+// jobs.  Both the Writable and the protobuf formats are supported.
+func ReadTokenStorage(data []byte) ([]*Token, error) {
+	if !bytes.HasPrefix(data, []byte(tokenStorageMagic)) {
+		return nil, errors.New("not a token storage file")
+	}
+	data = data[len(tokenStorageMagic):]
+	if len(data) == 0 {
+		return nil, errTruncatedTokenStorage
+	}
+	switch data[0] {
+	case tokenStorageWritable:
+		return readWritableTokens(data[1:])
+	case tokenStorageProtobuf:
+		storage := &credentialsProto{}
+		if err := proto.NewBuffer(data[1:]).DecodeMessage(storage); err != nil {
+			return nil, fmt.Errorf("invalid token storage: %s", err)
+		}
+		var tokens []*Token
+		for _, kv := range storage.Tokens {
+			if t := kv.Token; t != nil {
+				tokens = append(tokens, &Token{
+					Identifier: t.Identifier,
+					Password:   t.Password,
+					Kind:       t.GetKind(),
+					Service:    t.GetService(),
+				})
+			}
+		}
+		return tokens, nil
+	}
+	return nil, fmt.Errorf("unsupported token storage version %d", data[0])
+}
+
+// Reads the tokens of a token storage file in the Writable format: their
+// number, then each of them along with its alias.  The secret keys that
+// follow are ignored.
+func readWritableTokens(data []byte) ([]*Token, error) {
+	r := &writableReader{buf: data}
+	n := r.readVLong()
+	if n < 0 {
+		return nil, fmt.Errorf("invalid number of tokens %d", n)
+	}
+	var tokens []*Token
+	for i := int64(0); i < n && r.err == nil; i++ {
+		r.readBytes() // Alias.
+		tokens = append(tokens, &Token{
+			Identifier: r.readBytes(),
+			Password:   r.readBytes(),
+			Kind:       string(r.readBytes()),
+			Service:    string(r.readBytes()),
+		})
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return tokens, nil
+}
+
+// writableReader decodes what Hadoop serializes with WritableUtils, keeping
+// the first error encountered.
+type writableReader struct {
+	buf []byte
+	err error
+}
+
+// readVLong reads a variable-length integer.
+func (r *writableReader) readVLong() int64 {
+	if r.err != nil {
+		return 0
+	} else if len(r.buf) == 0 {
+		r.err = errTruncatedTokenStorage
+		return 0
+	}
+	first := int8(r.buf[0])
+	r.buf = r.buf[1:]
+	if first >= -112 {
+		return int64(first)
+	}
+	// The first byte is followed by the big-endian integer, whose number of
+	// bytes and sign it encodes.
+	negative := first < -120
+	size := -112 - int(first)
+	if negative {
+		size = -120 - int(first)
+	}
+	if len(r.buf) < size {
+		r.err = errTruncatedTokenStorage
+		return 0
+	}
+	var n int64
+	for _, v := range r.buf[:size] {
+		n = n<<8 | int64(v)
+	}
+	r.buf = r.buf[size:]
+	if negative {
+		n = ^n
+	}
+	return n
+}
+
+// readBytes reads a byte array or a Text: its length, then its bytes.
+func (r *writableReader) readBytes() []byte {
+	n := r.readVLong()
+	if r.err != nil {
+		return nil
+	} else if n < 0 || n > int64(len(r.buf)) {
+		r.err = errTruncatedTokenStorage
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+// SelectToken returns the HBase delegation token of the cluster with the
+// given ID among the given tokens, nil if there's none.
+func SelectToken(tokens []*Token, clusterID string) *Token {
+	for _, t := range tokens {
+		if t.Kind == HBaseTokenKind && t.Service == clusterID {
+			return t
+		}
+	}
+	return nil
+}
+
+// A TokenStorageCredentialProvider provides the HBase delegation token found
+// in a Hadoop token storage file for the cluster, so that batch jobs that were
+// handed tokens can authenticate without Kerberos.  The file is read every
+// time credentials are needed.
+type TokenStorageCredentialProvider struct {
+	// Path of the token storage file, the value of the
+	// HADOOP_TOKEN_FILE_LOCATION environment variable if empty.
+	File string
+}
+
+// GetSASLCredentials implements CredentialProvider.
+func (p *TokenStorageCredentialProvider) GetSASLCredentials() (*region.SASLCredentials, error) {
+	return nil, nil
+}
+
+// GetTLSCertificates implements CredentialProvider.
+func (p *TokenStorageCredentialProvider) GetTLSCertificates() ([]tls.Certificate, error) {
+	return nil, nil
+}
+
+// GetToken implements CredentialProvider.  It's nil if the file has no HBase
+// token for the cluster.
+func (p *TokenStorageCredentialProvider) GetToken(service string) (*Token, error) {
+	file := p.File
+	if file == "" {
+		if file = os.Getenv("HADOOP_TOKEN_FILE_LOCATION"); file == "" {
+			return nil, nil
+		}
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := ReadTokenStorage(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the tokens of %s: %s", file, err)
+	}
+	return SelectToken(tokens, service), nil
+}
+
+// Messages of the protobuf format of token storage files (Security.proto and
+// Credentials.proto of Hadoop).
+type credentialsProto struct {
+	Tokens           []*credentialsKVProto `protobuf:"bytes,1,rep,name=tokens" json:"tokens,omitempty"`
+	Secrets          []*credentialsKVProto `protobuf:"bytes,2,rep,name=secrets" json:"secrets,omitempty"`
+	XXX_unrecognized []byte                `json:"-"`
+}
+
+func (m *credentialsProto) Reset()         { *m = credentialsProto{} }
+func (m *credentialsProto) String() string { return proto.CompactTextString(m) }
+func (*credentialsProto) ProtoMessage()    {}
+
+type credentialsKVProto struct {
+	Alias            *string     `protobuf:"bytes,1,req,name=alias" json:"alias,omitempty"`
+	Token            *tokenProto `protobuf:"bytes,2,opt,name=token" json:"token,omitempty"`
+	Secret           []byte      `protobuf:"bytes,3,opt,name=secret" json:"secret,omitempty"`
+	XXX_unrecognized []byte      `json:"-"`
+}
+
+func (m *credentialsKVProto) Reset()         { *m = credentialsKVProto{} }
+func (m *credentialsKVProto) String() string { return proto.CompactTextString(m) }
+func (*credentialsKVProto) ProtoMessage()    {}
+
+type tokenProto struct {
+	Identifier       []byte  `protobuf:"bytes,1,req,name=identifier" json:"identifier,omitempty"`
+	Password         []byte  `protobuf:"bytes,2,req,name=password" json:"password,omitempty"`
+	Kind             *string `protobuf:"bytes,3,req,name=kind" json:"kind,omitempty"`
+	Service          *string `protobuf:"bytes,4,req,name=service" json:"service,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *tokenProto) Reset()         { *m = tokenProto{} }
+func (m *tokenProto) String() string { return proto.CompactTextString(m) }
+func (*tokenProto) ProtoMessage()    {}
+
+func (m *tokenProto) GetKind() string {
+	if m != nil && m.Kind != nil {
+		return *m.Kind
+	}
+	return ""
+}
+
+func (m *tokenProto) GetService() string {
+	if m != nil && m.Service != nil {
+		return *m.Service
+	}
+	return ""
+}
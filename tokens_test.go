@@ -0,0 +1,142 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Appends to buf a byte array as serialized by Hadoop's WritableUtils, for
+// arrays shorter than 113 bytes.
+func appendWritableBytes(buf []byte, b string) []byte {
+	return append(append(buf, byte(len(b))), b...)
+}
+
+// Returns a token storage file in the Writable format holding the given
+// tokens.
+func writableTokenStorage(tokens ...*Token) []byte {
+	buf := []byte("HDTS\x00")
+	buf = append(buf, byte(len(tokens)))
+	for _, t := range tokens {
+		buf = appendWritableBytes(buf, t.Service) // Alias.
+		buf = appendWritableBytes(buf, string(t.Identifier))
+		buf = appendWritableBytes(buf, string(t.Password))
+		buf = appendWritableBytes(buf, t.Kind)
+		buf = appendWritableBytes(buf, t.Service)
+	}
+	// A secret key.
+	buf = append(buf, 1)
+	buf = appendWritableBytes(buf, "key")
+	return appendWritableBytes(buf, "secret")
+}
+
+func TestReadTokenStorage(t *testing.T) {
+	hdfs := &Token{Identifier: []byte("hdfs-id"), Password: []byte("hdfs-password"),
+		Kind: "HDFS_DELEGATION_TOKEN", Service: "namenode:8020"}
+	other := &Token{Identifier: []byte("other-id"), Password: []byte("other-password"),
+		Kind: HBaseTokenKind, Service: "other-cluster"}
+	hbase := &Token{Identifier: []byte("hbase-id"), Password: []byte("hbase-password"),
+		Kind: HBaseTokenKind, Service: "cluster"}
+
+	storage := &credentialsProto{Secrets: []*credentialsKVProto{
+		{Alias: proto.String("key"), Secret: []byte("secret")},
+	}}
+	for _, t := range []*Token{hdfs, other, hbase} {
+		storage.Tokens = append(storage.Tokens, &credentialsKVProto{
+			Alias: proto.String(t.Service),
+			Token: &tokenProto{Identifier: t.Identifier, Password: t.Password,
+				Kind: proto.String(t.Kind), Service: proto.String(t.Service)},
+		})
+	}
+	buf := proto.NewBuffer([]byte("HDTS\x01"))
+	if err := buf.EncodeMessage(storage); err != nil {
+		t.Fatalf("Failed to encode the token storage: %s", err)
+	}
+
+	for name, data := range map[string][]byte{
+		"writable": writableTokenStorage(hdfs, other, hbase),
+		"protobuf": buf.Bytes(),
+	} {
+		tokens, err := ReadTokenStorage(data)
+		if err != nil {
+			t.Errorf("%s: failed to read the tokens: %s", name, err)
+			continue
+		}
+		if len(tokens) != 3 {
+			t.Errorf("%s: expected 3 tokens, got %d", name, len(tokens))
+			continue
+		}
+		token := SelectToken(tokens, "cluster")
+		if token == nil || string(token.Identifier) != "hbase-id" ||
+			string(token.Password) != "hbase-password" {
+			t.Errorf("%s: unexpected token for the cluster %+v", name, token)
+		}
+		if token = SelectToken(tokens, "namenode:8020"); token != nil {
+			t.Errorf("%s: expected no HBase token for the NameNode, got %+v", name, token)
+		}
+	}
+
+	for _, data := range []string{"", "HDTS", "HDTS\x02", "HDTS\x00\x01\x01a\x05id"} {
+		if _, err := ReadTokenStorage([]byte(data)); err == nil {
+			t.Errorf("Expected an error for the token storage %q", data)
+		}
+	}
+}
+
+func TestTokenStorageCredentialProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gohbase")
+	if err != nil {
+		t.Fatalf("Failed to create a temporary directory: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "container_tokens")
+	ioutil.WriteFile(file, writableTokenStorage(&Token{Identifier: []byte("id"),
+		Password: []byte("password"), Kind: HBaseTokenKind,
+		Service: "00000000-0000-0000-0000-000000000000"}), 0600)
+
+	defer os.Setenv("HADOOP_TOKEN_FILE_LOCATION", os.Getenv("HADOOP_TOKEN_FILE_LOCATION"))
+	os.Setenv("HADOOP_TOKEN_FILE_LOCATION", file)
+	p := &TokenStorageCredentialProvider{}
+	creds, err := saslCredentials(p, testClusterID)
+	if err != nil || creds.Username != "aWQ=" || string(creds.Password) != "cGFzc3dvcmQ=" {
+		t.Errorf("Unexpected SASL credentials %+v, %v", creds, err)
+	}
+	// Without a token for the cluster, the client connects with simple
+	// authentication.
+	if creds, err = saslCredentials(p, func() (string, error) {
+		return "other-cluster", nil
+	}); creds != nil || err != nil {
+		t.Errorf("Expected no SASL credentials, got %+v, %v", creds, err)
+	}
+	p.File = filepath.Join(dir, "missing")
+	if _, err = p.GetToken("cluster"); err == nil {
+		t.Error("Expected an error for a missing token storage file")
+	}
+}
+
+func TestGetClusterID(t *testing.T) {
+	savedReadClusterID := readClusterID
+	defer func() { readClusterID = savedReadClusterID }()
+	var reads int
+	readClusterID = func(zkquorum string) (string, error) {
+		reads++
+		return "cluster", nil
+	}
+	c := newClient("~invalid.quorum~")
+	for i := 0; i < 2; i++ {
+		if id, err := c.getClusterID(); id != "cluster" || err != nil {
+			t.Errorf("Unexpected cluster ID %q, %v", id, err)
+		}
+	}
+	if reads != 1 {
+		t.Errorf("Expected the cluster ID to be read once, got %d reads", reads)
+	}
+}
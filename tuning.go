@@ -0,0 +1,63 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import "time"
+
+// SetRpcQueueSize changes the size of the RPC queues of the connections to
+// the RegionServers, both those already open and those opened from now on.
+// Smaller queues are flushed more often, trading throughput for latency.
+// With the SharedRegionClients option, the connections shared with other
+// clients are affected too.
+func (c *client) SetRpcQueueSize(size int) {
+	c.tuningLock.Lock()
+	c.rpcQueueSize = size
+	c.tuningLock.Unlock()
+	c.eachRegionClient(func(client RegionClient) {
+		client.SetQueueSize(size)
+	})
+}
+
+// SetFlushInterval changes how long RPCs may wait in the queues of the
+// connections to the RegionServers before being sent, both for those already
+// open and those opened from now on.  With the SharedRegionClients option,
+// the connections shared with other clients are affected too.
+func (c *client) SetFlushInterval(interval time.Duration) {
+	c.tuningLock.Lock()
+	c.flushInterval = interval
+	c.tuningLock.Unlock()
+	c.eachRegionClient(func(client RegionClient) {
+		client.SetFlushInterval(interval)
+	})
+}
+
+// Returns the queue size and flush interval of new region clients.
+func (c *client) queueTuning() (int, time.Duration) {
+	c.tuningLock.Lock()
+	defer c.tuningLock.Unlock()
+	return c.rpcQueueSize, c.flushInterval
+}
+
+// Calls f once with each of the region clients of this client.
+func (c *client) eachRegionClient(f func(RegionClient)) {
+	seen := make(map[RegionClient]struct{})
+	once := func(client RegionClient) {
+		if _, ok := seen[client]; !ok && client != nil {
+			seen[client] = struct{}{}
+			f(client)
+		}
+	}
+	c.clients.m.Lock()
+	for _, client := range c.clients.clients {
+		once(client)
+	}
+	c.clients.m.Unlock()
+	once(c.metaClient)
+	if c.registry != nil {
+		c.registry.each(once)
+	}
+	c.userClients.each(once)
+}
@@ -0,0 +1,52 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/region"
+	"golang.org/x/net/context"
+)
+
+func TestTuneLiveRegionClients(t *testing.T) {
+	_, c, ctx, done := newFakeEnv(t, "test")
+	defer done()
+	get, _ := hrpc.NewGetStr(ctx, "test", "row")
+	if _, err := c.Get(get); err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+
+	// Once the pending flushes are done, queues are only flushed when over
+	// their size, which must have been changed for RPCs to go through.
+	c.SetFlushInterval(time.Hour)
+	time.Sleep(100 * time.Millisecond)
+	c.SetRpcQueueSize(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	get, _ = hrpc.NewGetStr(ctx, "test", "row")
+	if _, err := c.Get(get); err != nil {
+		t.Fatalf("Get failed after tuning: %s", err)
+	}
+
+	// New region clients get the new settings.
+	savedNewRegion := newRegion
+	defer func() { newRegion = savedNewRegion }()
+	var queueSize int
+	var flushInterval time.Duration
+	newRegion = func(res chan newRegResult, host string, port uint16, size int,
+		interval time.Duration, options ...region.Option) {
+		queueSize, flushInterval = size, interval
+		res <- newRegResult{&mockRegionClient{}, nil}
+	}
+	c.dialRegion(context.Background(), "regionserver", 16020)
+	if queueSize != 0 || flushInterval != time.Hour {
+		t.Errorf("Expected a new region client with queue size 0 and flush interval"+
+			" 1h, got %d and %s", queueSize, flushInterval)
+	}
+}
@@ -0,0 +1,582 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+	"golang.org/x/net/context"
+)
+
+var (
+	// ErrTxConflict is returned by Tx.Commit when another transaction
+	// committed a write to a cell written by the transaction after it
+	// began.  The transaction is rolled back.
+	ErrTxConflict = errors.New("transaction conflicts with another one")
+
+	// ErrTxAborted is returned by Tx.Commit when the transaction took longer
+	// than the timeout of its TxManager to commit and was invalidated by
+	// another one.  The transaction is rolled back.
+	ErrTxAborted = errors.New("transaction aborted")
+
+	// ErrTxDone is returned when using a transaction that was already
+	// committed or rolled back.
+	ErrTxDone = errors.New("transaction already committed or rolled back")
+)
+
+// States of a transaction.
+const (
+	txInProgress = "inprogress"
+	txCommitting = "committing"
+	txCommitted  = "committed"
+	txInvalid    = "invalid"
+)
+
+// Layout of the table of a TxManager.  Each transaction has a row keyed by
+// its ID, and the IDs are allocated from a counter in a row of its own.
+const (
+	txCounterRow = "counter"
+	txCounter    = "id"
+	txState      = "state"   // State of the transaction.
+	txCommit     = "commit"  // Commit ID, once committed.
+	txExpires    = "expires" // Deadline to commit, in ms since the epoch.
+)
+
+// Maximum number of versions of each cell read by transactions.
+const txMaxVersions = math.MaxInt32
+
+// Interval at which a transaction polls the state of another one that's
+// committing, until it's done.
+const txPollInterval = 10 * time.Millisecond
+
+// A TxManager runs transactions spanning several rows and tables on top of a
+// Client, for those who need cross-row atomicity and can afford the RPCs it
+// takes to coordinate through HBase.
+//
+// Transactions are given increasing IDs, which are used as the timestamps of
+// the cells they write.  IDs follow the wall clock, in milliseconds since the
+// epoch, so that those cells expire with the TTL of their family and can be
+// read along with those written outside of transactions.  They run ahead of
+// it when more than one transaction begins or commits per millisecond.  Once
+// a transaction starts to commit, it's given a commit ID from the same
+// sequence.  A transaction only sees the cells
+// written by itself and by the transactions that committed before it began
+// (snapshot isolation).  Its commit fails with ErrTxConflict if another
+// transaction committed a write to one of the cells it wrote in the meantime
+// (the first to commit wins).  The cells written by the transactions that
+// fail are deleted.
+//
+// The state of the transactions is kept in a table of its own.  The tables
+// accessed through transactions must only be written through transactions,
+// must keep enough versions of their cells for all the transactions in
+// flight, and can't hold empty values, which mark deleted cells.
+type TxManager struct {
+	client  Client
+	table   string
+	family  string
+	timeout time.Duration
+}
+
+// NewTxManager returns a TxManager keeping the state of the transactions in
+// the given family of the given table.  Transactions taking longer than the
+// given timeout to commit may be aborted by others, in case the process
+// committing them died.
+func NewTxManager(c Client, table, family string, timeout time.Duration) *TxManager {
+	return &TxManager{client: c, table: table, family: family, timeout: timeout}
+}
+
+// A Tx is a transaction, see TxManager.  It must be committed or rolled back
+// once done with, and isn't safe for concurrent use.
+type Tx struct {
+	manager *TxManager
+	id      uint64
+	state   string
+
+	// Columns written, by table and row.
+	writes map[txRow]map[string]map[string]struct{}
+
+	// Final states of the other transactions looked up.
+	states map[uint64]txStatus
+}
+
+// A row written by a transaction.
+type txRow struct {
+	table, key string
+}
+
+// The state of a transaction, as stored in its row.
+type txStatus struct {
+	state   string
+	commit  uint64
+	expires uint64
+}
+
+// Begin starts a new transaction.
+func (m *TxManager) Begin(ctx context.Context) (*Tx, error) {
+	id, err := m.nextID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	put, err := hrpc.NewPutStr(ctx, m.table, txKey(id), map[string]map[string][]byte{
+		m.family: {txState: []byte(txInProgress)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = m.client.Put(put); err != nil {
+		return nil, err
+	}
+	return &Tx{
+		manager: m,
+		id:      id,
+		state:   txInProgress,
+		writes:  make(map[txRow]map[string]map[string]struct{}),
+		states:  make(map[uint64]txStatus),
+	}, nil
+}
+
+// Allocates the next ID of the sequence of transaction and commit IDs: the
+// current time in milliseconds since the epoch, or the ID following the last
+// one allocated if it's not behind.  The counter is only set if nobody
+// allocated an ID since it was read, so that IDs stay unique when several
+// managers allocate them concurrently.
+func (m *TxManager) nextID(ctx context.Context) (uint64, error) {
+	for {
+		get, err := hrpc.NewGetStr(ctx, m.table, txCounterRow,
+			hrpc.Families(map[string][]string{m.family: {txCounter}}))
+		if err != nil {
+			return 0, err
+		}
+		resp, err := m.client.Get(get)
+		if err != nil {
+			return 0, err
+		}
+		var current []byte
+		if resp.Result != nil && len(resp.Result.Cell) == 1 {
+			current = resp.Result.Cell[0].Value
+		}
+		id := decodeUint64(current) + 1
+		if now := millis(time.Now()); now > id {
+			id = now
+		}
+
+		put, err := hrpc.NewPutStr(ctx, m.table, txCounterRow, map[string]map[string][]byte{
+			m.family: {txCounter: encodeUint64(id)},
+		})
+		if err != nil {
+			return 0, err
+		}
+		if err = put.SetCondition(m.family, txCounter, current); err != nil {
+			return 0, err
+		}
+		if ok, err := processed(m.client.Put(put)); err != nil {
+			return 0, err
+		} else if ok {
+			return id, nil
+		}
+		// Another manager allocated an ID meanwhile.
+	}
+}
+
+// Returns the key of the row of the transaction with the given ID.
+func txKey(id uint64) string {
+	return string(encodeUint64(id))
+}
+
+// Returns the state of the transaction with the given ID.  Transactions
+// unknown to the manager are reported invalid.
+func (m *TxManager) status(ctx context.Context, id uint64) (txStatus, error) {
+	get, err := hrpc.NewGetStr(ctx, m.table, txKey(id),
+		hrpc.Families(map[string][]string{m.family: nil}))
+	if err != nil {
+		return txStatus{}, err
+	}
+	resp, err := m.client.Get(get)
+	if err != nil {
+		return txStatus{}, err
+	}
+	st := txStatus{state: txInvalid}
+	if resp.Result != nil {
+		for _, cell := range resp.Result.Cell {
+			switch string(cell.Qualifier) {
+			case txState:
+				st.state = string(cell.Value)
+			case txCommit:
+				st.commit = decodeUint64(cell.Value)
+			case txExpires:
+				st.expires = decodeUint64(cell.Value)
+			}
+		}
+	}
+	return st, nil
+}
+
+// Moves the transaction with the given ID to a new state by writing the given
+// cells, provided it's in the expected state.  Returns whether it was.
+func (m *TxManager) setState(ctx context.Context, id uint64, expected string,
+	cells map[string][]byte) (bool, error) {
+	put, err := hrpc.NewPutStr(ctx, m.table, txKey(id), map[string]map[string][]byte{
+		m.family: cells,
+	})
+	if err != nil {
+		return false, err
+	}
+	if err = put.SetCondition(m.family, txState, []byte(expected)); err != nil {
+		return false, err
+	}
+	return processed(m.client.Put(put))
+}
+
+// ID returns the ID of the transaction, which is the timestamp of the cells
+// it writes.
+func (tx *Tx) ID() uint64 {
+	return tx.id
+}
+
+// Returns the state of the transaction with the given ID.  A transaction
+// that's been committing for longer than the timeout is invalidated.  If
+// wait is true, this waits for a transaction that's committing to be done.
+func (tx *Tx) status(ctx context.Context, id uint64, wait bool) (txStatus, error) {
+	if st, ok := tx.states[id]; ok {
+		return st, nil
+	}
+	for {
+		st, err := tx.manager.status(ctx, id)
+		if err != nil {
+			return txStatus{}, err
+		}
+		switch st.state {
+		case txCommitted, txInvalid:
+			tx.states[id] = st
+			return st, nil
+		case txCommitting:
+			if st.expires <= millis(time.Now()) {
+				_, err = tx.manager.setState(ctx, id, txCommitting,
+					map[string][]byte{txState: []byte(txInvalid)})
+				if err != nil {
+					return txStatus{}, err
+				}
+				continue
+			}
+			if !wait {
+				return st, nil
+			}
+			select {
+			case <-time.After(txPollInterval):
+			case <-ctx.Done():
+				return txStatus{}, ErrDeadline
+			}
+		default:
+			return st, nil
+		}
+	}
+}
+
+// Returns whether the cells written by the transaction with the given ID are
+// visible to this one.
+func (tx *Tx) visible(ctx context.Context, id uint64) (bool, error) {
+	if id == tx.id {
+		return true, nil
+	} else if id > tx.id {
+		// It began after this one, so it can't have committed before.
+		return false, nil
+	}
+	// A transaction still in progress can only get a commit ID greater than
+	// ours, but one that's committing may already have a smaller one.
+	st, err := tx.status(ctx, id, true)
+	if err != nil {
+		return false, err
+	}
+	return st.state == txCommitted && st.commit < tx.id, nil
+}
+
+// Returns the given result with only the newest version of each cell visible
+// to this transaction, and without the deleted cells.
+func (tx *Tx) filter(ctx context.Context, result *pb.Result) (*pb.Result, error) {
+	filtered := &pb.Result{}
+	if result == nil {
+		return filtered, nil
+	}
+	var family, qualifier []byte
+	var found bool
+	for _, cell := range result.Cell {
+		// The versions of a cell are sorted newest first.
+		if !bytes.Equal(cell.Family, family) || !bytes.Equal(cell.Qualifier, qualifier) {
+			family, qualifier, found = cell.Family, cell.Qualifier, false
+		}
+		if found {
+			continue
+		}
+		visible, err := tx.visible(ctx, cell.GetTimestamp())
+		if err != nil {
+			return nil, err
+		} else if !visible {
+			continue
+		}
+		found = true
+		if len(cell.Value) != 0 {
+			filtered.Cell = append(filtered.Cell, cell)
+		}
+	}
+	return filtered, nil
+}
+
+// Get returns the given row of the given table, restricted to the given
+// families (all of them if nil), as seen by this transaction.
+func (tx *Tx) Get(ctx context.Context, table, key string,
+	families map[string][]string) (*pb.Result, error) {
+	if tx.state != txInProgress {
+		return nil, ErrTxDone
+	}
+	get, err := hrpc.NewGetStr(ctx, table, key, hrpc.Families(families),
+		hrpc.MaxVersions(txMaxVersions))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := tx.manager.client.Get(get)
+	if err != nil {
+		return nil, err
+	}
+	return tx.filter(ctx, resp.Result)
+}
+
+// Scan returns the rows of the given table from startRow (inclusive) to
+// stopRow (exclusive), restricted to the given families (all of them if
+// nil), as seen by this transaction.
+func (tx *Tx) Scan(ctx context.Context, table, startRow, stopRow string,
+	families map[string][]string) ([]*pb.Result, error) {
+	if tx.state != txInProgress {
+		return nil, ErrTxDone
+	}
+	scan, err := hrpc.NewScanRangeStr(ctx, table, startRow, stopRow,
+		hrpc.Families(families), hrpc.MaxVersions(txMaxVersions))
+	if err != nil {
+		return nil, err
+	}
+	results, err := tx.manager.client.Scan(scan)
+	if err != nil {
+		return nil, err
+	}
+	var rows []*pb.Result
+	for _, result := range results {
+		result, err = tx.filter(ctx, result)
+		if err != nil {
+			return nil, err
+		}
+		if len(result.Cell) != 0 {
+			rows = append(rows, result)
+		}
+	}
+	return rows, nil
+}
+
+// Put writes the given values in the given row of the given table.  They're
+// only visible to other transactions once this one is committed.
+func (tx *Tx) Put(ctx context.Context, table, key string,
+	values map[string]map[string][]byte) error {
+	for family, qualifiers := range values {
+		for qualifier, value := range qualifiers {
+			if len(value) == 0 {
+				return fmt.Errorf("empty value for %s:%s, which would mark it deleted",
+					family, qualifier)
+			}
+		}
+	}
+	return tx.write(ctx, table, key, values)
+}
+
+// Delete deletes the given cells, by family, of the given row of the given
+// table.  Whole families can't be deleted.
+func (tx *Tx) Delete(ctx context.Context, table, key string,
+	columns map[string][]string) error {
+	values := make(map[string]map[string][]byte, len(columns))
+	for family, qualifiers := range columns {
+		if len(qualifiers) == 0 {
+			return fmt.Errorf("no qualifiers to delete in family %s", family)
+		}
+		values[family] = make(map[string][]byte, len(qualifiers))
+		for _, qualifier := range qualifiers {
+			values[family][qualifier] = []byte{}
+		}
+	}
+	return tx.write(ctx, table, key, values)
+}
+
+// Writes the given values with the ID of the transaction as timestamp.
+func (tx *Tx) write(ctx context.Context, table, key string,
+	values map[string]map[string][]byte) error {
+	if tx.state != txInProgress {
+		return ErrTxDone
+	}
+	put, err := hrpc.NewPutStr(ctx, table, key, values)
+	if err != nil {
+		return err
+	}
+	put.SetTimestamp(tx.id)
+	// Record the write first, so that it's rolled back even if it's
+	// applied despite failing.
+	row := txRow{table: table, key: key}
+	if tx.writes[row] == nil {
+		tx.writes[row] = make(map[string]map[string]struct{})
+	}
+	for family, qualifiers := range values {
+		if tx.writes[row][family] == nil {
+			tx.writes[row][family] = make(map[string]struct{})
+		}
+		for qualifier := range qualifiers {
+			tx.writes[row][family][qualifier] = struct{}{}
+		}
+	}
+	_, err = tx.manager.client.Put(put)
+	return err
+}
+
+// Returns the columns written in the given row, by family.
+func (tx *Tx) columns(row txRow) map[string][]string {
+	columns := make(map[string][]string, len(tx.writes[row]))
+	for family, qualifiers := range tx.writes[row] {
+		for qualifier := range qualifiers {
+			columns[family] = append(columns[family], qualifier)
+		}
+	}
+	return columns
+}
+
+// Commit makes the writes of this transaction visible to the transactions
+// that begin afterwards, unless it conflicts with another transaction, in
+// which case it's rolled back and ErrTxConflict is returned.  When it fails
+// with another error, the transaction may have committed, or it will be
+// aborted by the next one to come across its writes after the timeout.
+func (tx *Tx) Commit(ctx context.Context) error {
+	if tx.state != txInProgress {
+		return ErrTxDone
+	}
+	m := tx.manager
+	ok, err := m.setState(ctx, tx.id, txInProgress, map[string][]byte{
+		txState:   []byte(txCommitting),
+		txExpires: encodeUint64(millis(time.Now().Add(m.timeout))),
+	})
+	if err != nil {
+		return err
+	} else if !ok {
+		tx.rollback(ctx)
+		return ErrTxAborted
+	}
+	tx.state = txCommitting
+
+	conflict, err := tx.conflicts(ctx)
+	if err != nil {
+		return err
+	} else if conflict {
+		tx.rollback(ctx)
+		return ErrTxConflict
+	}
+
+	commit, err := m.nextID(ctx)
+	if err != nil {
+		return err
+	}
+	ok, err = m.setState(ctx, tx.id, txCommitting, map[string][]byte{
+		txState:  []byte(txCommitted),
+		txCommit: encodeUint64(commit),
+	})
+	if err != nil {
+		return err
+	} else if !ok {
+		tx.rollback(ctx)
+		return ErrTxAborted
+	}
+	tx.state = txCommitted
+	return nil
+}
+
+// Returns whether another transaction committed, or is committing, a write
+// to one of the cells written by this one since it began.  The other one
+// may see this one committing as well, in which case both abort.
+func (tx *Tx) conflicts(ctx context.Context) (bool, error) {
+	for row := range tx.writes {
+		get, err := hrpc.NewGetStr(ctx, row.table, row.key,
+			hrpc.Families(tx.columns(row)), hrpc.MaxVersions(txMaxVersions))
+		if err != nil {
+			return false, err
+		}
+		resp, err := tx.manager.client.Get(get)
+		if err != nil {
+			return false, err
+		}
+		if resp.Result == nil {
+			continue
+		}
+		for _, cell := range resp.Result.Cell {
+			id := cell.GetTimestamp()
+			if id == tx.id {
+				continue
+			}
+			st, err := tx.status(ctx, id, false)
+			if err != nil {
+				return false, err
+			}
+			if st.state == txCommitting ||
+				(st.state == txCommitted && st.commit > tx.id) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Rollback aborts this transaction and deletes the cells it wrote.
+func (tx *Tx) Rollback(ctx context.Context) error {
+	if tx.state != txInProgress {
+		return ErrTxDone
+	}
+	return tx.rollback(ctx)
+}
+
+// Marks this transaction invalid, unless it's already, and deletes the cells
+// it wrote.
+func (tx *Tx) rollback(ctx context.Context) error {
+	ok, err := tx.manager.setState(ctx, tx.id, tx.state,
+		map[string][]byte{txState: []byte(txInvalid)})
+	if err != nil {
+		return err
+	} else if !ok {
+		st, err := tx.manager.status(ctx, tx.id)
+		if err != nil {
+			return err
+		} else if st.state != txInvalid {
+			return fmt.Errorf("can't roll back transaction %d, which is %s", tx.id, st.state)
+		}
+	}
+	tx.state = txInvalid
+	for row := range tx.writes {
+		values := make(map[string]map[string][]byte)
+		for family, qualifiers := range tx.columns(row) {
+			values[family] = make(map[string][]byte, len(qualifiers))
+			for _, qualifier := range qualifiers {
+				values[family][qualifier] = nil
+			}
+		}
+		del, err := hrpc.NewDelStr(ctx, row.table, row.key, values)
+		if err != nil {
+			return err
+		}
+		del.SetTimestamp(tx.id)
+		if err = del.DeleteOneVersion(); err != nil {
+			return err
+		}
+		if _, err = tx.manager.client.Delete(del); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tsuna/gohbase/hrpc"
+)
+
+func TestTx(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	s.CreateTable("txs", []string{"t"})
+	s.CreateTable("accounts", []string{"cf"})
+	c := newFakeClient(t, s)
+	defer c.Close()
+	ctx, cancel := newTestContext()
+	defer cancel()
+	m := NewTxManager(c, "txs", "t", time.Minute)
+
+	begin := func() *Tx {
+		tx, err := m.Begin(ctx)
+		if err != nil {
+			t.Fatalf("Begin failed: %s", err)
+		}
+		return tx
+	}
+	balance := func(tx *Tx, key string) string {
+		result, err := tx.Get(ctx, "accounts", key, nil)
+		if err != nil {
+			t.Fatalf("Get of %q failed: %s", key, err)
+		}
+		if len(result.Cell) == 0 {
+			return ""
+		}
+		return string(result.Cell[0].Value)
+	}
+	put := func(tx *Tx, key, value string) {
+		err := tx.Put(ctx, "accounts", key,
+			map[string]map[string][]byte{"cf": {"balance": []byte(value)}})
+		if err != nil {
+			t.Fatalf("Put of %q failed: %s", key, err)
+		}
+	}
+
+	tx1 := begin()
+	put(tx1, "alice", "100")
+	put(tx1, "bob", "0")
+	if b := balance(tx1, "alice"); b != "100" {
+		t.Errorf("Expected the transaction to see its own write, got %q", b)
+	}
+	tx2 := begin()
+	if b := balance(tx2, "alice"); b != "" {
+		t.Errorf("Expected uncommitted writes to be invisible, got %q", b)
+	}
+	if err := tx1.Commit(ctx); err != nil {
+		t.Fatalf("Commit failed: %s", err)
+	}
+	if b := balance(tx2, "alice"); b != "" {
+		t.Errorf("Expected writes committed after Begin to be invisible, got %q", b)
+	}
+	if err := tx2.Rollback(ctx); err != nil {
+		t.Errorf("Rollback failed: %s", err)
+	}
+	if err := tx1.Commit(ctx); err != ErrTxDone {
+		t.Errorf("Expected ErrTxDone committing twice, got %v", err)
+	}
+
+	// The first to commit wins.
+	tx3 := begin()
+	tx4 := begin()
+	put(tx3, "alice", "50")
+	put(tx3, "bob", "50")
+	put(tx4, "alice", "90")
+	if err := tx3.Commit(ctx); err != nil {
+		t.Fatalf("Commit failed: %s", err)
+	}
+	if err := tx4.Commit(ctx); err != ErrTxConflict {
+		t.Errorf("Expected ErrTxConflict, got %v", err)
+	}
+	tx5 := begin()
+	if a, b := balance(tx5, "alice"), balance(tx5, "bob"); a != "50" || b != "50" {
+		t.Errorf("Expected balances 50 and 50, got %q and %q", a, b)
+	}
+	// The write of the transaction in conflict was deleted.
+	get, _ := hrpc.NewGetStr(ctx, "accounts", "alice", hrpc.MaxVersions(10))
+	resp, err := c.Get(get)
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	for _, cell := range resp.Result.Cell {
+		if cell.GetTimestamp() == tx4.ID() {
+			t.Errorf("Expected the write of the aborted transaction to be deleted, got %s", cell)
+		}
+	}
+
+	if err = tx5.Delete(ctx, "accounts", "bob", map[string][]string{"cf": {"balance"}}); err != nil {
+		t.Fatalf("Delete failed: %s", err)
+	}
+	put(tx5, "carol", "50")
+	if err = tx5.Commit(ctx); err != nil {
+		t.Fatalf("Commit failed: %s", err)
+	}
+	tx6 := begin()
+	results, err := tx6.Scan(ctx, "accounts", "", "", nil)
+	if err != nil {
+		t.Fatalf("Scan failed: %s", err)
+	}
+	var rows []string
+	for _, result := range results {
+		rows = append(rows, string(result.Cell[0].Row))
+	}
+	if len(rows) != 2 || rows[0] != "alice" || rows[1] != "carol" {
+		t.Errorf("Expected the rows of alice and carol, got %q", rows)
+	}
+
+	err = tx6.Put(ctx, "accounts", "dave", map[string]map[string][]byte{"cf": {"balance": nil}})
+	if err == nil {
+		t.Error("Expected an error putting an empty value")
+	}
+	put(tx6, "dave", "10")
+	if err = tx6.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback failed: %s", err)
+	}
+	if b := balance(begin(), "dave"); b != "" {
+		t.Errorf("Expected the write of a rolled back transaction to be invisible, got %q", b)
+	}
+	if _, err = tx6.Get(ctx, "accounts", "dave", nil); err != ErrTxDone {
+		t.Errorf("Expected ErrTxDone after Rollback, got %v", err)
+	}
+}
+
+func TestTxCommittingExpired(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	s.CreateTable("txs", []string{"t"})
+	s.CreateTable("accounts", []string{"cf"})
+	c := newFakeClient(t, s)
+	defer c.Close()
+	ctx, cancel := newTestContext()
+	defer cancel()
+	m := NewTxManager(c, "txs", "t", time.Minute)
+
+	// A transaction whose committer died right after it started to commit.
+	dead, err := m.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin failed: %s", err)
+	}
+	err = dead.Put(ctx, "accounts", "alice",
+		map[string]map[string][]byte{"cf": {"balance": []byte("100")}})
+	if err != nil {
+		t.Fatalf("Put failed: %s", err)
+	}
+	ok, err := m.setState(ctx, dead.ID(), txInProgress, map[string][]byte{
+		txState:   []byte(txCommitting),
+		txExpires: encodeUint64(millis(time.Now().Add(-time.Second))),
+	})
+	if err != nil || !ok {
+		t.Fatalf("Failed to mark the transaction committing: %v", err)
+	}
+
+	tx, err := m.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin failed: %s", err)
+	}
+	result, err := tx.Get(ctx, "accounts", "alice", nil)
+	if err != nil {
+		t.Fatalf("Get failed: %s", err)
+	}
+	if len(result.Cell) != 0 {
+		t.Errorf("Expected the write of the expired transaction to be invisible, got %v", result)
+	}
+	if st, err := m.status(ctx, dead.ID()); err != nil || st.state != txInvalid {
+		t.Errorf("Expected the expired transaction to be invalidated, got %v, %v", st, err)
+	}
+}
+
+func TestTxIDsFollowWallClock(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	s.CreateTable("txs", []string{"t"})
+	c := newFakeClient(t, s)
+	defer c.Close()
+	ctx, cancel := newTestContext()
+	defer cancel()
+	m := NewTxManager(c, "txs", "t", time.Minute)
+
+	start := millis(time.Now())
+	var last uint64
+	for i := 0; i < 10; i++ {
+		id, err := m.nextID(ctx)
+		if err != nil {
+			t.Fatalf("Failed to allocate an ID: %s", err)
+		}
+		if id <= last {
+			t.Fatalf("Expected IDs to increase, got %d after %d", id, last)
+		}
+		last = id
+	}
+	// IDs run ahead of the clock by at most one per allocation.
+	if end := millis(time.Now()); last < start || last > end+10 {
+		t.Errorf("Expected the last ID to be the time in ms, between %d and %d, got %d",
+			start, end+10, last)
+	}
+}
+
+func TestTxIDsConcurrentManagers(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	s.CreateTable("txs", []string{"t"})
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	// Managers of separate clients allocate IDs from the same counter,
+	// starting from an empty one.
+	const managers, perManager = 4, 10
+	start := millis(time.Now())
+	ids := make(chan uint64, managers*perManager)
+	errs := make(chan error, managers)
+	for i := 0; i < managers; i++ {
+		c := newFakeClient(t, s)
+		defer c.Close()
+		m := NewTxManager(c, "txs", "t", time.Minute)
+		go func() {
+			for j := 0; j < perManager; j++ {
+				id, err := m.nextID(ctx)
+				if err != nil {
+					errs <- err
+					return
+				}
+				ids <- id
+			}
+			errs <- nil
+		}()
+	}
+	for i := 0; i < managers; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("Failed to allocate an ID: %s", err)
+		}
+	}
+	close(ids)
+
+	seen := make(map[uint64]bool)
+	end := millis(time.Now()) + managers*perManager
+	for id := range ids {
+		if seen[id] {
+			t.Errorf("ID %d was allocated twice", id)
+		}
+		seen[id] = true
+		if id < start || id > end {
+			t.Errorf("Expected ID %d to be the time in ms, between %d and %d", id, start, end)
+		}
+	}
+}
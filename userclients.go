@@ -0,0 +1,66 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"sync"
+
+	"github.com/tsuna/gohbase/region"
+	"golang.org/x/net/context"
+)
+
+// The effective user of a connection to a RegionServer is set once and for
+// all when it's opened, so RPCs made on behalf of another user (see
+// hrpc.EffectiveUser) are sent over connections dedicated to that user.
+// userClients holds those connections, in a registry per user.
+type userClients struct {
+	m sync.Mutex
+
+	registries map[string]*RegionClientRegistry
+}
+
+// Returns the client connected to the given RegionServer on behalf of the
+// given user, connecting if needed.
+func (c *client) userClient(ctx context.Context, host string, port uint16,
+	user string) (RegionClient, error) {
+	c.userClients.m.Lock()
+	if c.userClients.registries == nil {
+		c.userClients.registries = make(map[string]*RegionClientRegistry)
+	}
+	registry := c.userClients.registries[user]
+	if registry == nil {
+		registry = NewRegionClientRegistry()
+		c.userClients.registries[user] = registry
+	}
+	c.userClients.m.Unlock()
+
+	return registry.get(ctx, host, port, c.connsPerServer,
+		func(ctx context.Context, host string, port uint16) (RegionClient, error) {
+			options := make([]region.Option, len(c.regionOptions), len(c.regionOptions)+1)
+			copy(options, c.regionOptions)
+			options = append(options, region.EffectiveUser(user))
+			return c.dialRegionWith(ctx, host, port, options)
+		})
+}
+
+// Closes all the connections opened on behalf of other users.
+func (u *userClients) close() {
+	u.m.Lock()
+	for user, registry := range u.registries {
+		registry.Close()
+		delete(u.registries, user)
+	}
+	u.m.Unlock()
+}
+
+// Calls f with each of the connections opened on behalf of other users.
+func (u *userClients) each(f func(RegionClient)) {
+	u.m.Lock()
+	for _, registry := range u.registries {
+		registry.each(f)
+	}
+	u.m.Unlock()
+}
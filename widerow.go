@@ -0,0 +1,139 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/tsuna/gohbase/filter"
+	"github.com/tsuna/gohbase/hrpc"
+	"github.com/tsuna/gohbase/pb"
+)
+
+// WideRowCells iterates over the cells of a row fetched a page of columns at
+// a time, see GetWideRow.
+type WideRowCells struct {
+	client   Client
+	get      *hrpc.Get
+	pageSize int
+
+	// Cells fetched but not returned yet.
+	cells []*pb.Cell
+	// Family and qualifier of the last column fetched, nil before the first
+	// page.
+	family    []byte
+	qualifier []byte
+	// Whether the rest of the family of the last column still has to be
+	// fetched.
+	inFamily bool
+	done     bool
+}
+
+// GetWideRow returns an iterator over the cells of the row of the given Get,
+// which are fetched pageSize columns at a time with as many Gets as needed,
+// so that rows with millions of columns can be read without holding them in
+// memory on either side.  The families, filter, max versions and user of the
+// Get are used by each of them.  Unlike a single Get, the row isn't read
+// atomically: it may change between pages.
+func GetWideRow(c Client, get *hrpc.Get, pageSize int) (*WideRowCells, error) {
+	if pageSize < 1 {
+		return nil, errors.New("the page size must be positive")
+	}
+	if get.IsClosestBefore() || get.IsExistsOnly() {
+		return nil, errors.New("wide rows can only be read with plain Gets")
+	}
+	return &WideRowCells{client: c, get: get, pageSize: pageSize}, nil
+}
+
+// Next returns the next cell of the row, in the order of their families and
+// qualifiers, or io.EOF once all the cells have been returned.
+func (w *WideRowCells) Next() (*pb.Cell, error) {
+	for len(w.cells) == 0 {
+		if w.done {
+			return nil, io.EOF
+		}
+		if err := w.fetch(); err != nil {
+			return nil, err
+		}
+	}
+	cell := w.cells[0]
+	w.cells = w.cells[1:]
+	return cell, nil
+}
+
+// Fetches the next page of columns.  Within a family, the next page starts
+// right after the last qualifier fetched.  Once a family is exhausted, the
+// next page starts with the next family: paging through several families at
+// once isn't possible, as the column offset of ColumnPaginationFilter applies
+// to each of them.
+func (w *WideRowCells) fetch() error {
+	pagination := filter.NewColumnPaginationFilter(int32(w.pageSize), 0, nil)
+	families := w.get.GetFamilies()
+	var filters []filter.Filter
+	if w.get.GetFilter() != nil {
+		filters = append(filters, w.get.GetFilter())
+	}
+	if w.inFamily {
+		// A zero byte makes the offset the smallest qualifier after the
+		// last one.
+		offset := append(append([]byte(nil), w.qualifier...), 0)
+		pagination = filter.NewColumnPaginationFilter(int32(w.pageSize), 0, offset)
+		families = map[string][]string{string(w.family): nil}
+		if qualifiers, ok := w.get.GetFamilies()[string(w.family)]; ok {
+			families[string(w.family)] = qualifiers
+		}
+	} else if w.family != nil {
+		filters = append(filters, filter.NewFamilyFilter(filter.NewCompareFilter(
+			filter.Greater, filter.NewBinaryComparator(filter.NewByteArrayComparable(w.family)))))
+	}
+	filters = append(filters, pagination)
+	var f filter.Filter = filters[0]
+	if len(filters) > 1 {
+		f = filter.NewList(filter.MustPassAll, filters...)
+	}
+	options := []func(hrpc.Call) error{
+		hrpc.Filters(f),
+		hrpc.MaxVersions(w.get.GetMaxVersions()),
+		hrpc.EffectiveUser(w.get.User()),
+		hrpc.Tenant(w.get.Tenant()),
+	}
+	if families != nil {
+		options = append(options, hrpc.Families(families))
+	}
+	page, err := hrpc.NewGet(w.get.GetContext(), w.get.Table(), w.get.Key(), options...)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Get(page)
+	w.get.AddMetadata(page.Metadata())
+	if err != nil {
+		return err
+	}
+	var cells []*pb.Cell
+	if resp.Result != nil {
+		cells = resp.Result.Cell
+	}
+	columns := 0
+	for i, cell := range cells {
+		if i == 0 || !bytes.Equal(cell.Family, w.family) ||
+			!bytes.Equal(cell.Qualifier, w.qualifier) {
+			columns++
+		}
+		w.family, w.qualifier = cell.Family, cell.Qualifier
+	}
+	w.cells = cells
+	if columns < w.pageSize {
+		// A short page ends the family, or the row if it was fetched
+		// across families.
+		w.done = !w.inFamily
+		w.inFamily = false
+	} else {
+		w.inFamily = true
+	}
+	return nil
+}
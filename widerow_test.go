@@ -0,0 +1,90 @@
+// Copyright (C) 2015  The GoHBase Authors.  All rights reserved.
+// This file is part of GoHBase.
+// Use of this source code is governed by the Apache License 2.0
+// that can be found in the COPYING file.
+
+package gohbase
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/tsuna/gohbase/hrpc"
+)
+
+func TestGetWideRow(t *testing.T) {
+	s := newFakeServer(t)
+	defer s.Close()
+	s.CreateTable("test", []string{"a", "b", "c"})
+	c := newFakeClient(t, s)
+	defer c.Close()
+	ctx, cancel := newTestContext()
+	defer cancel()
+
+	values := map[string]map[string][]byte{"a": {}, "c": {}}
+	var all []string
+	for i := 0; i < 7; i++ {
+		values["a"][fmt.Sprint("q", i)] = []byte(fmt.Sprint(i))
+		all = append(all, fmt.Sprintf("a:q%d", i))
+	}
+	var inC []string
+	for i := 0; i < 5; i++ {
+		values["c"][fmt.Sprint("q", i)] = []byte(fmt.Sprint(i))
+		inC = append(inC, fmt.Sprintf("c:q%d", i))
+	}
+	all = append(all, inC...)
+	put, _ := hrpc.NewPutStr(ctx, "test", "wide", values)
+	if _, err := c.Put(put); err != nil {
+		t.Fatalf("Put failed: %s", err)
+	}
+	put, _ = hrpc.NewPutStr(ctx, "test", "other", values)
+	if _, err := c.Put(put); err != nil {
+		t.Fatalf("Put failed: %s", err)
+	}
+
+	testcases := []struct {
+		families map[string][]string
+		pageSize int
+		expected []string
+	}{
+		{pageSize: 1, expected: all},
+		{pageSize: 3, expected: all},
+		{pageSize: 7, expected: all},
+		{pageSize: 100, expected: all},
+		{families: map[string][]string{"c": nil}, pageSize: 2, expected: inC},
+		{families: map[string][]string{"b": nil}, pageSize: 2},
+	}
+	for i, testcase := range testcases {
+		get, _ := hrpc.NewGetStr(ctx, "test", "wide")
+		if testcase.families != nil {
+			get.SetFamilies(testcase.families)
+		}
+		cells, err := GetWideRow(c, get, testcase.pageSize)
+		if err != nil {
+			t.Fatalf("[#%d] GetWideRow failed: %s", i, err)
+		}
+		var columns []string
+		for {
+			cell, err := cells.Next()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("[#%d] Next failed: %s", i, err)
+			}
+			if string(cell.Row) != "wide" {
+				t.Errorf("[#%d] Unexpected row %q", i, cell.Row)
+			}
+			columns = append(columns, string(cell.Family)+":"+string(cell.Qualifier))
+		}
+		if !reflect.DeepEqual(columns, testcase.expected) {
+			t.Errorf("[#%d] Expected %q, got %q", i, testcase.expected, columns)
+		}
+	}
+
+	get, _ := hrpc.NewGetStr(ctx, "test", "wide")
+	if _, err := GetWideRow(c, get, 0); err == nil {
+		t.Error("Expected an error for an invalid page size")
+	}
+}
@@ -27,41 +27,81 @@ const (
 
 // LocateMeta returns the location of the meta table.
 func LocateMeta(zkquorum string) (string, uint16, error) {
+	meta := &pb.MetaRegionServer{}
+	if err := getNode(zkquorum, "meta-region-server", meta); err != nil {
+		return "", 0, err
+	}
+	server := meta.Server
+	return *server.HostName, uint16(*server.Port), nil
+}
+
+// LocateMaster returns the location of the active HBase Master.
+func LocateMaster(zkquorum string) (string, uint16, error) {
+	master := &pb.Master{}
+	if err := getNode(zkquorum, "master", master); err != nil {
+		return "", 0, err
+	}
+	server := master.Master
+	return *server.HostName, uint16(*server.Port), nil
+}
+
+// ClusterID returns the ID of the HBase cluster, which is the service of its
+// delegation tokens.
+func ClusterID(zkquorum string) (string, error) {
+	id := &pb.ClusterId{}
+	if err := getNode(zkquorum, "hbaseid", id); err != nil {
+		return "", err
+	}
+	return id.GetClusterId(), nil
+}
+
+// TableState returns the state of the given table.  Tables without a znode,
+// which is the case of tables that were never disabled, are enabled.
+func TableState(zkquorum, table string) (pb.Table_State, error) {
+	state := &pb.Table{}
+	err := getNode(zkquorum, "table/"+table, state)
+	if err == zk.ErrNoNode {
+		return pb.Table_ENABLED, nil
+	} else if err != nil {
+		return pb.Table_ENABLED, err
+	}
+	return state.GetState(), nil
+}
+
+// getNode reads the given znode and deserializes it into the given message.
+// It returns zk.ErrNoNode as is if the znode doesn't exist.
+func getNode(zkquorum, node string, msg proto.Message) error {
 	zks := strings.Split(zkquorum, ",")
 	zkconn, _, err := zk.Connect(zks, time.Duration(sessionTimeout)*time.Second)
 	if err != nil {
-		return "", 0,
-			fmt.Errorf("Error connecting to ZooKeeper at %v: %s", zks, err)
+		return fmt.Errorf("Error connecting to ZooKeeper at %v: %s", zks, err)
 	}
 	defer zkconn.Close()
-	buf, _, err := zkconn.Get(znode + "/meta-region-server")
-	if err != nil {
-		return "", 0,
-			fmt.Errorf("Failed to read the meta-region-server znode: %s", err)
+	buf, _, err := zkconn.Get(znode + "/" + node)
+	if err == zk.ErrNoNode {
+		return err
+	} else if err != nil {
+		return fmt.Errorf("Failed to read the %s znode: %s", node, err)
 	}
 	if len(buf) == 0 {
-		log.Fatal("meta-region-server was empty!")
+		log.Fatalf("%s was empty!", node)
 	} else if buf[0] != 0xFF {
-		return "", 0,
-			fmt.Errorf("The first byte of meta-region-server was 0x%x, not 0xFF", buf[0])
+		return fmt.Errorf("The first byte of %s was 0x%x, not 0xFF", node, buf[0])
 	}
 	metadataLen := binary.BigEndian.Uint32(buf[1:])
 	if metadataLen < 1 || metadataLen > 65000 {
-		return "", 0, fmt.Errorf("Invalid metadata length: %d", metadataLen)
+		return fmt.Errorf("Invalid metadata length: %d", metadataLen)
 	}
 	buf = buf[1+4+metadataLen:]
 	magic := binary.BigEndian.Uint32(buf)
 	const pbufMagic = 1346524486 // 4 bytes: "PBUF"
 	if magic != pbufMagic {
-		return "", 0, fmt.Errorf("Invalid magic number: %d", magic)
+		return fmt.Errorf("Invalid magic number: %d", magic)
 	}
 	buf = buf[4:]
-	meta := &pb.MetaRegionServer{}
-	err = proto.UnmarshalMerge(buf, meta)
+	err = proto.UnmarshalMerge(buf, msg)
 	if err != nil {
-		return "", 0,
-			fmt.Errorf("Failed to deserialize the MetaRegionServer entry from ZK: %s", err)
+		return fmt.Errorf("Failed to deserialize the %s entry from ZK: %s", node, err)
 	}
-	server := meta.Server
-	return *server.HostName, uint16(*server.Port), nil
+	return nil
 }